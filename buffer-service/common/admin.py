@@ -0,0 +1,96 @@
+"""
+Admin API shared by router and consumer.
+
+Served on its own port so it never shadows proxied paths. The operator pushes
+every new schedule here and reads back the acknowledged version. The router
+also serves its per-client carbon attribution report and its carbon savings.
+
+Every call must carry the ADMIN_TOKEN the operator generates for the service
+as a bearer token; without one the API refuses everything. It listens on
+POD_IP, set by the operator, rather than on every interface.
+"""
+from __future__ import annotations
+
+import hmac
+import json
+import os
+from typing import Any, Dict
+
+import uvicorn
+from fastapi import Depends, FastAPI, HTTPException, Request
+
+from .attribution import AttributionLedger
+from .savings import SavingsLedger
+from .schedule import TrafficScheduleManager
+
+__all__ = ["create_admin_app", "admin_server"]
+
+
+ADMIN_TOKEN: str = os.getenv("ADMIN_TOKEN", "").strip()
+
+
+def _authorize(request: Request) -> None:
+    scheme, _, token = request.headers.get("Authorization", "").partition(" ")
+    accepted = scheme.lower() == "bearer" and hmac.compare_digest(token.strip().encode(), ADMIN_TOKEN.encode())
+    if not ADMIN_TOKEN or not accepted:
+        raise HTTPException(status_code=401, detail="unauthorized")
+
+
+def create_admin_app(
+    schedule_manager: TrafficScheduleManager,
+    ledger: AttributionLedger | None = None,
+    savings: SavingsLedger | None = None,
+) -> FastAPI:
+    admin = FastAPI(dependencies=[Depends(_authorize)])
+
+    @admin.post("/admin/schedule")
+    async def push_schedule(request: Request) -> Dict[str, Any]:
+        try:
+            payload = await request.json()
+        except json.JSONDecodeError as exc:
+            raise HTTPException(status_code=400, detail="invalid JSON body") from exc
+        version = payload.get("version")
+        status = payload.get("schedule")
+        if not isinstance(version, str) or not isinstance(status, dict):
+            raise HTTPException(status_code=400, detail="version and schedule are required")
+        if not status.get("flavours"):
+            raise HTTPException(status_code=422, detail="schedule has no flavours")
+        await schedule_manager.apply_pushed(status, version, payload.get("pinned") is True)
+        return {"version": version}
+
+    @admin.get("/admin/schedule")
+    async def schedule_version() -> Dict[str, Any]:
+        return {"version": await schedule_manager.version()}
+
+    if ledger is not None:
+
+        @admin.get("/admin/attribution")
+        async def attribution_report() -> Dict[str, Any]:
+            return ledger.report()
+
+    if savings is not None:
+
+        @admin.get("/admin/savings")
+        async def savings_report() -> Dict[str, Any]:
+            return savings.report()
+
+    return admin
+
+
+def admin_server(
+    schedule_manager: TrafficScheduleManager,
+    port: int,
+    log_level: str = "warning",
+    ledger: AttributionLedger | None = None,
+    savings: SavingsLedger | None = None,
+) -> uvicorn.Server:
+    """Build the uvicorn server for the admin API; the caller schedules serve()."""
+    return uvicorn.Server(
+        uvicorn.Config(
+            create_admin_app(schedule_manager, ledger, savings),
+            host=os.getenv("POD_IP", "0.0.0.0"),
+            port=port,
+            lifespan="off",
+            log_level=log_level,
+        )
+    )
@@ -0,0 +1,115 @@
+"""
+Per-request carbon attribution shared by router and consumer.
+
+When enabled by the operator, every request is annotated with the grid carbon
+intensity and the precision that served it. The router aggregates them per API
+client so carbon can be charged back to consumers.
+
+Client ids come from a request header any caller sets, so they never become
+labels or report keys as they are: only the ids in ATTRIBUTION_CLIENTS are kept,
+the others reported as "other", and without that allow-list every id is hashed
+into one of CLIENT_BUCKETS buckets. Both bound the metrics and the report.
+"""
+from __future__ import annotations
+
+import hashlib
+import os
+import threading
+from typing import Any, Dict
+
+from prometheus_client import Counter
+
+__all__ = [
+    "ATTRIBUTION_ENABLED",
+    "CLIENT_HEADER",
+    "INTENSITY_HEADER",
+    "PRECISION_HEADER",
+    "AttributionLedger",
+    "current_intensity",
+]
+
+ATTRIBUTION_ENABLED: bool = os.getenv("CARBON_ATTRIBUTION_ENABLED", "false").lower() == "true"
+CLIENT_HEADER: str = os.getenv("ATTRIBUTION_CLIENT_HEADER", "x-client-id").lower()
+
+INTENSITY_HEADER = "x-carbonrouter-intensity"
+PRECISION_HEADER = "x-carbonrouter-precision"
+ANONYMOUS_CLIENT = "anonymous"
+OTHER_CLIENT = "other"
+CLIENT_BUCKETS = 64
+
+ALLOWED_CLIENTS: frozenset[str] = frozenset(
+    client.strip() for client in os.getenv("ATTRIBUTION_CLIENTS", "").split(",") if client.strip()
+)
+
+ATTRIBUTED_REQUESTS = Counter(
+    "carbon_attributed_requests_total",
+    "Requests attributed to an API client",
+    ["client", "precision"],
+)
+ATTRIBUTED_INTENSITY = Counter(
+    "carbon_attributed_intensity_total",
+    "Sum of the grid carbon intensity (gCO2/kWh) of the requests attributed to an API client",
+    ["client", "precision"],
+)
+
+
+def client_label(client: str | None, allowed: frozenset[str] = ALLOWED_CLIENTS) -> str:
+    """Return the bounded name `client` is reported under.
+
+    Without an allow-list, ids go to "bucket-NN", NN being the first 8 bytes of
+    their SHA-256 modulo CLIENT_BUCKETS, so a client can find its own bucket.
+    """
+    if not client:
+        return ANONYMOUS_CLIENT
+    if allowed:
+        return client if client in allowed else OTHER_CLIENT
+    digest = hashlib.sha256(client.encode()).digest()
+    return f"bucket-{int.from_bytes(digest[:8], 'big') % CLIENT_BUCKETS:02d}"
+
+
+def current_intensity(schedule: Dict[str, Any]) -> float | None:
+    """Return the current grid intensity from a TrafficSchedule status, if known."""
+    try:
+        return float(schedule.get("carbonForecastNow"))
+    except (TypeError, ValueError):
+        return None
+
+
+class AttributionLedger:
+    """Aggregates attributed requests per client for the admin report.
+
+    Clients are reported under client_label, which bounds the map.
+    """
+
+    def __init__(self) -> None:
+        self._lock = threading.Lock()
+        self._clients: dict[str, dict[str, Any]] = {}
+
+    def record(self, client: str | None, precision: str, intensity: float | None) -> None:
+        client = client_label(client)
+        ATTRIBUTED_REQUESTS.labels(client, precision).inc()
+        if intensity is not None:
+            ATTRIBUTED_INTENSITY.labels(client, precision).inc(intensity)
+        with self._lock:
+            entry = self._clients.setdefault(
+                client, {"requests": 0, "measured": 0, "intensitySum": 0.0, "precisions": {}}
+            )
+            entry["requests"] += 1
+            entry["precisions"][precision] = entry["precisions"].get(precision, 0) + 1
+            if intensity is not None:
+                entry["measured"] += 1
+                entry["intensitySum"] += intensity
+
+    def report(self) -> Dict[str, Any]:
+        """Per-client totals; avgIntensity only covers requests with a known intensity."""
+        with self._lock:
+            clients = {}
+            for client, entry in self._clients.items():
+                measured = entry["measured"]
+                clients[client] = {
+                    "requests": entry["requests"],
+                    "precisions": dict(entry["precisions"]),
+                    "intensitySum": entry["intensitySum"],
+                    "avgIntensity": entry["intensitySum"] / measured if measured else None,
+                }
+        return {"clients": clients}
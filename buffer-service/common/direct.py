@@ -0,0 +1,90 @@
+"""
+Broker-less transport: the router forwards every request to the target
+service itself and answers with its response. Nothing is queued or deferred;
+the router joins the mesh instead of the consumer, so the schedule weights of
+the routing backend pick the precision of each request, unless its client
+forced one with the routing header.
+"""
+from __future__ import annotations
+
+import asyncio
+import json
+import os
+from typing import Dict
+
+import httpx
+
+from common.identity import IDENTITY_ENABLED, client_context, reload_forever
+from common.transport import TARGET_SVC_NAME, TARGET_SVC_NAMESPACE, Handler, Transport
+from common.utils import b64dec, b64enc, debug, log
+
+TARGET_SVC_SCHEME: str = os.getenv("TARGET_SVC_SCHEME", "http")
+TARGET_SVC_PORT: str | None = os.getenv("TARGET_SVC_PORT")
+TARGET_BASE_URL: str = (
+    f"{TARGET_SVC_SCHEME}://{TARGET_SVC_NAME}.{TARGET_SVC_NAMESPACE}.svc.cluster.local"
+    + (f":{TARGET_SVC_PORT}" if TARGET_SVC_PORT else "")
+)
+
+
+class DirectTransport(Transport):
+    def __init__(self, prefetch: int = 0) -> None:
+        self._client: httpx.AsyncClient | None = None
+        self._reload_task: asyncio.Task | None = None
+
+    def _get_client(self) -> httpx.AsyncClient:
+        if self._client is None:
+            tls_context = client_context() if IDENTITY_ENABLED else None
+            if tls_context is not None:
+                self._reload_task = asyncio.create_task(reload_forever(tls_context))
+                log.info("Calling %s with mutual TLS", TARGET_BASE_URL)
+            self._client = httpx.AsyncClient(
+                http2=True,
+                limits=httpx.Limits(max_connections=128, max_keepalive_connections=32),
+                verify=tls_context if tls_context is not None else True,
+            )
+        return self._client
+
+    async def request(
+        self, q_type: str, flavour: str, body: bytes, headers: Dict[str, str], timeout: float
+    ) -> bytes:
+        payload = json.loads(body)
+        # The host of the target, so the sidecar applies its routes
+        request_headers = {
+            key: value for key, value in payload.get("headers", {}).items() if key.lower() != "host"
+        }
+        try:
+            response = await self._get_client().request(
+                method=payload["method"],
+                url=f"{TARGET_BASE_URL}{payload['path']}",
+                params=payload.get("query"),
+                headers=request_headers,
+                content=b64dec(payload["body"]),
+                timeout=timeout,
+            )
+        except httpx.TimeoutException as exc:
+            raise asyncio.TimeoutError from exc
+        except httpx.HTTPError as exc:
+            debug(f"Forward failed: {exc}")
+            return json.dumps(
+                {
+                    "status": 502,
+                    "headers": {"content-type": "application/json"},
+                    "body": b64enc(json.dumps({"error": str(exc)}).encode()),
+                }
+            ).encode()
+        return json.dumps(
+            {
+                "status": response.status_code,
+                "headers": dict(response.headers),
+                "body": b64enc(response.content),
+            }
+        ).encode()
+
+    async def consume(self, q_type: str, flavour: str, handler: Handler) -> None:
+        raise RuntimeError("BROKER_TYPE=none has no queues to consume")
+
+    async def close(self) -> None:
+        if self._reload_task is not None:
+            self._reload_task.cancel()
+        if self._client is not None:
+            await self._client.aclose()
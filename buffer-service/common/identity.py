@@ -0,0 +1,92 @@
+"""
+Workload identity issued by the operator through cert-manager.
+
+When the operator enables identities, the router and consumer get a
+SPIFFE-compatible certificate mounted from a Secret. The consumer presents it
+to the target service over mutual TLS and the router serves its entrypoint with
+it, so the buffered path stays authenticated outside the mesh. cert-manager
+rotates the Secret in place; the contexts below pick up the new files.
+"""
+from __future__ import annotations
+
+import asyncio
+import os
+import ssl
+from typing import Any
+
+from .utils import log
+
+__all__ = [
+    "IDENTITY_ENABLED",
+    "client_context",
+    "server_context",
+    "install_server_context",
+    "reload_forever",
+]
+
+TLS_CERT_FILE: str | None = os.getenv("TLS_CERT_FILE")
+TLS_KEY_FILE: str | None = os.getenv("TLS_KEY_FILE")
+TLS_CA_FILE: str | None = os.getenv("TLS_CA_FILE")
+TLS_CLIENT_AUTH: str = os.getenv("TLS_CLIENT_AUTH", "").lower()
+RELOAD_INTERVAL_SEC: float = float(os.getenv("TLS_RELOAD_INTERVAL_SEC", "60"))
+
+IDENTITY_ENABLED: bool = bool(TLS_CERT_FILE and TLS_KEY_FILE)
+
+
+def _load(context: ssl.SSLContext) -> None:
+    context.load_cert_chain(TLS_CERT_FILE, TLS_KEY_FILE)
+    if TLS_CA_FILE and os.path.exists(TLS_CA_FILE):
+        context.load_verify_locations(TLS_CA_FILE)
+
+
+def client_context() -> ssl.SSLContext:
+    """Context presenting the workload certificate and trusting the issuer CA."""
+    context = ssl.create_default_context(ssl.Purpose.SERVER_AUTH)
+    _load(context)
+    return context
+
+
+def server_context() -> ssl.SSLContext:
+    """Context serving the workload certificate. With TLS_CLIENT_AUTH=required
+    callers must present a certificate from the issuer CA; otherwise client
+    certificates are not asked for, as an optional one authenticates nothing."""
+    context = ssl.create_default_context(ssl.Purpose.CLIENT_AUTH)
+    if TLS_CLIENT_AUTH == "required":
+        if not TLS_CA_FILE:
+            raise RuntimeError("TLS_CLIENT_AUTH=required needs TLS_CA_FILE")
+        context.verify_mode = ssl.CERT_REQUIRED
+    else:
+        context.verify_mode = ssl.CERT_NONE
+    _load(context)
+    return context
+
+
+def _mtime() -> float:
+    return max(os.path.getmtime(path) for path in (TLS_CERT_FILE, TLS_KEY_FILE) if path)
+
+
+async def reload_forever(*contexts: ssl.SSLContext) -> None:
+    """Reload the certificate into contexts whenever the mounted files change.
+    New handshakes use the rotated certificate; open connections keep theirs."""
+    last = _mtime()
+    while True:
+        await asyncio.sleep(RELOAD_INTERVAL_SEC)
+        try:
+            current = _mtime()
+            if current == last:
+                continue
+            for context in contexts:
+                _load(context)
+            last = current
+            log.info("Reloaded workload certificate from %s", TLS_CERT_FILE)
+        except (OSError, ssl.SSLError) as exc:
+            # The Secret volume is swapped atomically, but retry on a torn read
+            log.warning("Failed to reload workload certificate: %s", exc)
+
+
+def install_server_context(config: Any, context: ssl.SSLContext) -> None:
+    """Make a uvicorn.Config serve TLS with a context reload_forever can update.
+    uvicorn only builds its own context from files, which is never reloaded."""
+    if not config.loaded:
+        config.load()
+    config.ssl = context
@@ -0,0 +1,188 @@
+"""
+NATS JetStream transport: the queues of a service are the subjects
+"<exchange>.<queue>" of one work-queue stream, each read by a durable pull
+consumer named after the queue, whose pending messages KEDA scales on. Replies
+go straight to the inbox of the router over core NATS.
+
+Stream and consumer names take underscores for the characters NATS forbids,
+the same rule the operator applies when it renders the KEDA triggers.
+
+A consumer reports progress on the messages it is still handling every third
+of NATS_ACK_WAIT_SEC, so slow requests are not redelivered while in flight.
+"""
+from __future__ import annotations
+
+import asyncio
+import os
+import re
+import uuid
+from typing import Dict
+
+import nats
+from nats.errors import TimeoutError as NATSTimeoutError
+from nats.js.api import ConsumerConfig, RetentionPolicy
+from nats.js.errors import BadRequestError
+
+from common.transport import EXCHANGE_NAME, Delivery, Handler, Transport, queue_name
+from common.utils import debug, log
+
+
+def nats_name(name: str) -> str:
+    """Stream or consumer name of a queue or exchange name."""
+    return re.sub(r"[^A-Za-z0-9_-]", "_", name)
+
+
+NATS_SERVERS: str = os.getenv("NATS_SERVERS", "nats://nats:4222")
+NATS_STREAM: str = os.getenv("NATS_STREAM", nats_name(EXCHANGE_NAME))
+# Redelivery delay of unacknowledged requests, longer than a forward with retries
+NATS_ACK_WAIT_SEC: float = float(os.getenv("NATS_ACK_WAIT_SEC", "120"))
+FETCH_TIMEOUT_SEC = 5.0
+
+
+def subject(q_type: str, flavour: str) -> str:
+    return f"{EXCHANGE_NAME}.{queue_name(q_type, flavour)}"
+
+
+class NATSDelivery(Delivery):
+    def __init__(self, msg, connection) -> None:
+        self._msg = msg
+        self._connection = connection
+        self.body = msg.data
+        self.headers = dict(msg.headers or {})
+
+    async def reply(self, body: bytes) -> None:
+        reply_to = self.headers.get("reply_to")
+        if reply_to:
+            await self._connection.publish(reply_to, body)
+        await self._msg.ack()
+
+    async def requeue(self) -> None:
+        await self._msg.nak()
+
+
+class NATSTransport(Transport):
+    def __init__(self, prefetch: int = 0) -> None:
+        self._prefetch = prefetch
+        self._lock = asyncio.Lock()
+        self._connection = None
+        self._jetstream = None
+        self._inbox: str | None = None
+        self._pending: Dict[str, asyncio.Future] = {}
+        self._inflight = asyncio.Semaphore(prefetch) if prefetch else None
+
+    async def _connect(self):
+        """Connects and creates the stream of the service, once."""
+        async with self._lock:
+            if self._jetstream is not None:
+                return self._jetstream
+            self._connection = await nats.connect(
+                servers=NATS_SERVERS.split(","),
+                user=os.getenv("NATS_USER") or None,
+                password=os.getenv("NATS_PASSWORD") or None,
+            )
+            jetstream = self._connection.jetstream()
+            try:
+                await jetstream.add_stream(
+                    name=NATS_STREAM,
+                    subjects=[f"{EXCHANGE_NAME}.>"],
+                    retention=RetentionPolicy.WORK_QUEUE,
+                )
+            except BadRequestError as exc:
+                # Created with other settings, e.g. replicas, by an administrator
+                log.warning("Keeping the existing stream %s: %s", NATS_STREAM, exc)
+            self._jetstream = jetstream
+            return jetstream
+
+    async def _reply_inbox(self) -> str:
+        """Subscribes to the inbox receiving the replies, once."""
+        await self._connect()
+        async with self._lock:
+            if self._inbox is not None:
+                return self._inbox
+            inbox = self._connection.new_inbox()
+
+            async def _on_reply(msg) -> None:
+                future = self._pending.pop(msg.subject.rsplit(".", 1)[-1], None)
+                if future and not future.done():
+                    future.set_result(msg.data)
+
+            await self._connection.subscribe(f"{inbox}.*", cb=_on_reply)
+            self._inbox = inbox
+            return inbox
+
+    async def request(
+        self, q_type: str, flavour: str, body: bytes, headers: Dict[str, str], timeout: float
+    ) -> bytes:
+        jetstream = await self._connect()
+        inbox = await self._reply_inbox()
+        correlation_id = uuid.uuid4().hex
+        future: asyncio.Future = asyncio.get_running_loop().create_future()
+        self._pending[correlation_id] = future
+        await jetstream.publish(
+            subject(q_type, flavour),
+            body,
+            stream=NATS_STREAM,
+            headers={
+                **{key: str(value) for key, value in headers.items()},
+                "q_type": q_type,
+                "flavour": flavour,
+                "reply_to": f"{inbox}.{correlation_id}",
+            },
+        )
+        debug(f"Published message: subject={subject(q_type, flavour)} correlation_id={correlation_id}")
+        try:
+            return await asyncio.wait_for(future, timeout=timeout)
+        finally:
+            self._pending.pop(correlation_id, None)
+
+    async def consume(self, q_type: str, flavour: str, handler: Handler) -> None:
+        jetstream = await self._connect()
+        durable = nats_name(queue_name(q_type, flavour))
+        config = ConsumerConfig(ack_wait=NATS_ACK_WAIT_SEC)
+        if self._prefetch:
+            config.max_ack_pending = self._prefetch
+        subscription = await jetstream.pull_subscribe(
+            subject(q_type, flavour), durable=durable, stream=NATS_STREAM, config=config
+        )
+        debug(f"Pulling from consumer: {durable}")
+        tasks: set[asyncio.Task] = set()
+
+        async def _keep_in_progress(msg) -> None:
+            while True:
+                await asyncio.sleep(NATS_ACK_WAIT_SEC / 3)
+                try:
+                    await msg.in_progress()
+                except Exception as exc:  # noqa: BLE001
+                    log.warning("Failed to report progress on a message of %s: %s", durable, exc)
+
+        async def _handle(msg) -> None:
+            keeper = asyncio.create_task(_keep_in_progress(msg))
+            try:
+                await handler(NATSDelivery(msg, self._connection))
+            except Exception as exc:  # noqa: BLE001
+                log.error("Failed to handle a message of %s: %s", durable, exc)
+            finally:
+                keeper.cancel()
+                if self._inflight is not None:
+                    self._inflight.release()
+
+        try:
+            while True:
+                try:
+                    messages = await subscription.fetch(
+                        max(1, self._prefetch // 4), timeout=FETCH_TIMEOUT_SEC
+                    )
+                except NATSTimeoutError:
+                    continue
+                for msg in messages:
+                    if self._inflight is not None:
+                        await self._inflight.acquire()
+                    task = asyncio.create_task(_handle(msg))
+                    tasks.add(task)
+                    task.add_done_callback(tasks.discard)
+        finally:
+            await subscription.unsubscribe()
+
+    async def close(self) -> None:
+        if self._connection is not None:
+            await self._connection.drain()
@@ -0,0 +1,251 @@
+"""
+Kafka transport: every queue is a topic of the same name. Consumers of a
+service share one consumer group, whose lag KEDA scales on; replies are
+published on the reply topic of the service, which every router reads in full
+and demultiplexes by correlation_id.
+
+Offsets are committed once a request is answered, up to the oldest one still
+in flight, so requests in flight when a consumer dies are redelivered to
+another one; a request answered just before the commit may be served twice.
+"""
+from __future__ import annotations
+
+import asyncio
+import os
+import uuid
+from typing import Dict, List, Tuple
+
+from aiokafka import AIOKafkaConsumer, AIOKafkaProducer, ConsumerRebalanceListener, TopicPartition
+from aiokafka.errors import KafkaError
+from aiokafka.helpers import create_ssl_context
+
+from common.transport import EXCHANGE_NAME, Delivery, Handler, Transport, queue_name
+from common.utils import debug, log
+
+KAFKA_BOOTSTRAP_SERVERS: str = os.getenv("KAFKA_BOOTSTRAP_SERVERS", "kafka:9092")
+KAFKA_CONSUMER_GROUP: str = os.getenv("KAFKA_CONSUMER_GROUP", f"{EXCHANGE_NAME}.consumer")
+KAFKA_REPLY_TOPIC: str = os.getenv("KAFKA_REPLY_TOPIC", f"{EXCHANGE_NAME}.reply")
+KAFKA_SASL_MECHANISM: str = os.getenv("KAFKA_SASL_MECHANISM", "")
+KAFKA_TLS: bool = os.getenv("KAFKA_TLS", "false").lower() == "true"
+
+
+def client_options() -> dict:
+    """Connection options shared by producers and consumers."""
+    options: dict = {"bootstrap_servers": KAFKA_BOOTSTRAP_SERVERS.split(",")}
+    if KAFKA_SASL_MECHANISM:
+        options["security_protocol"] = "SASL_SSL" if KAFKA_TLS else "SASL_PLAINTEXT"
+        options["sasl_mechanism"] = KAFKA_SASL_MECHANISM
+        options["sasl_plain_username"] = os.getenv("KAFKA_USERNAME", "")
+        options["sasl_plain_password"] = os.getenv("KAFKA_PASSWORD", "")
+    elif KAFKA_TLS:
+        options["security_protocol"] = "SSL"
+    if KAFKA_TLS:
+        options["ssl_context"] = create_ssl_context()
+    return options
+
+
+def encode_headers(headers: Dict[str, str]) -> List[Tuple[str, bytes]]:
+    return [(key, str(value).encode()) for key, value in headers.items()]
+
+
+def decode_headers(headers) -> Dict[str, str]:
+    return {key: value.decode() for key, value in headers or ()}
+
+
+class KafkaDelivery(Delivery):
+    def __init__(self, record, producer: AIOKafkaProducer) -> None:
+        self._record = record
+        self._producer = producer
+        self.body = record.value
+        self.headers = decode_headers(record.headers)
+
+    async def reply(self, body: bytes) -> None:
+        await self._producer.send_and_wait(
+            self.headers.get("reply_to", KAFKA_REPLY_TOPIC),
+            body,
+            headers=encode_headers({"correlation_id": self.headers.get("correlation_id", "")}),
+        )
+
+    async def requeue(self) -> None:
+        # Committed offsets cannot be rewound per record, so the request goes
+        # to the back of its topic
+        await self._producer.send_and_wait(
+            self._record.topic, self._record.value, headers=list(self._record.headers or ())
+        )
+
+
+class OffsetTracker:
+    """
+    Offsets safe to commit for records handled out of order: past every
+    answered record, short of the oldest one still in flight.
+    """
+
+    def __init__(self) -> None:
+        self._inflight: Dict[TopicPartition, set[int]] = {}
+        self._next: Dict[TopicPartition, int] = {}
+        self._committed: Dict[TopicPartition, int] = {}
+
+    def start(self, tp: TopicPartition, offset: int) -> None:
+        self._inflight.setdefault(tp, set()).add(offset)
+        self._next[tp] = max(self._next.get(tp, 0), offset + 1)
+
+    def done(self, tp: TopicPartition, offset: int) -> Dict[TopicPartition, int]:
+        """
+        Forget a handled record and return the offsets to commit, if any.
+        Records of a revoked partition are committed by its new consumer.
+        """
+        if tp not in self._next:
+            return {}
+        inflight = self._inflight.get(tp, set())
+        inflight.discard(offset)
+        committable = min(inflight) if inflight else self._next[tp]
+        if committable <= self._committed.get(tp, -1):
+            return {}
+        self._committed[tp] = committable
+        return {tp: committable}
+
+    def revoke(self, partitions) -> None:
+        """Forget partitions handed to another consumer."""
+        for tp in partitions:
+            self._inflight.pop(tp, None)
+            self._next.pop(tp, None)
+            self._committed.pop(tp, None)
+
+
+class OffsetRebalanceListener(ConsumerRebalanceListener):
+    def __init__(self, offsets: OffsetTracker) -> None:
+        self._offsets = offsets
+
+    async def on_partitions_revoked(self, revoked) -> None:
+        self._offsets.revoke(revoked)
+
+    async def on_partitions_assigned(self, assigned) -> None:
+        pass
+
+
+class KafkaTransport(Transport):
+    def __init__(self, prefetch: int = 0) -> None:
+        self._lock = asyncio.Lock()
+        self._producer: AIOKafkaProducer | None = None
+        self._replies: AIOKafkaConsumer | None = None
+        self._reply_task: asyncio.Task | None = None
+        self._consumers: set[AIOKafkaConsumer] = set()
+        self._pending: Dict[str, asyncio.Future] = {}
+        self._inflight = asyncio.Semaphore(prefetch) if prefetch else None
+
+    async def _get_producer(self) -> AIOKafkaProducer:
+        async with self._lock:
+            if self._producer is None:
+                producer = AIOKafkaProducer(**client_options())
+                await producer.start()
+                self._producer = producer
+            return self._producer
+
+    async def _reply_consumer(self, producer: AIOKafkaProducer) -> None:
+        """Reads the reply topic from its end, resolving pending requests."""
+        async with self._lock:
+            if self._replies is not None:
+                return
+            partitions = await producer.partitions_for(KAFKA_REPLY_TOPIC)
+            if not partitions:
+                # Left to the next request, once the topic exists
+                raise RuntimeError(f"reply topic {KAFKA_REPLY_TOPIC} does not exist")
+            consumer = AIOKafkaConsumer(group_id=None, **client_options())
+            await consumer.start()
+            # Assigned up front, so no reply published after this point is missed
+            consumer.assign([TopicPartition(KAFKA_REPLY_TOPIC, p) for p in partitions])
+            await consumer.seek_to_end()
+            self._replies = consumer
+
+            async def _on_replies() -> None:
+                async for record in consumer:
+                    correlation_id = decode_headers(record.headers).get("correlation_id")
+                    future = self._pending.pop(correlation_id, None)
+                    if future and not future.done():
+                        future.set_result(record.value)
+
+            self._reply_task = asyncio.create_task(_on_replies())
+
+    async def request(
+        self, q_type: str, flavour: str, body: bytes, headers: Dict[str, str], timeout: float
+    ) -> bytes:
+        producer = await self._get_producer()
+        await self._reply_consumer(producer)
+        correlation_id = str(uuid.uuid4())
+        future: asyncio.Future = asyncio.get_running_loop().create_future()
+        self._pending[correlation_id] = future
+        topic = queue_name(q_type, flavour)
+        await producer.send_and_wait(
+            topic,
+            body,
+            headers=encode_headers(
+                {
+                    **headers,
+                    "q_type": q_type,
+                    "flavour": flavour,
+                    "correlation_id": correlation_id,
+                    "reply_to": KAFKA_REPLY_TOPIC,
+                }
+            ),
+        )
+        debug(f"Published message: topic={topic} correlation_id={correlation_id}")
+        try:
+            return await asyncio.wait_for(future, timeout=timeout)
+        finally:
+            self._pending.pop(correlation_id, None)
+
+    async def consume(self, q_type: str, flavour: str, handler: Handler) -> None:
+        producer = await self._get_producer()
+        topic = queue_name(q_type, flavour)
+        consumer = AIOKafkaConsumer(
+            group_id=KAFKA_CONSUMER_GROUP,
+            enable_auto_commit=False,
+            auto_offset_reset="earliest",
+            **client_options(),
+        )
+        offsets = OffsetTracker()
+        consumer.subscribe([topic], listener=OffsetRebalanceListener(offsets))
+        await consumer.start()
+        self._consumers.add(consumer)
+        debug(f"Subscribed to topic: {topic}")
+        tasks: set[asyncio.Task] = set()
+
+        async def _handle(record, tp: TopicPartition) -> None:
+            try:
+                await handler(KafkaDelivery(record, producer))
+            except Exception as exc:  # noqa: BLE001
+                log.error("Failed to handle a message of %s: %s", topic, exc)
+            finally:
+                if self._inflight is not None:
+                    self._inflight.release()
+            # Handled records are committed even when the handler failed, as
+            # the consumer answered or requeued them as far as it could
+            commit = offsets.done(tp, record.offset)
+            if commit:
+                try:
+                    await consumer.commit(commit)
+                except KafkaError as exc:
+                    # Rebalanced away; the new owner handles the record again
+                    log.warning("Failed to commit the offsets of %s: %s", topic, exc)
+
+        try:
+            async for record in consumer:
+                if self._inflight is not None:
+                    await self._inflight.acquire()
+                tp = TopicPartition(record.topic, record.partition)
+                offsets.start(tp, record.offset)
+                task = asyncio.create_task(_handle(record, tp))
+                tasks.add(task)
+                task.add_done_callback(tasks.discard)
+        finally:
+            self._consumers.discard(consumer)
+            await consumer.stop()
+
+    async def close(self) -> None:
+        if self._reply_task is not None:
+            self._reply_task.cancel()
+        for consumer in [self._replies, *self._consumers]:
+            if consumer is not None:
+                await consumer.stop()
+        if self._producer is not None:
+            await self._producer.stop()
@@ -0,0 +1,185 @@
+"""
+RabbitMQ transport: requests are published on the headers exchange of the
+service, routed to the queue bound to their q_type and flavour, and answered
+on the direct reply-to pseudo-queue of the router.
+
+With DEAD_LETTER_AFTER, failed requests go back to the tail of their queue
+with their attempts counted in a header, and are rejected, to the dead-letter
+exchange of the queue policy, once they run out.
+"""
+from __future__ import annotations
+
+import asyncio
+import uuid
+from typing import Dict
+
+import aio_pika
+from aio_pika import ExchangeType, Queue
+from aio_pika.pool import Pool
+
+from common.transport import (
+    DEAD_LETTER_AFTER,
+    EXCHANGE_NAME,
+    Delivery,
+    Handler,
+    Transport,
+    queue_name,
+)
+from common.utils import broker_url, debug
+
+REPLY_TO = "amq.rabbitmq.reply-to"
+ATTEMPTS_HEADER = "x-carbonrouter-attempts"
+
+
+class RabbitMQDelivery(Delivery):
+    def __init__(self, message: aio_pika.IncomingMessage, channel_pool: Pool, queue: str) -> None:
+        self._message = message
+        self._channel_pool = channel_pool
+        self._queue = queue
+        self.body = message.body
+        self.headers = {k: str(v) for k, v in (message.headers or {}).items()}
+        try:
+            self.attempts = int(self.headers.get(ATTEMPTS_HEADER, "0")) + 1
+        except ValueError:
+            self.attempts = 1
+
+    async def reply(self, body: bytes) -> None:
+        # Requests replayed from the dead-letter queue have nobody waiting
+        if self._message.reply_to:
+            # Pooled channels avoid serialising every reply on the listen channel
+            async with self._channel_pool.acquire() as publish_ch:
+                await publish_ch.default_exchange.publish(
+                    aio_pika.Message(body, correlation_id=self._message.correlation_id),
+                    routing_key=self._message.reply_to,
+                )
+        await self._message.ack()
+
+    async def requeue(self) -> None:
+        if not DEAD_LETTER_AFTER:
+            await self._message.nack(requeue=True)
+            return
+        # A copy carries the attempts, which a nack cannot update
+        async with self._channel_pool.acquire() as publish_ch:
+            await publish_ch.default_exchange.publish(
+                aio_pika.Message(
+                    self._message.body,
+                    correlation_id=self._message.correlation_id,
+                    reply_to=self._message.reply_to,
+                    headers={**(self._message.headers or {}), ATTEMPTS_HEADER: self.attempts},
+                    delivery_mode=self._message.delivery_mode,
+                ),
+                routing_key=self._queue,
+            )
+        await self._message.ack()
+
+    async def dead_letter(self) -> None:
+        await self._message.nack(requeue=False)
+
+
+class RabbitMQTransport(Transport):
+    def __init__(self, prefetch: int = 0) -> None:
+        self._url = broker_url()
+        self._prefetch = prefetch
+        self._lock = asyncio.Lock()
+        self._connection: aio_pika.RobustConnection | None = None
+        self._channel: aio_pika.RobustChannel | None = None
+        self._exchange: aio_pika.Exchange | None = None
+        self._channel_pool: Pool | None = None
+        self._connection_pool: Pool | None = None
+        self._replies: Queue | None = None
+        self._pending: Dict[str, asyncio.Future] = {}
+
+    async def _exchange_channel(self) -> aio_pika.Exchange:
+        """Opens the connection and declares the headers exchange, once."""
+        async with self._lock:
+            if self._exchange is not None:
+                return self._exchange
+            self._connection = await aio_pika.connect_robust(self._url)
+            self._channel = await self._connection.channel()
+            if self._prefetch:
+                await self._channel.set_qos(prefetch_count=self._prefetch)
+            self._exchange = await self._channel.declare_exchange(
+                EXCHANGE_NAME, ExchangeType.HEADERS, durable=True
+            )
+            return self._exchange
+
+    async def _reply_queue(self) -> None:
+        """Starts the consumer demultiplexing replies by correlation_id."""
+        await self._exchange_channel()
+        async with self._lock:
+            if self._replies is not None:
+                return
+
+            async def _on_reply(msg: aio_pika.IncomingMessage) -> None:
+                future = self._pending.pop(msg.correlation_id, None)
+                if future and not future.done():
+                    future.set_result(msg.body)
+
+            self._replies = Queue(
+                self._channel,
+                name=REPLY_TO,
+                passive=True,
+                durable=False,
+                exclusive=False,
+                auto_delete=False,
+                arguments=None,
+            )
+            await self._replies.consume(_on_reply, no_ack=True)
+
+    async def request(
+        self, q_type: str, flavour: str, body: bytes, headers: Dict[str, str], timeout: float
+    ) -> bytes:
+        await self._reply_queue()
+        correlation_id = str(uuid.uuid4())
+        future: asyncio.Future = asyncio.get_running_loop().create_future()
+        self._pending[correlation_id] = future
+        await self._exchange.publish(
+            aio_pika.Message(
+                body,
+                correlation_id=correlation_id,
+                reply_to=REPLY_TO,
+                headers={**headers, "q_type": q_type, "flavour": flavour},
+            ),
+            routing_key="",  # ignored by the headers exchange
+            mandatory=True,
+        )
+        debug(f"Published message: q_type={q_type} flavour={flavour} correlation_id={correlation_id}")
+        try:
+            return await asyncio.wait_for(future, timeout=timeout)
+        finally:
+            self._pending.pop(correlation_id, None)
+
+    def _pool(self) -> Pool:
+        if self._channel_pool is None:
+            self._connection_pool = Pool(lambda: aio_pika.connect_robust(self._url), max_size=2)
+
+            async def _get_channel() -> aio_pika.RobustChannel:
+                async with self._connection_pool.acquire() as conn:
+                    return await conn.channel()
+
+            self._channel_pool = Pool(_get_channel, max_size=64)
+        return self._channel_pool
+
+    async def consume(self, q_type: str, flavour: str, handler: Handler) -> None:
+        exchange = await self._exchange_channel()
+        name = queue_name(q_type, flavour)
+        queue = await self._channel.declare_queue(name, durable=True)
+        await queue.bind(
+            exchange,
+            arguments={"x-match": "all", "q_type": q_type, "flavour": flavour},
+        )
+        debug(f"Queue declared once: {name}")
+        channel_pool = self._pool()
+
+        async def _on_message(message: aio_pika.IncomingMessage) -> None:
+            await handler(RabbitMQDelivery(message, channel_pool, name))
+
+        consumer_tag = await queue.consume(_on_message, no_ack=False)
+        try:
+            await asyncio.Event().wait()
+        finally:
+            await queue.cancel(consumer_tag)
+
+    async def close(self) -> None:
+        if self._connection is not None:
+            await self._connection.close()
@@ -0,0 +1,202 @@
+"""
+Redis Streams transport: every queue is a stream of the same name, read by the
+consumer group of the service. Consumers acknowledge and delete the entries
+they answer, so the length of a stream, which KEDA scales on, is its backlog.
+Replies are published on a channel of the router named after the request.
+
+Entries a consumer took without answering are claimed by another one after
+REDIS_CLAIM_IDLE_SEC. A consumer claims the entries it is still handling again
+every third of that, so slow requests are not handed over while in flight.
+"""
+from __future__ import annotations
+
+import asyncio
+import os
+import socket
+import uuid
+from typing import Dict
+
+import redis.asyncio as redis
+from redis.exceptions import ResponseError
+
+from common.transport import EXCHANGE_NAME, Delivery, Handler, Transport, queue_name
+from common.utils import debug, log
+
+REDIS_ADDRESS: str = os.getenv("REDIS_ADDRESS", "redis:6379")
+REDIS_DB: int = int(os.getenv("REDIS_DB", "0"))
+REDIS_TLS: bool = os.getenv("REDIS_TLS", "false").lower() == "true"
+REDIS_CONSUMER_GROUP: str = os.getenv("REDIS_CONSUMER_GROUP", f"{EXCHANGE_NAME}.consumer")
+# Idle time after which an unanswered entry is handed to another consumer,
+# longer than a forward with retries
+REDIS_CLAIM_IDLE_SEC: float = float(os.getenv("REDIS_CLAIM_IDLE_SEC", "120"))
+BLOCK_MS = 5000
+CONSUMER_NAME = socket.gethostname()
+
+
+def connect() -> redis.Redis:
+    host, _, port = REDIS_ADDRESS.rpartition(":")
+    return redis.Redis(
+        host=host or REDIS_ADDRESS,
+        port=int(port) if host else 6379,
+        db=REDIS_DB,
+        ssl=REDIS_TLS,
+        username=os.getenv("REDIS_USERNAME") or None,
+        password=os.getenv("REDIS_PASSWORD") or None,
+    )
+
+
+class RedisDelivery(Delivery):
+    def __init__(self, stream: str, entry_id: bytes, fields: dict, client: redis.Redis) -> None:
+        self._stream = stream
+        self._entry_id = entry_id
+        self._fields = fields
+        self._client = client
+        self.body = fields.get(b"body", b"")
+        self.headers = {
+            key.decode(): value.decode() for key, value in fields.items() if key != b"body"
+        }
+
+    async def _done(self) -> None:
+        async with self._client.pipeline(transaction=True) as pipe:
+            pipe.xack(self._stream, REDIS_CONSUMER_GROUP, self._entry_id)
+            pipe.xdel(self._stream, self._entry_id)
+            await pipe.execute()
+
+    async def reply(self, body: bytes) -> None:
+        reply_to = self.headers.get("reply_to")
+        if reply_to:
+            await self._client.publish(reply_to, body)
+        await self._done()
+
+    async def requeue(self) -> None:
+        # Pending entries cannot be handed back to the group, so the request
+        # goes to the back of its stream
+        await self._client.xadd(self._stream, self._fields)
+        await self._done()
+
+
+class RedisTransport(Transport):
+    def __init__(self, prefetch: int = 0) -> None:
+        self._prefetch = prefetch
+        self._lock = asyncio.Lock()
+        self._client = connect()
+        self._pubsub = None
+        self._reply_task: asyncio.Task | None = None
+        self._inbox: str | None = None
+        self._pending: Dict[str, asyncio.Future] = {}
+        self._inflight = asyncio.Semaphore(prefetch) if prefetch else None
+
+    async def _reply_inbox(self) -> str:
+        """Subscribes to the reply channels of this router, once."""
+        async with self._lock:
+            if self._inbox is not None:
+                return self._inbox
+            inbox = f"{EXCHANGE_NAME}.reply.{uuid.uuid4().hex}"
+            pubsub = self._client.pubsub(ignore_subscribe_messages=True)
+            await pubsub.psubscribe(f"{inbox}.*")
+
+            async def _on_replies() -> None:
+                async for message in pubsub.listen():
+                    channel = message["channel"].decode()
+                    future = self._pending.pop(channel.rsplit(".", 1)[-1], None)
+                    if future and not future.done():
+                        future.set_result(message["data"])
+
+            self._pubsub = pubsub
+            self._reply_task = asyncio.create_task(_on_replies())
+            self._inbox = inbox
+            return inbox
+
+    async def request(
+        self, q_type: str, flavour: str, body: bytes, headers: Dict[str, str], timeout: float
+    ) -> bytes:
+        inbox = await self._reply_inbox()
+        correlation_id = uuid.uuid4().hex
+        future: asyncio.Future = asyncio.get_running_loop().create_future()
+        self._pending[correlation_id] = future
+        stream = queue_name(q_type, flavour)
+        await self._client.xadd(
+            stream,
+            {
+                **{key: str(value) for key, value in headers.items()},
+                "q_type": q_type,
+                "flavour": flavour,
+                "reply_to": f"{inbox}.{correlation_id}",
+                "body": body,
+            },
+        )
+        debug(f"Published message: stream={stream} correlation_id={correlation_id}")
+        try:
+            return await asyncio.wait_for(future, timeout=timeout)
+        finally:
+            self._pending.pop(correlation_id, None)
+
+    async def consume(self, q_type: str, flavour: str, handler: Handler) -> None:
+        stream = queue_name(q_type, flavour)
+        try:
+            await self._client.xgroup_create(stream, REDIS_CONSUMER_GROUP, id="0", mkstream=True)
+        except ResponseError as exc:
+            if "BUSYGROUP" not in str(exc):
+                raise
+        debug(f"Reading stream: {stream}")
+        tasks: set[asyncio.Task] = set()
+        handling: set[bytes] = set()
+        count = max(1, self._prefetch // 4)
+
+        async def _keep_claimed(entry_id: bytes) -> None:
+            while True:
+                await asyncio.sleep(REDIS_CLAIM_IDLE_SEC / 3)
+                try:
+                    await self._client.xclaim(
+                        stream, REDIS_CONSUMER_GROUP, CONSUMER_NAME, 0, [entry_id], justid=True
+                    )
+                except Exception as exc:  # noqa: BLE001
+                    log.warning("Failed to keep %s of %s claimed: %s", entry_id, stream, exc)
+
+        async def _handle(entry_id: bytes, fields: dict) -> None:
+            keeper = asyncio.create_task(_keep_claimed(entry_id))
+            try:
+                await handler(RedisDelivery(stream, entry_id, fields, self._client))
+            except Exception as exc:  # noqa: BLE001
+                log.error("Failed to handle a message of %s: %s", stream, exc)
+            finally:
+                keeper.cancel()
+                handling.discard(entry_id)
+                if self._inflight is not None:
+                    self._inflight.release()
+
+        async def _dispatch(entries) -> None:
+            for entry_id, fields in entries:
+                if not fields:  # deleted while pending
+                    continue
+                if entry_id in handling:  # our own, still in flight
+                    continue
+                handling.add(entry_id)
+                if self._inflight is not None:
+                    await self._inflight.acquire()
+                task = asyncio.create_task(_handle(entry_id, fields))
+                tasks.add(task)
+                task.add_done_callback(tasks.discard)
+
+        while True:
+            # Entries left unanswered by consumers that went away
+            claimed = await self._client.xautoclaim(
+                stream,
+                REDIS_CONSUMER_GROUP,
+                CONSUMER_NAME,
+                min_idle_time=int(REDIS_CLAIM_IDLE_SEC * 1000),
+                count=count,
+            )
+            await _dispatch(claimed[1])
+            response = await self._client.xreadgroup(
+                REDIS_CONSUMER_GROUP, CONSUMER_NAME, {stream: ">"}, count=count, block=BLOCK_MS
+            )
+            for _, entries in response or ():
+                await _dispatch(entries)
+
+    async def close(self) -> None:
+        if self._reply_task is not None:
+            self._reply_task.cancel()
+        if self._pubsub is not None:
+            await self._pubsub.aclose()
+        await self._client.aclose()
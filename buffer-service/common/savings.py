@@ -0,0 +1,81 @@
+"""
+Carbon savings accounting of the router.
+
+Every answered request is charged the carbon cost per request the schedule
+reports for the precision that served it, and the one of the highest
+precision as the baseline. The difference is the carbon avoided by serving it
+at a lower precision. The operator reads the totals from the admin API and
+rolls them up per schedule window, day and month.
+"""
+from __future__ import annotations
+
+import threading
+from typing import Any, Dict
+
+from prometheus_client import Counter
+
+__all__ = ["SavingsLedger"]
+
+SAVINGS_REQUESTS = Counter(
+    "router_savings_requests_total",
+    "Answered requests accounted for carbon savings",
+    ["flavour"],
+)
+BASELINE_GRAMS = Counter(
+    "router_carbon_baseline_grams_total",
+    "Estimated gCO2eq the accounted requests would have cost at the highest precision",
+    ["flavour"],
+)
+AVOIDED_GRAMS = Counter(
+    "router_carbon_avoided_grams_total",
+    "Estimated gCO2eq avoided by serving the accounted requests at their precision",
+    ["flavour"],
+)
+
+
+def _emissions(schedule: Dict[str, Any]) -> dict[int, float]:
+    """Carbon cost per request of each precision of a TrafficSchedule status."""
+    emissions: dict[int, float] = {}
+    for flavour in schedule.get("flavours", []) or []:
+        try:
+            emissions[int(flavour["precision"])] = float(flavour["emissions"])
+        except (KeyError, TypeError, ValueError):
+            continue
+    return emissions
+
+
+class SavingsLedger:
+    """Cumulative savings per flavour since the router started."""
+
+    def __init__(self) -> None:
+        self._lock = threading.Lock()
+        self._flavours: dict[str, dict[str, float]] = {}
+
+    def record(self, schedule: Dict[str, Any], precision: str) -> None:
+        """Account one request served at precision under schedule. Requests
+        are skipped while the schedule reports no emissions for it."""
+        emissions = _emissions(schedule)
+        try:
+            served = emissions[int(precision)]
+        except (KeyError, ValueError):
+            return
+        baseline = emissions[max(emissions)]
+        avoided = baseline - served
+        flavour = f"precision-{int(precision)}"
+        SAVINGS_REQUESTS.labels(flavour).inc()
+        BASELINE_GRAMS.labels(flavour).inc(baseline)
+        # Counters cannot go down, a precision dearer than the baseline is
+        # only reflected in the report
+        if avoided > 0:
+            AVOIDED_GRAMS.labels(flavour).inc(avoided)
+        with self._lock:
+            entry = self._flavours.setdefault(
+                flavour, {"requests": 0, "baselineGrams": 0.0, "avoidedGrams": 0.0}
+            )
+            entry["requests"] += 1
+            entry["baselineGrams"] += baseline
+            entry["avoidedGrams"] += avoided
+
+    def report(self) -> Dict[str, Any]:
+        with self._lock:
+            return {"flavours": {name: dict(entry) for name, entry in self._flavours.items()}}
@@ -23,12 +23,16 @@ class TrafficScheduleManager:
       • load_once()         – initial load / manual reload
       • watch_forever()     – CRD watch loop
       • expiry_guard()      – reload when validUntil is reached
+      • apply_pushed()      – accept a schedule pushed by the operator
     """
 
     def __init__(self, name: str, namespace: str = "default") -> None:
         self._name: str = name
         self._namespace: str = namespace
         self._current: dict[str, Any] = DEFAULT_SCHEDULE.copy()
+        self._version: str = ""
+        # Set while the operator overrides the schedule for this Service only
+        self._pinned: bool = False
         self._lock = asyncio.Lock()
 
         # K8s client bootstrap
@@ -58,6 +62,24 @@ class TrafficScheduleManager:
                 result.append(f"precision-{int(precision)}")
         return result
 
+    async def version(self) -> str:
+        """Return the version of the last schedule pushed by the operator."""
+        async with self._lock:
+            return self._version
+
+    async def apply_pushed(self, status: dict[str, Any], version: str, pinned: bool = False) -> None:
+        """
+        Replace the cached schedule with one pushed by the operator.
+        The CRD watch stays active as a fallback and converges to the same status,
+        unless the schedule is pinned: then it differs from the TrafficSchedule
+        and only the next push replaces it.
+        """
+        async with self._lock:
+            self._current = status
+            self._version = version
+            self._pinned = pinned
+        log.info("TrafficSchedule updated (push, version %s, pinned %s)", version, pinned)
+
     async def load_once(self) -> None:
         obj = await self._api.get_namespaced_custom_object(
             group="scheduling.carbonrouter.io",
@@ -67,6 +89,8 @@ class TrafficScheduleManager:
             name=self._name,
         )
         async with self._lock:
+            if self._pinned:
+                return
             self._current = obj.get("status", {})
         log.info("TrafficSchedule loaded")
 
@@ -85,6 +109,8 @@ class TrafficScheduleManager:
                 )
                 async for event in stream:
                     async with self._lock:
+                        if self._pinned:
+                            continue
                         self._current = event["object"].get("status", {})
                     log.info("TrafficSchedule updated (watch)")
             except Exception as exc:  # noqa: BLE001
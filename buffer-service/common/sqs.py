@@ -0,0 +1,266 @@
+"""
+Amazon SQS transport: every queue is an SQS queue of the same name, whose
+visible and in-flight messages KEDA scales on. SQS has no reply-to, so every
+router creates a reply queue of its own on start, passes its URL with each
+request and deletes it on shutdown.
+
+Queue names take underscores for the characters SQS forbids, the same rule the
+operator applies when it renders the KEDA triggers. A request whose consumer
+dies becomes visible again after SQS_VISIBILITY_TIMEOUT_SEC; consumers extend
+the visibility of the requests they are still handling every third of it.
+
+Reply queues carry the REPLY_QUEUE_TAG tag, naming their exchange, and the
+router and creation time, so those left by routers that were killed can be
+found and deleted.
+"""
+from __future__ import annotations
+
+import asyncio
+import contextlib
+import json
+import os
+import re
+import socket
+import uuid
+from datetime import datetime, timezone
+from typing import Dict
+
+from aiobotocore.session import get_session
+
+from common.transport import EXCHANGE_NAME, Delivery, Handler, Transport, queue_name
+from common.utils import debug, log
+
+
+def sqs_name(name: str) -> str:
+    """SQS queue name of a queue name."""
+    return re.sub(r"[^A-Za-z0-9_-]", "_", name)
+
+
+AWS_REGION: str = os.getenv("AWS_REGION", "us-east-1")
+SQS_ACCOUNT_ID: str = os.getenv("SQS_ACCOUNT_ID", "")
+# URLs of the queues provisioned outside the operator, by queue name
+SQS_QUEUE_URLS: Dict[str, str] = json.loads(os.getenv("SQS_QUEUE_URLS", "{}"))
+SQS_CREATE_QUEUES: bool = os.getenv("SQS_CREATE_QUEUES", "false").lower() == "true"
+# Redelivery delay of unacknowledged requests, longer than a forward with retries
+SQS_VISIBILITY_TIMEOUT_SEC: int = int(os.getenv("SQS_VISIBILITY_TIMEOUT_SEC", "120"))
+WAIT_TIME_SEC = 20  # long polling
+MAX_MESSAGES = 10  # per receive, the SQS limit
+RETRY_DELAY_SEC = 5.0
+REPLY_QUEUE_TAG = "carbonrouter.io/reply-queue"
+
+
+def encode_attributes(headers: Dict[str, str]) -> Dict[str, dict]:
+    return {
+        key: {"DataType": "String", "StringValue": str(value)}
+        for key, value in headers.items()
+        if str(value)
+    }
+
+
+def decode_attributes(attributes) -> Dict[str, str]:
+    return {key: value.get("StringValue", "") for key, value in (attributes or {}).items()}
+
+
+class SQSDelivery(Delivery):
+    def __init__(self, message: dict, queue_url: str, client) -> None:
+        self._message = message
+        self._queue_url = queue_url
+        self._client = client
+        self.body = message["Body"].encode()
+        self.headers = decode_attributes(message.get("MessageAttributes"))
+
+    async def reply(self, body: bytes) -> None:
+        reply_to = self.headers.get("reply_to")
+        if reply_to:
+            await self._client.send_message(
+                QueueUrl=reply_to,
+                MessageBody=body.decode(),
+                MessageAttributes=encode_attributes(
+                    {"correlation_id": self.headers.get("correlation_id", "")}
+                ),
+            )
+        await self._client.delete_message(
+            QueueUrl=self._queue_url, ReceiptHandle=self._message["ReceiptHandle"]
+        )
+
+    async def requeue(self) -> None:
+        await self._client.change_message_visibility(
+            QueueUrl=self._queue_url,
+            ReceiptHandle=self._message["ReceiptHandle"],
+            VisibilityTimeout=0,
+        )
+
+
+class SQSTransport(Transport):
+    def __init__(self, prefetch: int = 0) -> None:
+        self._prefetch = prefetch
+        self._lock = asyncio.Lock()
+        self._stack = contextlib.AsyncExitStack()
+        self._client = None
+        self._urls: Dict[str, str] = dict(SQS_QUEUE_URLS)
+        self._reply_url: str | None = None
+        self._reply_task: asyncio.Task | None = None
+        self._pending: Dict[str, asyncio.Future] = {}
+        self._inflight = asyncio.Semaphore(prefetch) if prefetch else None
+
+    async def _get_client(self):
+        async with self._lock:
+            if self._client is None:
+                self._client = await self._stack.enter_async_context(
+                    get_session().create_client("sqs", region_name=AWS_REGION)
+                )
+            return self._client
+
+    async def _queue_url(self, q_type: str, flavour: str) -> str:
+        name = queue_name(q_type, flavour)
+        if name in self._urls:
+            return self._urls[name]
+        client = await self._get_client()
+        if SQS_CREATE_QUEUES:
+            response = await client.create_queue(QueueName=sqs_name(name))
+            url = response["QueueUrl"]
+        elif SQS_ACCOUNT_ID:
+            url = f"https://sqs.{AWS_REGION}.amazonaws.com/{SQS_ACCOUNT_ID}/{sqs_name(name)}"
+        else:
+            response = await client.get_queue_url(QueueName=sqs_name(name))
+            url = response["QueueUrl"]
+        self._urls[name] = url
+        return url
+
+    async def _reply_queue(self) -> str:
+        """Creates the reply queue of this router and starts reading it, once."""
+        client = await self._get_client()
+        async with self._lock:
+            if self._reply_url is not None:
+                return self._reply_url
+            name = sqs_name(f"{EXCHANGE_NAME}-reply")[:71] + "-" + uuid.uuid4().hex[:8]
+            response = await client.create_queue(
+                QueueName=name,
+                Attributes={"MessageRetentionPeriod": "60"},
+                tags={
+                    REPLY_QUEUE_TAG: EXCHANGE_NAME,
+                    "carbonrouter.io/router": socket.gethostname(),
+                    "carbonrouter.io/created": datetime.now(timezone.utc).isoformat(timespec="seconds"),
+                },
+            )
+            reply_url = response["QueueUrl"]
+
+            async def _receive_replies() -> None:
+                response = await client.receive_message(
+                    QueueUrl=reply_url,
+                    MaxNumberOfMessages=MAX_MESSAGES,
+                    WaitTimeSeconds=WAIT_TIME_SEC,
+                    MessageAttributeNames=["All"],
+                )
+                messages = response.get("Messages", [])
+                for message in messages:
+                    correlation_id = decode_attributes(message.get("MessageAttributes")).get(
+                        "correlation_id"
+                    )
+                    future = self._pending.pop(correlation_id, None)
+                    if future and not future.done():
+                        future.set_result(message["Body"].encode())
+                if messages:
+                    await client.delete_message_batch(
+                        QueueUrl=reply_url,
+                        Entries=[
+                            {"Id": str(i), "ReceiptHandle": message["ReceiptHandle"]}
+                            for i, message in enumerate(messages)
+                        ],
+                    )
+
+            async def _on_replies() -> None:
+                while True:
+                    try:
+                        await _receive_replies()
+                    except Exception as exc:  # noqa: BLE001
+                        # A failed receive must not stop every later reply
+                        log.warning("Failed to read the reply queue %s: %s", reply_url, exc)
+                        await asyncio.sleep(RETRY_DELAY_SEC)
+
+            self._reply_task = asyncio.create_task(_on_replies())
+            self._reply_url = reply_url
+            debug(f"Reply queue created: {reply_url}")
+            return reply_url
+
+    async def request(
+        self, q_type: str, flavour: str, body: bytes, headers: Dict[str, str], timeout: float
+    ) -> bytes:
+        client = await self._get_client()
+        reply_url = await self._reply_queue()
+        queue_url = await self._queue_url(q_type, flavour)
+        correlation_id = str(uuid.uuid4())
+        future: asyncio.Future = asyncio.get_running_loop().create_future()
+        self._pending[correlation_id] = future
+        await client.send_message(
+            QueueUrl=queue_url,
+            MessageBody=body.decode(),
+            MessageAttributes=encode_attributes(
+                {
+                    **headers,
+                    "q_type": q_type,
+                    "flavour": flavour,
+                    "correlation_id": correlation_id,
+                    "reply_to": reply_url,
+                }
+            ),
+        )
+        debug(f"Published message: queue={queue_url} correlation_id={correlation_id}")
+        try:
+            return await asyncio.wait_for(future, timeout=timeout)
+        finally:
+            self._pending.pop(correlation_id, None)
+
+    async def consume(self, q_type: str, flavour: str, handler: Handler) -> None:
+        client = await self._get_client()
+        queue_url = await self._queue_url(q_type, flavour)
+        debug(f"Polling queue: {queue_url}")
+        tasks: set[asyncio.Task] = set()
+
+        async def _keep_invisible(message: dict) -> None:
+            while True:
+                await asyncio.sleep(SQS_VISIBILITY_TIMEOUT_SEC / 3)
+                try:
+                    await client.change_message_visibility(
+                        QueueUrl=queue_url,
+                        ReceiptHandle=message["ReceiptHandle"],
+                        VisibilityTimeout=SQS_VISIBILITY_TIMEOUT_SEC,
+                    )
+                except Exception as exc:  # noqa: BLE001
+                    log.warning("Failed to extend the visibility of a message of %s: %s", queue_url, exc)
+
+        async def _handle(message: dict) -> None:
+            keeper = asyncio.create_task(_keep_invisible(message))
+            try:
+                await handler(SQSDelivery(message, queue_url, client))
+            except Exception as exc:  # noqa: BLE001
+                log.error("Failed to handle a message of %s: %s", queue_url, exc)
+            finally:
+                keeper.cancel()
+                if self._inflight is not None:
+                    self._inflight.release()
+
+        while True:
+            response = await client.receive_message(
+                QueueUrl=queue_url,
+                MaxNumberOfMessages=min(MAX_MESSAGES, max(1, self._prefetch // 4)),
+                WaitTimeSeconds=WAIT_TIME_SEC,
+                VisibilityTimeout=SQS_VISIBILITY_TIMEOUT_SEC,
+                MessageAttributeNames=["All"],
+            )
+            for message in response.get("Messages", []):
+                if self._inflight is not None:
+                    await self._inflight.acquire()
+                task = asyncio.create_task(_handle(message))
+                tasks.add(task)
+                task.add_done_callback(tasks.discard)
+
+    async def close(self) -> None:
+        if self._reply_task is not None:
+            self._reply_task.cancel()
+        if self._reply_url is not None:
+            try:
+                await self._client.delete_queue(QueueUrl=self._reply_url)
+            except Exception as exc:  # noqa: BLE001
+                log.warning("Failed to delete the reply queue %s: %s", self._reply_url, exc)
+        await self._stack.aclose()
@@ -0,0 +1,109 @@
+"""
+Message transport between the router and the consumer.
+
+The router publishes every request on the queue of its type and flavour and
+waits for the reply; the consumer works the queues of each flavour and answers
+every delivery. BROKER_TYPE, set by the operator from `spec.broker.type`, picks
+the broker: RabbitMQ (default), Kafka, NATS JetStream, Amazon SQS or Redis
+Streams, or none, the router then forwarding requests itself.
+"""
+from __future__ import annotations
+
+import os
+from typing import Awaitable, Callable, Dict
+
+BROKER_TYPE: str = os.getenv("BROKER_TYPE", "rabbitmq").lower()
+
+TARGET_SVC_NAMESPACE: str = os.getenv("TARGET_SVC_NAMESPACE", "default").lower()
+TARGET_SVC_NAME: str = os.getenv("TARGET_SVC_NAME", "unknown-svc").lower()
+QUEUE_NAME_TEMPLATE: str = os.getenv(
+    "QUEUE_NAME_TEMPLATE", "{namespace}.{service}.{type}.{flavour}"
+)
+EXCHANGE_NAME_TEMPLATE: str = os.getenv("EXCHANGE_NAME_TEMPLATE", "{namespace}.{service}")
+EXCHANGE_NAME: str = EXCHANGE_NAME_TEMPLATE.format(
+    namespace=TARGET_SVC_NAMESPACE, service=TARGET_SVC_NAME
+)
+# Failed forwards after which a request is dead-lettered instead of requeued,
+# 0 to requeue it forever. Set by the operator from
+# spec.broker.topology.maxAttempts, only with RabbitMQ.
+DEAD_LETTER_AFTER: int = int(os.getenv("DEAD_LETTER_AFTER", "0"))
+
+
+def queue_name(q_type: str, flavour: str) -> str:
+    """Name of the <q_type> queue (or topic) of <flavour>."""
+    return QUEUE_NAME_TEMPLATE.format(
+        namespace=TARGET_SVC_NAMESPACE,
+        service=TARGET_SVC_NAME,
+        type=q_type,
+        flavour=flavour,
+    )
+
+
+class Delivery:
+    """A request taken off a queue, answered once with reply(), handed back to
+    the queue with requeue() or given up with dead_letter()."""
+
+    body: bytes
+    headers: Dict[str, str]
+    # Deliveries of the request so far, counting this one
+    attempts: int = 1
+
+    async def reply(self, body: bytes) -> None:
+        raise NotImplementedError
+
+    async def requeue(self) -> None:
+        raise NotImplementedError
+
+    async def dead_letter(self) -> None:
+        """Brokers without dead-lettering keep the request."""
+        await self.requeue()
+
+
+Handler = Callable[[Delivery], Awaitable[None]]
+
+
+class Transport:
+    """Request/reply over a broker."""
+
+    async def request(
+        self, q_type: str, flavour: str, body: bytes, headers: Dict[str, str], timeout: float
+    ) -> bytes:
+        """Publish body on the queue of q_type and flavour and return the reply.
+        Raises asyncio.TimeoutError when none arrives within timeout."""
+        raise NotImplementedError
+
+    async def consume(self, q_type: str, flavour: str, handler: Handler) -> None:
+        """Run handler on every delivery of the queue, concurrently, until
+        cancelled."""
+        raise NotImplementedError
+
+    async def close(self) -> None:
+        raise NotImplementedError
+
+
+def transport(prefetch: int = 0) -> Transport:
+    """Transport of BROKER_TYPE. Consumers bound the deliveries in flight to
+    prefetch."""
+    if BROKER_TYPE == "kafka":
+        from common.kafka import KafkaTransport
+
+        return KafkaTransport(prefetch)
+    if BROKER_TYPE == "natsjetstream":
+        from common.jetstream import NATSTransport
+
+        return NATSTransport(prefetch)
+    if BROKER_TYPE == "sqs":
+        from common.sqs import SQSTransport
+
+        return SQSTransport(prefetch)
+    if BROKER_TYPE == "none":
+        from common.direct import DirectTransport
+
+        return DirectTransport(prefetch)
+    if BROKER_TYPE == "redisstreams":
+        from common.redis_streams import RedisTransport
+
+        return RedisTransport(prefetch)
+    from common.rabbitmq import RabbitMQTransport
+
+    return RabbitMQTransport(prefetch)
@@ -1,11 +1,31 @@
-import base64, random, logging, os
-from typing import Dict
+import base64, json, random, re, logging, os
+from typing import Dict, List, Mapping
+from urllib.parse import quote
 
 loglevel = os.getenv("LOGLEVEL", "INFO").upper()
 logging.basicConfig(level=loglevel,
                     format="%(asctime)s %(levelname)s %(name)s — %(message)s")
 log = logging.getLogger("carbonrouter")
 
+def broker_url() -> str:
+    """AMQP URL of the broker: RABBITMQ_URL when set, otherwise assembled from
+    the RABBITMQ_* parts the operator injects (credentials come from a Secret).
+
+    Raises RuntimeError when no credentials are given, so the service fails at
+    startup instead of logging in with a well-known default.
+    """
+    url = os.getenv("RABBITMQ_URL")
+    if url:
+        return url
+    username, password = os.getenv("RABBITMQ_USERNAME"), os.getenv("RABBITMQ_PASSWORD")
+    if not username or not password:
+        raise RuntimeError("RABBITMQ_URL or RABBITMQ_USERNAME and RABBITMQ_PASSWORD are required")
+    username, password = quote(username, safe=""), quote(password, safe="")
+    host = os.getenv("RABBITMQ_HOST", "rabbitmq")
+    port = os.getenv("RABBITMQ_PORT", "5672")
+    vhost = quote(os.getenv("RABBITMQ_VHOST", "/"), safe="")
+    return f"amqp://{username}:{password}@{host}:{port}/{vhost}"
+
 def b64enc(data: bytes) -> str:
     return base64.b64encode(data).decode()
 
@@ -18,6 +38,97 @@ def weighted_choice(weights: Dict[str, int]) -> str:
     ks, vs = zip(*weights.items())
     return random.choices(ks, weights=vs, k=1)[0]
 
+# Buffering policies of single flavours, which the operator sets as e.g.
+# BUFFER_POLICIES="precision-100=always-direct,precision-50=buffer-when-throttled".
+# Flavours without a policy are always buffered.
+ALWAYS_DIRECT = "always-direct"
+BUFFER_WHEN_THROTTLED = "buffer-when-throttled"
+ALWAYS_BUFFER = "always-buffer"
+
+def buffer_policies() -> Dict[str, str]:
+    policies: Dict[str, str] = {}
+    for entry in os.getenv("BUFFER_POLICIES", "").split(","):
+        flavour, sep, policy = entry.strip().partition("=")
+        if sep and policy in (ALWAYS_DIRECT, BUFFER_WHEN_THROTTLED, ALWAYS_BUFFER):
+            policies[flavour] = policy
+        elif entry.strip():
+            log.warning("Ignoring malformed buffer policy %r", entry)
+    return policies
+
+def direct_methods() -> frozenset[str]:
+    """HTTP methods sent direct to the highest flavour, which the operator sets
+    as e.g. DIRECT_METHODS="DELETE,POST,PUT"."""
+    return frozenset(
+        method.strip().upper()
+        for method in os.getenv("DIRECT_METHODS", "").split(",")
+        if method.strip()
+    )
+
+# Priority classes of the buffered requests, which the operator sets as the
+# JSON list of the CarbonRoutedService spec.buffer.priorityClasses. The
+# buffered queues of a class are of type "queue-<name>"; requests matching no
+# class wait in the "queue" of the default class, which weighs 1.
+BUFFERED = "queue"
+
+def priority_classes() -> List[dict]:
+    raw = os.getenv("PRIORITY_CLASSES", "")
+    if not raw:
+        return []
+    try:
+        classes = json.loads(raw)
+    except ValueError:
+        log.warning("Ignoring malformed priority classes %r", raw)
+        return []
+    return [c for c in classes if isinstance(c, dict) and c.get("name")]
+
+def buffered_queue_types(classes: List[dict]) -> Dict[str, int]:
+    """Buffered queue types by weight, the default class first."""
+    types = {BUFFERED: 1}
+    for c in classes:
+        types[f"{BUFFERED}-{c['name']}"] = max(1, int(c.get("weight") or 1))
+    return types
+
+def _path_matches(match: dict, path: str) -> bool:
+    value = match.get("value", "")
+    kind = match.get("type") or "Prefix"
+    if kind == "Exact":
+        return path == value
+    if kind == "Regex":
+        return re.fullmatch(value, path) is not None
+    return path.startswith(value)
+
+def classify(classes: List[dict], method: str, path: str, headers: Mapping[str, str]) -> str:
+    """Buffered queue type of a request: the one of the first class it
+    matches, every field set of which must match."""
+    lowered = {k.lower(): v for k, v in headers.items()}
+    for c in classes:
+        methods = c.get("methods") or []
+        if methods and method.upper() not in methods:
+            continue
+        if c.get("path") and not _path_matches(c["path"], path):
+            continue
+        wanted = c.get("headers") or {}
+        if any(lowered.get(name.lower()) != value for name, value in wanted.items()):
+            continue
+        return f"{BUFFERED}-{c['name']}"
+    return BUFFERED
+
+def throttle_factor(schedule: dict) -> float:
+    """Processing throttle of a schedule in [0, 1], 1.0 when unthrottled."""
+    # Operator CR status format first, then the decision engine API format
+    raw_factor = schedule.get("processingThrottle")
+    if raw_factor is None:
+        processing = schedule.get("processing", {})
+        if isinstance(processing, dict):
+            raw_factor = processing.get("throttle")
+    if raw_factor is None:
+        return 1.0
+    try:
+        factor = float(raw_factor)
+    except (TypeError, ValueError):
+        return 1.0
+    return max(0.0, min(1.0, factor))
+
 # Fallback schedule
 DEFAULT_SCHEDULE = {
     "flavourWeights": {"precision-100": 60, "precision-50": 30, "precision-30": 10},
@@ -0,0 +1,87 @@
+"""
+Per-client carbon attribution. Run from buffer-service with
+`python -m unittest discover tests`.
+"""
+import sys
+import types
+import unittest
+
+try:
+    import prometheus_client  # noqa: F401
+except ImportError:
+    # The counters are not asserted on, so a stand-in is enough without prometheus_client
+    class _Counter:
+        def __init__(self, *args, **kwargs):
+            pass
+
+        def labels(self, *values):
+            return self
+
+        def inc(self, amount=1):
+            pass
+
+    stub = types.ModuleType("prometheus_client")
+    stub.Counter = _Counter
+    sys.modules["prometheus_client"] = stub
+
+from common.attribution import (  # noqa: E402
+    ANONYMOUS_CLIENT,
+    CLIENT_BUCKETS,
+    OTHER_CLIENT,
+    AttributionLedger,
+    client_label,
+    current_intensity,
+)
+
+
+class ClientLabelTest(unittest.TestCase):
+    def test_missing_id_is_anonymous(self):
+        self.assertEqual(client_label(None), ANONYMOUS_CLIENT)
+        self.assertEqual(client_label(""), ANONYMOUS_CLIENT)
+
+    def test_allow_list_keeps_known_ids_only(self):
+        allowed = frozenset({"billing", "search"})
+        self.assertEqual(client_label("billing", allowed), "billing")
+        self.assertEqual(client_label("made-up", allowed), OTHER_CLIENT)
+
+    def test_ids_are_hashed_into_stable_buckets(self):
+        buckets = {client_label(f"client-{i}", frozenset()) for i in range(1000)}
+        self.assertLessEqual(len(buckets), CLIENT_BUCKETS)
+        self.assertGreater(len(buckets), 1)
+        self.assertEqual(client_label("client-1", frozenset()), client_label("client-1", frozenset()))
+        for bucket in buckets:
+            self.assertRegex(bucket, r"^bucket-\d{2}$")
+
+
+class CurrentIntensityTest(unittest.TestCase):
+    def test_reads_the_forecast_now(self):
+        self.assertEqual(current_intensity({"carbonForecastNow": "212.5"}), 212.5)
+
+    def test_unknown_intensity(self):
+        self.assertIsNone(current_intensity({}))
+        self.assertIsNone(current_intensity({"carbonForecastNow": "n/a"}))
+
+
+class AttributionLedgerTest(unittest.TestCase):
+    def test_report_averages_the_measured_requests_only(self):
+        ledger = AttributionLedger()
+        ledger.record(None, "precision-100", 200.0)
+        ledger.record(None, "precision-50", 100.0)
+        ledger.record(None, "precision-50", None)
+
+        report = ledger.report()["clients"]
+        self.assertEqual(list(report), [ANONYMOUS_CLIENT])
+        entry = report[ANONYMOUS_CLIENT]
+        self.assertEqual(entry["requests"], 3)
+        self.assertEqual(entry["precisions"], {"precision-100": 1, "precision-50": 2})
+        self.assertEqual(entry["intensitySum"], 300.0)
+        self.assertEqual(entry["avgIntensity"], 150.0)
+
+    def test_no_intensity_no_average(self):
+        ledger = AttributionLedger()
+        ledger.record(None, "precision-100", None)
+        self.assertIsNone(ledger.report()["clients"][ANONYMOUS_CLIENT]["avgIntensity"])
+
+
+if __name__ == "__main__":
+    unittest.main()
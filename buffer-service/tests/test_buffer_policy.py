@@ -0,0 +1,67 @@
+"""
+Buffering policies and processing throttle of the schedule. Run from
+buffer-service with `python -m unittest discover tests`.
+"""
+import os
+import unittest
+from unittest import mock
+
+from common.utils import (
+    ALWAYS_DIRECT,
+    BUFFER_WHEN_THROTTLED,
+    buffer_policies,
+    direct_methods,
+    throttle_factor,
+)
+
+
+class BufferPoliciesTest(unittest.TestCase):
+    def policies(self, value):
+        with mock.patch.dict(os.environ, {"BUFFER_POLICIES": value}):
+            return buffer_policies()
+
+    def test_parses_the_operator_format(self):
+        self.assertEqual(
+            self.policies("precision-100=always-direct, precision-50=buffer-when-throttled"),
+            {"precision-100": ALWAYS_DIRECT, "precision-50": BUFFER_WHEN_THROTTLED},
+        )
+
+    def test_unset_buffers_everything(self):
+        with mock.patch.dict(os.environ, clear=True):
+            self.assertEqual(buffer_policies(), {})
+
+    def test_malformed_entries_are_skipped(self):
+        with self.assertLogs("carbonrouter", "WARNING"):
+            policies = self.policies("precision-100=never,precision-30,precision-50=always-direct")
+        self.assertEqual(policies, {"precision-50": ALWAYS_DIRECT})
+
+
+class DirectMethodsTest(unittest.TestCase):
+    def test_parses_the_operator_format(self):
+        with mock.patch.dict(os.environ, {"DIRECT_METHODS": "DELETE, post,,PUT"}):
+            self.assertEqual(direct_methods(), frozenset({"DELETE", "POST", "PUT"}))
+
+    def test_unset_sends_nothing_direct(self):
+        with mock.patch.dict(os.environ, clear=True):
+            self.assertEqual(direct_methods(), frozenset())
+
+
+class ThrottleFactorTest(unittest.TestCase):
+    def test_operator_status(self):
+        self.assertEqual(throttle_factor({"processingThrottle": "0.4"}), 0.4)
+
+    def test_engine_schedule(self):
+        self.assertEqual(throttle_factor({"processing": {"throttle": 0.25}}), 0.25)
+
+    def test_clamped(self):
+        self.assertEqual(throttle_factor({"processingThrottle": "1.5"}), 1.0)
+        self.assertEqual(throttle_factor({"processingThrottle": -1}), 0.0)
+
+    def test_unthrottled_without_a_valid_factor(self):
+        self.assertEqual(throttle_factor({}), 1.0)
+        self.assertEqual(throttle_factor({"processingThrottle": "fast"}), 1.0)
+        self.assertEqual(throttle_factor({"processing": "paused"}), 1.0)
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -0,0 +1,63 @@
+"""
+Offset tracking of the Kafka transport. Run from buffer-service with
+`python -m unittest discover tests`.
+"""
+import sys
+import types
+import unittest
+from collections import namedtuple
+
+try:
+    import aiokafka  # noqa: F401
+except ImportError:
+    # Only OffsetTracker is exercised, so a stand-in is enough without aiokafka
+    stub = types.ModuleType("aiokafka")
+    stub.AIOKafkaConsumer = stub.AIOKafkaProducer = object
+    stub.ConsumerRebalanceListener = object
+    stub.TopicPartition = namedtuple("TopicPartition", "topic partition")
+    errors = types.ModuleType("aiokafka.errors")
+    errors.KafkaError = Exception
+    helpers = types.ModuleType("aiokafka.helpers")
+    helpers.create_ssl_context = lambda: None
+    sys.modules.update({"aiokafka": stub, "aiokafka.errors": errors, "aiokafka.helpers": helpers})
+
+from common.kafka import OffsetTracker, TopicPartition  # noqa: E402
+
+TP = TopicPartition("carbonrouter.shop.checkout.queue", 0)
+
+
+class OffsetTrackerTest(unittest.TestCase):
+    def test_commits_short_of_the_oldest_record_in_flight(self):
+        offsets = OffsetTracker()
+        for offset in (10, 11, 12):
+            offsets.start(TP, offset)
+        self.assertEqual(offsets.done(TP, 11), {TP: 10})
+        self.assertEqual(offsets.done(TP, 10), {TP: 12})
+        self.assertEqual(offsets.done(TP, 12), {TP: 13})
+
+    def test_nothing_committed_twice(self):
+        offsets = OffsetTracker()
+        offsets.start(TP, 10)
+        offsets.start(TP, 11)
+        self.assertEqual(offsets.done(TP, 11), {TP: 10})
+        self.assertEqual(offsets.done(TP, 11), {})
+
+    def test_revoke_with_records_in_flight(self):
+        offsets = OffsetTracker()
+        offsets.start(TP, 10)
+        offsets.start(TP, 11)
+        offsets.revoke([TP])
+        self.assertEqual(offsets.done(TP, 10), {})
+        self.assertEqual(offsets.done(TP, 11), {})
+
+    def test_reassigned_partition_starts_over(self):
+        offsets = OffsetTracker()
+        offsets.start(TP, 10)
+        offsets.revoke([TP])
+        offsets.start(TP, 20)
+        self.assertEqual(offsets.done(TP, 10), {TP: 20})
+        self.assertEqual(offsets.done(TP, 20), {TP: 21})
+
+
+if __name__ == "__main__":
+    unittest.main()
@@ -9,20 +9,30 @@ Main components:
 - SchedulerSession: Long-lived scheduler instances for specific TrafficSchedules
 - SchedulerRegistry: Registry managing multiple scheduler sessions
 - Flask API: REST endpoints for schedule retrieval and configuration
+- gRPC API: the same operations plus a schedule stream (decision_engine.proto)
 """
 
+import hmac
+import json
 import logging
 import os
 import threading
 import time
-from typing import Any, Dict, List, Mapping, Optional, Tuple
+from concurrent import futures
+from typing import Any, Dict, Iterator, List, Mapping, Optional, Tuple
 
-from flask import Flask, jsonify, request
+from flask import Flask, Response, jsonify, request
+from google.protobuf import json_format
+import grpc
 from prometheus_client import start_http_server
 import requests
 
+import decision_engine_pb2
+import decision_engine_pb2_grpc
+
 from scheduler import SchedulerEngine
 from scheduler.models import SchedulerConfig, FlavourProfile, precision_key
+from scheduler.providers import CarbonForecastProvider, ChaosWindow
 
 
 logging.basicConfig(level=os.getenv("LOGLEVEL", "INFO").upper())
@@ -40,6 +50,37 @@ METRICS_POLL_INTERVAL_SEC = int(os.getenv("METRICS_POLL_INTERVAL_SEC", "15"))
 # This is separate from validFor (how long clients can cache the schedule)
 SCHEDULE_EVAL_INTERVAL_SEC = int(os.getenv("SCHEDULE_EVAL_INTERVAL_SEC", "15"))
 
+# gRPC API: port (0 disables it), worker threads (each open schedule stream
+# holds one) and how often idle streams check whether the client is gone
+GRPC_PORT = int(os.getenv("GRPC_PORT", "50051"))
+GRPC_MAX_WORKERS = int(os.getenv("GRPC_MAX_WORKERS", "32"))
+GRPC_WATCH_HEARTBEAT_SEC = float(os.getenv("GRPC_WATCH_HEARTBEAT_SEC", "30"))
+# TLS of the gRPC API, so API_TOKENS do not cross the network in plaintext;
+# with a client CA, clients must present a certificate it signed
+GRPC_TLS_CERT_FILE = os.getenv("GRPC_TLS_CERT_FILE", "")
+GRPC_TLS_KEY_FILE = os.getenv("GRPC_TLS_KEY_FILE", "")
+GRPC_TLS_CLIENT_CA_FILE = os.getenv("GRPC_TLS_CLIENT_CA_FILE", "")
+
+# Heartbeat of the server-sent schedule events; the operator drops
+# subscriptions silent for a minute, so keep it well below that
+EVENTS_HEARTBEAT_SEC = float(os.getenv("EVENTS_HEARTBEAT_SEC", "15"))
+
+# Credentials accepted on the REST API, as bearer tokens or X-API-Key values.
+# Empty leaves the API open, which is fine inside the cluster trust boundary.
+API_TOKENS = [token.strip() for token in os.getenv("API_TOKENS", "").split(",") if token.strip()]
+
+# Schedule receiver of the operator (--schedule-receiver): every new decision
+# is POSTed to <OPERATOR_WEBHOOK_URL>/schedules/<namespace>/<name>, so the
+# operator applies it right away instead of at its next poll. Empty disables it.
+OPERATOR_WEBHOOK_URL = os.getenv("OPERATOR_WEBHOOK_URL", "").rstrip("/")
+OPERATOR_WEBHOOK_TOKEN = os.getenv("OPERATOR_WEBHOOK_TOKEN", "")
+OPERATOR_WEBHOOK_TIMEOUT_SEC = float(os.getenv("OPERATOR_WEBHOOK_TIMEOUT_SEC", "5"))
+# CA bundle verifying an https receiver; empty uses the system roots
+OPERATOR_WEBHOOK_CA_FILE = os.getenv("OPERATOR_WEBHOOK_CA_FILE", "")
+
+# Test-only: allow TrafficSchedules to overlay synthetic carbon spikes/dips
+CHAOS_MODE_ENABLED = os.getenv("CHAOS_MODE_ENABLED", "false").lower() in ("1", "true", "yes")
+
 # Configuration keys that can be overridden via API
 SCHEDULER_CONFIG_KEYS = {
     "targetError",      # Target quality error threshold
@@ -186,6 +227,13 @@ def _parse_flavours(data: Any) -> List[FlavourProfile]:
                 if key is not None and value is not None
             }
 
+        # Right-sized requests, sent when the schedule enables rightsizing
+        resources = item.get("resources")
+        cpu = memory = None
+        if isinstance(resources, Mapping):
+            cpu = _as_float(resources.get("cpu"), default=0.0) or None
+            memory = _as_float(resources.get("memory"), default=0.0) or None
+
         flavours.append(
             FlavourProfile(
                 name=str(strategy_name),
@@ -193,12 +241,93 @@ def _parse_flavours(data: Any) -> List[FlavourProfile]:
                 carbon_intensity=carbon_intensity,
                 enabled=enabled,
                 annotations=annotations,
+                cpu=cpu,
+                memory=memory,
             )
         )
 
+    # Flavours without an emissions label cost their CPU relative to the largest
+    max_cpu = max((flavour.cpu or 0.0 for flavour in flavours), default=0.0)
+    if max_cpu > 0:
+        for flavour in flavours:
+            if flavour.carbon_intensity == 0.0 and flavour.cpu:
+                flavour.carbon_intensity = flavour.cpu / max_cpu
+
     return flavours
 
 
+def _parse_zone_providers(payload: Optional[Mapping[str, Any]]) -> Dict[str, CarbonForecastProvider]:
+    """
+    Build one carbon forecast provider per locality zone.
+
+    Args:
+        payload: Raw configuration data, optionally holding a "zones" list of
+            {"name": "<region>/<zone>", "carbonTarget": "<target>"} entries
+
+    Returns:
+        Dictionary mapping zone names to their forecast providers
+    """
+    providers: Dict[str, CarbonForecastProvider] = {}
+    if not payload or not isinstance(payload, Mapping):
+        return providers
+    zones = payload.get("zones")
+    if not isinstance(zones, list):
+        return providers
+    for item in zones:
+        if not isinstance(item, Mapping):
+            continue
+        name = item.get("name")
+        target = item.get("carbonTarget")
+        if not name or not target:
+            continue
+        providers[str(name)] = CarbonForecastProvider(target=str(target))
+    return providers
+
+
+def _parse_chaos_windows(payload: Optional[Mapping[str, Any]]) -> List[ChaosWindow]:
+    """
+    Parse the synthetic carbon windows of a schedule.
+
+    Args:
+        payload: Raw configuration data, optionally holding a "chaos" list of
+            {"name", "start", "period", "duration", "factor", "intensity"} entries
+
+    Returns:
+        The valid windows, or an empty list when chaos mode is disabled
+    """
+    if not payload or not isinstance(payload, Mapping):
+        return []
+    raw = payload.get("chaos")
+    if not isinstance(raw, list) or not raw:
+        return []
+    if not CHAOS_MODE_ENABLED:
+        LOGGER.warning("Ignoring %d chaos windows: CHAOS_MODE_ENABLED is not set", len(raw))
+        return []
+    windows: List[ChaosWindow] = []
+    for item in raw:
+        if not isinstance(item, Mapping):
+            continue
+        factor = item.get("factor")
+        intensity = item.get("intensity")
+        if factor is None and intensity is None:
+            continue
+        try:
+            window = ChaosWindow(
+                name=str(item.get("name") or f"window-{len(windows)}"),
+                duration=float(item.get("duration") or 0),
+                period=float(item.get("period") or 0),
+                start=float(item.get("start") or 0),
+                factor=float(factor) if factor is not None else None,
+                intensity=float(intensity) if intensity is not None else None,
+            )
+        except (TypeError, ValueError):
+            continue
+        if window.duration <= 0:
+            continue
+        windows.append(window)
+    return windows
+
+
 def _as_int(value: Any) -> Optional[int]:
     """Safely convert value to int, returning None on error."""
     if value is None:
@@ -321,6 +450,7 @@ def _build_engine(
     config_overrides: Optional[Dict[str, Any]] = None,
     component_bounds: Optional[Dict[str, Dict[str, int]]] = None,
     flavours: Optional[List[FlavourProfile]] = None,
+    chaos_windows: Optional[List[ChaosWindow]] = None,
 ) -> SchedulerEngine:
     """
     Create a SchedulerEngine instance with given configuration.
@@ -331,6 +461,7 @@ def _build_engine(
         config_overrides: Optional configuration parameter overrides
         component_bounds: Optional min/max replica constraints
         flavours: Optional list of precision flavours to use
+        chaos_windows: Optional synthetic carbon windows (chaos mode only)
         
     Returns:
         Configured SchedulerEngine instance
@@ -344,6 +475,7 @@ def _build_engine(
         name=name,
         component_bounds=component_bounds,
         flavours=flavours,
+        chaos_windows=chaos_windows,
     )
 
 
@@ -376,6 +508,8 @@ class SchedulerSession:
         
         # Thread synchronization primitives
         self._lock = threading.RLock()
+        self._updated = threading.Condition(self._lock)  # Signals schedule changes
+        self._version = 0                                # Bumped on every schedule change
         self._refresh_event = threading.Event()  # Signals schedule refresh needed
         self._stop_event = threading.Event()     # Signals shutdown
         
@@ -392,9 +526,11 @@ class SchedulerSession:
             config_overrides,
             component_bounds,
             flavours=self._flavours,
+            chaos_windows=_parse_chaos_windows(payload),
         )
         self._config_overrides = dict(config_overrides)
         self._component_bounds = component_bounds
+        self._zone_providers = _parse_zone_providers(payload)
         
         # Schedule state
         self._manual_schedule: Optional[Dict[str, Any]] = None  # Manual override
@@ -418,6 +554,15 @@ class SchedulerSession:
         )
         self._metrics_thread.start()
 
+        # Push decisions to the operator when it runs the schedule receiver
+        if OPERATOR_WEBHOOK_URL:
+            self._push_thread = threading.Thread(
+                target=self._push_loop,
+                name=f"schedule-push[{namespace}/{name}]",
+                daemon=True,
+            )
+            self._push_thread.start()
+
     def apply_overrides(self, payload: Dict[str, Any]) -> None:
         """
         Apply configuration overrides and rebuild the scheduler engine.
@@ -445,6 +590,7 @@ class SchedulerSession:
             config_overrides,
             component_bounds,
             flavours=next_flavours,
+            chaos_windows=_parse_chaos_windows(payload),
         )
         
         # Update state atomically
@@ -452,10 +598,12 @@ class SchedulerSession:
             self._engine = engine
             self._config_overrides = dict(config_overrides)
             self._component_bounds = component_bounds
+            self._zone_providers = _parse_zone_providers(payload)
             self._flavours = next_flavours
             self._manual_schedule = None  # Clear manual override
             self._manual_expiry = 0.0
             self._schedule = None         # Invalidate current schedule
+            self._changed()
         self._refresh_event.set()  # Trigger immediate refresh
 
     def get_schedule(self) -> Optional[Dict[str, Any]]:
@@ -489,8 +637,32 @@ class SchedulerSession:
             self._manual_schedule = dict(payload)
             self._manual_expiry = time.time() + ttl
             self._schedule = dict(payload)
+            self._changed()
         self._refresh_event.set()
 
+    def wait_for_schedule(self, version: Optional[int], timeout: float) -> Tuple[int, Optional[Dict[str, Any]]]:
+        """
+        Wait until the schedule changes past version, or timeout elapses.
+
+        Args:
+            version: Last version seen by the caller, None to return right away
+            timeout: Maximum wait in seconds
+
+        Returns:
+            Current version and schedule (None while not computed yet)
+        """
+        with self._updated:
+            self._updated.wait_for(
+                lambda: self._version != version or self._stop_event.is_set(),
+                timeout=timeout,
+            )
+            return self._version, self.get_schedule()
+
+    def _changed(self) -> None:
+        """Record a schedule change and wake up the watchers. Caller holds the lock."""
+        self._version += 1
+        self._updated.notify_all()
+
     def request_refresh(self) -> None:
         """Request an immediate schedule refresh."""
         self._refresh_event.set()
@@ -580,6 +752,7 @@ class SchedulerSession:
             # Check if manual override is active
             with self._lock:
                 engine = self._engine
+                zone_providers = dict(self._zone_providers)
                 manual_active = self._manual_schedule is not None and self._manual_expiry > time.time()
 
             if manual_active:
@@ -590,6 +763,9 @@ class SchedulerSession:
                 LOGGER.debug("Evaluating schedule for %s/%s", self.namespace, self.name)
                 decision = engine.evaluate()
                 schedule = decision.as_dict()
+                zones = self._zone_forecasts(zone_providers)
+                if zones:
+                    schedule["zones"] = zones
                 LOGGER.info(
                     "Schedule updated for %s/%s: carbon_now=%.1f, avg_precision=%.3f, validUntil=%s",
                     self.namespace,
@@ -613,6 +789,52 @@ class SchedulerSession:
                 self._schedule = schedule
                 self._manual_schedule = None
                 self._manual_expiry = 0.0
+                self._changed()
+
+    @staticmethod
+    def _zone_forecasts(providers: Dict[str, CarbonForecastProvider]) -> Dict[str, float]:
+        """
+        Fetch the current carbon intensity of every locality zone.
+
+        Zones without a forecast are left out so the operator never routes on stale data.
+        """
+        forecasts: Dict[str, float] = {}
+        for zone, provider in providers.items():
+            try:
+                snapshot = provider.fetch()
+            except Exception as exc:  # noqa: BLE001
+                LOGGER.warning("Failed to fetch forecast for zone %s: %s", zone, exc)
+                continue
+            if snapshot.intensity_now is not None:
+                forecasts[zone] = snapshot.intensity_now
+        return forecasts
+
+    def _push_loop(self) -> None:
+        """
+        Schedule push loop - runs in background thread.
+
+        POSTs every new schedule to the operator's schedule receiver. A failed
+        push is only logged: the operator still polls the REST API, so the
+        decision reaches it at its next poll at the latest.
+        """
+        url = f"{OPERATOR_WEBHOOK_URL}/schedules/{self.namespace}/{self.name}"
+        headers = {"Authorization": f"Bearer {OPERATOR_WEBHOOK_TOKEN}"} if OPERATOR_WEBHOOK_TOKEN else {}
+        verify: Any = OPERATOR_WEBHOOK_CA_FILE or True
+        seen: Optional[int] = None
+        while not self._stop_event.is_set():
+            version, schedule = self.wait_for_schedule(seen, GRPC_WATCH_HEARTBEAT_SEC)
+            if version == seen:
+                continue
+            seen = version
+            if schedule is None:
+                continue
+            try:
+                response = requests.post(
+                    url, json=schedule, headers=headers, timeout=OPERATOR_WEBHOOK_TIMEOUT_SEC, verify=verify
+                )
+                response.raise_for_status()
+            except requests.RequestException as exc:
+                LOGGER.warning("Failed to push schedule %s/%s to the operator: %s", self.namespace, self.name, exc)
 
     def _metrics_poll_loop(self) -> None:
         """
@@ -683,6 +905,8 @@ class SchedulerSession:
         """Gracefully shutdown the scheduler session and background thread."""
         self._stop_event.set()
         self._refresh_event.set()
+        with self._updated:
+            self._updated.notify_all()
         if self._thread.is_alive():
             self._thread.join(timeout=2)
 
@@ -744,6 +968,31 @@ class SchedulerRegistry:
             raise ScheduleNotReady(namespace, name)
         return schedule
 
+    def wait_for_schedule(
+        self, namespace: str, name: str, version: Optional[int], timeout: float
+    ) -> Tuple[int, Optional[Dict[str, Any]]]:
+        """
+        Wait for a schedule change of a TrafficSchedule.
+
+        Args:
+            namespace: Kubernetes namespace
+            name: TrafficSchedule name
+            version: Last version seen by the caller, None to return right away
+            timeout: Maximum wait in seconds
+
+        Returns:
+            Current version and schedule (None while not computed yet)
+
+        Raises:
+            KeyError: If no session exists for this namespace/name
+        """
+        key = (namespace, name)
+        with self._lock:
+            session = self._sessions.get(key)
+        if session is None:
+            raise KeyError(key)
+        return session.wait_for_schedule(version, timeout)
+
     def manual_override(self, namespace: str, name: str, payload: Dict[str, Any]) -> None:
         """
         Set a manual schedule override for a TrafficSchedule.
@@ -828,6 +1077,29 @@ registry = SchedulerRegistry()
 # REST API Endpoints
 # ============================================================================
 
+def _request_token() -> str:
+    """Return the credential sent as a bearer token or X-API-Key header."""
+    scheme, _, token = request.headers.get("Authorization", "").partition(" ")
+    if scheme.lower() == "bearer" and token.strip():
+        return token.strip()
+    return request.headers.get("X-API-Key", "").strip()
+
+
+def _token_accepted(token: str) -> bool:
+    """Return whether token is one of API_TOKENS."""
+    return bool(token) and any(hmac.compare_digest(token.encode(), accepted.encode()) for accepted in API_TOKENS)
+
+
+@app.before_request
+def authenticate() -> Any:
+    """Reject requests without a valid credential when API_TOKENS is set."""
+    if not API_TOKENS or request.path == "/healthz":
+        return None
+    if _token_accepted(_request_token()):
+        return None
+    return jsonify({"error": "unauthorized"}), 401
+
+
 @app.route("/schedule")
 def get_default_schedule() -> Any:
     """
@@ -868,6 +1140,52 @@ def get_schedule(namespace: str, name: str) -> Any:
     return jsonify(schedule)
 
 
+@app.route("/schedule/<namespace>/<name>/events")
+def watch_schedule(namespace: str, name: str) -> Any:
+    """
+    Stream the schedule of a TrafficSchedule as server-sent events.
+
+    The current schedule is sent first, then every new decision as a
+    "schedule" event carrying the same JSON as GET /schedule/<namespace>/<name>.
+    Comments are sent as heartbeats while the schedule does not change.
+
+    Args:
+        namespace: Kubernetes namespace
+        name: TrafficSchedule name
+
+    Returns:
+        200: text/event-stream of schedules
+        404: Schedule not found (no configuration pushed yet)
+    """
+    try:
+        registry.wait_for_schedule(namespace, name, None, 0)
+    except KeyError:
+        return jsonify({"error": f"unknown schedule {namespace}/{name}"}), 404
+
+    def events() -> Iterator[str]:
+        seen: Optional[int] = None
+        while True:
+            try:
+                version, schedule = registry.wait_for_schedule(
+                    namespace, name, seen, EVENTS_HEARTBEAT_SEC
+                )
+            except KeyError:
+                # The configuration was dropped; the operator pushes it again
+                return
+            if version == seen:
+                yield ": heartbeat\n\n"
+                continue
+            seen = version
+            if schedule is not None:
+                yield f"id: {version}\nevent: schedule\ndata: {json.dumps(schedule)}\n\n"
+
+    return Response(
+        events(),
+        mimetype="text/event-stream",
+        headers={"Cache-Control": "no-cache", "X-Accel-Buffering": "no"},
+    )
+
+
 @app.route("/setschedule", methods=["POST"])
 def set_default_manual_schedule() -> Any:
     """
@@ -1018,6 +1336,105 @@ def health() -> Any:
     return jsonify({"status": "ready"}), 200
 
 
+# ============================================================================
+# gRPC API
+# ============================================================================
+
+def _schedule_message(schedule: Dict[str, Any]) -> decision_engine_pb2.Schedule:
+    """Convert a schedule dictionary, as served by the REST API, to its message."""
+    return json_format.ParseDict(schedule, decision_engine_pb2.Schedule(), ignore_unknown_fields=True)
+
+
+class DecisionEngineService(decision_engine_pb2_grpc.DecisionEngineServicer):
+    """
+    gRPC counterpart of the REST API, used by the operator with --engine-protocol=grpc.
+
+    WatchSchedule pushes every new decision, so the operator does not poll.
+    """
+
+    def PutConfig(self, request: Any, context: grpc.ServicerContext) -> Any:
+        ref = request.schedule
+        payload = json_format.MessageToDict(request.config)
+        registry.configure(ref.namespace, ref.name, payload)
+        return decision_engine_pb2.PutConfigResponse()
+
+    def GetSchedule(self, request: Any, context: grpc.ServicerContext) -> Any:
+        ref = request.schedule
+        try:
+            schedule = registry.get_schedule(ref.namespace, ref.name)
+        except KeyError:
+            context.abort(grpc.StatusCode.NOT_FOUND, f"unknown schedule {ref.namespace}/{ref.name}")
+        except ScheduleNotReady:
+            context.abort(grpc.StatusCode.UNAVAILABLE, f"schedule {ref.namespace}/{ref.name} is pending")
+        return _schedule_message(schedule)
+
+    def WatchSchedule(self, request: Any, context: grpc.ServicerContext) -> Iterator[Any]:
+        ref = request.schedule
+        seen: Optional[int] = None
+        while context.is_active():
+            try:
+                version, schedule = registry.wait_for_schedule(
+                    ref.namespace, ref.name, seen, GRPC_WATCH_HEARTBEAT_SEC
+                )
+            except KeyError:
+                context.abort(grpc.StatusCode.NOT_FOUND, f"unknown schedule {ref.namespace}/{ref.name}")
+            if version == seen:
+                continue
+            seen = version
+            if schedule is not None:
+                yield _schedule_message(schedule)
+
+
+class TokenInterceptor(grpc.ServerInterceptor):
+    """Reject calls without a valid credential when API_TOKENS is set, like the REST API."""
+
+    def __init__(self) -> None:
+        def deny(request: Any, context: grpc.ServicerContext) -> Any:
+            context.abort(grpc.StatusCode.UNAUTHENTICATED, "unauthorized")
+
+        self._deny_unary = grpc.unary_unary_rpc_method_handler(deny)
+        self._deny_stream = grpc.unary_stream_rpc_method_handler(deny)
+
+    def intercept_service(self, continuation: Any, handler_call_details: Any) -> Any:
+        if not API_TOKENS:
+            return continuation(handler_call_details)
+        metadata = dict(handler_call_details.invocation_metadata or ())
+        scheme, _, token = metadata.get("authorization", "").partition(" ")
+        if scheme.lower() != "bearer" or not token.strip():
+            token = metadata.get("x-api-key", "")
+        if _token_accepted(token.strip()):
+            return continuation(handler_call_details)
+        if handler_call_details.method.endswith("/WatchSchedule"):
+            return self._deny_stream
+        return self._deny_unary
+
+
+def serve_grpc(port: int) -> grpc.Server:
+    """Start the gRPC API on port in background threads."""
+    server = grpc.server(
+        futures.ThreadPoolExecutor(max_workers=GRPC_MAX_WORKERS),
+        interceptors=[TokenInterceptor()],
+    )
+    decision_engine_pb2_grpc.add_DecisionEngineServicer_to_server(DecisionEngineService(), server)
+    if GRPC_TLS_CERT_FILE:
+        with open(GRPC_TLS_CERT_FILE, "rb") as cert, open(GRPC_TLS_KEY_FILE, "rb") as key:
+            pair = (key.read(), cert.read())
+        client_ca = None
+        if GRPC_TLS_CLIENT_CA_FILE:
+            with open(GRPC_TLS_CLIENT_CA_FILE, "rb") as ca:
+                client_ca = ca.read()
+        credentials = grpc.ssl_server_credentials(
+            [pair], root_certificates=client_ca, require_client_auth=client_ca is not None
+        )
+        server.add_secure_port(f"[::]:{port}", credentials)
+    else:
+        if API_TOKENS:
+            LOGGER.warning("gRPC API serves API_TOKENS in plaintext, set GRPC_TLS_CERT_FILE")
+        server.add_insecure_port(f"[::]:{port}")
+    server.start()
+    return server
+
+
 # ============================================================================
 # Main Entry Point
 # ============================================================================
@@ -1031,5 +1448,10 @@ if __name__ == "__main__":
     # Don't create default scheduler session - only create sessions when configured by operator
     # registry.ensure_default()
 
+    # Start gRPC API server
+    if GRPC_PORT:
+        LOGGER.info("Starting gRPC API on port %s", GRPC_PORT)
+        grpc_server = serve_grpc(GRPC_PORT)
+
     # Start Flask API server
     app.run(host="0.0.0.0", port=80)
\ No newline at end of file
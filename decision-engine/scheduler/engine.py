@@ -36,7 +36,7 @@ from .models import (
     precision_key,
 )
 from .strategies import CreditGreedyPolicy, ForecastAwarePolicy, ForecastAwareGlobalPolicy, P100Policy, RandomPolicy, RoundRobinPolicy, SchedulerPolicy
-from .providers import CarbonForecastProvider, DemandEstimator, ForecastManager
+from .providers import CarbonForecastProvider, ChaosForecastProvider, ChaosWindow, DemandEstimator, ForecastManager
 
 _LOGGER = logging.getLogger("scheduler")
 
@@ -134,6 +134,12 @@ _METRIC_FORECAST = Gauge(
     ["namespace", "schedule", "policy", "horizon"],
 )
 
+_METRIC_CHAOS = Gauge(
+    "scheduler_chaos_active",
+    "1 while a synthetic chaos window overrides the carbon signal",
+    ["namespace", "schedule"],
+)
+
 
 class ForecastCollector(Collector):
     """
@@ -237,6 +243,7 @@ class SchedulerEngine:
         name: str = "default",
         component_bounds: Optional[Mapping[str, Mapping[str, int]]] = None,
         flavours: Optional[Iterable[FlavourProfile]] = None,
+        chaos_windows: Optional[Iterable[ChaosWindow]] = None,
     ) -> None:
         """
         Initialize scheduler engine.
@@ -247,6 +254,7 @@ class SchedulerEngine:
             name: Name of TrafficSchedule resource
             component_bounds: Min/max replica constraints per component
             flavours: Precision flavours to use (defaults if None)
+            chaos_windows: Synthetic carbon windows overlaid onto the forecast
         """
         self.namespace = namespace
         self.name = name
@@ -285,6 +293,9 @@ class SchedulerEngine:
         self.registry = FlavourRegistry(initial_flavours)
         # Pass carbon_cache_ttl from config to provider
         carbon_provider = CarbonForecastProvider(cache_ttl=self.config.carbon_cache_ttl)
+        windows = list(chaos_windows) if chaos_windows else []
+        if windows:
+            carbon_provider = ChaosForecastProvider(carbon_provider, windows)
         self.forecast_manager = ForecastManager(carbon_provider, DemandEstimator())
         self.policy = self._build_policy(self.config.policy_name)
         self._lock = threading.Lock()
@@ -298,6 +309,7 @@ class SchedulerEngine:
         self._metric_ceiling = _METRIC_CEILING
         self._metric_policy_choice = _METRIC_POLICY_CHOICE
         self._metric_forecast = _METRIC_FORECAST
+        self._metric_chaos = _METRIC_CHAOS
 
     def _load_config(self) -> SchedulerConfig:
         return SchedulerConfig(
@@ -387,6 +399,20 @@ class SchedulerEngine:
                 scaling,
                 forecast,
             )
+            if forecast.chaos_window is not None:
+                diagnostics = dict(decision.diagnostics)
+                diagnostics["chaos_active"] = 1.0
+                if forecast.intensity_real is not None:
+                    diagnostics["carbon_real"] = forecast.intensity_real
+                decision.diagnostics = diagnostics
+                _LOGGER.info(
+                    "Chaos window %s active for %s/%s: carbon_now=%s (real %s)",
+                    forecast.chaos_window,
+                    self.namespace,
+                    self.name,
+                    forecast.intensity_now,
+                    forecast.intensity_real,
+                )
             self._update_metrics(decision, result, forecast)
             return decision
 
@@ -400,6 +426,8 @@ class SchedulerEngine:
             self._metric_flavour.labels(self.namespace, self.name, flavour).set(weight)
         self._metric_valid_until.labels(self.namespace, self.name).set(decision.valid_until.timestamp())
 
+        self._metric_chaos.labels(self.namespace, self.name).set(1.0 if forecast.chaos_window is not None else 0.0)
+
         policy = self.config.policy_name
         self._metric_credit_balance.labels(self.namespace, self.name, policy).set(decision.credits["balance"])
         self._metric_credit_velocity.labels(self.namespace, self.name, policy).set(decision.credits["velocity"])
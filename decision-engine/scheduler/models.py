@@ -37,6 +37,21 @@ def precision_key(precision: float) -> str:
     return f"precision-{int(round(clamped * 100))}"
 
 
+# Forecast slots published with each schedule: a day of half-hour slots.
+MAX_PUBLISHED_SLOTS = 48
+
+
+def upcoming_slots(schedule: List["ForecastPoint"], now: Optional[datetime] = None) -> List["ForecastPoint"]:
+    """Return the forecast slots that have not ended yet, at most MAX_PUBLISHED_SLOTS."""
+    now = now or datetime.now(timezone.utc)
+    upcoming = []
+    for point in schedule:
+        end = point.end if point.end.tzinfo is not None else point.end.replace(tzinfo=timezone.utc)
+        if end > now:
+            upcoming.append(point)
+    return upcoming[:MAX_PUBLISHED_SLOTS]
+
+
 @dataclass
 class FlavourProfile:
     """
@@ -51,6 +66,8 @@ class FlavourProfile:
         carbon_intensity: Estimated carbon cost per request (gCO2eq)
         enabled: Whether this flavour is currently available
         annotations: Metadata from Kubernetes deployment labels
+        cpu: Per-pod CPU requests in cores (VPA recommendation or declared)
+        memory: Per-pod memory requests in bytes
     """
 
     name: str
@@ -58,6 +75,8 @@ class FlavourProfile:
     carbon_intensity: float = 0.0  # gCO2eq per request
     enabled: bool = True
     annotations: Mapping[str, str] = field(default_factory=dict)
+    cpu: Optional[float] = None
+    memory: Optional[float] = None
 
     def expected_error(self) -> float:
         """
@@ -113,6 +132,8 @@ class ForecastSnapshot:
         demand_next: Next period demand estimate
         generated_at: Timestamp when forecast was generated
         schedule: Extended forecast schedule for future periods
+        chaos_window: Name of the synthetic chaos window overriding intensity_now
+        intensity_real: Real current carbon intensity while a chaos window is active
     """
 
     intensity_now: Optional[float] = None
@@ -123,6 +144,8 @@ class ForecastSnapshot:
     demand_next: Optional[float] = None
     generated_at: datetime = field(default_factory=datetime.utcnow)
     schedule: List[ForecastPoint] = field(default_factory=list)
+    chaos_window: Optional[str] = None
+    intensity_real: Optional[float] = None
 
 
 @dataclass
@@ -449,6 +472,9 @@ class ScheduleDecision:
         diagnostics: Policy-specific diagnostic values
         avg_precision: Weighted average precision of the schedule
         scaling: Autoscaling recommendations
+        carbon_now: Grid carbon intensity of the current slot (gCO2eq/kWh)
+        carbon_next: Grid carbon intensity of the next slot (gCO2eq/kWh)
+        carbon_schedule: Upcoming forecast slots, for clients planning deferrable work
     """
 
     flavour_weights: Dict[str, int]
@@ -459,6 +485,9 @@ class ScheduleDecision:
     diagnostics: Dict[str, float]
     avg_precision: float
     scaling: ScalingDirective
+    carbon_now: Optional[float] = None
+    carbon_next: Optional[float] = None
+    carbon_schedule: List[ForecastPoint] = field(default_factory=list)
 
     def as_dict(self) -> Dict[str, object]:
         """
@@ -468,7 +497,7 @@ class ScheduleDecision:
             Dictionary with all schedule fields in API format
         """
 
-        return {
+        result: Dict[str, object] = {
             "flavourWeights": self.flavour_weights,
             "flavours": self.flavours,
             "validUntil": self.valid_until.strftime("%Y-%m-%dT%H:%M:%SZ"),
@@ -478,6 +507,16 @@ class ScheduleDecision:
             "avgPrecision": self.avg_precision,
             "processing": self.scaling.as_dict(),
         }
+        carbon: Dict[str, object] = {
+            key: value
+            for key, value in (("now", self.carbon_now), ("next", self.carbon_next))
+            if value is not None
+        }
+        if self.carbon_schedule:
+            carbon["schedule"] = [point.as_dict() for point in self.carbon_schedule]
+        if carbon:
+            result["carbon"] = carbon
+        return result
 
     @classmethod
     def from_policy(
@@ -566,4 +605,7 @@ class ScheduleDecision:
             diagnostics=policy_result.diagnostics.fields,
             avg_precision=policy_result.avg_precision,
             scaling=scaling,
+            carbon_now=forecast.intensity_now,
+            carbon_next=forecast.intensity_next,
+            carbon_schedule=upcoming_slots(forecast.schedule),
         )
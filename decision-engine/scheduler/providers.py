@@ -7,7 +7,7 @@ import os
 import logging
 import threading
 import time
-from dataclasses import dataclass
+from dataclasses import dataclass, replace
 from datetime import datetime, timedelta, timezone
 from typing import Any, List, Optional
 
@@ -243,6 +243,86 @@ class CarbonForecastProvider:
             return None
 
 
+@dataclass
+class ChaosWindow:
+    """Recurring window replacing the carbon signal with a synthetic spike or dip.
+
+    The window is open for ``duration`` seconds every ``period`` seconds from
+    ``start`` (Unix seconds); a zero period opens it once.
+    """
+
+    name: str
+    duration: float
+    period: float = 0.0
+    start: float = 0.0
+    factor: Optional[float] = None
+    intensity: Optional[float] = None
+
+    def active_at(self, moment: datetime) -> bool:
+        elapsed = moment.timestamp() - self.start
+        if elapsed < 0:
+            return False
+        if self.period > 0:
+            elapsed %= self.period
+        return elapsed < self.duration
+
+    def apply(self, value: Optional[float]) -> Optional[float]:
+        if self.intensity is not None:
+            return self.intensity
+        if self.factor is not None and value is not None:
+            return value * self.factor
+        return value
+
+
+class ChaosForecastProvider:
+    """Overlay chaos windows onto the forecast of another provider.
+
+    Meant for rehearsing throttling behaviour; the decision engine only builds
+    it when CHAOS_MODE_ENABLED is set.
+    """
+
+    # Slot length assumed for intensity_next when the forecast has no schedule
+    _SLOT = timedelta(minutes=30)
+
+    def __init__(self, inner: CarbonForecastProvider, windows: List[ChaosWindow]) -> None:
+        self._inner = inner
+        self._windows = list(windows)
+
+    def _window_at(self, moment: datetime) -> Optional[ChaosWindow]:
+        for window in self._windows:
+            if window.active_at(moment):
+                return window
+        return None
+
+    def fetch(self) -> ForecastSnapshot:
+        snapshot = self._inner.fetch()
+        now = datetime.now(timezone.utc)
+
+        # The inner provider caches its schedule, so points are copied, not edited
+        schedule: List[ForecastPoint] = []
+        for point in snapshot.schedule:
+            window = self._window_at(point.start)
+            if window is None:
+                schedule.append(point)
+            else:
+                schedule.append(replace(point, forecast=window.apply(point.forecast), index=None))
+
+        current = self._window_at(now)
+        next_moment = snapshot.schedule[1].start if len(snapshot.schedule) > 1 else now + self._SLOT
+        upcoming = self._window_at(next_moment)
+
+        overlaid = replace(snapshot, schedule=schedule)
+        if current is not None:
+            overlaid.intensity_real = snapshot.intensity_now
+            overlaid.intensity_now = current.apply(snapshot.intensity_now)
+            overlaid.index_now = None
+            overlaid.chaos_window = current.name
+        if upcoming is not None:
+            overlaid.intensity_next = upcoming.apply(snapshot.intensity_next)
+            overlaid.index_next = None
+        return overlaid
+
+
 @dataclass
 class DemandEstimate:
     current: float
@@ -0,0 +1,126 @@
+"""
+Chaos windows over the carbon forecast. Run from decision-engine with
+`python -m unittest discover tests`.
+"""
+import sys
+import types
+import unittest
+from datetime import datetime, timedelta, timezone
+
+try:
+    import prometheus_client  # noqa: F401
+except ImportError:
+    # The scheduler package registers metrics on import; none are asserted on here
+    class _Metric:
+        def __init__(self, *args, **kwargs):
+            pass
+
+        def labels(self, *args, **kwargs):
+            return self
+
+        def __getattr__(self, name):
+            return lambda *args, **kwargs: None
+
+    stub = types.ModuleType("prometheus_client")
+    stub.Counter = stub.Gauge = _Metric
+    core = types.ModuleType("prometheus_client.core")
+    core.GaugeMetricFamily = _Metric
+    core.REGISTRY = _Metric()
+    registry = types.ModuleType("prometheus_client.registry")
+    registry.Collector = object
+    stub.core, stub.registry = core, registry
+    sys.modules.update({
+        "prometheus_client": stub,
+        "prometheus_client.core": core,
+        "prometheus_client.registry": registry,
+    })
+
+from scheduler.models import ForecastPoint, ForecastSnapshot  # noqa: E402
+from scheduler.providers import ChaosForecastProvider, ChaosWindow  # noqa: E402
+
+START = datetime(2025, 6, 1, 12, 0, tzinfo=timezone.utc)
+
+
+class _StaticProvider:
+    def __init__(self, snapshot):
+        self.snapshot = snapshot
+
+    def fetch(self):
+        return self.snapshot
+
+
+class ChaosWindowTest(unittest.TestCase):
+    def test_one_shot(self):
+        window = ChaosWindow(name="spike", duration=600, start=START.timestamp())
+        self.assertFalse(window.active_at(START - timedelta(seconds=1)))
+        self.assertTrue(window.active_at(START))
+        self.assertTrue(window.active_at(START + timedelta(seconds=599)))
+        self.assertFalse(window.active_at(START + timedelta(seconds=600)))
+        self.assertFalse(window.active_at(START + timedelta(days=1)))
+
+    def test_periodic(self):
+        window = ChaosWindow(name="hourly", duration=600, period=3600, start=START.timestamp())
+        self.assertTrue(window.active_at(START + timedelta(hours=5, minutes=5)))
+        self.assertFalse(window.active_at(START + timedelta(hours=5, minutes=15)))
+        self.assertFalse(window.active_at(START - timedelta(minutes=55)))
+
+    def test_apply(self):
+        self.assertEqual(ChaosWindow(name="x", duration=1, factor=3.0).apply(100.0), 300.0)
+        self.assertEqual(ChaosWindow(name="x", duration=1, factor=3.0, intensity=50.0).apply(100.0), 50.0)
+        self.assertEqual(ChaosWindow(name="x", duration=1, intensity=50.0).apply(None), 50.0)
+        self.assertIsNone(ChaosWindow(name="x", duration=1, factor=3.0).apply(None))
+        self.assertEqual(ChaosWindow(name="x", duration=1).apply(100.0), 100.0)
+
+
+class ChaosForecastProviderTest(unittest.TestCase):
+    def snapshot(self, now):
+        slot = timedelta(minutes=30)
+        return ForecastSnapshot(
+            intensity_now=200.0,
+            intensity_next=180.0,
+            index_now="moderate",
+            index_next="moderate",
+            schedule=[
+                ForecastPoint(start=now + i * slot, end=now + (i + 1) * slot, forecast=200.0 - 20 * i, index="moderate")
+                for i in range(3)
+            ],
+        )
+
+    def test_overlays_the_active_window(self):
+        now = datetime.now(timezone.utc)
+        inner = self.snapshot(now)
+        window = ChaosWindow(name="spike", duration=45 * 60, start=(now - timedelta(minutes=1)).timestamp(), factor=2.0)
+        got = ChaosForecastProvider(_StaticProvider(inner), [window]).fetch()
+
+        self.assertEqual(got.chaos_window, "spike")
+        self.assertEqual(got.intensity_real, 200.0)
+        self.assertEqual(got.intensity_now, 400.0)
+        self.assertIsNone(got.index_now)
+        self.assertEqual(got.intensity_next, 360.0)
+        self.assertEqual([p.forecast for p in got.schedule], [400.0, 360.0, 160.0])
+        self.assertEqual([p.index for p in got.schedule], [None, None, "moderate"])
+        # The inner provider's cached schedule stays untouched
+        self.assertEqual([p.forecast for p in inner.schedule], [200.0, 180.0, 160.0])
+
+    def test_upcoming_window_only(self):
+        now = datetime.now(timezone.utc)
+        window = ChaosWindow(name="dip", duration=60, start=(now + timedelta(minutes=30)).timestamp(), intensity=20.0)
+        got = ChaosForecastProvider(_StaticProvider(self.snapshot(now)), [window]).fetch()
+
+        self.assertIsNone(got.chaos_window)
+        self.assertIsNone(got.intensity_real)
+        self.assertEqual(got.intensity_now, 200.0)
+        self.assertEqual(got.intensity_next, 20.0)
+        self.assertIsNone(got.index_next)
+
+    def test_no_schedule_uses_the_default_slot(self):
+        now = datetime.now(timezone.utc)
+        window = ChaosWindow(name="dip", duration=3600, start=(now + timedelta(minutes=20)).timestamp(), intensity=20.0)
+        got = ChaosForecastProvider(_StaticProvider(ForecastSnapshot(intensity_now=200.0, intensity_next=180.0)), [window]).fetch()
+
+        self.assertEqual(got.intensity_now, 200.0)
+        self.assertEqual(got.intensity_next, 20.0)
+
+
+if __name__ == "__main__":
+    unittest.main()
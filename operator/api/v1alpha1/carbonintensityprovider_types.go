@@ -0,0 +1,111 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CarbonIntensityProviderSpec defines the carbon intensity source of a grid
+// zone.
+type CarbonIntensityProviderSpec struct {
+	// Type is the API the forecast is read from: "carbonintensity" for the
+	// Carbon Intensity API of the GB grid, "electricitymaps" or "watttime".
+	// +kubebuilder:validation:Enum=carbonintensity;electricitymaps;watttime
+	Type string `json:"type"`
+	// Endpoint is the base URL of the API. Defaults to the URL the operator
+	// runs with for the type.
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+	// Zone is the grid zone in the format of the type: "national",
+	// "region:<id>" or "postcode:<outcode>" for carbonintensity (defaults to
+	// "national"), a zone such as "DE" for electricitymaps, a region such as
+	// "CAISO_NORTH" for watttime.
+	// +optional
+	Zone string `json:"zone,omitempty"`
+	// SecretRef names the Secret holding the credentials of the API: the token
+	// under "token" for electricitymaps, the account under "username" and
+	// "password" for watttime.
+	// +optional
+	SecretRef *corev1.SecretReference `json:"secretRef,omitempty"`
+	// RefreshIntervalSeconds is how often the forecast is fetched. Defaults to
+	// 300.
+	// +optional
+	// +kubebuilder:validation:Minimum=30
+	RefreshIntervalSeconds *int32 `json:"refreshIntervalSeconds,omitempty"`
+}
+
+// CarbonIntensityProviderStatus defines the observed state of
+// CarbonIntensityProvider.
+type CarbonIntensityProviderStatus struct {
+	// ObservedGeneration is the spec generation of the last fetch.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// CarbonForecastNow and CarbonForecastNext are the intensities of the
+	// current and next slot, in gCO2/kWh.
+	// +optional
+	CarbonForecastNow string `json:"carbonForecastNow,omitempty"`
+	// +optional
+	CarbonForecastNext string `json:"carbonForecastNext,omitempty"`
+	// CarbonIndex is the qualitative band of the current slot, such as "low".
+	// +optional
+	CarbonIndex string `json:"carbonIndex,omitempty"`
+	// ForecastSchedule is the forecast from the current slot on.
+	// +optional
+	ForecastSchedule []ForecastSlot `json:"forecastSchedule,omitempty"`
+	// LastUpdated is when the forecast was last fetched.
+	// +optional
+	LastUpdated metav1.Time `json:"lastUpdated,omitempty"`
+	// Conditions report the outcome of the last fetch.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster,shortName=cip
+// +kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`
+// +kubebuilder:printcolumn:name="Zone",type=string,JSONPath=`.spec.zone`
+// +kubebuilder:printcolumn:name="Now",type=string,JSONPath=`.status.carbonForecastNow`
+// +kubebuilder:printcolumn:name="Index",type=string,JSONPath=`.status.carbonIndex`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// CarbonIntensityProvider keeps the current and forecast carbon intensity of a
+// grid zone, which TrafficSchedules reference by name instead of fetching it
+// themselves.
+type CarbonIntensityProvider struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CarbonIntensityProviderSpec   `json:"spec,omitempty"`
+	Status CarbonIntensityProviderStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CarbonIntensityProviderList contains a list of CarbonIntensityProvider.
+type CarbonIntensityProviderList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CarbonIntensityProvider `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CarbonIntensityProvider{}, &CarbonIntensityProviderList{})
+}
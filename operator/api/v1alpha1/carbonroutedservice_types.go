@@ -0,0 +1,396 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BufferConfig tunes the buffer service queues of a routed Service.
+type BufferConfig struct {
+	// QueueLengthTarget is the number of ready messages per buffered queue at
+	// which consumers and targets scale out. Defaults to 300.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	QueueLengthTarget *int32 `json:"queueLengthTarget,omitempty"`
+	// Concurrency is the number of in-flight requests per queue in the consumer.
+	// Defaults to 32.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Concurrency *int32 `json:"concurrency,omitempty"`
+	// MinRequestDuration is the minimum time in seconds a consumer spends on a
+	// request (e.g. "0.02"). Defaults to "0.02".
+	// +optional
+	MinRequestDuration *string `json:"minRequestDuration,omitempty"`
+	// Policies set how the requests of single precisions are buffered.
+	// Precisions without a policy are always buffered.
+	// +optional
+	// +listType=map
+	// +listMapKey=precision
+	Policies []BufferPolicy `json:"policies,omitempty"`
+	// DirectMethods are sent by the router to the direct queue of the highest
+	// precision, whatever the schedule weights and the routing header, so e.g.
+	// POST, PUT and DELETE requests are neither degraded nor delayed.
+	// +optional
+	DirectMethods []HTTPMethod `json:"directMethods,omitempty"`
+	// PriorityClasses split the buffered requests of each precision into
+	// classes with queues of their own, e.g. interactive requests ahead of
+	// background ones. The router puts a request in the first class it
+	// matches, and the others in the default class. While the processing
+	// throttle constrains the consumers, the classes of higher weight are
+	// drained first, and their backlog scales the consumers and precision
+	// Deployments out sooner.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	// +kubebuilder:validation:MaxItems=8
+	PriorityClasses []PriorityClass `json:"priorityClasses,omitempty"`
+}
+
+// PriorityClass is a class of buffered requests. A request matches it when it
+// matches every field set.
+type PriorityClass struct {
+	// Name of the class. Its buffered queues are named with the type
+	// "queue-<name>".
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=32
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+	// Weight ranks the class against the others and the default class, which
+	// weighs 1. The consumers serve the waiting requests of the highest weight
+	// first, and scale out when a class queue reaches the queue length target
+	// divided by its weight.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	Weight int32 `json:"weight"`
+	// Methods match the HTTP method.
+	// +optional
+	Methods []HTTPMethod `json:"methods,omitempty"`
+	// +optional
+	Path *PathMatch `json:"path,omitempty"`
+	// Headers match request headers by exact value, e.g. a header set by the
+	// interactive clients.
+	// +optional
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// BufferPolicy sets whether the requests of a precision wait in the buffered
+// queue, which the processing throttle drains, or skip it through the direct
+// queue, so e.g. full precision requests are never delayed while the lower
+// precisions absorb the deferral.
+type BufferPolicy struct {
+	Precision int `json:"precision"`
+	// Policy is always-direct, buffer-when-throttled, which skips the buffer
+	// while the schedule does not throttle processing, or always-buffer.
+	// +kubebuilder:validation:Enum=always-direct;buffer-when-throttled;always-buffer
+	Policy string `json:"policy"`
+}
+
+// BurstReserveConfig is replica headroom withheld while the schedule throttles
+// processing and added on top of the maxReplicaCount of the consumers and
+// precision Deployments for the first minutes after the throttle lifts, so the
+// backlog built up during high carbon drains faster.
+type BurstReserveConfig struct {
+	// ConsumerReplicas is added to the consumers while the reserve is released.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	ConsumerReplicas int32 `json:"consumerReplicas,omitempty"`
+	// TargetReplicas is added to every precision Deployment while the reserve
+	// is released.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	TargetReplicas int32 `json:"targetReplicas,omitempty"`
+	// ReleaseMinutes is how long the reserve stays released at most. It is
+	// withheld again as soon as the buffered queues are drained. Defaults to 15.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	ReleaseMinutes *int32 `json:"releaseMinutes,omitempty"`
+	// PreScale raises minReplicaCount by the reserve too while it is released,
+	// so the extra replicas start right away instead of waiting for the queue
+	// triggers.
+	// +optional
+	PreScale bool `json:"preScale,omitempty"`
+}
+
+// BurstReserveStatus reports the burst reserve of a Service and the drain of
+// the backlog since its last release.
+type BurstReserveStatus struct {
+	// Phase is Withheld while the schedule throttles processing, Released while
+	// the reserve drains the backlog, and Standby otherwise.
+	Phase string `json:"phase"`
+	// ReleasedAt is when the reserve was last released, and ReleaseUntil when
+	// it is withheld again at the latest.
+	// +optional
+	ReleasedAt *metav1.Time `json:"releasedAt,omitempty"`
+	// +optional
+	ReleaseUntil *metav1.Time `json:"releaseUntil,omitempty"`
+	// BacklogAtRelease is the number of ready messages in the buffered queues
+	// when the reserve was last released, and Backlog the number now.
+	// +optional
+	BacklogAtRelease int64 `json:"backlogAtRelease,omitempty"`
+	// +optional
+	Backlog int64 `json:"backlog,omitempty"`
+	// DrainedPercent is the share of BacklogAtRelease drained since the release.
+	// +optional
+	DrainedPercent int32 `json:"drainedPercent,omitempty"`
+}
+
+// CarbonRoutedServiceSpec defines the desired state of CarbonRoutedService.
+type CarbonRoutedServiceSpec struct {
+	// ServiceName is the Service, in the same namespace, routed by carbonrouter.
+	// +kubebuilder:validation:MinLength=1
+	ServiceName string `json:"serviceName"`
+	// RoutingHeader is the request header that pins a request to a precision.
+	// Defaults to "x-carbonrouter". Istio only matches lowercase header names.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9_.]*[a-z0-9])?$`
+	// +optional
+	RoutingHeader string `json:"routingHeader,omitempty"`
+	// Router, Consumer and Target override the settings of the bound
+	// TrafficSchedule for this Service. Fields left unset are inherited.
+	// +optional
+	Router *ComponentConfig `json:"router,omitempty"`
+	// +optional
+	Consumer *ComponentConfig `json:"consumer,omitempty"`
+	// +optional
+	Target *TargetConfig `json:"target,omitempty"`
+	// +optional
+	Buffer BufferConfig `json:"buffer,omitempty"`
+	// +optional
+	BurstReserve *BurstReserveConfig `json:"burstReserve,omitempty"`
+	// RoutingRules replace the routing rules of the bound TrafficSchedule for
+	// this Service, e.g. to pin "/api/checkout" to full precision.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	RoutingRules []RoutingRule `json:"routingRules,omitempty"`
+	// Resilience replaces the route timeouts and retries of the bound
+	// TrafficSchedule for this Service.
+	// +optional
+	Resilience *ResilienceConfig `json:"resilience,omitempty"`
+	// Ingress replaces the gateways and external hostnames of the bound
+	// TrafficSchedule for this Service, so Services sharing a schedule are
+	// exposed under their own hostnames.
+	// +optional
+	Ingress *IngressConfig `json:"ingress,omitempty"`
+	// Override suspends carbon-aware routing for this Service, pinning its
+	// traffic to one precision with no replica ceiling or processing throttle,
+	// e.g. during an incident. "kubectl carbonrouter pause", "resume" and
+	// "override" set and clear it.
+	// +optional
+	Override *PrecisionOverride `json:"override,omitempty"`
+	// SLOGuard relaxes carbon throttling while the Service burns its error
+	// budget too fast, as measured by the Istio telemetry in Prometheus. It
+	// needs the operator to run with --slo-guard-prometheus-url.
+	// +optional
+	SLOGuard *SLOGuardConfig `json:"sloGuard,omitempty"`
+}
+
+// PrecisionOverride pins the traffic of a Service to one precision, until a
+// given time or until removed.
+type PrecisionOverride struct {
+	// Precision receives all the traffic. Defaults to the highest precision of
+	// the bound schedule.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Precision *int `json:"precision,omitempty"`
+	// Until is when the override lapses and the schedule applies again. Unset,
+	// the override holds until removed.
+	// +optional
+	Until *metav1.Time `json:"until,omitempty"`
+	// Reason is why routing was overridden, reported with the override.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+}
+
+// SLOGuardConfig sets the service level objectives guarded for a Service and
+// how the guard intervenes when their burn rate is too high.
+type SLOGuardConfig struct {
+	// Latency is met by the requests answered within a threshold.
+	// +optional
+	Latency *LatencySLO `json:"latency,omitempty"`
+	// Availability is met by the requests answered without a 5xx status.
+	// +optional
+	Availability *AvailabilitySLO `json:"availability,omitempty"`
+	// BurnRateThreshold is the rate at which the error budget of an objective
+	// is spent, relative to spending it exactly over the SLO period, above
+	// which the guard intervenes. Defaults to "14.4", the fast burn that spends
+	// 2% of a 30 day budget in an hour.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[0-9]+(\.[0-9]+)?$`
+	BurnRateThreshold *string `json:"burnRateThreshold,omitempty"`
+	// WindowMinutes is the window over which the burn rates are measured.
+	// Defaults to 5.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=60
+	WindowMinutes *int32 `json:"windowMinutes,omitempty"`
+	// HoldMinutes is how long an intervention lasts after the last breach.
+	// Defaults to 10.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	HoldMinutes *int32 `json:"holdMinutes,omitempty"`
+	// Action is what the guard does while intervening: relax-throttle lifts
+	// the processing throttle, flavour concurrency limits and replica
+	// ceilings, and boost-precision also moves boostPercent of the traffic to
+	// the highest precision. Defaults to relax-throttle.
+	// +optional
+	// +kubebuilder:validation:Enum=relax-throttle;boost-precision
+	Action string `json:"action,omitempty"`
+	// BoostPercent is the share of the traffic moved to the highest precision
+	// by boost-precision. Defaults to 50.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	BoostPercent *int32 `json:"boostPercent,omitempty"`
+}
+
+// LatencySLO is the share of requests to answer within a threshold.
+type LatencySLO struct {
+	// ThresholdMilliseconds is the latency a request must be answered within.
+	// It must be a bucket boundary of istio_request_duration_milliseconds,
+	// e.g. 100, 250 or 500 with the default buckets.
+	// +kubebuilder:validation:Minimum=1
+	ThresholdMilliseconds int32 `json:"thresholdMilliseconds"`
+	// Objective is the percentage of requests answered within the threshold,
+	// e.g. "99".
+	// +kubebuilder:validation:Pattern=`^(100(\.0+)?|[0-9]{1,2}(\.[0-9]+)?)$`
+	Objective string `json:"objective"`
+}
+
+// AvailabilitySLO is the share of requests to answer without a server error.
+type AvailabilitySLO struct {
+	// Objective is the percentage of requests answered without a 5xx status,
+	// e.g. "99.9".
+	// +kubebuilder:validation:Pattern=`^(100(\.0+)?|[0-9]{1,2}(\.[0-9]+)?)$`
+	Objective string `json:"objective"`
+}
+
+// SLOGuardStatus reports the last evaluation of the SLO guard of a Service
+// and its interventions.
+type SLOGuardStatus struct {
+	// Intervening is true while the guard overrides carbon throttling.
+	Intervening bool `json:"intervening"`
+	// Action is the action of the current or last intervention.
+	// +optional
+	Action string `json:"action,omitempty"`
+	// LatencyBurnRate and AvailabilityBurnRate are the burn rates last
+	// measured, as decimals. They are empty without traffic in the window.
+	// +optional
+	LatencyBurnRate string `json:"latencyBurnRate,omitempty"`
+	// +optional
+	AvailabilityBurnRate string `json:"availabilityBurnRate,omitempty"`
+	// Reason tells which objective breached the threshold last.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// InterveningSince is when the current or last intervention started, and
+	// HoldUntil when it ends at the earliest.
+	// +optional
+	InterveningSince *metav1.Time `json:"interveningSince,omitempty"`
+	// +optional
+	HoldUntil *metav1.Time `json:"holdUntil,omitempty"`
+	// Interventions counts the interventions so far.
+	// +optional
+	Interventions int64 `json:"interventions,omitempty"`
+	// LastEvaluated is when the burn rates were last measured.
+	LastEvaluated metav1.Time `json:"lastEvaluated"`
+}
+
+// IngressConfig binds the routes of a Service to Istio gateways, so the
+// traffic entering through them is carbon-routed too.
+type IngressConfig struct {
+	// Gateways are the Istio gateways ("namespace/name") the routes are bound
+	// to in addition to the mesh.
+	// +kubebuilder:validation:MinItems=1
+	Gateways []string `json:"gateways"`
+	// Hosts are the external hostnames served through Gateways.
+	// +optional
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+// CarbonRoutedServiceStatus defines the observed state of CarbonRoutedService.
+type CarbonRoutedServiceStatus struct {
+	// ObservedGeneration is the spec generation last applied by the operator.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Schedule is the TrafficSchedule bound to the Service, as "namespace/name".
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+	// ScheduleScope is the scope through which Schedule won the Service:
+	// Service, Namespace or Cluster.
+	// +optional
+	ScheduleScope string `json:"scheduleScope,omitempty"`
+	// Overrides lists the sections of this CarbonRoutedService merged over the
+	// bound schedule (router, consumer, target, routingRules, resilience,
+	// ingress), override while spec.override is in force, and sloGuard while
+	// the SLO guard intervenes.
+	// +optional
+	Overrides []string `json:"overrides,omitempty"`
+	// ActiveWeights are the weights routed to the precisions backed by a deployment.
+	// +optional
+	ActiveWeights []FlavourDecision `json:"activeWeights,omitempty"`
+	// ReplicaCeilings are the replica ceilings applied to the ScaledObjects, keyed
+	// by component name.
+	// +optional
+	ReplicaCeilings map[string]int32 `json:"replicaCeilings,omitempty"`
+	// QueueDepths holds the ready messages of each buffered queue, keyed by
+	// precision subset (e.g. "precision-100").
+	// +optional
+	QueueDepths map[string]int64 `json:"queueDepths,omitempty"`
+	// DeadLetteredRequests counts the requests waiting in the dead-letter queue
+	// of the Service, with spec.broker.topology.deadLetter.
+	// +optional
+	DeadLetteredRequests int64 `json:"deadLetteredRequests,omitempty"`
+	// BurstReserve reports the burst reserve, when spec.burstReserve is set.
+	// +optional
+	BurstReserve *BurstReserveStatus `json:"burstReserve,omitempty"`
+	// SLOGuard reports the SLO guard, when spec.sloGuard is set.
+	// +optional
+	SLOGuard *SLOGuardStatus `json:"sloGuard,omitempty"`
+	// LastUpdated is when the operator last refreshed this status.
+	// +optional
+	LastUpdated metav1.Time `json:"lastUpdated,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Namespaced,shortName=crs
+// +kubebuilder:printcolumn:name="Service",type=string,JSONPath=`.spec.serviceName`
+// +kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.status.schedule`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// CarbonRoutedService opts a Service in to carbon-aware routing and carries its
+// per-service configuration and status.
+type CarbonRoutedService struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CarbonRoutedServiceSpec   `json:"spec,omitempty"`
+	Status CarbonRoutedServiceStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CarbonRoutedServiceList contains a list of CarbonRoutedService.
+type CarbonRoutedServiceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CarbonRoutedService `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CarbonRoutedService{}, &CarbonRoutedServiceList{})
+}
@@ -17,7 +17,9 @@ package v1alpha1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -32,6 +34,22 @@ type AutoscalingConfig struct {
 	CooldownPeriod *int32 `json:"cooldownPeriod,omitempty"`
 	// +optional
 	CPUUtilization *int32 `json:"cpuUtilization,omitempty"`
+	// PollingInterval is how often, in seconds, KEDA checks the triggers.
+	// Defaults to 5.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	PollingInterval *int32 `json:"pollingInterval,omitempty"`
+	// QueueLengthTarget is the number of ready messages per queue at which the
+	// consumers or targets scale out. Defaults to spec.buffer.queueLengthTarget
+	// of the CarbonRoutedService, or 300.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	QueueLengthTarget *int32 `json:"queueLengthTarget,omitempty"`
+	// RequestRateThreshold is the number of requests per minute each consumer
+	// replica handles before scaling out. Defaults to 500.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	RequestRateThreshold *int32 `json:"requestRateThreshold,omitempty"`
 }
 
 // ComponentConfig defines the configuration for a specific component like router or consumer.
@@ -42,6 +60,74 @@ type ComponentConfig struct {
 	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
 	// +optional
 	Debug bool `json:"debug,omitempty"`
+	// MinAvailable keeps this many pods of the component, or this percentage
+	// (e.g. "50%"), running through voluntary disruptions such as node drains
+	// with a PodDisruptionBudget. Unset creates none.
+	// +optional
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+	// +optional
+	Image ImageConfig `json:"image,omitempty"`
+	// NodeSelector, Tolerations, Affinity and TopologySpreadConstraints place
+	// the pods of the component, e.g. on a low-carbon or on-demand node pool.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// +optional
+	// +listType=atomic
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+	// Constraints without a labelSelector spread the pods of the component.
+	// +optional
+	// +listType=atomic
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	// ExtraEnv is added to the environment of the buffer service, e.g. to tune
+	// prefetch, timeouts or the tracing endpoint. Variables named like the
+	// generated ones replace them.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	ExtraEnv []corev1.EnvVar `json:"extraEnv,omitempty"`
+	// EnvFrom loads variables from ConfigMaps and Secrets of the Service
+	// namespace. Variables set explicitly, generated or extra, take precedence.
+	// +optional
+	// +listType=atomic
+	EnvFrom []corev1.EnvFromSource `json:"envFrom,omitempty"`
+	// PodSecurityContext and SecurityContext harden the pods and the buffer
+	// service container, e.g. to satisfy the restricted Pod Security Standard.
+	// +optional
+	PodSecurityContext *corev1.PodSecurityContext `json:"podSecurityContext,omitempty"`
+	// +optional
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+	// +optional
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+	// AutomountServiceAccountToken defaults to true. The buffer service reads
+	// the TrafficSchedule with the token, so false only suits pods given one
+	// by other means.
+	// +optional
+	AutomountServiceAccountToken *bool `json:"automountServiceAccountToken,omitempty"`
+}
+
+// ImageConfig selects the buffer service image of a component, e.g. from a
+// mirror in air-gapped clusters or pinned to a digest.
+type ImageConfig struct {
+	// Repository defaults to ghcr.io/belgio99/k8s-carbonrouter/buffer-service-<component>.
+	// +optional
+	Repository string `json:"repository,omitempty"`
+	// Tag defaults to "latest". Ignored when Digest is set.
+	// +optional
+	Tag string `json:"tag,omitempty"`
+	// Digest pins the image, e.g. "sha256:0123...".
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]+:[a-f0-9]{32,}$`
+	Digest string `json:"digest,omitempty"`
+	// PullPolicy defaults to Always for the latest tag and IfNotPresent
+	// otherwise.
+	// +optional
+	// +kubebuilder:validation:Enum=Always;IfNotPresent;Never
+	PullPolicy corev1.PullPolicy `json:"pullPolicy,omitempty"`
+	// PullSecrets are Secrets of the Service namespace used to pull the image.
+	// +optional
+	PullSecrets []corev1.LocalObjectReference `json:"pullSecrets,omitempty"`
 }
 
 // SchedulerConfigSpec defines runtime tuning knobs for the credit scheduler.
@@ -66,6 +152,30 @@ type SchedulerConfigSpec struct {
 	CarbonTimeout *int32 `json:"carbonTimeout,omitempty"`
 	// +optional
 	CarbonCacheTTL *int32 `json:"carbonCacheTTL,omitempty"`
+	// CarbonProvider has the operator fetch the forecast of carbonTarget, for
+	// the status and the embedded engine, instead of leaving it to the decision
+	// engine: "carbonintensity" reads the half-hour slots of carbonTarget
+	// ("national" when unset, "region:<id>" or "postcode:<outcode>") from the
+	// Carbon Intensity API of the GB grid, "electricitymaps" the zone of
+	// carbonTarget (e.g. "DE") from the Electricity Maps API, "watttime" the
+	// marginal emissions of the region of carbonTarget (e.g. "CAISO_NORTH")
+	// from the WattTime API. The forecast is fetched again every
+	// carbonCacheTTL seconds, 5 minutes by default.
+	// +optional
+	// +kubebuilder:validation:Enum=carbonintensity;electricitymaps;watttime
+	CarbonProvider string `json:"carbonProvider,omitempty"`
+	// CarbonProviderSecretRef names a Secret in the namespace of the schedule
+	// holding the credentials of carbonProvider: the API token under "token"
+	// for Electricity Maps, the account under "username" and "password" for
+	// WattTime.
+	// +optional
+	CarbonProviderSecretRef *corev1.LocalObjectReference `json:"carbonProviderSecretRef,omitempty"`
+	// CarbonProviderRef names the CarbonIntensityProvider whose forecast the
+	// schedule follows, taking precedence over carbonProvider and carbonTarget.
+	// The carbon targets of spec.locality then name CarbonIntensityProviders
+	// too.
+	// +optional
+	CarbonProviderRef string `json:"carbonProviderRef,omitempty"`
 	// +optional
 	ThrottleMin *string `json:"throttleMin,omitempty"`
 	// +optional
@@ -74,12 +184,1121 @@ type SchedulerConfigSpec struct {
 	ThrottleIntensityCeiling *string `json:"throttleIntensityCeiling,omitempty"`
 	// +optional
 	Evaluator *string `json:"evaluator,omitempty"`
+	// FallbackGraceSeconds is how long after its expiry the last known good
+	// schedule keeps being applied while the decision engine is unreachable.
+	// Past it, traffic falls back to full precision without ceilings. Unset
+	// applies the last known good schedule until the engine comes back.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	FallbackGraceSeconds *int32 `json:"fallbackGraceSeconds,omitempty"`
+	// Auth authenticates the HTTP calls to the decision engine.
+	// +optional
+	Auth *EngineAuthConfig `json:"auth,omitempty"`
+}
+
+// EngineAuthConfig holds the credential sent to the decision engine.
+type EngineAuthConfig struct {
+	// SecretRef names a Secret in the namespace of the schedule. Its "token" key
+	// is sent as a bearer token; otherwise its "apiKey" key is sent in the
+	// X-API-Key header.
+	SecretRef corev1.LocalObjectReference `json:"secretRef"`
 }
 
 // TargetConfig defines the configuration for the target deployments.
 type TargetConfig struct {
 	// +optional
 	Autoscaling AutoscalingConfig `json:"autoscaling,omitempty"`
+	// ScaleToZero lets the Deployment of a precision the schedule gives no
+	// weight scale to zero once its queues stay empty for the cooldown period.
+	// A message on either queue of the precision, or weight coming back,
+	// scales it up again.
+	// +optional
+	ScaleToZero bool `json:"scaleToZero,omitempty"`
+	// PerFlavour overrides Autoscaling for the Deployments of single
+	// precisions, e.g. to let low precision flavours scale further out than
+	// the full precision one. Fields left unset are inherited from Autoscaling.
+	// +optional
+	// +listType=map
+	// +listMapKey=precision
+	PerFlavour []FlavourAutoscaling `json:"perFlavour,omitempty"`
+}
+
+// FlavourAutoscaling overrides the target autoscaling settings of one precision.
+type FlavourAutoscaling struct {
+	Precision int `json:"precision"`
+	// +optional
+	Autoscaling AutoscalingConfig `json:"autoscaling,omitempty"`
+}
+
+// ScaleCoordinationConfig smooths cluster-level scaling when many services share a schedule.
+type ScaleCoordinationConfig struct {
+	// RelaxationSpreadSeconds staggers replica ceiling increases across services over
+	// this window, each service waiting a stable per-service offset. Ceiling decreases
+	// are always applied immediately. Zero disables staggering.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	RelaxationSpreadSeconds *int32 `json:"relaxationSpreadSeconds,omitempty"`
+}
+
+// ForecastScalingConfig pre-scales the consumers and the highest precision
+// Deployment ahead of the green windows of the carbon forecast, with KEDA cron
+// triggers that start LeadMinutes before a window opens and end LeadMinutes
+// before it closes. Green windows usually shift the weights to the highest
+// precision, so the lower precisions are left to their queue triggers.
+type ForecastScalingConfig struct {
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+	// LeadMinutes is how long before a window the replicas are raised and
+	// lowered again. Defaults to 10.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	LeadMinutes *int32 `json:"leadMinutes,omitempty"`
+	// MaxForecast marks the slots forecast at or below it (gCO2/kWh, e.g. "120")
+	// as green. Without it, the slots indexed "very low" or "low" are green.
+	// +optional
+	MaxForecast *string `json:"maxForecast,omitempty"`
+	// ConsumerReplicas is held by the consumers during a green window. Unset
+	// leaves the consumers to their other triggers.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	ConsumerReplicas *int32 `json:"consumerReplicas,omitempty"`
+	// TargetReplicas is held by the highest precision Deployment during a green
+	// window. Unset leaves it to its other triggers.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	TargetReplicas *int32 `json:"targetReplicas,omitempty"`
+}
+
+// RightsizingConfig reads the recommendations of the Vertical Pod Autoscalers
+// targeting the flavour Deployments and the router and consumer. The
+// VerticalPodAutoscalers are created by the user, typically with updateMode
+// "Off", so only the operator acts on their recommendations.
+type RightsizingConfig struct {
+	// Enabled sends the recommended requests of each flavour, or its declared
+	// ones when no VerticalPodAutoscaler targets it, to the decision engine.
+	// Flavours without the carbonstat.emissions label get a carbon cost
+	// relative to their CPU.
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+	// ApplyToComponents sets the requests of the router and consumer
+	// Deployments to their recommendations when spec.router.resources or
+	// spec.consumer.resources leave them unset. Requests within 15% of the
+	// recommendation are kept, so small drifts do not roll the pods.
+	// +optional
+	ApplyToComponents bool `json:"applyToComponents,omitempty"`
+}
+
+// EnergyCalibrationConfig measures the energy each flavour Deployment draws
+// with Kepler, whose metrics the operator reads from Prometheus, instead of
+// relying on the carbonstat.emissions label of the flavours.
+type EnergyCalibrationConfig struct {
+	// Enabled sends the measured carbon cost per request of each flavour to
+	// the decision engine: the joules its pods drew per request they served
+	// over the window, relative to the costliest flavour like the labels.
+	// The labels stay until every flavour has enough traffic to be measured.
+	// Needs the operator to run with --kepler-prometheus-url.
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+	// WindowMinutes is the window the energy and requests are averaged over.
+	// Defaults to 10.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	WindowMinutes *int32 `json:"windowMinutes,omitempty"`
+}
+
+// ConcurrencyConfig resizes the worker pool the consumers run for each
+// precision queue with the processing throttle, so processing slows down even
+// when every component already runs at its minimum replicas. Higher precisions
+// cost more per request and are slowed down harder: a precision of p percent
+// gets throttle^(p/100) of its workers.
+type ConcurrencyConfig struct {
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+	// WorkersPerQueue is the worker pool of each precision queue when processing
+	// is not throttled. Defaults to the consumer default of 32.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	WorkersPerQueue *int32 `json:"workersPerQueue,omitempty"`
+	// MinFactor is the lowest share of its workers any precision is left with
+	// (e.g. "0.1"). Defaults to "0.05".
+	// +optional
+	MinFactor *string `json:"minFactor,omitempty"`
+}
+
+// PowerCapConfig enables node-level CPU power capping during extreme carbon windows.
+// It only takes effect when the operator runs with --enable-power-cap.
+type PowerCapConfig struct {
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+	// IntensityThreshold is the forecast (gCO2/kWh) at or above which the current slot
+	// counts as an extreme carbon window.
+	// +optional
+	IntensityThreshold *string `json:"intensityThreshold,omitempty"`
+	// MinCapPercent is the lowest CPU power cap, as a percentage of the node maximum.
+	// The applied cap follows the processing throttle but never goes below this value.
+	// +optional
+	// +kubebuilder:validation:Minimum=10
+	// +kubebuilder:validation:Maximum=100
+	MinCapPercent *int32 `json:"minCapPercent,omitempty"`
+	// DominanceRatio is the share of running pods on a node that must belong to
+	// carbonrouter-managed workloads for the node to be capped (e.g. "0.5").
+	// +optional
+	DominanceRatio *string `json:"dominanceRatio,omitempty"`
+}
+
+// AutoscalerHintsConfig steers the scale-ups of the cluster-autoscaler towards
+// the greener node groups while the schedule throttles processing, through the
+// priorities of its priority expander. It only takes effect when the operator
+// runs with --autoscaler-hints.
+type AutoscalerHintsConfig struct {
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+	// NodeGroups are ranked by carbon intensity, the greenest with the highest
+	// priority, while processing is throttled.
+	// +optional
+	NodeGroups []NodeGroupHint `json:"nodeGroups,omitempty"`
+}
+
+// NodeGroupHint ties cluster-autoscaler node groups to the carbon intensity of
+// the grid they draw from.
+type NodeGroupHint struct {
+	// Pattern is a regular expression matching the names of the node groups,
+	// as in the priority expander configuration.
+	// +kubebuilder:validation:MinLength=1
+	Pattern string `json:"pattern"`
+	// Zone is the spec.locality zone ("region/zone") whose current forecast
+	// ranks the node groups.
+	// +optional
+	Zone string `json:"zone,omitempty"`
+	// Intensity is a fixed carbon intensity of the node groups in gCO2/kWh,
+	// e.g. of a pool on a renewable supply contract, used instead of a zone
+	// forecast.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[0-9]+(\.[0-9]+)?$`
+	Intensity *string `json:"intensity,omitempty"`
+}
+
+// PropagationConfig propagates the schedule to the member clusters of a fleet
+// managed by Karmada or Cluster API, each running the operator, so that one
+// TrafficSchedule drives all of them. The members get the schedule without
+// spec.propagation.
+type PropagationConfig struct {
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+	// Provider manages the fleet: "karmada" propagates the schedule with a
+	// PropagationPolicy and an OverridePolicy, "cluster-api" with a
+	// ClusterResourceSet per member. Defaults to karmada.
+	// +optional
+	// +kubebuilder:validation:Enum=karmada;cluster-api
+	Provider string `json:"provider,omitempty"`
+	// Clusters are the member clusters receiving the schedule.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Clusters []MemberCluster `json:"clusters,omitempty"`
+}
+
+// MemberCluster is a member cluster of the fleet and its overrides.
+type MemberCluster struct {
+	// Name of the Karmada Cluster, or of the Cluster API Cluster, labelled
+	// cluster.x-k8s.io/cluster-name with it, in the namespace of the schedule.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// CarbonTarget overrides spec.scheduler.carbonTarget on the member, so its
+	// weights follow the forecast of the grid of its region.
+	// +optional
+	CarbonTarget string `json:"carbonTarget,omitempty"`
+}
+
+// LocalityZone maps an Istio locality to the carbon intensity source of its grid.
+type LocalityZone struct {
+	// Name is the Istio locality of the zone, as "region/zone".
+	Name string `json:"name"`
+	// CarbonTarget selects the forecast for this zone, in the same format as
+	// spec.scheduler.carbonTarget (e.g. "region:13").
+	CarbonTarget string `json:"carbonTarget"`
+}
+
+// LocalityFailover is an Istio region failover pair.
+type LocalityFailover struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// LocalityConfig steers traffic towards endpoints in the greener zones of a
+// multi-zone cluster through the DestinationRule locality load balancer.
+type LocalityConfig struct {
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+	// Zones lists the localities taking part in the distribution.
+	// +optional
+	Zones []LocalityZone `json:"zones,omitempty"`
+	// MinLocalPercent is the share of traffic always kept in the caller's own zone,
+	// bounding the extra latency of cross-zone hops. Defaults to 50.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	MinLocalPercent *int32 `json:"minLocalPercent,omitempty"`
+	// Failover is applied instead of the carbon-aware distribution while zone
+	// forecasts are unavailable (Istio does not allow both at the same time).
+	// +optional
+	Failover []LocalityFailover `json:"failover,omitempty"`
+	// NodeZones distributes the traffic of each Service over the localities
+	// of the nodes its pods currently run on, from their
+	// topology.kubernetes.io/region and zone labels, instead of over every
+	// zone listed. Zones may then be named by the zone alone (e.g.
+	// "eu-west-1a"), and apply to that zone in every region.
+	// +optional
+	NodeZones bool `json:"nodeZones,omitempty"`
+}
+
+// ServiceSelector picks the opted-in Services a TrafficSchedule applies to.
+type ServiceSelector struct {
+	// Selector matches Service labels. Unset matches every opted-in Service.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// Namespaces restricts the schedule to Services in these namespaces. Empty
+	// means every namespace.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// ConnectionRebalancingConfig periodically recycles long-lived connections
+// (gRPC streams, WebSockets) so weight changes shift load within a schedule slot
+// instead of only reaching new connections.
+type ConnectionRebalancingConfig struct {
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+	// MaxConnectionDurationSeconds is the connection age at which Envoy starts
+	// draining it: GOAWAY for HTTP/2, Connection: close for HTTP/1.1. Defaults to 300.
+	// +optional
+	// +kubebuilder:validation:Minimum=10
+	MaxConnectionDurationSeconds *int32 `json:"maxConnectionDurationSeconds,omitempty"`
+	// DrainGraceSeconds is how long in-flight streams may continue after the
+	// drain hint before they are closed and clients reconnect. Defaults to 30.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	DrainGraceSeconds *int32 `json:"drainGraceSeconds,omitempty"`
+}
+
+// ClientHeaderMatch identifies clients by a request header, such as an API key.
+type ClientHeaderMatch struct {
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// +kubebuilder:validation:MinItems=1
+	Values []string `json:"values"`
+}
+
+// ClientClaimMatch identifies clients by a claim of their JWT, such as their
+// subscription tier. The token must be validated by a RequestAuthentication.
+type ClientClaimMatch struct {
+	// Name of the claim. Nested claims are separated by dots, e.g.
+	// "subscription.tier".
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// +kubebuilder:validation:MinItems=1
+	Values []string `json:"values"`
+}
+
+// ClientMatch identifies the clients of a ClientPrecisionRule. Clients match
+// when any of the fields does.
+type ClientMatch struct {
+	// Principals are mesh identities, as "<trustDomain>/ns/<namespace>/sa/<serviceAccount>".
+	// Their requests to pods of other precisions are denied.
+	// +optional
+	Principals []string `json:"principals,omitempty"`
+	// SourceNamespace and SourceLabels select the client workloads, so their
+	// sidecars only route them to the allowed precisions. Set them alongside
+	// Principals, which the VirtualService cannot match.
+	// +optional
+	SourceNamespace string `json:"sourceNamespace,omitempty"`
+	// +optional
+	SourceLabels map[string]string `json:"sourceLabels,omitempty"`
+	// +optional
+	Header *ClientHeaderMatch `json:"header,omitempty"`
+	// Claim matches a claim of the request JWT. Istio only routes on claims at
+	// its gateways, so the requests of mesh clients to other precisions are
+	// only rejected by the AuthorizationPolicies.
+	// +optional
+	Claim *ClientClaimMatch `json:"claim,omitempty"`
+}
+
+// ClientPrecisionRule restricts the precisions served to a set of clients.
+type ClientPrecisionRule struct {
+	// +kubebuilder:validation:MinLength=1
+	Name    string      `json:"name"`
+	Clients ClientMatch `json:"clients"`
+	// Precisions the clients may receive. The schedule weights are split across
+	// them only; requests forcing another precision are served by an allowed one.
+	// +kubebuilder:validation:MinItems=1
+	Precisions []int `json:"precisions"`
+}
+
+// HTTPMethod is the method of an HTTP request.
+// +kubebuilder:validation:Enum=GET;HEAD;POST;PUT;PATCH;DELETE;OPTIONS
+type HTTPMethod string
+
+// PathMatch matches the path of a request.
+type PathMatch struct {
+	// Type is Prefix (default), Exact or Regex, an RE2 expression matched
+	// against the whole path.
+	// +optional
+	// +kubebuilder:validation:Enum=Prefix;Exact;Regex
+	Type string `json:"type,omitempty"`
+	// +kubebuilder:validation:MinLength=1
+	Value string `json:"value"`
+}
+
+// GRPCMethodMatch matches the calls of a gRPC service, or of one of its
+// methods.
+type GRPCMethodMatch struct {
+	// Service is the fully qualified service name, e.g. "shop.v1.Catalog".
+	// +kubebuilder:validation:MinLength=1
+	Service string `json:"service"`
+	// Method restricts the match to one method of Service, e.g. "Search".
+	// +optional
+	Method string `json:"method,omitempty"`
+}
+
+// RoutingRule restricts the precisions served to the requests of selected
+// endpoints, so e.g. search may be degraded while checkout stays at full
+// precision. A rule matches the requests matching all of its Path or GRPC,
+// Methods and Authority; rules setting none of them are ignored.
+type RoutingRule struct {
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// +optional
+	Path *PathMatch `json:"path,omitempty"`
+	// GRPC matches gRPC calls by service and method, in place of Path. The
+	// routing header is set on the calls, so servers read the precision
+	// serving them from the call metadata.
+	// +optional
+	GRPC *GRPCMethodMatch `json:"grpc,omitempty"`
+	// Authority matches the :authority (Host) of the requests exactly. Istio
+	// routing backend only: the other backends skip rules setting it.
+	// +optional
+	Authority string `json:"authority,omitempty"`
+	// Methods match the HTTP method, e.g. POST, PUT and DELETE to keep mutating
+	// requests at full precision while GET and HEAD follow the schedule.
+	// +optional
+	Methods []HTTPMethod `json:"methods,omitempty"`
+	// Precisions the requests may receive. The schedule weights are split across
+	// them only; requests forcing another precision are served by an allowed one.
+	// +kubebuilder:validation:MinItems=1
+	Precisions []int `json:"precisions"`
+}
+
+// RoutingConfig extends the generated VirtualService beyond plain HTTP/1.1 and
+// HTTP/2 mesh traffic.
+type RoutingConfig struct {
+	// Mode is "http" (default) to split the HTTP traffic of the Services, or
+	// "none" for queue-only workers: no routes are rendered, while buffering,
+	// per-precision scaling and replica ceilings still apply. The
+	// carbonrouter.io/routing-mode Service annotation overrides it.
+	// +optional
+	// +kubebuilder:validation:Enum=http;none
+	Mode string `json:"mode,omitempty"`
+	// WebSocket adds a route for WebSocket upgrade requests. Each connection is
+	// pinned to the precision picked by the schedule weights when it is
+	// established, and the backend learns it through the x-carbonrouter header.
+	// +optional
+	WebSocket bool `json:"webSocket,omitempty"`
+	// Gateways binds the VirtualService to these Istio gateways ("namespace/name")
+	// in addition to the mesh.
+	// +optional
+	Gateways []string `json:"gateways,omitempty"`
+	// Hosts are the external hostnames served through Gateways.
+	// +optional
+	Hosts []string `json:"hosts,omitempty"`
+	// HTTP3 advertises HTTP/3 through the Alt-Svc response header. The gateways
+	// must expose a QUIC listener; ignored when no gateway is set.
+	// +optional
+	HTTP3 bool `json:"http3,omitempty"`
+	// HTTP3Port is the UDP port advertised for HTTP/3. Defaults to 443.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	HTTP3Port *int32 `json:"http3Port,omitempty"`
+	// ServedHeader names a response header set to the precision that served
+	// the request, e.g. "x-carbonrouter-served", so clients and dashboards can
+	// correlate the observed quality with it. Empty disables it.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9-]+$`
+	ServedHeader string `json:"servedHeader,omitempty"`
+	// +optional
+	ConnectionRebalancing ConnectionRebalancingConfig `json:"connectionRebalancing,omitempty"`
+	// ClientRules restrict the precisions each client identity may receive,
+	// for per-customer quality guarantees. Rules are evaluated in order.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	ClientRules []ClientPrecisionRule `json:"clientRules,omitempty"`
+	// RoutingRules restrict the precisions served to the requests of selected
+	// paths and methods. Rules are evaluated in order, after the client rules.
+	// The routingRules of a CarbonRoutedService replace them for its Service.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	RoutingRules []RoutingRule `json:"routingRules,omitempty"`
+	// +optional
+	MeshSecurity MeshSecurityConfig `json:"meshSecurity,omitempty"`
+	// +optional
+	Sidecar SidecarConfig `json:"sidecar,omitempty"`
+	// +optional
+	SessionAffinity SessionAffinityConfig `json:"sessionAffinity,omitempty"`
+	// +optional
+	Mirror *MirrorConfig `json:"mirror,omitempty"`
+	// +optional
+	Resilience *ResilienceConfig `json:"resilience,omitempty"`
+	// +optional
+	TrafficPolicy *TrafficPolicyConfig `json:"trafficPolicy,omitempty"`
+	// +optional
+	FaultInjection *FaultInjectionConfig `json:"faultInjection,omitempty"`
+	// +optional
+	RateLimit *RateLimitConfig `json:"rateLimit,omitempty"`
+	// +optional
+	Brownout *BrownoutConfig `json:"brownout,omitempty"`
+}
+
+// BrownoutConfig serves part of the GET traffic from a static responder while
+// the carbon intensity is extreme, sparing the real backend. The operator
+// deploys the responder next to the Service as soon as it is configured.
+// Istio routing backend only.
+type BrownoutConfig struct {
+	// IntensityThreshold is the current forecast, in gCO2/kWh, above which the
+	// brownout route is rendered.
+	// +kubebuilder:validation:Pattern=`^[0-9]+(\.[0-9]+)?$`
+	IntensityThreshold string `json:"intensityThreshold"`
+	// Percentage of the eligible requests served by the responder, from "0"
+	// to "100", once the schedule stops processing or when it sets no
+	// processing throttle. It shrinks as the throttle recovers.
+	// +kubebuilder:validation:Pattern=`^(100(\.0+)?|[0-9]{1,2}(\.[0-9]+)?)$`
+	Percentage string `json:"percentage"`
+	// Paths restrict the eligible GET requests; all of them are eligible when
+	// empty.
+	// +optional
+	Paths []PathMatch `json:"paths,omitempty"`
+	// Image replaces the default static responder, e.g. with a cache in front
+	// of the Service. It must serve HTTP on port 8080.
+	// +optional
+	Image string `json:"image,omitempty"`
+	// Body is returned by the default responder for every request.
+	// +optional
+	Body string `json:"body,omitempty"`
+	// ContentType of the body. Defaults to text/html.
+	// +optional
+	ContentType string `json:"contentType,omitempty"`
+	// Replicas of the responder. Defaults to 1.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Replicas *int32 `json:"replicas,omitempty"`
+}
+
+// RateLimitConfig sheds excess load while the carbon intensity is high: every
+// pod of the routed Service gets a local rate limit scaled by the processing
+// throttle of the schedule, and requests above it are answered with 429.
+// Istio routing backend only.
+type RateLimitConfig struct {
+	// RequestsPerSecond is the rate each pod accepts at a throttle of 1; the
+	// limit is this rate times the throttle.
+	// +kubebuilder:validation:Minimum=1
+	RequestsPerSecond int32 `json:"requestsPerSecond"`
+	// ThrottleBelow installs the limit only while the throttle is below it
+	// (e.g. "0.5"). Defaults to "1", i.e. whenever processing is throttled.
+	// +optional
+	ThrottleBelow *string `json:"throttleBelow,omitempty"`
+}
+
+// FaultDelay delays a share of the requests.
+type FaultDelay struct {
+	// Percentage of the requests delayed, from "0" to "100".
+	// +kubebuilder:validation:Pattern=`^(100(\.0+)?|[0-9]{1,2}(\.[0-9]+)?)$`
+	Percentage string `json:"percentage"`
+	// +kubebuilder:validation:Minimum=1
+	FixedDelayMilliseconds int32 `json:"fixedDelayMilliseconds"`
+}
+
+// FaultAbort fails a share of the requests with an HTTP status.
+type FaultAbort struct {
+	// Percentage of the requests aborted, from "0" to "100".
+	// +kubebuilder:validation:Pattern=`^(100(\.0+)?|[0-9]{1,2}(\.[0-9]+)?)$`
+	Percentage string `json:"percentage"`
+	// +kubebuilder:validation:Minimum=200
+	// +kubebuilder:validation:Maximum=599
+	HTTPStatus int32 `json:"httpStatus"`
+}
+
+// PrecisionFault is the fault injected into the requests of one precision.
+type PrecisionFault struct {
+	Precision int `json:"precision"`
+	// +optional
+	Delay *FaultDelay `json:"delay,omitempty"`
+	// +optional
+	Abort *FaultAbort `json:"abort,omitempty"`
+}
+
+// FaultInjectionConfig makes precisions slow or failing, to rehearse how
+// clients cope with degraded flavours. Faults apply to the routes sending all
+// their requests to the precision: forced precisions, sessions, and client or
+// routing rules allowing a single precision. Istio routing backend only.
+type FaultInjectionConfig struct {
+	// +listType=map
+	// +listMapKey=precision
+	PerPrecision []PrecisionFault `json:"perPrecision"`
+}
+
+// ConnectionPoolConfig caps the connections and requests to the pods of a
+// subset, from every client sidecar.
+type ConnectionPoolConfig struct {
+	// MaxConnections is the number of TCP connections to a pod.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxConnections *int32 `json:"maxConnections,omitempty"`
+	// MaxPendingRequests is the number of requests waiting for a connection.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxPendingRequests *int32 `json:"maxPendingRequests,omitempty"`
+	// MaxRequestsPerConnection closes connections after that many requests.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxRequestsPerConnection *int32 `json:"maxRequestsPerConnection,omitempty"`
+}
+
+// OutlierDetectionConfig ejects misbehaving pods of a subset from the load
+// balancing pool, instead of letting them degrade the whole subset.
+type OutlierDetectionConfig struct {
+	// Consecutive5xxErrors ejects a pod after that many 5xx responses in a row.
+	// Defaults to 5.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Consecutive5xxErrors *int32 `json:"consecutive5xxErrors,omitempty"`
+	// IntervalSeconds is how often pods are checked. Defaults to 10.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	IntervalSeconds *int32 `json:"intervalSeconds,omitempty"`
+	// BaseEjectionTimeSeconds is how long a pod stays ejected, growing with
+	// each ejection. Defaults to 30.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	BaseEjectionTimeSeconds *int32 `json:"baseEjectionTimeSeconds,omitempty"`
+	// MaxEjectionPercent caps the share of the pods ejected. Defaults to 10.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	MaxEjectionPercent *int32 `json:"maxEjectionPercent,omitempty"`
+}
+
+// SubsetTrafficPolicy is the traffic policy of precision subsets.
+type SubsetTrafficPolicy struct {
+	// +optional
+	ConnectionPool *ConnectionPoolConfig `json:"connectionPool,omitempty"`
+	// +optional
+	OutlierDetection *OutlierDetectionConfig `json:"outlierDetection,omitempty"`
+	// LoadBalancer picks the pod of a subset serving a request. Locality load
+	// balancing, when enabled, still applies on top.
+	// +optional
+	// +kubebuilder:validation:Enum=ROUND_ROBIN;LEAST_REQUEST;RANDOM;PASSTHROUGH
+	LoadBalancer string `json:"loadBalancer,omitempty"`
+}
+
+// PrecisionTrafficPolicy overrides the traffic policy of one subset.
+type PrecisionTrafficPolicy struct {
+	Precision           int `json:"precision"`
+	SubsetTrafficPolicy `json:",inline"`
+}
+
+// TrafficPolicyConfig sets the DestinationRule traffic policy of the precision
+// subsets. Istio routing backend only.
+type TrafficPolicyConfig struct {
+	SubsetTrafficPolicy `json:",inline"`
+	// PerPrecision overrides the policy of single subsets, field by field.
+	// +optional
+	// +listType=map
+	// +listMapKey=precision
+	PerPrecision []PrecisionTrafficPolicy `json:"perPrecision,omitempty"`
+}
+
+// RetryConfig retries the failed requests of a route.
+type RetryConfig struct {
+	// Attempts is the number of retries of a request; 0 disables them.
+	// +kubebuilder:validation:Minimum=0
+	Attempts int32 `json:"attempts"`
+	// RetryOn lists the conditions to retry on, e.g.
+	// "5xx,connect-failure,reset". Defaults to the Istio ones.
+	// +optional
+	RetryOn string `json:"retryOn,omitempty"`
+	// PerTryTimeoutSeconds bounds each attempt. Defaults to the route timeout.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	PerTryTimeoutSeconds *int32 `json:"perTryTimeoutSeconds,omitempty"`
+}
+
+// RouteResilience is the timeout and retry policy of routes.
+type RouteResilience struct {
+	// TimeoutSeconds bounds a request, retries included. Defaults to none.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	TimeoutSeconds *int32 `json:"timeoutSeconds,omitempty"`
+	// +optional
+	Retries *RetryConfig `json:"retries,omitempty"`
+}
+
+// PrecisionResilience overrides the resilience policy of the routes serving
+// a single precision.
+type PrecisionResilience struct {
+	Precision       int `json:"precision"`
+	RouteResilience `json:",inline"`
+}
+
+// ResilienceConfig sets the timeouts and retries of the generated routes, so
+// e.g. buffered or low precision backends get more time than the default.
+// WebSocket upgrades keep the Istio defaults. Istio routing backend only.
+type ResilienceConfig struct {
+	RouteResilience `json:",inline"`
+	// PerPrecision overrides the policy, field by field, on the routes sending
+	// all their requests to one precision: forced precisions, sessions, and
+	// client or routing rules allowing a single precision. Weighted routes keep
+	// the policy above.
+	// +optional
+	// +listType=map
+	// +listMapKey=precision
+	PerPrecision []PrecisionResilience `json:"perPrecision,omitempty"`
+}
+
+// MirrorConfig shadows full-precision requests to a lower precision, whose
+// responses are discarded, to validate it before it gets real weight. Istio
+// routing backend only.
+type MirrorConfig struct {
+	// Precision receives the shadow traffic. It must be below the highest
+	// precision; nothing is mirrored while it has no Deployment.
+	// +kubebuilder:validation:Minimum=1
+	Precision int `json:"precision"`
+	// MirrorPercentage is the share of requests shadowed, from "0" to "100".
+	// +kubebuilder:validation:Pattern=`^(100(\.0+)?|[0-9]{1,2}(\.[0-9]+)?)$`
+	MirrorPercentage string `json:"mirrorPercentage"`
+}
+
+// SessionAffinityConfig keeps every request of a session on one precision for
+// as long as the schedule weights hold, instead of splitting it request by
+// request. Sessions are identified by a header or a cookie set by the
+// application, whose value must end in random hexadecimal digits, such as a
+// UUID. Istio routing backend only.
+type SessionAffinityConfig struct {
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+	// Header carrying the session ID, e.g. "x-session-id". Set Header or Cookie.
+	// +optional
+	Header string `json:"header,omitempty"`
+	// Cookie carrying the session ID, e.g. "session".
+	// +optional
+	Cookie string `json:"cookie,omitempty"`
+}
+
+// SidecarConfig sets how the Istio sidecar of the consumer pods is injected,
+// which routes the buffered requests over the precision subsets.
+type SidecarConfig struct {
+	// Revision is the istio.io/rev label of the consumer pods, a revision or
+	// revision tag of the control plane such as "canary" or "1-26-1".
+	// Defaults to the --istio-revision operator flag.
+	// +optional
+	Revision string `json:"revision,omitempty"`
+	// Inject is the sidecar.istio.io/inject annotation of the consumer pods.
+	// Defaults to true; false leaves them out of the mesh.
+	// +optional
+	Inject *bool `json:"inject,omitempty"`
+}
+
+// MeshSecurityConfig hardens the data path to the precision Deployments with a
+// STRICT mTLS PeerAuthentication on their pods and an AuthorizationPolicy
+// letting only the buffer service and AllowedPrincipals call them. Istio
+// routing backend only.
+type MeshSecurityConfig struct {
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+	// AllowedPrincipals are further callers of the precision Deployments, e.g.
+	// "cluster.local/ns/istio-system/sa/istio-ingressgateway-service-account".
+	// +optional
+	AllowedPrincipals []string `json:"allowedPrincipals,omitempty"`
+	// TrustDomain is the trust domain of the mesh. Defaults to "cluster.local".
+	// +optional
+	TrustDomain string `json:"trustDomain,omitempty"`
+}
+
+// AttributionConfig makes routers and consumers annotate every request with the
+// grid carbon intensity and the precision that served it, for chargeback.
+type AttributionConfig struct {
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+	// ClientHeader is the request header identifying the API consumer in the
+	// attribution reports. Defaults to "x-client-id".
+	// +optional
+	ClientHeader string `json:"clientHeader,omitempty"`
+	// Clients are the client ids reported by name; any other client is
+	// reported as "other". When empty, client ids are hashed into 64 buckets,
+	// so callers cannot grow the metrics and reports with ids of their own.
+	// +optional
+	// +kubebuilder:validation:MaxItems=256
+	Clients []string `json:"clients,omitempty"`
+}
+
+// IssuerReference points at the cert-manager issuer signing buffer service identities.
+type IssuerReference struct {
+	Name string `json:"name"`
+	// Kind is Issuer or ClusterIssuer. Defaults to ClusterIssuer.
+	// +optional
+	// +kubebuilder:validation:Enum=Issuer;ClusterIssuer
+	Kind string `json:"kind,omitempty"`
+	// Group defaults to cert-manager.io.
+	// +optional
+	Group string `json:"group,omitempty"`
+}
+
+// IdentityConfig gives the router and consumer of each routed Service a
+// SPIFFE-compatible X.509 identity issued through cert-manager, so the buffered
+// path to the target can be mutually authenticated without a mesh sidecar.
+type IdentityConfig struct {
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+	// +optional
+	IssuerRef IssuerReference `json:"issuerRef,omitempty"`
+	// TrustDomain of the SPIFFE IDs, spiffe://<trustDomain>/ns/<namespace>/sa/<serviceAccount>.
+	// Defaults to "cluster.local", matching Istio identities.
+	// +optional
+	TrustDomain string `json:"trustDomain,omitempty"`
+	// TargetPort is the TLS port of the target Service called by the consumer.
+	// Defaults to 443.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	TargetPort *int32 `json:"targetPort,omitempty"`
+	// ClientAuth makes the router entrypoint require a client certificate
+	// signed by the CA of the issuer, so that only workloads holding such an
+	// identity can call it. Without it the entrypoint only serves TLS.
+	// +optional
+	ClientAuth bool `json:"clientAuth,omitempty"`
+}
+
+// BrokerConfig locates the broker used by the buffer services.
+type BrokerConfig struct {
+	// Type is the buffer backend: "rabbitmq", the broker installed by the
+	// carbonrouter chart, "kafka", "natsJetstream", "sqs" or "redisStreams".
+	// "none" runs without a broker: the router forwards every request straight
+	// to the Service, where the schedule weights of the routing backend alone
+	// pick its precision, and no consumer is deployed. Defaults to rabbitmq.
+	// +optional
+	// +kubebuilder:validation:Enum=rabbitmq;kafka;natsJetstream;sqs;redisStreams;none
+	Type string `json:"type,omitempty"`
+	// SecretRef names a Secret, in the namespace of each routed Service, holding
+	// the broker credentials under the "username" and "password" keys.
+	// +optional
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+	// Host of the RabbitMQ broker. Defaults to the broker installed by the
+	// carbonrouter chart.
+	// +optional
+	Host string `json:"host,omitempty"`
+	// Port is the AMQP port. Defaults to 5672.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port *int32 `json:"port,omitempty"`
+	// VHost of the RabbitMQ broker. Defaults to "/".
+	// +optional
+	VHost string `json:"vhost,omitempty"`
+	// Cluster has the operator provision the RabbitMQ broker of the namespace
+	// instead of using the one installed by the carbonrouter chart. It cannot be
+	// combined with Host, Port or SecretRef.
+	// +optional
+	Cluster *RabbitMQClusterConfig `json:"cluster,omitempty"`
+	// +optional
+	Tenancy BrokerTenancyConfig `json:"tenancy,omitempty"`
+	// Kafka locates the cluster of the kafka backend. Required with it.
+	// +optional
+	Kafka *KafkaConfig `json:"kafka,omitempty"`
+	// NATS locates the servers of the natsJetstream backend. Required with it.
+	// +optional
+	NATS *NATSConfig `json:"nats,omitempty"`
+	// SQS locates the queues of the sqs backend. Required with it.
+	// +optional
+	SQS *SQSConfig `json:"sqs,omitempty"`
+	// Redis locates the server of the redisStreams backend. Required with it.
+	// +optional
+	Redis *RedisConfig `json:"redis,omitempty"`
+	// QueueNameTemplate names the queues of each precision of a Service, to
+	// follow existing naming conventions or keep environments sharing a broker
+	// apart. It must use each of {namespace}, {service}, {type} ("direct" or
+	// "queue") and {flavour} ("precision-<n>"), and no name it can produce may
+	// exceed the 255 bytes allowed by the broker.
+	// Defaults to "{namespace}.{service}.{type}.{flavour}".
+	// +optional
+	// +kubebuilder:validation:MaxLength=255
+	QueueNameTemplate string `json:"queueNameTemplate,omitempty"`
+	// ExchangeNameTemplate names the exchange of a Service. It must use both
+	// {namespace} and {service}. Defaults to "{namespace}.{service}".
+	// +optional
+	// +kubebuilder:validation:MaxLength=255
+	ExchangeNameTemplate string `json:"exchangeNameTemplate,omitempty"`
+	// +optional
+	Topology QueueTopologyConfig `json:"topology,omitempty"`
+	// +optional
+	LazyQueues LazyQueuesConfig `json:"lazyQueues,omitempty"`
+}
+
+// BrokerTenancyConfig gives the routed Services a RabbitMQ vhost and user of
+// their own, so tenants sharing a broker cannot reach each other's queues and
+// get their own quotas. The operator creates them with the credentials of
+// spec.broker, which need the "administrator" tag, and hands the buffer
+// services the tenant credentials through a Secret it keeps in the namespace
+// of each Service. It only applies to the rabbitmq backend and cannot be
+// combined with spec.broker.vhost.
+type BrokerTenancyConfig struct {
+	// Isolation is "shared", every Service on the vhost of spec.broker,
+	// "namespace", a vhost and user for the Services of each namespace, or
+	// "service", a vhost and user for each routed Service. Defaults to shared.
+	// +optional
+	// +kubebuilder:validation:Enum=shared;namespace;service
+	Isolation string `json:"isolation,omitempty"`
+	// MaxQueues caps the queues of each tenant vhost. Unlimited by default.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxQueues *int32 `json:"maxQueues,omitempty"`
+	// MaxConnections caps the client connections of each tenant vhost.
+	// Unlimited by default.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxConnections *int32 `json:"maxConnections,omitempty"`
+}
+
+// RabbitMQClusterConfig has the operator create a RabbitmqCluster named
+// "carbonrouter-rabbitmq" in the namespace of the schedule, run by the RabbitMQ
+// Cluster Operator, which must be installed. The Services of the schedule then
+// use it with the default user the Cluster Operator generates. Schedules of the
+// same namespace share the cluster, so their settings should match; it is
+// deleted with the last schedule that asks for it.
+type RabbitMQClusterConfig struct {
+	// Replicas is the number of RabbitMQ nodes. Defaults to 1; use an odd
+	// number so the cluster keeps a quorum.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Replicas *int32 `json:"replicas,omitempty"`
+	// Image of the RabbitMQ nodes. Defaults to the one of the Cluster Operator.
+	// +optional
+	Image string `json:"image,omitempty"`
+	// Storage is the size of the persistent volume of each node. Defaults to
+	// the one of the Cluster Operator, 10Gi.
+	// +optional
+	Storage *resource.Quantity `json:"storage,omitempty"`
+	// StorageClassName of the persistent volumes. Defaults to the default
+	// storage class of the cluster.
+	// +optional
+	StorageClassName string `json:"storageClassName,omitempty"`
+	// Resources of each node. Defaults to those of the Cluster Operator.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+}
+
+// KafkaConfig locates a Kafka cluster. Each queue of a Service is a topic named
+// by spec.broker.queueNameTemplate, and replies flow back on the topic named
+// after its exchange with a ".reply" suffix. Topics are expected to exist or
+// be auto-created by the cluster.
+type KafkaConfig struct {
+	// BootstrapServers are the host:port addresses of the brokers.
+	// +kubebuilder:validation:MinItems=1
+	BootstrapServers []string `json:"bootstrapServers"`
+	// SASL is the mechanism authenticating with the credentials of
+	// spec.broker.secretRef. Defaults to plaintext when a Secret is set.
+	// +optional
+	// +kubebuilder:validation:Enum=plaintext;scram_sha256;scram_sha512
+	SASL string `json:"sasl,omitempty"`
+	// TLS encrypts the connections to the brokers.
+	// +optional
+	TLS bool `json:"tls,omitempty"`
+}
+
+// NATSConfig locates a NATS server with JetStream enabled. The queues of a
+// Service are the subjects "<exchange>.<queue>" of one work-queue stream named
+// after its exchange, each read by a durable consumer named after the queue;
+// dots and other characters NATS forbids in those names become underscores.
+// The buffer services create the stream and consumers.
+type NATSConfig struct {
+	// Servers are the URLs of the servers, e.g. "nats://nats.nats:4222".
+	// +kubebuilder:validation:MinItems=1
+	Servers []string `json:"servers"`
+	// MonitoringEndpoint is the host:port of the HTTP monitoring endpoint KEDA
+	// reads the consumer lag from. Defaults to the host of the first server on
+	// port 8222.
+	// +optional
+	MonitoringEndpoint string `json:"monitoringEndpoint,omitempty"`
+	// Account holding the streams. Defaults to "$G", the account of servers
+	// without multi-tenancy.
+	// +optional
+	Account string `json:"account,omitempty"`
+}
+
+// SQSConfig locates the Amazon SQS queues of a Service. Each queue is named by
+// spec.broker.queueNameTemplate, with underscores for the characters SQS
+// forbids, unless Queues gives its URL. Every router reads its replies from a
+// queue of its own, which it creates on start and deletes on shutdown. The
+// credentials of spec.broker.secretRef, if set, are an access key ID under
+// "username" and a secret access key under "password".
+type SQSConfig struct {
+	// Region of the queues, e.g. "eu-west-1".
+	// +kubebuilder:validation:MinLength=1
+	Region string `json:"region"`
+	// AccountID of the AWS account owning the queues named by the templates.
+	// Defaults to the account of the credentials, looking the queues up by name.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[0-9]{12}$`
+	AccountID string `json:"accountID,omitempty"`
+	// Queues gives the URLs of the queues of some precisions, to reuse queues
+	// provisioned outside the operator.
+	// +optional
+	// +listType=map
+	// +listMapKey=precision
+	Queues []SQSQueue `json:"queues,omitempty"`
+	// CreateQueues has the buffer services create the queues named by the
+	// templates when missing, which needs sqs:CreateQueue.
+	// +optional
+	CreateQueues bool `json:"createQueues,omitempty"`
+	// RoleARN is the IAM role of the buffer services, bound to their
+	// ServiceAccount through IAM Roles for Service Accounts, and assumed by KEDA
+	// to read the queue lengths. Takes precedence over spec.broker.secretRef.
+	// +optional
+	RoleARN string `json:"roleARN,omitempty"`
+}
+
+// SQSQueue gives the queue URLs of one precision.
+type SQSQueue struct {
+	Precision int `json:"precision"`
+	// URL of the queue buffering the requests of the precision.
+	URL string `json:"url"`
+	// DirectURL of the queue carrying the requests the router forwards
+	// straight away. Defaults to the queue named by the templates.
+	// +optional
+	DirectURL string `json:"directURL,omitempty"`
+}
+
+// RedisConfig locates a Redis server, version 6.2 or later. Each queue of a
+// Service is a stream named by spec.broker.queueNameTemplate, read by the
+// consumer group named after its exchange with a ".consumer" suffix, and
+// replies are published on channels of the router. The credentials of
+// spec.broker.secretRef, if set, are those of a Redis ACL user.
+type RedisConfig struct {
+	// Address is the host:port of the server, e.g. "redis.redis:6379".
+	// +kubebuilder:validation:MinLength=1
+	Address string `json:"address"`
+	// DatabaseIndex of the streams. Defaults to 0.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	DatabaseIndex int32 `json:"databaseIndex,omitempty"`
+	// TLS encrypts the connections to the server.
+	// +optional
+	TLS bool `json:"tls,omitempty"`
+}
+
+// QueueTopologyConfig has the operator declare the RabbitMQ topology of a
+// Service through the management API instead of leaving it to the consumers:
+// its exchange, the direct and buffered queues of every precision and their
+// bindings, declared before any consumer starts and re-declared every ten
+// minutes. The arguments of the buffered queues are set by a broker policy, so
+// they can change without recreating the queues; the lazy queue policy, while
+// it applies, carries them too. Only applies to the rabbitmq backend.
+type QueueTopologyConfig struct {
+	// Managed turns the topology management on. The other fields require it.
+	// +optional
+	Managed bool `json:"managed,omitempty"`
+	// DeadLetter routes the messages the buffered queues expire or drop to a
+	// queue named after the exchange with a ".dead-letter" suffix, through a
+	// fanout exchange with a ".dlx" suffix.
+	// +optional
+	DeadLetter bool `json:"deadLetter,omitempty"`
+	// MaxAttempts dead-letters a buffered request once forwarding it failed
+	// this many times, instead of requeueing it again. Requires DeadLetter.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxAttempts *int32 `json:"maxAttempts,omitempty"`
+	// MessageTTLSeconds expires the buffered messages older than it.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MessageTTLSeconds *int32 `json:"messageTTLSeconds,omitempty"`
+	// MaxLength caps the messages held by each buffered queue.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxLength *int64 `json:"maxLength,omitempty"`
+	// Overflow is what the broker does with messages beyond MaxLength:
+	// "reject-publish" refuses new ones, "reject-publish-dlx" dead-letters
+	// them too and "drop-head" discards the oldest. Defaults to reject-publish.
+	// +optional
+	// +kubebuilder:validation:Enum=reject-publish;reject-publish-dlx;drop-head
+	Overflow string `json:"overflow,omitempty"`
+	// Lazy keeps the buffered queues in lazy mode at all times, paging their
+	// messages to disk.
+	// +optional
+	Lazy bool `json:"lazy,omitempty"`
+}
+
+// LazyQueuesConfig has the operator set a broker policy on the buffered queues
+// of a Service once its schedule has throttled processing for a while, so long
+// backlogs are paged to disk instead of filling the broker memory. The policy
+// is removed as soon as the throttle lifts.
+type LazyQueuesConfig struct {
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+	// AfterSeconds is how long processing must stay throttled before the policy
+	// is applied. Defaults to 300.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	AfterSeconds *int32 `json:"afterSeconds,omitempty"`
+	// MaxLength caps the messages held by each buffered queue while the policy
+	// applies. Unset leaves the queues unbounded.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxLength *int64 `json:"maxLength,omitempty"`
+	// Overflow is what the broker does with messages beyond MaxLength:
+	// "reject-publish" refuses new ones, "drop-head" discards the oldest.
+	// Defaults to reject-publish.
+	// +optional
+	// +kubebuilder:validation:Enum=reject-publish;drop-head
+	Overflow string `json:"overflow,omitempty"`
+	// Priority of the policy among the policies of the vhost. The broker only
+	// applies the highest priority policy matching a queue. Defaults to 1, just
+	// above the topology policy of the Service, so other policies win.
+	// +optional
+	Priority *int32 `json:"priority,omitempty"`
+}
+
+// ChaosWindow is a recurring window during which the carbon signal is replaced
+// by a synthetic spike or dip.
+type ChaosWindow struct {
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Start anchors the window. Defaults to the Unix epoch, so periodic windows
+	// line up with wall-clock boundaries (e.g. every hour on the hour).
+	// +optional
+	Start *metav1.Time `json:"start,omitempty"`
+	// PeriodSeconds repeats the window from Start. Zero runs it once.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	PeriodSeconds int32 `json:"periodSeconds,omitempty"`
+	// +kubebuilder:validation:Minimum=1
+	DurationSeconds int32 `json:"durationSeconds"`
+	// Factor multiplies the real intensity: above 1 for a spike, below 1 for a dip.
+	// +optional
+	Factor *string `json:"factor,omitempty"`
+	// Intensity replaces the real intensity (gCO2/kWh) and takes precedence over Factor.
+	// +optional
+	Intensity *string `json:"intensity,omitempty"`
+}
+
+// ChaosConfig overlays synthetic carbon spikes and dips onto the real signal,
+// so teams can rehearse aggressive throttling without waiting for a grid event.
+// It only takes effect when the decision engine runs with CHAOS_MODE_ENABLED.
+type ChaosConfig struct {
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Windows []ChaosWindow `json:"windows,omitempty"`
 }
 
 // TrafficScheduleSpec defines the desired state of TrafficSchedule.
@@ -95,6 +1314,49 @@ type TrafficScheduleSpec struct {
 	Consumer ComponentConfig `json:"consumer,omitempty"`
 	// +optional
 	Scheduler SchedulerConfigSpec `json:"scheduler,omitempty"`
+	// +optional
+	ScaleCoordination ScaleCoordinationConfig `json:"scaleCoordination,omitempty"`
+	// +optional
+	Concurrency ConcurrencyConfig `json:"concurrency,omitempty"`
+	// +optional
+	ForecastScaling ForecastScalingConfig `json:"forecastScaling,omitempty"`
+	// +optional
+	Rightsizing RightsizingConfig `json:"rightsizing,omitempty"`
+	// +optional
+	EnergyCalibration EnergyCalibrationConfig `json:"energyCalibration,omitempty"`
+	// +optional
+	PowerCap PowerCapConfig `json:"powerCap,omitempty"`
+	// +optional
+	AutoscalerHints AutoscalerHintsConfig `json:"autoscalerHints,omitempty"`
+	// +optional
+	Locality LocalityConfig `json:"locality,omitempty"`
+	// +optional
+	Attribution AttributionConfig `json:"attribution,omitempty"`
+	// +optional
+	Routing RoutingConfig `json:"routing,omitempty"`
+	// +optional
+	Identity IdentityConfig `json:"identity,omitempty"`
+	// +optional
+	Broker BrokerConfig `json:"broker,omitempty"`
+	// +optional
+	Chaos ChaosConfig `json:"chaos,omitempty"`
+	// +optional
+	Propagation PropagationConfig `json:"propagation,omitempty"`
+	// ServiceSelector binds the schedule to a subset of the opted-in Services.
+	// When several schedules match a Service, the highest priority wins, then
+	// the most specific scope: a label selector (Service), then a namespaces
+	// list naming the Service's namespace or a schedule in that namespace
+	// (Namespace), then any other schedule (Cluster). Remaining ties go to a
+	// schedule in the Service's namespace, then the oldest, then the first by
+	// namespace/name.
+	// +optional
+	ServiceSelector ServiceSelector `json:"serviceSelector,omitempty"`
+	// Priority ranks the schedule against the others matching the same Service,
+	// before their scope is compared. Higher wins; defaults to 0.
+	// +optional
+	// +kubebuilder:validation:Minimum=-1000
+	// +kubebuilder:validation:Maximum=1000
+	Priority int32 `json:"priority,omitempty"`
 }
 
 // FlavourDecision describes the scheduler outcome for a specific precision flavour.
@@ -106,6 +1368,14 @@ type FlavourDecision struct {
 	// Emissions is the estimated carbon cost per request in gCO2eq for this flavour.
 	// +optional
 	Emissions string `json:"emissions,omitempty"`
+	// JoulesPerRequest is the energy per request measured for this flavour
+	// when spec.energyCalibration is enabled.
+	// +optional
+	JoulesPerRequest string `json:"joulesPerRequest,omitempty"`
+	// Concurrency is the share of its worker pool the consumers run for this
+	// flavour, set when spec.concurrency is enabled. Empty means the full pool.
+	// +optional
+	Concurrency string `json:"concurrency,omitempty"`
 }
 
 // StrategyDecision is an alias for backward compatibility.
@@ -139,12 +1409,90 @@ type TrafficScheduleStatus struct {
 	CarbonForecastNow string `json:"carbonForecastNow,omitempty"`
 	// CarbonForecastNext is the next slot forecast in gCO2/kWh.
 	CarbonForecastNext string `json:"carbonForecastNext,omitempty"`
+	// ZoneForecasts holds the current forecast in gCO2/kWh per spec.locality zone.
+	ZoneForecasts map[string]string `json:"zoneForecasts,omitempty"`
 	// ForecastSchedule summarises the upcoming half-hour slots as reported by the provider.
 	ForecastSchedule []ForecastSlot `json:"forecastSchedule,omitempty"`
 	// Diagnostics contains policy-specific telemetry useful for debugging.
 	Diagnostics map[string]string `json:"diagnostics,omitempty"`
 	// RoutingEvaluator indicates which component performs routing decisions (router or consumer).
 	RoutingEvaluator string `json:"routingEvaluator,omitempty"`
+	// LastKnownGood is the last schedule computed by the decision engine, applied
+	// again while the engine is unreachable.
+	// +optional
+	LastKnownGood *LastKnownGoodSchedule `json:"lastKnownGood,omitempty"`
+	// Savings accounts the carbon avoided by the Services routed by the
+	// schedule against serving every request at the highest precision.
+	// +optional
+	Savings *CarbonSavings `json:"savings,omitempty"`
+	// Conditions report the outcome of the last reconciliation.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// LastKnownGoodSchedule is the routing and scaling part of a schedule computed
+// by the decision engine.
+type LastKnownGoodSchedule struct {
+	Flavours []FlavourDecision `json:"flavours"`
+	// +optional
+	ActivePolicy string `json:"activePolicy,omitempty"`
+	// +optional
+	ProcessingThrottle string `json:"processingThrottle,omitempty"`
+	// +optional
+	EffectiveReplicaCeilings map[string]int32 `json:"effectiveReplicaCeilings,omitempty"`
+	// ValidUntil is the expiry the decision engine set for the schedule.
+	ValidUntil metav1.Time `json:"validUntil"`
+}
+
+// CarbonSavings is the carbon avoided by routing requests to lower precisions,
+// estimated from the emissions per request the schedule reports for each
+// precision and the requests the routers answered.
+type CarbonSavings struct {
+	// WindowStart and WindowEnd bound the last schedule window accounted.
+	WindowStart metav1.Time `json:"windowStart"`
+	WindowEnd   metav1.Time `json:"windowEnd"`
+	// Window holds the savings of each Service over the last window.
+	// +optional
+	// +listType=map
+	// +listMapKey=service
+	Window []ServiceSavings `json:"window,omitempty"`
+	// Daily and Monthly roll the savings of all the Services up per UTC day
+	// and month, over the last 31 days and 12 months.
+	// +optional
+	// +listType=map
+	// +listMapKey=period
+	Daily []PeriodSavings `json:"daily,omitempty"`
+	// +optional
+	// +listType=map
+	// +listMapKey=period
+	Monthly []PeriodSavings `json:"monthly,omitempty"`
+	// Total holds the savings since the accounting started.
+	Total SavingsTotals `json:"total"`
+}
+
+// SavingsTotals is the carbon accounted for a set of answered requests.
+type SavingsTotals struct {
+	Requests int64 `json:"requests"`
+	// BaselineGrams is the gCO2eq the requests would have cost at the
+	// highest precision.
+	BaselineGrams string `json:"baselineGrams"`
+	// AvoidedGrams is the gCO2eq avoided by serving them at their precision.
+	AvoidedGrams string `json:"avoidedGrams"`
+}
+
+// ServiceSavings is the savings of one Service, as "namespace/name".
+type ServiceSavings struct {
+	Service       string `json:"service"`
+	SavingsTotals `json:",inline"`
+}
+
+// PeriodSavings is the savings of a UTC day ("2006-01-02") or month
+// ("2006-01").
+type PeriodSavings struct {
+	Period        string `json:"period"`
+	SavingsTotals `json:",inline"`
 }
 
 // ForecastSlot describes a single carbon forecast interval.
@@ -21,87 +21,2116 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AttributionConfig) DeepCopyInto(out *AttributionConfig) {
+	*out = *in
+	if in.Clients != nil {
+		in, out := &in.Clients, &out.Clients
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AttributionConfig.
+func (in *AttributionConfig) DeepCopy() *AttributionConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(AttributionConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AutoscalerHintsConfig) DeepCopyInto(out *AutoscalerHintsConfig) {
+	*out = *in
+	if in.NodeGroups != nil {
+		in, out := &in.NodeGroups, &out.NodeGroups
+		*out = make([]NodeGroupHint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoscalerHintsConfig.
+func (in *AutoscalerHintsConfig) DeepCopy() *AutoscalerHintsConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoscalerHintsConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AutoscalingConfig) DeepCopyInto(out *AutoscalingConfig) {
 	*out = *in
-	if in.MinReplicaCount != nil {
-		in, out := &in.MinReplicaCount, &out.MinReplicaCount
+	if in.MinReplicaCount != nil {
+		in, out := &in.MinReplicaCount, &out.MinReplicaCount
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxReplicaCount != nil {
+		in, out := &in.MaxReplicaCount, &out.MaxReplicaCount
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CooldownPeriod != nil {
+		in, out := &in.CooldownPeriod, &out.CooldownPeriod
+		*out = new(int32)
+		**out = **in
+	}
+	if in.CPUUtilization != nil {
+		in, out := &in.CPUUtilization, &out.CPUUtilization
+		*out = new(int32)
+		**out = **in
+	}
+	if in.PollingInterval != nil {
+		in, out := &in.PollingInterval, &out.PollingInterval
+		*out = new(int32)
+		**out = **in
+	}
+	if in.QueueLengthTarget != nil {
+		in, out := &in.QueueLengthTarget, &out.QueueLengthTarget
+		*out = new(int32)
+		**out = **in
+	}
+	if in.RequestRateThreshold != nil {
+		in, out := &in.RequestRateThreshold, &out.RequestRateThreshold
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoscalingConfig.
+func (in *AutoscalingConfig) DeepCopy() *AutoscalingConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(AutoscalingConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AvailabilitySLO) DeepCopyInto(out *AvailabilitySLO) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AvailabilitySLO.
+func (in *AvailabilitySLO) DeepCopy() *AvailabilitySLO {
+	if in == nil {
+		return nil
+	}
+	out := new(AvailabilitySLO)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BrokerConfig) DeepCopyInto(out *BrokerConfig) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+	if in.Port != nil {
+		in, out := &in.Port, &out.Port
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Cluster != nil {
+		in, out := &in.Cluster, &out.Cluster
+		*out = new(RabbitMQClusterConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Tenancy.DeepCopyInto(&out.Tenancy)
+	if in.Kafka != nil {
+		in, out := &in.Kafka, &out.Kafka
+		*out = new(KafkaConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.NATS != nil {
+		in, out := &in.NATS, &out.NATS
+		*out = new(NATSConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SQS != nil {
+		in, out := &in.SQS, &out.SQS
+		*out = new(SQSConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Redis != nil {
+		in, out := &in.Redis, &out.Redis
+		*out = new(RedisConfig)
+		**out = **in
+	}
+	in.Topology.DeepCopyInto(&out.Topology)
+	in.LazyQueues.DeepCopyInto(&out.LazyQueues)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BrokerConfig.
+func (in *BrokerConfig) DeepCopy() *BrokerConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(BrokerConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BrokerTenancyConfig) DeepCopyInto(out *BrokerTenancyConfig) {
+	*out = *in
+	if in.MaxQueues != nil {
+		in, out := &in.MaxQueues, &out.MaxQueues
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxConnections != nil {
+		in, out := &in.MaxConnections, &out.MaxConnections
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BrokerTenancyConfig.
+func (in *BrokerTenancyConfig) DeepCopy() *BrokerTenancyConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(BrokerTenancyConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BrownoutConfig) DeepCopyInto(out *BrownoutConfig) {
+	*out = *in
+	if in.Paths != nil {
+		in, out := &in.Paths, &out.Paths
+		*out = make([]PathMatch, len(*in))
+		copy(*out, *in)
+	}
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BrownoutConfig.
+func (in *BrownoutConfig) DeepCopy() *BrownoutConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(BrownoutConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BufferConfig) DeepCopyInto(out *BufferConfig) {
+	*out = *in
+	if in.QueueLengthTarget != nil {
+		in, out := &in.QueueLengthTarget, &out.QueueLengthTarget
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Concurrency != nil {
+		in, out := &in.Concurrency, &out.Concurrency
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MinRequestDuration != nil {
+		in, out := &in.MinRequestDuration, &out.MinRequestDuration
+		*out = new(string)
+		**out = **in
+	}
+	if in.Policies != nil {
+		in, out := &in.Policies, &out.Policies
+		*out = make([]BufferPolicy, len(*in))
+		copy(*out, *in)
+	}
+	if in.DirectMethods != nil {
+		in, out := &in.DirectMethods, &out.DirectMethods
+		*out = make([]HTTPMethod, len(*in))
+		copy(*out, *in)
+	}
+	if in.PriorityClasses != nil {
+		in, out := &in.PriorityClasses, &out.PriorityClasses
+		*out = make([]PriorityClass, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BufferConfig.
+func (in *BufferConfig) DeepCopy() *BufferConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(BufferConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BufferPolicy) DeepCopyInto(out *BufferPolicy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BufferPolicy.
+func (in *BufferPolicy) DeepCopy() *BufferPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(BufferPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BurstReserveConfig) DeepCopyInto(out *BurstReserveConfig) {
+	*out = *in
+	if in.ReleaseMinutes != nil {
+		in, out := &in.ReleaseMinutes, &out.ReleaseMinutes
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BurstReserveConfig.
+func (in *BurstReserveConfig) DeepCopy() *BurstReserveConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(BurstReserveConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BurstReserveStatus) DeepCopyInto(out *BurstReserveStatus) {
+	*out = *in
+	if in.ReleasedAt != nil {
+		in, out := &in.ReleasedAt, &out.ReleasedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.ReleaseUntil != nil {
+		in, out := &in.ReleaseUntil, &out.ReleaseUntil
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BurstReserveStatus.
+func (in *BurstReserveStatus) DeepCopy() *BurstReserveStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(BurstReserveStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CarbonIntensityProvider) DeepCopyInto(out *CarbonIntensityProvider) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonIntensityProvider.
+func (in *CarbonIntensityProvider) DeepCopy() *CarbonIntensityProvider {
+	if in == nil {
+		return nil
+	}
+	out := new(CarbonIntensityProvider)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CarbonIntensityProvider) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CarbonIntensityProviderList) DeepCopyInto(out *CarbonIntensityProviderList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CarbonIntensityProvider, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonIntensityProviderList.
+func (in *CarbonIntensityProviderList) DeepCopy() *CarbonIntensityProviderList {
+	if in == nil {
+		return nil
+	}
+	out := new(CarbonIntensityProviderList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CarbonIntensityProviderList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CarbonIntensityProviderSpec) DeepCopyInto(out *CarbonIntensityProviderSpec) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(v1.SecretReference)
+		**out = **in
+	}
+	if in.RefreshIntervalSeconds != nil {
+		in, out := &in.RefreshIntervalSeconds, &out.RefreshIntervalSeconds
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonIntensityProviderSpec.
+func (in *CarbonIntensityProviderSpec) DeepCopy() *CarbonIntensityProviderSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CarbonIntensityProviderSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CarbonIntensityProviderStatus) DeepCopyInto(out *CarbonIntensityProviderStatus) {
+	*out = *in
+	if in.ForecastSchedule != nil {
+		in, out := &in.ForecastSchedule, &out.ForecastSchedule
+		*out = make([]ForecastSlot, len(*in))
+		copy(*out, *in)
+	}
+	in.LastUpdated.DeepCopyInto(&out.LastUpdated)
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonIntensityProviderStatus.
+func (in *CarbonIntensityProviderStatus) DeepCopy() *CarbonIntensityProviderStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CarbonIntensityProviderStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CarbonRoutedService) DeepCopyInto(out *CarbonRoutedService) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonRoutedService.
+func (in *CarbonRoutedService) DeepCopy() *CarbonRoutedService {
+	if in == nil {
+		return nil
+	}
+	out := new(CarbonRoutedService)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CarbonRoutedService) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CarbonRoutedServiceList) DeepCopyInto(out *CarbonRoutedServiceList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CarbonRoutedService, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonRoutedServiceList.
+func (in *CarbonRoutedServiceList) DeepCopy() *CarbonRoutedServiceList {
+	if in == nil {
+		return nil
+	}
+	out := new(CarbonRoutedServiceList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CarbonRoutedServiceList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CarbonRoutedServiceSpec) DeepCopyInto(out *CarbonRoutedServiceSpec) {
+	*out = *in
+	if in.Router != nil {
+		in, out := &in.Router, &out.Router
+		*out = new(ComponentConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Consumer != nil {
+		in, out := &in.Consumer, &out.Consumer
+		*out = new(ComponentConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Target != nil {
+		in, out := &in.Target, &out.Target
+		*out = new(TargetConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Buffer.DeepCopyInto(&out.Buffer)
+	if in.BurstReserve != nil {
+		in, out := &in.BurstReserve, &out.BurstReserve
+		*out = new(BurstReserveConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RoutingRules != nil {
+		in, out := &in.RoutingRules, &out.RoutingRules
+		*out = make([]RoutingRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Resilience != nil {
+		in, out := &in.Resilience, &out.Resilience
+		*out = new(ResilienceConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Ingress != nil {
+		in, out := &in.Ingress, &out.Ingress
+		*out = new(IngressConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Override != nil {
+		in, out := &in.Override, &out.Override
+		*out = new(PrecisionOverride)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SLOGuard != nil {
+		in, out := &in.SLOGuard, &out.SLOGuard
+		*out = new(SLOGuardConfig)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonRoutedServiceSpec.
+func (in *CarbonRoutedServiceSpec) DeepCopy() *CarbonRoutedServiceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CarbonRoutedServiceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CarbonRoutedServiceStatus) DeepCopyInto(out *CarbonRoutedServiceStatus) {
+	*out = *in
+	if in.Overrides != nil {
+		in, out := &in.Overrides, &out.Overrides
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ActiveWeights != nil {
+		in, out := &in.ActiveWeights, &out.ActiveWeights
+		*out = make([]FlavourDecision, len(*in))
+		copy(*out, *in)
+	}
+	if in.ReplicaCeilings != nil {
+		in, out := &in.ReplicaCeilings, &out.ReplicaCeilings
+		*out = make(map[string]int32, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.QueueDepths != nil {
+		in, out := &in.QueueDepths, &out.QueueDepths
+		*out = make(map[string]int64, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.BurstReserve != nil {
+		in, out := &in.BurstReserve, &out.BurstReserve
+		*out = new(BurstReserveStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SLOGuard != nil {
+		in, out := &in.SLOGuard, &out.SLOGuard
+		*out = new(SLOGuardStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	in.LastUpdated.DeepCopyInto(&out.LastUpdated)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonRoutedServiceStatus.
+func (in *CarbonRoutedServiceStatus) DeepCopy() *CarbonRoutedServiceStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CarbonRoutedServiceStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CarbonSavings) DeepCopyInto(out *CarbonSavings) {
+	*out = *in
+	in.WindowStart.DeepCopyInto(&out.WindowStart)
+	in.WindowEnd.DeepCopyInto(&out.WindowEnd)
+	if in.Window != nil {
+		in, out := &in.Window, &out.Window
+		*out = make([]ServiceSavings, len(*in))
+		copy(*out, *in)
+	}
+	if in.Daily != nil {
+		in, out := &in.Daily, &out.Daily
+		*out = make([]PeriodSavings, len(*in))
+		copy(*out, *in)
+	}
+	if in.Monthly != nil {
+		in, out := &in.Monthly, &out.Monthly
+		*out = make([]PeriodSavings, len(*in))
+		copy(*out, *in)
+	}
+	out.Total = in.Total
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CarbonSavings.
+func (in *CarbonSavings) DeepCopy() *CarbonSavings {
+	if in == nil {
+		return nil
+	}
+	out := new(CarbonSavings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChaosConfig) DeepCopyInto(out *ChaosConfig) {
+	*out = *in
+	if in.Windows != nil {
+		in, out := &in.Windows, &out.Windows
+		*out = make([]ChaosWindow, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChaosConfig.
+func (in *ChaosConfig) DeepCopy() *ChaosConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ChaosConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ChaosWindow) DeepCopyInto(out *ChaosWindow) {
+	*out = *in
+	if in.Start != nil {
+		in, out := &in.Start, &out.Start
+		*out = (*in).DeepCopy()
+	}
+	if in.Factor != nil {
+		in, out := &in.Factor, &out.Factor
+		*out = new(string)
+		**out = **in
+	}
+	if in.Intensity != nil {
+		in, out := &in.Intensity, &out.Intensity
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ChaosWindow.
+func (in *ChaosWindow) DeepCopy() *ChaosWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(ChaosWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClientClaimMatch) DeepCopyInto(out *ClientClaimMatch) {
+	*out = *in
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClientClaimMatch.
+func (in *ClientClaimMatch) DeepCopy() *ClientClaimMatch {
+	if in == nil {
+		return nil
+	}
+	out := new(ClientClaimMatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClientHeaderMatch) DeepCopyInto(out *ClientHeaderMatch) {
+	*out = *in
+	if in.Values != nil {
+		in, out := &in.Values, &out.Values
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClientHeaderMatch.
+func (in *ClientHeaderMatch) DeepCopy() *ClientHeaderMatch {
+	if in == nil {
+		return nil
+	}
+	out := new(ClientHeaderMatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClientMatch) DeepCopyInto(out *ClientMatch) {
+	*out = *in
+	if in.Principals != nil {
+		in, out := &in.Principals, &out.Principals
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SourceLabels != nil {
+		in, out := &in.SourceLabels, &out.SourceLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Header != nil {
+		in, out := &in.Header, &out.Header
+		*out = new(ClientHeaderMatch)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Claim != nil {
+		in, out := &in.Claim, &out.Claim
+		*out = new(ClientClaimMatch)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClientMatch.
+func (in *ClientMatch) DeepCopy() *ClientMatch {
+	if in == nil {
+		return nil
+	}
+	out := new(ClientMatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClientPrecisionRule) DeepCopyInto(out *ClientPrecisionRule) {
+	*out = *in
+	in.Clients.DeepCopyInto(&out.Clients)
+	if in.Precisions != nil {
+		in, out := &in.Precisions, &out.Precisions
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClientPrecisionRule.
+func (in *ClientPrecisionRule) DeepCopy() *ClientPrecisionRule {
+	if in == nil {
+		return nil
+	}
+	out := new(ClientPrecisionRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComponentConfig) DeepCopyInto(out *ComponentConfig) {
+	*out = *in
+	in.Autoscaling.DeepCopyInto(&out.Autoscaling)
+	in.Resources.DeepCopyInto(&out.Resources)
+	if in.MinAvailable != nil {
+		in, out := &in.MinAvailable, &out.MinAvailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	in.Image.DeepCopyInto(&out.Image)
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]v1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(v1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TopologySpreadConstraints != nil {
+		in, out := &in.TopologySpreadConstraints, &out.TopologySpreadConstraints
+		*out = make([]v1.TopologySpreadConstraint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ExtraEnv != nil {
+		in, out := &in.ExtraEnv, &out.ExtraEnv
+		*out = make([]v1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.EnvFrom != nil {
+		in, out := &in.EnvFrom, &out.EnvFrom
+		*out = make([]v1.EnvFromSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PodSecurityContext != nil {
+		in, out := &in.PodSecurityContext, &out.PodSecurityContext
+		*out = new(v1.PodSecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecurityContext != nil {
+		in, out := &in.SecurityContext, &out.SecurityContext
+		*out = new(v1.SecurityContext)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AutomountServiceAccountToken != nil {
+		in, out := &in.AutomountServiceAccountToken, &out.AutomountServiceAccountToken
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComponentConfig.
+func (in *ComponentConfig) DeepCopy() *ComponentConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ComponentConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConcurrencyConfig) DeepCopyInto(out *ConcurrencyConfig) {
+	*out = *in
+	if in.WorkersPerQueue != nil {
+		in, out := &in.WorkersPerQueue, &out.WorkersPerQueue
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MinFactor != nil {
+		in, out := &in.MinFactor, &out.MinFactor
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConcurrencyConfig.
+func (in *ConcurrencyConfig) DeepCopy() *ConcurrencyConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ConcurrencyConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConnectionPoolConfig) DeepCopyInto(out *ConnectionPoolConfig) {
+	*out = *in
+	if in.MaxConnections != nil {
+		in, out := &in.MaxConnections, &out.MaxConnections
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxPendingRequests != nil {
+		in, out := &in.MaxPendingRequests, &out.MaxPendingRequests
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxRequestsPerConnection != nil {
+		in, out := &in.MaxRequestsPerConnection, &out.MaxRequestsPerConnection
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConnectionPoolConfig.
+func (in *ConnectionPoolConfig) DeepCopy() *ConnectionPoolConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ConnectionPoolConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConnectionRebalancingConfig) DeepCopyInto(out *ConnectionRebalancingConfig) {
+	*out = *in
+	if in.MaxConnectionDurationSeconds != nil {
+		in, out := &in.MaxConnectionDurationSeconds, &out.MaxConnectionDurationSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.DrainGraceSeconds != nil {
+		in, out := &in.DrainGraceSeconds, &out.DrainGraceSeconds
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConnectionRebalancingConfig.
+func (in *ConnectionRebalancingConfig) DeepCopy() *ConnectionRebalancingConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ConnectionRebalancingConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EnergyCalibrationConfig) DeepCopyInto(out *EnergyCalibrationConfig) {
+	*out = *in
+	if in.WindowMinutes != nil {
+		in, out := &in.WindowMinutes, &out.WindowMinutes
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnergyCalibrationConfig.
+func (in *EnergyCalibrationConfig) DeepCopy() *EnergyCalibrationConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(EnergyCalibrationConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EngineAuthConfig) DeepCopyInto(out *EngineAuthConfig) {
+	*out = *in
+	out.SecretRef = in.SecretRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EngineAuthConfig.
+func (in *EngineAuthConfig) DeepCopy() *EngineAuthConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(EngineAuthConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FaultAbort) DeepCopyInto(out *FaultAbort) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FaultAbort.
+func (in *FaultAbort) DeepCopy() *FaultAbort {
+	if in == nil {
+		return nil
+	}
+	out := new(FaultAbort)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FaultDelay) DeepCopyInto(out *FaultDelay) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FaultDelay.
+func (in *FaultDelay) DeepCopy() *FaultDelay {
+	if in == nil {
+		return nil
+	}
+	out := new(FaultDelay)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FaultInjectionConfig) DeepCopyInto(out *FaultInjectionConfig) {
+	*out = *in
+	if in.PerPrecision != nil {
+		in, out := &in.PerPrecision, &out.PerPrecision
+		*out = make([]PrecisionFault, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FaultInjectionConfig.
+func (in *FaultInjectionConfig) DeepCopy() *FaultInjectionConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(FaultInjectionConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlavourAutoscaling) DeepCopyInto(out *FlavourAutoscaling) {
+	*out = *in
+	in.Autoscaling.DeepCopyInto(&out.Autoscaling)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlavourAutoscaling.
+func (in *FlavourAutoscaling) DeepCopy() *FlavourAutoscaling {
+	if in == nil {
+		return nil
+	}
+	out := new(FlavourAutoscaling)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FlavourDecision) DeepCopyInto(out *FlavourDecision) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlavourDecision.
+func (in *FlavourDecision) DeepCopy() *FlavourDecision {
+	if in == nil {
+		return nil
+	}
+	out := new(FlavourDecision)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ForecastScalingConfig) DeepCopyInto(out *ForecastScalingConfig) {
+	*out = *in
+	if in.LeadMinutes != nil {
+		in, out := &in.LeadMinutes, &out.LeadMinutes
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxForecast != nil {
+		in, out := &in.MaxForecast, &out.MaxForecast
+		*out = new(string)
+		**out = **in
+	}
+	if in.ConsumerReplicas != nil {
+		in, out := &in.ConsumerReplicas, &out.ConsumerReplicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TargetReplicas != nil {
+		in, out := &in.TargetReplicas, &out.TargetReplicas
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ForecastScalingConfig.
+func (in *ForecastScalingConfig) DeepCopy() *ForecastScalingConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ForecastScalingConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ForecastSlot) DeepCopyInto(out *ForecastSlot) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ForecastSlot.
+func (in *ForecastSlot) DeepCopy() *ForecastSlot {
+	if in == nil {
+		return nil
+	}
+	out := new(ForecastSlot)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GRPCMethodMatch) DeepCopyInto(out *GRPCMethodMatch) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GRPCMethodMatch.
+func (in *GRPCMethodMatch) DeepCopy() *GRPCMethodMatch {
+	if in == nil {
+		return nil
+	}
+	out := new(GRPCMethodMatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IdentityConfig) DeepCopyInto(out *IdentityConfig) {
+	*out = *in
+	out.IssuerRef = in.IssuerRef
+	if in.TargetPort != nil {
+		in, out := &in.TargetPort, &out.TargetPort
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IdentityConfig.
+func (in *IdentityConfig) DeepCopy() *IdentityConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(IdentityConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImageConfig) DeepCopyInto(out *ImageConfig) {
+	*out = *in
+	if in.PullSecrets != nil {
+		in, out := &in.PullSecrets, &out.PullSecrets
+		*out = make([]v1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImageConfig.
+func (in *ImageConfig) DeepCopy() *ImageConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ImageConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressConfig) DeepCopyInto(out *IngressConfig) {
+	*out = *in
+	if in.Gateways != nil {
+		in, out := &in.Gateways, &out.Gateways
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Hosts != nil {
+		in, out := &in.Hosts, &out.Hosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressConfig.
+func (in *IngressConfig) DeepCopy() *IngressConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IssuerReference) DeepCopyInto(out *IssuerReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IssuerReference.
+func (in *IssuerReference) DeepCopy() *IssuerReference {
+	if in == nil {
+		return nil
+	}
+	out := new(IssuerReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KafkaConfig) DeepCopyInto(out *KafkaConfig) {
+	*out = *in
+	if in.BootstrapServers != nil {
+		in, out := &in.BootstrapServers, &out.BootstrapServers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KafkaConfig.
+func (in *KafkaConfig) DeepCopy() *KafkaConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(KafkaConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LastKnownGoodSchedule) DeepCopyInto(out *LastKnownGoodSchedule) {
+	*out = *in
+	if in.Flavours != nil {
+		in, out := &in.Flavours, &out.Flavours
+		*out = make([]FlavourDecision, len(*in))
+		copy(*out, *in)
+	}
+	if in.EffectiveReplicaCeilings != nil {
+		in, out := &in.EffectiveReplicaCeilings, &out.EffectiveReplicaCeilings
+		*out = make(map[string]int32, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	in.ValidUntil.DeepCopyInto(&out.ValidUntil)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LastKnownGoodSchedule.
+func (in *LastKnownGoodSchedule) DeepCopy() *LastKnownGoodSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(LastKnownGoodSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LatencySLO) DeepCopyInto(out *LatencySLO) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LatencySLO.
+func (in *LatencySLO) DeepCopy() *LatencySLO {
+	if in == nil {
+		return nil
+	}
+	out := new(LatencySLO)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LazyQueuesConfig) DeepCopyInto(out *LazyQueuesConfig) {
+	*out = *in
+	if in.AfterSeconds != nil {
+		in, out := &in.AfterSeconds, &out.AfterSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxLength != nil {
+		in, out := &in.MaxLength, &out.MaxLength
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Priority != nil {
+		in, out := &in.Priority, &out.Priority
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LazyQueuesConfig.
+func (in *LazyQueuesConfig) DeepCopy() *LazyQueuesConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(LazyQueuesConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocalityConfig) DeepCopyInto(out *LocalityConfig) {
+	*out = *in
+	if in.Zones != nil {
+		in, out := &in.Zones, &out.Zones
+		*out = make([]LocalityZone, len(*in))
+		copy(*out, *in)
+	}
+	if in.MinLocalPercent != nil {
+		in, out := &in.MinLocalPercent, &out.MinLocalPercent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Failover != nil {
+		in, out := &in.Failover, &out.Failover
+		*out = make([]LocalityFailover, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LocalityConfig.
+func (in *LocalityConfig) DeepCopy() *LocalityConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(LocalityConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocalityFailover) DeepCopyInto(out *LocalityFailover) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LocalityFailover.
+func (in *LocalityFailover) DeepCopy() *LocalityFailover {
+	if in == nil {
+		return nil
+	}
+	out := new(LocalityFailover)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocalityZone) DeepCopyInto(out *LocalityZone) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LocalityZone.
+func (in *LocalityZone) DeepCopy() *LocalityZone {
+	if in == nil {
+		return nil
+	}
+	out := new(LocalityZone)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MemberCluster) DeepCopyInto(out *MemberCluster) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MemberCluster.
+func (in *MemberCluster) DeepCopy() *MemberCluster {
+	if in == nil {
+		return nil
+	}
+	out := new(MemberCluster)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MeshSecurityConfig) DeepCopyInto(out *MeshSecurityConfig) {
+	*out = *in
+	if in.AllowedPrincipals != nil {
+		in, out := &in.AllowedPrincipals, &out.AllowedPrincipals
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MeshSecurityConfig.
+func (in *MeshSecurityConfig) DeepCopy() *MeshSecurityConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(MeshSecurityConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MirrorConfig) DeepCopyInto(out *MirrorConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MirrorConfig.
+func (in *MirrorConfig) DeepCopy() *MirrorConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(MirrorConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NATSConfig) DeepCopyInto(out *NATSConfig) {
+	*out = *in
+	if in.Servers != nil {
+		in, out := &in.Servers, &out.Servers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NATSConfig.
+func (in *NATSConfig) DeepCopy() *NATSConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(NATSConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NodeGroupHint) DeepCopyInto(out *NodeGroupHint) {
+	*out = *in
+	if in.Intensity != nil {
+		in, out := &in.Intensity, &out.Intensity
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NodeGroupHint.
+func (in *NodeGroupHint) DeepCopy() *NodeGroupHint {
+	if in == nil {
+		return nil
+	}
+	out := new(NodeGroupHint)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OutlierDetectionConfig) DeepCopyInto(out *OutlierDetectionConfig) {
+	*out = *in
+	if in.Consecutive5xxErrors != nil {
+		in, out := &in.Consecutive5xxErrors, &out.Consecutive5xxErrors
+		*out = new(int32)
+		**out = **in
+	}
+	if in.IntervalSeconds != nil {
+		in, out := &in.IntervalSeconds, &out.IntervalSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.BaseEjectionTimeSeconds != nil {
+		in, out := &in.BaseEjectionTimeSeconds, &out.BaseEjectionTimeSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxEjectionPercent != nil {
+		in, out := &in.MaxEjectionPercent, &out.MaxEjectionPercent
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OutlierDetectionConfig.
+func (in *OutlierDetectionConfig) DeepCopy() *OutlierDetectionConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(OutlierDetectionConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PathMatch) DeepCopyInto(out *PathMatch) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PathMatch.
+func (in *PathMatch) DeepCopy() *PathMatch {
+	if in == nil {
+		return nil
+	}
+	out := new(PathMatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PeriodSavings) DeepCopyInto(out *PeriodSavings) {
+	*out = *in
+	out.SavingsTotals = in.SavingsTotals
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PeriodSavings.
+func (in *PeriodSavings) DeepCopy() *PeriodSavings {
+	if in == nil {
+		return nil
+	}
+	out := new(PeriodSavings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PowerCapConfig) DeepCopyInto(out *PowerCapConfig) {
+	*out = *in
+	if in.IntensityThreshold != nil {
+		in, out := &in.IntensityThreshold, &out.IntensityThreshold
+		*out = new(string)
+		**out = **in
+	}
+	if in.MinCapPercent != nil {
+		in, out := &in.MinCapPercent, &out.MinCapPercent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.DominanceRatio != nil {
+		in, out := &in.DominanceRatio, &out.DominanceRatio
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PowerCapConfig.
+func (in *PowerCapConfig) DeepCopy() *PowerCapConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(PowerCapConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrecisionFault) DeepCopyInto(out *PrecisionFault) {
+	*out = *in
+	if in.Delay != nil {
+		in, out := &in.Delay, &out.Delay
+		*out = new(FaultDelay)
+		**out = **in
+	}
+	if in.Abort != nil {
+		in, out := &in.Abort, &out.Abort
+		*out = new(FaultAbort)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrecisionFault.
+func (in *PrecisionFault) DeepCopy() *PrecisionFault {
+	if in == nil {
+		return nil
+	}
+	out := new(PrecisionFault)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrecisionOverride) DeepCopyInto(out *PrecisionOverride) {
+	*out = *in
+	if in.Precision != nil {
+		in, out := &in.Precision, &out.Precision
+		*out = new(int)
+		**out = **in
+	}
+	if in.Until != nil {
+		in, out := &in.Until, &out.Until
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrecisionOverride.
+func (in *PrecisionOverride) DeepCopy() *PrecisionOverride {
+	if in == nil {
+		return nil
+	}
+	out := new(PrecisionOverride)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrecisionResilience) DeepCopyInto(out *PrecisionResilience) {
+	*out = *in
+	in.RouteResilience.DeepCopyInto(&out.RouteResilience)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrecisionResilience.
+func (in *PrecisionResilience) DeepCopy() *PrecisionResilience {
+	if in == nil {
+		return nil
+	}
+	out := new(PrecisionResilience)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrecisionTrafficPolicy) DeepCopyInto(out *PrecisionTrafficPolicy) {
+	*out = *in
+	in.SubsetTrafficPolicy.DeepCopyInto(&out.SubsetTrafficPolicy)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrecisionTrafficPolicy.
+func (in *PrecisionTrafficPolicy) DeepCopy() *PrecisionTrafficPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(PrecisionTrafficPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PriorityClass) DeepCopyInto(out *PriorityClass) {
+	*out = *in
+	if in.Methods != nil {
+		in, out := &in.Methods, &out.Methods
+		*out = make([]HTTPMethod, len(*in))
+		copy(*out, *in)
+	}
+	if in.Path != nil {
+		in, out := &in.Path, &out.Path
+		*out = new(PathMatch)
+		**out = **in
+	}
+	if in.Headers != nil {
+		in, out := &in.Headers, &out.Headers
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PriorityClass.
+func (in *PriorityClass) DeepCopy() *PriorityClass {
+	if in == nil {
+		return nil
+	}
+	out := new(PriorityClass)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PropagationConfig) DeepCopyInto(out *PropagationConfig) {
+	*out = *in
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]MemberCluster, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PropagationConfig.
+func (in *PropagationConfig) DeepCopy() *PropagationConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(PropagationConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QueueTopologyConfig) DeepCopyInto(out *QueueTopologyConfig) {
+	*out = *in
+	if in.MaxAttempts != nil {
+		in, out := &in.MaxAttempts, &out.MaxAttempts
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MessageTTLSeconds != nil {
+		in, out := &in.MessageTTLSeconds, &out.MessageTTLSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxLength != nil {
+		in, out := &in.MaxLength, &out.MaxLength
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QueueTopologyConfig.
+func (in *QueueTopologyConfig) DeepCopy() *QueueTopologyConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(QueueTopologyConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RabbitMQClusterConfig) DeepCopyInto(out *RabbitMQClusterConfig) {
+	*out = *in
+	if in.Replicas != nil {
+		in, out := &in.Replicas, &out.Replicas
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(v1.ResourceRequirements)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RabbitMQClusterConfig.
+func (in *RabbitMQClusterConfig) DeepCopy() *RabbitMQClusterConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RabbitMQClusterConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RateLimitConfig) DeepCopyInto(out *RateLimitConfig) {
+	*out = *in
+	if in.ThrottleBelow != nil {
+		in, out := &in.ThrottleBelow, &out.ThrottleBelow
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RateLimitConfig.
+func (in *RateLimitConfig) DeepCopy() *RateLimitConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RateLimitConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RedisConfig) DeepCopyInto(out *RedisConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RedisConfig.
+func (in *RedisConfig) DeepCopy() *RedisConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RedisConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResilienceConfig) DeepCopyInto(out *ResilienceConfig) {
+	*out = *in
+	in.RouteResilience.DeepCopyInto(&out.RouteResilience)
+	if in.PerPrecision != nil {
+		in, out := &in.PerPrecision, &out.PerPrecision
+		*out = make([]PrecisionResilience, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResilienceConfig.
+func (in *ResilienceConfig) DeepCopy() *ResilienceConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ResilienceConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RetryConfig) DeepCopyInto(out *RetryConfig) {
+	*out = *in
+	if in.PerTryTimeoutSeconds != nil {
+		in, out := &in.PerTryTimeoutSeconds, &out.PerTryTimeoutSeconds
 		*out = new(int32)
 		**out = **in
 	}
-	if in.MaxReplicaCount != nil {
-		in, out := &in.MaxReplicaCount, &out.MaxReplicaCount
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RetryConfig.
+func (in *RetryConfig) DeepCopy() *RetryConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RetryConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RightsizingConfig) DeepCopyInto(out *RightsizingConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RightsizingConfig.
+func (in *RightsizingConfig) DeepCopy() *RightsizingConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RightsizingConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RouteResilience) DeepCopyInto(out *RouteResilience) {
+	*out = *in
+	if in.TimeoutSeconds != nil {
+		in, out := &in.TimeoutSeconds, &out.TimeoutSeconds
 		*out = new(int32)
 		**out = **in
 	}
-	if in.CooldownPeriod != nil {
-		in, out := &in.CooldownPeriod, &out.CooldownPeriod
+	if in.Retries != nil {
+		in, out := &in.Retries, &out.Retries
+		*out = new(RetryConfig)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RouteResilience.
+func (in *RouteResilience) DeepCopy() *RouteResilience {
+	if in == nil {
+		return nil
+	}
+	out := new(RouteResilience)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RoutingConfig) DeepCopyInto(out *RoutingConfig) {
+	*out = *in
+	if in.Gateways != nil {
+		in, out := &in.Gateways, &out.Gateways
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Hosts != nil {
+		in, out := &in.Hosts, &out.Hosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.HTTP3Port != nil {
+		in, out := &in.HTTP3Port, &out.HTTP3Port
 		*out = new(int32)
 		**out = **in
 	}
-	if in.CPUUtilization != nil {
-		in, out := &in.CPUUtilization, &out.CPUUtilization
+	in.ConnectionRebalancing.DeepCopyInto(&out.ConnectionRebalancing)
+	if in.ClientRules != nil {
+		in, out := &in.ClientRules, &out.ClientRules
+		*out = make([]ClientPrecisionRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RoutingRules != nil {
+		in, out := &in.RoutingRules, &out.RoutingRules
+		*out = make([]RoutingRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.MeshSecurity.DeepCopyInto(&out.MeshSecurity)
+	in.Sidecar.DeepCopyInto(&out.Sidecar)
+	out.SessionAffinity = in.SessionAffinity
+	if in.Mirror != nil {
+		in, out := &in.Mirror, &out.Mirror
+		*out = new(MirrorConfig)
+		**out = **in
+	}
+	if in.Resilience != nil {
+		in, out := &in.Resilience, &out.Resilience
+		*out = new(ResilienceConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TrafficPolicy != nil {
+		in, out := &in.TrafficPolicy, &out.TrafficPolicy
+		*out = new(TrafficPolicyConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.FaultInjection != nil {
+		in, out := &in.FaultInjection, &out.FaultInjection
+		*out = new(FaultInjectionConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RateLimit != nil {
+		in, out := &in.RateLimit, &out.RateLimit
+		*out = new(RateLimitConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Brownout != nil {
+		in, out := &in.Brownout, &out.Brownout
+		*out = new(BrownoutConfig)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RoutingConfig.
+func (in *RoutingConfig) DeepCopy() *RoutingConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(RoutingConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RoutingRule) DeepCopyInto(out *RoutingRule) {
+	*out = *in
+	if in.Path != nil {
+		in, out := &in.Path, &out.Path
+		*out = new(PathMatch)
+		**out = **in
+	}
+	if in.GRPC != nil {
+		in, out := &in.GRPC, &out.GRPC
+		*out = new(GRPCMethodMatch)
+		**out = **in
+	}
+	if in.Methods != nil {
+		in, out := &in.Methods, &out.Methods
+		*out = make([]HTTPMethod, len(*in))
+		copy(*out, *in)
+	}
+	if in.Precisions != nil {
+		in, out := &in.Precisions, &out.Precisions
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RoutingRule.
+func (in *RoutingRule) DeepCopy() *RoutingRule {
+	if in == nil {
+		return nil
+	}
+	out := new(RoutingRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SLOGuardConfig) DeepCopyInto(out *SLOGuardConfig) {
+	*out = *in
+	if in.Latency != nil {
+		in, out := &in.Latency, &out.Latency
+		*out = new(LatencySLO)
+		**out = **in
+	}
+	if in.Availability != nil {
+		in, out := &in.Availability, &out.Availability
+		*out = new(AvailabilitySLO)
+		**out = **in
+	}
+	if in.BurnRateThreshold != nil {
+		in, out := &in.BurnRateThreshold, &out.BurnRateThreshold
+		*out = new(string)
+		**out = **in
+	}
+	if in.WindowMinutes != nil {
+		in, out := &in.WindowMinutes, &out.WindowMinutes
+		*out = new(int32)
+		**out = **in
+	}
+	if in.HoldMinutes != nil {
+		in, out := &in.HoldMinutes, &out.HoldMinutes
+		*out = new(int32)
+		**out = **in
+	}
+	if in.BoostPercent != nil {
+		in, out := &in.BoostPercent, &out.BoostPercent
 		*out = new(int32)
 		**out = **in
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AutoscalingConfig.
-func (in *AutoscalingConfig) DeepCopy() *AutoscalingConfig {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SLOGuardConfig.
+func (in *SLOGuardConfig) DeepCopy() *SLOGuardConfig {
 	if in == nil {
 		return nil
 	}
-	out := new(AutoscalingConfig)
+	out := new(SLOGuardConfig)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ComponentConfig) DeepCopyInto(out *ComponentConfig) {
+func (in *SLOGuardStatus) DeepCopyInto(out *SLOGuardStatus) {
 	*out = *in
-	in.Autoscaling.DeepCopyInto(&out.Autoscaling)
-	in.Resources.DeepCopyInto(&out.Resources)
+	if in.InterveningSince != nil {
+		in, out := &in.InterveningSince, &out.InterveningSince
+		*out = new(metav1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HoldUntil != nil {
+		in, out := &in.HoldUntil, &out.HoldUntil
+		*out = new(metav1.Time)
+		(*in).DeepCopyInto(*out)
+	}
+	in.LastEvaluated.DeepCopyInto(&out.LastEvaluated)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComponentConfig.
-func (in *ComponentConfig) DeepCopy() *ComponentConfig {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SLOGuardStatus.
+func (in *SLOGuardStatus) DeepCopy() *SLOGuardStatus {
 	if in == nil {
 		return nil
 	}
-	out := new(ComponentConfig)
+	out := new(SLOGuardStatus)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *FlavourDecision) DeepCopyInto(out *FlavourDecision) {
+func (in *SQSConfig) DeepCopyInto(out *SQSConfig) {
 	*out = *in
+	if in.Queues != nil {
+		in, out := &in.Queues, &out.Queues
+		*out = make([]SQSQueue, len(*in))
+		copy(*out, *in)
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FlavourDecision.
-func (in *FlavourDecision) DeepCopy() *FlavourDecision {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SQSConfig.
+func (in *SQSConfig) DeepCopy() *SQSConfig {
 	if in == nil {
 		return nil
 	}
-	out := new(FlavourDecision)
+	out := new(SQSConfig)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ForecastSlot) DeepCopyInto(out *ForecastSlot) {
+func (in *SQSQueue) DeepCopyInto(out *SQSQueue) {
 	*out = *in
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ForecastSlot.
-func (in *ForecastSlot) DeepCopy() *ForecastSlot {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SQSQueue.
+func (in *SQSQueue) DeepCopy() *SQSQueue {
 	if in == nil {
 		return nil
 	}
-	out := new(ForecastSlot)
+	out := new(SQSQueue)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SavingsTotals) DeepCopyInto(out *SavingsTotals) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SavingsTotals.
+func (in *SavingsTotals) DeepCopy() *SavingsTotals {
+	if in == nil {
+		return nil
+	}
+	out := new(SavingsTotals)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScaleCoordinationConfig) DeepCopyInto(out *ScaleCoordinationConfig) {
+	*out = *in
+	if in.RelaxationSpreadSeconds != nil {
+		in, out := &in.RelaxationSpreadSeconds, &out.RelaxationSpreadSeconds
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScaleCoordinationConfig.
+func (in *ScaleCoordinationConfig) DeepCopy() *ScaleCoordinationConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ScaleCoordinationConfig)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -159,6 +2188,11 @@ func (in *SchedulerConfigSpec) DeepCopyInto(out *SchedulerConfigSpec) {
 		*out = new(int32)
 		**out = **in
 	}
+	if in.CarbonProviderSecretRef != nil {
+		in, out := &in.CarbonProviderSecretRef, &out.CarbonProviderSecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
 	if in.ThrottleMin != nil {
 		in, out := &in.ThrottleMin, &out.ThrottleMin
 		*out = new(string)
@@ -174,6 +2208,21 @@ func (in *SchedulerConfigSpec) DeepCopyInto(out *SchedulerConfigSpec) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.Evaluator != nil {
+		in, out := &in.Evaluator, &out.Evaluator
+		*out = new(string)
+		**out = **in
+	}
+	if in.FallbackGraceSeconds != nil {
+		in, out := &in.FallbackGraceSeconds, &out.FallbackGraceSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Auth != nil {
+		in, out := &in.Auth, &out.Auth
+		*out = new(EngineAuthConfig)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SchedulerConfigSpec.
@@ -186,10 +2235,118 @@ func (in *SchedulerConfigSpec) DeepCopy() *SchedulerConfigSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceSavings) DeepCopyInto(out *ServiceSavings) {
+	*out = *in
+	out.SavingsTotals = in.SavingsTotals
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceSavings.
+func (in *ServiceSavings) DeepCopy() *ServiceSavings {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceSavings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ServiceSelector) DeepCopyInto(out *ServiceSelector) {
+	*out = *in
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceSelector.
+func (in *ServiceSelector) DeepCopy() *ServiceSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(ServiceSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SessionAffinityConfig) DeepCopyInto(out *SessionAffinityConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SessionAffinityConfig.
+func (in *SessionAffinityConfig) DeepCopy() *SessionAffinityConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(SessionAffinityConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SidecarConfig) DeepCopyInto(out *SidecarConfig) {
+	*out = *in
+	if in.Inject != nil {
+		in, out := &in.Inject, &out.Inject
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SidecarConfig.
+func (in *SidecarConfig) DeepCopy() *SidecarConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(SidecarConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SubsetTrafficPolicy) DeepCopyInto(out *SubsetTrafficPolicy) {
+	*out = *in
+	if in.ConnectionPool != nil {
+		in, out := &in.ConnectionPool, &out.ConnectionPool
+		*out = new(ConnectionPoolConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OutlierDetection != nil {
+		in, out := &in.OutlierDetection, &out.OutlierDetection
+		*out = new(OutlierDetectionConfig)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SubsetTrafficPolicy.
+func (in *SubsetTrafficPolicy) DeepCopy() *SubsetTrafficPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(SubsetTrafficPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TargetConfig) DeepCopyInto(out *TargetConfig) {
 	*out = *in
 	in.Autoscaling.DeepCopyInto(&out.Autoscaling)
+	if in.PerFlavour != nil {
+		in, out := &in.PerFlavour, &out.PerFlavour
+		*out = make([]FlavourAutoscaling, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TargetConfig.
@@ -202,6 +2359,29 @@ func (in *TargetConfig) DeepCopy() *TargetConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrafficPolicyConfig) DeepCopyInto(out *TrafficPolicyConfig) {
+	*out = *in
+	in.SubsetTrafficPolicy.DeepCopyInto(&out.SubsetTrafficPolicy)
+	if in.PerPrecision != nil {
+		in, out := &in.PerPrecision, &out.PerPrecision
+		*out = make([]PrecisionTrafficPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficPolicyConfig.
+func (in *TrafficPolicyConfig) DeepCopy() *TrafficPolicyConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(TrafficPolicyConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TrafficSchedule) DeepCopyInto(out *TrafficSchedule) {
 	*out = *in
@@ -268,6 +2448,21 @@ func (in *TrafficScheduleSpec) DeepCopyInto(out *TrafficScheduleSpec) {
 	in.Router.DeepCopyInto(&out.Router)
 	in.Consumer.DeepCopyInto(&out.Consumer)
 	in.Scheduler.DeepCopyInto(&out.Scheduler)
+	in.ScaleCoordination.DeepCopyInto(&out.ScaleCoordination)
+	in.Concurrency.DeepCopyInto(&out.Concurrency)
+	in.ForecastScaling.DeepCopyInto(&out.ForecastScaling)
+	out.Rightsizing = in.Rightsizing
+	in.EnergyCalibration.DeepCopyInto(&out.EnergyCalibration)
+	in.PowerCap.DeepCopyInto(&out.PowerCap)
+	in.AutoscalerHints.DeepCopyInto(&out.AutoscalerHints)
+	in.Locality.DeepCopyInto(&out.Locality)
+	in.Attribution.DeepCopyInto(&out.Attribution)
+	in.Routing.DeepCopyInto(&out.Routing)
+	in.Identity.DeepCopyInto(&out.Identity)
+	in.Broker.DeepCopyInto(&out.Broker)
+	in.Chaos.DeepCopyInto(&out.Chaos)
+	in.Propagation.DeepCopyInto(&out.Propagation)
+	in.ServiceSelector.DeepCopyInto(&out.ServiceSelector)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficScheduleSpec.
@@ -296,6 +2491,13 @@ func (in *TrafficScheduleStatus) DeepCopyInto(out *TrafficScheduleStatus) {
 			(*out)[key] = val
 		}
 	}
+	if in.ZoneForecasts != nil {
+		in, out := &in.ZoneForecasts, &out.ZoneForecasts
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.ForecastSchedule != nil {
 		in, out := &in.ForecastSchedule, &out.ForecastSchedule
 		*out = make([]ForecastSlot, len(*in))
@@ -308,6 +2510,23 @@ func (in *TrafficScheduleStatus) DeepCopyInto(out *TrafficScheduleStatus) {
 			(*out)[key] = val
 		}
 	}
+	if in.LastKnownGood != nil {
+		in, out := &in.LastKnownGood, &out.LastKnownGood
+		*out = new(LastKnownGoodSchedule)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Savings != nil {
+		in, out := &in.Savings, &out.Savings
+		*out = new(CarbonSavings)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficScheduleStatus.
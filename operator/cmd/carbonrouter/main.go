@@ -0,0 +1,267 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+	istionet "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	istiosecurity "istio.io/client-go/pkg/apis/security/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/yaml"
+
+	kedav1alpha1 "github.com/kedacore/keda/v2/apis/keda/v1alpha1"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/controller"
+)
+
+const usage = `Usage: carbonrouter render -f <manifests> [flags]
+       carbonrouter verify-decision-log -key-file <key> <files or directories>...
+
+render renders the resources the operator would create for the routed Services
+in the manifests (TrafficSchedules with their status, Services,
+CarbonRoutedServices and precision Deployments) as YAML on stdout.
+
+verify-decision-log checks the signatures and the chain of a decision log
+exported with --decision-log, reading directories in file name order.
+`
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(istionet.AddToScheme(scheme))
+	utilruntime.Must(istiosecurity.AddToScheme(scheme))
+	utilruntime.Must(schedulingv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(kedav1alpha1.AddToScheme(scheme))
+}
+
+// fileFlags collects the repeatable -f flag.
+type fileFlags []string
+
+func (f *fileFlags) String() string { return strings.Join(*f, ",") }
+
+func (f *fileFlags) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "render":
+		err = render(os.Args[2:], os.Stdout)
+	case "verify-decision-log":
+		err = verifyDecisionLog(os.Args[2:], os.Stdout)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func verifyDecisionLog(args []string, out io.Writer) error {
+	var keyFile string
+	fs := flag.NewFlagSet("verify-decision-log", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&keyFile, "key-file", "", "File holding the HMAC key the operator signs the decision log with.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if keyFile == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("a key file and at least one log are needed")
+	}
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return err
+	}
+	var readers []io.Reader
+	for _, path := range fs.Args() {
+		paths := []string{path}
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			if paths, err = filepath.Glob(filepath.Join(path, "*.jsonl")); err != nil {
+				return err
+			}
+			slices.Sort(paths)
+		}
+		for _, path := range paths {
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			readers = append(readers, file)
+		}
+	}
+	count, err := controller.VerifyDecisionLog(io.MultiReader(readers...), []byte(strings.TrimSpace(string(key))))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%d decisions verified\n", count)
+	return nil
+}
+
+func render(args []string, out io.Writer) error {
+	var files fileFlags
+	var opts renderOptions
+	var maxServices, maxPrecisions int
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	fs.Var(&files, "f", "Manifest file or directory of .yaml/.yml/.json files; repeatable, - reads stdin.")
+	fs.StringVar(&opts.RoutingBackend, "routing-backend", controller.RoutingBackendIstio,
+		"Routing backend of Services without the carbonrouter.io/routing-backend annotation: istio, gateway-api or linkerd.")
+	fs.StringVar(&opts.KillSwitchNamespace, "operator-namespace", "carbonrouter-system",
+		"Namespace of the carbonrouter-kill-switch ConfigMap, if one is among the manifests.")
+	fs.BoolVar(&opts.NetworkPolicies, "network-policies", false, "Same as the operator flag.")
+	fs.StringVar(&opts.IstioRevision, "istio-revision", "default", "Same as the operator flag.")
+	fs.IntVar(&maxServices, "max-services-per-namespace", 0, "Same as the operator flag. 0 means unlimited.")
+	fs.IntVar(&maxPrecisions, "max-precisions-per-service", 0, "Same as the operator flag. 0 means unlimited.")
+	logOpts := zap.Options{Level: zapcore.ErrorLevel}
+	logOpts.BindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&logOpts)))
+	if len(files) == 0 {
+		fs.Usage()
+		return errors.New("no manifests given")
+	}
+	if !slices.Contains(controller.RoutingBackends, opts.RoutingBackend) {
+		return fmt.Errorf("unknown routing backend %q, expected one of %v", opts.RoutingBackend, controller.RoutingBackends)
+	}
+	opts.EnrollmentLimits = controller.EnrollmentLimits{MaxServicesPerNamespace: maxServices, MaxPrecisionsPerService: maxPrecisions}
+
+	var objs []client.Object
+	for _, path := range files {
+		decoded, err := readManifests(path)
+		if err != nil {
+			return err
+		}
+		objs = append(objs, decoded...)
+	}
+	rendered, err := renderServices(context.Background(), scheme, objs, opts)
+	// Whatever rendered is still printed, so one broken Service does not hide the others
+	for _, obj := range rendered {
+		doc, marshalErr := yaml.Marshal(obj.Object)
+		if marshalErr != nil {
+			return marshalErr
+		}
+		fmt.Fprintf(out, "---\n%s", doc)
+	}
+	return err
+}
+
+// readManifests decodes the objects of a file, of every manifest in a
+// directory, or of stdin for "-".
+func readManifests(path string) ([]client.Object, error) {
+	if path == "-" {
+		return decodeManifests(os.Stdin, "stdin")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		paths = paths[:0]
+		for _, entry := range entries {
+			switch filepath.Ext(entry.Name()) {
+			case ".yaml", ".yml", ".json":
+				if !entry.IsDir() {
+					paths = append(paths, filepath.Join(path, entry.Name()))
+				}
+			}
+		}
+	}
+	var objs []client.Object
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := decodeManifests(f, p)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, decoded...)
+	}
+	return objs, nil
+}
+
+func decodeManifests(r io.Reader, source string) ([]client.Object, error) {
+	decoder := k8syaml.NewYAMLOrJSONDecoder(r, 4096)
+	deserializer := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+	var objs []client.Object
+	for {
+		var raw runtime.RawExtension
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objs, nil
+			}
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		if len(bytes.TrimSpace(raw.Raw)) == 0 || bytes.Equal(bytes.TrimSpace(raw.Raw), []byte("null")) {
+			continue
+		}
+		obj, _, err := deserializer.Decode(raw.Raw, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		cobj, ok := obj.(client.Object)
+		if !ok {
+			return nil, fmt.Errorf("%s: %T is not a Kubernetes object", source, obj)
+		}
+		objs = append(objs, cobj)
+	}
+}
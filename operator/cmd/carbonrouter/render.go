@@ -0,0 +1,208 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/controller"
+)
+
+// renderOptions mirror the operator flags that change the rendered resources.
+type renderOptions struct {
+	RoutingBackend      string
+	KillSwitchNamespace string
+	EnrollmentLimits    controller.EnrollmentLimits
+	NetworkPolicies     bool
+	IstioRevision       string
+}
+
+// renderServices returns the resources the FlavourRouter reconciler would
+// apply for the routed Services among objs, in the order it applies them. The
+// reconciler runs against an in-memory client seeded with objs, so the
+// TrafficSchedules must carry the status to render (e.g. captured with kubectl
+// get -o yaml) and the precision Deployments of each Service must be part of
+// objs.
+func renderServices(ctx context.Context, scheme *runtime.Scheme, objs []client.Object, opts renderOptions) ([]*unstructured.Unstructured, error) {
+	inputs := map[string]struct{}{}
+	var services []types.NamespacedName
+	for _, obj := range objs {
+		key, err := renderKey(obj, scheme)
+		if err != nil {
+			return nil, err
+		}
+		inputs[key] = struct{}{}
+		if _, ok := obj.(*corev1.Service); ok {
+			services = append(services, client.ObjectKeyFromObject(obj))
+		}
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].String() < services[j].String() })
+	// The enrollment limits read the Namespaces, which fixtures seldom include
+	for _, obj := range slices.Clone(objs) {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: obj.GetNamespace()}}
+		key, err := renderKey(ns, scheme)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := inputs[key]; ok || ns.Name == "" {
+			continue
+		}
+		inputs[key] = struct{}{}
+		objs = append(objs, ns)
+	}
+
+	rendered := &renderSink{scheme: scheme, inputs: inputs, index: map[string]int{}}
+	c := interceptor.NewClient(fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objs...).
+		WithStatusSubresource(&corev1.Service{}, &schedulingv1alpha1.CarbonRoutedService{}).
+		Build(), rendered.funcs())
+	r := &controller.FlavourRouterReconciler{
+		Client:              c,
+		Scheme:              scheme,
+		KillSwitchNamespace: opts.KillSwitchNamespace,
+		EnrollmentLimits:    opts.EnrollmentLimits,
+		RoutingBackend:      opts.RoutingBackend,
+		NetworkPolicies:     opts.NetworkPolicies,
+		OperatorNamespace:   opts.KillSwitchNamespace,
+		IstioRevision:       opts.IstioRevision,
+		Offline:             true,
+	}
+
+	var errs []error
+	for _, key := range services {
+		var svc corev1.Service
+		if err := c.Get(ctx, key, &svc); err != nil {
+			return nil, err
+		}
+		enrolled, err := controller.Enrolled(ctx, c, &svc)
+		if err != nil {
+			return nil, err
+		}
+		if !enrolled {
+			continue
+		}
+		before := len(rendered.objects)
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			errs = append(errs, fmt.Errorf("service %s: %w", key, err))
+			continue
+		}
+		// Failures the reconciler does not retry only show in the condition
+		if err := c.Get(ctx, key, &svc); err != nil {
+			return nil, err
+		}
+		if cond := meta.FindStatusCondition(svc.Status.Conditions, controller.ConditionReconciled); cond != nil && cond.Status != "True" {
+			errs = append(errs, fmt.Errorf("service %s: %s: %s", key, cond.Reason, cond.Message))
+			continue
+		}
+		if len(rendered.objects) == before {
+			errs = append(errs, fmt.Errorf("service %s: nothing to render, it needs a TrafficSchedule with status.flavours and a Deployment per precision", key))
+		}
+	}
+	return rendered.objects, errors.Join(errs...)
+}
+
+// renderSink collects the objects written by the reconciler. Server-side
+// applies, which the fake client does not support, only reach the sink.
+type renderSink struct {
+	scheme  *runtime.Scheme
+	inputs  map[string]struct{}
+	index   map[string]int
+	objects []*unstructured.Unstructured
+}
+
+func (s *renderSink) funcs() interceptor.Funcs {
+	return interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			if err := s.record(obj); err != nil {
+				return err
+			}
+			return c.Create(ctx, obj, opts...)
+		},
+		Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+			if err := s.record(obj); err != nil {
+				return err
+			}
+			return c.Update(ctx, obj, opts...)
+		},
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if patch.Type() == types.ApplyPatchType {
+				return s.record(obj)
+			}
+			return c.Patch(ctx, obj, patch, opts...)
+		},
+	}
+}
+
+// record keeps the last write of every object that is not an input, without
+// the fields the API server would fill in.
+func (s *renderSink) record(obj client.Object) error {
+	key, err := renderKey(obj, s.scheme)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.inputs[key]; ok {
+		return nil
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	out := &unstructured.Unstructured{Object: content}
+	gvk, err := apiutil.GVKForObject(obj, s.scheme)
+	if err != nil {
+		return err
+	}
+	out.SetGroupVersionKind(gvk)
+	out.SetResourceVersion("")
+	unstructured.RemoveNestedField(out.Object, "metadata", "creationTimestamp")
+	if status, ok := out.Object["status"].(map[string]interface{}); ok && len(status) == 0 {
+		delete(out.Object, "status")
+	}
+	if i, ok := s.index[key]; ok {
+		s.objects[i] = out
+		return nil
+	}
+	s.index[key] = len(s.objects)
+	s.objects = append(s.objects, out)
+	return nil
+}
+
+func renderKey(obj client.Object, scheme *runtime.Scheme) (string, error) {
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s/%s", gvk.GroupKind(), obj.GetNamespace(), obj.GetName()), nil
+}
@@ -0,0 +1,234 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	networkingkube "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	"sigs.k8s.io/yaml"
+)
+
+// fixture holds a cluster default schedule with its status, the opted-in
+// checkout Service with a Deployment per precision, and the cart Service
+// without any.
+var fixture = `apiVersion: scheduling.carbonrouter.io/v1alpha1
+kind: TrafficSchedule
+metadata:
+  name: default
+  namespace: carbonrouter-system
+spec:
+  router:
+    autoscaling: {minReplicaCount: 1, maxReplicaCount: 5, cpuUtilization: 70, cooldownPeriod: 60}
+  consumer:
+    autoscaling: {minReplicaCount: 1, maxReplicaCount: 5, cpuUtilization: 70, cooldownPeriod: 60}
+  target:
+    autoscaling: {minReplicaCount: 1, maxReplicaCount: 5, cpuUtilization: 70, cooldownPeriod: 60}
+  broker:
+    secretRef: {name: rabbitmq}
+status:
+  flavours:
+  - {precision: 100, weight: 30}
+  - {precision: 50, weight: 70}
+---
+apiVersion: v1
+kind: Secret
+metadata: {name: rabbitmq, namespace: shop}
+stringData: {username: shop, password: s3cret}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: checkout
+  namespace: shop
+  labels: {carbonrouter/enabled: "true"}
+spec:
+  selector: {app: checkout}
+  ports: [{name: http, port: 80}]
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: cart
+  namespace: shop
+  labels: {carbonrouter/enabled: "true"}
+spec:
+  selector: {app: cart}
+  ports: [{port: 80}]
+` + precisionDeployment + strings.ReplaceAll(precisionDeployment, "100", "50")
+
+const precisionDeployment = `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: checkout-precision-100
+  namespace: shop
+  labels: {carbonrouter/parent-service: checkout, carbonstat.precision: "100"}
+spec:
+  selector:
+    matchLabels: {app: checkout}
+  template:
+    metadata:
+      labels: {app: checkout}
+    spec:
+      containers: [{name: app, image: shop/checkout}]
+`
+
+// renderFixture renders manifests with args and returns the rendered documents
+// by kind and name.
+func renderFixture(t *testing.T, manifests string, args ...string) (map[string]string, error) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "shop.yaml"), []byte(manifests), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Directories are read for manifests only
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("# fixtures"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err := render(append(args, "-f", dir), &out)
+	docs := map[string]string{}
+	for _, doc := range strings.Split(out.String(), "---\n")[1:] {
+		var meta struct {
+			Kind     string `json:"kind"`
+			Metadata struct {
+				Name              string  `json:"name"`
+				ResourceVersion   string  `json:"resourceVersion"`
+				CreationTimestamp *string `json:"creationTimestamp"`
+			} `json:"metadata"`
+		}
+		if err := yaml.Unmarshal([]byte(doc), &meta); err != nil {
+			t.Fatal(err)
+		}
+		if meta.Metadata.ResourceVersion != "" || meta.Metadata.CreationTimestamp != nil {
+			t.Errorf("%s %s: got %+v, want the server-side fields dropped", meta.Kind, meta.Metadata.Name, meta.Metadata)
+		}
+		docs[meta.Kind+"/"+meta.Metadata.Name] = doc
+	}
+	return docs, err
+}
+
+func TestRender(t *testing.T) {
+	docs, err := renderFixture(t, fixture)
+	if err == nil || !strings.Contains(err.Error(), "service shop/cart: nothing to render") {
+		t.Errorf("got error %v, want shop/cart reported", err)
+	}
+	for _, key := range []string{
+		"Deployment/buffer-service-router-checkout", "ScaledObject/checkout-precision-50",
+		"DestinationRule/checkout-carbonrouter-dr", "VirtualService/checkout-carbonrouter-vs", "ConfigMap/carbonrouter-schedule",
+	} {
+		if _, ok := docs[key]; !ok {
+			t.Errorf("%s not rendered", key)
+		}
+	}
+	for _, input := range []string{"Service/checkout", "Deployment/checkout-precision-100", "TrafficSchedule/default", "Namespace/shop"} {
+		if _, ok := docs[input]; ok {
+			t.Errorf("input %s rendered", input)
+		}
+	}
+
+	var vs networkingkube.VirtualService
+	if err := yaml.Unmarshal([]byte(docs["VirtualService/checkout-carbonrouter-vs"]), &vs); err != nil {
+		t.Fatal(err)
+	}
+	routes := vs.Spec.Http
+	weights := map[string]int32{}
+	for _, destination := range routes[len(routes)-1].Route {
+		weights[destination.Destination.Subset] = destination.Weight
+	}
+	if weights["precision-100"] != 30 || weights["precision-50"] != 70 {
+		t.Errorf("got default route weights %v, want the schedule weights", weights)
+	}
+}
+
+func TestRenderRoutingBackend(t *testing.T) {
+	docs, _ := renderFixture(t, fixture, "-routing-backend", "gateway-api")
+	if _, ok := docs["HTTPRoute/checkout-carbonrouter"]; !ok {
+		t.Error("HTTPRoute not rendered")
+	}
+	if _, ok := docs["Service/checkout-precision-50"]; !ok {
+		t.Error("precision Service not rendered")
+	}
+	if _, ok := docs["VirtualService/checkout-carbonrouter-vs"]; ok {
+		t.Error("VirtualService rendered for the gateway-api backend")
+	}
+
+	docs, _ = renderFixture(t, fixture, "-routing-backend", "linkerd")
+	var route struct {
+		APIVersion string `json:"apiVersion"`
+		Spec       struct {
+			ParentRefs []struct {
+				Group string `json:"group"`
+				Kind  string `json:"kind"`
+			} `json:"parentRefs"`
+		} `json:"spec"`
+	}
+	if err := yaml.Unmarshal([]byte(docs["HTTPRoute/checkout-carbonrouter"]), &route); err != nil {
+		t.Fatal(err)
+	}
+	if route.APIVersion != "policy.linkerd.io/v1beta3" || len(route.Spec.ParentRefs) != 1 || route.Spec.ParentRefs[0].Group != "core" {
+		t.Errorf("got %+v, want a Linkerd HTTPRoute attached to the core Service", route)
+	}
+
+	if _, err := renderFixture(t, fixture, "-routing-backend", "nginx"); err == nil || !strings.Contains(err.Error(), `unknown routing backend "nginx"`) {
+		t.Errorf("got %v, want the unknown backend rejected", err)
+	}
+}
+
+func TestRenderQueueOnly(t *testing.T) {
+	queueOnly := strings.Replace(fixture, "name: checkout\n  namespace: shop\n", "name: checkout\n  namespace: shop\n  annotations: {carbonrouter.io/routing-mode: none}\n", 1)
+	docs, _ := renderFixture(t, queueOnly)
+	for _, key := range []string{"Deployment/buffer-service-consumer-checkout", "ScaledObject/checkout-precision-50"} {
+		if _, ok := docs[key]; !ok {
+			t.Errorf("%s not rendered", key)
+		}
+	}
+	for _, key := range []string{"VirtualService/checkout-carbonrouter-vs", "DestinationRule/checkout-carbonrouter-dr"} {
+		if _, ok := docs[key]; ok {
+			t.Errorf("%s rendered for a queue-only Service", key)
+		}
+	}
+}
+
+func TestDecodeManifests(t *testing.T) {
+	manifests := `---
+# comments and empty documents are skipped
+---
+{"apiVersion": "v1", "kind": "Namespace", "metadata": {"name": "shop"}}
+---
+apiVersion: v1
+kind: Service
+metadata: {name: checkout, namespace: shop}
+`
+	objs, err := decodeManifests(strings.NewReader(manifests), "shop.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 2 || objs[0].GetName() != "shop" || objs[1].GetName() != "checkout" {
+		t.Errorf("got %v, want the Namespace and the Service", objs)
+	}
+
+	_, err = decodeManifests(strings.NewReader("apiVersion: example.com/v1\nkind: Widget\nmetadata: {name: w}\n"), "widget.yaml")
+	if err == nil || !strings.HasPrefix(err.Error(), "widget.yaml: ") {
+		t.Errorf("got %v, want the unknown kind reported with its source", err)
+	}
+}
@@ -0,0 +1,430 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-carbonrouter is the kubectl plugin of carbonrouter. Installed on the
+// PATH, it runs as "kubectl carbonrouter".
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const usage = `Usage: kubectl carbonrouter <command> <service> [flags]
+
+Commands:
+  status <service>    Routing state of a routed Service: bound schedule, active
+                      weights, replica ceilings, queue depths and conditions.
+  pause <service>     Suspend carbon-aware routing, sending all the traffic of
+                      the Service to its highest precision until resumed.
+  resume <service>    Hand the Service back to its schedule.
+  override <service>  Pin the traffic of the Service to --precision, for
+                      --duration or until resumed.
+  savings <service>   Estimated carbon cost per request under the current
+                      weights against always serving full precision, and the
+                      carbon avoided as accounted in the bound schedule.
+
+pause and override set spec.override of the CarbonRoutedService of the
+Service, and resume clears it.
+
+Flags:
+`
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(schedulingv1alpha1.AddToScheme(scheme))
+}
+
+// options are the flags of every command.
+type options struct {
+	namespace  string
+	kubeconfig string
+	context    string
+	reason     string
+	precision  int
+	duration   time.Duration
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	command := os.Args[1]
+	commands := map[string]func(context.Context, client.Client, string, string, options, io.Writer) error{
+		"status":   status,
+		"pause":    pause,
+		"resume":   resume,
+		"override": override,
+		"savings":  savings,
+	}
+	run, ok := commands[command]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	err := func() error {
+		var opts options
+		fs := flag.NewFlagSet(command, flag.ExitOnError)
+		fs.Usage = func() {
+			fmt.Fprint(fs.Output(), usage)
+			fs.PrintDefaults()
+		}
+		fs.StringVar(&opts.namespace, "namespace", "", "Namespace of the Service. Defaults to the one of the kubeconfig context.")
+		fs.StringVar(&opts.namespace, "n", "", "Shorthand for --namespace.")
+		fs.StringVar(&opts.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file.")
+		fs.StringVar(&opts.context, "context", "", "Name of the kubeconfig context to use.")
+		fs.StringVar(&opts.reason, "reason", "", "pause, override: why routing is overridden.")
+		fs.IntVar(&opts.precision, "precision", -1, "override: precision receiving all the traffic. Defaults to the highest.")
+		fs.DurationVar(&opts.duration, "duration", 0, "override: how long the override holds, e.g. 1h. 0 holds it until resumed.")
+		args, err := parseInterspersed(fs, os.Args[2:])
+		if err != nil {
+			return err
+		}
+		if len(args) != 1 {
+			fs.Usage()
+			return errors.New("expected exactly one Service name")
+		}
+		c, namespace, err := newClient(opts)
+		if err != nil {
+			return err
+		}
+		return run(context.Background(), c, namespace, args[0], opts, os.Stdout)
+	}()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", command, err)
+		os.Exit(1)
+	}
+}
+
+// parseInterspersed parses fs from flags placed before and after the
+// positional arguments, as kubectl does, and returns the latter.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// newClient connects like kubectl, through the kubeconfig and context given
+// or the defaults, and resolves the namespace of the command.
+func newClient(opts options) (client.Client, string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = opts.kubeconfig
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: opts.context})
+	config, err := loader.ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	namespace := opts.namespace
+	if namespace == "" {
+		if namespace, _, err = loader.Namespace(); err != nil {
+			return nil, "", err
+		}
+	}
+	c, err := client.New(config, client.Options{Scheme: scheme})
+	return c, namespace, err
+}
+
+// routedService returns the CarbonRoutedService of the Service namespace/name:
+// the oldest one naming it, as the operator picks.
+func routedService(ctx context.Context, c client.Reader, namespace, name string) (*schedulingv1alpha1.CarbonRoutedService, error) {
+	var list schedulingv1alpha1.CarbonRoutedServiceList
+	if err := c.List(ctx, &list, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	var routed *schedulingv1alpha1.CarbonRoutedService
+	for i := range list.Items {
+		crs := &list.Items[i]
+		if crs.Spec.ServiceName != name || !crs.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if routed == nil || crs.CreationTimestamp.Before(&routed.CreationTimestamp) {
+			routed = crs
+		}
+	}
+	if routed == nil {
+		return nil, fmt.Errorf("no CarbonRoutedService routes the Service %s/%s", namespace, name)
+	}
+	return routed, nil
+}
+
+func status(ctx context.Context, c client.Client, namespace, name string, _ options, out io.Writer) error {
+	routed, err := routedService(ctx, c, namespace, name)
+	if err != nil {
+		return err
+	}
+	st := routed.Status
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Service:\t%s/%s (CarbonRoutedService %s)\n", namespace, name, routed.Name)
+	schedule := st.Schedule
+	if schedule == "" {
+		schedule = "<none bound>"
+	} else if st.ScheduleScope != "" {
+		schedule += " (" + st.ScheduleScope + ")"
+	}
+	fmt.Fprintf(w, "Schedule:\t%s\n", schedule)
+	if len(st.Overrides) > 0 {
+		fmt.Fprintf(w, "Overrides:\t%s\n", strings.Join(st.Overrides, ", "))
+	}
+	if routed.Spec.Override != nil {
+		fmt.Fprintf(w, "Override:\t%s\n", describeOverride(routed.Spec.Override))
+	}
+	if st.DeadLetteredRequests > 0 {
+		fmt.Fprintf(w, "Dead letters:\t%d\n", st.DeadLetteredRequests)
+	}
+	if burst := st.BurstReserve; burst != nil {
+		fmt.Fprintf(w, "Burst reserve:\t%s, %d%% of the backlog drained\n", burst.Phase, burst.DrainedPercent)
+	}
+	if guard := st.SLOGuard; guard != nil {
+		state := "watching"
+		if guard.Intervening {
+			state = fmt.Sprintf("intervening (%s) until %s: %s", guard.Action, guard.HoldUntil.Format(time.RFC3339), guard.Reason)
+		}
+		fmt.Fprintf(w, "SLO guard:\t%s, burn rates latency %s availability %s, %d interventions\n",
+			state, orDash(guard.LatencyBurnRate), orDash(guard.AvailabilityBurnRate), guard.Interventions)
+	}
+	if !st.LastUpdated.IsZero() {
+		fmt.Fprintf(w, "Last updated:\t%s\n", st.LastUpdated.Format(time.RFC3339))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(w, "PRECISION\tWEIGHT\tEMISSIONS\tQUEUE DEPTH")
+	for _, flavour := range st.ActiveWeights {
+		depth := "-"
+		if value, ok := st.QueueDepths[fmt.Sprintf("precision-%d", flavour.Precision)]; ok {
+			depth = strconv.FormatInt(value, 10)
+		}
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\n", flavour.Precision, flavour.Weight, orDash(flavour.Emissions), depth)
+	}
+	if len(st.ReplicaCeilings) > 0 {
+		fmt.Fprintln(w, "\nCOMPONENT\tREPLICA CEILING")
+		for _, component := range sortedKeys(st.ReplicaCeilings) {
+			fmt.Fprintf(w, "%s\t%d\n", component, st.ReplicaCeilings[component])
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	// The operator reports its reconciliation on the Service itself
+	var svc corev1.Service
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &svc); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if len(svc.Status.Conditions) > 0 {
+		fmt.Fprintln(w, "\nCONDITION\tSTATUS\tREASON\tMESSAGE")
+		for _, cond := range svc.Status.Conditions {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", cond.Type, cond.Status, cond.Reason, cond.Message)
+		}
+	}
+	return w.Flush()
+}
+
+func describeOverride(override *schedulingv1alpha1.PrecisionOverride) string {
+	precision := "highest precision"
+	if override.Precision != nil {
+		precision = fmt.Sprintf("precision %d", *override.Precision)
+	}
+	until := "until resumed"
+	if override.Until != nil {
+		until = "until " + override.Until.Format(time.RFC3339)
+		if !time.Now().Before(override.Until.Time) {
+			until = "lapsed at " + override.Until.Format(time.RFC3339)
+		}
+	}
+	description := precision + ", " + until
+	if override.Reason != "" {
+		description += " (" + override.Reason + ")"
+	}
+	return description
+}
+
+func pause(ctx context.Context, c client.Client, namespace, name string, opts options, out io.Writer) error {
+	return setOverride(ctx, c, namespace, name, &schedulingv1alpha1.PrecisionOverride{Reason: opts.reason}, out)
+}
+
+func override(ctx context.Context, c client.Client, namespace, name string, opts options, out io.Writer) error {
+	spec := &schedulingv1alpha1.PrecisionOverride{Reason: opts.reason}
+	if opts.precision >= 0 {
+		if opts.precision > 100 {
+			return fmt.Errorf("--precision %d is not between 0 and 100", opts.precision)
+		}
+		spec.Precision = &opts.precision
+	}
+	if opts.duration < 0 {
+		return fmt.Errorf("--duration %s is negative", opts.duration)
+	}
+	if opts.duration > 0 {
+		until := metav1.NewTime(time.Now().Add(opts.duration).Truncate(time.Second))
+		spec.Until = &until
+	}
+	return setOverride(ctx, c, namespace, name, spec, out)
+}
+
+func resume(ctx context.Context, c client.Client, namespace, name string, _ options, out io.Writer) error {
+	return setOverride(ctx, c, namespace, name, nil, out)
+}
+
+// setOverride replaces spec.override of the CarbonRoutedService of the Service,
+// clearing it when spec is nil.
+func setOverride(ctx context.Context, c client.Client, namespace, name string, spec *schedulingv1alpha1.PrecisionOverride, out io.Writer) error {
+	routed, err := routedService(ctx, c, namespace, name)
+	if err != nil {
+		return err
+	}
+	if spec == nil && routed.Spec.Override == nil {
+		fmt.Fprintf(out, "%s/%s follows its schedule already\n", namespace, name)
+		return nil
+	}
+	patch := client.MergeFrom(routed.DeepCopy())
+	routed.Spec.Override = spec
+	if err := c.Patch(ctx, routed, patch); err != nil {
+		return err
+	}
+	if spec == nil {
+		fmt.Fprintf(out, "%s/%s resumed, routing follows its schedule\n", namespace, name)
+		return nil
+	}
+	fmt.Fprintf(out, "%s/%s overridden: %s\n", namespace, name, describeOverride(spec))
+	return nil
+}
+
+// savings compares the carbon cost per request of the active weights of the
+// Service, from the emissions the schedule reports per precision, with the
+// one of serving every request at the highest precision, then prints the
+// savings the operator accounted in the status of the bound schedule.
+func savings(ctx context.Context, c client.Client, namespace, name string, _ options, out io.Writer) error {
+	routed, err := routedService(ctx, c, namespace, name)
+	if err != nil {
+		return err
+	}
+	var baseline, weighted, total float64
+	highest := -1
+	for _, flavour := range routed.Status.ActiveWeights {
+		emissions, err := strconv.ParseFloat(flavour.Emissions, 64)
+		if err != nil {
+			return fmt.Errorf("schedule %s reports no emissions for precision %d", routed.Status.Schedule, flavour.Precision)
+		}
+		if flavour.Precision > highest {
+			highest, baseline = flavour.Precision, emissions
+		}
+		weighted += float64(flavour.Weight) * emissions
+		total += float64(flavour.Weight)
+	}
+	if highest < 0 || total == 0 {
+		return fmt.Errorf("%s/%s has no active weights yet", namespace, name)
+	}
+	current := weighted / total
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Full precision (%d):\t%.4f gCO2eq/request\n", highest, baseline)
+	fmt.Fprintf(w, "Current weights:\t%.4f gCO2eq/request\n", current)
+	saved := baseline - current
+	if baseline > 0 {
+		fmt.Fprintf(w, "Savings:\t%.4f gCO2eq/request (%.1f%%)\n", saved, 100*saved/baseline)
+	} else {
+		fmt.Fprintf(w, "Savings:\t%.4f gCO2eq/request\n", saved)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	scheduleNamespace, scheduleName, ok := strings.Cut(routed.Status.Schedule, "/")
+	if !ok {
+		return nil
+	}
+	var ts schedulingv1alpha1.TrafficSchedule
+	if err := c.Get(ctx, client.ObjectKey{Namespace: scheduleNamespace, Name: scheduleName}, &ts); err != nil {
+		return err
+	}
+	accounted := ts.Status.Savings
+	if accounted == nil {
+		fmt.Fprintf(out, "\nNo savings accounted in schedule %s yet\n", routed.Status.Schedule)
+		return nil
+	}
+	fmt.Fprintf(out, "\nAccounted from %s to %s:\n", accounted.WindowStart.Format(time.RFC3339), accounted.WindowEnd.Format(time.RFC3339))
+	fmt.Fprintln(w, "PERIOD\tREQUESTS\tBASELINE (gCO2eq)\tAVOIDED (gCO2eq)")
+	service := namespace + "/" + name
+	for _, entry := range accounted.Window {
+		if entry.Service == service {
+			printTotals(w, "window, "+name, entry.SavingsTotals)
+		}
+	}
+	for _, period := range accounted.Daily {
+		printTotals(w, period.Period, period.SavingsTotals)
+	}
+	for _, period := range accounted.Monthly {
+		printTotals(w, period.Period, period.SavingsTotals)
+	}
+	printTotals(w, "total", accounted.Total)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Days, months and total cover every Service of schedule %s.\n", routed.Status.Schedule)
+	return nil
+}
+
+func printTotals(w io.Writer, period string, totals schedulingv1alpha1.SavingsTotals) {
+	fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", period, totals.Requests, orDash(totals.BaselineGrams), orDash(totals.AvoidedGrams))
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func sortedKeys(m map[string]int32) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -19,18 +19,28 @@ package main
 import (
 	"crypto/tls"
 	"flag"
+	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
@@ -38,11 +48,16 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/apiserver"
 	"github.com/belgio99/k8s-carbonrouter/operator/internal/controller"
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/engine"
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/enginepb"
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/schedextender"
 
 	// +kubebuilder:scaffold:imports
 	kedav1alpha1 "github.com/kedacore/keda/v2/apis/keda/v1alpha1"
 	istionet "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	istiosecurity "istio.io/client-go/pkg/apis/security/v1"
 )
 
 var (
@@ -53,6 +68,7 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(istionet.AddToScheme(scheme))
+	utilruntime.Must(istiosecurity.AddToScheme(scheme))
 	utilruntime.Must(schedulingv1alpha1.AddToScheme(scheme))
 	utilruntime.Must(kedav1alpha1.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
@@ -65,12 +81,153 @@ func main() {
 	var webhookCertPath, webhookCertName, webhookCertKey string
 	var enableLeaderElection bool
 	var probeAddr string
+	var apiAddr string
+	var flapThreshold int
+	var flapWindow time.Duration
+	var enablePowerCap bool
+	var enableBatchDeferral bool
+	var schedulerExtender bool
+	var autoscalerHints bool
+	var autoscalerPriorityConfigMap string
+	var operatorNamespace, nodeAgentImage string
+	var engineMode, carbonAPIURL, electricityMapsURL, wattTimeURL string
+	var engineProtocol, engineGRPCAddress string
+	var engineURL, engineCAFile, engineCertPath, engineCertName, engineCertKey string
+	var engineTimeout time.Duration
+	var scheduleReceiver, engineEvents bool
+	var scheduleReceiverTokenFile, apiCertPath, apiCertName, apiCertKey string
+	var grafanaDashboards bool
+	var brokerAutoscaling bool
+	var brokerStatefulSet string
+	var brokerMinReplicas, brokerMaxReplicas, brokerBufferingMinReplicas, brokerBacklogPerReplica int
+	var maxServicesPerNamespace, maxPrecisionsPerService int
+	var routingBackend string
+	var networkPolicies bool
+	var istioRevision string
+	var precisionHintsTokenFile string
+	var deadLettersTokenFile string
+	var diagnosticsTokenFile string
+	var decisionLogTarget, decisionLogKeyFile string
+	var decisionLogRetention time.Duration
+	var sloGuardPrometheusURL string
+	var keplerPrometheusURL string
 	var secureMetrics bool
 	var enableHTTP2 bool
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.StringVar(&apiAddr, "api-bind-address", ":8082", "The address the operator API (inventory and "+
+		"diagnostics endpoints) binds to. Use 0 to disable it.")
+	flag.IntVar(&flapThreshold, "recreate-flap-threshold", 5,
+		"Number of recreations of an out-of-band deleted resource that marks its service as Degraded.")
+	flag.DurationVar(&flapWindow, "recreate-flap-window", 10*time.Minute,
+		"Time window over which resource recreations are counted for anti-flap detection.")
+	flag.BoolVar(&enablePowerCap, "enable-power-cap", false,
+		"Enable the node power-cap controller and its agent DaemonSet (opt-in per TrafficSchedule via spec.powerCap).")
+	flag.BoolVar(&enableBatchDeferral, "enable-batch-deferral", false,
+		"Defer the Jobs and CronJobs labelled carbonrouter/defer=true to green carbon windows.")
+	flag.BoolVar(&schedulerExtender, "scheduler-extender", false,
+		"Label nodes with the carbon intensity of their zone and serve POST /scheduler/prioritize on the operator API, "+
+			"a kube-scheduler extender placing the pods of precision Deployments on the greener nodes.")
+	flag.BoolVar(&autoscalerHints, "autoscaler-hints", false,
+		"Rank the node groups of the cluster-autoscaler priority expander by carbon intensity while schedules "+
+			"throttle processing (opt-in per TrafficSchedule via spec.autoscalerHints).")
+	flag.StringVar(&autoscalerPriorityConfigMap, "autoscaler-priority-configmap", "kube-system/cluster-autoscaler-priority-expander",
+		"Namespace/name of the priority expander ConfigMap read by the cluster-autoscaler.")
+	flag.StringVar(&operatorNamespace, "operator-namespace", "carbonrouter-system",
+		"Namespace where operator-managed cluster components (such as the power-cap agent) are deployed "+
+			"and where the carbonrouter-kill-switch ConfigMap is read from.")
+	flag.StringVar(&nodeAgentImage, "node-agent-image", "ghcr.io/belgio99/k8s-carbonrouter/operator:latest",
+		"Image providing the /power-agent binary used by the power-cap DaemonSet.")
+	flag.StringVar(&engineMode, "engine", "external",
+		"Decision engine computing the schedules: \"external\" calls the decision-engine service, "+
+			"\"embedded\" computes them inside the operator.")
+	flag.StringVar(&engineProtocol, "engine-protocol", "http",
+		"Protocol used to talk to the external decision engine: \"http\" polls its JSON API, "+
+			"\"grpc\" uses its gRPC API and receives schedule updates as a stream.")
+	flag.StringVar(&engineGRPCAddress, "engine-grpc-address", controller.DefaultEngineGRPCAddress,
+		"gRPC address of the external decision engine, used with --engine-protocol=grpc. "+
+			"TLS is used when --engine-ca-file or --engine-cert-path is set.")
+	flag.StringVar(&engineURL, "engine-url", controller.DefaultEngineURL,
+		"Base URL of the external decision engine, used with --engine-protocol=http. Use https:// for TLS.")
+	flag.DurationVar(&engineTimeout, "engine-timeout", controller.DefaultEngineTimeout,
+		"Timeout of a single HTTP call to the decision engine.")
+	flag.StringVar(&engineCAFile, "engine-ca-file", "",
+		"PEM bundle trusted for an https --engine-url on top of the system roots, "+
+			"e.g. mounted from a ConfigMap or Secret.")
+	flag.StringVar(&engineCertPath, "engine-cert-path", "",
+		"The directory that contains the client certificate presented to the decision engine for mutual TLS.")
+	flag.StringVar(&engineCertName, "engine-cert-name", "tls.crt", "The name of the engine client certificate file.")
+	flag.StringVar(&engineCertKey, "engine-cert-key", "tls.key", "The name of the engine client key file.")
+	flag.BoolVar(&scheduleReceiver, "schedule-receiver", false,
+		"Accept schedules pushed by the decision engine on POST /schedules/<namespace>/<name> of the operator API, "+
+			"applying them right away instead of at the next poll. Used with --engine-protocol=http.")
+	flag.BoolVar(&engineEvents, "engine-events", false,
+		"Subscribe to the server-sent schedule events of the decision engine, so new decisions are applied "+
+			"within seconds instead of at the next poll. Used with --engine-protocol=http; polling resumes "+
+			"while a subscription is down.")
+	flag.StringVar(&scheduleReceiverTokenFile, "schedule-receiver-token-file", "",
+		"File holding the bearer token the decision engine must send to the schedule receiver, "+
+			"e.g. mounted from a Secret. Required by --schedule-receiver.")
+	flag.StringVar(&apiCertPath, "api-cert-path", "",
+		"The directory that contains the operator API certificate. Set it to serve the operator API over HTTPS.")
+	flag.StringVar(&apiCertName, "api-cert-name", "tls.crt", "The name of the operator API certificate file.")
+	flag.StringVar(&apiCertKey, "api-cert-key", "tls.key", "The name of the operator API key file.")
+	flag.StringVar(&carbonAPIURL, "carbon-api-url", engine.DefaultCarbonAPIURL,
+		"Carbon intensity API queried by the embedded decision engine and for the schedules with spec.scheduler.carbonProvider carbonintensity, and by the CarbonIntensityProviders of that type without spec.endpoint.")
+	flag.StringVar(&electricityMapsURL, "electricitymaps-url", engine.DefaultElectricityMapsURL,
+		"Electricity Maps API queried for the schedules with spec.scheduler.carbonProvider electricitymaps, and by the CarbonIntensityProviders of that type without spec.endpoint.")
+	flag.StringVar(&wattTimeURL, "watttime-url", engine.DefaultWattTimeURL,
+		"WattTime API queried for the schedules with spec.scheduler.carbonProvider watttime, and by the CarbonIntensityProviders of that type without spec.endpoint.")
+	flag.BoolVar(&grafanaDashboards, "grafana-dashboards", false,
+		"Publish a Grafana dashboard ConfigMap (label grafana_dashboard=1) for every TrafficSchedule.")
+	flag.BoolVar(&brokerAutoscaling, "broker-autoscaling", false,
+		"Scale the RabbitMQ broker StatefulSet with KEDA on the messages buffered across all routed services.")
+	flag.StringVar(&brokerStatefulSet, "broker-statefulset", "carbonrouter-rabbitmq",
+		"Broker StatefulSet in --operator-namespace scaled by --broker-autoscaling.")
+	flag.IntVar(&brokerMinReplicas, "broker-min-replicas", 1, "Minimum broker replicas.")
+	flag.IntVar(&brokerMaxReplicas, "broker-max-replicas", 3, "Maximum broker replicas.")
+	flag.IntVar(&brokerBufferingMinReplicas, "broker-buffering-min-replicas", 2,
+		"Minimum broker replicas while a TrafficSchedule throttles processing.")
+	flag.IntVar(&brokerBacklogPerReplica, "broker-backlog-per-replica", 50000,
+		"Buffered messages per broker replica before scaling out.")
+	flag.IntVar(&maxServicesPerNamespace, "max-services-per-namespace", 0,
+		"Maximum Services routed per namespace, overridable with the carbonrouter.io/max-routed-services "+
+			"namespace annotation. 0 means unlimited.")
+	flag.IntVar(&maxPrecisionsPerService, "max-precisions-per-service", 0,
+		"Maximum precisions routed per Service, overridable with the carbonrouter.io/max-precisions "+
+			"namespace annotation. 0 means unlimited.")
+	flag.StringVar(&routingBackend, "routing-backend", controller.RoutingBackendIstio,
+		"Resources splitting the traffic of routed Services: \"istio\" renders VirtualServices and DestinationRules, "+
+			"\"gateway-api\" renders HTTPRoutes, \"linkerd\" renders policy.linkerd.io HTTPRoutes. Overridable per Service with the carbonrouter.io/routing-backend annotation.")
+	flag.BoolVar(&networkPolicies, "network-policies", false,
+		"Restrict the router and consumer pods of every routed Service with a NetworkPolicy letting them reach only "+
+			"DNS, the API server, the broker and, for the consumers, the target pods and istiod.")
+	flag.StringVar(&istioRevision, "istio-revision", "default",
+		"istio.io/rev label of the consumer pods, a revision or revision tag of the Istio control plane. "+
+			"Overridable per schedule with spec.routing.sidecar.revision. Empty leaves it to the namespace injection labels.")
+	flag.StringVar(&precisionHintsTokenFile, "precision-hints-token-file", "",
+		"File holding the bearer token clients send to GET /hints/<namespace>/<service> on the operator API. "+
+			"Empty disables the precision hints.")
+	flag.StringVar(&deadLettersTokenFile, "dead-letters-token-file", "",
+		"File holding the bearer token clients send to GET /deadletters/<namespace>/<service> and "+
+			"POST /deadletters/<namespace>/<service>/replay on the operator API. Empty disables the dead-letter API.")
+	flag.StringVar(&diagnosticsTokenFile, "diagnostics-token-file", "",
+		"File holding the bearer token clients send to GET /inventory and GET /routers on the operator API. "+
+			"Empty disables both.")
+	flag.StringVar(&decisionLogTarget, "decision-log", "",
+		"Where to export the signed, append-only log of applied schedule decisions: a directory of daily "+
+			"JSONL files, or a syslog+tcp:// or syslog+udp:// endpoint. Empty disables the decision log.")
+	flag.StringVar(&decisionLogKeyFile, "decision-log-key-file", "",
+		"File holding the HMAC key signing the decision log, e.g. mounted from a Secret.")
+	flag.DurationVar(&decisionLogRetention, "decision-log-retention", 0,
+		"How long daily decision log files are kept. 0 keeps them forever.")
+	flag.StringVar(&sloGuardPrometheusURL, "slo-guard-prometheus-url", "",
+		"The Prometheus URL the SLO guard reads the Istio telemetry of the routed Services from. Empty disables the guard.")
+	flag.StringVar(&keplerPrometheusURL, "kepler-prometheus-url", "",
+		"The Prometheus URL the Kepler energy metrics and Istio telemetry of the flavours are read from, "+
+			"for schedules with spec.energyCalibration. Empty disables the calibration.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -108,8 +265,8 @@ func main() {
 		tlsOpts = append(tlsOpts, disableHTTP2)
 	}
 
-	// Create watchers for metrics and webhooks certificates
-	var metricsCertWatcher, webhookCertWatcher *certwatcher.CertWatcher
+	// Create watchers for metrics, webhooks and engine client certificates
+	var metricsCertWatcher, webhookCertWatcher, engineCertWatcher, apiCertWatcher *certwatcher.CertWatcher
 
 	// Initial webhook TLS options
 	webhookTLSOpts := tlsOpts
@@ -133,6 +290,44 @@ func main() {
 		})
 	}
 
+	if len(engineCertPath) > 0 {
+		setupLog.Info("Initializing engine client certificate watcher using provided certificates",
+			"engine-cert-path", engineCertPath, "engine-cert-name", engineCertName, "engine-cert-key", engineCertKey)
+
+		var err error
+		engineCertWatcher, err = certwatcher.New(
+			filepath.Join(engineCertPath, engineCertName),
+			filepath.Join(engineCertPath, engineCertKey),
+		)
+		if err != nil {
+			setupLog.Error(err, "Failed to initialize engine client certificate watcher")
+			os.Exit(1)
+		}
+	}
+	if len(apiCertPath) > 0 {
+		setupLog.Info("Initializing operator API certificate watcher using provided certificates",
+			"api-cert-path", apiCertPath, "api-cert-name", apiCertName, "api-cert-key", apiCertKey)
+
+		var err error
+		apiCertWatcher, err = certwatcher.New(
+			filepath.Join(apiCertPath, apiCertName),
+			filepath.Join(apiCertPath, apiCertKey),
+		)
+		if err != nil {
+			setupLog.Error(err, "Failed to initialize operator API certificate watcher")
+			os.Exit(1)
+		}
+	}
+	engineHTTP, err := controller.NewEngineHTTPClient(controller.EngineHTTPOptions{
+		Timeout:    engineTimeout,
+		CAFile:     engineCAFile,
+		ClientCert: engineCertWatcher,
+	})
+	if err != nil {
+		setupLog.Error(err, "unable to create decision engine HTTP client")
+		os.Exit(1)
+	}
+
 	webhookServer := webhook.NewServer(webhook.Options{
 		TLSOpts: webhookTLSOpts,
 	})
@@ -182,8 +377,17 @@ func main() {
 		})
 	}
 
+	var cacheOptions cache.Options
+	if !enablePowerCap {
+		// The power-cap controller counts every pod of the nodes; otherwise only
+		// the flavour pods are read from the cache
+		cacheOptions.ByObject = map[client.Object]cache.ByObject{
+			&corev1.Pod{}: {Label: controller.FlavourPodSelector()},
+		}
+	}
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
+		Cache:                  cacheOptions,
 		Metrics:                metricsServerOptions,
 		WebhookServer:          webhookServer,
 		HealthProbeBindAddress: probeAddr,
@@ -206,22 +410,291 @@ func main() {
 		os.Exit(1)
 	}
 
+	apiServer := apiserver.New(apiAddr)
+	if apiCertWatcher != nil {
+		apiServer.ServeTLS(apiCertWatcher.GetCertificate)
+	}
+	inventory := controller.NewResourceInventory()
+	routerSync := controller.NewRouterSyncTracker()
+	savings := controller.NewSavingsLedger()
+	var sloGuard *controller.SLOGuard
+	if sloGuardPrometheusURL != "" {
+		sloGuard = controller.NewSLOGuard(sloGuardPrometheusURL)
+	}
+	var kepler *controller.Kepler
+	if keplerPrometheusURL != "" {
+		kepler = controller.NewKepler(keplerPrometheusURL)
+	}
+	if diagnosticsTokenFile != "" {
+		token, err := os.ReadFile(diagnosticsTokenFile)
+		if err != nil || len(strings.TrimSpace(string(token))) == 0 {
+			setupLog.Error(err, "unable to read a diagnostics token", "file", diagnosticsTokenFile)
+			os.Exit(1)
+		}
+		// Both are filled by the reconcilers, which only run on the leader
+		diagnostics := func(handler http.Handler) http.Handler {
+			return apiserver.RequireToken([]byte(strings.TrimSpace(string(token))), apiserver.LeaderOnly(mgr.Elected(), handler))
+		}
+		apiServer.Handle("/inventory", diagnostics(inventory))
+		apiServer.Handle("/routers", diagnostics(routerSync))
+		setupLog.Info("Serving the inventory and router state to clients")
+	}
+	if precisionHintsTokenFile != "" {
+		token, err := os.ReadFile(precisionHintsTokenFile)
+		if err != nil || len(strings.TrimSpace(string(token))) == 0 {
+			setupLog.Error(err, "unable to read a precision hints token", "file", precisionHintsTokenFile)
+			os.Exit(1)
+		}
+		apiServer.Handle(controller.PrecisionHintsPattern,
+			controller.NewPrecisionHints(mgr.GetClient(), strings.TrimSpace(string(token)), operatorNamespace))
+		setupLog.Info("Serving precision hints to clients")
+	}
+	if deadLettersTokenFile != "" {
+		token, err := os.ReadFile(deadLettersTokenFile)
+		if err != nil || len(strings.TrimSpace(string(token))) == 0 {
+			setupLog.Error(err, "unable to read a dead letters token", "file", deadLettersTokenFile)
+			os.Exit(1)
+		}
+		deadLetters := controller.NewDeadLetters(mgr.GetClient(), mgr.GetAPIReader(), strings.TrimSpace(string(token)))
+		apiServer.Handle(controller.DeadLettersPattern, deadLetters)
+		apiServer.Handle(controller.DeadLettersReplayPattern, deadLetters)
+		setupLog.Info("Serving dead letters to clients")
+	}
+	if schedulerExtender {
+		apiServer.Handle("/scheduler/prioritize", schedextender.NewHandler(mgr.GetClient()))
+		setupLog.Info("Serving the scheduler extender")
+	}
+
+	var embeddedEngine *engine.Engine
+	var streams *controller.ScheduleStreams
+	var receiver *controller.ScheduleReceiver
+	var events *controller.ScheduleEvents
+	switch engineMode {
+	case "external":
+		switch engineProtocol {
+		case "http":
+			if scheduleReceiver {
+				var token []byte
+				if scheduleReceiverTokenFile != "" {
+					if token, err = os.ReadFile(scheduleReceiverTokenFile); err != nil {
+						setupLog.Error(err, "unable to read schedule receiver token")
+						os.Exit(1)
+					}
+				}
+				if !apiServer.Enabled() {
+					setupLog.Info("Schedule receiver needs the operator API, set --api-bind-address")
+				}
+				receiver, err = controller.NewScheduleReceiver(strings.TrimSpace(string(token)), mgr.GetClient())
+				if err != nil {
+					setupLog.Error(err, "unable to start the schedule receiver, set --schedule-receiver-token-file")
+					os.Exit(1)
+				}
+				// Followers would accept pushes only the leader applies
+				apiServer.Handle(controller.ScheduleReceiverPattern, apiserver.LeaderOnly(mgr.Elected(), receiver))
+				setupLog.Info("Accepting schedules pushed by the decision engine")
+			}
+			if engineEvents {
+				events = controller.NewScheduleEvents(engineURL, engineHTTP)
+				if err := mgr.Add(events); err != nil {
+					setupLog.Error(err, "unable to add schedule events")
+					os.Exit(1)
+				}
+				setupLog.Info("Subscribing to the decision engine schedule events", "url", engineURL)
+			}
+		case "grpc":
+			// Without TLS, schedules with spec.scheduler.auth are refused rather
+			// than sending their credentials in plaintext
+			creds, secure, err := controller.EngineGRPCCredentials(controller.EngineHTTPOptions{
+				CAFile:     engineCAFile,
+				ClientCert: engineCertWatcher,
+			})
+			if err != nil {
+				setupLog.Error(err, "unable to build the decision engine gRPC TLS credentials")
+				os.Exit(1)
+			}
+			conn, err := grpc.NewClient(engineGRPCAddress, grpc.WithTransportCredentials(creds))
+			if err != nil {
+				setupLog.Error(err, "unable to create decision engine gRPC client")
+				os.Exit(1)
+			}
+			streams = controller.NewScheduleStreams(enginepb.NewDecisionEngineClient(conn), secure)
+			if err := mgr.Add(streams); err != nil {
+				setupLog.Error(err, "unable to add schedule streams")
+				os.Exit(1)
+			}
+			setupLog.Info("Using the decision engine gRPC API", "address", engineGRPCAddress)
+		default:
+			setupLog.Error(fmt.Errorf("unknown engine protocol %q", engineProtocol), "invalid --engine-protocol, expected http or grpc")
+			os.Exit(1)
+		}
+	case "embedded":
+		embeddedEngine = engine.New(engine.Options{CarbonAPIURL: carbonAPIURL})
+		setupLog.Info("Using the embedded decision engine", "carbonAPIURL", carbonAPIURL)
+	default:
+		setupLog.Error(fmt.Errorf("unknown engine %q", engineMode), "invalid --engine, expected external or embedded")
+		os.Exit(1)
+	}
+
+	if !slices.Contains(controller.RoutingBackends, routingBackend) {
+		setupLog.Error(fmt.Errorf("unknown routing backend %q", routingBackend), "invalid --routing-backend, expected istio, gateway-api or linkerd")
+		os.Exit(1)
+	}
+
+	var decisionLog *controller.DecisionLog
+	if decisionLogTarget != "" {
+		if decisionLogKeyFile == "" {
+			setupLog.Error(fmt.Errorf("missing signing key"), "--decision-log needs --decision-log-key-file")
+			os.Exit(1)
+		}
+		key, err := os.ReadFile(decisionLogKeyFile)
+		if err != nil {
+			setupLog.Error(err, "unable to read decision log key")
+			os.Exit(1)
+		}
+		if decisionLog, err = controller.NewDecisionLog(decisionLogTarget, []byte(strings.TrimSpace(string(key))), decisionLogRetention); err != nil {
+			setupLog.Error(err, "unable to open decision log")
+			os.Exit(1)
+		}
+		setupLog.Info("Exporting schedule decisions", "target", decisionLogTarget, "retention", decisionLogRetention)
+	}
+
+	carbonProviderURLs := controller.CarbonProviderURLs{
+		CarbonIntensity: carbonAPIURL,
+		ElectricityMaps: electricityMapsURL,
+		WattTime:        wattTimeURL,
+	}
 	if err = (&controller.TrafficScheduleReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:              mgr.GetClient(),
+		Scheme:              mgr.GetScheme(),
+		KillSwitchNamespace: operatorNamespace,
+		Engine:              embeddedEngine,
+		Dashboards:          grafanaDashboards,
+		Streams:             streams,
+		APIReader:           mgr.GetAPIReader(),
+		EngineURL:           engineURL,
+		EngineHTTP:          engineHTTP,
+		Receiver:            receiver,
+		Events:              events,
+		Recorder:            mgr.GetEventRecorderFor("trafficschedule-controller"),
+		DecisionLog:         decisionLog,
+		Savings:             savings,
+		CarbonProviderURLs:  carbonProviderURLs,
+		Kepler:              kepler,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "TrafficSchedule")
 		os.Exit(1)
 	}
+	if err = (&controller.CarbonIntensityProviderReconciler{
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		APIReader: mgr.GetAPIReader(),
+		URLs:      carbonProviderURLs,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "CarbonIntensityProvider")
+		os.Exit(1)
+	}
 	if err = (&controller.FlavourRouterReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:              mgr.GetClient(),
+		Scheme:              mgr.GetScheme(),
+		APIReader:           mgr.GetAPIReader(),
+		Inventory:           inventory,
+		RouterSync:          routerSync,
+		Savings:             savings,
+		SLOGuard:            sloGuard,
+		FlapThreshold:       flapThreshold,
+		FlapWindow:          flapWindow,
+		KillSwitchNamespace: operatorNamespace,
+		EnrollmentLimits: controller.EnrollmentLimits{
+			MaxServicesPerNamespace: maxServicesPerNamespace,
+			MaxPrecisionsPerService: maxPrecisionsPerService,
+		},
+		Recorder:          mgr.GetEventRecorderFor("flavourrouter-controller"),
+		RoutingBackend:    routingBackend,
+		NetworkPolicies:   networkPolicies,
+		OperatorNamespace: operatorNamespace,
+		IstioRevision:     istioRevision,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "FlavourRouter")
 		os.Exit(1)
 	}
+	if enablePowerCap {
+		if err = (&controller.PowerCapReconciler{
+			Client:     mgr.GetClient(),
+			Scheme:     mgr.GetScheme(),
+			Namespace:  operatorNamespace,
+			AgentImage: nodeAgentImage,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "PowerCap")
+			os.Exit(1)
+		}
+	}
+	if enableBatchDeferral {
+		if err = (&controller.BatchDeferralReconciler{
+			Client:              mgr.GetClient(),
+			Scheme:              mgr.GetScheme(),
+			KillSwitchNamespace: operatorNamespace,
+			Recorder:            mgr.GetEventRecorderFor("batchdeferral-controller"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "BatchDeferral")
+			os.Exit(1)
+		}
+		if err = (&controller.CronJobDeferralReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "CronJobDeferral")
+			os.Exit(1)
+		}
+	}
+	if schedulerExtender {
+		if err = (&controller.NodeCarbonReconciler{
+			Client:              mgr.GetClient(),
+			Scheme:              mgr.GetScheme(),
+			KillSwitchNamespace: operatorNamespace,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "NodeCarbon")
+			os.Exit(1)
+		}
+	}
+	if autoscalerHints {
+		namespace, name, ok := strings.Cut(autoscalerPriorityConfigMap, "/")
+		if !ok || namespace == "" || name == "" {
+			setupLog.Error(fmt.Errorf("expected namespace/name, got %q", autoscalerPriorityConfigMap),
+				"invalid --autoscaler-priority-configmap")
+			os.Exit(1)
+		}
+		if err = (&controller.AutoscalerHintsReconciler{
+			Client:              mgr.GetClient(),
+			Scheme:              mgr.GetScheme(),
+			ConfigMap:           types.NamespacedName{Namespace: namespace, Name: name},
+			KillSwitchNamespace: operatorNamespace,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "AutoscalerHints")
+			os.Exit(1)
+		}
+	}
+	if brokerAutoscaling {
+		if err = (&controller.BrokerScalerReconciler{
+			Client:               mgr.GetClient(),
+			Scheme:               mgr.GetScheme(),
+			Namespace:            operatorNamespace,
+			StatefulSet:          brokerStatefulSet,
+			MinReplicas:          int32(brokerMinReplicas),
+			MaxReplicas:          int32(brokerMaxReplicas),
+			BufferingMinReplicas: int32(brokerBufferingMinReplicas),
+			BacklogPerReplica:    int32(brokerBacklogPerReplica),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "BrokerScaler")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
+	if err := mgr.Add(apiServer); err != nil {
+		setupLog.Error(err, "unable to add operator API server to manager")
+		os.Exit(1)
+	}
+
 	if metricsCertWatcher != nil {
 		setupLog.Info("Adding metrics certificate watcher to manager")
 		if err := mgr.Add(metricsCertWatcher); err != nil {
@@ -238,6 +711,22 @@ func main() {
 		}
 	}
 
+	if apiCertWatcher != nil {
+		setupLog.Info("Adding operator API certificate watcher to manager")
+		if err := mgr.Add(apiCertWatcher); err != nil {
+			setupLog.Error(err, "unable to add operator API certificate watcher to manager")
+			os.Exit(1)
+		}
+	}
+
+	if engineCertWatcher != nil {
+		setupLog.Info("Adding engine client certificate watcher to manager")
+		if err := mgr.Add(engineCertWatcher); err != nil {
+			setupLog.Error(err, "unable to add engine client certificate watcher to manager")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -0,0 +1,59 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/poweragent"
+)
+
+func main() {
+	var sysfsRoot string
+	var interval time.Duration
+	flag.StringVar(&sysfsRoot, "sysfs-root", "/host/sys", "Mount point of the node sysfs.")
+	flag.DurationVar(&interval, "interval", 15*time.Second, "How often the node annotation is checked.")
+	opts := zap.Options{}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	log := ctrl.Log.WithName("setup")
+
+	nodeName := os.Getenv("NODE_NAME")
+	if nodeName == "" {
+		log.Info("NODE_NAME is not set")
+		os.Exit(1)
+	}
+
+	clientset, err := kubernetes.NewForConfig(ctrl.GetConfigOrDie())
+	if err != nil {
+		log.Error(err, "unable to create clientset")
+		os.Exit(1)
+	}
+
+	if err := poweragent.Run(ctrl.SetupSignalHandler(), clientset, nodeName, poweragent.NewCapper(sysfsRoot), interval); err != nil {
+		log.Error(err, "power agent stopped")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package apiserver hosts the small HTTP API exposed by the operator manager
+// (inventory, diagnostics and other operational endpoints).
+package apiserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const shutdownTimeout = 5 * time.Second
+
+// Server is a manager.Runnable serving operator API handlers on a dedicated port.
+type Server struct {
+	addr string
+	mux  *http.ServeMux
+	tls  *tls.Config
+}
+
+// New returns a Server bound to addr. An empty addr or "0" disables serving.
+func New(addr string) *Server {
+	return &Server{addr: addr, mux: http.NewServeMux()}
+}
+
+// Handle registers a handler for the given pattern.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// ServeTLS serves HTTPS with the certificates returned by getCertificate,
+// typically those of a certwatcher.CertWatcher.
+func (s *Server) ServeTLS(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) {
+	s.tls = &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: getCertificate}
+}
+
+// Enabled reports whether the server will listen at all.
+func (s *Server) Enabled() bool {
+	return s.addr != "" && s.addr != "0"
+}
+
+// Start serves until ctx is cancelled.
+func (s *Server) Start(ctx context.Context) error {
+	log := ctrl.Log.WithName("apiserver")
+	if !s.Enabled() {
+		log.Info("Operator API disabled")
+		<-ctx.Done()
+		return nil
+	}
+
+	srv := &http.Server{
+		Addr:              s.addr,
+		Handler:           s.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig:         s.tls,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Info("Serving operator API", "addr", s.addr, "tls", s.tls != nil)
+		serve := srv.ListenAndServe
+		if s.tls != nil {
+			serve = func() error { return srv.ListenAndServeTLS("", "") }
+		}
+		if err := serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+		close(errCh)
+	}()
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		return srv.Shutdown(shutdownCtx)
+	case err := <-errCh:
+		return err
+	}
+}
+
+// NeedLeaderElection lets every replica answer API calls; handlers backed by
+// reconciler state only hold data on the current leader, see LeaderOnly.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// RequireToken answers only the requests sending token as a bearer token.
+func RequireToken(token []byte, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		sent, _ := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if len(token) == 0 || subtle.ConstantTimeCompare([]byte(sent), token) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// LeaderOnly serves handler once elected is closed. Until then the replica
+// holds none of the reconciler state, so it answers 503 rather than empty data.
+func LeaderOnly(elected <-chan struct{}, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-elected:
+			handler.ServeHTTP(w, req)
+		default:
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, "not the leader, the reconciler state is held by the leader replica", http.StatusServiceUnavailable)
+		}
+	})
+}
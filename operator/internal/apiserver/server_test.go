@@ -0,0 +1,37 @@
+package apiserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDiagnosticsHandlers(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {})
+	follower, leader := make(chan struct{}), make(chan struct{})
+	close(leader)
+	tests := []struct {
+		name    string
+		elected chan struct{}
+		header  string
+		status  int
+	}{
+		{name: "no token", elected: leader, status: http.StatusUnauthorized},
+		{name: "wrong token", elected: leader, header: "Bearer nope", status: http.StatusUnauthorized},
+		{name: "follower", elected: follower, header: "Bearer secret", status: http.StatusServiceUnavailable},
+		{name: "leader", elected: leader, header: "Bearer secret", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/inventory", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			RequireToken([]byte("secret"), LeaderOnly(tt.elected, ok)).ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("got %d, want %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
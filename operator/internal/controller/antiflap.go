@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// conditionDegraded is set on the routed Service when the operator stops reconciling it.
+	conditionDegraded = "carbonrouter.io/Degraded"
+
+	reasonRecreationFlapping = "RecreationFlapping"
+
+	defaultFlapThreshold = 5
+	defaultFlapWindow    = 10 * time.Minute
+)
+
+// recreationFlapError is returned by ensure* helpers when a managed resource keeps
+// disappearing and the operator should stop fighting whoever deletes it.
+type recreationFlapError struct {
+	Kind   string
+	Name   string
+	Count  int
+	Window time.Duration
+}
+
+func (e *recreationFlapError) Error() string {
+	return fmt.Sprintf("%s %s was recreated %d times within %s", e.Kind, e.Name, e.Count, e.Window)
+}
+
+// recreationTracker counts how often managed resources had to be recreated.
+type recreationTracker struct {
+	mu     sync.Mutex
+	events map[string][]time.Time
+}
+
+func (t *recreationTracker) observe(key string, window time.Duration, now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.events == nil {
+		t.events = map[string][]time.Time{}
+	}
+	kept := t.events[key][:0]
+	for _, ts := range t.events[key] {
+		if now.Sub(ts) < window {
+			kept = append(kept, ts)
+		}
+	}
+	kept = append(kept, now)
+	t.events[key] = kept
+	return len(kept)
+}
+
+func (t *recreationTracker) reset(prefix string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key := range t.events {
+		if strings.HasPrefix(key, prefix) {
+			delete(t.events, key)
+		}
+	}
+}
+
+func (r *FlavourRouterReconciler) flapSettings() (int, time.Duration) {
+	threshold, window := r.FlapThreshold, r.FlapWindow
+	if threshold <= 0 {
+		threshold = defaultFlapThreshold
+	}
+	if window <= 0 {
+		window = defaultFlapWindow
+	}
+	return threshold, window
+}
+
+// guardRecreate is called before creating a managed resource. When the resource was
+// applied before (it is in the inventory) the creation counts as a recreation, and
+// too many recreations in the configured window abort the reconcile.
+func (r *FlavourRouterReconciler) guardRecreate(ctx context.Context, svc *corev1.Service, kind, namespace, name string) error {
+	key := client.ObjectKeyFromObject(svc)
+	if !r.Inventory.Has(key, kind, namespace, name) {
+		return nil
+	}
+	threshold, window := r.flapSettings()
+	count := r.recreations.observe(key.String()+"|"+inventoryKey(kind, namespace, name), window, time.Now())
+	ctrl.LoggerFrom(ctx).WithName("[FlavourRouter]").Info("Recreating resource deleted out-of-band",
+		"kind", kind, "name", name, "recreations", count, "window", window)
+	if count >= threshold {
+		return &recreationFlapError{Kind: kind, Name: name, Count: count, Window: window}
+	}
+	return nil
+}
+
+// ensureFailed converts a reconcile failure into a reconcile result retried
+// according to its class, and reports it in the Reconciled condition. Flapping
+// resources flip the Service to Degraded and stop the loop instead of retrying.
+func (r *FlavourRouterReconciler) ensureFailed(ctx context.Context, svc *corev1.Service, err error) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx).WithName("[FlavourRouter]")
+	var flapErr *recreationFlapError
+	if !errors.As(err, &flapErr) {
+		class := classify(err)
+		// Conflicts are retried on a fresh copy and would only make the condition flicker
+		if class != failureConflict {
+			recordEvent(r.Recorder, svc, corev1.EventTypeWarning, eventReconcileFailed, "%s: %v", class, err)
+			if condErr := r.setServiceCondition(ctx, svc, reconciledCondition(class, err)); condErr != nil {
+				log.Error(condErr, "Failed to report reconcile failure")
+			}
+		}
+		return failureResult("flavourrouter", class, err)
+	}
+	log.Error(err, "Stopping reconciliation, another actor keeps deleting a managed resource")
+	recordEvent(r.Recorder, svc, corev1.EventTypeWarning, eventRecreationFlapping, "%s", flapErr.Error())
+	cond := metav1.Condition{
+		Type:    conditionDegraded,
+		Status:  metav1.ConditionTrue,
+		Reason:  reasonRecreationFlapping,
+		Message: fmt.Sprintf("%s; remove the %s condition or re-enable the service to resume", flapErr.Error(), conditionDegraded),
+	}
+	return ctrl.Result{}, r.setServiceCondition(ctx, svc, cond)
+}
+
+func (r *FlavourRouterReconciler) setServiceCondition(ctx context.Context, svc *corev1.Service, cond metav1.Condition) error {
+	cond.ObservedGeneration = svc.Generation
+	original := svc.DeepCopy()
+	if !meta.SetStatusCondition(&svc.Status.Conditions, cond) {
+		return nil
+	}
+	return r.Status().Patch(ctx, svc, client.MergeFrom(original))
+}
+
+func (r *FlavourRouterReconciler) clearServiceCondition(ctx context.Context, svc *corev1.Service, conditionType string) error {
+	original := svc.DeepCopy()
+	if !meta.RemoveStatusCondition(&svc.Status.Conditions, conditionType) {
+		return nil
+	}
+	return r.Status().Patch(ctx, svc, client.MergeFrom(original))
+}
+
+func (r *FlavourRouterReconciler) resetRecreations(service types.NamespacedName) {
+	r.recreations.reset(service.String() + "|")
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRecreationTrackerObserve(t *testing.T) {
+	var tracker recreationTracker
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	steps := []struct {
+		key  string
+		at   time.Duration
+		want int
+	}{
+		{key: "shop/checkout|VirtualService", at: 0, want: 1},
+		{key: "shop/checkout|VirtualService", at: time.Minute, want: 2},
+		{key: "shop/cart|VirtualService", at: time.Minute, want: 1},
+		{key: "shop/checkout|VirtualService", at: 10 * time.Minute, want: 2},
+		{key: "shop/checkout|VirtualService", at: 30 * time.Minute, want: 1},
+	}
+	for _, step := range steps {
+		if got := tracker.observe(step.key, 10*time.Minute, start.Add(step.at)); got != step.want {
+			t.Errorf("%s at %v: got %d recreations, want %d", step.key, step.at, got, step.want)
+		}
+	}
+	tracker.reset("shop/checkout|")
+	if got := tracker.observe("shop/checkout|VirtualService", 10*time.Minute, start.Add(31*time.Minute)); got != 1 {
+		t.Errorf("after reset: got %d recreations, want 1", got)
+	}
+	if got := tracker.observe("shop/cart|VirtualService", time.Hour, start.Add(31*time.Minute)); got != 2 {
+		t.Errorf("reset reached another service: got %d recreations, want 2", got)
+	}
+}
+
+func TestGuardRecreate(t *testing.T) {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout"}}
+	r := &FlavourRouterReconciler{Inventory: NewResourceInventory(), FlapThreshold: 3, FlapWindow: time.Hour}
+
+	if err := r.guardRecreate(context.Background(), svc, "VirtualService", "shop", "checkout"); err != nil {
+		t.Fatalf("first creation counted as a recreation: %v", err)
+	}
+	r.Inventory.Record(client.ObjectKeyFromObject(svc), "VirtualService", "shop", "checkout", nil, true)
+	for i := 1; i < 3; i++ {
+		if err := r.guardRecreate(context.Background(), svc, "VirtualService", "shop", "checkout"); err != nil {
+			t.Fatalf("recreation %d aborted below the threshold: %v", i, err)
+		}
+	}
+	err := r.guardRecreate(context.Background(), svc, "VirtualService", "shop", "checkout")
+	var flapErr *recreationFlapError
+	if !errors.As(err, &flapErr) || flapErr.Count != 3 || flapErr.Kind != "VirtualService" {
+		t.Fatalf("got %v, want a flap error at the third recreation", err)
+	}
+
+	r.resetRecreations(client.ObjectKeyFromObject(svc))
+	if err := r.guardRecreate(context.Background(), svc, "VirtualService", "shop", "checkout"); err != nil {
+		t.Errorf("recreations not reset: %v", err)
+	}
+}
+
+func TestEnsureFailedDegradesOnFlapping(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout"}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(svc).WithStatusSubresource(svc).Build()
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme}
+
+	result, err := r.ensureFailed(context.Background(), svc,
+		&recreationFlapError{Kind: "VirtualService", Name: "checkout", Count: 5, Window: time.Minute})
+	if err != nil || result.Requeue || result.RequeueAfter != 0 {
+		t.Fatalf("got %+v, %v, want the loop stopped", result, err)
+	}
+	var got corev1.Service
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(svc), &got); err != nil {
+		t.Fatal(err)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, conditionDegraded)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != reasonRecreationFlapping {
+		t.Errorf("got condition %+v, want Degraded for %s", cond, reasonRecreationFlapping)
+	}
+}
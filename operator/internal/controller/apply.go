@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// fieldManager is the Server-Side Apply field manager of the operator. Fields
+// it does not send, such as Deployment replicas or annotations added by users,
+// stay with their own managers.
+const fieldManager = "carbonrouter-operator"
+
+// apply server-side applies the desired state of a managed resource and records
+// it in the inventory. Ownership is forced, but only over the fields present in
+// obj, so the desired objects must never carry fields owned by KEDA or the HPA.
+// obj is left untouched, which keeps spec pointing at the desired state.
+func (r *FlavourRouterReconciler) apply(ctx context.Context, svc *corev1.Service, kind string, obj client.Object, spec interface{}) error {
+	gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+	if err != nil {
+		return err
+	}
+	desired := obj.DeepCopyObject().(client.Object)
+	desired.GetObjectKind().SetGroupVersionKind(gvk)
+
+	current := obj.DeepCopyObject().(client.Object)
+	resourceVersion := ""
+	err = r.Get(ctx, client.ObjectKeyFromObject(obj), current)
+	created := apierrors.IsNotFound(err)
+	switch {
+	case created:
+		if err := r.guardRecreate(ctx, svc, kind, obj.GetNamespace(), obj.GetName()); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		resourceVersion = current.GetResourceVersion()
+	}
+
+	if err := r.Patch(ctx, desired, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership); err != nil {
+		return err
+	}
+	// The API server leaves the resourceVersion alone when the apply is a no-op.
+	applied := desired.GetResourceVersion() != resourceVersion
+	if applied {
+		ctrl.LoggerFrom(ctx).WithName("[FlavourRouter]").Info("Applied managed resource", "kind", kind, "name", obj.GetName(), "namespace", obj.GetNamespace())
+		r.recordApplied(svc, kind, obj.GetName(), created)
+	}
+	r.track(svc, kind, obj.GetNamespace(), obj.GetName(), spec, applied)
+	return nil
+}
+
+// recordApplied records the creation or update of a managed resource on its
+// parent service.
+func (r *FlavourRouterReconciler) recordApplied(svc *corev1.Service, kind, name string, created bool) {
+	reason, verb := "Updated"+kind, "Updated"
+	if created {
+		reason, verb = "Created"+kind, "Created"
+	}
+	recordEvent(r.Recorder, svc, corev1.EventTypeNormal, reason, "%s %s %s", verb, kind, name)
+}
@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+// fakeApply stands in for Server-Side Apply, which the fake client does not
+// support, on ConfigMaps: it creates or replaces the object and, as the API
+// server does, leaves the resourceVersion alone when nothing changes.
+func fakeApply(t *testing.T) interceptor.Funcs {
+	return interceptor.Funcs{Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+		if patch.Type() != types.ApplyPatchType {
+			return c.Patch(ctx, obj, patch, opts...)
+		}
+		applyOpts := &client.PatchOptions{}
+		applyOpts.ApplyOptions(opts)
+		if applyOpts.FieldManager != fieldManager || applyOpts.Force == nil || !*applyOpts.Force {
+			t.Errorf("apply with field manager %q and force %v, want %q forced", applyOpts.FieldManager, applyOpts.Force, fieldManager)
+		}
+		if obj.GetObjectKind().GroupVersionKind().Kind != "ConfigMap" {
+			t.Errorf("apply without its kind: %v", obj.GetObjectKind().GroupVersionKind())
+		}
+		desired := obj.(*corev1.ConfigMap)
+		var current corev1.ConfigMap
+		err := c.Get(ctx, client.ObjectKeyFromObject(obj), &current)
+		switch {
+		case apierrors.IsNotFound(err):
+			return c.Create(ctx, desired)
+		case err != nil:
+			return err
+		case reflect.DeepEqual(current.Data, desired.Data):
+			current.DeepCopyInto(desired)
+			return nil
+		}
+		current.Data = desired.Data
+		if err := c.Update(ctx, &current); err != nil {
+			return err
+		}
+		current.DeepCopyInto(desired)
+		return nil
+	}}
+}
+
+func TestApply(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout"}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(fakeApply(t)).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme, Inventory: NewResourceInventory(), Recorder: recorder, FlapThreshold: 2, FlapWindow: time.Hour}
+	ctx := context.Background()
+	desired := func(value string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout-config"}, Data: map[string]string{"key": value}}
+	}
+	events := func() []string {
+		var out []string
+		for len(recorder.Events) > 0 {
+			out = append(out, <-recorder.Events)
+		}
+		return out
+	}
+
+	steps := []struct {
+		name   string
+		value  string
+		delete bool
+		events []string
+	}{
+		{name: "created", value: "a", events: []string{"Normal CreatedConfigMap Created ConfigMap checkout-config"}},
+		{name: "no-op", value: "a"},
+		{name: "updated", value: "b", events: []string{"Normal UpdatedConfigMap Updated ConfigMap checkout-config"}},
+		{name: "recreated", value: "b", delete: true, events: []string{"Normal CreatedConfigMap Created ConfigMap checkout-config"}},
+	}
+	for _, step := range steps {
+		if step.delete {
+			if err := c.Delete(ctx, desired(step.value)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		obj := desired(step.value)
+		if err := r.apply(ctx, svc, "ConfigMap", obj, obj.Data); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if obj.ResourceVersion != "" || !obj.GetObjectKind().GroupVersionKind().Empty() {
+			t.Errorf("%s: desired object modified: %+v", step.name, obj)
+		}
+		if got := events(); !reflect.DeepEqual(got, step.events) {
+			t.Errorf("%s: got events %v, want %v", step.name, got, step.events)
+		}
+		resources := r.Inventory.Snapshot("shop", "checkout")[0].Resources
+		if len(resources) != 1 || resources[0].Hash != specHash(obj.Data) {
+			t.Errorf("%s: got inventory %+v, want the applied spec", step.name, resources)
+		}
+	}
+
+	if err := c.Delete(ctx, desired("b")); err != nil {
+		t.Fatal(err)
+	}
+	err := r.apply(ctx, svc, "ConfigMap", desired("b"), nil)
+	var flapErr *recreationFlapError
+	if !errors.As(err, &flapErr) {
+		t.Fatalf("got %v, want the second recreation refused", err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(desired("b")), &corev1.ConfigMap{}); !apierrors.IsNotFound(err) {
+		t.Errorf("refused recreation still applied: %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	autoscalerHintsResync          = time.Minute
+	autoscalerHintsReconcileTarget = "autoscaler-hints"
+	// priorityExpanderKey holds the configuration of the cluster-autoscaler
+	// priority expander.
+	priorityExpanderKey = "priorities"
+	// originalPrioritiesAnnotation keeps the priorities the operator replaced,
+	// restored once processing is no longer throttled.
+	originalPrioritiesAnnotation = "carbonrouter.io/original-priorities"
+	autoscalerHintsManagedBy     = "carbonrouter-operator"
+	// The greenest node group gets the highest priority, and node groups
+	// matched by no hint keep the lowest.
+	hintedPriorityStep = 10
+	fallbackPriority   = 1
+)
+
+// AutoscalerHintsReconciler rewrites the priority expander ConfigMap of the
+// cluster-autoscaler while any schedule with spec.autoscalerHints throttles
+// processing, so that scale-ups land on the node groups drawing from the
+// greenest grid. The priorities it replaced are restored once no schedule
+// throttles, and while the kill-switch is engaged.
+type AutoscalerHintsReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// ConfigMap is the priority expander ConfigMap read by the
+	// cluster-autoscaler, created when missing.
+	ConfigMap types.NamespacedName
+	// KillSwitchNamespace holds the emergency kill-switch ConfigMap; empty
+	// disables it.
+	KillSwitchNamespace string
+}
+
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=scheduling.carbonrouter.io,resources=trafficschedules,verbs=get;list;watch
+
+func (r *AutoscalerHintsReconciler) Reconcile(ctx context.Context, _ ctrl.Request) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx).WithName("[AutoscalerHints]")
+
+	var tsList schedulingv1alpha1.TrafficScheduleList
+	if err := r.List(ctx, &tsList); err != nil {
+		return ctrl.Result{}, err
+	}
+	killed, err := killSwitchEngaged(ctx, r.Client, r.KillSwitchNamespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	priorities := ""
+	if !killed {
+		priorities = renderPriorities(rankNodeGroups(ctx, tsList.Items))
+	}
+
+	var cm corev1.ConfigMap
+	err = r.Get(ctx, r.ConfigMap, &cm)
+	switch {
+	case apierrors.IsNotFound(err):
+		if priorities == "" {
+			return ctrl.Result{RequeueAfter: autoscalerHintsResync}, nil
+		}
+		cm = corev1.ConfigMap{}
+		cm.Name, cm.Namespace = r.ConfigMap.Name, r.ConfigMap.Namespace
+		cm.Labels = map[string]string{"app.kubernetes.io/managed-by": autoscalerHintsManagedBy}
+		cm.Data = map[string]string{priorityExpanderKey: priorities}
+		log.Info("Hinting the cluster-autoscaler towards greener node groups", "configMap", r.ConfigMap.String())
+		return ctrl.Result{RequeueAfter: autoscalerHintsResync}, r.Create(ctx, &cm)
+	case err != nil:
+		return ctrl.Result{}, err
+	}
+
+	original, hinted := cm.Annotations[originalPrioritiesAnnotation]
+	if priorities == "" {
+		if !hinted {
+			return ctrl.Result{RequeueAfter: autoscalerHintsResync}, nil
+		}
+		if cm.Labels["app.kubernetes.io/managed-by"] == autoscalerHintsManagedBy {
+			log.Info("Processing no longer throttled, removing the node group hints", "configMap", r.ConfigMap.String())
+			return ctrl.Result{RequeueAfter: autoscalerHintsResync}, client.IgnoreNotFound(r.Delete(ctx, &cm))
+		}
+		log.Info("Processing no longer throttled, restoring the node group priorities", "configMap", r.ConfigMap.String())
+		patch := client.MergeFrom(cm.DeepCopy())
+		delete(cm.Annotations, originalPrioritiesAnnotation)
+		if original == "" {
+			delete(cm.Data, priorityExpanderKey)
+		} else {
+			cm.Data[priorityExpanderKey] = original
+		}
+		return ctrl.Result{RequeueAfter: autoscalerHintsResync}, r.Patch(ctx, &cm, patch)
+	}
+
+	if hinted && cm.Data[priorityExpanderKey] == priorities {
+		return ctrl.Result{RequeueAfter: autoscalerHintsResync}, nil
+	}
+	patch := client.MergeFrom(cm.DeepCopy())
+	if !hinted {
+		log.Info("Hinting the cluster-autoscaler towards greener node groups", "configMap", r.ConfigMap.String())
+		if cm.Annotations == nil {
+			cm.Annotations = map[string]string{}
+		}
+		cm.Annotations[originalPrioritiesAnnotation] = cm.Data[priorityExpanderKey]
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[priorityExpanderKey] = priorities
+	if err := r.Patch(ctx, &cm, patch); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: autoscalerHintsResync}, nil
+}
+
+// nodeGroupRank is the carbon intensity of the node groups matched by a
+// pattern, averaged over the throttled schedules hinting them. known is false
+// when none has a forecast for them.
+type nodeGroupRank struct {
+	pattern   string
+	intensity float64
+	known     bool
+}
+
+// rankNodeGroups collects the node group hints of the schedules with
+// spec.autoscalerHints that currently throttle processing, greenest first. It
+// returns none while no such schedule throttles.
+func rankNodeGroups(ctx context.Context, schedules []schedulingv1alpha1.TrafficSchedule) []nodeGroupRank {
+	log := ctrl.LoggerFrom(ctx).WithName("[AutoscalerHints]")
+	sums := map[string]float64{}
+	counts := map[string]int{}
+	var patterns []string
+	for _, ts := range schedules {
+		cfg := ts.Spec.AutoscalerHints
+		if !cfg.Enabled {
+			continue
+		}
+		throttle, err := strconv.ParseFloat(strings.TrimSpace(ts.Status.ProcessingThrottle), 64)
+		if err != nil || throttle >= 1 {
+			continue
+		}
+		for _, hint := range cfg.NodeGroups {
+			if _, err := regexp.Compile(hint.Pattern); err != nil {
+				log.Info("Skipping invalid node group pattern", "trafficSchedule", client.ObjectKeyFromObject(&ts).String(), "pattern", hint.Pattern, "error", err.Error())
+				continue
+			}
+			if _, seen := counts[hint.Pattern]; !seen {
+				patterns = append(patterns, hint.Pattern)
+				counts[hint.Pattern] = 0
+			}
+			intensity, ok := parseOptionalFloat(hint.Intensity)
+			if !ok && hint.Zone != "" {
+				intensity, err = strconv.ParseFloat(ts.Status.ZoneForecasts[hint.Zone], 64)
+				ok = err == nil
+			}
+			if ok {
+				sums[hint.Pattern] += intensity
+				counts[hint.Pattern]++
+			}
+		}
+	}
+	ranks := make([]nodeGroupRank, 0, len(patterns))
+	for _, pattern := range patterns {
+		rank := nodeGroupRank{pattern: pattern, known: counts[pattern] > 0}
+		if rank.known {
+			rank.intensity = sums[pattern] / float64(counts[pattern])
+		}
+		ranks = append(ranks, rank)
+	}
+	// Node groups without a forecast rank below the others, in spec order
+	sort.SliceStable(ranks, func(i, j int) bool {
+		if ranks[i].known != ranks[j].known {
+			return ranks[i].known
+		}
+		return ranks[i].known && ranks[i].intensity < ranks[j].intensity
+	})
+	return ranks
+}
+
+// renderPriorities writes the priority expander configuration ranking ranks,
+// node groups of equal intensity sharing a priority. The node groups matched
+// by no hint stay eligible with the lowest priority. It returns "" for no
+// ranks.
+func renderPriorities(ranks []nodeGroupRank) string {
+	if len(ranks) == 0 {
+		return ""
+	}
+	levels := map[int][]string{fallbackPriority: {".*"}}
+	priority := (len(ranks) + 1) * hintedPriorityStep
+	for i, rank := range ranks {
+		if i > 0 && !(rank.known == ranks[i-1].known && math.Abs(rank.intensity-ranks[i-1].intensity) < 0.5) {
+			priority -= hintedPriorityStep
+		}
+		levels[priority] = append(levels[priority], rank.pattern)
+	}
+	keys := make([]int, 0, len(levels))
+	for key := range levels {
+		keys = append(keys, key)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(keys)))
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%d:\n", key)
+		for _, pattern := range levels[key] {
+			// Double-quoted so that patterns such as ".*" stay plain YAML strings
+			fmt.Fprintf(&b, "  - %s\n", strconv.Quote(pattern))
+		}
+	}
+	return b.String()
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *AutoscalerHintsReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	singleton := handler.EnqueueRequestsFromMapFunc(func(context.Context, client.Object) []reconcile.Request {
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: autoscalerHintsReconcileTarget}}}
+	})
+	target := r.ConfigMap
+	priorityConfigMap := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return obj.GetNamespace() == target.Namespace && obj.GetName() == target.Name
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("autoscalerhints").
+		Watches(&schedulingv1alpha1.TrafficSchedule{}, singleton).
+		Watches(&corev1.ConfigMap{}, singleton, builder.WithPredicates(predicate.Or(killSwitchPredicate(r.KillSwitchNamespace), priorityConfigMap))).
+		Complete(r)
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/utils/ptr"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func hintedSchedule(throttle string, zones map[string]string, hints ...schedulingv1alpha1.NodeGroupHint) schedulingv1alpha1.TrafficSchedule {
+	return schedulingv1alpha1.TrafficSchedule{
+		Spec: schedulingv1alpha1.TrafficScheduleSpec{
+			AutoscalerHints: schedulingv1alpha1.AutoscalerHintsConfig{Enabled: true, NodeGroups: hints},
+		},
+		Status: schedulingv1alpha1.TrafficScheduleStatus{ProcessingThrottle: throttle, ZoneForecasts: zones},
+	}
+}
+
+func TestRankNodeGroups(t *testing.T) {
+	zones := map[string]string{"eu/north": "40", "eu/south": "300"}
+	north := schedulingv1alpha1.NodeGroupHint{Pattern: "north-.*", Zone: "eu/north"}
+	south := schedulingv1alpha1.NodeGroupHint{Pattern: "south-.*", Zone: "eu/south"}
+	solar := schedulingv1alpha1.NodeGroupHint{Pattern: "solar-.*", Intensity: ptr.To("10")}
+	unknown := schedulingv1alpha1.NodeGroupHint{Pattern: "east-.*", Zone: "eu/east"}
+
+	disabled := hintedSchedule("0.5", zones, north)
+	disabled.Spec.AutoscalerHints.Enabled = false
+	tests := []struct {
+		name      string
+		schedules []schedulingv1alpha1.TrafficSchedule
+		want      []nodeGroupRank
+	}{
+		{name: "not throttled", schedules: []schedulingv1alpha1.TrafficSchedule{hintedSchedule("1", zones, north, south)}},
+		{name: "disabled", schedules: []schedulingv1alpha1.TrafficSchedule{disabled}},
+		{
+			name:      "greenest first, unknown last",
+			schedules: []schedulingv1alpha1.TrafficSchedule{hintedSchedule("0.5", zones, unknown, south, north, solar)},
+			want: []nodeGroupRank{
+				{pattern: "solar-.*", intensity: 10, known: true},
+				{pattern: "north-.*", intensity: 40, known: true},
+				{pattern: "south-.*", intensity: 300, known: true},
+				{pattern: "east-.*"},
+			},
+		},
+		{
+			name: "averaged over the schedules",
+			schedules: []schedulingv1alpha1.TrafficSchedule{
+				hintedSchedule("0.5", zones, north),
+				hintedSchedule("0.2", map[string]string{"eu/north": "60"}, north),
+			},
+			want: []nodeGroupRank{{pattern: "north-.*", intensity: 50, known: true}},
+		},
+		{
+			name:      "invalid patterns are skipped",
+			schedules: []schedulingv1alpha1.TrafficSchedule{hintedSchedule("0.5", zones, schedulingv1alpha1.NodeGroupHint{Pattern: "(", Zone: "eu/north"}, north)},
+			want:      []nodeGroupRank{{pattern: "north-.*", intensity: 40, known: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rankNodeGroups(context.Background(), tt.schedules)
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderPriorities(t *testing.T) {
+	tests := []struct {
+		name  string
+		ranks []nodeGroupRank
+		want  string
+	}{
+		{name: "no ranks"},
+		{
+			name: "ranked",
+			ranks: []nodeGroupRank{
+				{pattern: "solar-.*", intensity: 10, known: true},
+				{pattern: "north-.*", intensity: 40, known: true},
+				{pattern: "east-.*"},
+			},
+			want: "40:\n  - \"solar-.*\"\n30:\n  - \"north-.*\"\n20:\n  - \"east-.*\"\n1:\n  - \".*\"\n",
+		},
+		{
+			name: "equal intensities share a priority",
+			ranks: []nodeGroupRank{
+				{pattern: "a", intensity: 40, known: true},
+				{pattern: "b", intensity: 40.2, known: true},
+				{pattern: "c", intensity: 90, known: true},
+			},
+			want: "40:\n  - \"a\"\n  - \"b\"\n30:\n  - \"c\"\n1:\n  - \".*\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderPriorities(tt.ranks); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	// deferLabel opts a Job or CronJob in to carbon-aware deferral.
+	deferLabel = "carbonrouter/defer"
+	// deferMaxDelayAnnotation bounds how long a Job waits for a green window
+	// after its creation, as a Go duration. deferThresholdAnnotation is the
+	// intensity, in gCO2/kWh, at or below which it runs right away.
+	deferMaxDelayAnnotation  = "carbonrouter.io/defer-max-delay"
+	deferThresholdAnnotation = "carbonrouter.io/defer-threshold"
+	// deferredUntilAnnotation is when a waiting Job is planned to run, and
+	// releasedAnnotation when and why it was let run.
+	deferredUntilAnnotation = "carbonrouter.io/deferred-until"
+	releasedAnnotation      = "carbonrouter.io/released"
+	defaultDeferMaxDelay    = 12 * time.Hour
+	// deferralResync re-evaluates waiting Jobs between forecast updates.
+	deferralResync = 10 * time.Minute
+)
+
+// BatchDeferralReconciler holds the Jobs labelled carbonrouter/defer=true
+// suspended until a green window of the forecast of their TrafficSchedule,
+// bound as for a Service with the labels of the Job, or until their maximum
+// delay. Jobs are best created suspended: the ones that are not are suspended
+// as long as they have not started.
+type BatchDeferralReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// KillSwitchNamespace holds the emergency kill-switch ConfigMap, which
+	// releases every Job; empty disables it.
+	KillSwitchNamespace string
+	// Recorder records Events on the deferred Jobs; optional.
+	Recorder record.EventRecorder
+}
+
+// deferral is what a deferred Job does now.
+type deferral struct {
+	release bool
+	reason  string
+	// until is when the Job is planned to run while it waits.
+	until time.Time
+}
+
+// decideDeferral releases a Job past its deadline, without a forecast, at or
+// below threshold when set, or else when no upcoming slot before the deadline
+// is greener than now. Otherwise it waits for the first slot at or below the
+// threshold, or for the greenest one, and at most until the deadline.
+func decideDeferral(status *schedulingv1alpha1.TrafficScheduleStatus, threshold *float64, deadline, now time.Time) deferral {
+	if !now.Before(deadline) {
+		return deferral{release: true, reason: "maximum delay reached"}
+	}
+	if status == nil {
+		return deferral{release: true, reason: "no TrafficSchedule applies"}
+	}
+	current, err := strconv.ParseFloat(strings.TrimSpace(status.CarbonForecastNow), 64)
+	if err != nil {
+		return deferral{release: true, reason: "no carbon forecast"}
+	}
+	var slots []schedulingv1alpha1.ForecastSlot
+	for _, slot := range upcomingForecast(status.ForecastSchedule, now) {
+		if from, err := time.Parse(time.RFC3339, slot.From); err == nil && from.Before(deadline) {
+			slots = append(slots, slot)
+		}
+	}
+	if threshold != nil {
+		if current <= *threshold {
+			return deferral{release: true, reason: fmt.Sprintf("intensity %s gCO2/kWh at or below the threshold", formatFloat(current))}
+		}
+		for _, slot := range slots {
+			if forecast, err := strconv.ParseFloat(slot.Forecast, 64); err == nil && forecast <= *threshold {
+				return deferral{until: slotStart(slot, now)}
+			}
+		}
+		return deferral{until: deadline}
+	}
+	green := greenWindow(slots)
+	if green == nil {
+		return deferral{release: true, reason: "no forecast before the maximum delay"}
+	}
+	if forecast, _ := strconv.ParseFloat(green.Forecast, 64); current <= forecast || !slotStart(*green, now).After(now) {
+		return deferral{release: true, reason: fmt.Sprintf("greenest window before the maximum delay, %s gCO2/kWh", formatFloat(current))}
+	}
+	return deferral{until: slotStart(*green, now)}
+}
+
+func slotStart(slot schedulingv1alpha1.ForecastSlot, now time.Time) time.Time {
+	from, err := time.Parse(time.RFC3339, slot.From)
+	if err != nil || from.Before(now) {
+		return now
+	}
+	return from
+}
+
+// deferralSettings reads the maximum delay and threshold of obj, skipping the
+// annotations that do not parse.
+func deferralSettings(recorder record.EventRecorder, obj client.Object) (time.Duration, *float64) {
+	maxDelay := defaultDeferMaxDelay
+	if value, ok := obj.GetAnnotations()[deferMaxDelayAnnotation]; ok {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			recordEvent(recorder, obj, corev1.EventTypeWarning, eventInvalidDeferral, "Ignoring %s %q: not a duration", deferMaxDelayAnnotation, value)
+		} else {
+			maxDelay = parsed
+		}
+	}
+	var threshold *float64
+	if value, ok := obj.GetAnnotations()[deferThresholdAnnotation]; ok {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			recordEvent(recorder, obj, corev1.EventTypeWarning, eventInvalidDeferral, "Ignoring %s %q: not a number", deferThresholdAnnotation, value)
+		} else {
+			threshold = &parsed
+		}
+	}
+	return maxDelay, threshold
+}
+
+func jobFinished(job *batchv1.Job) bool {
+	for _, cond := range job.Status.Conditions {
+		if (cond.Type == batchv1.JobComplete || cond.Type == batchv1.JobFailed) && cond.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// +kubebuilder:rbac:groups=batch,resources=jobs;cronjobs,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=scheduling.carbonrouter.io,resources=trafficschedules,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+
+func (r *BatchDeferralReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx).WithName("[BatchDeferral]").WithValues("job", req.NamespacedName)
+
+	var job batchv1.Job
+	if err := r.Get(ctx, req.NamespacedName, &job); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if job.Labels[deferLabel] != "true" || job.Annotations[releasedAnnotation] != "" || !job.DeletionTimestamp.IsZero() || jobFinished(&job) {
+		return ctrl.Result{}, nil
+	}
+	if !ptr.Deref(job.Spec.Suspend, false) && (job.Status.StartTime != nil || job.Status.Active > 0) {
+		log.Info("Job started before it could be deferred, letting it run")
+		return ctrl.Result{}, r.release(ctx, &job, "started before it could be deferred")
+	}
+
+	killed, err := killSwitchEngaged(ctx, r.Client, r.KillSwitchNamespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if killed {
+		return ctrl.Result{}, r.release(ctx, &job, "kill-switch engaged")
+	}
+	var tsList schedulingv1alpha1.TrafficScheduleList
+	if err := r.List(ctx, &tsList); err != nil {
+		return ctrl.Result{}, err
+	}
+	// Jobs bind to schedules as Services do, by namespace and labels
+	ts, _, errs := bindSchedule(&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: job.Namespace, Labels: job.Labels}}, tsList.Items)
+	for _, err := range errs {
+		log.Error(err, "Ignoring TrafficSchedule")
+	}
+	var status *schedulingv1alpha1.TrafficScheduleStatus
+	if ts != nil {
+		status = &ts.Status
+	}
+	maxDelay, threshold := deferralSettings(r.Recorder, &job)
+	now := time.Now()
+	decision := decideDeferral(status, threshold, job.CreationTimestamp.Add(maxDelay), now)
+	if decision.release {
+		log.Info("Releasing deferred Job", "reason", decision.reason)
+		return ctrl.Result{}, r.release(ctx, &job, decision.reason)
+	}
+
+	until := decision.until.UTC().Format(time.RFC3339)
+	if !ptr.Deref(job.Spec.Suspend, false) || job.Annotations[deferredUntilAnnotation] != until {
+		patch := client.MergeFrom(job.DeepCopy())
+		job.Spec.Suspend = ptr.To(true)
+		if job.Annotations == nil {
+			job.Annotations = map[string]string{}
+		}
+		job.Annotations[deferredUntilAnnotation] = until
+		if err := r.Patch(ctx, &job, patch); err != nil {
+			return ctrl.Result{}, err
+		}
+		recordEvent(r.Recorder, &job, corev1.EventTypeNormal, eventJobDeferred, "Deferred until %s for a greener carbon window", until)
+	}
+	return ctrl.Result{RequeueAfter: min(deferralResync, max(time.Second, decision.until.Sub(now)))}, nil
+}
+
+// release lets job run and records why.
+func (r *BatchDeferralReconciler) release(ctx context.Context, job *batchv1.Job, reason string) error {
+	patch := client.MergeFrom(job.DeepCopy())
+	job.Spec.Suspend = ptr.To(false)
+	if job.Annotations == nil {
+		job.Annotations = map[string]string{}
+	}
+	delete(job.Annotations, deferredUntilAnnotation)
+	job.Annotations[releasedAnnotation] = fmt.Sprintf("%s: %s", time.Now().UTC().Format(time.RFC3339), reason)
+	if err := r.Patch(ctx, job, patch); err != nil {
+		return err
+	}
+	recordEvent(r.Recorder, job, corev1.EventTypeNormal, eventJobReleased, "Released: %s", reason)
+	return nil
+}
+
+// waitingJobs maps a forecast or kill-switch change to every Job waiting for
+// a green window.
+func (r *BatchDeferralReconciler) waitingJobs(ctx context.Context, _ client.Object) []reconcile.Request {
+	var jobs batchv1.JobList
+	if err := r.List(ctx, &jobs, client.MatchingLabels{deferLabel: "true"}); err != nil {
+		ctrl.LoggerFrom(ctx).WithName("[BatchDeferral]").Error(err, "Failed to list deferred Jobs")
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, job := range jobs.Items {
+		if job.Annotations[releasedAnnotation] == "" {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&job)})
+		}
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *BatchDeferralReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	deferred := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return obj.GetLabels()[deferLabel] == "true"
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("batchdeferral").
+		For(&batchv1.Job{}, builder.WithPredicates(deferred)).
+		Watches(&schedulingv1alpha1.TrafficSchedule{}, handler.EnqueueRequestsFromMapFunc(r.waitingJobs)).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.waitingJobs), builder.WithPredicates(killSwitchPredicate(r.KillSwitchNamespace))).
+		Complete(r)
+}
+
+// CronJobDeferralReconciler makes the CronJobs labelled carbonrouter/defer=true
+// create their Jobs suspended, labelled and annotated for the
+// BatchDeferralReconciler, and undoes it when the label is removed.
+type CronJobDeferralReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+func (r *CronJobDeferralReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	var cronJob batchv1.CronJob
+	if err := r.Get(ctx, req.NamespacedName, &cronJob); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	template := cronJob.Spec.JobTemplate.DeepCopy()
+	if cronJob.Labels[deferLabel] == "true" {
+		template.Spec.Suspend = ptr.To(true)
+		if template.Labels == nil {
+			template.Labels = map[string]string{}
+		}
+		template.Labels[deferLabel] = "true"
+		for _, key := range []string{deferMaxDelayAnnotation, deferThresholdAnnotation} {
+			if value, ok := cronJob.Annotations[key]; ok {
+				if template.Annotations == nil {
+					template.Annotations = map[string]string{}
+				}
+				template.Annotations[key] = value
+			} else {
+				delete(template.Annotations, key)
+			}
+		}
+	} else if template.Labels[deferLabel] == "true" {
+		template.Spec.Suspend = nil
+		delete(template.Labels, deferLabel)
+		delete(template.Annotations, deferMaxDelayAnnotation)
+		delete(template.Annotations, deferThresholdAnnotation)
+	}
+	if equality.Semantic.DeepEqual(*template, cronJob.Spec.JobTemplate) {
+		return ctrl.Result{}, nil
+	}
+	ctrl.LoggerFrom(ctx).WithName("[BatchDeferral]").Info("Updating the job template of CronJob", "cronjob", req.NamespacedName, "deferred", cronJob.Labels[deferLabel] == "true")
+	patch := client.MergeFrom(cronJob.DeepCopy())
+	cronJob.Spec.JobTemplate = *template
+	return ctrl.Result{}, r.Patch(ctx, &cronJob, patch)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CronJobDeferralReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Removing the label must reach the controller too
+	deferred := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		cronJob, ok := obj.(*batchv1.CronJob)
+		return ok && (cronJob.Labels[deferLabel] == "true" || cronJob.Spec.JobTemplate.Labels[deferLabel] == "true")
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("cronjobdeferral").
+		For(&batchv1.CronJob{}, builder.WithPredicates(deferred)).
+		Complete(r)
+}
@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	defaultBrokerHost    = "carbonrouter-rabbitmq.carbonrouter-system.svc.cluster.local"
+	defaultBrokerPort    = 5672
+	defaultBrokerVHost   = "/"
+	brokerManagementPort = 15672
+	brokerUsernameKey    = "username"
+	brokerPasswordKey    = "password"
+)
+
+// errBrokerCredentialsMissing is returned for RabbitMQ brokers without
+// spec.broker.secretRef: there are no default credentials to fall back to.
+var errBrokerCredentialsMissing = errors.New("spec.broker.secretRef is required with the rabbitmq backend")
+
+// errOffline is returned by the broker calls of an offline reconciler, so
+// rendering never touches a live broker.
+var errOffline = errors.New("broker calls are disabled while rendering")
+
+// brokerEndpoint is the resolved broker address and credentials.
+type brokerEndpoint struct {
+	Host     string
+	Port     int32
+	VHost    string
+	Username string
+	Password string
+	// Naming renders the queue and exchange names on this broker.
+	Naming queueNaming
+}
+
+func brokerAddress(cfg schedulingv1alpha1.BrokerConfig) (string, int32, string) {
+	host := cfg.Host
+	if host == "" {
+		host = defaultBrokerHost
+	}
+	port := int32(defaultBrokerPort)
+	if cfg.Port != nil {
+		port = *cfg.Port
+	}
+	vhost := cfg.VHost
+	if vhost == "" {
+		vhost = defaultBrokerVHost
+	}
+	return host, port, vhost
+}
+
+// brokerEnv points a buffer service container at the broker. Credentials are
+// read from the Secret by the kubelet, so they never appear in the pod spec.
+func brokerEnv(cfg schedulingv1alpha1.BrokerConfig) []corev1.EnvVar {
+	host, port, vhost := brokerAddress(cfg)
+	env := []corev1.EnvVar{
+		{Name: "RABBITMQ_HOST", Value: host},
+		{Name: "RABBITMQ_PORT", Value: strconv.Itoa(int(port))},
+		{Name: "RABBITMQ_VHOST", Value: vhost},
+	}
+	if cfg.SecretRef == nil {
+		return env
+	}
+	secretKey := func(key string) *corev1.EnvVarSource {
+		return &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: *cfg.SecretRef, Key: key}}
+	}
+	return append(env,
+		corev1.EnvVar{Name: "RABBITMQ_USERNAME", ValueFrom: secretKey(brokerUsernameKey)},
+		corev1.EnvVar{Name: "RABBITMQ_PASSWORD", ValueFrom: secretKey(brokerPasswordKey)},
+	)
+}
+
+// errNoManagementAPI is returned for brokers other than RabbitMQ, whose queues
+// the operator neither inspects nor deletes.
+var errNoManagementAPI = errors.New("broker has no management API")
+
+// brokerFor resolves the broker of the Services in namespace. The Secret is
+// read uncached, so the operator does not watch every Secret in the cluster.
+func (r *FlavourRouterReconciler) brokerFor(ctx context.Context, namespace string, cfg schedulingv1alpha1.BrokerConfig) (brokerEndpoint, error) {
+	if r.Offline {
+		return brokerEndpoint{}, errOffline
+	}
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+	return resolveBroker(ctx, reader, namespace, cfg)
+}
+
+// resolveBroker resolves the broker of the Services in namespace, reading its
+// Secret through reader.
+func resolveBroker(ctx context.Context, reader client.Reader, namespace string, cfg schedulingv1alpha1.BrokerConfig) (brokerEndpoint, error) {
+	if brokerType(cfg) != brokerTypeRabbitMQ {
+		return brokerEndpoint{}, errNoManagementAPI
+	}
+	naming, err := queueNamingFor(cfg)
+	if err != nil {
+		return brokerEndpoint{}, err
+	}
+	host, port, vhost := brokerAddress(cfg)
+	endpoint := brokerEndpoint{Host: host, Port: port, VHost: vhost, Naming: naming}
+	if cfg.SecretRef == nil {
+		return brokerEndpoint{}, invalidConfigError(errBrokerCredentialsMissing)
+	}
+	var secret corev1.Secret
+	if err := reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: cfg.SecretRef.Name}, &secret); err != nil {
+		return brokerEndpoint{}, fmt.Errorf("broker secret %s/%s: %w", namespace, cfg.SecretRef.Name, err)
+	}
+	endpoint.Username = string(secret.Data[brokerUsernameKey])
+	endpoint.Password = string(secret.Data[brokerPasswordKey])
+	return endpoint, nil
+}
+
+// brokerForService resolves the broker of the schedule bound to svc, falling
+// back to the defaults when no schedule selects it any more.
+func (r *FlavourRouterReconciler) brokerForService(ctx context.Context, svc *corev1.Service) (brokerEndpoint, error) {
+	cfg, err := serviceBrokerConfig(ctx, r.Client, svc)
+	if err != nil {
+		return brokerEndpoint{}, err
+	}
+	return r.brokerFor(ctx, svc.Namespace, cfg)
+}
+
+// serviceBrokerConfig returns the broker settings of the schedule bound to
+// svc, pointed at the tenant of svc, or the defaults when no schedule selects
+// it.
+func serviceBrokerConfig(ctx context.Context, reader client.Reader, svc *corev1.Service) (schedulingv1alpha1.BrokerConfig, error) {
+	cfg, err := boundBrokerConfig(ctx, reader, svc)
+	if err != nil {
+		return cfg, err
+	}
+	return withBrokerTenant(cfg, svc.Namespace, svc.Name)
+}
+
+// boundBrokerConfig returns the broker settings of the schedule bound to svc,
+// with the credentials that manage its tenants.
+func boundBrokerConfig(ctx context.Context, reader client.Reader, svc *corev1.Service) (schedulingv1alpha1.BrokerConfig, error) {
+	var schedules schedulingv1alpha1.TrafficScheduleList
+	if err := reader.List(ctx, &schedules); err != nil {
+		return schedulingv1alpha1.BrokerConfig{}, err
+	}
+	ts, _, _ := bindSchedule(svc, schedules.Items)
+	if ts == nil {
+		return schedulingv1alpha1.BrokerConfig{}, nil
+	}
+	return withProvisionedBroker(ts.Spec.Broker, ts.Namespace)
+}
+
+// managementRequest builds an authenticated request to the RabbitMQ management
+// API; path is relative to /api and must already be escaped. A non-nil body is
+// sent as JSON.
+func (b brokerEndpoint) managementRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	target := fmt.Sprintf("http://%s:%d/api/%s", b.Host, brokerManagementPort, path)
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(b.Username, b.Password)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// managementPath joins the escaped vhost and resource name under kind.
+func (b brokerEndpoint) managementPath(kind, name string) string {
+	return fmt.Sprintf("%s/%s/%s", kind, url.PathEscape(b.VHost), url.PathEscape(name))
+}
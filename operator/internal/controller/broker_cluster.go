@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	// provisionedBrokerName names the RabbitmqCluster of a namespace after the
+	// broker of the chart.
+	provisionedBrokerName = "carbonrouter-rabbitmq"
+	// provisionedBrokerURIKey holds the AMQP URI of the broker in the default
+	// user Secret of the Cluster Operator.
+	provisionedBrokerURIKey = "connection_string"
+)
+
+var rabbitmqClusterGVK = schema.GroupVersionKind{Group: "rabbitmq.com", Version: "v1beta1", Kind: "RabbitmqCluster"}
+
+// withProvisionedBroker points cfg at the RabbitmqCluster that
+// spec.broker.cluster provisions in namespace, the namespace of the schedule.
+// The Cluster Operator names the Service of the broker after the cluster and
+// keeps the default user in a Secret with a "-default-user" suffix, under the
+// keys brokerFor reads. Services in other namespaces read the copy
+// ensureProvisionedBrokerSecret makes in theirs.
+func withProvisionedBroker(cfg schedulingv1alpha1.BrokerConfig, namespace string) (schedulingv1alpha1.BrokerConfig, error) {
+	if cfg.Cluster == nil {
+		return cfg, nil
+	}
+	if brokerType(cfg) != brokerTypeRabbitMQ {
+		return cfg, invalidConfigError(fmt.Errorf("spec.broker.cluster requires the rabbitmq backend"))
+	}
+	if cfg.Host != "" || cfg.Port != nil || cfg.SecretRef != nil {
+		return cfg, invalidConfigError(fmt.Errorf("spec.broker.cluster cannot be combined with spec.broker.host, port or secretRef"))
+	}
+	cfg.Host = fmt.Sprintf("%s.%s.svc.cluster.local", provisionedBrokerName, namespace)
+	cfg.SecretRef = &corev1.LocalObjectReference{Name: provisionedBrokerName + "-default-user"}
+	return cfg, nil
+}
+
+// ensureProvisionedBrokerSecret copies the default user Secret of the broker
+// provisioned in namespace to the namespace of svc, where the buffer services,
+// KEDA and brokerFor resolve cfg.SecretRef. The copy is owned by every Service
+// using it, so it goes away with the last one.
+func (r *FlavourRouterReconciler) ensureProvisionedBrokerSecret(ctx context.Context, svc *corev1.Service, cfg schedulingv1alpha1.BrokerConfig, namespace string) error {
+	if cfg.Cluster == nil || cfg.SecretRef == nil || svc.Namespace == namespace || r.Offline {
+		return nil
+	}
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+	name := cfg.SecretRef.Name
+	var source corev1.Secret
+	if err := reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &source); err != nil {
+		if apierrors.IsNotFound(err) {
+			return dependencyMissingError(fmt.Errorf("broker secret %s/%s is not there yet: %w", namespace, name, err))
+		}
+		return err
+	}
+
+	var existing corev1.Secret
+	err := reader.Get(ctx, client.ObjectKey{Namespace: svc.Namespace, Name: name}, &existing)
+	switch {
+	case apierrors.IsNotFound(err):
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: svc.Namespace,
+				Labels:    map[string]string{"app.kubernetes.io/managed-by": "carbonrouter-operator"},
+			},
+			Data: source.Data,
+		}
+		if err := controllerutil.SetOwnerReference(svc, secret, r.Scheme); err != nil {
+			return err
+		}
+		if err := r.Create(ctx, secret); err != nil {
+			return err
+		}
+		r.track(svc, "Secret", svc.Namespace, name, nil, true)
+		return nil
+	case err != nil:
+		return err
+	}
+	if existing.Labels["app.kubernetes.io/managed-by"] != "carbonrouter-operator" {
+		return invalidConfigError(fmt.Errorf("secret %s/%s is not managed by the operator, remove it to use spec.broker.cluster from namespace %s", svc.Namespace, name, namespace))
+	}
+	owners := len(existing.OwnerReferences)
+	patch := client.MergeFrom(existing.DeepCopy())
+	if err := controllerutil.SetOwnerReference(svc, &existing, r.Scheme); err != nil {
+		return err
+	}
+	// The Cluster Operator rotates the password in the source
+	rotated := !maps.EqualFunc(existing.Data, source.Data, bytes.Equal)
+	if !rotated && len(existing.OwnerReferences) == owners {
+		r.track(svc, "Secret", svc.Namespace, name, nil, false)
+		return nil
+	}
+	existing.Data = source.Data
+	if err := r.Patch(ctx, &existing, patch); err != nil {
+		return err
+	}
+	r.track(svc, "Secret", svc.Namespace, name, nil, true)
+	return nil
+}
+
+// brokerClusterSpec renders the RabbitmqCluster spec of cfg, leaving unset
+// fields to the defaults of the Cluster Operator.
+func brokerClusterSpec(cfg schedulingv1alpha1.RabbitMQClusterConfig) (map[string]interface{}, error) {
+	replicas := int64(1)
+	if cfg.Replicas != nil {
+		replicas = int64(*cfg.Replicas)
+	}
+	spec := map[string]interface{}{"replicas": replicas}
+	if cfg.Image != "" {
+		spec["image"] = cfg.Image
+	}
+	persistence := map[string]interface{}{}
+	if cfg.Storage != nil {
+		persistence["storage"] = cfg.Storage.String()
+	}
+	if cfg.StorageClassName != "" {
+		persistence["storageClassName"] = cfg.StorageClassName
+	}
+	if len(persistence) > 0 {
+		spec["persistence"] = persistence
+	}
+	if cfg.Resources != nil {
+		resources, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cfg.Resources)
+		if err != nil {
+			return nil, err
+		}
+		spec["resources"] = resources
+	}
+	return spec, nil
+}
+
+// ensureBrokerCluster applies the RabbitmqCluster ts asks for, adding ts to its
+// owners, or deletes it once no schedule of the namespace asks for one. Every
+// schedule applies it as a field manager of its own, so the owner references
+// of the others are kept and the cluster goes away with the last of them.
+func (r *TrafficScheduleReconciler) ensureBrokerCluster(ctx context.Context, ts *schedulingv1alpha1.TrafficSchedule) error {
+	cfg := ts.Spec.Broker
+	if cfg.Cluster == nil {
+		return r.retireBrokerCluster(ctx, ts.Namespace)
+	}
+	if _, err := withProvisionedBroker(cfg, ts.Namespace); err != nil {
+		return err
+	}
+	spec, err := brokerClusterSpec(*cfg.Cluster)
+	if err != nil {
+		return err
+	}
+	cluster := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	cluster.SetGroupVersionKind(rabbitmqClusterGVK)
+	cluster.SetName(provisionedBrokerName)
+	cluster.SetNamespace(ts.Namespace)
+	cluster.SetLabels(map[string]string{"app.kubernetes.io/managed-by": "carbonrouter-operator"})
+	if err := controllerutil.SetOwnerReference(ts, cluster, r.Scheme); err != nil {
+		return err
+	}
+	err = r.Patch(ctx, cluster, client.Apply, client.FieldOwner(fieldManager+"-"+ts.Name), client.ForceOwnership)
+	if meta.IsNoMatchError(err) {
+		return invalidConfigError(fmt.Errorf("spec.broker.cluster requires the RabbitMQ Cluster Operator: %w", err))
+	}
+	return err
+}
+
+// retireBrokerCluster deletes the RabbitmqCluster the operator provisioned in
+// namespace when none of its schedules asks for it any more. Clusters without
+// the Cluster Operator have nothing to delete.
+func (r *TrafficScheduleReconciler) retireBrokerCluster(ctx context.Context, namespace string) error {
+	var schedules schedulingv1alpha1.TrafficScheduleList
+	if err := r.List(ctx, &schedules, client.InNamespace(namespace)); err != nil {
+		return err
+	}
+	for _, ts := range schedules.Items {
+		if ts.Spec.Broker.Cluster != nil && ts.DeletionTimestamp.IsZero() {
+			return nil
+		}
+	}
+	cluster := &unstructured.Unstructured{}
+	cluster.SetGroupVersionKind(rabbitmqClusterGVK)
+	if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: provisionedBrokerName}, cluster); err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil
+		}
+		return client.IgnoreNotFound(err)
+	}
+	// A cluster the operator did not create is left alone
+	if cluster.GetLabels()["app.kubernetes.io/managed-by"] != "carbonrouter-operator" {
+		return nil
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, cluster))
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestEnsureProvisionedBrokerSecret(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	secretName := provisionedBrokerName + "-default-user"
+	source := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "carbon", Name: secretName},
+		Data:       map[string][]byte{brokerUsernameKey: []byte("admin"), brokerPasswordKey: []byte("first")},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(source).Build()
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme}
+	cfg, err := withProvisionedBroker(schedulingv1alpha1.BrokerConfig{Cluster: &schedulingv1alpha1.RabbitMQClusterConfig{}}, "carbon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := func(namespace, name string) *corev1.Service {
+		return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: types.UID(name)}}
+	}
+	copied := func() *corev1.Secret {
+		var secret corev1.Secret
+		if err := c.Get(context.Background(), client.ObjectKey{Namespace: "shop", Name: secretName}, &secret); err != nil {
+			t.Fatalf("copy missing: %v", err)
+		}
+		return &secret
+	}
+
+	if err := r.ensureProvisionedBrokerSecret(context.Background(), service("carbon", "checkout"), cfg, "carbon"); err != nil {
+		t.Fatalf("same namespace: %v", err)
+	}
+	if err := r.ensureProvisionedBrokerSecret(context.Background(), service("shop", "checkout"), cfg, "carbon"); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	if got := string(copied().Data[brokerPasswordKey]); got != "first" {
+		t.Errorf("got password %q, want the source one", got)
+	}
+
+	source.Data[brokerPasswordKey] = []byte("rotated")
+	if err := c.Update(context.Background(), source); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ensureProvisionedBrokerSecret(context.Background(), service("shop", "cart"), cfg, "carbon"); err != nil {
+		t.Fatalf("second service: %v", err)
+	}
+	secret := copied()
+	if got := string(secret.Data[brokerPasswordKey]); got != "rotated" {
+		t.Errorf("got password %q, want the rotated one", got)
+	}
+	if len(secret.OwnerReferences) != 2 {
+		t.Errorf("got %d owners, want both Services", len(secret.OwnerReferences))
+	}
+
+	if err := c.Delete(context.Background(), source); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ensureProvisionedBrokerSecret(context.Background(), service("shop", "cart"), cfg, "carbon"); classify(err) != failureDependencyMissing {
+		t.Errorf("missing source: got %v, want a missing dependency", err)
+	}
+}
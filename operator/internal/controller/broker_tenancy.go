@@ -0,0 +1,313 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	tenantIsolationShared    = "shared"
+	tenantIsolationNamespace = "namespace"
+	tenantIsolationService   = "service"
+
+	// tenantPrefix starts the vhost and user names of the tenants, keeping
+	// them apart from those created by hand.
+	tenantPrefix        = "carbonrouter."
+	tenantSecretName    = "carbonrouter-broker-tenant"
+	tenantPasswordBytes = 24
+)
+
+// brokerTenant is the vhost and user of the Services isolated together, and
+// the Secret holding its credentials in the namespace of the Service.
+type brokerTenant struct {
+	VHost  string
+	User   string
+	Secret string
+}
+
+func tenantIsolation(cfg schedulingv1alpha1.BrokerConfig) string {
+	if cfg.Tenancy.Isolation == "" {
+		return tenantIsolationShared
+	}
+	return cfg.Tenancy.Isolation
+}
+
+// brokerTenantFor returns the tenant of the Service namespace/service under
+// isolation. Shared Services have none.
+func brokerTenantFor(isolation, namespace, service string) (brokerTenant, bool) {
+	switch isolation {
+	case tenantIsolationNamespace:
+		return brokerTenant{VHost: tenantPrefix + namespace, User: tenantPrefix + namespace, Secret: tenantSecretName}, true
+	case tenantIsolationService:
+		name := tenantPrefix + namespace + "." + service
+		return brokerTenant{VHost: name, User: name, Secret: service + "-" + tenantSecretName}, true
+	}
+	return brokerTenant{}, false
+}
+
+// withBrokerTenant points cfg at the tenant of the Service namespace/service,
+// so the buffer services, KEDA and the management API calls of the operator
+// all use its vhost and credentials. The credentials of spec.broker are only
+// used to manage the tenant, see ensureBrokerTenant.
+func withBrokerTenant(cfg schedulingv1alpha1.BrokerConfig, namespace, service string) (schedulingv1alpha1.BrokerConfig, error) {
+	if err := validateBrokerTenancy(cfg); err != nil {
+		return cfg, err
+	}
+	tenant, ok := brokerTenantFor(tenantIsolation(cfg), namespace, service)
+	if !ok {
+		return cfg, nil
+	}
+	cfg.VHost = tenant.VHost
+	cfg.SecretRef = &corev1.LocalObjectReference{Name: tenant.Secret}
+	return cfg, nil
+}
+
+func validateBrokerTenancy(cfg schedulingv1alpha1.BrokerConfig) error {
+	tenancy := cfg.Tenancy
+	if tenantIsolation(cfg) == tenantIsolationShared {
+		if tenancy.MaxQueues != nil || tenancy.MaxConnections != nil {
+			return invalidConfigError(fmt.Errorf("spec.broker.tenancy limits require the namespace or service isolation"))
+		}
+		return nil
+	}
+	if brokerType(cfg) != brokerTypeRabbitMQ {
+		return invalidConfigError(fmt.Errorf("spec.broker.tenancy requires the rabbitmq backend"))
+	}
+	if cfg.VHost != "" {
+		return invalidConfigError(fmt.Errorf("spec.broker.tenancy cannot be combined with spec.broker.vhost"))
+	}
+	return nil
+}
+
+// ensureBrokerTenant creates the vhost and user of the tenant of svc, with
+// full permissions on the vhost and the limits of spec.broker.tenancy, through
+// the management API with the credentials of cfg, and the Secret handing its
+// credentials to the buffer services. The password is generated once and kept
+// in the Secret, which the user is reset to on every sync, so deleting the
+// Secret rotates it. Like the queue topology, the tenant is re-declared every
+// ten minutes and whenever it changes.
+func (r *FlavourRouterReconciler) ensureBrokerTenant(ctx context.Context, svc *corev1.Service, cfg schedulingv1alpha1.BrokerConfig) error {
+	if err := validateBrokerTenancy(cfg); err != nil {
+		return err
+	}
+	tenant, ok := brokerTenantFor(tenantIsolation(cfg), svc.Namespace, svc.Name)
+	if !ok || r.Offline {
+		return nil
+	}
+	admin, err := r.brokerFor(ctx, svc.Namespace, cfg)
+	if err != nil {
+		return err
+	}
+	key := client.ObjectKeyFromObject(svc)
+	desired := fmt.Sprintf("%s|%s:%d|%s|%s", tenant.VHost, admin.Host, admin.Port,
+		limitValue(cfg.Tenancy.MaxQueues), limitValue(cfg.Tenancy.MaxConnections))
+	state := r.brokerTenants.get(key)
+	if state.applied == desired && time.Since(state.syncedAt) < queueTopologyResync {
+		return nil
+	}
+
+	password, err := r.ensureTenantSecret(ctx, svc, tenant, admin)
+	if err != nil {
+		return err
+	}
+	vhost := url.PathEscape(tenant.VHost)
+	user := url.PathEscape(tenant.User)
+	calls := []struct {
+		path string
+		body interface{}
+	}{
+		{"vhosts/" + vhost, map[string]interface{}{"description": "carbonrouter tenant of " + svc.Namespace}},
+		// policymaker lets the operator manage the queues and policies of the
+		// tenant with its credentials, within its vhost only
+		{"users/" + user, map[string]interface{}{"password": password, "tags": "policymaker"}},
+		{"permissions/" + vhost + "/" + user, map[string]interface{}{"configure": ".*", "write": ".*", "read": ".*"}},
+		{"vhost-limits/" + vhost + "/max-queues", map[string]interface{}{"value": vhostLimit(cfg.Tenancy.MaxQueues)}},
+		{"vhost-limits/" + vhost + "/max-connections", map[string]interface{}{"value": vhostLimit(cfg.Tenancy.MaxConnections)}},
+	}
+	for _, call := range calls {
+		if err := managementCall(ctx, admin, http.MethodPut, call.path, call.body, nil); err != nil {
+			return err
+		}
+	}
+	r.brokerTenants.set(key, queueTopologyState{applied: desired, syncedAt: time.Now()})
+	return nil
+}
+
+// ensureTenantSecret returns the password of tenant, applying its Secret with
+// a new one when missing and keeping the connection string in line with the
+// broker address. The Secret of a Service tenant goes away with the Service;
+// the one of a namespace tenant is shared and goes away with the last Service
+// of the namespace, see retireBrokerTenant. Secrets are not cached, so the
+// Secret is read through the APIReader and applied directly instead of with
+// apply.
+func (r *FlavourRouterReconciler) ensureTenantSecret(ctx context.Context, svc *corev1.Service, tenant brokerTenant, admin brokerEndpoint) (string, error) {
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+	var existing corev1.Secret
+	err := reader.Get(ctx, client.ObjectKey{Namespace: svc.Namespace, Name: tenant.Secret}, &existing)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+	created := apierrors.IsNotFound(err)
+	password := string(existing.Data[brokerPasswordKey])
+	if password == "" {
+		// A Secret without a password, e.g. emptied by hand, is refilled
+		random := make([]byte, tenantPasswordBytes)
+		if _, err := rand.Read(random); err != nil {
+			return "", err
+		}
+		password = hex.EncodeToString(random)
+	}
+	data := tenantSecretData(tenant, admin, password)
+	if !created && bytes.Equal(existing.Data[brokerPasswordKey], data[brokerPasswordKey]) &&
+		bytes.Equal(existing.Data[brokerUsernameKey], data[brokerUsernameKey]) &&
+		bytes.Equal(existing.Data[provisionedBrokerURIKey], data[provisionedBrokerURIKey]) {
+		r.track(svc, "Secret", svc.Namespace, tenant.Secret, tenant, false)
+		return password, nil
+	}
+
+	secret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      tenant.Secret,
+			Namespace: svc.Namespace,
+			Labels:    map[string]string{"app.kubernetes.io/managed-by": "carbonrouter-operator"},
+		},
+		Data: data,
+	}
+	if tenant.Secret != tenantSecretName {
+		secret.Labels[parentServiceLabel] = svc.Name
+		if err := ctrl.SetControllerReference(svc, secret, r.Scheme); err != nil {
+			return "", err
+		}
+	}
+	if err := r.Patch(ctx, secret, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership); err != nil {
+		return "", err
+	}
+	if created {
+		recordEvent(r.Recorder, svc, corev1.EventTypeNormal, "CreatedSecret", "Created broker tenant credentials %s", tenant.Secret)
+	}
+	r.track(svc, "Secret", svc.Namespace, tenant.Secret, tenant, true)
+	return password, nil
+}
+
+// tenantSecretData holds the credentials of tenant under the keys brokerFor
+// reads, and the AMQP URI of its vhost that KEDA reads.
+func tenantSecretData(tenant brokerTenant, admin brokerEndpoint, password string) map[string][]byte {
+	uri := url.URL{
+		Scheme:  "amqp",
+		User:    url.UserPassword(tenant.User, password),
+		Host:    net.JoinHostPort(admin.Host, strconv.Itoa(int(admin.Port))),
+		Path:    "/" + tenant.VHost,
+		RawPath: "/" + url.PathEscape(tenant.VHost),
+	}
+	return map[string][]byte{
+		brokerUsernameKey:       []byte(tenant.User),
+		brokerPasswordKey:       []byte(password),
+		provisionedBrokerURIKey: []byte(uri.String()),
+	}
+}
+
+// vhostLimit renders a vhost limit, where -1 lifts it.
+func vhostLimit(limit *int32) int32 {
+	if limit == nil {
+		return -1
+	}
+	return *limit
+}
+
+func limitValue(limit *int32) string {
+	return strconv.Itoa(int(vhostLimit(limit)))
+}
+
+// retireBrokerTenant deletes the vhost and user of the tenant of svc, which
+// drops its queues with them, and its Secret. A namespace tenant is shared by
+// the other Services of the namespace and only goes with the last of them.
+// The vhost of a Service moved back to the shared one stays.
+func (r *FlavourRouterReconciler) retireBrokerTenant(ctx context.Context, svc *corev1.Service) error {
+	cfg, err := boundBrokerConfig(ctx, r.Client, svc)
+	if err != nil {
+		return err
+	}
+	isolation := tenantIsolation(cfg)
+	tenant, ok := brokerTenantFor(isolation, svc.Namespace, svc.Name)
+	if !ok {
+		return nil
+	}
+	r.brokerTenants.forget(client.ObjectKeyFromObject(svc))
+	if isolation == tenantIsolationNamespace {
+		shared, err := r.namespaceTenantShared(ctx, svc)
+		if err != nil || shared {
+			return err
+		}
+	}
+	admin, err := r.brokerFor(ctx, svc.Namespace, cfg)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, path := range []string{"vhosts/" + url.PathEscape(tenant.VHost), "users/" + url.PathEscape(tenant.User)} {
+		req, err := admin.managementRequest(ctx, http.MethodDelete, path, nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode != http.StatusNotFound {
+			errs = append(errs, fmt.Errorf("delete %s: %s", path, resp.Status))
+		}
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: tenant.Secret, Namespace: svc.Namespace}}
+	if err := r.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+		errs = append(errs, err)
+	}
+	r.Inventory.Drop(client.ObjectKeyFromObject(svc), "Secret", svc.Namespace, tenant.Secret)
+	return errors.Join(errs...)
+}
+
+// namespaceTenantShared reports whether another Service of the namespace of
+// svc, not being deleted, still uses the namespace tenant.
+func (r *FlavourRouterReconciler) namespaceTenantShared(ctx context.Context, svc *corev1.Service) (bool, error) {
+	services, err := listRoutedServices(ctx, r.Client, client.InNamespace(svc.Namespace))
+	if err != nil {
+		return false, err
+	}
+	for i := range services {
+		other := &services[i]
+		if other.Name == svc.Name || !other.DeletionTimestamp.IsZero() {
+			continue
+		}
+		cfg, err := boundBrokerConfig(ctx, r.Client, other)
+		if err != nil {
+			return false, err
+		}
+		if tenantIsolation(cfg) == tenantIsolationNamespace {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestBrokerEnv(t *testing.T) {
+	env := brokerEnv(schedulingv1alpha1.BrokerConfig{})
+	want := []corev1.EnvVar{
+		{Name: "RABBITMQ_HOST", Value: defaultBrokerHost},
+		{Name: "RABBITMQ_PORT", Value: "5672"},
+		{Name: "RABBITMQ_VHOST", Value: "/"},
+	}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("defaults: got %v, want %v", env, want)
+	}
+
+	env = brokerEnv(schedulingv1alpha1.BrokerConfig{
+		Host: "rabbitmq.shop", Port: ptr.To[int32](5671), VHost: "shop",
+		SecretRef: &corev1.LocalObjectReference{Name: "rabbitmq-credentials"},
+	})
+	if len(env) != 5 || env[0].Value != "rabbitmq.shop" || env[1].Value != "5671" || env[2].Value != "shop" {
+		t.Fatalf("got %v, want the configured address and both credentials", env)
+	}
+	for _, credential := range env[3:] {
+		ref := credential.ValueFrom.SecretKeyRef
+		if credential.Value != "" || ref == nil || ref.Name != "rabbitmq-credentials" {
+			t.Errorf("%s: got %+v, want a reference to the Secret", credential.Name, credential)
+		}
+	}
+}
+
+func TestResolveBroker(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "rabbitmq-credentials"},
+		Data:       map[string][]byte{brokerUsernameKey: []byte("shop"), brokerPasswordKey: []byte("s3cret")},
+	}).Build()
+	ctx := context.Background()
+	withSecret := func(name string) schedulingv1alpha1.BrokerConfig {
+		return schedulingv1alpha1.BrokerConfig{SecretRef: &corev1.LocalObjectReference{Name: name}}
+	}
+
+	endpoint, err := resolveBroker(ctx, c, "shop", withSecret("rabbitmq-credentials"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoint.Host != defaultBrokerHost || endpoint.Username != "shop" || endpoint.Password != "s3cret" {
+		t.Errorf("got %+v, want the default host with the Secret credentials", endpoint)
+	}
+
+	if _, err := resolveBroker(ctx, c, "shop", schedulingv1alpha1.BrokerConfig{}); !errors.Is(err, errBrokerCredentialsMissing) || classify(err) != failureInvalidConfig {
+		t.Errorf("no secretRef: got %v, want an invalid configuration", err)
+	}
+	if _, err := resolveBroker(ctx, c, "shop", withSecret("missing")); !apierrors.IsNotFound(err) {
+		t.Errorf("missing Secret: got %v, want not found", err)
+	}
+	if _, err := resolveBroker(ctx, c, "shop", schedulingv1alpha1.BrokerConfig{Type: brokerTypeKafka}); !errors.Is(err, errNoManagementAPI) {
+		t.Errorf("kafka: got %v, want no management API", err)
+	}
+}
+
+func TestManagementRequest(t *testing.T) {
+	broker := brokerEndpoint{Host: "rabbitmq.shop", VHost: "/", Username: "shop", Password: "s3cret"}
+	req, err := broker.managementRequest(context.Background(), http.MethodDelete, broker.managementPath("queues", "shop.checkout/direct"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := req.URL.String(); got != "http://rabbitmq.shop:15672/api/queues/%2F/shop.checkout%2Fdirect" {
+		t.Errorf("got URL %s, want the escaped vhost and name on the management port", got)
+	}
+	if user, password, ok := req.BasicAuth(); !ok || user != "shop" || password != "s3cret" {
+		t.Errorf("got basic auth %q/%q, want the broker credentials", user, password)
+	}
+}
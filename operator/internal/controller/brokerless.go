@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	kedav1alpha1 "github.com/kedacore/keda/v2/apis/keda/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// forwardsRequests reports whether a buffer service component calls the
+// target Service: the consumer, or the router when there is no broker. It
+// then joins the mesh, so the routing backend splits its calls.
+func forwardsRequests(component string, broker bufferBackend) bool {
+	return component == "consumer" || !broker.queued()
+}
+
+// retireConsumer removes the consumer of svc, if any, once its broker is gone.
+// It runs on every reconcile of a brokerless Service, so only the objects the
+// cache still holds are deleted.
+func (r *FlavourRouterReconciler) retireConsumer(ctx context.Context, svc *corev1.Service) error {
+	name := fmt.Sprintf("buffer-service-consumer-%s", svc.Name)
+	key := client.ObjectKeyFromObject(svc)
+	var errs []error
+	for kind, obj := range map[string]client.Object{
+		"ScaledObject":  &kedav1alpha1.ScaledObject{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: svc.Namespace}},
+		"Deployment":    &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: svc.Namespace}},
+		"Service":       &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: svc.Namespace}},
+		"NetworkPolicy": &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: svc.Namespace}},
+	} {
+		err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+		switch {
+		case apierrors.IsNotFound(err):
+		case err != nil:
+			errs = append(errs, err)
+			continue
+		default:
+			if err := r.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		r.Inventory.Drop(key, kind, svc.Namespace, name)
+	}
+	if err := r.deleteDisruptionBudget(ctx, svc, name); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.deleteIdentity(ctx, svc, "consumer"); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	kedav1alpha1 "github.com/kedacore/keda/v2/apis/keda/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	brokerScaledObjectName    = "carbonrouter-rabbitmq"
+	brokerScalerReconcileKey  = "broker-scaler"
+	brokerScalerResync        = 1 * time.Minute
+	brokerPrometheusAddress   = "http://carbonrouter-kube-promethe-prometheus.carbonrouter-system.svc:9090"
+	brokerScaleDownWindowSecs = 600
+	brokerScaleDownPeriodSecs = 300
+)
+
+// BrokerScalerReconciler manages a KEDA ScaledObject for the RabbitMQ broker
+// StatefulSet. The broker scales on the messages buffered across every routed
+// Service, and keeps a higher floor while a schedule throttles processing,
+// since that is when buffers build up. It only scales down once the buffers
+// are drained, so no buffered message sits on a node being removed.
+type BrokerScalerReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// Namespace hosts the broker StatefulSet and its ScaledObject.
+	Namespace string
+	// StatefulSet is the broker StatefulSet.
+	StatefulSet string
+	// MinReplicas and MaxReplicas bound the broker replicas.
+	MinReplicas int32
+	MaxReplicas int32
+	// BufferingMinReplicas is the floor while a schedule throttles processing.
+	BufferingMinReplicas int32
+	// BacklogPerReplica is the buffered messages each broker replica takes.
+	BacklogPerReplica int32
+}
+
+// +kubebuilder:rbac:groups=keda.sh,resources=scaledobjects,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get
+
+func (r *BrokerScalerReconciler) Reconcile(ctx context.Context, _ ctrl.Request) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx).WithName("[BrokerScaler]")
+
+	var tsList schedulingv1alpha1.TrafficScheduleList
+	if err := r.List(ctx, &tsList); err != nil {
+		return ctrl.Result{}, err
+	}
+	// The kill-switch lifts every throttle, so nothing is held back in the buffers
+	engaged, err := killSwitchEngaged(ctx, r.Client, r.Namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	buffering := !engaged && schedulesBuffering(tsList.Items)
+
+	minReplicas := r.MinReplicas
+	if buffering {
+		minReplicas = max(minReplicas, min(r.BufferingMinReplicas, r.MaxReplicas))
+	}
+	queues := bufferedQueuesPattern(tsList.Items)
+	running, err := r.drainingFloor(ctx, queues)
+	if err != nil {
+		return failureResult("brokerscaler", classify(err), err)
+	}
+	minReplicas = max(minReplicas, running)
+	log.Info("Broker scaling evaluated", "buffering", buffering, "draining", running > 0, "minReplicas", minReplicas, "maxReplicas", r.MaxReplicas)
+	if err := r.ensureScaledObject(ctx, minReplicas, queues); err != nil {
+		return failureResult("brokerscaler", classify(err), err)
+	}
+	return ctrl.Result{RequeueAfter: brokerScalerResync}, nil
+}
+
+// schedulesBuffering reports whether any schedule throttles processing, which
+// holds messages in the broker until the carbon intensity drops.
+func schedulesBuffering(schedules []schedulingv1alpha1.TrafficSchedule) bool {
+	return slices.ContainsFunc(schedules, func(ts schedulingv1alpha1.TrafficSchedule) bool {
+		return processingThrottled(ts.Status)
+	})
+}
+
+// bufferedQueuesPattern matches the buffered queues of every Service, whatever
+// queue name template its schedule uses. Schedules with an invalid template
+// have no queues to count.
+func bufferedQueuesPattern(schedules []schedulingv1alpha1.TrafficSchedule) string {
+	patterns := []string{queueNaming{queue: defaultQueueNameTemplate}.bufferedQueuePattern("", "")}
+	for _, ts := range schedules {
+		naming, err := queueNamingFor(ts.Spec.Broker)
+		if err != nil {
+			continue
+		}
+		if pattern := naming.bufferedQueuePattern("", ""); !slices.Contains(patterns, pattern) {
+			patterns = append(patterns, pattern)
+		}
+	}
+	slices.Sort(patterns)
+	return strings.Join(patterns, "|")
+}
+
+// drainingFloor returns the running broker replicas while the buffered queues
+// hold ready messages, and zero once they are drained. Classic queues live on
+// a single node, so removing it while the buffers are full loses the messages
+// on it. Without a buffered queue the broker counts as drained, while an
+// unreachable Prometheus counts as buffered.
+func (r *BrokerScalerReconciler) drainingFloor(ctx context.Context, queues string) (int32, error) {
+	var sts appsv1.StatefulSet
+	if err := r.Get(ctx, types.NamespacedName{Namespace: r.Namespace, Name: r.StatefulSet}, &sts); err != nil {
+		if apierrors.IsNotFound(err) {
+			return 0, dependencyMissingError(fmt.Errorf("broker StatefulSet %s/%s not found: %w", r.Namespace, r.StatefulSet, err))
+		}
+		return 0, err
+	}
+	running := ptr.Deref(sts.Spec.Replicas, 1)
+	backlog, ok, err := queryPrometheus(ctx, brokerPrometheusAddress,
+		fmt.Sprintf(`sum(rabbitmq_detailed_queue_messages_ready{queue=~"%s"})`, promQLString(queues)))
+	if err != nil {
+		ctrl.LoggerFrom(ctx).WithName("[BrokerScaler]").Error(err, "Failed to read the buffered backlog, holding the broker replicas")
+		return running, nil
+	}
+	if !ok || backlog == 0 {
+		return 0, nil
+	}
+	return running, nil
+}
+
+// ensureScaledObject applies the broker ScaledObject with server-side apply.
+func (r *BrokerScalerReconciler) ensureScaledObject(ctx context.Context, minReplicas int32, queues string) error {
+	so := &kedav1alpha1.ScaledObject{
+		TypeMeta: metav1.TypeMeta{APIVersion: kedav1alpha1.SchemeGroupVersion.String(), Kind: "ScaledObject"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      brokerScaledObjectName,
+			Namespace: r.Namespace,
+			Labels:    map[string]string{"app.kubernetes.io/managed-by": "carbonrouter-operator"},
+		},
+		Spec: kedav1alpha1.ScaledObjectSpec{
+			ScaleTargetRef:  &kedav1alpha1.ScaleTarget{APIVersion: "apps/v1", Kind: "StatefulSet", Name: r.StatefulSet},
+			PollingInterval: ptr.To[int32](30),
+			MinReplicaCount: ptr.To(minReplicas),
+			MaxReplicaCount: ptr.To(r.MaxReplicas),
+			// Removing a broker node moves its queues, so shrink one node at a
+			// time after the buffers have stayed drained for a while
+			Advanced: &kedav1alpha1.AdvancedConfig{
+				HorizontalPodAutoscalerConfig: &kedav1alpha1.HorizontalPodAutoscalerConfig{
+					Behavior: &autoscalingv2.HorizontalPodAutoscalerBehavior{
+						ScaleDown: &autoscalingv2.HPAScalingRules{
+							StabilizationWindowSeconds: ptr.To[int32](brokerScaleDownWindowSecs),
+							Policies: []autoscalingv2.HPAScalingPolicy{{
+								Type:          autoscalingv2.PodsScalingPolicy,
+								Value:         1,
+								PeriodSeconds: brokerScaleDownPeriodSecs,
+							}},
+						},
+					},
+				},
+			},
+			Triggers: []kedav1alpha1.ScaleTriggers{{
+				Type: "prometheus",
+				Metadata: map[string]string{
+					"serverAddress": brokerPrometheusAddress,
+					"query":         fmt.Sprintf(`sum(rabbitmq_detailed_queue_messages_ready{queue=~"%s"})`, promQLString(queues)),
+					"threshold":     strconv.Itoa(int(r.BacklogPerReplica)),
+				},
+			}},
+		},
+	}
+	return r.Patch(ctx, so, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
+}
+
+func (r *BrokerScalerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	singleton := handler.EnqueueRequestsFromMapFunc(func(context.Context, client.Object) []reconcile.Request {
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: r.Namespace, Name: brokerScalerReconcileKey}}}
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("brokerscaler").
+		Watches(&schedulingv1alpha1.TrafficSchedule{}, singleton).
+		Watches(&corev1.ConfigMap{}, singleton, builder.WithPredicates(killSwitchPredicate(r.Namespace))).
+		Complete(r)
+}
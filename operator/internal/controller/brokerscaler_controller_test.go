@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	kedav1alpha1 "github.com/kedacore/keda/v2/apis/keda/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestBufferedQueuesPattern(t *testing.T) {
+	base := bufferedQueuesPattern(nil)
+	if base == "" || strings.Contains(base, "|") {
+		t.Fatalf("got %q, want the default template only", base)
+	}
+	custom := schedulingv1alpha1.TrafficSchedule{}
+	custom.Spec.Broker.QueueNameTemplate = "cr-{namespace}-{service}-{type}-{flavour}"
+	invalid := schedulingv1alpha1.TrafficSchedule{}
+	invalid.Spec.Broker.QueueNameTemplate = "{flavour}"
+	got := bufferedQueuesPattern([]schedulingv1alpha1.TrafficSchedule{custom, {}, invalid, custom})
+	if patterns := strings.Split(got, "|"); len(patterns) != 2 || !strings.Contains(got, base) || !strings.Contains(got, "cr-") {
+		t.Errorf("got %q, want the default and the custom template once each", got)
+	}
+}
+
+func TestBrokerScalerReconcile(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := schedulingv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := kedav1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	const namespace = "carbonrouter-system"
+	broker := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "rabbitmq"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: ptr.To[int32](4)},
+	}
+	throttled := &schedulingv1alpha1.TrafficSchedule{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ops", Name: "default"},
+		Status:     schedulingv1alpha1.TrafficScheduleStatus{ProcessingThrottle: "0.5"},
+	}
+	idle := &schedulingv1alpha1.TrafficSchedule{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ops", Name: "default"},
+		Status:     schedulingv1alpha1.TrafficScheduleStatus{ProcessingThrottle: "1"},
+	}
+	killSwitch := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: killSwitchConfigMap},
+		Data:       map[string]string{killSwitchKey: "true"},
+	}
+
+	tests := []struct {
+		name    string
+		objects []client.Object
+		// backlog is the ready messages Prometheus reports, zero when empty,
+		// "none" for no series and "down" for an unreachable Prometheus.
+		backlog string
+		want    int32
+	}{
+		{name: "idle", objects: []client.Object{broker, idle}, want: 1},
+		{name: "no series", objects: []client.Object{broker, idle}, backlog: "none", want: 1},
+		{name: "buffering", objects: []client.Object{broker, throttled}, want: 3},
+		{name: "kill switch", objects: []client.Object{broker, throttled, killSwitch}, want: 1},
+		{name: "draining", objects: []client.Object{broker, idle}, backlog: "40", want: 4},
+		{name: "prometheus down", objects: []client.Object{broker, idle}, backlog: "down", want: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var query string
+			redirectAdmin(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				query = req.URL.Query().Get("query")
+				switch tt.backlog {
+				case "down":
+					w.WriteHeader(http.StatusBadGateway)
+				case "none":
+					fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+				default:
+					value := tt.backlog
+					if value == "" {
+						value = "0"
+					}
+					fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"%s"]}]}}`, value)
+				}
+			}))
+			var applied *kedav1alpha1.ScaledObject
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tt.objects...).WithInterceptorFuncs(interceptor.Funcs{
+				Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+					applied = obj.(*kedav1alpha1.ScaledObject).DeepCopy()
+					return nil
+				},
+			}).Build()
+			r := &BrokerScalerReconciler{
+				Client: c, Scheme: scheme, Namespace: namespace, StatefulSet: "rabbitmq",
+				MinReplicas: 1, MaxReplicas: 5, BufferingMinReplicas: 3, BacklogPerReplica: 1000,
+			}
+			result, err := r.Reconcile(context.Background(), ctrl.Request{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.RequeueAfter != brokerScalerResync {
+				t.Errorf("got requeue after %v, want %v", result.RequeueAfter, brokerScalerResync)
+			}
+			if applied == nil {
+				t.Fatal("no ScaledObject applied")
+			}
+			if got := ptr.Deref(applied.Spec.MinReplicaCount, 0); got != tt.want {
+				t.Errorf("got min replicas %d, want %d", got, tt.want)
+			}
+			trigger := applied.Spec.Triggers[0].Metadata
+			if trigger["query"] != query || trigger["threshold"] != "1000" || ptr.Deref(applied.Spec.MaxReplicaCount, 0) != 5 {
+				t.Errorf("got trigger %v, want the backlog query drained with a threshold of 1000", trigger)
+			}
+		})
+	}
+
+	t.Run("missing StatefulSet", func(t *testing.T) {
+		r := &BrokerScalerReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).Build(), Scheme: scheme, Namespace: namespace, StatefulSet: "rabbitmq"}
+		result, err := r.Reconcile(context.Background(), ctrl.Request{})
+		if err != nil || result.RequeueAfter != dependencyRetryInterval {
+			t.Errorf("got %v, %v, want a retry once the broker exists", result, err)
+		}
+	})
+}
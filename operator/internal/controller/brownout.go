@@ -0,0 +1,265 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	networkingapi "istio.io/api/networking/v1alpha3"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	defaultBrownoutImage       = "nginxinc/nginx-unprivileged:1.27-alpine"
+	defaultBrownoutContentType = "text/html"
+	brownoutPort               = 8080
+	// brownoutHeader marks the responses of the static responder.
+	brownoutHeader = "x-carbonrouter-brownout"
+	// brownoutConfigAnnotation rolls the responder pods when nginx.conf changes.
+	brownoutConfigAnnotation = "carbonrouter.io/brownout-config"
+)
+
+func brownoutName(svc *corev1.Service) string {
+	return fmt.Sprintf("%s-carbonrouter-brownout", svc.Name)
+}
+
+// brownoutShare returns the percentage of the eligible requests sent to the
+// responder while the current forecast is above the threshold, 0 otherwise.
+// The schedule drives it through its processing throttle: the configured
+// percentage applies in full once processing stops, or when the schedule sets
+// no throttle, and shrinks as the throttle recovers.
+func brownoutShare(cfg *schedulingv1alpha1.BrownoutConfig, status schedulingv1alpha1.TrafficScheduleStatus) (float64, error) {
+	if cfg == nil {
+		return 0, nil
+	}
+	threshold, err := strconv.ParseFloat(cfg.IntensityThreshold, 64)
+	if err != nil {
+		return 0, invalidConfigError(fmt.Errorf("spec.routing.brownout.intensityThreshold %q is not a number", cfg.IntensityThreshold))
+	}
+	percentage, err := strconv.ParseFloat(cfg.Percentage, 64)
+	if err != nil || percentage < 0 || percentage > 100 {
+		return 0, invalidConfigError(fmt.Errorf("spec.routing.brownout.percentage %q is not a percentage", cfg.Percentage))
+	}
+	forecast, err := strconv.ParseFloat(strings.TrimSpace(status.CarbonForecastNow), 64)
+	if err != nil || forecast <= threshold {
+		return 0, nil
+	}
+	if throttle, err := strconv.ParseFloat(strings.TrimSpace(status.ProcessingThrottle), 64); err == nil {
+		percentage *= 1 - min(max(throttle, 0), 1)
+	}
+	return percentage, nil
+}
+
+// brownoutMatches matches the eligible GET requests, restricted to headers
+// when set.
+func brownoutMatches(cfg *schedulingv1alpha1.BrownoutConfig, headers map[string]*networkingapi.StringMatch) []*networkingapi.HTTPMatchRequest {
+	get := &networkingapi.StringMatch{MatchType: &networkingapi.StringMatch_Exact{Exact: "GET"}}
+	if len(cfg.Paths) == 0 {
+		return []*networkingapi.HTTPMatchRequest{{Method: get, Headers: headers}}
+	}
+	var matches []*networkingapi.HTTPMatchRequest
+	for _, path := range cfg.Paths {
+		matches = append(matches, &networkingapi.HTTPMatchRequest{Uri: uriMatch(path), Method: get, Headers: headers})
+	}
+	return matches
+}
+
+// buildBrownoutRoute sends share percent of the eligible GET requests to the
+// responder and splits the rest with the schedule weights. It returns nil
+// while no request is browned out.
+func buildBrownoutRoute(host, responderHost string, cfg *schedulingv1alpha1.BrownoutConfig, share float64, flavours []schedulingv1alpha1.FlavourDecision, precisions []int) *networkingapi.HTTPRoute {
+	if cfg == nil || share == 0 {
+		return nil
+	}
+	weighted := buildWeightedRoute(host, flavours, precisions)
+	shares := []float64{share}
+	for _, destination := range weighted.Route {
+		shares = append(shares, float64(destination.Weight)*(100-share)/100)
+	}
+	percentages := roundPercentages(shares)
+
+	route := &networkingapi.HTTPRoute{Name: "carbonrouter-brownout", Match: brownoutMatches(cfg, nil)}
+	route.Route = append(route.Route, &networkingapi.HTTPRouteDestination{
+		Destination: &networkingapi.Destination{Host: responderHost},
+		Weight:      int32(percentages[0]),
+	})
+	for i, destination := range weighted.Route {
+		if percentages[i+1] == 0 {
+			continue
+		}
+		destination.Weight = int32(percentages[i+1])
+		route.Route = append(route.Route, destination)
+	}
+	return route
+}
+
+// buildForcedBrownoutRoutes browns out share percent of the eligible GET
+// requests forced to each precision through header, as the buffer consumers
+// replay them, and sends the rest to that precision. They go before the
+// forced precision routes, which would match them first otherwise.
+func buildForcedBrownoutRoutes(host, responderHost, header string, cfg *schedulingv1alpha1.BrownoutConfig, share float64, precisions []int) []*networkingapi.HTTPRoute {
+	if cfg == nil || share == 0 {
+		return nil
+	}
+	percentages := roundPercentages([]float64{share, 100 - share})
+	var routes []*networkingapi.HTTPRoute
+	for _, precision := range precisions {
+		subsetName := precisionSubsetName(precision)
+		route := &networkingapi.HTTPRoute{
+			Name: "carbonrouter-brownout-" + subsetName,
+			Match: brownoutMatches(cfg, map[string]*networkingapi.StringMatch{
+				header: {MatchType: &networkingapi.StringMatch_Exact{Exact: precisionHeaderValue(precision)}},
+			}),
+			Route: []*networkingapi.HTTPRouteDestination{{
+				Destination: &networkingapi.Destination{Host: responderHost},
+				Weight:      int32(percentages[0]),
+			}},
+		}
+		if percentages[1] > 0 {
+			route.Route = append(route.Route, &networkingapi.HTTPRouteDestination{
+				Destination: &networkingapi.Destination{Host: host, Subset: subsetName},
+				Weight:      int32(percentages[1]),
+			})
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// brownoutNginxConfig answers every request with the configured body.
+func brownoutNginxConfig(cfg *schedulingv1alpha1.BrownoutConfig) string {
+	contentType := cfg.ContentType
+	if contentType == "" {
+		contentType = defaultBrownoutContentType
+	}
+	return fmt.Sprintf(`server {
+    listen %d;
+    root /usr/share/carbonrouter;
+    location / {
+        types {}
+        default_type %s;
+        add_header %s "true" always;
+        try_files /index.html =404;
+    }
+}
+`, brownoutPort, contentType, brownoutHeader)
+}
+
+// ensureBrownoutResponder deploys the responder of the brownout route. It runs
+// whenever brownout is configured, so it is warm when the carbon intensity
+// crosses the threshold, and is removed with the configuration.
+func (r *FlavourRouterReconciler) ensureBrownoutResponder(ctx context.Context, svc *corev1.Service, cfg *schedulingv1alpha1.BrownoutConfig) error {
+	if cfg == nil {
+		return r.deleteBrownoutResponder(ctx, svc)
+	}
+	name := brownoutName(svc)
+	labels := map[string]string{
+		"app.kubernetes.io/name":       "carbonrouter-brownout",
+		"app.kubernetes.io/part-of":    "carbonrouter",
+		"app.kubernetes.io/managed-by": "carbonrouter-operator",
+		parentServiceLabel:             svc.Name,
+	}
+	selector := map[string]string{
+		"app.kubernetes.io/name": "carbonrouter-brownout",
+		parentServiceLabel:       svc.Name,
+	}
+
+	container := corev1.Container{
+		Name:  "responder",
+		Image: cfg.Image,
+		Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: brownoutPort}},
+	}
+	var volumes []corev1.Volume
+	var annotations map[string]string
+	// The default responder serves the body from a ConfigMap
+	if cfg.Image == "" {
+		nginxConfig := brownoutNginxConfig(cfg)
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: svc.Namespace, Labels: labels},
+			Data:       map[string]string{"default.conf": nginxConfig, "index.html": cfg.Body},
+		}
+		if err := ctrl.SetControllerReference(svc, cm, r.Scheme); err != nil {
+			return err
+		}
+		if err := r.apply(ctx, svc, "ConfigMap", cm, cm.Data); err != nil {
+			return err
+		}
+		container.Image = defaultBrownoutImage
+		container.VolumeMounts = []corev1.VolumeMount{
+			{Name: "content", MountPath: "/etc/nginx/conf.d/default.conf", SubPath: "default.conf", ReadOnly: true},
+			{Name: "content", MountPath: "/usr/share/carbonrouter", ReadOnly: true},
+		}
+		volumes = []corev1.Volume{{
+			Name: "content",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: name}},
+			},
+		}}
+		annotations = map[string]string{brownoutConfigAnnotation: fmt.Sprintf("%x", sha256.Sum256([]byte(nginxConfig)))[:16]}
+	}
+
+	dep := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: svc.Namespace, Labels: labels},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.To(ptr.Deref(cfg.Replicas, 1)),
+			Selector: &metav1.LabelSelector{MatchLabels: selector},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels, Annotations: annotations},
+				Spec: corev1.PodSpec{
+					AutomountServiceAccountToken: ptr.To(false),
+					Volumes:                      volumes,
+					Containers:                   []corev1.Container{container},
+				},
+			},
+		},
+	}
+	if err := ctrl.SetControllerReference(svc, dep, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.apply(ctx, svc, "Deployment", dep, &dep.Spec); err != nil {
+		return err
+	}
+
+	responderSvc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: svc.Namespace, Labels: labels},
+		Spec: corev1.ServiceSpec{
+			Selector: selector,
+			Ports:    []corev1.ServicePort{{Name: "http", Port: 80, TargetPort: intstr.FromInt(brownoutPort)}},
+			Type:     corev1.ServiceTypeClusterIP,
+		},
+	}
+	if err := ctrl.SetControllerReference(svc, responderSvc, r.Scheme); err != nil {
+		return err
+	}
+	return r.apply(ctx, svc, "Service", responderSvc, &responderSvc.Spec)
+}
+
+// deleteBrownoutResponder removes the responder of svc, if any.
+func (r *FlavourRouterReconciler) deleteBrownoutResponder(ctx context.Context, svc *corev1.Service) error {
+	name := brownoutName(svc)
+	key := client.ObjectKeyFromObject(svc)
+	var errs []error
+	for kind, obj := range map[string]client.Object{
+		"Deployment": &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: svc.Namespace}},
+		"Service":    &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: svc.Namespace}},
+		"ConfigMap":  &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: svc.Namespace}},
+	} {
+		if err := r.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+			errs = append(errs, err)
+			continue
+		}
+		r.Inventory.Drop(key, kind, svc.Namespace, name)
+	}
+	return errors.Join(errs...)
+}
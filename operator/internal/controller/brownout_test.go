@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"testing"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestBrownoutShare(t *testing.T) {
+	cfg := &schedulingv1alpha1.BrownoutConfig{IntensityThreshold: "300", Percentage: "40"}
+	tests := []struct {
+		name   string
+		cfg    *schedulingv1alpha1.BrownoutConfig
+		status schedulingv1alpha1.TrafficScheduleStatus
+		want   float64
+	}{
+		{name: "not configured", status: schedulingv1alpha1.TrafficScheduleStatus{CarbonForecastNow: "500"}},
+		{name: "below the threshold", cfg: cfg, status: schedulingv1alpha1.TrafficScheduleStatus{CarbonForecastNow: "250", ProcessingThrottle: "0"}},
+		{name: "no forecast", cfg: cfg},
+		{name: "no throttle", cfg: cfg, status: schedulingv1alpha1.TrafficScheduleStatus{CarbonForecastNow: "500"}, want: 40},
+		{name: "processing stopped", cfg: cfg, status: schedulingv1alpha1.TrafficScheduleStatus{CarbonForecastNow: "500", ProcessingThrottle: "0"}, want: 40},
+		{name: "throttled", cfg: cfg, status: schedulingv1alpha1.TrafficScheduleStatus{CarbonForecastNow: "500", ProcessingThrottle: "0.75"}, want: 10},
+		{name: "not throttled", cfg: cfg, status: schedulingv1alpha1.TrafficScheduleStatus{CarbonForecastNow: "500", ProcessingThrottle: "1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := brownoutShare(tt.cfg, tt.status)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := brownoutShare(&schedulingv1alpha1.BrownoutConfig{IntensityThreshold: "300", Percentage: "140"}, schedulingv1alpha1.TrafficScheduleStatus{}); classify(err) != failureInvalidConfig {
+		t.Errorf("got %v, want an invalid configuration", err)
+	}
+}
+
+func TestBuildForcedBrownoutRoutes(t *testing.T) {
+	cfg := &schedulingv1alpha1.BrownoutConfig{IntensityThreshold: "300", Percentage: "40"}
+	if routes := buildForcedBrownoutRoutes("svc", "responder", "x-carbonrouter", cfg, 0, []int{100, 50}); routes != nil {
+		t.Errorf("got %d routes without a share", len(routes))
+	}
+	routes := buildForcedBrownoutRoutes("svc", "responder", "x-carbonrouter", cfg, 25, []int{100, 50})
+	if len(routes) != 2 {
+		t.Fatalf("got %d routes, want one per precision", len(routes))
+	}
+	for i, precision := range []int{100, 50} {
+		route := routes[i]
+		match := route.Match[0]
+		if match.Method.GetExact() != "GET" || match.Headers["x-carbonrouter"].GetExact() != precisionHeaderValue(precision) {
+			t.Errorf("precision %d: unexpected match %v", precision, match)
+		}
+		if len(route.Route) != 2 || route.Route[0].Destination.Host != "responder" || route.Route[0].Weight != 25 ||
+			route.Route[1].Destination.Subset != precisionSubsetName(precision) || route.Route[1].Weight != 75 {
+			t.Errorf("precision %d: unexpected destinations %v", precision, route.Route)
+		}
+	}
+}
@@ -0,0 +1,631 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	kedav1alpha1 "github.com/kedacore/keda/v2/apis/keda/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+// Buffer backends of spec.broker.type.
+const (
+	brokerTypeRabbitMQ = "rabbitmq"
+	brokerTypeKafka    = "kafka"
+	brokerTypeNATS     = "natsJetstream"
+	brokerTypeSQS      = "sqs"
+	brokerTypeRedis    = "redisStreams"
+	brokerTypeNone     = "none"
+
+	defaultKafkaPort          = 9092
+	defaultNATSPort           = 4222
+	defaultNATSMonitoringPort = 8222
+	defaultRedisPort          = 6379
+
+	// irsaRoleAnnotation binds a ServiceAccount to an IAM role on EKS.
+	irsaRoleAnnotation = "eks.amazonaws.com/role-arn"
+)
+
+// bufferBackend is the broker the buffer services of a Service queue their
+// requests on.
+type bufferBackend interface {
+	// env points a buffer service container at the broker.
+	env() []corev1.EnvVar
+	// addresses are the host and port pairs the buffer services dial.
+	addresses() []brokerHostPort
+	// backlogTrigger scales a workload on the messages waiting in queue. An
+	// empty activation keeps the default of the scaler.
+	backlogTrigger(queue string, target int32, activation string) kedav1alpha1.ScaleTriggers
+	// queueMetrics reports whether Prometheus scrapes the queue depths of the
+	// broker, which the rabbitmq_detailed_queue_messages_ready triggers read.
+	queueMetrics() bool
+	// queued reports whether requests go through a broker at all. Without one
+	// the router forwards them itself, no consumer runs and there is no
+	// backlog to scale on.
+	queued() bool
+}
+
+type brokerHostPort struct {
+	host string
+	port int32
+}
+
+func brokerType(cfg schedulingv1alpha1.BrokerConfig) string {
+	if cfg.Type == "" {
+		return brokerTypeRabbitMQ
+	}
+	return cfg.Type
+}
+
+// bufferBackendFor returns the backend of cfg for the buffer services of svc.
+func bufferBackendFor(svc *corev1.Service, cfg schedulingv1alpha1.BrokerConfig, naming queueNaming) (bufferBackend, error) {
+	switch brokerType(cfg) {
+	case brokerTypeKafka:
+		if cfg.Kafka == nil {
+			return nil, invalidConfigError(fmt.Errorf("spec.broker.kafka is required with the kafka backend"))
+		}
+		return kafkaBackend{cfg: cfg, exchange: naming.exchangeName(svc.Namespace, svc.Name), auth: brokerTriggerAuthenticationName(svc)}, nil
+	case brokerTypeNATS:
+		if cfg.NATS == nil {
+			return nil, invalidConfigError(fmt.Errorf("spec.broker.nats is required with the natsJetstream backend"))
+		}
+		return natsBackend{cfg: cfg, exchange: naming.exchangeName(svc.Namespace, svc.Name)}, nil
+	case brokerTypeSQS:
+		if cfg.SQS == nil {
+			return nil, invalidConfigError(fmt.Errorf("spec.broker.sqs is required with the sqs backend"))
+		}
+		urls := make(map[string]string, 2*len(cfg.SQS.Queues))
+		for _, queue := range cfg.SQS.Queues {
+			urls[naming.bufferedQueue(svc.Namespace, svc.Name, queue.Precision)] = queue.URL
+			if queue.DirectURL != "" {
+				urls[naming.directQueue(svc.Namespace, svc.Name, queue.Precision)] = queue.DirectURL
+			}
+		}
+		return sqsBackend{cfg: cfg, urls: urls, auth: brokerTriggerAuthenticationName(svc)}, nil
+	case brokerTypeRedis:
+		if cfg.Redis == nil {
+			return nil, invalidConfigError(fmt.Errorf("spec.broker.redis is required with the redisStreams backend"))
+		}
+		return redisBackend{cfg: cfg, exchange: naming.exchangeName(svc.Namespace, svc.Name), auth: brokerTriggerAuthenticationName(svc)}, nil
+	case brokerTypeNone:
+		return directBackend{}, nil
+	default:
+		if topology := cfg.Topology; !topology.Managed && (topology.DeadLetter || topology.Lazy || topology.MessageTTLSeconds != nil || topology.MaxLength != nil || topology.Overflow != "") {
+			return nil, invalidConfigError(fmt.Errorf("spec.broker.topology requires managed to be set"))
+		}
+		if cfg.Topology.MaxAttempts != nil && !cfg.Topology.DeadLetter {
+			return nil, invalidConfigError(fmt.Errorf("spec.broker.topology.maxAttempts requires deadLetter to be set"))
+		}
+		if cfg.SecretRef == nil {
+			return nil, invalidConfigError(errBrokerCredentialsMissing)
+		}
+		return rabbitMQBackend{cfg: cfg, auth: brokerTriggerAuthenticationName(svc)}, nil
+	}
+}
+
+// rabbitMQBackend queues requests on RabbitMQ, the broker installed by the
+// chart unless spec.broker points elsewhere.
+type rabbitMQBackend struct {
+	cfg schedulingv1alpha1.BrokerConfig
+	// auth names the TriggerAuthentication of a provisioned cluster or tenant.
+	auth string
+}
+
+func (b rabbitMQBackend) env() []corev1.EnvVar {
+	env := brokerEnv(b.cfg)
+	if topology := b.cfg.Topology; topology.MaxAttempts != nil {
+		env = append(env, corev1.EnvVar{Name: "DEAD_LETTER_AFTER", Value: strconv.Itoa(int(*topology.MaxAttempts))})
+	}
+	return env
+}
+
+func (b rabbitMQBackend) addresses() []brokerHostPort {
+	host, port, _ := brokerAddress(b.cfg)
+	return []brokerHostPort{{host: host, port: port}}
+}
+
+func (b rabbitMQBackend) backlogTrigger(queue string, target int32, activation string) kedav1alpha1.ScaleTriggers {
+	trigger := kedav1alpha1.ScaleTriggers{
+		Type:              "rabbitmq",
+		AuthenticationRef: &kedav1alpha1.AuthenticationRef{Name: "carbonrouter-rabbitmq-auth", Kind: "ClusterTriggerAuthentication"},
+		Metadata: map[string]string{
+			"queueName": queue,
+			"mode":      "QueueLength",
+			"value":     fmt.Sprintf("%d", target),
+		},
+	}
+	// The URI of a provisioned cluster points at its default vhost
+	if b.cfg.Cluster != nil || tenantIsolation(b.cfg) != tenantIsolationShared {
+		trigger.AuthenticationRef = &kedav1alpha1.AuthenticationRef{Name: b.auth}
+		if b.cfg.VHost != "" {
+			trigger.Metadata["vhostName"] = b.cfg.VHost
+		}
+	}
+	if activation != "" {
+		trigger.Metadata["activationValue"] = activation
+	}
+	return trigger
+}
+
+func (b rabbitMQBackend) queueMetrics() bool {
+	return true
+}
+
+func (b rabbitMQBackend) queued() bool {
+	return true
+}
+
+// kafkaBackend queues requests on Kafka topics named after the queues. The
+// consumers of a Service share one consumer group, whose lag KEDA scales on.
+type kafkaBackend struct {
+	cfg      schedulingv1alpha1.BrokerConfig
+	exchange string
+	// auth names the TriggerAuthentication holding the credentials.
+	auth string
+}
+
+func (b kafkaBackend) consumerGroup() string {
+	return b.exchange + ".consumer"
+}
+
+func (b kafkaBackend) sasl() string {
+	if b.cfg.SecretRef == nil {
+		return ""
+	}
+	if b.cfg.Kafka.SASL == "" {
+		return "plaintext"
+	}
+	return b.cfg.Kafka.SASL
+}
+
+// kafkaSASLMechanisms maps the SASL modes of KEDA to the mechanism names of
+// the Kafka clients.
+var kafkaSASLMechanisms = map[string]string{
+	"plaintext":    "PLAIN",
+	"scram_sha256": "SCRAM-SHA-256",
+	"scram_sha512": "SCRAM-SHA-512",
+}
+
+// env hands the buffer services the topics the operator rendered, so they
+// agree with the triggers on the consumer group.
+func (b kafkaBackend) env() []corev1.EnvVar {
+	env := []corev1.EnvVar{
+		{Name: "BROKER_TYPE", Value: brokerTypeKafka},
+		{Name: "KAFKA_BOOTSTRAP_SERVERS", Value: strings.Join(b.cfg.Kafka.BootstrapServers, ",")},
+		{Name: "KAFKA_CONSUMER_GROUP", Value: b.consumerGroup()},
+		{Name: "KAFKA_REPLY_TOPIC", Value: b.exchange + ".reply"},
+	}
+	if b.cfg.Kafka.TLS {
+		env = append(env, corev1.EnvVar{Name: "KAFKA_TLS", Value: "true"})
+	}
+	if b.cfg.SecretRef == nil {
+		return env
+	}
+	secretKey := func(key string) *corev1.EnvVarSource {
+		return &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: *b.cfg.SecretRef, Key: key}}
+	}
+	return append(env,
+		corev1.EnvVar{Name: "KAFKA_SASL_MECHANISM", Value: kafkaSASLMechanisms[b.sasl()]},
+		corev1.EnvVar{Name: "KAFKA_USERNAME", ValueFrom: secretKey(brokerUsernameKey)},
+		corev1.EnvVar{Name: "KAFKA_PASSWORD", ValueFrom: secretKey(brokerPasswordKey)},
+	)
+}
+
+func (b kafkaBackend) addresses() []brokerHostPort {
+	addresses := make([]brokerHostPort, 0, len(b.cfg.Kafka.BootstrapServers))
+	for _, server := range b.cfg.Kafka.BootstrapServers {
+		address := brokerHostPort{host: server, port: defaultKafkaPort}
+		if host, port, err := net.SplitHostPort(server); err == nil {
+			if number, err := strconv.ParseInt(port, 10, 32); err == nil {
+				address = brokerHostPort{host: host, port: int32(number)}
+			}
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+// backlogTrigger scales on the lag of the consumer group on the topic. The
+// scaled workloads are not all consumers of the topic, so replicas are not
+// capped at its partition count.
+func (b kafkaBackend) backlogTrigger(topic string, target int32, activation string) kedav1alpha1.ScaleTriggers {
+	trigger := kedav1alpha1.ScaleTriggers{
+		Type: "kafka",
+		Metadata: map[string]string{
+			"bootstrapServers":   strings.Join(b.cfg.Kafka.BootstrapServers, ","),
+			"consumerGroup":      b.consumerGroup(),
+			"topic":              topic,
+			"lagThreshold":       fmt.Sprintf("%d", target),
+			"offsetResetPolicy":  "earliest",
+			"allowIdleConsumers": "true",
+		},
+	}
+	if activation != "" {
+		trigger.Metadata["activationLagThreshold"] = activation
+	}
+	if b.cfg.Kafka.TLS {
+		trigger.Metadata["tls"] = "enable"
+	}
+	if sasl := b.sasl(); sasl != "" {
+		trigger.Metadata["sasl"] = sasl
+		trigger.AuthenticationRef = &kedav1alpha1.AuthenticationRef{Name: b.auth, Kind: "TriggerAuthentication"}
+	}
+	return trigger
+}
+
+func (b kafkaBackend) queueMetrics() bool {
+	return false
+}
+
+func (b kafkaBackend) queued() bool {
+	return true
+}
+
+// natsBackend queues requests on a JetStream work-queue stream per Service.
+// Replies go straight to the inbox of the router, over core NATS.
+type natsBackend struct {
+	cfg      schedulingv1alpha1.BrokerConfig
+	exchange string
+}
+
+// brokerNameForbidden matches the characters NATS does not allow in stream
+// and consumer names, or that KEDA cannot pass in its monitoring URLs, and SQS
+// in queue names.
+var brokerNameForbidden = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// natsName turns a queue or exchange name into a stream or consumer name. The
+// buffer services apply the same rule.
+func natsName(name string) string {
+	return brokerNameForbidden.ReplaceAllString(name, "_")
+}
+
+func (b natsBackend) env() []corev1.EnvVar {
+	env := []corev1.EnvVar{
+		{Name: "BROKER_TYPE", Value: brokerTypeNATS},
+		{Name: "NATS_SERVERS", Value: strings.Join(b.cfg.NATS.Servers, ",")},
+		{Name: "NATS_STREAM", Value: natsName(b.exchange)},
+	}
+	if b.cfg.SecretRef == nil {
+		return env
+	}
+	secretKey := func(key string) *corev1.EnvVarSource {
+		return &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: *b.cfg.SecretRef, Key: key}}
+	}
+	return append(env,
+		corev1.EnvVar{Name: "NATS_USER", ValueFrom: secretKey(brokerUsernameKey)},
+		corev1.EnvVar{Name: "NATS_PASSWORD", ValueFrom: secretKey(brokerPasswordKey)},
+	)
+}
+
+// natsAddress returns the host and port of a server URL such as
+// "nats://nats.nats:4222" or "nats.nats".
+func natsAddress(server string) brokerHostPort {
+	if !strings.Contains(server, "://") {
+		server = "nats://" + server
+	}
+	address := brokerHostPort{port: defaultNATSPort}
+	parsed, err := url.Parse(server)
+	if err != nil {
+		return address
+	}
+	address.host = parsed.Hostname()
+	if number, err := strconv.ParseInt(parsed.Port(), 10, 32); err == nil {
+		address.port = int32(number)
+	}
+	return address
+}
+
+func (b natsBackend) addresses() []brokerHostPort {
+	addresses := make([]brokerHostPort, 0, len(b.cfg.NATS.Servers))
+	for _, server := range b.cfg.NATS.Servers {
+		addresses = append(addresses, natsAddress(server))
+	}
+	return addresses
+}
+
+// backlogTrigger scales on the pending messages of the durable consumer of
+// queue, which KEDA reads from the monitoring endpoint without credentials.
+func (b natsBackend) backlogTrigger(queue string, target int32, activation string) kedav1alpha1.ScaleTriggers {
+	endpoint := b.cfg.NATS.MonitoringEndpoint
+	if endpoint == "" {
+		endpoint = net.JoinHostPort(natsAddress(b.cfg.NATS.Servers[0]).host, strconv.Itoa(defaultNATSMonitoringPort))
+	}
+	account := b.cfg.NATS.Account
+	if account == "" {
+		account = "$G"
+	}
+	trigger := kedav1alpha1.ScaleTriggers{
+		Type: "nats-jetstream",
+		Metadata: map[string]string{
+			"natsServerMonitoringEndpoint": endpoint,
+			"account":                      account,
+			"stream":                       natsName(b.exchange),
+			"consumer":                     natsName(queue),
+			"lagThreshold":                 fmt.Sprintf("%d", target),
+		},
+	}
+	if activation != "" {
+		trigger.Metadata["activationLagThreshold"] = activation
+	}
+	return trigger
+}
+
+func (b natsBackend) queueMetrics() bool {
+	return false
+}
+
+func (b natsBackend) queued() bool {
+	return true
+}
+
+// sqsBackend queues requests on Amazon SQS, one queue per queue name.
+type sqsBackend struct {
+	cfg schedulingv1alpha1.BrokerConfig
+	// urls are the queue URLs of spec.broker.sqs.queues by queue name.
+	urls map[string]string
+	auth string
+}
+
+// sqsName turns a queue name into an SQS queue name. The buffer services apply
+// the same rule.
+func sqsName(name string) string {
+	return brokerNameForbidden.ReplaceAllString(name, "_")
+}
+
+// queueURL returns the URL of queue, or its bare SQS name without an account
+// ID, which KEDA and the buffer services look up in the account of their
+// credentials.
+func (b sqsBackend) queueURL(queue string) string {
+	if known, ok := b.urls[queue]; ok {
+		return known
+	}
+	if b.cfg.SQS.AccountID == "" {
+		return sqsName(queue)
+	}
+	return fmt.Sprintf("https://sqs.%s.amazonaws.com/%s/%s", b.cfg.SQS.Region, b.cfg.SQS.AccountID, sqsName(queue))
+}
+
+// env hands the buffer services the queue URLs of spec.broker.sqs.queues as
+// JSON. With a role, the EKS pod identity webhook injects the credentials.
+func (b sqsBackend) env() []corev1.EnvVar {
+	env := []corev1.EnvVar{
+		{Name: "BROKER_TYPE", Value: brokerTypeSQS},
+		{Name: "AWS_REGION", Value: b.cfg.SQS.Region},
+	}
+	if b.cfg.SQS.AccountID != "" {
+		env = append(env, corev1.EnvVar{Name: "SQS_ACCOUNT_ID", Value: b.cfg.SQS.AccountID})
+	}
+	if len(b.urls) > 0 {
+		urls, _ := json.Marshal(b.urls)
+		env = append(env, corev1.EnvVar{Name: "SQS_QUEUE_URLS", Value: string(urls)})
+	}
+	if b.cfg.SQS.CreateQueues {
+		env = append(env, corev1.EnvVar{Name: "SQS_CREATE_QUEUES", Value: "true"})
+	}
+	if b.cfg.SQS.RoleARN != "" || b.cfg.SecretRef == nil {
+		return env
+	}
+	secretKey := func(key string) *corev1.EnvVarSource {
+		return &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: *b.cfg.SecretRef, Key: key}}
+	}
+	return append(env,
+		corev1.EnvVar{Name: "AWS_ACCESS_KEY_ID", ValueFrom: secretKey(brokerUsernameKey)},
+		corev1.EnvVar{Name: "AWS_SECRET_ACCESS_KEY", ValueFrom: secretKey(brokerPasswordKey)},
+	)
+}
+
+func (b sqsBackend) addresses() []brokerHostPort {
+	return []brokerHostPort{{host: fmt.Sprintf("sqs.%s.amazonaws.com", b.cfg.SQS.Region), port: 443}}
+}
+
+// backlogTrigger scales on the visible and in-flight messages of the queue.
+func (b sqsBackend) backlogTrigger(queue string, target int32, activation string) kedav1alpha1.ScaleTriggers {
+	trigger := kedav1alpha1.ScaleTriggers{
+		Type:              "aws-sqs-queue",
+		AuthenticationRef: &kedav1alpha1.AuthenticationRef{Name: b.auth, Kind: "TriggerAuthentication"},
+		Metadata: map[string]string{
+			"queueURL":    b.queueURL(queue),
+			"queueLength": fmt.Sprintf("%d", target),
+			"awsRegion":   b.cfg.SQS.Region,
+		},
+	}
+	if activation != "" {
+		trigger.Metadata["activationQueueLength"] = activation
+	}
+	return trigger
+}
+
+func (b sqsBackend) queueMetrics() bool {
+	return false
+}
+
+func (b sqsBackend) queued() bool {
+	return true
+}
+
+// redisBackend queues requests on Redis streams named after the queues. The
+// consumers of a Service share one consumer group and delete the entries they
+// answer, so the length of a stream is its backlog.
+type redisBackend struct {
+	cfg      schedulingv1alpha1.BrokerConfig
+	exchange string
+	auth     string
+}
+
+func (b redisBackend) consumerGroup() string {
+	return b.exchange + ".consumer"
+}
+
+func (b redisBackend) env() []corev1.EnvVar {
+	env := []corev1.EnvVar{
+		{Name: "BROKER_TYPE", Value: brokerTypeRedis},
+		{Name: "REDIS_ADDRESS", Value: b.cfg.Redis.Address},
+		{Name: "REDIS_DB", Value: strconv.Itoa(int(b.cfg.Redis.DatabaseIndex))},
+		{Name: "REDIS_CONSUMER_GROUP", Value: b.consumerGroup()},
+	}
+	if b.cfg.Redis.TLS {
+		env = append(env, corev1.EnvVar{Name: "REDIS_TLS", Value: "true"})
+	}
+	if b.cfg.SecretRef == nil {
+		return env
+	}
+	secretKey := func(key string) *corev1.EnvVarSource {
+		return &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: *b.cfg.SecretRef, Key: key}}
+	}
+	return append(env,
+		corev1.EnvVar{Name: "REDIS_USERNAME", ValueFrom: secretKey(brokerUsernameKey)},
+		corev1.EnvVar{Name: "REDIS_PASSWORD", ValueFrom: secretKey(brokerPasswordKey)},
+	)
+}
+
+func (b redisBackend) addresses() []brokerHostPort {
+	address := brokerHostPort{host: b.cfg.Redis.Address, port: defaultRedisPort}
+	if host, port, err := net.SplitHostPort(b.cfg.Redis.Address); err == nil {
+		address.host = host
+		if number, err := strconv.ParseInt(port, 10, 32); err == nil {
+			address.port = int32(number)
+		}
+	}
+	return []brokerHostPort{address}
+}
+
+// backlogTrigger scales on the length of the stream, which holds the entries
+// waiting and those being answered.
+// backlogTrigger scales on the length of the stream, which is its backlog as
+// the consumers delete the entries they answer. KEDA reads pending entries
+// instead whenever a consumer group is set, which would miss unread entries.
+func (b redisBackend) backlogTrigger(stream string, target int32, activation string) kedav1alpha1.ScaleTriggers {
+	trigger := kedav1alpha1.ScaleTriggers{
+		Type: "redis-streams",
+		Metadata: map[string]string{
+			"address":       b.cfg.Redis.Address,
+			"stream":        stream,
+			"streamLength":  fmt.Sprintf("%d", target),
+			"databaseIndex": strconv.Itoa(int(b.cfg.Redis.DatabaseIndex)),
+		},
+	}
+	if activation != "" {
+		trigger.Metadata["activationStreamLength"] = activation
+	}
+	if b.cfg.Redis.TLS {
+		trigger.Metadata["enableTLS"] = "true"
+	}
+	if b.cfg.SecretRef != nil {
+		trigger.AuthenticationRef = &kedav1alpha1.AuthenticationRef{Name: b.auth, Kind: "TriggerAuthentication"}
+	}
+	return trigger
+}
+
+func (b redisBackend) queueMetrics() bool {
+	return false
+}
+
+func (b redisBackend) queued() bool {
+	return true
+}
+
+// directBackend forwards requests straight from the router, for clusters
+// without a broker such as local ones. Only the weights of the routing backend
+// split them.
+type directBackend struct{}
+
+func (directBackend) env() []corev1.EnvVar {
+	return []corev1.EnvVar{{Name: "BROKER_TYPE", Value: brokerTypeNone}}
+}
+
+func (directBackend) addresses() []brokerHostPort {
+	return nil
+}
+
+// backlogTrigger is never called, as no request waits in a queue.
+func (directBackend) backlogTrigger(string, int32, string) kedav1alpha1.ScaleTriggers {
+	return kedav1alpha1.ScaleTriggers{}
+}
+
+func (directBackend) queueMetrics() bool {
+	return false
+}
+
+func (directBackend) queued() bool {
+	return false
+}
+
+// serviceAccountRole returns the IAM role the ServiceAccount of the buffer
+// services is bound to.
+func serviceAccountRole(cfg schedulingv1alpha1.BrokerConfig) string {
+	if brokerType(cfg) != brokerTypeSQS || cfg.SQS == nil {
+		return ""
+	}
+	return cfg.SQS.RoleARN
+}
+
+func brokerTriggerAuthenticationName(svc *corev1.Service) string {
+	return fmt.Sprintf("%s-carbonrouter-broker", svc.Name)
+}
+
+// ensureBrokerTriggerAuthentication hands KEDA the credentials of a Kafka
+// cluster, a Redis server, SQS, a provisioned RabbitMQ cluster or a RabbitMQ
+// tenant, and removes them when no longer needed. The shared
+// ClusterTriggerAuthentication of the chart covers its RabbitMQ, and KEDA reads
+// NATS from its unauthenticated monitoring endpoint.
+func (r *FlavourRouterReconciler) ensureBrokerTriggerAuthentication(ctx context.Context, svc *corev1.Service, cfg schedulingv1alpha1.BrokerConfig) error {
+	name := brokerTriggerAuthenticationName(svc)
+	userPassword := (brokerType(cfg) == brokerTypeKafka || brokerType(cfg) == brokerTypeRedis) && cfg.SecretRef != nil
+	provisioned := brokerType(cfg) == brokerTypeRabbitMQ && (cfg.Cluster != nil || tenantIsolation(cfg) != tenantIsolationShared)
+	if !userPassword && !provisioned && brokerType(cfg) != brokerTypeSQS {
+		var existing kedav1alpha1.TriggerAuthentication
+		if err := r.Get(ctx, client.ObjectKey{Namespace: svc.Namespace, Name: name}, &existing); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if err := r.Delete(ctx, &existing); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		r.Inventory.Drop(client.ObjectKeyFromObject(svc), "TriggerAuthentication", svc.Namespace, name)
+		return nil
+	}
+
+	auth := &kedav1alpha1.TriggerAuthentication{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: svc.Namespace,
+			Labels:    map[string]string{parentServiceLabel: svc.Name},
+		},
+	}
+	switch {
+	case provisioned:
+		auth.Spec.SecretTargetRef = []kedav1alpha1.AuthSecretTargetRef{
+			{Parameter: "host", Name: cfg.SecretRef.Name, Key: provisionedBrokerURIKey},
+		}
+	case userPassword:
+		auth.Spec.SecretTargetRef = []kedav1alpha1.AuthSecretTargetRef{
+			{Parameter: "username", Name: cfg.SecretRef.Name, Key: brokerUsernameKey},
+			{Parameter: "password", Name: cfg.SecretRef.Name, Key: brokerPasswordKey},
+		}
+	case cfg.SQS != nil && cfg.SQS.RoleARN != "":
+		auth.Spec.PodIdentity = &kedav1alpha1.AuthPodIdentity{Provider: kedav1alpha1.PodIdentityProviderAws, RoleArn: ptr.To(cfg.SQS.RoleARN)}
+	case cfg.SecretRef != nil:
+		auth.Spec.SecretTargetRef = []kedav1alpha1.AuthSecretTargetRef{
+			{Parameter: "awsAccessKeyID", Name: cfg.SecretRef.Name, Key: brokerUsernameKey},
+			{Parameter: "awsSecretAccessKey", Name: cfg.SecretRef.Name, Key: brokerPasswordKey},
+		}
+	default:
+		// The role of KEDA itself
+		auth.Spec.PodIdentity = &kedav1alpha1.AuthPodIdentity{Provider: kedav1alpha1.PodIdentityProviderAws, IdentityOwner: ptr.To("keda")}
+	}
+	if err := ctrl.SetControllerReference(svc, auth, r.Scheme); err != nil {
+		return err
+	}
+	return r.apply(ctx, svc, "TriggerAuthentication", auth, &auth.Spec)
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	// bufferAlways is the policy of precisions without one. The others are
+	// always-direct and buffer-when-throttled, which the router tells apart.
+	bufferAlways               = "always-buffer"
+	bufferPoliciesEnvVariable  = "BUFFER_POLICIES"
+	directMethodsEnvVariable   = "DIRECT_METHODS"
+	priorityClassesEnvVariable = "PRIORITY_CLASSES"
+)
+
+// bufferPolicy returns the buffering policy of precision, always-buffer when
+// the Service sets none.
+func bufferPolicy(cfg schedulingv1alpha1.BufferConfig, precision int) string {
+	for _, policy := range cfg.Policies {
+		if policy.Precision == precision && policy.Policy != "" {
+			return policy.Policy
+		}
+	}
+	return bufferAlways
+}
+
+// skipsBuffer reports whether requests of precision may be sent to its direct
+// queue, which the consumer drains without the processing throttle. The
+// direct methods go to the queue of the highest precision.
+func skipsBuffer(cfg schedulingv1alpha1.BufferConfig, precision, highest int) bool {
+	return bufferPolicy(cfg, precision) != bufferAlways || len(cfg.DirectMethods) > 0 && precision == highest
+}
+
+// bufferPolicyEnv tells the router which precisions skip the buffer and the
+// consumer which direct queues to drain, as "precision-100=always-direct,...",
+// both of them which methods go direct at the highest precision, and the
+// priority classes of the buffered requests.
+func bufferPolicyEnv(cfg schedulingv1alpha1.BufferConfig) ([]corev1.EnvVar, error) {
+	var entries []string
+	for _, policy := range cfg.Policies {
+		if policy.Policy == "" || policy.Policy == bufferAlways {
+			continue
+		}
+		entries = append(entries, fmt.Sprintf("%s=%s", precisionQueueSuffix(policy.Precision), policy.Policy))
+	}
+	var env []corev1.EnvVar
+	if len(entries) > 0 {
+		slices.Sort(entries)
+		env = append(env, corev1.EnvVar{Name: bufferPoliciesEnvVariable, Value: strings.Join(entries, ",")})
+	}
+	if len(cfg.DirectMethods) > 0 {
+		methods := make([]string, 0, len(cfg.DirectMethods))
+		for _, method := range cfg.DirectMethods {
+			methods = append(methods, string(method))
+		}
+		slices.Sort(methods)
+		env = append(env, corev1.EnvVar{Name: directMethodsEnvVariable, Value: strings.Join(slices.Compact(methods), ",")})
+	}
+	if len(cfg.PriorityClasses) > 0 {
+		// The router matches the classes in order, the consumer ranks them
+		classes, err := json.Marshal(cfg.PriorityClasses)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, corev1.EnvVar{Name: priorityClassesEnvVariable, Value: string(classes)})
+	}
+	return env, nil
+}
+
+// priorityQueueTarget is the queue length at which the backlog of a class of
+// weight scales a workload out.
+func priorityQueueTarget(target, weight int32) int32 {
+	return max(1, target/max(1, weight))
+}
+
+// bufferedQueueTargets maps the buffered queues of a precision to the queue
+// length at which each scales a workload out, the default class first.
+func bufferedQueueTargets(naming queueNaming, namespace, service string, precision int, classes []schedulingv1alpha1.PriorityClass, target int32) ([]string, []int32) {
+	queues := []string{naming.bufferedQueue(namespace, service, precision)}
+	targets := []int32{target}
+	for _, class := range classes {
+		queues = append(queues, naming.queueName(namespace, service, priorityQueueType(class.Name), precision))
+		targets = append(targets, priorityQueueTarget(target, class.Weight))
+	}
+	return queues, targets
+}
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestBufferPolicy(t *testing.T) {
+	cfg := schedulingv1alpha1.BufferConfig{Policies: []schedulingv1alpha1.BufferPolicy{
+		{Precision: 100, Policy: "always-direct"},
+		{Precision: 50, Policy: "buffer-when-throttled"},
+		{Precision: 30},
+	}}
+	tests := []struct {
+		precision int
+		policy    string
+		skips     bool
+	}{
+		{precision: 100, policy: "always-direct", skips: true},
+		{precision: 50, policy: "buffer-when-throttled", skips: true},
+		{precision: 30, policy: bufferAlways},
+		{precision: 10, policy: bufferAlways},
+	}
+	for _, tt := range tests {
+		if got := bufferPolicy(cfg, tt.precision); got != tt.policy {
+			t.Errorf("precision %d: got policy %q, want %q", tt.precision, got, tt.policy)
+		}
+		if got := skipsBuffer(cfg, tt.precision, 100); got != tt.skips {
+			t.Errorf("precision %d: got skips buffer %v, want %v", tt.precision, got, tt.skips)
+		}
+	}
+}
+
+func TestBufferPolicyEnv(t *testing.T) {
+	env, err := bufferPolicyEnv(schedulingv1alpha1.BufferConfig{Policies: []schedulingv1alpha1.BufferPolicy{{Precision: 30, Policy: bufferAlways}}})
+	if err != nil || env != nil {
+		t.Errorf("always-buffer only: got %v, %v, want no env", env, err)
+	}
+	env, err = bufferPolicyEnv(schedulingv1alpha1.BufferConfig{Policies: []schedulingv1alpha1.BufferPolicy{
+		{Precision: 50, Policy: "buffer-when-throttled"},
+		{Precision: 30, Policy: bufferAlways},
+		{Precision: 100, Policy: "always-direct"},
+	}})
+	want := []corev1.EnvVar{{Name: bufferPoliciesEnvVariable, Value: "precision-100=always-direct,precision-50=buffer-when-throttled"}}
+	if err != nil || !reflect.DeepEqual(env, want) {
+		t.Errorf("got %v, %v, want %v", env, err, want)
+	}
+}
+
+func TestDirectMethods(t *testing.T) {
+	cfg := schedulingv1alpha1.BufferConfig{DirectMethods: []schedulingv1alpha1.HTTPMethod{"PUT", "DELETE", "POST", "PUT"}}
+	for _, tt := range []struct {
+		precision int
+		skips     bool
+	}{{precision: 100, skips: true}, {precision: 50}} {
+		if got := skipsBuffer(cfg, tt.precision, 100); got != tt.skips {
+			t.Errorf("precision %d: got skips buffer %v, want %v", tt.precision, got, tt.skips)
+		}
+	}
+
+	env, err := bufferPolicyEnv(cfg)
+	want := []corev1.EnvVar{{Name: directMethodsEnvVariable, Value: "DELETE,POST,PUT"}}
+	if err != nil || !reflect.DeepEqual(env, want) {
+		t.Errorf("got %v, %v, want %v", env, err, want)
+	}
+	cfg.Policies = []schedulingv1alpha1.BufferPolicy{{Precision: 50, Policy: "always-direct"}}
+	if env, _ := bufferPolicyEnv(cfg); len(env) != 2 || env[0].Name != bufferPoliciesEnvVariable || env[1].Name != directMethodsEnvVariable {
+		t.Errorf("got %v, want the policies and the direct methods", env)
+	}
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"maps"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+// Phases of the burst reserve of a Service.
+const (
+	burstReserveStandby  = "Standby"
+	burstReserveWithheld = "Withheld"
+	burstReserveReleased = "Released"
+
+	defaultBurstReleaseMinutes = 15
+)
+
+// advanceBurstReserve moves the burst reserve of a Service on from its last
+// reported phase: it is withheld while processing is throttled, released when
+// the throttle lifts, and back on standby once the last backlog read is
+// drained or the release expires. It returns nil without a reserve.
+func advanceBurstReserve(cfg *schedulingv1alpha1.BurstReserveConfig, prev *schedulingv1alpha1.BurstReserveStatus, throttled bool, now time.Time) *schedulingv1alpha1.BurstReserveStatus {
+	if cfg == nil {
+		return nil
+	}
+	next := &schedulingv1alpha1.BurstReserveStatus{Phase: burstReserveStandby}
+	if prev != nil {
+		next = prev.DeepCopy()
+	}
+	switch {
+	case throttled:
+		next.Phase = burstReserveWithheld
+	case next.Phase == burstReserveWithheld:
+		release := time.Duration(ptr.Deref(cfg.ReleaseMinutes, defaultBurstReleaseMinutes)) * time.Minute
+		now = now.Truncate(time.Second)
+		next.Phase = burstReserveReleased
+		next.ReleasedAt = ptr.To(metav1.NewTime(now))
+		next.ReleaseUntil = ptr.To(metav1.NewTime(now.Add(release)))
+		next.BacklogAtRelease = next.Backlog
+		next.DrainedPercent = 0
+	case next.Phase == burstReserveReleased && (next.ReleaseUntil == nil || !now.Before(next.ReleaseUntil.Time) || next.Backlog == 0):
+		next.Phase = burstReserveStandby
+	}
+	return next
+}
+
+// releaseBurstReserve raises the maxReplicaCount of a component by replicas,
+// and its minReplicaCount too when the reserve pre-scales.
+func releaseBurstReserve(autoscaling schedulingv1alpha1.AutoscalingConfig, replicas int32, preScale bool) schedulingv1alpha1.AutoscalingConfig {
+	if replicas <= 0 || autoscaling.MaxReplicaCount == nil {
+		return autoscaling
+	}
+	autoscaling.MaxReplicaCount = ptr.To(*autoscaling.MaxReplicaCount + replicas)
+	if preScale {
+		autoscaling.MinReplicaCount = ptr.To(min(ptr.Deref(autoscaling.MinReplicaCount, 0)+replicas, *autoscaling.MaxReplicaCount))
+	}
+	return autoscaling
+}
+
+// burstCeilings raises the replica ceilings of the consumers and targets by
+// the reserve, which would otherwise cap the raised maxReplicaCount.
+func burstCeilings(ceilings map[string]int32, cfg *schedulingv1alpha1.BurstReserveConfig) map[string]int32 {
+	raised := maps.Clone(ceilings)
+	for component, replicas := range map[string]int32{"consumer": cfg.ConsumerReplicas, "target": cfg.TargetReplicas} {
+		if ceiling, ok := raised[component]; ok && ceiling > 0 {
+			raised[component] = ceiling + replicas
+		}
+	}
+	return raised
+}
+
+// reportBurstDrain records the backlog of the buffered queues in the status of
+// the reserve and how much of it was drained since the release.
+func reportBurstDrain(burst *schedulingv1alpha1.BurstReserveStatus, depths map[string]int64) {
+	burst.Backlog = 0
+	for _, depth := range depths {
+		burst.Backlog += depth
+	}
+	if burst.Phase == burstReserveReleased && burst.BacklogAtRelease > 0 {
+		drained := max(burst.BacklogAtRelease-burst.Backlog, 0)
+		burst.DrainedPercent = int32(drained * 100 / burst.BacklogAtRelease)
+	}
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestAdvanceBurstReserve(t *testing.T) {
+	cfg := &schedulingv1alpha1.BurstReserveConfig{ConsumerReplicas: 4, ReleaseMinutes: ptr.To[int32](10)}
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	released := &schedulingv1alpha1.BurstReserveStatus{
+		Phase:        burstReserveReleased,
+		ReleasedAt:   ptr.To(metav1.NewTime(now.Add(-5 * time.Minute))),
+		ReleaseUntil: ptr.To(metav1.NewTime(now.Add(5 * time.Minute))),
+		Backlog:      120,
+	}
+	withBacklog := func(status *schedulingv1alpha1.BurstReserveStatus, backlog int64) *schedulingv1alpha1.BurstReserveStatus {
+		status = status.DeepCopy()
+		status.Backlog = backlog
+		return status
+	}
+
+	if got := advanceBurstReserve(nil, released, true, now); got != nil {
+		t.Errorf("no reserve: got %+v, want nil", got)
+	}
+	tests := []struct {
+		name      string
+		prev      *schedulingv1alpha1.BurstReserveStatus
+		throttled bool
+		now       time.Time
+		want      string
+	}{
+		{name: "first reconcile", want: burstReserveStandby},
+		{name: "first reconcile throttled", throttled: true, want: burstReserveWithheld},
+		{name: "throttled while released", prev: released, throttled: true, want: burstReserveWithheld},
+		{name: "still withheld", prev: &schedulingv1alpha1.BurstReserveStatus{Phase: burstReserveWithheld}, throttled: true, want: burstReserveWithheld},
+		{name: "backlog left", prev: released, now: now, want: burstReserveReleased},
+		{name: "backlog drained", prev: withBacklog(released, 0), now: now, want: burstReserveStandby},
+		{name: "release expired", prev: released, now: now.Add(5 * time.Minute), want: burstReserveStandby},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := advanceBurstReserve(cfg, tt.prev, tt.throttled, tt.now)
+			if got.Phase != tt.want {
+				t.Errorf("got phase %s, want %s", got.Phase, tt.want)
+			}
+		})
+	}
+
+	// The throttle lifting releases the reserve for the configured minutes
+	withheld := &schedulingv1alpha1.BurstReserveStatus{Phase: burstReserveWithheld, Backlog: 300, DrainedPercent: 40}
+	got := advanceBurstReserve(cfg, withheld, false, now.Add(500*time.Millisecond))
+	if got.Phase != burstReserveReleased || !got.ReleasedAt.Time.Equal(now) || !got.ReleaseUntil.Time.Equal(now.Add(10*time.Minute)) {
+		t.Errorf("got %+v, want released at %v for 10 minutes", got, now)
+	}
+	if got.BacklogAtRelease != 300 || got.DrainedPercent != 0 {
+		t.Errorf("got backlog at release %d drained %d%%, want 300 and 0%%", got.BacklogAtRelease, got.DrainedPercent)
+	}
+	if withheld.Phase != burstReserveWithheld {
+		t.Error("the previous status was modified")
+	}
+	got = advanceBurstReserve(&schedulingv1alpha1.BurstReserveConfig{}, withheld, false, now)
+	if !got.ReleaseUntil.Time.Equal(now.Add(defaultBurstReleaseMinutes * time.Minute)) {
+		t.Errorf("got release until %v, want the default release", got.ReleaseUntil)
+	}
+}
+
+func TestReleaseBurstReserve(t *testing.T) {
+	autoscaling := schedulingv1alpha1.AutoscalingConfig{MinReplicaCount: ptr.To[int32](1), MaxReplicaCount: ptr.To[int32](5)}
+	tests := []struct {
+		name        string
+		autoscaling schedulingv1alpha1.AutoscalingConfig
+		replicas    int32
+		preScale    bool
+		wantMin     *int32
+		wantMax     *int32
+	}{
+		{name: "no replicas", autoscaling: autoscaling, preScale: true, wantMin: ptr.To[int32](1), wantMax: ptr.To[int32](5)},
+		{name: "no max", autoscaling: schedulingv1alpha1.AutoscalingConfig{}, replicas: 3},
+		{name: "max raised", autoscaling: autoscaling, replicas: 3, wantMin: ptr.To[int32](1), wantMax: ptr.To[int32](8)},
+		{name: "pre-scaled", autoscaling: autoscaling, replicas: 3, preScale: true, wantMin: ptr.To[int32](4), wantMax: ptr.To[int32](8)},
+		{name: "pre-scaled without min", autoscaling: schedulingv1alpha1.AutoscalingConfig{MaxReplicaCount: ptr.To[int32](2)}, replicas: 3, preScale: true,
+			wantMin: ptr.To[int32](3), wantMax: ptr.To[int32](5)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := releaseBurstReserve(tt.autoscaling, tt.replicas, tt.preScale)
+			if !reflect.DeepEqual(got.MinReplicaCount, tt.wantMin) || !reflect.DeepEqual(got.MaxReplicaCount, tt.wantMax) {
+				t.Errorf("got min %v max %v, want min %v max %v", ptr.Deref(got.MinReplicaCount, -1), ptr.Deref(got.MaxReplicaCount, -1),
+					ptr.Deref(tt.wantMin, -1), ptr.Deref(tt.wantMax, -1))
+			}
+		})
+	}
+	if *autoscaling.MaxReplicaCount != 5 {
+		t.Error("the component settings were modified")
+	}
+}
+
+func TestBurstCeilings(t *testing.T) {
+	ceilings := map[string]int32{"consumer": 4, "target": 0, "router": 2}
+	got := burstCeilings(ceilings, &schedulingv1alpha1.BurstReserveConfig{ConsumerReplicas: 3, TargetReplicas: 2})
+	want := map[string]int32{"consumer": 7, "target": 0, "router": 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if ceilings["consumer"] != 4 {
+		t.Error("the shared ceilings were modified")
+	}
+}
+
+func TestReportBurstDrain(t *testing.T) {
+	depths := map[string]int64{"precision-50": 40, "precision-30": 20}
+	standby := &schedulingv1alpha1.BurstReserveStatus{Phase: burstReserveStandby, BacklogAtRelease: 200}
+	reportBurstDrain(standby, depths)
+	if standby.Backlog != 60 || standby.DrainedPercent != 0 {
+		t.Errorf("standby: got %+v, want the backlog only", standby)
+	}
+	released := &schedulingv1alpha1.BurstReserveStatus{Phase: burstReserveReleased, BacklogAtRelease: 200}
+	reportBurstDrain(released, depths)
+	if released.Backlog != 60 || released.DrainedPercent != 70 {
+		t.Errorf("released: got %+v, want 70%% drained", released)
+	}
+	reportBurstDrain(released, map[string]int64{"precision-50": 500})
+	if released.DrainedPercent != 0 {
+		t.Errorf("grown backlog: got %d%% drained, want 0%%", released.DrainedPercent)
+	}
+}
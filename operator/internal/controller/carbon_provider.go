@@ -0,0 +1,262 @@
+package controller
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/engine"
+)
+
+const (
+	carbonProviderCarbonIntensity = "carbonintensity"
+	carbonProviderElectricityMaps = "electricitymaps"
+	carbonProviderWattTime        = "watttime"
+	carbonProviderTokenKey        = "token"
+	carbonProviderUsernameKey     = "username"
+	carbonProviderPasswordKey     = "password"
+	defaultCarbonProviderTimeout  = 2 * time.Second
+)
+
+// CarbonProviderURLs are the base URLs of the carbon intensity APIs; empty
+// ones use the public APIs.
+type CarbonProviderURLs struct {
+	CarbonIntensity string
+	ElectricityMaps string
+	WattTime        string
+}
+
+// url returns the base URL of the API of kind.
+func (u CarbonProviderURLs) url(kind string) string {
+	switch kind {
+	case carbonProviderCarbonIntensity:
+		return cmp.Or(u.CarbonIntensity, engine.DefaultCarbonAPIURL)
+	case carbonProviderElectricityMaps:
+		return cmp.Or(u.ElectricityMaps, engine.DefaultElectricityMapsURL)
+	case carbonProviderWattTime:
+		return cmp.Or(u.WattTime, engine.DefaultWattTimeURL)
+	}
+	return ""
+}
+
+// newCarbonProvider returns the provider of kind at baseURL with the
+// credentials of secret, which the Carbon Intensity API needs none of.
+func newCarbonProvider(kind, baseURL string, secret *corev1.Secret) (engine.CarbonProvider, error) {
+	secretName := func() string {
+		if secret == nil {
+			return ""
+		}
+		return secret.Namespace + "/" + secret.Name
+	}
+	switch kind {
+	case carbonProviderCarbonIntensity:
+		return engine.NewCarbonIntensityAPI(baseURL), nil
+	case carbonProviderElectricityMaps:
+		token := ""
+		if secret != nil {
+			token = strings.TrimSpace(string(secret.Data[carbonProviderTokenKey]))
+		}
+		if token == "" {
+			return nil, dependencyMissingError(fmt.Errorf("carbon provider secret %s has no %q key", secretName(), carbonProviderTokenKey))
+		}
+		return engine.NewElectricityMaps(baseURL, token), nil
+	case carbonProviderWattTime:
+		username, password := "", ""
+		if secret != nil {
+			username = strings.TrimSpace(string(secret.Data[carbonProviderUsernameKey]))
+			password = string(secret.Data[carbonProviderPasswordKey])
+		}
+		if username == "" || password == "" {
+			return nil, dependencyMissingError(fmt.Errorf("carbon provider secret %s needs the %q and %q keys",
+				secretName(), carbonProviderUsernameKey, carbonProviderPasswordKey))
+		}
+		return engine.NewWattTime(baseURL, username, password), nil
+	}
+	return nil, invalidConfigError(fmt.Errorf("unknown carbon provider %q", kind))
+}
+
+// carbonProviderFor returns the provider of spec.scheduler.carbonProvider with
+// the credentials of its Secret, or nil when the decision engine fetches the
+// forecast. The Secret is read uncached like the engine credentials. With
+// spec.scheduler.carbonProviderRef, the forecast is read from the status of
+// the CarbonIntensityProvider instead.
+func (r *TrafficScheduleReconciler) carbonProviderFor(ctx context.Context, ts *schedulingv1alpha1.TrafficSchedule) (engine.CarbonProvider, error) {
+	s := ts.Spec.Scheduler
+	if s.CarbonProviderRef != "" {
+		var cip schedulingv1alpha1.CarbonIntensityProvider
+		if err := r.Get(ctx, client.ObjectKey{Name: s.CarbonProviderRef}, &cip); err != nil {
+			return nil, dependencyMissingError(fmt.Errorf("spec.scheduler.carbonProviderRef %s: %w", s.CarbonProviderRef, err))
+		}
+		return providerStatus{reader: r.Client}, nil
+	}
+	if s.CarbonProvider == "" {
+		return nil, nil
+	}
+	if carbonProviderTarget(s) == "" {
+		return nil, invalidConfigError(fmt.Errorf("spec.scheduler.carbonProvider %s needs spec.scheduler.carbonTarget", s.CarbonProvider))
+	}
+	var secret *corev1.Secret
+	if s.CarbonProvider != carbonProviderCarbonIntensity {
+		var err error
+		if secret, err = r.carbonProviderSecret(ctx, ts); err != nil {
+			return nil, err
+		}
+	}
+	return newCarbonProvider(s.CarbonProvider, r.CarbonProviderURLs.url(s.CarbonProvider), secret)
+}
+
+// carbonProviderTarget is the carbon target of the provider of s: the name of
+// the CarbonIntensityProvider of carbonProviderRef, or carbonTarget, the
+// national forecast for the Carbon Intensity API when s sets none.
+func carbonProviderTarget(s schedulingv1alpha1.SchedulerConfigSpec) string {
+	if s.CarbonProviderRef != "" {
+		return s.CarbonProviderRef
+	}
+	if s.CarbonTarget != nil && strings.TrimSpace(*s.CarbonTarget) != "" {
+		return strings.TrimSpace(*s.CarbonTarget)
+	}
+	if s.CarbonProvider == carbonProviderCarbonIntensity {
+		return "national"
+	}
+	return ""
+}
+
+// carbonRefreshInterval is how long the forecast of the provider of s is
+// cached, and so how often it is fetched again; zero without a provider, and
+// for CarbonIntensityProviders, whose updates reconcile the schedules
+// referencing them.
+func carbonRefreshInterval(s schedulingv1alpha1.SchedulerConfigSpec) time.Duration {
+	switch {
+	case s.CarbonProvider == "" || s.CarbonProviderRef != "":
+		return 0
+	case s.CarbonCacheTTL != nil && *s.CarbonCacheTTL > 0:
+		return time.Duration(*s.CarbonCacheTTL) * time.Second
+	default:
+		return engine.DefaultProviderCacheTTL
+	}
+}
+
+func (r *TrafficScheduleReconciler) carbonProviderSecret(ctx context.Context, ts *schedulingv1alpha1.TrafficSchedule) (*corev1.Secret, error) {
+	ref := ts.Spec.Scheduler.CarbonProviderSecretRef
+	if ref == nil || ref.Name == "" {
+		return nil, invalidConfigError(fmt.Errorf("spec.scheduler.carbonProvider %s needs spec.scheduler.carbonProviderSecretRef", ts.Spec.Scheduler.CarbonProvider))
+	}
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+	var secret corev1.Secret
+	if err := reader.Get(ctx, client.ObjectKey{Namespace: ts.Namespace, Name: ref.Name}, &secret); err != nil {
+		return nil, dependencyMissingError(fmt.Errorf("carbon provider secret %s/%s: %w", ts.Namespace, ref.Name, err))
+	}
+	return &secret, nil
+}
+
+// withOperatorForecast replaces the forecast of a decision of the external
+// decision engine, and those of the spec.locality zones, with the ones the
+// operator fetches from the provider of spec.scheduler.carbonProvider or
+// carbonProviderRef. While the provider fails, the forecasts of the engine
+// stay.
+func (r *TrafficScheduleReconciler) withOperatorForecast(ctx context.Context, ts *schedulingv1alpha1.TrafficSchedule, remote engine.Schedule) (engine.Schedule, error) {
+	provider, err := r.carbonProviderFor(ctx, ts)
+	if err != nil || provider == nil {
+		return remote, err
+	}
+	s := ts.Spec.Scheduler
+	timeout := defaultCarbonProviderTimeout
+	if s.CarbonTimeout != nil {
+		timeout = time.Duration(*s.CarbonTimeout) * time.Second
+	}
+	log := ctrl.LoggerFrom(ctx).WithName("[TrafficSchedule]")
+	key := client.ObjectKeyFromObject(ts)
+	now := time.Now().UTC()
+	cache := r.forecasts.cache(forecastCacheKey{schedule: key}, provider, carbonProviderTarget(s), timeout, carbonRefreshInterval(s))
+	carbon, err := cache.Carbon(ctx, now)
+	switch {
+	case err != nil:
+		log.Error(err, "Carbon forecast unavailable, keeping the one of the decision engine", "target", carbonProviderTarget(s))
+	case carbon.Now != nil:
+		remote.Carbon = carbon
+	}
+
+	if !ts.Spec.Locality.Enabled {
+		return remote, nil
+	}
+	for _, zone := range ts.Spec.Locality.Zones {
+		if zone.Name == "" || zone.CarbonTarget == "" {
+			continue
+		}
+		cache := r.forecasts.cache(forecastCacheKey{schedule: key, zone: zone.Name}, provider, zone.CarbonTarget, timeout, carbonRefreshInterval(s))
+		carbon, err := cache.Carbon(ctx, now)
+		if err != nil || carbon.Now == nil {
+			continue
+		}
+		if remote.Zones == nil {
+			remote.Zones = map[string]float64{}
+		}
+		remote.Zones[zone.Name] = *carbon.Now
+	}
+	return remote, nil
+}
+
+// forecastCaches keeps the forecast cache of every schedule whose forecast the
+// operator fetches, so the rate limits of the providers are respected across
+// reconciles.
+type forecastCaches struct {
+	mu      sync.Mutex
+	entries map[forecastCacheKey]forecastCacheEntry
+}
+
+// forecastCacheKey is the forecast of a schedule, or of one of its
+// spec.locality zones.
+type forecastCacheKey struct {
+	schedule types.NamespacedName
+	zone     string
+}
+
+type forecastCacheEntry struct {
+	provider engine.CarbonProvider
+	target   string
+	timeout  time.Duration
+	ttl      time.Duration
+	cache    *engine.ForecastCache
+}
+
+// cache returns the cache of key, replaced when its provider or settings
+// changed.
+func (c *forecastCaches) cache(key forecastCacheKey, provider engine.CarbonProvider, target string, timeout, ttl time.Duration) *engine.ForecastCache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if ok && reflect.DeepEqual(entry.provider, provider) && entry.target == target && entry.timeout == timeout && entry.ttl == ttl {
+		return entry.cache
+	}
+	if c.entries == nil {
+		c.entries = map[forecastCacheKey]forecastCacheEntry{}
+	}
+	entry = forecastCacheEntry{provider: provider, target: target, timeout: timeout, ttl: ttl,
+		cache: engine.NewForecastCache(provider, target, timeout, ttl)}
+	c.entries[key] = entry
+	return entry.cache
+}
+
+// forget drops the caches of a deleted schedule.
+func (c *forecastCaches) forget(schedule types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if key.schedule == schedule {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package controller
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	// savingsDays and savingsMonths bound the roll-ups kept in the status.
+	savingsDays   = 31
+	savingsMonths = 12
+)
+
+// The savings accounted per Service, as the routers report them.
+var (
+	savingsRequestsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "carbonrouter_savings_requests_total",
+		Help: "Answered requests accounted for carbon savings.",
+	}, []string{"namespace", "service"})
+	baselineGramsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "carbonrouter_carbon_baseline_grams_total",
+		Help: "Estimated gCO2eq the accounted requests would have cost at the highest precision.",
+	}, []string{"namespace", "service"})
+	avoidedGramsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "carbonrouter_carbon_avoided_grams_total",
+		Help: "Estimated gCO2eq avoided by serving the accounted requests at lower precisions.",
+	}, []string{"namespace", "service"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(savingsRequestsCounter, baselineGramsCounter, avoidedGramsCounter)
+}
+
+// savingsCounters are the savings of a set of requests, as reported by the
+// routers on their admin port.
+type savingsCounters struct {
+	Requests      int64   `json:"requests"`
+	BaselineGrams float64 `json:"baselineGrams"`
+	AvoidedGrams  float64 `json:"avoidedGrams"`
+}
+
+func (c *savingsCounters) add(other savingsCounters) {
+	c.Requests += other.Requests
+	c.BaselineGrams += other.BaselineGrams
+	c.AvoidedGrams += other.AvoidedGrams
+}
+
+// savingsWindow is what the Services of a schedule accounted since its last
+// roll-up.
+type savingsWindow struct {
+	since    time.Time
+	services map[string]savingsCounters
+}
+
+// SavingsLedger collects the carbon savings the routers of every Service
+// account, until the TrafficSchedule controller rolls them up in the status of
+// the schedule bound to the Service. It is safe for concurrent use and
+// tolerates a nil receiver.
+type SavingsLedger struct {
+	mu sync.Mutex
+	// started is when the ledger started reading the routers
+	started time.Time
+	// seen holds the cumulative counters last read from each router pod of a
+	// Service, per flavour
+	seen    map[types.NamespacedName]map[types.UID]map[string]savingsCounters
+	pending map[types.NamespacedName]*savingsWindow
+}
+
+// NewSavingsLedger returns an empty ledger.
+func NewSavingsLedger() *SavingsLedger {
+	return &SavingsLedger{
+		started: time.Now(),
+		seen:    map[types.NamespacedName]map[types.UID]map[string]savingsCounters{},
+		pending: map[types.NamespacedName]*savingsWindow{},
+	}
+}
+
+// record adds what the router pods of service accounted since they were last
+// read to the window of schedule. A counter gone down means the router
+// restarted, and counts from zero. running maps the running pods to their
+// creation time: the first counters read from a pod created before the ledger
+// started are only its baseline, as they were accounted in the status before
+// the operator restarted or another replica took the lead. Only the running
+// pods are kept, the ones not read this time with the counters last read.
+func (l *SavingsLedger) record(schedule, service types.NamespacedName, reports map[types.UID]map[string]savingsCounters, running map[types.UID]time.Time) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var delta savingsCounters
+	for pod, flavours := range reports {
+		last, read := l.seen[service][pod]
+		if !read && running[pod].Before(l.started) {
+			continue
+		}
+		for flavour, current := range flavours {
+			previous := last[flavour]
+			if current.Requests < previous.Requests {
+				previous = savingsCounters{}
+			}
+			delta.add(savingsCounters{
+				Requests:      current.Requests - previous.Requests,
+				BaselineGrams: current.BaselineGrams - previous.BaselineGrams,
+				AvoidedGrams:  current.AvoidedGrams - previous.AvoidedGrams,
+			})
+		}
+	}
+	seen := reports
+	for pod := range running {
+		if _, ok := seen[pod]; !ok && l.seen[service][pod] != nil {
+			seen[pod] = l.seen[service][pod]
+		}
+	}
+	l.seen[service] = seen
+	if delta.Requests == 0 {
+		return
+	}
+	savingsRequestsCounter.WithLabelValues(service.Namespace, service.Name).Add(float64(delta.Requests))
+	baselineGramsCounter.WithLabelValues(service.Namespace, service.Name).Add(max(0, delta.BaselineGrams))
+	avoidedGramsCounter.WithLabelValues(service.Namespace, service.Name).Add(max(0, delta.AvoidedGrams))
+	window := l.pending[schedule]
+	if window == nil {
+		window = &savingsWindow{since: time.Now(), services: map[string]savingsCounters{}}
+		l.pending[schedule] = window
+	}
+	totals := window.services[service.String()]
+	totals.add(delta)
+	window.services[service.String()] = totals
+}
+
+// take hands the window of schedule over for a roll-up.
+func (l *SavingsLedger) take(schedule types.NamespacedName) *savingsWindow {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	window := l.pending[schedule]
+	delete(l.pending, schedule)
+	return window
+}
+
+// restore puts back a window whose roll-up could not be stored.
+func (l *SavingsLedger) restore(schedule types.NamespacedName, window *savingsWindow) {
+	if l == nil || window == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if current := l.pending[schedule]; current != nil {
+		for service, totals := range current.services {
+			restored := window.services[service]
+			restored.add(totals)
+			window.services[service] = restored
+		}
+	}
+	l.pending[schedule] = window
+}
+
+// Forget drops the counters read from the routers of a Service.
+func (l *SavingsLedger) Forget(service types.NamespacedName) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.seen, service)
+}
+
+// collectSavings reads the savings accounted by the running router pods of
+// svc into the window of the schedule ts. Routers that cannot be read are
+// read again at the next reconciliation.
+func (r *FlavourRouterReconciler) collectSavings(ctx context.Context, svc *corev1.Service, ts *schedulingv1alpha1.TrafficSchedule) error {
+	if r.Savings == nil {
+		return nil
+	}
+	log := ctrl.LoggerFrom(ctx).WithName("[FlavourRouter]")
+	token, err := r.adminToken(ctx, svc)
+	if err != nil {
+		return err
+	}
+	pods, err := r.bufferPods(ctx, svc, "router")
+	if err != nil {
+		return err
+	}
+	reports := map[types.UID]map[string]savingsCounters{}
+	running := map[types.UID]time.Time{}
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" {
+			continue
+		}
+		running[pod.UID] = pod.CreationTimestamp.Time
+		flavours, err := readSavings(ctx, pod.Status.PodIP, token)
+		if err != nil {
+			log.V(1).Info("Router did not report its savings", "pod", pod.Name, "error", err.Error())
+			continue
+		}
+		reports[pod.UID] = flavours
+	}
+	r.Savings.record(client.ObjectKeyFromObject(ts), client.ObjectKeyFromObject(svc), reports, running)
+	return nil
+}
+
+func readSavings(ctx context.Context, podIP, token string) (map[string]savingsCounters, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s:%d/admin/savings", podIP, adminPort), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %s", resp.Status)
+	}
+	var report struct {
+		Flavours map[string]savingsCounters `json:"flavours"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, err
+	}
+	return report.Flavours, nil
+}
+
+// rollUpSavings closes the window of a schedule at now: the savings of each
+// Service over it replace the previous window, and their sum is added to the
+// day, month and total. Without a window the previous savings stay as they are.
+func rollUpSavings(previous *schedulingv1alpha1.CarbonSavings, window *savingsWindow, now time.Time) *schedulingv1alpha1.CarbonSavings {
+	if window == nil || len(window.services) == 0 {
+		return previous
+	}
+	out := &schedulingv1alpha1.CarbonSavings{}
+	if previous != nil {
+		out = previous.DeepCopy()
+	}
+	out.WindowStart = metav1.NewTime(window.since.UTC().Truncate(time.Second))
+	if previous != nil && !previous.WindowEnd.IsZero() {
+		out.WindowStart = previous.WindowEnd
+	}
+	out.WindowEnd = metav1.NewTime(now.UTC().Truncate(time.Second))
+	out.Window = nil
+	var sum savingsCounters
+	for service, totals := range window.services {
+		out.Window = append(out.Window, schedulingv1alpha1.ServiceSavings{Service: service, SavingsTotals: savingsTotals(savingsCounters{}, totals)})
+		sum.add(totals)
+	}
+	slices.SortFunc(out.Window, func(a, b schedulingv1alpha1.ServiceSavings) int {
+		return cmp.Compare(a.Service, b.Service)
+	})
+	out.Daily = addPeriodSavings(out.Daily, now.UTC().Format("2006-01-02"), sum, savingsDays)
+	out.Monthly = addPeriodSavings(out.Monthly, now.UTC().Format("2006-01"), sum, savingsMonths)
+	out.Total = savingsTotals(parseSavingsTotals(out.Total), sum)
+	return out
+}
+
+// addPeriodSavings adds sum to period, keeping the last keep periods.
+func addPeriodSavings(periods []schedulingv1alpha1.PeriodSavings, period string, sum savingsCounters, keep int) []schedulingv1alpha1.PeriodSavings {
+	i := slices.IndexFunc(periods, func(p schedulingv1alpha1.PeriodSavings) bool { return p.Period == period })
+	if i < 0 {
+		periods = append(periods, schedulingv1alpha1.PeriodSavings{Period: period})
+		i = len(periods) - 1
+	}
+	periods[i].SavingsTotals = savingsTotals(parseSavingsTotals(periods[i].SavingsTotals), sum)
+	slices.SortFunc(periods, func(a, b schedulingv1alpha1.PeriodSavings) int {
+		return cmp.Compare(a.Period, b.Period)
+	})
+	if len(periods) > keep {
+		periods = periods[len(periods)-keep:]
+	}
+	return periods
+}
+
+// parseSavingsTotals reads totals back from a status; grams that do not parse
+// count from zero.
+func parseSavingsTotals(totals schedulingv1alpha1.SavingsTotals) savingsCounters {
+	baseline, _ := strconv.ParseFloat(totals.BaselineGrams, 64)
+	avoided, _ := strconv.ParseFloat(totals.AvoidedGrams, 64)
+	return savingsCounters{Requests: totals.Requests, BaselineGrams: baseline, AvoidedGrams: avoided}
+}
+
+func savingsTotals(base, added savingsCounters) schedulingv1alpha1.SavingsTotals {
+	base.add(added)
+	return schedulingv1alpha1.SavingsTotals{
+		Requests:      base.Requests,
+		BaselineGrams: formatFloat(base.BaselineGrams),
+		AvoidedGrams:  formatFloat(base.AvoidedGrams),
+	}
+}
@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestSavingsLedgerRecord(t *testing.T) {
+	schedule := types.NamespacedName{Namespace: "shop", Name: "green"}
+	service := types.NamespacedName{Namespace: "shop", Name: "checkout"}
+	started := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	before, after := started.Add(-time.Hour), started.Add(time.Minute)
+	counters := func(requests int64, baseline, avoided float64) map[string]savingsCounters {
+		return map[string]savingsCounters{"precision-50": {Requests: requests, BaselineGrams: baseline, AvoidedGrams: avoided}}
+	}
+
+	steps := []struct {
+		name    string
+		reports map[types.UID]map[string]savingsCounters
+		running map[types.UID]time.Time
+		want    savingsCounters
+	}{
+		{
+			name:    "routers running before the ledger started are a baseline",
+			reports: map[types.UID]map[string]savingsCounters{"old": counters(100, 10, 4)},
+			running: map[types.UID]time.Time{"old": before},
+		},
+		{
+			name:    "what they answer afterwards counts",
+			reports: map[types.UID]map[string]savingsCounters{"old": counters(130, 13, 5)},
+			running: map[types.UID]time.Time{"old": before},
+			want:    savingsCounters{Requests: 30, BaselineGrams: 3, AvoidedGrams: 1},
+		},
+		{
+			name:    "routers started afterwards count from zero",
+			reports: map[types.UID]map[string]savingsCounters{"old": counters(130, 13, 5), "new": counters(20, 2, 1)},
+			running: map[types.UID]time.Time{"old": before, "new": after},
+			want:    savingsCounters{Requests: 50, BaselineGrams: 5, AvoidedGrams: 2},
+		},
+		{
+			name:    "an unread router keeps its counters",
+			reports: map[types.UID]map[string]savingsCounters{"new": counters(25, 2.5, 1.5)},
+			running: map[types.UID]time.Time{"old": before, "new": after},
+			want:    savingsCounters{Requests: 55, BaselineGrams: 5.5, AvoidedGrams: 2.5},
+		},
+		{
+			name:    "a restarted router counts from zero",
+			reports: map[types.UID]map[string]savingsCounters{"old": counters(10, 1, 0.5), "new": counters(25, 2.5, 1.5)},
+			running: map[types.UID]time.Time{"old": before, "new": after},
+			want:    savingsCounters{Requests: 65, BaselineGrams: 6.5, AvoidedGrams: 3},
+		},
+	}
+
+	l := NewSavingsLedger()
+	l.started = started
+	for _, step := range steps {
+		l.record(schedule, service, step.reports, step.running)
+		var got savingsCounters
+		if window := l.pending[schedule]; window != nil {
+			got = window.services[service.String()]
+		}
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: got %+v, want %+v", step.name, got, step.want)
+		}
+	}
+
+	window := l.take(schedule)
+	if window == nil || l.take(schedule) != nil {
+		t.Fatalf("take did not hand the window over once")
+	}
+	l.record(schedule, service, map[types.UID]map[string]savingsCounters{"new": counters(26, 2.6, 1.6)}, map[types.UID]time.Time{"new": after})
+	l.restore(schedule, window)
+	want := savingsCounters{Requests: 66, BaselineGrams: 6.6, AvoidedGrams: 3.1}
+	got := l.pending[schedule].services[service.String()]
+	if got.Requests != want.Requests || !near(got.BaselineGrams, want.BaselineGrams) || !near(got.AvoidedGrams, want.AvoidedGrams) {
+		t.Errorf("restored window: got %+v, want %+v", got, want)
+	}
+}
+
+func near(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
+
+func TestRollUpSavings(t *testing.T) {
+	since := time.Date(2025, 6, 30, 23, 50, 0, 0, time.UTC)
+	now := time.Date(2025, 7, 1, 0, 5, 0, 0, time.UTC)
+	window := &savingsWindow{since: since, services: map[string]savingsCounters{
+		"shop/checkout": {Requests: 10, BaselineGrams: 2, AvoidedGrams: 0.5},
+		"shop/cart":     {Requests: 30, BaselineGrams: 6, AvoidedGrams: 1.5},
+	}}
+	previous := &schedulingv1alpha1.CarbonSavings{
+		WindowStart: metav1.NewTime(since.Add(-10 * time.Minute)),
+		WindowEnd:   metav1.NewTime(since),
+		Window:      []schedulingv1alpha1.ServiceSavings{{Service: "shop/gone"}},
+		Daily: []schedulingv1alpha1.PeriodSavings{
+			{Period: "2025-06-30", SavingsTotals: schedulingv1alpha1.SavingsTotals{Requests: 5, BaselineGrams: "1", AvoidedGrams: "0.25"}},
+		},
+		Monthly: []schedulingv1alpha1.PeriodSavings{
+			{Period: "2025-06", SavingsTotals: schedulingv1alpha1.SavingsTotals{Requests: 5, BaselineGrams: "1", AvoidedGrams: "0.25"}},
+		},
+		Total: schedulingv1alpha1.SavingsTotals{Requests: 5, BaselineGrams: "1", AvoidedGrams: "0.25"},
+	}
+
+	tests := []struct {
+		name     string
+		previous *schedulingv1alpha1.CarbonSavings
+		window   *savingsWindow
+		want     *schedulingv1alpha1.CarbonSavings
+	}{
+		{name: "no window keeps the savings", previous: previous, want: previous},
+		{name: "empty window keeps the savings", previous: previous, window: &savingsWindow{since: since}, want: previous},
+		{
+			name:     "window is added to the new day, month and total",
+			previous: previous,
+			window:   window,
+			want: &schedulingv1alpha1.CarbonSavings{
+				WindowStart: metav1.NewTime(since),
+				WindowEnd:   metav1.NewTime(now),
+				Window: []schedulingv1alpha1.ServiceSavings{
+					{Service: "shop/cart", SavingsTotals: schedulingv1alpha1.SavingsTotals{Requests: 30, BaselineGrams: "6", AvoidedGrams: "1.5"}},
+					{Service: "shop/checkout", SavingsTotals: schedulingv1alpha1.SavingsTotals{Requests: 10, BaselineGrams: "2", AvoidedGrams: "0.5"}},
+				},
+				Daily: []schedulingv1alpha1.PeriodSavings{
+					{Period: "2025-06-30", SavingsTotals: schedulingv1alpha1.SavingsTotals{Requests: 5, BaselineGrams: "1", AvoidedGrams: "0.25"}},
+					{Period: "2025-07-01", SavingsTotals: schedulingv1alpha1.SavingsTotals{Requests: 40, BaselineGrams: "8", AvoidedGrams: "2"}},
+				},
+				Monthly: []schedulingv1alpha1.PeriodSavings{
+					{Period: "2025-06", SavingsTotals: schedulingv1alpha1.SavingsTotals{Requests: 5, BaselineGrams: "1", AvoidedGrams: "0.25"}},
+					{Period: "2025-07", SavingsTotals: schedulingv1alpha1.SavingsTotals{Requests: 40, BaselineGrams: "8", AvoidedGrams: "2"}},
+				},
+				Total: schedulingv1alpha1.SavingsTotals{Requests: 45, BaselineGrams: "9", AvoidedGrams: "2.25"},
+			},
+		},
+		{
+			name:   "first window starts when the ledger opened it",
+			window: &savingsWindow{since: since, services: map[string]savingsCounters{"shop/cart": {Requests: 1, BaselineGrams: 1}}},
+			want: &schedulingv1alpha1.CarbonSavings{
+				WindowStart: metav1.NewTime(since),
+				WindowEnd:   metav1.NewTime(now),
+				Window: []schedulingv1alpha1.ServiceSavings{
+					{Service: "shop/cart", SavingsTotals: schedulingv1alpha1.SavingsTotals{Requests: 1, BaselineGrams: "1", AvoidedGrams: "0"}},
+				},
+				Daily:   []schedulingv1alpha1.PeriodSavings{{Period: "2025-07-01", SavingsTotals: schedulingv1alpha1.SavingsTotals{Requests: 1, BaselineGrams: "1", AvoidedGrams: "0"}}},
+				Monthly: []schedulingv1alpha1.PeriodSavings{{Period: "2025-07", SavingsTotals: schedulingv1alpha1.SavingsTotals{Requests: 1, BaselineGrams: "1", AvoidedGrams: "0"}}},
+				Total:   schedulingv1alpha1.SavingsTotals{Requests: 1, BaselineGrams: "1", AvoidedGrams: "0"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rollUpSavings(tt.previous, tt.window, now)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddPeriodSavingsKeepsTheLastPeriods(t *testing.T) {
+	var periods []schedulingv1alpha1.PeriodSavings
+	for day := 1; day <= savingsDays+2; day++ {
+		at := time.Date(2025, 1, day, 0, 0, 0, 0, time.UTC)
+		periods = addPeriodSavings(periods, at.Format("2006-01-02"), savingsCounters{Requests: 1}, savingsDays)
+	}
+	if len(periods) != savingsDays || periods[0].Period != "2025-01-03" || periods[len(periods)-1].Period != "2025-02-02" {
+		t.Errorf("got %d periods from %s to %s", len(periods), periods[0].Period, periods[len(periods)-1].Period)
+	}
+}
@@ -0,0 +1,244 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/engine"
+)
+
+const (
+	defaultProviderRefresh = 5 * time.Minute
+	// providerFetchTimeout bounds a fetch, which may log in first.
+	providerFetchTimeout = 10 * time.Second
+)
+
+// CarbonIntensityProviderReconciler keeps the current and forecast intensity
+// of the zone of each CarbonIntensityProvider in its status, fetched every
+// refresh interval. Schedules referencing a provider read its status instead
+// of querying the API themselves.
+type CarbonIntensityProviderReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// APIReader reads the credential Secrets without caching Secrets.
+	APIReader client.Reader
+	// URLs are the APIs of the providers without spec.endpoint.
+	URLs CarbonProviderURLs
+}
+
+// +kubebuilder:rbac:groups=scheduling.carbonrouter.io,resources=carbonintensityproviders,verbs=get;list;watch
+// +kubebuilder:rbac:groups=scheduling.carbonrouter.io,resources=carbonintensityproviders/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get
+
+func (r *CarbonIntensityProviderReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx).WithName("[CarbonIntensityProvider]")
+
+	var cip schedulingv1alpha1.CarbonIntensityProvider
+	if err := r.Get(ctx, req.NamespacedName, &cip); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	refresh := defaultProviderRefresh
+	if cip.Spec.RefreshIntervalSeconds != nil {
+		refresh = time.Duration(*cip.Spec.RefreshIntervalSeconds) * time.Second
+	}
+	// A restarted operator keeps the forecast fetched before until it is due
+	if cip.Status.ObservedGeneration == cip.Generation && !cip.Status.LastUpdated.IsZero() {
+		if wait := time.Until(cip.Status.LastUpdated.Add(refresh)); wait > 0 {
+			return ctrl.Result{RequeueAfter: wait}, nil
+		}
+	}
+
+	carbon, err := r.fetch(ctx, &cip)
+	if err != nil {
+		return r.fetchFailed(ctx, &cip, err)
+	}
+
+	original := cip.DeepCopy()
+	cip.Status.ObservedGeneration = cip.Generation
+	cip.Status.CarbonForecastNow, cip.Status.CarbonForecastNext = "", ""
+	if carbon.Now != nil {
+		cip.Status.CarbonForecastNow = formatFloat(*carbon.Now)
+	}
+	if carbon.Next != nil {
+		cip.Status.CarbonForecastNext = formatFloat(*carbon.Next)
+	}
+	cip.Status.CarbonIndex = carbon.Index
+	cip.Status.ForecastSchedule = forecastSlots(carbon.Schedule)
+	cip.Status.LastUpdated = metav1.Now()
+	cond := reconciledCondition("", nil)
+	cond.ObservedGeneration = cip.Generation
+	meta.SetStatusCondition(&cip.Status.Conditions, cond)
+	if err := r.Status().Patch(ctx, &cip, client.MergeFrom(original)); err != nil {
+		return failureResult("carbonintensityprovider", classify(err), err)
+	}
+	log.V(1).Info("Carbon forecast refreshed", "provider", cip.Name, "zone", providerZone(cip.Spec), "now", cip.Status.CarbonForecastNow, "slots", len(cip.Status.ForecastSchedule))
+	return ctrl.Result{RequeueAfter: refresh}, nil
+}
+
+// fetch returns the current forecast of the zone of cip.
+func (r *CarbonIntensityProviderReconciler) fetch(ctx context.Context, cip *schedulingv1alpha1.CarbonIntensityProvider) (engine.Carbon, error) {
+	zone := providerZone(cip.Spec)
+	if zone == "" {
+		return engine.Carbon{}, invalidConfigError(fmt.Errorf("spec.zone is required for %s", cip.Spec.Type))
+	}
+	var secret *corev1.Secret
+	if cip.Spec.Type != carbonProviderCarbonIntensity {
+		ref := cip.Spec.SecretRef
+		if ref == nil || ref.Name == "" || ref.Namespace == "" {
+			return engine.Carbon{}, invalidConfigError(fmt.Errorf("spec.secretRef with a name and namespace is required for %s", cip.Spec.Type))
+		}
+		reader := r.APIReader
+		if reader == nil {
+			reader = r.Client
+		}
+		secret = &corev1.Secret{}
+		if err := reader.Get(ctx, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}, secret); err != nil {
+			return engine.Carbon{}, dependencyMissingError(fmt.Errorf("carbon provider secret %s/%s: %w", ref.Namespace, ref.Name, err))
+		}
+	}
+	baseURL := cmp.Or(strings.TrimSpace(cip.Spec.Endpoint), r.URLs.url(cip.Spec.Type))
+	provider, err := newCarbonProvider(cip.Spec.Type, baseURL, secret)
+	if err != nil {
+		return engine.Carbon{}, err
+	}
+	carbon, err := engine.NewForecastCache(provider, zone, providerFetchTimeout, 0).Carbon(ctx, time.Now().UTC())
+	if err == nil && len(carbon.Schedule) == 0 {
+		err = fmt.Errorf("no forecast for %s %s", cip.Spec.Type, zone)
+	}
+	return carbon, err
+}
+
+// fetchFailed reports err in the Reconciled condition of cip, keeping the
+// forecast fetched before, and retries according to its class.
+func (r *CarbonIntensityProviderReconciler) fetchFailed(ctx context.Context, cip *schedulingv1alpha1.CarbonIntensityProvider, err error) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx).WithName("[CarbonIntensityProvider]")
+	class := classify(err)
+	log.Error(err, "Failed to fetch the carbon forecast", "provider", cip.Name, "class", class)
+	original := cip.DeepCopy()
+	cond := reconciledCondition(class, err)
+	cond.ObservedGeneration = cip.Generation
+	if meta.SetStatusCondition(&cip.Status.Conditions, cond) {
+		if patchErr := r.Status().Patch(ctx, cip, client.MergeFrom(original)); patchErr != nil {
+			log.Error(patchErr, "Failed to report fetch failure")
+		}
+	}
+	return failureResult("carbonintensityprovider", class, err)
+}
+
+// providerZone is the zone of spec, the national forecast for the Carbon
+// Intensity API when unset.
+func providerZone(spec schedulingv1alpha1.CarbonIntensityProviderSpec) string {
+	if zone := strings.TrimSpace(spec.Zone); zone != "" {
+		return zone
+	}
+	if spec.Type == carbonProviderCarbonIntensity {
+		return "national"
+	}
+	return ""
+}
+
+// providerStatus is the CarbonProvider of the schedules following a
+// CarbonIntensityProvider: its targets are CarbonIntensityProvider names, whose
+// forecast is read from their status.
+type providerStatus struct {
+	reader client.Reader
+}
+
+func (p providerStatus) Forecast(ctx context.Context, target string) ([]engine.ForecastPoint, error) {
+	var cip schedulingv1alpha1.CarbonIntensityProvider
+	if err := p.reader.Get(ctx, client.ObjectKey{Name: target}, &cip); err != nil {
+		return nil, fmt.Errorf("carbon intensity provider %s: %w", target, err)
+	}
+	points := make([]engine.ForecastPoint, 0, len(cip.Status.ForecastSchedule))
+	for _, slot := range cip.Status.ForecastSchedule {
+		start, errStart := time.Parse(time.RFC3339, slot.From)
+		end, errEnd := time.Parse(time.RFC3339, slot.To)
+		if errStart != nil || errEnd != nil {
+			continue
+		}
+		point := engine.ForecastPoint{Start: start, End: end, Index: slot.Index}
+		if value, err := strconv.ParseFloat(slot.Forecast, 64); err == nil {
+			point.Forecast = &value
+		}
+		points = append(points, point)
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("carbon intensity provider %s has no forecast yet", target)
+	}
+	return points, nil
+}
+
+// SetupWithManager sets up the controller with the Manager. Status updates
+// are ignored, the forecast being refreshed on its own interval.
+func (r *CarbonIntensityProviderReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&schedulingv1alpha1.CarbonIntensityProvider{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
+
+// schedulesFollowingProvider enqueues the schedules referencing a
+// CarbonIntensityProvider, directly or through their spec.locality zones, so
+// they pick up its new forecast right away.
+func schedulesFollowingProvider(c client.Client) handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+		var list schedulingv1alpha1.TrafficScheduleList
+		if err := c.List(ctx, &list); err != nil {
+			return nil
+		}
+		var out []reconcile.Request
+		for _, ts := range list.Items {
+			if followsProvider(ts.Spec, obj.GetName()) {
+				out = append(out, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&ts)})
+			}
+		}
+		return out
+	})
+}
+
+func followsProvider(spec schedulingv1alpha1.TrafficScheduleSpec, name string) bool {
+	ref := spec.Scheduler.CarbonProviderRef
+	if ref == "" {
+		return false
+	}
+	if ref == name {
+		return true
+	}
+	for _, zone := range spec.Locality.Zones {
+		if zone.CarbonTarget == name {
+			return true
+		}
+	}
+	return false
+}
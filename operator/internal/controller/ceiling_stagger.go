@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+// ceilingStagger delays replica ceiling relaxation per service so that a green
+// transition does not make every consumer and target scale up in the same instant.
+type ceilingStagger struct {
+	mu    sync.Mutex
+	state map[string]staggerState
+}
+
+type staggerState struct {
+	applied int32
+	pending int32
+	since   time.Time
+}
+
+// relaxes reports whether moving from old to next loosens the ceiling. A value <= 0
+// means "no ceiling".
+func relaxes(old, next int32) bool {
+	return old > 0 && (next <= 0 || next > old)
+}
+
+// resolve returns the ceiling to apply now and, when a relaxation is being held back,
+// how long until it becomes due.
+func (s *ceilingStagger) resolve(key string, desired int32, offset time.Duration, now time.Time) (int32, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state == nil {
+		s.state = map[string]staggerState{}
+	}
+	st, ok := s.state[key]
+	if !ok || offset <= 0 || !relaxes(st.applied, desired) {
+		s.state[key] = staggerState{applied: desired}
+		return desired, 0
+	}
+	if st.pending != desired || st.since.IsZero() {
+		st.pending = desired
+		st.since = now
+		s.state[key] = st
+	}
+	due := st.since.Add(offset)
+	if !now.Before(due) {
+		s.state[key] = staggerState{applied: desired}
+		return desired, 0
+	}
+	return st.applied, due.Sub(now)
+}
+
+// staggerOffset maps a service onto a stable point inside the spread window.
+func staggerOffset(serviceKey string, spread time.Duration) time.Duration {
+	if spread <= 0 {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(serviceKey))
+	return time.Duration(h.Sum32()%uint32(spread/time.Second+1)) * time.Second
+}
+
+// staggerCeilings applies the relaxation spread to the ceilings of a service and
+// returns the ceilings to use now plus the delay until the next held-back change.
+func (r *FlavourRouterReconciler) staggerCeilings(serviceKey string, ceilings map[string]int32, cfg schedulingv1alpha1.ScaleCoordinationConfig) (map[string]int32, time.Duration) {
+	spread := time.Duration(0)
+	if cfg.RelaxationSpreadSeconds != nil {
+		spread = time.Duration(*cfg.RelaxationSpreadSeconds) * time.Second
+	}
+	offset := staggerOffset(serviceKey, spread)
+	now := time.Now()
+
+	out := make(map[string]int32, len(ceilings))
+	var wait time.Duration
+	for _, component := range []string{"consumer", "target"} {
+		value, delay := r.ceilings.resolve(serviceKey+"|"+component, ceilings[component], offset, now)
+		if value > 0 {
+			out[component] = value
+		}
+		if delay > 0 && (wait == 0 || delay < wait) {
+			wait = delay
+		}
+	}
+	for component, value := range ceilings {
+		if _, handled := out[component]; !handled && component != "consumer" && component != "target" {
+			out[component] = value
+		}
+	}
+	return out, wait
+}
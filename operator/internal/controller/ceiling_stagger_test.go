@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRelaxes(t *testing.T) {
+	tests := []struct {
+		old, next int32
+		want      bool
+	}{
+		{old: 2, next: 4, want: true},
+		{old: 2, next: 0, want: true},
+		{old: 4, next: 2},
+		{old: 2, next: 2},
+		{old: 0, next: 4},
+	}
+	for _, tt := range tests {
+		if got := relaxes(tt.old, tt.next); got != tt.want {
+			t.Errorf("relaxes(%d, %d): got %v, want %v", tt.old, tt.next, got, tt.want)
+		}
+	}
+}
+
+func TestCeilingStaggerResolve(t *testing.T) {
+	var s ceilingStagger
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	offset := 30 * time.Second
+	steps := []struct {
+		name    string
+		desired int32
+		at      time.Duration
+		want    int32
+		wait    time.Duration
+	}{
+		{name: "first ceiling applies at once", desired: 2, want: 2},
+		{name: "tightening applies at once", desired: 1, at: time.Second, want: 1},
+		{name: "relaxing is held back", desired: 4, at: 10 * time.Second, want: 1, wait: 30 * time.Second},
+		{name: "still held back", desired: 4, at: 30 * time.Second, want: 1, wait: 10 * time.Second},
+		{name: "a new target restarts the wait", desired: 0, at: 35 * time.Second, want: 1, wait: 30 * time.Second},
+		{name: "due", desired: 0, at: 65 * time.Second, want: 0},
+		{name: "tightening from no ceiling", desired: 3, at: 66 * time.Second, want: 3},
+	}
+	for _, step := range steps {
+		got, wait := s.resolve("shop/checkout|consumer", step.desired, offset, start.Add(step.at))
+		if got != step.want || wait != step.wait {
+			t.Errorf("%s: got %d (wait %v), want %d (wait %v)", step.name, got, wait, step.want, step.wait)
+		}
+	}
+	if got, wait := s.resolve("shop/checkout|consumer", 6, 0, start.Add(67*time.Second)); got != 6 || wait != 0 {
+		t.Errorf("without an offset: got %d (wait %v), want 6 at once", got, wait)
+	}
+}
+
+func TestStaggerOffset(t *testing.T) {
+	if got := staggerOffset("shop/checkout", 0); got != 0 {
+		t.Errorf("no spread: got %v, want 0", got)
+	}
+	spread := 2 * time.Minute
+	seen := map[time.Duration]bool{}
+	for _, svc := range []string{"shop/checkout", "shop/cart", "shop/search", "catalog/items"} {
+		offset := staggerOffset(svc, spread)
+		if offset < 0 || offset > spread || offset%time.Second != 0 {
+			t.Errorf("%s: offset %v outside the spread", svc, offset)
+		}
+		if again := staggerOffset(svc, spread); again != offset {
+			t.Errorf("%s: offset not stable, %v then %v", svc, offset, again)
+		}
+		seen[offset] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("every service got the same offset: %v", seen)
+	}
+}
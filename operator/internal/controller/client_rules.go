@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	networkingapi "istio.io/api/networking/v1alpha3"
+	securityapi "istio.io/api/security/v1beta1"
+	typeapi "istio.io/api/type/v1beta1"
+	securitykube "istio.io/client-go/pkg/apis/security/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func clientPolicyName(svc *corev1.Service, precision int) string {
+	return fmt.Sprintf("%s-carbonrouter-%s", svc.Name, precisionSubsetName(precision))
+}
+
+// clientMatches returns the VirtualService matches of a rule: one per header
+// or claim value and one for the source workloads.
+func clientMatches(clients schedulingv1alpha1.ClientMatch) []*networkingapi.HTTPMatchRequest {
+	var matches []*networkingapi.HTTPMatchRequest
+	if clients.Header != nil {
+		for _, value := range clients.Header.Values {
+			matches = append(matches, &networkingapi.HTTPMatchRequest{
+				Headers: map[string]*networkingapi.StringMatch{
+					clients.Header.Name: {MatchType: &networkingapi.StringMatch_Exact{Exact: value}},
+				},
+			})
+		}
+	}
+	if clients.Claim != nil {
+		for _, value := range clients.Claim.Values {
+			matches = append(matches, &networkingapi.HTTPMatchRequest{
+				Headers: map[string]*networkingapi.StringMatch{
+					"@request.auth.claims." + clients.Claim.Name: {MatchType: &networkingapi.StringMatch_Exact{Exact: value}},
+				},
+			})
+		}
+	}
+	if clients.SourceNamespace != "" || len(clients.SourceLabels) > 0 {
+		matches = append(matches, &networkingapi.HTTPMatchRequest{
+			SourceNamespace: clients.SourceNamespace,
+			SourceLabels:    clients.SourceLabels,
+		})
+	}
+	return matches
+}
+
+// allowedPrecisions keeps the active precisions a rule grants.
+func allowedPrecisions(granted, precisions []int) []int {
+	var allowed []int
+	for _, precision := range precisions {
+		if slices.Contains(granted, precision) {
+			allowed = append(allowed, precision)
+		}
+	}
+	return allowed
+}
+
+// buildClientRoutes compiles the client rules into routes placed ahead of the
+// shared ones. A client forcing an allowed precision gets it; any other request
+// of the client is split across its allowed precisions with the schedule
+// weights. Rules without an active allowed precision are left to the
+// AuthorizationPolicies, which reject the requests.
+func buildClientRoutes(host, header string, rules []schedulingv1alpha1.ClientPrecisionRule, flavours []schedulingv1alpha1.FlavourDecision, precisions []int) []*networkingapi.HTTPRoute {
+	var routes []*networkingapi.HTTPRoute
+	for _, rule := range rules {
+		matches := clientMatches(rule.Clients)
+		allowed := allowedPrecisions(rule.Precisions, precisions)
+		if len(matches) == 0 || len(allowed) == 0 {
+			continue
+		}
+		for _, precision := range allowed {
+			forced := make([]*networkingapi.HTTPMatchRequest, 0, len(matches))
+			for _, match := range matches {
+				headers := maps.Clone(match.Headers)
+				if headers == nil {
+					headers = map[string]*networkingapi.StringMatch{}
+				}
+				headers[header] = &networkingapi.StringMatch{MatchType: &networkingapi.StringMatch_Exact{Exact: precisionHeaderValue(precision)}}
+				forced = append(forced, &networkingapi.HTTPMatchRequest{
+					Headers:         headers,
+					SourceNamespace: match.SourceNamespace,
+					SourceLabels:    match.SourceLabels,
+				})
+			}
+			routes = append(routes, &networkingapi.HTTPRoute{
+				Match: forced,
+				Route: []*networkingapi.HTTPRouteDestination{{
+					Destination: &networkingapi.Destination{Host: host, Subset: precisionSubsetName(precision)},
+					Weight:      100,
+				}},
+			})
+		}
+		route := buildWeightedRoute(host, flavours, allowed)
+		route.Name = "carbonrouter-client-" + rule.Name
+		route.Match = matches
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// claimConditionKey is the AuthorizationPolicy key of a claim, with nested
+// claims as "request.auth.claims[subscription][tier]".
+func claimConditionKey(name string) string {
+	return fmt.Sprintf("request.auth.claims[%s]", strings.ReplaceAll(name, ".", "]["))
+}
+
+// clientDenyRules returns the AuthorizationPolicy rules rejecting the clients
+// not allowed to receive precision. Clients only identified by source labels
+// cannot be enforced, since the policy sees principals and not workloads.
+func clientDenyRules(rules []schedulingv1alpha1.ClientPrecisionRule, precision int) []*securityapi.Rule {
+	var deny []*securityapi.Rule
+	for _, rule := range rules {
+		if slices.Contains(rule.Precisions, precision) {
+			continue
+		}
+		if len(rule.Clients.Principals) > 0 {
+			deny = append(deny, &securityapi.Rule{
+				From: []*securityapi.Rule_From{{Source: &securityapi.Source{Principals: rule.Clients.Principals}}},
+			})
+		}
+		if header := rule.Clients.Header; header != nil {
+			deny = append(deny, &securityapi.Rule{
+				When: []*securityapi.Condition{{Key: fmt.Sprintf("request.headers[%s]", header.Name), Values: header.Values}},
+			})
+		}
+		if claim := rule.Clients.Claim; claim != nil {
+			deny = append(deny, &securityapi.Rule{
+				When: []*securityapi.Condition{{Key: claimConditionKey(claim.Name), Values: claim.Values}},
+			})
+		}
+	}
+	return deny
+}
+
+// ensureClientPolicies manages one DENY AuthorizationPolicy per restricted
+// precision on the target pods, so clients forcing their way past the routes
+// still never receive a precision outside their rule.
+func (r *FlavourRouterReconciler) ensureClientPolicies(ctx context.Context, svc *corev1.Service, rules []schedulingv1alpha1.ClientPrecisionRule, precisions []int) error {
+	desired := map[string]struct{}{}
+	if len(svc.Spec.Selector) > 0 {
+		for _, precision := range precisions {
+			deny := clientDenyRules(rules, precision)
+			if len(deny) == 0 {
+				continue
+			}
+			selector := maps.Clone(svc.Spec.Selector)
+			selector[precisionLabel] = precisionHeaderValue(precision)
+			policy := &securitykube.AuthorizationPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      clientPolicyName(svc, precision),
+					Namespace: svc.Namespace,
+					Labels:    map[string]string{parentServiceLabel: svc.Name},
+				},
+				Spec: securityapi.AuthorizationPolicy{
+					Selector: &typeapi.WorkloadSelector{MatchLabels: selector},
+					Action:   securityapi.AuthorizationPolicy_DENY,
+					Rules:    deny,
+				},
+			}
+			if err := ctrl.SetControllerReference(svc, policy, r.Scheme); err != nil {
+				return err
+			}
+			if err := r.apply(ctx, svc, "AuthorizationPolicy", policy, &policy.Spec); err != nil {
+				return err
+			}
+			desired[policy.Name] = struct{}{}
+		}
+	}
+
+	var existing securitykube.AuthorizationPolicyList
+	if err := r.List(ctx, &existing, client.InNamespace(svc.Namespace), client.MatchingLabels{parentServiceLabel: svc.Name}); err != nil {
+		return err
+	}
+	for _, policy := range existing.Items {
+		// The mesh policy is managed by ensureMeshSecurity
+		if _, ok := desired[policy.Name]; ok || policy.Name == meshPolicyName(svc) {
+			continue
+		}
+		if err := r.Delete(ctx, policy); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		r.Inventory.Drop(client.ObjectKeyFromObject(svc), "AuthorizationPolicy", svc.Namespace, policy.Name)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	securitykube "istio.io/client-go/pkg/apis/security/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+var (
+	freeTier = schedulingv1alpha1.ClientPrecisionRule{
+		Name:       "free",
+		Clients:    schedulingv1alpha1.ClientMatch{Header: &schedulingv1alpha1.ClientHeaderMatch{Name: "x-plan", Values: []string{"free", "trial"}}},
+		Precisions: []int{50, 30},
+	}
+	batchJobs = schedulingv1alpha1.ClientPrecisionRule{
+		Name:       "batch",
+		Clients:    schedulingv1alpha1.ClientMatch{SourceNamespace: "batch", Principals: []string{"cluster.local/ns/batch/sa/jobs"}},
+		Precisions: []int{30},
+	}
+	goldClaim = schedulingv1alpha1.ClientPrecisionRule{
+		Name:       "gold",
+		Clients:    schedulingv1alpha1.ClientMatch{Claim: &schedulingv1alpha1.ClientClaimMatch{Name: "subscription.tier", Values: []string{"gold"}}},
+		Precisions: []int{100},
+	}
+)
+
+func TestBuildClientRoutes(t *testing.T) {
+	host := "checkout.shop.svc.cluster.local"
+	flavours := []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 20}, {Precision: 50, Weight: 40}, {Precision: 30, Weight: 40}}
+	routes := buildClientRoutes(host, "x-carbonrouter", []schedulingv1alpha1.ClientPrecisionRule{freeTier, batchJobs}, flavours, []int{100, 50})
+
+	// batch only allows precision 30, which is not deployed
+	if len(routes) != 2 {
+		t.Fatalf("got %d routes, want the forced and the weighted route of the free tier", len(routes))
+	}
+	forced, weighted := routes[0], routes[1]
+	if len(forced.Match) != 2 || forced.Route[0].Destination.Subset != "precision-50" {
+		t.Errorf("got forced route %v, want one match per header value to precision-50", forced)
+	}
+	for _, match := range forced.Match {
+		if match.Headers["x-carbonrouter"].GetExact() != "50" || match.Headers["x-plan"] == nil {
+			t.Errorf("got forced match %v, want the client and the requested precision", match)
+		}
+	}
+	if weighted.Name != "carbonrouter-client-free" || len(weighted.Match) != 2 {
+		t.Errorf("got route %q with %d matches, want the client weighted route", weighted.Name, len(weighted.Match))
+	}
+	if len(weighted.Route) != 1 || weighted.Route[0].Destination.Subset != "precision-50" || weighted.Route[0].Weight != 100 {
+		t.Errorf("got destinations %v, want the allowed precision only", weighted.Route)
+	}
+}
+
+func TestClientMatches(t *testing.T) {
+	clients := schedulingv1alpha1.ClientMatch{
+		Claim:           &schedulingv1alpha1.ClientClaimMatch{Name: "subscription.tier", Values: []string{"gold", "platinum"}},
+		SourceNamespace: "batch",
+	}
+	matches := clientMatches(clients)
+	if len(matches) != 3 {
+		t.Fatalf("got %d matches, want one per claim value and one for the source", len(matches))
+	}
+	for i, want := range []string{"gold", "platinum"} {
+		if got := matches[i].Headers["@request.auth.claims.subscription.tier"].GetExact(); got != want {
+			t.Errorf("match %d: got claim %q, want %q", i, got, want)
+		}
+	}
+	if matches[2].SourceNamespace != "batch" || matches[2].Headers != nil {
+		t.Errorf("got %v, want the source workloads only", matches[2])
+	}
+	if got := claimConditionKey("tier"); got != "request.auth.claims[tier]" {
+		t.Errorf("got %q for a top-level claim", got)
+	}
+}
+
+func TestClientDenyRules(t *testing.T) {
+	rules := []schedulingv1alpha1.ClientPrecisionRule{freeTier, batchJobs, goldClaim}
+	keys := func(precision int) []string {
+		var out []string
+		for _, rule := range clientDenyRules(rules, precision) {
+			for _, from := range rule.From {
+				out = append(out, from.Source.Principals...)
+			}
+			for _, when := range rule.When {
+				out = append(out, when.Key)
+			}
+		}
+		return out
+	}
+	tests := []struct {
+		precision int
+		want      []string
+	}{
+		{precision: 100, want: []string{"request.headers[x-plan]", "cluster.local/ns/batch/sa/jobs"}},
+		{precision: 50, want: []string{"cluster.local/ns/batch/sa/jobs", "request.auth.claims[subscription][tier]"}},
+		{precision: 30, want: []string{"request.auth.claims[subscription][tier]"}},
+	}
+	for _, tt := range tests {
+		if got := keys(tt.precision); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("precision %d: got %v, want %v", tt.precision, got, tt.want)
+		}
+	}
+}
+
+func TestEnsureClientPolicies(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := securitykube.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout", UID: "checkout"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "checkout"}},
+	}
+	policy := func(name string) *securitykube.AuthorizationPolicy {
+		return &securitykube.AuthorizationPolicy{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "shop", Name: name, Labels: map[string]string{parentServiceLabel: "checkout"},
+		}}
+	}
+	applied := map[string]*securitykube.AuthorizationPolicy{}
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(policy(clientPolicyName(svc, 30)), policy(meshPolicyName(svc))).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+				applied[obj.GetName()] = obj.(*securitykube.AuthorizationPolicy).DeepCopy()
+				return nil
+			},
+		}).Build()
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme, Inventory: NewResourceInventory()}
+	ctx := context.Background()
+
+	if err := r.ensureClientPolicies(ctx, svc, []schedulingv1alpha1.ClientPrecisionRule{goldClaim}, []int{100, 50}); err != nil {
+		t.Fatal(err)
+	}
+	// gold may use 100 only, so only precision 50 is restricted
+	if len(applied) != 1 || applied[clientPolicyName(svc, 50)] == nil {
+		t.Fatalf("got policies %v, want one for precision-50", applied)
+	}
+	spec := &applied[clientPolicyName(svc, 50)].Spec
+	if spec.Action.String() != "DENY" || spec.Selector.MatchLabels[precisionLabel] != "50" || spec.Selector.MatchLabels["app"] != "checkout" {
+		t.Errorf("got %v, want a DENY on the precision-50 pods of the Service", spec)
+	}
+
+	var remaining securitykube.AuthorizationPolicyList
+	if err := c.List(ctx, &remaining); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range remaining.Items {
+		names = append(names, p.Name)
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{meshPolicyName(svc)}) {
+		t.Errorf("got policies %v, want the stale client policy removed and the mesh policy kept", names)
+	}
+}
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const defaultConcurrencyMinFactor = 0.05
+
+// setConcurrencyFactors fills the concurrency factor of every flavour of status
+// from its processing throttle. Higher precisions get throttle^(p/100) of their
+// workers, so the costliest flavours are slowed down first; an unthrottled
+// schedule runs every pool in full.
+func setConcurrencyFactors(status *schedulingv1alpha1.TrafficScheduleStatus, cfg schedulingv1alpha1.ConcurrencyConfig) {
+	for i := range status.Flavours {
+		status.Flavours[i].Concurrency = ""
+	}
+	if !cfg.Enabled {
+		return
+	}
+	throttle, err := strconv.ParseFloat(strings.TrimSpace(status.ProcessingThrottle), 64)
+	if err != nil || throttle > 1 {
+		throttle = 1
+	}
+	minFactor := defaultConcurrencyMinFactor
+	if value, ok := parseOptionalFloat(cfg.MinFactor); ok {
+		minFactor = min(max(value, 0), 1)
+	}
+	for i := range status.Flavours {
+		factor := math.Pow(max(throttle, 0), float64(status.Flavours[i].Precision)/100)
+		factor = math.Round(max(factor, minFactor)*1000) / 1000
+		status.Flavours[i].Concurrency = formatFloat(factor)
+	}
+}
+
+// concurrencyEnv has the consumer size its worker pools from the concurrency
+// factors of the schedule. They replace the global in-flight throttle, which
+// would slow processing down a second time.
+func concurrencyEnv(cfg schedulingv1alpha1.ConcurrencyConfig) []corev1.EnvVar {
+	if !cfg.Enabled {
+		return nil
+	}
+	env := []corev1.EnvVar{
+		{Name: "PRECISION_CONCURRENCY_ENABLED", Value: "true"},
+		{Name: "CONSUMER_THROTTLE_ENABLED", Value: "false"},
+	}
+	if cfg.WorkersPerQueue != nil {
+		env = append(env, corev1.EnvVar{Name: "CONCURRENCY_PER_QUEUE", Value: strconv.Itoa(int(*cfg.WorkersPerQueue))})
+	}
+	return env
+}
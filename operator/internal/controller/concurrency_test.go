@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestSetConcurrencyFactors(t *testing.T) {
+	enabled := schedulingv1alpha1.ConcurrencyConfig{Enabled: true}
+	tests := []struct {
+		name     string
+		throttle string
+		cfg      schedulingv1alpha1.ConcurrencyConfig
+		want     []string
+	}{
+		{name: "disabled", throttle: "0.25", want: []string{"", "", ""}},
+		{name: "higher precisions slowed down first", throttle: "0.25", cfg: enabled, want: []string{"0.25", "0.5", "0.66"}},
+		{name: "unthrottled", throttle: "1", cfg: enabled, want: []string{"1", "1", "1"}},
+		{name: "unparsable throttle runs in full", throttle: "fast", cfg: enabled, want: []string{"1", "1", "1"}},
+		{name: "stopped keeps the minimum", throttle: "0", cfg: enabled, want: []string{"0.05", "0.05", "0.05"}},
+		{name: "custom minimum", throttle: "0.25", cfg: schedulingv1alpha1.ConcurrencyConfig{Enabled: true, MinFactor: ptr.To("0.3")},
+			want: []string{"0.3", "0.5", "0.66"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := schedulingv1alpha1.TrafficScheduleStatus{
+				ProcessingThrottle: tt.throttle,
+				Flavours: []schedulingv1alpha1.FlavourDecision{
+					{Precision: 100, Concurrency: "0.9"}, {Precision: 50}, {Precision: 30},
+				},
+			}
+			setConcurrencyFactors(&status, tt.cfg)
+			var got []string
+			for _, flavour := range status.Flavours {
+				got = append(got, flavour.Concurrency)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got factors %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConcurrencyEnv(t *testing.T) {
+	if env := concurrencyEnv(schedulingv1alpha1.ConcurrencyConfig{}); env != nil {
+		t.Errorf("disabled: got %v, want no env", env)
+	}
+	env := concurrencyEnv(schedulingv1alpha1.ConcurrencyConfig{Enabled: true, WorkersPerQueue: ptr.To[int32](8)})
+	want := []corev1.EnvVar{
+		{Name: "PRECISION_CONCURRENCY_ENABLED", Value: "true"},
+		{Name: "CONSUMER_THROTTLE_ENABLED", Value: "false"},
+		{Name: "CONCURRENCY_PER_QUEUE", Value: "8"},
+	}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("got %v, want %v", env, want)
+	}
+}
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	kedav1alpha1 "github.com/kedacore/keda/v2/apis/keda/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	networkingkube "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// conditionConverged is True once every data-plane component of a routed Service
+// runs on the current schedule version.
+const conditionConverged = "carbonrouter.io/Converged"
+
+var scheduleConvergenceSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "carbonrouter_schedule_convergence_seconds",
+	Help:    "Time from a schedule version being first observed to every data-plane component converging on it.",
+	Buckets: []float64{1, 2, 5, 10, 15, 30, 60, 120, 300, 600},
+}, []string{"namespace", "service"})
+
+func init() {
+	metrics.Registry.MustRegister(scheduleConvergenceSeconds)
+}
+
+type convergenceEntry struct {
+	version   string
+	since     time.Time
+	converged bool
+}
+
+// convergenceTracker remembers when each service first saw its current schedule
+// version, so the convergence latency is measured once per slot.
+type convergenceTracker struct {
+	mu      sync.Mutex
+	entries map[types.NamespacedName]convergenceEntry
+}
+
+// observe records the convergence state of a version and returns the time the
+// version was first seen and whether it converged in this very call.
+func (t *convergenceTracker) observe(key types.NamespacedName, version string, converged bool, now time.Time) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.entries == nil {
+		t.entries = map[types.NamespacedName]convergenceEntry{}
+	}
+	entry, ok := t.entries[key]
+	if !ok || entry.version != version {
+		entry = convergenceEntry{version: version, since: now}
+	}
+	justConverged := converged && !entry.converged
+	entry.converged = entry.converged || converged
+	t.entries[key] = entry
+	return entry.since, justConverged
+}
+
+func (t *convergenceTracker) forget(key types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, key)
+}
+
+// updateConvergence checks every data-plane component against the schedule
+// version and sets the Converged condition. It returns true while some
+// component is still catching up.
+func (r *FlavourRouterReconciler) updateConvergence(ctx context.Context, svc *corev1.Service, backend routingBackend, version string, podsPending bool) (bool, error) {
+	var pending []string
+	if podsPending {
+		pending = append(pending, "buffer-service pods")
+	}
+
+	routesPending, err := backend.pending(ctx, svc)
+	if err != nil {
+		return false, err
+	}
+	if routesPending != "" {
+		pending = append(pending, routesPending)
+	}
+
+	soPending, err := r.scaledObjectsPending(ctx, svc)
+	if err != nil {
+		return false, err
+	}
+	pending = append(pending, soPending...)
+
+	key := client.ObjectKeyFromObject(svc)
+	now := time.Now()
+	since, justConverged := r.convergence.observe(key, version, len(pending) == 0, now)
+	if justConverged {
+		scheduleConvergenceSeconds.WithLabelValues(svc.Namespace, svc.Name).Observe(now.Sub(since).Seconds())
+	}
+
+	cond := metav1.Condition{
+		Type:    conditionConverged,
+		Status:  metav1.ConditionTrue,
+		Reason:  "ScheduleApplied",
+		Message: fmt.Sprintf("schedule version %s applied end to end", version),
+	}
+	if len(pending) > 0 {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "ComponentsPending"
+		cond.Message = fmt.Sprintf("schedule version %s pending on %s (since %s)", version, strings.Join(pending, ", "), since.UTC().Format(time.RFC3339))
+	}
+	return len(pending) > 0, r.setServiceCondition(ctx, svc, cond)
+}
+
+// virtualServicePending reports whether istiod has not yet processed the latest
+// VirtualService generation. Without Istio status reporting it trusts the write.
+func (r *FlavourRouterReconciler) virtualServicePending(ctx context.Context, svc *corev1.Service) (bool, error) {
+	var vs networkingkube.VirtualService
+	if err := r.Get(ctx, client.ObjectKey{Namespace: svc.Namespace, Name: virtualServiceName(svc)}, &vs); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	observed := vs.Status.ObservedGeneration
+	return observed != 0 && observed < vs.Generation, nil
+}
+
+// scaledObjectsPending lists the ScaledObjects whose HPA does not reflect the
+// current replica ceiling yet.
+func (r *FlavourRouterReconciler) scaledObjectsPending(ctx context.Context, svc *corev1.Service) ([]string, error) {
+	var soList kedav1alpha1.ScaledObjectList
+	if err := r.List(ctx, &soList, client.InNamespace(svc.Namespace), client.MatchingLabels{parentServiceLabel: svc.Name}); err != nil {
+		return nil, err
+	}
+	var pending []string
+	for _, so := range soList.Items {
+		ready := so.Status.Conditions.GetReadyCondition()
+		if !ready.IsTrue() || so.Status.HpaName == "" {
+			pending = append(pending, "ScaledObject "+so.Name)
+			continue
+		}
+		if so.Spec.MaxReplicaCount == nil {
+			continue
+		}
+		var hpa autoscalingv2.HorizontalPodAutoscaler
+		if err := r.Get(ctx, client.ObjectKey{Namespace: so.Namespace, Name: so.Status.HpaName}, &hpa); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return nil, err
+			}
+			pending = append(pending, "ScaledObject "+so.Name)
+			continue
+		}
+		if hpa.Spec.MaxReplicas != *so.Spec.MaxReplicaCount {
+			pending = append(pending, "ScaledObject "+so.Name)
+		}
+	}
+	return pending, nil
+}
@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	kedav1alpha1 "github.com/kedacore/keda/v2/apis/keda/v1alpha1"
+	networkingkube "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestConvergenceTrackerObserve(t *testing.T) {
+	var tracker convergenceTracker
+	key := types.NamespacedName{Namespace: "shop", Name: "checkout"}
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	steps := []struct {
+		name      string
+		version   string
+		converged bool
+		at        time.Duration
+		since     time.Duration
+		just      bool
+	}{
+		{name: "new version", version: "v1"},
+		{name: "still pending", version: "v1", at: 5 * time.Second},
+		{name: "converged", version: "v1", converged: true, at: 12 * time.Second, just: true},
+		{name: "measured once", version: "v1", converged: true, at: 20 * time.Second},
+		{name: "next version restarts the clock", version: "v2", converged: true, at: 30 * time.Second, since: 30 * time.Second, just: true},
+	}
+	for _, step := range steps {
+		since, just := tracker.observe(key, step.version, step.converged, start.Add(step.at))
+		if !since.Equal(start.Add(step.since)) || just != step.just {
+			t.Errorf("%s: got since %v just %v, want %v and %v", step.name, since, just, start.Add(step.since), step.just)
+		}
+	}
+	tracker.forget(key)
+	if since, _ := tracker.observe(key, "v2", false, start.Add(time.Minute)); !since.Equal(start.Add(time.Minute)) {
+		t.Errorf("forgotten service kept its start: %v", since)
+	}
+}
+
+func TestConvergencePending(t *testing.T) {
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{clientgoscheme.AddToScheme, kedav1alpha1.AddToScheme, networkingkube.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout"}}
+	ready := kedav1alpha1.Conditions{{Type: kedav1alpha1.ConditionReady, Status: metav1.ConditionTrue}}
+	scaledObject := func(name, hpa string, conditions kedav1alpha1.Conditions, max *int32) *kedav1alpha1.ScaledObject {
+		return &kedav1alpha1.ScaledObject{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name, Labels: map[string]string{parentServiceLabel: "checkout"}},
+			Spec:       kedav1alpha1.ScaledObjectSpec{MaxReplicaCount: max},
+			Status:     kedav1alpha1.ScaledObjectStatus{HpaName: hpa, Conditions: conditions},
+		}
+	}
+	hpa := func(name string, max int32) *autoscalingv2.HorizontalPodAutoscaler {
+		return &autoscalingv2.HorizontalPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name},
+			Spec:       autoscalingv2.HorizontalPodAutoscalerSpec{MaxReplicas: max},
+		}
+	}
+	vs := &networkingkube.VirtualService{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: virtualServiceName(svc), Generation: 3}}
+	vs.Status.ObservedGeneration = 2
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		scaledObject("not-ready", "", nil, ptr.To[int32](4)),
+		scaledObject("uncapped", "keda-hpa-uncapped", ready, nil),
+		scaledObject("applied", "keda-hpa-applied", ready, ptr.To[int32](4)),
+		scaledObject("stale", "keda-hpa-stale", ready, ptr.To[int32](4)),
+		scaledObject("no-hpa", "keda-hpa-no-hpa", ready, ptr.To[int32](4)),
+		hpa("keda-hpa-applied", 4),
+		hpa("keda-hpa-stale", 8),
+		vs,
+	).Build()
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme}
+	ctx := context.Background()
+
+	pending, err := r.scaledObjectsPending(ctx, svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ScaledObject no-hpa", "ScaledObject not-ready", "ScaledObject stale"}
+	if !reflect.DeepEqual(pending, want) {
+		t.Errorf("got %v, want %v", pending, want)
+	}
+
+	if pending, err := r.virtualServicePending(ctx, svc); err != nil || !pending {
+		t.Errorf("got %v, %v, want the older observed generation pending", pending, err)
+	}
+	vs.Status.ObservedGeneration = 0
+	if err := c.Update(ctx, vs); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := r.virtualServicePending(ctx, svc); err != nil || pending {
+		t.Errorf("got %v, %v, want the write trusted without status reporting", pending, err)
+	}
+	if pending, err := r.virtualServicePending(ctx, &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "cart"}}); err != nil || pending {
+		t.Errorf("missing VirtualService: got %v, %v, want nothing pending", pending, err)
+	}
+}
@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	// dashboardLabel is the label the Grafana sidecar watches for dashboards.
+	dashboardLabel = "grafana_dashboard"
+	dashboardKey   = "carbonrouter.json"
+	// dashboardWidth is the width of the Grafana grid.
+	dashboardWidth = 24
+)
+
+func dashboardName(ts *schedulingv1alpha1.TrafficSchedule) string {
+	return "carbonrouter-dashboard-" + ts.Name
+}
+
+// dashboardPanel is the subset of the Grafana panel model the generated
+// dashboards use.
+type dashboardPanel struct {
+	ID          int               `json:"id"`
+	Type        string            `json:"type"`
+	Title       string            `json:"title"`
+	GridPos     dashboardGridPos  `json:"gridPos"`
+	Datasource  map[string]string `json:"datasource,omitempty"`
+	FieldConfig map[string]any    `json:"fieldConfig,omitempty"`
+	Targets     []dashboardTarget `json:"targets,omitempty"`
+}
+
+type dashboardGridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type dashboardTarget struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat,omitempty"`
+}
+
+// dashboardLayout places panels left to right, wrapping onto a new row of the
+// grid when the current one is full.
+type dashboardLayout struct {
+	panels []dashboardPanel
+	x, y   int
+	rowH   int
+}
+
+func (l *dashboardLayout) row(title string) {
+	l.wrap()
+	l.panels = append(l.panels, dashboardPanel{
+		ID:      len(l.panels) + 1,
+		Type:    "row",
+		Title:   title,
+		GridPos: dashboardGridPos{H: 1, W: dashboardWidth, Y: l.y},
+	})
+	l.y++
+}
+
+func (l *dashboardLayout) wrap() {
+	if l.x > 0 {
+		l.x, l.y, l.rowH = 0, l.y+l.rowH, 0
+	}
+}
+
+func (l *dashboardLayout) add(kind, title, unit string, w, h int, targets ...dashboardTarget) {
+	if l.x+w > dashboardWidth {
+		l.wrap()
+	}
+	for i := range targets {
+		targets[i].RefID = string(rune('A' + i))
+	}
+	l.panels = append(l.panels, dashboardPanel{
+		ID:          len(l.panels) + 1,
+		Type:        kind,
+		Title:       title,
+		GridPos:     dashboardGridPos{H: h, W: w, X: l.x, Y: l.y},
+		Datasource:  map[string]string{"type": "prometheus", "uid": "${datasource}"},
+		FieldConfig: map[string]any{"defaults": map[string]any{"unit": unit}, "overrides": []any{}},
+		Targets:     targets,
+	})
+	l.x += w
+	l.rowH = max(l.rowH, h)
+}
+
+// buildDashboard renders the Grafana dashboard of ts. Decision engine series
+// carry the schedule namespace as exported_namespace, since Prometheus keeps
+// namespace for the namespace of the scraped engine.
+func buildDashboard(ts *schedulingv1alpha1.TrafficSchedule, services []string) ([]byte, error) {
+	naming, err := queueNamingFor(ts.Spec.Broker)
+	if err != nil {
+		return nil, err
+	}
+	schedule := fmt.Sprintf(`exported_namespace="%s", schedule="%s"`, ts.Namespace, ts.Name)
+	layout := &dashboardLayout{}
+
+	layout.row(fmt.Sprintf("Schedule %s/%s", ts.Namespace, ts.Name))
+	layout.add("timeseries", "Flavour weights", "percent", 12, 8,
+		dashboardTarget{Expr: fmt.Sprintf("max by (flavour) (schedule_flavour_weight{%s})", schedule), LegendFormat: "{{flavour}}"})
+	layout.add("timeseries", "Carbon intensity forecast (gCO2/kWh)", "none", 12, 8,
+		dashboardTarget{Expr: fmt.Sprintf(`max(scheduler_forecast_intensity{%s, horizon="now"})`, schedule), LegendFormat: "now"},
+		dashboardTarget{Expr: fmt.Sprintf(`max(scheduler_forecast_intensity{%s, horizon="next"})`, schedule), LegendFormat: "next"})
+	layout.add("timeseries", "Credit balance and velocity", "none", 8, 8,
+		dashboardTarget{Expr: fmt.Sprintf("max(scheduler_credit_balance{%s})", schedule), LegendFormat: "balance"},
+		dashboardTarget{Expr: fmt.Sprintf("max(scheduler_credit_velocity{%s})", schedule), LegendFormat: "velocity"})
+	layout.add("timeseries", "Processing throttle", "percentunit", 8, 8,
+		dashboardTarget{Expr: fmt.Sprintf("max(scheduler_processing_throttle{%s})", schedule), LegendFormat: "throttle"})
+	layout.add("timeseries", "Replica ceilings", "none", 8, 8,
+		dashboardTarget{Expr: fmt.Sprintf("max by (component) (scheduler_effective_replica_ceiling{%s})", schedule), LegendFormat: "{{component}}"})
+
+	for _, key := range services {
+		namespace, name, _ := strings.Cut(key, "/")
+		router := fmt.Sprintf(`namespace="%s", service="buffer-service-router-%s"`, namespace, name)
+		consumer := fmt.Sprintf(`namespace="%s", service="buffer-service-consumer-%s"`, namespace, name)
+		queues := promQLString(naming.bufferedQueuePattern(namespace, name))
+
+		layout.row(fmt.Sprintf("Service %s", key))
+		layout.add("timeseries", "Ingress rate by flavour", "reqps", 6, 8,
+			dashboardTarget{Expr: fmt.Sprintf("sum by (flavour) (rate(router_ingress_http_requests_total{%s}[1m]))", router), LegendFormat: "{{flavour}}"})
+		layout.add("timeseries", "Processed rate by flavour", "reqps", 6, 8,
+			dashboardTarget{Expr: fmt.Sprintf("sum by (flavour) (rate(router_http_requests_total{%s}[1m]))", consumer), LegendFormat: "{{flavour}}"})
+		layout.add("timeseries", "Router latency p95", "s", 6, 8,
+			dashboardTarget{Expr: fmt.Sprintf("histogram_quantile(0.95, sum by (le, flavour) (rate(router_request_duration_seconds_bucket{%s}[5m])))", router), LegendFormat: "{{flavour}}"})
+		layout.add("timeseries", "Queue depth", "short", 6, 8,
+			dashboardTarget{Expr: fmt.Sprintf(`sum by (queue) (rabbitmq_detailed_queue_messages_ready{queue=~"%s"})`, queues), LegendFormat: "{{queue}}"})
+	}
+
+	dashboard := map[string]any{
+		"uid":           "carbonrouter-" + string(ts.UID),
+		"title":         fmt.Sprintf("carbonrouter / %s / %s", ts.Namespace, ts.Name),
+		"tags":          []string{"carbonrouter"},
+		"editable":      true,
+		"schemaVersion": 39,
+		"refresh":       "30s",
+		"time":          map[string]string{"from": "now-6h", "to": "now"},
+		"templating": map[string]any{"list": []any{map[string]any{
+			"name":  "datasource",
+			"label": "Datasource",
+			"type":  "datasource",
+			"query": "prometheus",
+		}}},
+		"panels": layout.panels,
+	}
+	return json.MarshalIndent(dashboard, "", "  ")
+}
+
+// ensureDashboard publishes the Grafana dashboard of ts in a ConfigMap picked
+// up by the Grafana sidecar. The ConfigMap is owned by the schedule, so it goes
+// away with it.
+func (r *TrafficScheduleReconciler) ensureDashboard(ctx context.Context, ts *schedulingv1alpha1.TrafficSchedule) error {
+	bound, err := boundServices(ctx, r.Client, ts)
+	if err != nil {
+		return err
+	}
+	services := make([]string, 0, len(bound))
+	for key := range bound {
+		services = append(services, key)
+	}
+	sort.Strings(services)
+
+	data, err := buildDashboard(ts, services)
+	if err != nil {
+		return err
+	}
+	cm := &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      dashboardName(ts),
+			Namespace: ts.Namespace,
+			Labels:    map[string]string{dashboardLabel: "1"},
+		},
+		Data: map[string]string{dashboardKey: string(data)},
+	}
+	if err := ctrl.SetControllerReference(ts, cm, r.Scheme); err != nil {
+		return err
+	}
+	return r.Patch(ctx, cm, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
+}
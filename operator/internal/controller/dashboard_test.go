@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestDashboardLayout(t *testing.T) {
+	layout := &dashboardLayout{}
+	layout.row("first")
+	layout.add("timeseries", "a", "none", 12, 8)
+	layout.add("timeseries", "b", "none", 8, 6)
+	layout.add("timeseries", "c", "none", 8, 4)
+	layout.row("second")
+	layout.add("stat", "d", "none", 24, 4, dashboardTarget{Expr: "up"}, dashboardTarget{Expr: "down"})
+
+	want := []dashboardGridPos{
+		{H: 1, W: 24, Y: 0},
+		{H: 8, W: 12, X: 0, Y: 1},
+		{H: 6, W: 8, X: 12, Y: 1},
+		// does not fit next to a and b, so it wraps below the tallest of them
+		{H: 4, W: 8, X: 0, Y: 9},
+		{H: 1, W: 24, Y: 13},
+		{H: 4, W: 24, X: 0, Y: 14},
+	}
+	if len(layout.panels) != len(want) {
+		t.Fatalf("got %d panels, want %d", len(layout.panels), len(want))
+	}
+	for i, panel := range layout.panels {
+		if panel.ID != i+1 || panel.GridPos != want[i] {
+			t.Errorf("panel %q: got id %d at %+v, want id %d at %+v", panel.Title, panel.ID, panel.GridPos, i+1, want[i])
+		}
+	}
+	targets := layout.panels[5].Targets
+	if targets[0].RefID != "A" || targets[1].RefID != "B" {
+		t.Errorf("got targets %v, want refIds A and B", targets)
+	}
+}
+
+func TestBuildDashboard(t *testing.T) {
+	ts := &schedulingv1alpha1.TrafficSchedule{ObjectMeta: metav1.ObjectMeta{Namespace: "ops", Name: "default", UID: "1234"}}
+	data, err := buildDashboard(ts, []string{"shop/checkout", "shop/cart"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dashboard struct {
+		UID    string           `json:"uid"`
+		Title  string           `json:"title"`
+		Panels []dashboardPanel `json:"panels"`
+	}
+	if err := json.Unmarshal(data, &dashboard); err != nil {
+		t.Fatal(err)
+	}
+	if dashboard.UID != "carbonrouter-1234" || dashboard.Title != "carbonrouter / ops / default" {
+		t.Errorf("got uid %q and title %q", dashboard.UID, dashboard.Title)
+	}
+
+	var rows []string
+	for _, panel := range dashboard.Panels {
+		if panel.Type == "row" {
+			rows = append(rows, panel.Title)
+			continue
+		}
+		for _, target := range panel.Targets {
+			if strings.Contains(target.Expr, "scheduler_") && !strings.Contains(target.Expr, `exported_namespace="ops", schedule="default"`) {
+				t.Errorf("%s: got %s, want the schedule selected by exported_namespace", panel.Title, target.Expr)
+			}
+		}
+	}
+	if strings.Join(rows, ", ") != "Schedule ops/default, Service shop/checkout, Service shop/cart" {
+		t.Errorf("got rows %v, want the schedule then one per Service", rows)
+	}
+	queueDepth := dashboard.Panels[len(dashboard.Panels)-1]
+	if queueDepth.Title != "Queue depth" || !strings.Contains(queueDepth.Targets[0].Expr, `shop\\.cart`) {
+		t.Errorf("got %q with %v, want the escaped buffered queues of the Service", queueDepth.Title, queueDepth.Targets)
+	}
+
+	ts.Spec.Broker.QueueNameTemplate = "{flavour}"
+	if _, err := buildDashboard(ts, nil); err == nil {
+		t.Error("invalid queue name template accepted")
+	}
+}
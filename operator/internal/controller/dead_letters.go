@@ -0,0 +1,361 @@
+package controller
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DeadLettersPattern and DeadLettersReplayPattern are the operator API routes
+// listing the dead-lettered requests of a routed Service and replaying them.
+const (
+	DeadLettersPattern       = "GET /deadletters/{namespace}/{service}"
+	DeadLettersReplayPattern = "POST /deadletters/{namespace}/{service}/replay"
+)
+
+const (
+	defaultDeadLettersLimit = 100
+	maxDeadLettersLimit     = 1000
+	// deadLetterAttemptsHeader counts the failed forwards of a request, see
+	// the RabbitMQ transport of the buffer service.
+	deadLetterAttemptsHeader = "x-carbonrouter-attempts"
+	// defaultExchange is the name of the default exchange in the management API.
+	defaultExchange = "amq.default"
+)
+
+// errNoDeadLetterQueue is returned for Services without a dead-letter queue.
+var errNoDeadLetterQueue = errors.New("no dead-letter queue")
+
+// DeadLetters lists the requests in the dead-letter queue of a routed Service,
+// see spec.broker.topology.deadLetter, and replays them into the direct queue
+// of their precision, so they are forwarded as soon as a consumer is back.
+type DeadLetters struct {
+	reader client.Reader
+	// secrets reads the broker credentials uncached.
+	secrets client.Reader
+	token   []byte
+}
+
+// NewDeadLetters returns a DeadLetters reading Services and schedules through
+// reader and the broker Secrets through secrets. Clients must send token as
+// a bearer token.
+func NewDeadLetters(reader, secrets client.Reader, token string) *DeadLetters {
+	return &DeadLetters{reader: reader, secrets: secrets, token: []byte(token)}
+}
+
+// deadLetter describes a dead-lettered request.
+type deadLetter struct {
+	Precision int    `json:"precision,omitempty"`
+	QueueType string `json:"queueType,omitempty"`
+	// Reason is why the broker dead-lettered it: "expired", "maxlen" or
+	// "rejected" by a consumer that ran out of attempts.
+	Reason         string     `json:"reason,omitempty"`
+	Queue          string     `json:"queue,omitempty"`
+	DeadLetteredAt *time.Time `json:"deadLetteredAt,omitempty"`
+	Attempts       int        `json:"attempts,omitempty"`
+	Method         string     `json:"method,omitempty"`
+	Path           string     `json:"path,omitempty"`
+}
+
+// deadLetterList is the JSON document listing the dead letters of a Service.
+type deadLetterList struct {
+	Service string `json:"service"`
+	Queue   string `json:"queue"`
+	// Total counts the requests in the queue, of which Requests lists up to
+	// the limit, counted by precision subset in ByPrecision.
+	Total       int64          `json:"total"`
+	ByPrecision map[string]int `json:"byPrecision"`
+	Requests    []deadLetter   `json:"requests"`
+}
+
+// deadLetterReplay is the JSON document answering a replay.
+type deadLetterReplay struct {
+	Service string `json:"service"`
+	// Replayed requests went to the direct queue of their precision, Skipped
+	// ones, of other precisions or of none, back to the dead-letter queue.
+	Replayed int `json:"replayed"`
+	Skipped  int `json:"skipped"`
+}
+
+// managementMessage is a message as read and published by the management API.
+type managementMessage struct {
+	Properties struct {
+		Headers map[string]interface{} `json:"headers"`
+	} `json:"properties"`
+	Payload         string `json:"payload"`
+	PayloadEncoding string `json:"payload_encoding"`
+}
+
+// ServeHTTP lists or replays the dead letters of the routed Service
+// {namespace}/{service}. Both take a limit query parameter; a replay can be
+// restricted to one precision with the precision query parameter.
+func (h *DeadLetters) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	token, _ := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), h.token) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	limit := defaultDeadLettersLimit
+	if raw := req.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxDeadLettersLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxDeadLettersLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	var precision *int
+	if raw := req.URL.Query().Get("precision"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			http.Error(w, "precision must be an integer", http.StatusBadRequest)
+			return
+		}
+		precision = &parsed
+	}
+
+	ctx := req.Context()
+	key := types.NamespacedName{Namespace: req.PathValue("namespace"), Name: req.PathValue("service")}
+	var svc corev1.Service
+	if err := h.reader.Get(ctx, key, &svc); err != nil {
+		h.fail(w, err)
+		return
+	}
+	routed, err := routedServiceFor(ctx, h.reader, &svc)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	if !optedIn(&svc, routed) {
+		http.Error(w, "service is not routed by carbonrouter", http.StatusNotFound)
+		return
+	}
+	cfg, err := serviceBrokerConfig(ctx, h.reader, &svc)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	broker, err := resolveBroker(ctx, h.secrets, svc.Namespace, cfg)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+
+	var body interface{}
+	if req.Method == http.MethodPost {
+		body, err = replayDeadLetters(ctx, broker, svc.Namespace, svc.Name, precision, limit)
+	} else {
+		body, err = listDeadLetters(ctx, broker, svc.Namespace, svc.Name, limit)
+	}
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (h *DeadLetters) fail(w http.ResponseWriter, err error) {
+	switch {
+	case apierrors.IsNotFound(err):
+		http.Error(w, "service not found", http.StatusNotFound)
+	case errors.Is(err, errNoManagementAPI):
+		http.Error(w, "dead letters need the rabbitmq backend", http.StatusConflict)
+	case errors.Is(err, errNoDeadLetterQueue):
+		http.Error(w, "no dead-letter queue, set spec.broker.topology.deadLetter", http.StatusNotFound)
+	default:
+		ctrl.Log.WithName("[DeadLetters]").Error(err, "Failed to serve dead letters")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+// deadLetterCount reads the requests in the dead-letter queue of a Service
+// from the RabbitMQ management API.
+func deadLetterCount(ctx context.Context, broker brokerEndpoint, namespace, service string) (int64, error) {
+	name := deadLetterQueue(broker.Naming, namespace, service)
+	req, err := broker.managementRequest(ctx, http.MethodGet, broker.managementPath("queues", name), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return 0, errNoDeadLetterQueue
+	case resp.StatusCode >= http.StatusBadRequest:
+		return 0, fmt.Errorf("get queue %s: %s", name, resp.Status)
+	}
+	var queue struct {
+		Messages int64 `json:"messages"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&queue); err != nil {
+		return 0, fmt.Errorf("decode queue %s: %w", name, err)
+	}
+	return queue.Messages, nil
+}
+
+// fetchDeadLetters takes up to count messages off the dead-letter queue of a
+// Service. Unless remove is set, the broker puts them back right away.
+func fetchDeadLetters(ctx context.Context, broker brokerEndpoint, namespace, service string, count int, remove bool) ([]managementMessage, error) {
+	ackMode := "ack_requeue_true"
+	if remove {
+		ackMode = "ack_requeue_false"
+	}
+	var messages []managementMessage
+	err := managementCall(ctx, broker, http.MethodPost,
+		broker.managementPath("queues", deadLetterQueue(broker.Naming, namespace, service))+"/get",
+		map[string]interface{}{"count": count, "ackmode": ackMode, "encoding": "base64"}, &messages)
+	return messages, err
+}
+
+func listDeadLetters(ctx context.Context, broker brokerEndpoint, namespace, service string, limit int) (deadLetterList, error) {
+	total, err := deadLetterCount(ctx, broker, namespace, service)
+	if err != nil {
+		return deadLetterList{}, err
+	}
+	list := deadLetterList{
+		Service:     namespace + "/" + service,
+		Queue:       deadLetterQueue(broker.Naming, namespace, service),
+		Total:       total,
+		ByPrecision: map[string]int{},
+		Requests:    []deadLetter{},
+	}
+	if total == 0 {
+		return list, nil
+	}
+	messages, err := fetchDeadLetters(ctx, broker, namespace, service, limit, false)
+	if err != nil {
+		return deadLetterList{}, err
+	}
+	for _, message := range messages {
+		letter := describeDeadLetter(message)
+		list.Requests = append(list.Requests, letter)
+		if letter.Precision > 0 {
+			list.ByPrecision[precisionSubsetName(letter.Precision)]++
+		}
+	}
+	return list, nil
+}
+
+// replayDeadLetters moves up to limit requests of the dead-letter queue of a
+// Service to the direct queue of their precision, or only those of precision
+// when set. The others go back to the tail of the dead-letter queue, as does a
+// request the broker failed to route, so none is lost.
+func replayDeadLetters(ctx context.Context, broker brokerEndpoint, namespace, service string, precision *int, limit int) (deadLetterReplay, error) {
+	if _, err := deadLetterCount(ctx, broker, namespace, service); err != nil {
+		return deadLetterReplay{}, err
+	}
+	messages, err := fetchDeadLetters(ctx, broker, namespace, service, limit, true)
+	if err != nil {
+		return deadLetterReplay{}, err
+	}
+	dlq := deadLetterQueue(broker.Naming, namespace, service)
+	exchange := broker.Naming.exchangeName(namespace, service)
+	replay := deadLetterReplay{Service: namespace + "/" + service}
+	var errs []error
+	for _, message := range messages {
+		letter := describeDeadLetter(message)
+		if letter.Precision > 0 && (precision == nil || *precision == letter.Precision) {
+			err := publishMessage(ctx, broker, exchange, "", replayHeaders(message.Properties.Headers, letter.Precision), message)
+			if err == nil {
+				replay.Replayed++
+				continue
+			}
+			errs = append(errs, err)
+		} else {
+			replay.Skipped++
+		}
+		if err := publishMessage(ctx, broker, defaultExchange, dlq, message.Properties.Headers, message); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return replay, errors.Join(errs...)
+}
+
+// publishMessage publishes message with headers on exchange.
+func publishMessage(ctx context.Context, broker brokerEndpoint, exchange, routingKey string, headers map[string]interface{}, message managementMessage) error {
+	var result struct {
+		Routed bool `json:"routed"`
+	}
+	err := managementCall(ctx, broker, http.MethodPost, broker.managementPath("exchanges", exchange)+"/publish",
+		map[string]interface{}{
+			"properties":       map[string]interface{}{"headers": headers, "delivery_mode": 2},
+			"routing_key":      routingKey,
+			"payload":          message.Payload,
+			"payload_encoding": message.PayloadEncoding,
+		}, &result)
+	if err == nil && !result.Routed {
+		err = fmt.Errorf("publish on %s: message not routed", exchange)
+	}
+	return err
+}
+
+// replayHeaders sends a dead letter to the direct queue of precision, with
+// its attempts and dead-lettering history reset.
+func replayHeaders(headers map[string]interface{}, precision int) map[string]interface{} {
+	replayed := make(map[string]interface{}, len(headers))
+	for key, value := range headers {
+		if key == deadLetterAttemptsHeader || key == "x-death" || strings.HasPrefix(key, "x-first-death-") || strings.HasPrefix(key, "x-last-death-") {
+			continue
+		}
+		replayed[key] = value
+	}
+	replayed["q_type"] = queueTypeDirect
+	replayed["flavour"] = precisionSubsetName(precision)
+	return replayed
+}
+
+// describeDeadLetter reads a dead letter from its headers, the first death
+// recorded by the broker and the request it carries.
+func describeDeadLetter(message managementMessage) deadLetter {
+	headers := message.Properties.Headers
+	var letter deadLetter
+	if flavour, ok := headers["flavour"].(string); ok {
+		letter.Precision, _ = strconv.Atoi(strings.TrimPrefix(flavour, "precision-"))
+	}
+	letter.QueueType, _ = headers["q_type"].(string)
+	switch attempts := headers[deadLetterAttemptsHeader].(type) {
+	case float64:
+		letter.Attempts = int(attempts)
+	case string:
+		letter.Attempts, _ = strconv.Atoi(attempts)
+	}
+	if deaths, ok := headers["x-death"].([]interface{}); ok && len(deaths) > 0 {
+		if death, ok := deaths[0].(map[string]interface{}); ok {
+			letter.Reason, _ = death["reason"].(string)
+			letter.Queue, _ = death["queue"].(string)
+			if at, ok := death["time"].(float64); ok {
+				deadAt := time.Unix(int64(at), 0).UTC()
+				letter.DeadLetteredAt = &deadAt
+			}
+		}
+	}
+	if message.PayloadEncoding == "base64" {
+		if payload, err := base64.StdEncoding.DecodeString(message.Payload); err == nil {
+			var request struct {
+				Method string `json:"method"`
+				Path   string `json:"path"`
+			}
+			if json.Unmarshal(payload, &request) == nil {
+				letter.Method, letter.Path = request.Method, request.Path
+			}
+		}
+	}
+	return letter
+}
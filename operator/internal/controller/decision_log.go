@@ -0,0 +1,389 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/syslog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+// Sources of the decisions in the decision log.
+const (
+	decisionSourceEngine     = "engine"
+	decisionSourceKillSwitch = "kill-switch"
+	decisionSourceFallback   = "fallback"
+	// decisionSourceAnchor marks the record each file of a directory target
+	// starts with, chained to the last record of the previous file.
+	decisionSourceAnchor = "anchor"
+)
+
+var decisionLogFailures = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "carbonrouter_decision_log_failures_total",
+	Help: "Schedule decisions that could not be written to the decision log.",
+})
+
+func init() {
+	metrics.Registry.MustRegister(decisionLogFailures)
+}
+
+// DecisionRecord is one line of the decision log. It holds the figures of the
+// schedule only, never request data or client identities.
+type DecisionRecord struct {
+	Seq       uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace"`
+	Schedule  string    `json:"schedule"`
+	// Source is engine, kill-switch or fallback, and Reason why a kill-switch
+	// or fallback decision was taken.
+	Source             string           `json:"source"`
+	Reason             string           `json:"reason,omitempty"`
+	Policy             string           `json:"policy,omitempty"`
+	Weights            map[string]int   `json:"weights"`
+	ProcessingThrottle string           `json:"processingThrottle,omitempty"`
+	ReplicaCeilings    map[string]int32 `json:"replicaCeilings,omitempty"`
+	CarbonNow          string           `json:"carbonNow,omitempty"`
+	CarbonNext         string           `json:"carbonNext,omitempty"`
+	CreditBalance      string           `json:"creditBalance,omitempty"`
+	ValidUntil         time.Time        `json:"validUntil"`
+	// Degraded reports that part of the traffic is served below full precision.
+	Degraded bool `json:"degraded"`
+	// Prev is the signature of the previous record, empty when the chain starts.
+	Prev      string `json:"prev"`
+	Signature string `json:"sig,omitempty"`
+}
+
+// decisionSink stores the lines of the decision log.
+type decisionSink interface {
+	// last returns the last line stored, to carry the chain on across
+	// restarts, or nil.
+	last() ([]byte, error)
+	// starts reports whether a line written at goes to a new file, which
+	// then starts with an anchor.
+	starts(at time.Time) bool
+	write(line []byte, at time.Time) error
+}
+
+// DecisionLog appends every schedule decision applied to a TrafficSchedule to
+// an audit trail of JSON lines. Each line is signed with HMAC-SHA256 and holds
+// the signature of the previous one, so lines removed, reordered or edited
+// after the fact fail VerifyDecisionLog. Each daily file starts with an anchor
+// record chained to the last record of the previous file, so the files left
+// once the retention deleted older ones still verify.
+type DecisionLog struct {
+	sink decisionSink
+	key  []byte
+
+	mu   sync.Mutex
+	seq  uint64
+	prev string
+	// last is the digest of the last decision logged per schedule
+	last map[types.NamespacedName]string
+}
+
+// NewDecisionLog returns a DecisionLog writing to target, a directory of daily
+// files (file:///var/log/carbonrouter or a plain path) whose files older than
+// retention are deleted, or a syslog endpoint (syslog+tcp://host:514 or
+// syslog+udp://host:514), which keeps the records as long as it is configured
+// to. A zero retention keeps every file.
+func NewDecisionLog(target string, key []byte, retention time.Duration) (*DecisionLog, error) {
+	if len(key) == 0 {
+		return nil, errors.New("the decision log needs a signing key")
+	}
+	var sink decisionSink
+	parsed, err := url.Parse(target)
+	switch {
+	case err == nil && (parsed.Scheme == "syslog+tcp" || parsed.Scheme == "syslog+udp"):
+		writer, err := syslog.Dial(strings.TrimPrefix(parsed.Scheme, "syslog+"), parsed.Host, syslog.LOG_NOTICE|syslog.LOG_LOCAL0, "carbonrouter-decisions")
+		if err != nil {
+			return nil, err
+		}
+		sink = syslogSink{writer}
+	case err == nil && parsed.Scheme == "file":
+		sink, err = newFileSink(parsed.Path, retention)
+	case err == nil && parsed.Scheme == "":
+		sink, err = newFileSink(target, retention)
+	default:
+		err = fmt.Errorf("unsupported decision log target %q, expected a directory, file://, syslog+tcp:// or syslog+udp://", target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	log := &DecisionLog{sink: sink, key: key, last: map[types.NamespacedName]string{}}
+	line, err := sink.last()
+	if err != nil {
+		return nil, fmt.Errorf("read the end of the decision log: %w", err)
+	}
+	if len(line) > 0 {
+		var record DecisionRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("decode the end of the decision log: %w", err)
+		}
+		log.seq, log.prev = record.Seq, record.Signature
+	}
+	return log, nil
+}
+
+// Record logs the status of ts as a decision from source, unless it repeats
+// the last decision logged for ts. Failures are logged and counted but never
+// fail the reconcile. A nil DecisionLog records nothing.
+func (d *DecisionLog) Record(ctx context.Context, ts *schedulingv1alpha1.TrafficSchedule, source, reason string) {
+	if d == nil {
+		return
+	}
+	d.record(ctx, ts, source, reason, time.Now().UTC())
+}
+
+func (d *DecisionLog) record(ctx context.Context, ts *schedulingv1alpha1.TrafficSchedule, source, reason string, now time.Time) {
+	status := ts.Status
+	record := DecisionRecord{
+		Namespace:          ts.Namespace,
+		Schedule:           ts.Name,
+		Source:             source,
+		Reason:             reason,
+		Policy:             status.ActivePolicy,
+		Weights:            make(map[string]int, len(status.Flavours)),
+		ProcessingThrottle: status.ProcessingThrottle,
+		ReplicaCeilings:    status.EffectiveReplicaCeilings,
+		CarbonNow:          status.CarbonForecastNow,
+		CarbonNext:         status.CarbonForecastNext,
+		CreditBalance:      status.CreditBalance,
+		ValidUntil:         status.ValidUntil.UTC(),
+	}
+	highest := 0
+	for _, flavour := range status.Flavours {
+		highest = max(highest, flavour.Precision)
+	}
+	for _, flavour := range status.Flavours {
+		record.Weights[precisionSubsetName(flavour.Precision)] = flavour.Weight
+		if flavour.Precision < highest && flavour.Weight > 0 {
+			record.Degraded = true
+		}
+	}
+
+	key := client.ObjectKeyFromObject(ts)
+	decision, _ := json.Marshal(record)
+	digest := fmt.Sprintf("%x", sha256.Sum256(decision))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.last[key] == digest {
+		return
+	}
+	var err error
+	if d.prev != "" && d.sink.starts(now) {
+		err = d.append(DecisionRecord{Time: now, Source: decisionSourceAnchor}, now)
+	}
+	if err == nil {
+		record.Time = now
+		err = d.append(record, now)
+	}
+	if err != nil {
+		decisionLogFailures.Inc()
+		ctrl.LoggerFrom(ctx).WithName("[DecisionLog]").Error(err, "Failed to write a schedule decision", "schedule", key)
+		return
+	}
+	d.last[key] = digest
+}
+
+// append chains record to the last one written, signs and writes it.
+func (d *DecisionLog) append(record DecisionRecord, now time.Time) error {
+	record.Seq, record.Prev = d.seq+1, d.prev
+	record.Signature = signDecision(d.key, record)
+	line, err := json.Marshal(record)
+	if err == nil {
+		err = d.sink.write(line, now)
+	}
+	if err != nil {
+		return err
+	}
+	d.seq, d.prev = record.Seq, record.Signature
+	return nil
+}
+
+// Forget drops what is remembered about a deleted schedule.
+func (d *DecisionLog) Forget(key types.NamespacedName) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.last, key)
+}
+
+// fallbackReason is the reason of the fallback condition of ts.
+func fallbackReason(ts *schedulingv1alpha1.TrafficSchedule) string {
+	if cond := meta.FindStatusCondition(ts.Status.Conditions, conditionScheduleFallback); cond != nil {
+		return cond.Reason
+	}
+	return ""
+}
+
+// signDecision signs record without its signature.
+func signDecision(key []byte, record DecisionRecord) string {
+	record.Signature = ""
+	payload, _ := json.Marshal(record)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyDecisionLog checks the signature of every record read from r and that
+// each one follows the previous: a record with an empty prev starts a new
+// chain, as after a restart with a syslog target, and the log may start with an
+// anchor whose previous file the retention deleted. It returns the number of
+// records verified.
+func VerifyDecisionLog(r io.Reader, key []byte) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var prev DecisionRecord
+	count := 0
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var record DecisionRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return count, fmt.Errorf("line %d: %w", line, err)
+		}
+		if !hmac.Equal([]byte(signDecision(key, record)), []byte(record.Signature)) {
+			return count, fmt.Errorf("line %d: record %d has an invalid signature", line, record.Seq)
+		}
+		head := count == 0 && record.Source == decisionSourceAnchor
+		if record.Prev != "" && !head && (record.Prev != prev.Signature || record.Seq != prev.Seq+1) {
+			return count, fmt.Errorf("line %d: record %d does not follow record %d", line, record.Seq, prev.Seq)
+		}
+		prev = record
+		count++
+	}
+	return count, scanner.Err()
+}
+
+// fileSink appends the records to one file per UTC day in dir.
+type fileSink struct {
+	dir       string
+	retention time.Duration
+
+	day  string
+	file *os.File
+}
+
+const decisionFilePrefix, decisionFileSuffix = "decisions-", ".jsonl"
+
+func newFileSink(dir string, retention time.Duration) (*fileSink, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &fileSink{dir: dir, retention: retention}, nil
+}
+
+func (s *fileSink) path(day string) string {
+	return filepath.Join(s.dir, decisionFilePrefix+day+decisionFileSuffix)
+}
+
+func (s *fileSink) files() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(s.dir, decisionFilePrefix+"*"+decisionFileSuffix))
+	slices.Sort(matches)
+	return matches, err
+}
+
+func (s *fileSink) last() ([]byte, error) {
+	files, err := s.files()
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+	content, err := os.ReadFile(files[len(files)-1])
+	if err != nil {
+		return nil, err
+	}
+	lines := bytes.Split(bytes.TrimSpace(content), []byte("\n"))
+	return lines[len(lines)-1], nil
+}
+
+func (s *fileSink) starts(at time.Time) bool {
+	day := at.UTC().Format(time.DateOnly)
+	if s.file != nil && day == s.day {
+		return false
+	}
+	info, err := os.Stat(s.path(day))
+	return err != nil || info.Size() == 0
+}
+
+func (s *fileSink) write(line []byte, at time.Time) error {
+	if day := at.UTC().Format(time.DateOnly); day != s.day || s.file == nil {
+		if err := s.rotate(day, at); err != nil {
+			return err
+		}
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// rotate opens the file of day and deletes the files past the retention at
+// now.
+func (s *fileSink) rotate(day string, now time.Time) error {
+	if s.file != nil {
+		s.file.Close()
+	}
+	file, err := os.OpenFile(s.path(day), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		s.file = nil
+		return err
+	}
+	s.file, s.day = file, day
+	if s.retention <= 0 {
+		return nil
+	}
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+	cutoff := now.UTC().Add(-s.retention).Format(time.DateOnly)
+	for _, path := range files {
+		fileDay := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), decisionFilePrefix), decisionFileSuffix)
+		if fileDay < cutoff {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// syslogSink sends every record as one syslog message. The chain starts over
+// after a restart, since syslog cannot be read back.
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+func (syslogSink) last() ([]byte, error) { return nil, nil }
+
+func (syslogSink) starts(time.Time) bool { return false }
+
+func (s syslogSink) write(line []byte, _ time.Time) error {
+	return s.writer.Notice(string(line))
+}
@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+// writeDecisions records one decision per day from start for days days,
+// alternating the weights so that no decision repeats the previous one.
+func writeDecisions(t *testing.T, d *DecisionLog, start time.Time, days int) {
+	t.Helper()
+	ts := &schedulingv1alpha1.TrafficSchedule{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "green"}}
+	for day := range days {
+		weight := 40 + start.Add(time.Duration(day)*24*time.Hour).Day()
+		ts.Status.Flavours = []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 100 - weight}, {Precision: 50, Weight: weight}}
+		d.record(context.Background(), ts, decisionSourceEngine, "", start.Add(time.Duration(day)*24*time.Hour))
+	}
+}
+
+func readDecisionFiles(t *testing.T, dir string) [][]byte {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files [][]byte
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, content)
+	}
+	return files
+}
+
+func TestDecisionLogChainSurvivesRetention(t *testing.T) {
+	key := []byte("secret")
+	dir := t.TempDir()
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	d, err := NewDecisionLog(dir, key, 48*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeDecisions(t, d, start, 3)
+
+	// A restart carries the chain on from the last file
+	d, err = NewDecisionLog(dir, key, 48*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeDecisions(t, d, start.Add(3*24*time.Hour), 2)
+
+	files := readDecisionFiles(t, dir)
+	if len(files) != 3 {
+		t.Fatalf("got %d files, want the 3 days within the retention", len(files))
+	}
+	for i, file := range files {
+		if !bytes.Contains(bytes.SplitN(file, []byte("\n"), 2)[0], []byte(`"source":"anchor"`)) {
+			t.Errorf("file %d does not start with an anchor", i)
+		}
+	}
+	// 3 files holding an anchor and a decision each
+	if count, err := VerifyDecisionLog(bytes.NewReader(bytes.Join(files, nil)), key); err != nil || count != 6 {
+		t.Errorf("retained log: got %d records, %v", count, err)
+	}
+
+	tests := []struct {
+		name  string
+		files [][]byte
+	}{
+		{name: "file removed", files: [][]byte{files[0], files[2]}},
+		{name: "files reordered", files: [][]byte{files[1], files[0], files[2]}},
+		{name: "record edited", files: [][]byte{files[0], bytes.Replace(files[1], []byte(`"source":"engine"`), []byte(`"source":"fallback"`), 1), files[2]}},
+		{name: "anchor removed", files: [][]byte{bytes.SplitN(files[0], []byte("\n"), 2)[1], files[1], files[2]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := VerifyDecisionLog(bytes.NewReader(bytes.Join(tt.files, nil)), key); err == nil {
+				t.Error("tampered log verified")
+			}
+		})
+	}
+	if _, err := VerifyDecisionLog(bytes.NewReader(bytes.Join(files, nil)), []byte("other")); err == nil {
+		t.Error("log verified with another key")
+	}
+}
+
+func TestDecisionLogSkipsRepeatedDecisions(t *testing.T) {
+	dir := t.TempDir()
+	d, err := NewDecisionLog(dir, []byte("secret"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := &schedulingv1alpha1.TrafficSchedule{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "green"}}
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i := range 3 {
+		d.record(context.Background(), ts, decisionSourceEngine, "", now.Add(time.Duration(i)*time.Minute))
+	}
+	files := readDecisionFiles(t, dir)
+	if len(files) != 1 || bytes.Count(files[0], []byte("\n")) != 1 {
+		t.Errorf("got %q, want a single decision", files)
+	}
+}
+
+func TestNewDecisionLog(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		target  string
+		key     []byte
+		wantErr bool
+	}{
+		{name: "directory", target: filepath.Join(dir, "plain"), key: []byte("secret")},
+		{name: "file URL", target: "file://" + filepath.Join(dir, "url"), key: []byte("secret")},
+		{name: "no key", target: dir, wantErr: true},
+		{name: "unsupported scheme", target: "s3://bucket/decisions", key: []byte("secret"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDecisionLog(tt.target, tt.key, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && d == nil {
+				t.Error("got no decision log")
+			}
+		})
+	}
+
+	// A nil log records nothing
+	var d *DecisionLog
+	d.Record(context.Background(), &schedulingv1alpha1.TrafficSchedule{}, decisionSourceEngine, "")
+	d.Forget(client.ObjectKey{Namespace: "shop", Name: "green"})
+}
+
+func TestDecisionRecord(t *testing.T) {
+	dir := t.TempDir()
+	d, err := NewDecisionLog(dir, []byte("secret"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := &schedulingv1alpha1.TrafficSchedule{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "green"}}
+	ts.Status.ActivePolicy = "credit-greedy"
+	ts.Status.Flavours = []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 70}, {Precision: 50, Weight: 30}, {Precision: 30}}
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	d.record(context.Background(), ts, decisionSourceFallback, "EngineUnavailable", now)
+
+	// Forgetting the schedule logs its next decision even when it repeats
+	d.Forget(client.ObjectKeyFromObject(ts))
+	ts.Status.Flavours = []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 100}, {Precision: 50}}
+	d.record(context.Background(), ts, decisionSourceEngine, "", now.Add(time.Minute))
+	d.Forget(client.ObjectKeyFromObject(ts))
+	d.record(context.Background(), ts, decisionSourceEngine, "", now.Add(2*time.Minute))
+
+	files := readDecisionFiles(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("got %d files, want one for the day", len(files))
+	}
+	lines := bytes.Split(bytes.TrimSpace(files[0]), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("got %d records, want 3", len(lines))
+	}
+	var records []DecisionRecord
+	for _, line := range lines {
+		var record DecisionRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	first := records[0]
+	if first.Seq != 1 || first.Prev != "" || first.Source != decisionSourceFallback || first.Reason != "EngineUnavailable" || first.Policy != "credit-greedy" {
+		t.Errorf("got %+v, want the first fallback decision of the chain", first)
+	}
+	if first.Weights["precision-50"] != 30 || !first.Degraded {
+		t.Errorf("got weights %v degraded %v, want traffic on precision-50 reported as degraded", first.Weights, first.Degraded)
+	}
+	if records[1].Degraded || records[1].Prev != first.Signature {
+		t.Errorf("got %+v, want a full precision decision chained to the first", records[1])
+	}
+	if records[2].Seq != 3 {
+		t.Errorf("got seq %d, want the repeated decision logged once forgotten", records[2].Seq)
+	}
+}
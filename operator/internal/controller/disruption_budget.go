@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ensureDisruptionBudget keeps minAvailable pods of a buffer service component
+// running through node drains, and removes the budget once minAvailable is
+// unset. Unhealthy pods may always be evicted, so a crash-looping component
+// cannot block a drain.
+func (r *FlavourRouterReconciler) ensureDisruptionBudget(ctx context.Context, svc *corev1.Service, component string, minAvailable *intstr.IntOrString) error {
+	name := fmt.Sprintf("buffer-service-%s-%s", component, svc.Name)
+	if minAvailable == nil {
+		return r.deleteDisruptionBudget(ctx, svc, name)
+	}
+	ctrl.LoggerFrom(ctx).WithName("[FlavourRouter]").Info("Ensuring PodDisruptionBudget for buffer service", "component", component, "minAvailable", minAvailable.String())
+
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: svc.Namespace,
+			Labels: map[string]string{
+				parentServiceLabel:             svc.Name,
+				"app.kubernetes.io/managed-by": "carbonrouter-operator",
+			},
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MinAvailable: minAvailable,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{
+				"app.kubernetes.io/name": fmt.Sprintf("buffer-service-%s", component),
+				parentServiceLabel:       svc.Name,
+			}},
+			UnhealthyPodEvictionPolicy: ptr.To(policyv1.AlwaysAllow),
+		},
+	}
+	if err := ctrl.SetControllerReference(svc, pdb, r.Scheme); err != nil {
+		return err
+	}
+	return r.apply(ctx, svc, "PodDisruptionBudget", pdb, &pdb.Spec)
+}
+
+// deleteDisruptionBudget removes the budget of a component, looking it up in
+// the cache first so components without one cost no API call.
+func (r *FlavourRouterReconciler) deleteDisruptionBudget(ctx context.Context, svc *corev1.Service, name string) error {
+	var pdb policyv1.PodDisruptionBudget
+	if err := r.Get(ctx, types.NamespacedName{Namespace: svc.Namespace, Name: name}, &pdb); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if err := r.Delete(ctx, &pdb); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	r.Inventory.Drop(client.ObjectKeyFromObject(svc), "PodDisruptionBudget", svc.Namespace, name)
+	return nil
+}
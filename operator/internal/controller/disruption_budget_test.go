@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestEnsureDisruptionBudget(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout", UID: "checkout"}}
+	var applied *policyv1.PodDisruptionBudget
+	c := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			applied = obj.(*policyv1.PodDisruptionBudget).DeepCopy()
+			applied.ResourceVersion = ""
+			return c.Create(ctx, applied)
+		},
+	}).Build()
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme, Inventory: NewResourceInventory()}
+	ctx := context.Background()
+
+	// Nothing to remove before a budget was ever set
+	if err := r.ensureDisruptionBudget(ctx, svc, "router", nil); err != nil {
+		t.Fatal(err)
+	}
+	if applied != nil {
+		t.Fatalf("got %v, want no budget without minAvailable", applied)
+	}
+
+	minAvailable := intstr.FromString("50%")
+	if err := r.ensureDisruptionBudget(ctx, svc, "router", &minAvailable); err != nil {
+		t.Fatal(err)
+	}
+	if applied == nil || applied.Name != "buffer-service-router-checkout" {
+		t.Fatalf("got %v, want the budget of the router", applied)
+	}
+	spec := applied.Spec
+	if spec.MinAvailable.String() != "50%" || ptr.Deref(spec.UnhealthyPodEvictionPolicy, "") != policyv1.AlwaysAllow {
+		t.Errorf("got minAvailable %v and unhealthy pod eviction %v, want 50%% with unhealthy pods always evictable", spec.MinAvailable, spec.UnhealthyPodEvictionPolicy)
+	}
+	if spec.Selector.MatchLabels["app.kubernetes.io/name"] != "buffer-service-router" || spec.Selector.MatchLabels[parentServiceLabel] != "checkout" {
+		t.Errorf("got selector %v, want the router pods of the Service", spec.Selector)
+	}
+	if owner := metav1.GetControllerOf(applied); owner == nil || owner.UID != svc.UID {
+		t.Errorf("got owner %v, want the Service", owner)
+	}
+
+	if err := r.ensureDisruptionBudget(ctx, svc, "router", nil); err != nil {
+		t.Fatal(err)
+	}
+	key := client.ObjectKey{Namespace: "shop", Name: "buffer-service-router-checkout"}
+	if err := c.Get(ctx, key, &policyv1.PodDisruptionBudget{}); !apierrors.IsNotFound(err) {
+		t.Errorf("budget kept once minAvailable is unset: %v", err)
+	}
+	if r.Inventory.Has(client.ObjectKeyFromObject(svc), "PodDisruptionBudget", "shop", key.Name) {
+		t.Error("budget kept in the inventory once minAvailable is unset")
+	}
+}
@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	engineTokenKey  = "token"
+	engineAPIKeyKey = "apiKey"
+)
+
+// engineCredential is the header authenticating the operator to the decision
+// engine. The zero value sends nothing.
+type engineCredential struct {
+	header string
+	value  string
+}
+
+func (c engineCredential) apply(req *http.Request) {
+	if c.header != "" {
+		req.Header.Set(c.header, c.value)
+	}
+}
+
+// outgoing returns ctx carrying the credential as gRPC metadata.
+func (c engineCredential) outgoing(ctx context.Context) context.Context {
+	if c.header == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, strings.ToLower(c.header), c.value)
+}
+
+// engineCredentialFor reads the credential of ts from spec.scheduler.auth. The
+// Secret is read uncached, so the operator does not watch every Secret in the
+// cluster. Missing Secrets and keys are retried like missing dependencies, so
+// creating or fixing the Secret is enough.
+func (r *TrafficScheduleReconciler) engineCredentialFor(ctx context.Context, ts *schedulingv1alpha1.TrafficSchedule) (engineCredential, error) {
+	auth := ts.Spec.Scheduler.Auth
+	if auth == nil {
+		return engineCredential{}, nil
+	}
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+	var secret corev1.Secret
+	if err := reader.Get(ctx, client.ObjectKey{Namespace: ts.Namespace, Name: auth.SecretRef.Name}, &secret); err != nil {
+		return engineCredential{}, fmt.Errorf("decision engine secret %s/%s: %w", ts.Namespace, auth.SecretRef.Name, err)
+	}
+	if token := strings.TrimSpace(string(secret.Data[engineTokenKey])); token != "" {
+		return engineCredential{header: "Authorization", value: "Bearer " + token}, nil
+	}
+	if apiKey := strings.TrimSpace(string(secret.Data[engineAPIKeyKey])); apiKey != "" {
+		return engineCredential{header: "X-API-Key", value: apiKey}, nil
+	}
+	return engineCredential{}, dependencyMissingError(fmt.Errorf("decision engine secret %s/%s has no %q or %q key",
+		ts.Namespace, auth.SecretRef.Name, engineTokenKey, engineAPIKeyKey))
+}
+
+// credentialsRejected turns the 401 and 403 answers of the decision engine
+// into errors retried at a fixed interval, so a rotated Secret is picked up.
+func credentialsRejected(resp *http.Response) error {
+	if resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+		return nil
+	}
+	return dependencyMissingError(fmt.Errorf("decision engine rejected the credentials: %s", resp.Status))
+}
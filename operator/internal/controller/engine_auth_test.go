@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestEngineCredentialFor(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	secret := func(name string, data map[string]string) *corev1.Secret {
+		s := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "ops", Name: name}, Data: map[string][]byte{}}
+		for key, value := range data {
+			s.Data[key] = []byte(value)
+		}
+		return s
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		secret("both", map[string]string{engineTokenKey: " t0ken\n", engineAPIKeyKey: "key"}),
+		secret("api-key", map[string]string{engineTokenKey: "  ", engineAPIKeyKey: "key"}),
+		secret("empty", nil),
+	).Build()
+	r := &TrafficScheduleReconciler{Client: c, Scheme: scheme}
+	withAuth := func(name string) *schedulingv1alpha1.TrafficSchedule {
+		ts := &schedulingv1alpha1.TrafficSchedule{ObjectMeta: metav1.ObjectMeta{Namespace: "ops", Name: "default"}}
+		if name != "" {
+			ts.Spec.Scheduler.Auth = &schedulingv1alpha1.EngineAuthConfig{SecretRef: corev1.LocalObjectReference{Name: name}}
+		}
+		return ts
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		secret string
+		want   engineCredential
+	}{
+		{secret: ""},
+		{secret: "both", want: engineCredential{header: "Authorization", value: "Bearer t0ken"}},
+		{secret: "api-key", want: engineCredential{header: "X-API-Key", value: "key"}},
+	}
+	for _, tt := range tests {
+		got, err := r.engineCredentialFor(ctx, withAuth(tt.secret))
+		if err != nil || got != tt.want {
+			t.Errorf("secret %q: got %+v, %v, want %+v", tt.secret, got, err, tt.want)
+		}
+	}
+
+	if _, err := r.engineCredentialFor(ctx, withAuth("empty")); classify(err) != failureDependencyMissing {
+		t.Errorf("no key: got %v, want a missing dependency", err)
+	}
+	_, err := r.engineCredentialFor(ctx, withAuth("missing"))
+	if !apierrors.IsNotFound(err) || classify(err) != failureDependencyMissing {
+		t.Errorf("missing Secret: got %v, want a missing dependency", err)
+	}
+}
+
+func TestEngineCredentialHeaders(t *testing.T) {
+	credential := engineCredential{header: "X-API-Key", value: "key"}
+	req, _ := http.NewRequest(http.MethodGet, "http://engine/schedules/ops/default", nil)
+	credential.apply(req)
+	if got := req.Header.Get("X-API-Key"); got != "key" {
+		t.Errorf("got header %q, want the API key", got)
+	}
+	md, _ := metadata.FromOutgoingContext(credential.outgoing(context.Background()))
+	if got := md.Get("x-api-key"); len(got) != 1 || got[0] != "key" {
+		t.Errorf("got metadata %v, want the API key", md)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "http://engine/schedules/ops/default", nil)
+	engineCredential{}.apply(req)
+	if len(req.Header) != 0 {
+		t.Errorf("zero credential: got headers %v", req.Header)
+	}
+	if _, ok := metadata.FromOutgoingContext(engineCredential{}.outgoing(context.Background())); ok {
+		t.Error("zero credential: got outgoing metadata")
+	}
+}
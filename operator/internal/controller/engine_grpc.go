@@ -0,0 +1,278 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/engine"
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/enginepb"
+)
+
+const (
+	// DefaultEngineGRPCAddress is the gRPC endpoint of the decision engine service.
+	DefaultEngineGRPCAddress = "carbonrouter-decision-engine.carbonrouter-system.svc.cluster.local:50051"
+	// streamRetryInterval is the wait before reopening a broken schedule stream.
+	streamRetryInterval = 5 * time.Second
+	// streamResyncInterval requeues streamed schedules in case a stream goes
+	// silent without breaking.
+	streamResyncInterval = 10 * time.Minute
+)
+
+// ScheduleStreams talks to the decision engine over gRPC. It keeps a
+// WatchSchedule stream open per TrafficSchedule and enqueues the schedule
+// whenever a new decision arrives, so schedules are not polled.
+type ScheduleStreams struct {
+	client enginepb.DecisionEngineClient
+	// secure is false on plaintext connections, which never carry credentials.
+	secure bool
+	events chan event.GenericEvent
+
+	mu      sync.Mutex
+	ctx     context.Context
+	streams map[types.NamespacedName]*scheduleStream
+}
+
+type scheduleStream struct {
+	cancel     context.CancelFunc
+	credential engineCredential
+	latest     *engine.Schedule
+}
+
+// NewScheduleStreams returns ScheduleStreams using client, connected over TLS
+// when secure. It must be added to the manager, which bounds the lifetime of
+// the streams.
+func NewScheduleStreams(client enginepb.DecisionEngineClient, secure bool) *ScheduleStreams {
+	return &ScheduleStreams{
+		client:  client,
+		secure:  secure,
+		events:  make(chan event.GenericEvent, 64),
+		streams: map[types.NamespacedName]*scheduleStream{},
+	}
+}
+
+// Start implements manager.Runnable.
+func (s *ScheduleStreams) Start(ctx context.Context) error {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+	<-ctx.Done()
+	return nil
+}
+
+// EngineGRPCCredentials returns the transport credentials of the decision
+// engine connection: TLS with the CA bundle and client certificate of opts
+// when either is set, plaintext otherwise. secure reports which.
+func EngineGRPCCredentials(opts EngineHTTPOptions) (creds credentials.TransportCredentials, secure bool, err error) {
+	if opts.CAFile == "" && opts.ClientCert == nil {
+		return insecure.NewCredentials(), false, nil
+	}
+	tlsConfig, err := engineTLSConfig(opts)
+	if err != nil {
+		return nil, false, err
+	}
+	return credentials.NewTLS(tlsConfig), true, nil
+}
+
+// errEngineCredentialsInsecure refuses to send the engine credentials of a
+// schedule in plaintext.
+var errEngineCredentialsInsecure = errors.New("spec.scheduler.auth needs a TLS connection to the gRPC decision engine, set --engine-ca-file or --engine-cert-path")
+
+// outgoing returns ctx carrying credential, which is refused on a plaintext
+// connection.
+func (s *ScheduleStreams) outgoing(ctx context.Context, credential engineCredential) (context.Context, error) {
+	if credential.header != "" && !s.secure {
+		return nil, invalidConfigError(errEngineCredentialsInsecure)
+	}
+	return credential.outgoing(ctx), nil
+}
+
+func scheduleRef(key types.NamespacedName) *enginepb.ScheduleRef {
+	return &enginepb.ScheduleRef{Namespace: key.Namespace, Name: key.Name}
+}
+
+// PutConfig pushes the scheduler payload of a schedule with credential.
+// Payloads the engine rejects as invalid arguments, the gRPC 400, are reported
+// as invalid configuration, and rejected credentials as a missing dependency;
+// the other errors are retried.
+func (s *ScheduleStreams) PutConfig(ctx context.Context, key types.NamespacedName, credential engineCredential, payload []byte) error {
+	var cfg structpb.Struct
+	if err := protojson.Unmarshal(payload, &cfg); err != nil {
+		return err
+	}
+	ctx, err := s.outgoing(ctx, credential)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.PutConfig(ctx, &enginepb.PutConfigRequest{Schedule: scheduleRef(key), Config: &cfg})
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		return invalidConfigError(err)
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return dependencyMissingError(fmt.Errorf("decision engine rejected the credentials: %w", err))
+	}
+	return err
+}
+
+// Schedule returns the last decision streamed for key, and asks the engine
+// with credential until the stream delivers one. Errors carry the gRPC status
+// of the engine.
+func (s *ScheduleStreams) Schedule(ctx context.Context, key types.NamespacedName, credential engineCredential) (engine.Schedule, error) {
+	ctx, err := s.outgoing(ctx, credential)
+	if err != nil {
+		return engine.Schedule{}, err
+	}
+	s.watch(key, credential)
+	s.mu.Lock()
+	var latest *engine.Schedule
+	if stream := s.streams[key]; stream != nil {
+		latest = stream.latest
+	}
+	s.mu.Unlock()
+	if latest != nil {
+		return *latest, nil
+	}
+	resp, err := s.client.GetSchedule(ctx, &enginepb.GetScheduleRequest{Schedule: scheduleRef(key)})
+	if err != nil {
+		return engine.Schedule{}, err
+	}
+	return scheduleFromProto(resp), nil
+}
+
+// Forget closes the stream of key.
+func (s *ScheduleStreams) Forget(key types.NamespacedName) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stream := s.streams[key]; stream != nil {
+		stream.cancel()
+		delete(s.streams, key)
+	}
+}
+
+// watch opens the stream of key unless it is already open with credential.
+// Rotated credentials reopen it. Schedule has already refused credentials on
+// a plaintext connection.
+func (s *ScheduleStreams) watch(key types.NamespacedName, credential engineCredential) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx == nil {
+		return
+	}
+	if stream, ok := s.streams[key]; ok {
+		if stream.credential == credential {
+			return
+		}
+		stream.cancel()
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.streams[key] = &scheduleStream{cancel: cancel, credential: credential}
+	go s.run(credential.outgoing(ctx), key)
+}
+
+func (s *ScheduleStreams) store(key types.NamespacedName, schedule *engine.Schedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stream := s.streams[key]; stream != nil {
+		stream.latest = schedule
+	}
+}
+
+func (s *ScheduleStreams) enqueue(ctx context.Context, key types.NamespacedName) {
+	obj := &schedulingv1alpha1.TrafficSchedule{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}}
+	select {
+	case s.events <- event.GenericEvent{Object: obj}:
+	case <-ctx.Done():
+	}
+}
+
+// run receives the decisions of key until ctx is done, reopening the stream
+// when it breaks. A broken stream drops the last decision and enqueues the
+// schedule, whose reconcile then falls back to GetSchedule and pushes the
+// configuration again if the engine lost it.
+func (s *ScheduleStreams) run(ctx context.Context, key types.NamespacedName) {
+	log := ctrl.Log.WithName("[ScheduleStreams]").WithValues("schedule", key)
+	for {
+		stream, err := s.client.WatchSchedule(ctx, &enginepb.WatchScheduleRequest{Schedule: scheduleRef(key)})
+		for err == nil {
+			var msg *enginepb.Schedule
+			if msg, err = stream.Recv(); err == nil {
+				schedule := scheduleFromProto(msg)
+				s.store(key, &schedule)
+				s.enqueue(ctx, key)
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Info("Schedule stream interrupted, reopening", "reason", err.Error(), "retryIn", streamRetryInterval)
+		s.store(key, nil)
+		s.enqueue(ctx, key)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(streamRetryInterval):
+		}
+	}
+}
+
+func scheduleFromProto(msg *enginepb.Schedule) engine.Schedule {
+	out := engine.Schedule{
+		FlavourWeights: make(map[string]int, len(msg.GetFlavourWeights())),
+		ValidUntil:     msg.GetValidUntil(),
+		Credits: engine.Credits{
+			Balance:   msg.GetCredits().GetBalance(),
+			Velocity:  msg.GetCredits().GetVelocity(),
+			Target:    msg.GetCredits().GetTarget(),
+			Min:       msg.GetCredits().GetMin(),
+			Max:       msg.GetCredits().GetMax(),
+			Allowance: msg.GetCredits().GetAllowance(),
+		},
+		Policy:       engine.PolicyRef{Name: msg.GetPolicy().GetName()},
+		Diagnostics:  msg.GetDiagnostics(),
+		AvgPrecision: msg.GetAvgPrecision(),
+		Processing: engine.Processing{
+			Throttle:       msg.GetProcessing().GetThrottle(),
+			CreditsRatio:   msg.GetProcessing().GetCreditsRatio(),
+			IntensityRatio: msg.GetProcessing().GetIntensityRatio(),
+			Ceilings:       msg.GetProcessing().GetCeilings(),
+		},
+		Zones: msg.GetZones(),
+	}
+	for name, weight := range msg.GetFlavourWeights() {
+		out.FlavourWeights[name] = int(weight)
+	}
+	for _, flavour := range msg.GetFlavours() {
+		out.Flavours = append(out.Flavours, engine.FlavourWeight{
+			Name:            flavour.GetName(),
+			Precision:       int(flavour.GetPrecision()),
+			Weight:          int(flavour.GetWeight()),
+			CarbonIntensity: flavour.GetCarbonIntensity(),
+			Enabled:         flavour.GetEnabled(),
+		})
+	}
+	if carbon := msg.GetCarbon(); carbon != nil {
+		if carbon.Now != nil {
+			now := carbon.GetNow()
+			out.Carbon.Now = &now
+		}
+		if carbon.Next != nil {
+			next := carbon.GetNext()
+			out.Carbon.Next = &next
+		}
+	}
+	return out
+}
@@ -0,0 +1,246 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/enginepb"
+)
+
+// fakeEngineClient answers GetSchedule with schedule and streams whatever is
+// sent on the channel of the last WatchSchedule call.
+type fakeEngineClient struct {
+	putErr   error
+	schedule *enginepb.Schedule
+
+	mu      sync.Mutex
+	gets    int
+	watches []chan *enginepb.Schedule
+}
+
+func (f *fakeEngineClient) PutConfig(ctx context.Context, in *enginepb.PutConfigRequest, opts ...grpc.CallOption) (*enginepb.PutConfigResponse, error) {
+	return &enginepb.PutConfigResponse{}, f.putErr
+}
+
+func (f *fakeEngineClient) GetSchedule(ctx context.Context, in *enginepb.GetScheduleRequest, opts ...grpc.CallOption) (*enginepb.Schedule, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.gets++
+	return f.schedule, nil
+}
+
+func (f *fakeEngineClient) WatchSchedule(ctx context.Context, in *enginepb.WatchScheduleRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[enginepb.Schedule], error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan *enginepb.Schedule)
+	f.watches = append(f.watches, ch)
+	return &fakeScheduleStream{ctx: ctx, ch: ch}, nil
+}
+
+// stream waits for the i-th WatchSchedule call, which streams open in the
+// background.
+func (f *fakeEngineClient) stream(t *testing.T, i int) chan *enginepb.Schedule {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		f.mu.Lock()
+		if len(f.watches) > i {
+			defer f.mu.Unlock()
+			return f.watches[i]
+		}
+		f.mu.Unlock()
+	}
+	t.Fatalf("stream %d never opened", i)
+	return nil
+}
+
+func (f *fakeEngineClient) counts() (gets, watches int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.gets, len(f.watches)
+}
+
+type fakeScheduleStream struct {
+	grpc.ClientStream
+	ctx context.Context
+	ch  chan *enginepb.Schedule
+}
+
+func (s *fakeScheduleStream) Recv() (*enginepb.Schedule, error) {
+	select {
+	case msg, ok := <-s.ch:
+		if !ok {
+			return nil, io.EOF
+		}
+		return msg, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+func TestScheduleFromProto(t *testing.T) {
+	got := scheduleFromProto(&enginepb.Schedule{
+		FlavourWeights: map[string]int32{"precision-100": 30, "precision-50": 70},
+		Flavours:       []*enginepb.FlavourWeight{{Name: "precision-50", Precision: 50, Weight: 70, Enabled: true}},
+		Credits:        &enginepb.Credits{Balance: 0.2},
+		Policy:         &enginepb.Policy{Name: "credit-greedy"},
+		Carbon:         &enginepb.Carbon{Now: ptr.To(120.0)},
+	})
+	if got.FlavourWeights["precision-50"] != 70 || len(got.Flavours) != 1 || got.Flavours[0].Precision != 50 || !got.Flavours[0].Enabled {
+		t.Errorf("got weights %v and flavours %v", got.FlavourWeights, got.Flavours)
+	}
+	if got.Credits.Balance != 0.2 || got.Policy.Name != "credit-greedy" {
+		t.Errorf("got credits %v and policy %v", got.Credits, got.Policy)
+	}
+	if got.Carbon.Now == nil || *got.Carbon.Now != 120 || got.Carbon.Next != nil {
+		t.Errorf("got carbon %v, want now only", got.Carbon)
+	}
+	if empty := scheduleFromProto(&enginepb.Schedule{}); empty.FlavourWeights == nil || empty.Carbon.Now != nil {
+		t.Errorf("empty message: got %+v", empty)
+	}
+}
+
+func TestScheduleStreamsPutConfig(t *testing.T) {
+	key := types.NamespacedName{Namespace: "ops", Name: "default"}
+	tests := []struct {
+		code  codes.Code
+		class failureClass
+	}{
+		{code: codes.InvalidArgument, class: failureInvalidConfig},
+		{code: codes.Unauthenticated, class: failureDependencyMissing},
+		{code: codes.PermissionDenied, class: failureDependencyMissing},
+		{code: codes.Unavailable, class: failureTransient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			s := NewScheduleStreams(&fakeEngineClient{putErr: status.Error(tt.code, "no")}, false)
+			err := s.PutConfig(context.Background(), key, engineCredential{}, []byte(`{"targetError": 0.1}`))
+			if status.Code(err) != tt.code || classify(err) != tt.class {
+				t.Errorf("got %v classified %s, want %s", err, classify(err), tt.class)
+			}
+		})
+	}
+	s := NewScheduleStreams(&fakeEngineClient{}, false)
+	if err := s.PutConfig(context.Background(), key, engineCredential{}, []byte("not json")); err == nil {
+		t.Error("malformed payload accepted")
+	}
+}
+
+func TestScheduleStreams(t *testing.T) {
+	key := types.NamespacedName{Namespace: "ops", Name: "default"}
+	engineClient := &fakeEngineClient{schedule: &enginepb.Schedule{FlavourWeights: map[string]int32{"precision-100": 100}}}
+	s := NewScheduleStreams(engineClient, true)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = s.Start(ctx) }()
+	for started := false; !started; {
+		s.mu.Lock()
+		started = s.ctx != nil
+		s.mu.Unlock()
+	}
+	enqueued := func() {
+		t.Helper()
+		select {
+		case e := <-s.events:
+			if e.Object.GetNamespace() != key.Namespace || e.Object.GetName() != key.Name {
+				t.Errorf("got event for %s/%s", e.Object.GetNamespace(), e.Object.GetName())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("schedule not enqueued")
+		}
+	}
+	weight := func(credential engineCredential) int {
+		t.Helper()
+		schedule, err := s.Schedule(ctx, key, credential)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return schedule.FlavourWeights["precision-100"]
+	}
+
+	// Until the stream delivers, the engine is asked
+	if got := weight(engineCredential{}); got != 100 {
+		t.Errorf("got weight %d, want the polled decision", got)
+	}
+	engineClient.stream(t, 0) <- &enginepb.Schedule{FlavourWeights: map[string]int32{"precision-100": 40}}
+	enqueued()
+	if got := weight(engineCredential{}); got != 40 {
+		t.Errorf("got weight %d, want the streamed decision", got)
+	}
+	if gets, watches := engineClient.counts(); gets != 1 || watches != 1 {
+		t.Errorf("got %d polls and %d streams, want 1 and 1", gets, watches)
+	}
+
+	// Rotated credentials reopen the stream
+	rotated := engineCredential{header: "Authorization", value: "Bearer rotated"}
+	if got := weight(rotated); got != 100 {
+		t.Errorf("got weight %d after the rotation, want the polled decision", got)
+	}
+	engineClient.stream(t, 1) <- &enginepb.Schedule{FlavourWeights: map[string]int32{"precision-100": 60}}
+	enqueued()
+	if got := weight(rotated); got != 60 {
+		t.Errorf("got weight %d, want the decision of the reopened stream", got)
+	}
+
+	// A broken stream drops the streamed decision
+	close(engineClient.stream(t, 1))
+	enqueued()
+	if got := weight(rotated); got != 100 {
+		t.Errorf("got weight %d after the stream broke, want the polled decision", got)
+	}
+	if gets, watches := engineClient.counts(); gets != 3 || watches != 2 {
+		t.Errorf("got %d polls and %d streams, want 3 and 2", gets, watches)
+	}
+
+	s.Forget(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.streams) != 0 {
+		t.Errorf("got streams %v after Forget", s.streams)
+	}
+}
+
+func TestScheduleStreamsRefuseCredentialsInPlaintext(t *testing.T) {
+	token := engineCredential{header: "Authorization", value: "Bearer secret"}
+	tests := []struct {
+		name       string
+		secure     bool
+		credential engineCredential
+		refused    bool
+	}{
+		{name: "plaintext without credentials"},
+		{name: "plaintext with credentials", credential: token, refused: true},
+		{name: "tls with credentials", secure: true, credential: token},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScheduleStreams(nil, tt.secure)
+			_, err := s.outgoing(context.Background(), tt.credential)
+			if got := errors.Is(err, errEngineCredentialsInsecure); got != tt.refused {
+				t.Fatalf("refused: got %v (%v), want %v", got, err, tt.refused)
+			}
+			if tt.refused && classify(err) != failureInvalidConfig {
+				t.Errorf("got class %s, want %s", classify(err), failureInvalidConfig)
+			}
+		})
+	}
+}
+
+func TestEngineGRPCCredentials(t *testing.T) {
+	if _, secure, err := EngineGRPCCredentials(EngineHTTPOptions{}); err != nil || secure {
+		t.Errorf("without TLS options: got secure %v, err %v, want plaintext", secure, err)
+	}
+	if _, _, err := EngineGRPCCredentials(EngineHTTPOptions{CAFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Error("unreadable CA bundle accepted")
+	}
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+)
+
+const (
+	// DefaultEngineURL is the HTTP endpoint of the decision engine service.
+	DefaultEngineURL = "http://carbonrouter-decision-engine.carbonrouter-system.svc.cluster.local"
+	// DefaultEngineTimeout bounds a single HTTP call to the decision engine.
+	DefaultEngineTimeout = 5 * time.Second
+)
+
+// EngineHTTPOptions configure the HTTP client of the external decision engine.
+type EngineHTTPOptions struct {
+	// Timeout bounds a single call; zero uses DefaultEngineTimeout.
+	Timeout time.Duration
+	// CAFile is a PEM bundle trusted for https engine URLs on top of the system
+	// roots, typically mounted from a ConfigMap or Secret.
+	CAFile string
+	// ClientCert is presented to engines requiring mutual TLS; optional. The
+	// watcher must be added to the manager to follow certificate rotations.
+	ClientCert *certwatcher.CertWatcher
+}
+
+// NewEngineHTTPClient returns the client used for decision engine calls.
+func NewEngineHTTPClient(opts EngineHTTPOptions) (*http.Client, error) {
+	tlsConfig, err := engineTLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = DefaultEngineTimeout
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// engineTLSConfig returns the TLS configuration of the decision engine
+// clients, trusting the CA bundle of opts and presenting its client
+// certificate.
+func engineTLSConfig(opts EngineHTTPOptions) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read engine CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("engine CA bundle %s holds no PEM certificate", opts.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if opts.ClientCert != nil {
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return opts.ClientCert.GetCertificate(nil)
+		}
+	}
+	return tlsConfig, nil
+}
+
+func (r *TrafficScheduleReconciler) engineURL() string {
+	if r.EngineURL == "" {
+		return DefaultEngineURL
+	}
+	return r.EngineURL
+}
+
+func (r *TrafficScheduleReconciler) engineClient() *http.Client {
+	if r.EngineHTTP == nil {
+		return httpClient
+	}
+	return r.EngineHTTP
+}
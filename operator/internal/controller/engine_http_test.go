@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+)
+
+// writePEM writes blocks of kind to a file of dir and returns its path.
+func writePEM(t *testing.T, dir, name, kind string, blocks ...[]byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	var data []byte
+	for _, block := range blocks {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: block})...)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewEngineHTTPClient(t *testing.T) {
+	var clientCerts int
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		clientCerts = len(req.TLS.PeerCertificates)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	defer server.Close()
+	dir := t.TempDir()
+	serverCert := server.TLS.Certificates[0]
+	caFile := writePEM(t, dir, "ca.pem", "CERTIFICATE", serverCert.Certificate[0])
+
+	get := func(opts EngineHTTPOptions) error {
+		t.Helper()
+		c, err := NewEngineHTTPClient(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := c.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := get(EngineHTTPOptions{}); err == nil {
+		t.Error("engine certificate trusted without the CA bundle")
+	}
+	if err := get(EngineHTTPOptions{CAFile: caFile}); err != nil || clientCerts != 0 {
+		t.Errorf("with the CA bundle: got %v and %d client certificates", err, clientCerts)
+	}
+
+	key, err := x509.MarshalPKCS8PrivateKey(serverCert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	watcher, err := certwatcher.New(
+		writePEM(t, dir, "tls.crt", "CERTIFICATE", serverCert.Certificate...),
+		writePEM(t, dir, "tls.key", "PRIVATE KEY", key),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := get(EngineHTTPOptions{CAFile: caFile, ClientCert: watcher}); err != nil || clientCerts != 1 {
+		t.Errorf("with a client certificate: got %v and %d client certificates", err, clientCerts)
+	}
+
+	c, err := NewEngineHTTPClient(EngineHTTPOptions{})
+	if err != nil || c.Timeout != DefaultEngineTimeout {
+		t.Errorf("got timeout %v (%v), want the default", c.Timeout, err)
+	}
+	c, _ = NewEngineHTTPClient(EngineHTTPOptions{Timeout: time.Second})
+	if c.Timeout != time.Second {
+		t.Errorf("got timeout %v, want 1s", c.Timeout)
+	}
+	if _, err := NewEngineHTTPClient(EngineHTTPOptions{CAFile: writePEM(t, dir, "empty.pem", "CERTIFICATE")}); err == nil {
+		t.Error("CA bundle without certificates accepted")
+	}
+}
+
+func TestEngineEndpoint(t *testing.T) {
+	r := &TrafficScheduleReconciler{}
+	if r.engineURL() != DefaultEngineURL || r.engineClient() != httpClient {
+		t.Errorf("got %s, want the default engine and client", r.engineURL())
+	}
+	custom := &http.Client{}
+	r = &TrafficScheduleReconciler{EngineURL: "https://engine.example", EngineHTTP: custom}
+	if r.engineURL() != "https://engine.example" || r.engineClient() != custom {
+		t.Errorf("got %s, want the configured engine and client", r.engineURL())
+	}
+}
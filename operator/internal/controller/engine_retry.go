@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// conditionEngineAvailable reports the state of the circuit breaker guarding
+// the decision engine.
+const conditionEngineAvailable = "carbonrouter.io/DecisionEngineAvailable"
+
+const (
+	// engineCallAttempts bounds the attempts of one decision engine call.
+	engineCallAttempts = 3
+	// engineBackoffBase is the backoff before the second attempt. It doubles
+	// for every further attempt, up to engineBackoffMax, with full jitter.
+	engineBackoffBase = 250 * time.Millisecond
+	engineBackoffMax  = 2 * time.Second
+	// breakerThreshold is the number of consecutive failed calls that opens the
+	// circuit.
+	breakerThreshold = 5
+	// breakerCooldown is how long the circuit stays open before a trial call.
+	breakerCooldown = 30 * time.Second
+)
+
+// errEngineCircuitOpen is returned instead of calling the decision engine
+// while the circuit is open.
+var errEngineCircuitOpen = errors.New("decision engine circuit open")
+
+type breakerState string
+
+const (
+	breakerClosed   breakerState = "Closed"
+	breakerOpen     breakerState = "Open"
+	breakerHalfOpen breakerState = "HalfOpen"
+)
+
+var (
+	engineCallRetriesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "carbonrouter_engine_call_retries_total",
+		Help: "Decision engine calls retried after a transient failure.",
+	})
+	engineCircuitOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "carbonrouter_engine_circuit_open",
+		Help: "1 while the decision engine circuit breaker is open or half-open.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(engineCallRetriesTotal, engineCircuitOpen)
+}
+
+// engineBreaker is a circuit breaker shared by all schedules, since they talk
+// to the same decision engine. Once open, schedules keep their last published
+// decision until a trial call after the cooldown succeeds.
+type engineBreaker struct {
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	// trial is set while the single call allowed by a half-open circuit runs.
+	trial bool
+}
+
+var decisionEngineBreaker = &engineBreaker{state: breakerClosed}
+
+// allow reports whether a call may go through. A half-open circuit lets a
+// single trial call through at a time.
+func (b *engineBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < breakerCooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		fallthrough
+	case breakerHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+	}
+	return true
+}
+
+// retryIn returns the wait before calls may go through again.
+func (b *engineBreaker) retryIn() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen {
+		if wait := breakerCooldown - time.Since(b.openedAt); wait > 0 {
+			return wait
+		}
+	}
+	return engineBackoffMax
+}
+
+// record updates the breaker with the outcome of a call.
+func (b *engineBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if !failed {
+		b.state, b.failures = breakerClosed, 0
+		engineCircuitOpen.Set(0)
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= breakerThreshold {
+		b.state, b.openedAt = breakerOpen, time.Now()
+		engineCircuitOpen.Set(1)
+	}
+}
+
+// release ends a call without an outcome, such as one cancelled by its caller.
+func (b *engineBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// condition returns the DecisionEngineAvailable condition for the current
+// state of the breaker.
+func (b *engineBreaker) condition() metav1.Condition {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		return metav1.Condition{
+			Type:    conditionEngineAvailable,
+			Status:  metav1.ConditionFalse,
+			Reason:  "CircuitOpen",
+			Message: "decision engine unreachable, serving the last published schedule",
+		}
+	case breakerHalfOpen:
+		return metav1.Condition{
+			Type:    conditionEngineAvailable,
+			Status:  metav1.ConditionUnknown,
+			Reason:  "CircuitHalfOpen",
+			Message: "probing the decision engine",
+		}
+	}
+	return metav1.Condition{
+		Type:    conditionEngineAvailable,
+		Status:  metav1.ConditionTrue,
+		Reason:  "CircuitClosed",
+		Message: "decision engine reachable",
+	}
+}
+
+// engineBackoff returns the wait before retry attempt (1-based), with full
+// jitter so schedules failing together do not retry in lockstep.
+func engineBackoff(attempt int) time.Duration {
+	limit := min(engineBackoffBase<<(attempt-1), engineBackoffMax)
+	return rand.N(limit) + 1
+}
+
+// callEngine runs call through the breaker, retrying transient failures with
+// exponential backoff. Other failures, such as rejected configurations, mean
+// the engine answered and are returned right away.
+func callEngine(ctx context.Context, call func() error) error {
+	if !decisionEngineBreaker.allow() {
+		return errEngineCircuitOpen
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = call(); err == nil || classify(err) != failureTransient || attempt == engineCallAttempts {
+			break
+		}
+		engineCallRetriesTotal.Inc()
+		select {
+		case <-ctx.Done():
+			decisionEngineBreaker.release()
+			return ctx.Err()
+		case <-time.After(engineBackoff(attempt)):
+		}
+	}
+	decisionEngineBreaker.record(err != nil && classify(err) == failureTransient)
+	return err
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEngineBreaker(t *testing.T) {
+	b := &engineBreaker{state: breakerClosed}
+	for i := 1; i < breakerThreshold; i++ {
+		b.record(true)
+	}
+	if !b.allow() || b.state != breakerClosed {
+		t.Fatalf("got state %s after %d failures, want closed", b.state, breakerThreshold-1)
+	}
+	b.record(true)
+	if b.allow() || b.condition().Reason != "CircuitOpen" {
+		t.Fatalf("got state %s, want open after %d failures", b.state, breakerThreshold)
+	}
+	if wait := b.retryIn(); wait <= 0 || wait > breakerCooldown {
+		t.Errorf("got retry in %v, want the rest of the cooldown", wait)
+	}
+
+	// After the cooldown a single trial goes through, and a failed one opens again
+	b.openedAt = time.Now().Add(-breakerCooldown)
+	if !b.allow() {
+		t.Fatal("trial call refused after the cooldown")
+	}
+	if b.allow() {
+		t.Error("second call let through while the trial runs")
+	}
+	if cond := b.condition(); cond.Status != metav1.ConditionUnknown {
+		t.Errorf("got condition %v, want unknown while half-open", cond)
+	}
+	b.record(true)
+	if b.state != breakerOpen || b.allow() {
+		t.Errorf("got state %s after a failed trial, want open", b.state)
+	}
+
+	// A cancelled trial frees the slot, a successful one closes the circuit
+	b.openedAt = time.Now().Add(-breakerCooldown)
+	b.allow()
+	b.release()
+	if !b.allow() {
+		t.Fatal("trial slot kept after release")
+	}
+	b.record(false)
+	if b.state != breakerClosed || b.failures != 0 || b.condition().Status != metav1.ConditionTrue {
+		t.Errorf("got state %s with %d failures, want closed", b.state, b.failures)
+	}
+}
+
+func TestEngineBackoff(t *testing.T) {
+	for attempt := 1; attempt <= 6; attempt++ {
+		limit := min(engineBackoffBase<<(attempt-1), engineBackoffMax)
+		for range 50 {
+			if got := engineBackoff(attempt); got <= 0 || got > limit {
+				t.Fatalf("attempt %d: got %v, want (0, %v]", attempt, got, limit)
+			}
+		}
+	}
+}
+
+func TestCallEngine(t *testing.T) {
+	saved := decisionEngineBreaker
+	defer func() { decisionEngineBreaker = saved }()
+	decisionEngineBreaker = &engineBreaker{state: breakerClosed}
+	ctx := context.Background()
+	calls := 0
+	failing := func(err error) func() error {
+		return func() error {
+			calls++
+			return err
+		}
+	}
+
+	if err := callEngine(ctx, failing(errors.New("connection refused"))); err == nil || calls != engineCallAttempts {
+		t.Errorf("transient: got %v after %d calls, want %d attempts", err, calls, engineCallAttempts)
+	}
+	if decisionEngineBreaker.failures != 1 {
+		t.Errorf("got %d failures, want the call counted once", decisionEngineBreaker.failures)
+	}
+
+	calls = 0
+	rejected := invalidConfigError(errors.New("unknown policy"))
+	if err := callEngine(ctx, failing(rejected)); !errors.Is(err, rejected) || calls != 1 {
+		t.Errorf("invalid config: got %v after %d calls, want no retry", err, calls)
+	}
+	if decisionEngineBreaker.failures != 0 {
+		t.Error("an answer of the engine was counted as a failure")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := callEngine(cancelled, failing(errors.New("timeout"))); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled: got %v, want the context error", err)
+	}
+
+	decisionEngineBreaker.state, decisionEngineBreaker.openedAt = breakerOpen, time.Now()
+	calls = 0
+	if err := callEngine(ctx, failing(nil)); !errors.Is(err, errEngineCircuitOpen) || calls != 0 {
+		t.Errorf("open circuit: got %v after %d calls, want the engine left alone", err, calls)
+	}
+}
@@ -0,0 +1,238 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/engine"
+)
+
+const (
+	// scheduleEventType is the server-sent event carrying a schedule.
+	scheduleEventType = "schedule"
+	// eventsIdleTimeout drops a subscription that sent neither an event nor a
+	// heartbeat for that long, since the engine sends one every 15 seconds.
+	eventsIdleTimeout = 1 * time.Minute
+	// eventsRetryMax caps the backoff between failed subscriptions, which
+	// starts at streamRetryInterval and doubles.
+	eventsRetryMax = 2 * time.Minute
+)
+
+// ScheduleEvents subscribes to the server-sent schedule events of the HTTP
+// decision engine, one subscription per TrafficSchedule, and enqueues the
+// schedule whenever a new decision arrives. Weight changes then reach the
+// routers within seconds instead of at the next poll. Subscriptions are
+// reopened when they break, and polling goes on meanwhile.
+type ScheduleEvents struct {
+	url    string
+	client *http.Client
+	events chan event.GenericEvent
+
+	mu   sync.Mutex
+	ctx  context.Context
+	subs map[types.NamespacedName]*scheduleSubscription
+}
+
+type scheduleSubscription struct {
+	cancel     context.CancelFunc
+	credential engineCredential
+	latest     *engine.Schedule
+}
+
+// NewScheduleEvents returns ScheduleEvents for the engine at url. The timeout
+// of client is lifted, since subscriptions stay open. It must be added to the
+// manager, which bounds the lifetime of the subscriptions.
+func NewScheduleEvents(url string, client *http.Client) *ScheduleEvents {
+	if url == "" {
+		url = DefaultEngineURL
+	}
+	streaming := *client
+	streaming.Timeout = 0
+	return &ScheduleEvents{
+		url:    strings.TrimRight(url, "/"),
+		client: &streaming,
+		events: make(chan event.GenericEvent, 64),
+		subs:   map[types.NamespacedName]*scheduleSubscription{},
+	}
+}
+
+// Start implements manager.Runnable.
+func (s *ScheduleEvents) Start(ctx context.Context) error {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+	<-ctx.Done()
+	return nil
+}
+
+// watch opens the subscription of key unless it is already open with
+// credential. Rotated credentials reopen it.
+func (s *ScheduleEvents) watch(key types.NamespacedName, credential engineCredential) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx == nil {
+		return
+	}
+	if sub, ok := s.subs[key]; ok {
+		if sub.credential == credential {
+			return
+		}
+		sub.cancel()
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.subs[key] = &scheduleSubscription{cancel: cancel, credential: credential}
+	go s.run(ctx, key, credential)
+}
+
+// latest returns the last decision received for key, unless it has expired.
+func (s *ScheduleEvents) latest(key types.NamespacedName) (engine.Schedule, bool) {
+	if s == nil {
+		return engine.Schedule{}, false
+	}
+	s.mu.Lock()
+	var latest *engine.Schedule
+	if sub := s.subs[key]; sub != nil {
+		latest = sub.latest
+	}
+	s.mu.Unlock()
+	if latest == nil {
+		return engine.Schedule{}, false
+	}
+	validUntil, err := time.Parse(time.RFC3339, latest.ValidUntil)
+	return *latest, err == nil && time.Now().Before(validUntil)
+}
+
+// Forget closes the subscription of key.
+func (s *ScheduleEvents) Forget(key types.NamespacedName) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sub := s.subs[key]; sub != nil {
+		sub.cancel()
+		delete(s.subs, key)
+	}
+}
+
+func (s *ScheduleEvents) store(key types.NamespacedName, schedule *engine.Schedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sub := s.subs[key]; sub != nil {
+		sub.latest = schedule
+	}
+}
+
+func (s *ScheduleEvents) enqueue(ctx context.Context, key types.NamespacedName) {
+	obj := &schedulingv1alpha1.TrafficSchedule{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}}
+	select {
+	case s.events <- event.GenericEvent{Object: obj}:
+	case <-ctx.Done():
+	}
+}
+
+// run receives the decisions of key until ctx is done, resubscribing with a
+// growing backoff when the subscription fails. A broken subscription drops the
+// last decision, so reconciles poll the engine until the next one arrives.
+func (s *ScheduleEvents) run(ctx context.Context, key types.NamespacedName, credential engineCredential) {
+	log := ctrl.Log.WithName("[ScheduleEvents]").WithValues("schedule", key)
+	retryIn := streamRetryInterval
+	for {
+		received, err := s.subscribe(ctx, key, credential)
+		if ctx.Err() != nil {
+			return
+		}
+		if received {
+			retryIn = streamRetryInterval
+		}
+		log.Info("Schedule events interrupted, polling until resubscribed", "reason", err.Error(), "retryIn", retryIn)
+		s.store(key, nil)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryIn):
+		}
+		retryIn = min(2*retryIn, eventsRetryMax)
+	}
+}
+
+// subscribe reads the event stream of key until it breaks, and reports
+// whether any schedule came through.
+func (s *ScheduleEvents) subscribe(ctx context.Context, key types.NamespacedName, credential engineCredential) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// A stream gone silent is as good as broken
+	idle := time.AfterFunc(eventsIdleTimeout, cancel)
+	defer idle.Stop()
+
+	url := fmt.Sprintf("%s/schedule/%s/%s/events", s.url, key.Namespace, key.Name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	credential.apply(req)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if err := credentialsRejected(resp); err != nil {
+		return false, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("decision engine returned %s", resp.Status)
+	}
+
+	received := false
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxPushedScheduleBytes)
+	var eventType string
+	var data strings.Builder
+	for scanner.Scan() {
+		idle.Reset(eventsIdleTimeout)
+		field, value, _ := strings.Cut(scanner.Text(), ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "":
+			// A blank line dispatches the event, a leading colon is a heartbeat
+			if scanner.Text() != "" || data.Len() == 0 {
+				continue
+			}
+			if eventType == "" || eventType == scheduleEventType {
+				var schedule engine.Schedule
+				if err := json.Unmarshal([]byte(data.String()), &schedule); err != nil {
+					return received, fmt.Errorf("invalid schedule event: %w", err)
+				}
+				received = true
+				s.store(key, &schedule)
+				s.enqueue(ctx, key)
+			}
+			eventType = ""
+			data.Reset()
+		case "event":
+			eventType = value
+		case "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return received, err
+	}
+	return received, fmt.Errorf("decision engine closed the event stream")
+}
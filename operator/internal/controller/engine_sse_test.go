@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/engine"
+)
+
+func TestNewScheduleEvents(t *testing.T) {
+	engineHTTP := &http.Client{Timeout: time.Second}
+	s := NewScheduleEvents("http://engine.example/", engineHTTP)
+	if s.url != "http://engine.example" || s.client.Timeout != 0 || engineHTTP.Timeout != time.Second {
+		t.Errorf("got url %s with timeout %v, want the trimmed url without timeout on a copy of the client", s.url, s.client.Timeout)
+	}
+	if s := NewScheduleEvents("", engineHTTP); s.url != DefaultEngineURL {
+		t.Errorf("got url %s, want the default engine", s.url)
+	}
+
+	var none *ScheduleEvents
+	none.watch(types.NamespacedName{}, engineCredential{})
+	if _, ok := none.latest(types.NamespacedName{}); ok {
+		t.Error("nil ScheduleEvents returned a schedule")
+	}
+}
+
+func TestScheduleEventsSubscribe(t *testing.T) {
+	key := types.NamespacedName{Namespace: "ops", Name: "default"}
+	validUntil := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	var stream string
+	var status int
+	var gotAccept, gotKey, gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotAccept, gotKey, gotPath = req.Header.Get("Accept"), req.Header.Get("X-API-Key"), req.URL.Path
+		if status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+		fmt.Fprint(w, stream)
+	}))
+	defer server.Close()
+	s := NewScheduleEvents(server.URL, server.Client())
+	s.subs[key] = &scheduleSubscription{}
+	ctx := context.Background()
+	credential := engineCredential{header: "X-API-Key", value: "key"}
+
+	stream = strings.Join([]string{
+		": heartbeat",
+		"",
+		"event: diagnostics",
+		`data: {"flavourWeights": {"precision-100": 1}}`,
+		"",
+		"event: schedule",
+		`data: {"flavourWeights":`,
+		fmt.Sprintf(`data: {"precision-100": 40, "precision-50": 60}, "validUntil": %q}`, validUntil),
+		"",
+		"",
+	}, "\n")
+	received, err := s.subscribe(ctx, key, credential)
+	if !received || err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Fatalf("got received %v, err %v, want a schedule then the closed stream", received, err)
+	}
+	if gotAccept != "text/event-stream" || gotKey != "key" || gotPath != "/schedule/ops/default/events" {
+		t.Errorf("got Accept %q, key %q on %s", gotAccept, gotKey, gotPath)
+	}
+	latest, ok := s.latest(key)
+	if !ok || latest.FlavourWeights["precision-50"] != 60 || latest.FlavourWeights["precision-100"] != 40 {
+		t.Errorf("got latest %v (%v), want the multi-line schedule event", latest.FlavourWeights, ok)
+	}
+	if len(s.events) != 1 {
+		t.Errorf("got %d enqueued events, want the schedule event only", len(s.events))
+	}
+
+	stream = "data: {not json\n\n"
+	if received, err := s.subscribe(ctx, key, credential); received || err == nil || !strings.Contains(err.Error(), "invalid schedule event") {
+		t.Errorf("invalid event: got received %v, err %v", received, err)
+	}
+	status = http.StatusUnauthorized
+	if _, err := s.subscribe(ctx, key, credential); classify(err) != failureDependencyMissing {
+		t.Errorf("rejected credentials: got %v, want a missing dependency", err)
+	}
+	status = http.StatusNotFound
+	if _, err := s.subscribe(ctx, key, credential); err == nil || classify(err) != failureTransient {
+		t.Errorf("not found: got %v, want a transient failure", err)
+	}
+}
+
+func TestScheduleEventsLatest(t *testing.T) {
+	key := types.NamespacedName{Namespace: "ops", Name: "default"}
+	s := NewScheduleEvents("", &http.Client{})
+	if _, ok := s.latest(key); ok {
+		t.Error("schedule returned without a subscription")
+	}
+	s.subs[key] = &scheduleSubscription{}
+	s.store(key, &engine.Schedule{ValidUntil: time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)})
+	if _, ok := s.latest(key); ok {
+		t.Error("expired schedule returned")
+	}
+	s.store(key, &engine.Schedule{ValidUntil: "soon"})
+	if _, ok := s.latest(key); ok {
+		t.Error("schedule with an unparsable expiry returned")
+	}
+
+	cancelled := false
+	s.subs[key].cancel = func() { cancelled = true }
+	s.Forget(key)
+	if !cancelled || len(s.subs) != 0 {
+		t.Errorf("got cancelled %v with %d subscriptions, want the subscription closed", cancelled, len(s.subs))
+	}
+}
@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// conditionEnrolled reports whether a Service fits the enrollment limits of
+	// its namespace.
+	conditionEnrolled = "carbonrouter.io/Enrolled"
+
+	// maxRoutedServicesAnnotation and maxPrecisionsAnnotation override the
+	// operator-wide enrollment limits for a namespace. Namespaces are managed by
+	// platform admins, so tenants cannot raise their own limits.
+	maxRoutedServicesAnnotation = "carbonrouter.io/max-routed-services"
+	maxPrecisionsAnnotation     = "carbonrouter.io/max-precisions"
+)
+
+// EnrollmentLimits bound the resources fanned out per namespace: every routed
+// Service gets its own router, consumer, VirtualService and ScaledObjects, and
+// every precision its own queues and ScaledObject. Zero means unlimited.
+type EnrollmentLimits struct {
+	// MaxServicesPerNamespace is the number of Services a namespace may route.
+	MaxServicesPerNamespace int
+	// MaxPrecisionsPerService is the number of precisions a Service may register.
+	MaxPrecisionsPerService int
+}
+
+// limitsFor returns the limits of a namespace, with its annotations taking
+// precedence over the operator defaults.
+func (r *FlavourRouterReconciler) limitsFor(ctx context.Context, namespace string) (EnrollmentLimits, error) {
+	limits := r.EnrollmentLimits
+	var ns corev1.Namespace
+	if err := r.Get(ctx, client.ObjectKey{Name: namespace}, &ns); err != nil {
+		return limits, err
+	}
+	for annotation, limit := range map[string]*int{
+		maxRoutedServicesAnnotation: &limits.MaxServicesPerNamespace,
+		maxPrecisionsAnnotation:     &limits.MaxPrecisionsPerService,
+	} {
+		value, ok := ns.Annotations[annotation]
+		if !ok {
+			continue
+		}
+		parsed, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || parsed < 0 {
+			return limits, invalidConfigError(fmt.Errorf("namespace %s: annotation %s=%q is not a non-negative integer", namespace, annotation, value))
+		}
+		*limit = parsed
+	}
+	return limits, nil
+}
+
+// enrollmentRank orders the routed Services of a namespace for the quota.
+// Services already enrolled come first, so lowering a limit or opting in an
+// older Service never evicts a Service that fits; ties go to the oldest.
+func enrollmentRank(services []corev1.Service) {
+	slices.SortStableFunc(services, func(a, b corev1.Service) int {
+		aEnrolled, bEnrolled := controllerutil.ContainsFinalizer(&a, cleanupFinalizer), controllerutil.ContainsFinalizer(&b, cleanupFinalizer)
+		switch {
+		case aEnrolled && !bEnrolled:
+			return -1
+		case bEnrolled && !aEnrolled:
+			return 1
+		}
+		if c := a.CreationTimestamp.Compare(b.CreationTimestamp.Time); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+}
+
+// withinServiceQuota reports whether svc is among the first limit routed
+// Services of its namespace.
+func (r *FlavourRouterReconciler) withinServiceQuota(ctx context.Context, svc *corev1.Service, limit int) (bool, error) {
+	if limit == 0 {
+		return true, nil
+	}
+	services, err := listRoutedServices(ctx, r.Client, client.InNamespace(svc.Namespace))
+	if err != nil {
+		return false, err
+	}
+	enrollmentRank(services)
+	for i := range min(limit, len(services)) {
+		if services[i].Name == svc.Name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// limitPrecisions keeps the highest limit precisions of an ascending list, so a
+// capped Service loses its most degraded flavours first.
+func limitPrecisions(precisions []int, limit int) []int {
+	if limit == 0 || len(precisions) <= limit {
+		return precisions
+	}
+	return precisions[len(precisions)-limit:]
+}
+
+func quotaExceededCondition(limit int) metav1.Condition {
+	return metav1.Condition{
+		Type:    conditionEnrolled,
+		Status:  metav1.ConditionFalse,
+		Reason:  "NamespaceQuotaExceeded",
+		Message: fmt.Sprintf("the namespace already routes %d services, the most allowed", limit),
+	}
+}
+
+func enrolledCondition(registered, limit int) metav1.Condition {
+	if limit > 0 && registered > limit {
+		return metav1.Condition{
+			Type:    conditionEnrolled,
+			Status:  metav1.ConditionTrue,
+			Reason:  "PrecisionsLimited",
+			Message: fmt.Sprintf("routing the highest %d of %d precisions, the most allowed per service", limit, registered),
+		}
+	}
+	return metav1.Condition{
+		Type:    conditionEnrolled,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Enrolled",
+		Message: "within the enrollment limits of the namespace",
+	}
+}
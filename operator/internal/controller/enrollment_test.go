@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func enrollmentScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := schedulingv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return scheme
+}
+
+func TestLimitsFor(t *testing.T) {
+	scheme := enrollmentScheme(t)
+	namespace := func(name string, annotations map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: annotations}}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		namespace("plain", nil),
+		namespace("tenant", map[string]string{maxRoutedServicesAnnotation: " 2 ", maxPrecisionsAnnotation: "0"}),
+		namespace("broken", map[string]string{maxPrecisionsAnnotation: "-1"}),
+	).Build()
+	defaults := EnrollmentLimits{MaxServicesPerNamespace: 10, MaxPrecisionsPerService: 3}
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme, EnrollmentLimits: defaults}
+	ctx := context.Background()
+
+	if got, err := r.limitsFor(ctx, "plain"); err != nil || got != defaults {
+		t.Errorf("plain: got %+v, %v, want the defaults", got, err)
+	}
+	if got, err := r.limitsFor(ctx, "tenant"); err != nil || got != (EnrollmentLimits{MaxServicesPerNamespace: 2}) {
+		t.Errorf("tenant: got %+v, %v, want the annotations", got, err)
+	}
+	if _, err := r.limitsFor(ctx, "broken"); classify(err) != failureInvalidConfig {
+		t.Errorf("broken: got %v, want an invalid configuration", err)
+	}
+	if _, err := r.limitsFor(ctx, "missing"); classify(err) != failureDependencyMissing {
+		t.Errorf("missing: got %v, want a missing dependency", err)
+	}
+}
+
+func TestWithinServiceQuota(t *testing.T) {
+	scheme := enrollmentScheme(t)
+	created := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	service := func(name string, age time.Duration, enrolled bool) *corev1.Service {
+		svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "shop",
+			Name:              name,
+			Labels:            map[string]string{enableLabel: "true"},
+			CreationTimestamp: metav1.NewTime(created.Add(-age)),
+		}}
+		if enrolled {
+			svc.Finalizers = []string{cleanupFinalizer}
+		}
+		return svc
+	}
+	// cart and checkout are the oldest, but orders got its slot first
+	orders := service("orders", time.Hour, true)
+	services := []client.Object{service("checkout", 3*time.Hour, false), service("cart", 3*time.Hour, false), orders, service("search", 2*time.Hour, false)}
+	unrouted := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "legacy", CreationTimestamp: metav1.NewTime(created.Add(-24 * time.Hour))}}
+	other := service("elsewhere", 24*time.Hour, false)
+	other.Namespace = "catalog"
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(append(services, unrouted, other)...).Build()
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme}
+
+	var ranked []corev1.Service
+	for _, obj := range services {
+		ranked = append(ranked, *obj.(*corev1.Service))
+	}
+	enrollmentRank(ranked)
+	var names []string
+	for _, svc := range ranked {
+		names = append(names, svc.Name)
+	}
+	if want := []string{"orders", "cart", "checkout", "search"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got rank %v, want %v", names, want)
+	}
+
+	for _, tt := range []struct {
+		limit int
+		want  []string
+	}{
+		{limit: 0, want: []string{"orders", "cart", "checkout", "search"}},
+		{limit: 2, want: []string{"orders", "cart"}},
+		{limit: 10, want: []string{"orders", "cart", "checkout", "search"}},
+	} {
+		var within []string
+		for _, name := range names {
+			ok, err := r.withinServiceQuota(context.Background(), &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name}}, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok {
+				within = append(within, name)
+			}
+		}
+		if !reflect.DeepEqual(within, tt.want) {
+			t.Errorf("limit %d: got %v, want %v", tt.limit, within, tt.want)
+		}
+	}
+}
+
+func TestLimitPrecisions(t *testing.T) {
+	precisions := []int{30, 50, 80, 100}
+	tests := []struct {
+		limit int
+		want  []int
+	}{
+		{limit: 0, want: precisions},
+		{limit: 4, want: precisions},
+		{limit: 2, want: []int{80, 100}},
+		{limit: 1, want: []int{100}},
+	}
+	for _, tt := range tests {
+		if got := limitPrecisions(precisions, tt.limit); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("limit %d: got %v, want %v", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestEnrolledCondition(t *testing.T) {
+	if cond := enrolledCondition(4, 0); cond.Reason != "Enrolled" || cond.Status != metav1.ConditionTrue {
+		t.Errorf("unlimited: got %v", cond)
+	}
+	if cond := enrolledCondition(4, 4); cond.Reason != "Enrolled" {
+		t.Errorf("at the limit: got %v", cond)
+	}
+	if cond := enrolledCondition(4, 2); cond.Reason != "PrecisionsLimited" || cond.Status != metav1.ConditionTrue {
+		t.Errorf("over the limit: got %v, want enrolled with fewer precisions", cond)
+	}
+	if cond := quotaExceededCondition(2); cond.Status != metav1.ConditionFalse || cond.Reason != "NamespaceQuotaExceeded" {
+		t.Errorf("quota exceeded: got %v", cond)
+	}
+}
@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ConditionReconciled reports whether the last reconciliation of an object went
+// through, and otherwise which class of failure stopped it.
+const ConditionReconciled = "carbonrouter.io/Reconciled"
+
+// dependencyRetryInterval is how often a reconcile waiting on a missing object or
+// CRD looks again. Exponential backoff would soon wait minutes after the
+// dependency shows up.
+const dependencyRetryInterval = 30 * time.Second
+
+// failureClass tells how a reconcile failure is retried.
+type failureClass string
+
+const (
+	// failureTransient is retried with the controller backoff: decision engine
+	// outages, broker hiccups, API server timeouts.
+	failureTransient failureClass = "Transient"
+	// failureInvalidConfig is not retried until the object changes.
+	failureInvalidConfig failureClass = "InvalidConfig"
+	// failureDependencyMissing is retried at a fixed interval: Secrets, issuers
+	// or the Istio and KEDA CRDs.
+	failureDependencyMissing failureClass = "DependencyMissing"
+	// failureConflict is retried right away on a fresh copy of the object.
+	failureConflict failureClass = "Conflict"
+)
+
+var reconcileFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "carbonrouter_reconcile_failures_total",
+	Help: "Reconcile failures by controller and failure class.",
+}, []string{"controller", "class"})
+
+func init() {
+	metrics.Registry.MustRegister(reconcileFailuresTotal)
+}
+
+// classifiedError pins the failure class of an error the API status cannot tell.
+type classifiedError struct {
+	class failureClass
+	err   error
+}
+
+func (e *classifiedError) Error() string { return e.err.Error() }
+
+func (e *classifiedError) Unwrap() error { return e.err }
+
+func invalidConfigError(err error) error {
+	return &classifiedError{class: failureInvalidConfig, err: err}
+}
+
+func dependencyMissingError(err error) error {
+	return &classifiedError{class: failureDependencyMissing, err: err}
+}
+
+// classify returns the class of err. Errors not classified by the operator fall
+// back to their API status, and to transient.
+func classify(err error) failureClass {
+	var classified *classifiedError
+	switch {
+	case errors.As(err, &classified):
+		return classified.class
+	case apierrors.IsConflict(err):
+		return failureConflict
+	case apierrors.IsNotFound(err), meta.IsNoMatchError(err):
+		return failureDependencyMissing
+	case apierrors.IsInvalid(err), apierrors.IsBadRequest(err):
+		return failureInvalidConfig
+	}
+	return failureTransient
+}
+
+// failureResult counts err and turns it into the result of a reconcile.
+func failureResult(controller string, class failureClass, err error) (ctrl.Result, error) {
+	reconcileFailuresTotal.WithLabelValues(controller, string(class)).Inc()
+	switch class {
+	case failureConflict:
+		return ctrl.Result{Requeue: true}, nil
+	case failureDependencyMissing:
+		return ctrl.Result{RequeueAfter: dependencyRetryInterval}, nil
+	case failureInvalidConfig:
+		return ctrl.Result{}, reconcile.TerminalError(err)
+	}
+	return ctrl.Result{}, err
+}
+
+// reconciledCondition builds the Reconciled condition for err, nil meaning
+// success.
+func reconciledCondition(class failureClass, err error) metav1.Condition {
+	if err == nil {
+		return metav1.Condition{
+			Type:    ConditionReconciled,
+			Status:  metav1.ConditionTrue,
+			Reason:  "Succeeded",
+			Message: "reconciled successfully",
+		}
+	}
+	return metav1.Condition{
+		Type:    ConditionReconciled,
+		Status:  metav1.ConditionFalse,
+		Reason:  string(class),
+		Message: err.Error(),
+	}
+}
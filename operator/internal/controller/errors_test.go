@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestClassify(t *testing.T) {
+	resource := schema.GroupResource{Group: "networking.istio.io", Resource: "virtualservices"}
+	tests := []struct {
+		name string
+		err  error
+		want failureClass
+	}{
+		{name: "plain", err: errors.New("connection refused"), want: failureTransient},
+		{name: "conflict", err: apierrors.NewConflict(resource, "checkout", errors.New("stale")), want: failureConflict},
+		{name: "not found", err: apierrors.NewNotFound(resource, "checkout"), want: failureDependencyMissing},
+		{name: "no CRD", err: &meta.NoKindMatchError{GroupKind: schema.GroupKind{Group: "keda.sh", Kind: "ScaledObject"}}, want: failureDependencyMissing},
+		{name: "invalid", err: apierrors.NewInvalid(schema.GroupKind{Kind: "Service"}, "checkout", nil), want: failureInvalidConfig},
+		{name: "bad request", err: apierrors.NewBadRequest("bad"), want: failureInvalidConfig},
+		{name: "timeout", err: apierrors.NewTimeoutError("slow", 1), want: failureTransient},
+		{name: "wrapped", err: fmt.Errorf("ensure: %w", apierrors.NewConflict(resource, "checkout", errors.New("stale"))), want: failureConflict},
+		// the operator's own class wins over the API status
+		{name: "pinned", err: invalidConfigError(fmt.Errorf("ensure: %w", apierrors.NewNotFound(resource, "checkout"))), want: failureInvalidConfig},
+		{name: "pinned dependency", err: dependencyMissingError(errors.New("no issuer")), want: failureDependencyMissing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classify(tt.err); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleFailed(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := schedulingv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	ts := &schedulingv1alpha1.TrafficSchedule{ObjectMeta: metav1.ObjectMeta{Namespace: "ops", Name: "default", Generation: 3}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ts).WithStatusSubresource(ts).Build()
+	r := &TrafficScheduleReconciler{Client: c, Scheme: scheme}
+	ctx := context.Background()
+	reconciled := func() *metav1.Condition {
+		var got schedulingv1alpha1.TrafficSchedule
+		if err := c.Get(ctx, client.ObjectKeyFromObject(ts), &got); err != nil {
+			t.Fatal(err)
+		}
+		return meta.FindStatusCondition(got.Status.Conditions, ConditionReconciled)
+	}
+
+	conflict := apierrors.NewConflict(schema.GroupResource{Resource: "trafficschedules"}, "default", errors.New("stale"))
+	if result, err := r.scheduleFailed(ctx, ts.DeepCopy(), conflict); err != nil || !result.Requeue {
+		t.Errorf("conflict: got %v, %v, want an immediate requeue", result, err)
+	}
+	if cond := reconciled(); cond != nil {
+		t.Errorf("conflict: got condition %v, want none", cond)
+	}
+
+	result, err := r.scheduleFailed(ctx, ts.DeepCopy(), invalidConfigError(errors.New("unknown strategy")))
+	if !errors.Is(err, reconcile.TerminalError(nil)) || result.Requeue || result.RequeueAfter > 0 {
+		t.Errorf("invalid config: got %v, %v, want a terminal error", result, err)
+	}
+	cond := reconciled()
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != string(failureInvalidConfig) || cond.ObservedGeneration != 3 {
+		t.Errorf("got condition %v, want the failure class at generation 3", cond)
+	}
+}
+
+func TestPushSchedulerConfigFailureClass(t *testing.T) {
+	tests := []struct {
+		status int
+		class  failureClass
+	}{
+		{status: http.StatusBadRequest, class: failureInvalidConfig},
+		{status: http.StatusUnprocessableEntity, class: failureInvalidConfig},
+		{status: http.StatusUnauthorized, class: failureDependencyMissing},
+		{status: http.StatusForbidden, class: failureDependencyMissing},
+		{status: http.StatusNotFound, class: failureTransient},
+		{status: http.StatusConflict, class: failureTransient},
+		{status: http.StatusTooManyRequests, class: failureTransient},
+		{status: http.StatusServiceUnavailable, class: failureTransient},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+			r := &TrafficScheduleReconciler{EngineURL: server.URL}
+			err := r.pushSchedulerConfig(context.Background(), engineCredential{}, "shop", "green", []byte("{}"))
+			if err == nil {
+				t.Fatalf("push answered %d did not fail", tt.status)
+			}
+			if got := classify(err); got != tt.class {
+				t.Errorf("got class %s, want %s", got, tt.class)
+			}
+		})
+	}
+}
+
+func TestFailureResult(t *testing.T) {
+	cause := errors.New("boom")
+	tests := []struct {
+		class    failureClass
+		terminal bool
+		requeue  bool
+	}{
+		{class: failureTransient},
+		{class: failureInvalidConfig, terminal: true},
+		{class: failureDependencyMissing, requeue: true},
+		{class: failureConflict, requeue: true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.class), func(t *testing.T) {
+			result, err := failureResult("test", tt.class, cause)
+			if got := errors.Is(err, reconcile.TerminalError(nil)); got != tt.terminal {
+				t.Errorf("terminal: got %v, want %v", got, tt.terminal)
+			}
+			if got := result.Requeue || result.RequeueAfter > 0; got != tt.requeue {
+				t.Errorf("requeue: got %v, want %v", got, tt.requeue)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+// Reasons of the Events recorded on routed Services and TrafficSchedules.
+// Managed resources use Created<Kind> and Updated<Kind>.
+const (
+	eventAppliedSchedule      = "AppliedSchedule"
+	eventCeilingThrottled     = "CeilingThrottled"
+	eventCeilingLifted        = "CeilingLifted"
+	eventEngineUnreachable    = "EngineUnreachable"
+	eventFallbackApplied      = "FallbackApplied"
+	eventKillSwitchEngaged    = "KillSwitchEngaged"
+	eventConfigPushed         = "ConfigPushed"
+	eventReconcileFailed      = "ReconcileFailed"
+	eventRecreationFlapping   = "RecreationFlapping"
+	eventDeletedResources     = "DeletedManagedResources"
+	eventScheduleBound        = "ScheduleBound"
+	eventNamespaceQuotaHit    = "NamespaceQuotaExceeded"
+	eventPrecisionDriftFound  = "PrecisionDrift"
+	eventLazyQueuesApplied    = "LazyQueuesApplied"
+	eventLazyQueuesReverted   = "LazyQueuesReverted"
+	eventBurstReserveReleased = "BurstReserveReleased"
+	eventSLOGuardIntervened   = "SLOGuardIntervened"
+	eventSLOGuardStoodDown    = "SLOGuardStoodDown"
+	eventJobDeferred          = "DeferredForCarbon"
+	eventJobReleased          = "ReleasedForCarbon"
+	eventInvalidDeferral      = "InvalidDeferralSettings"
+)
+
+// recordEvent records an Event on obj. Reconcilers built without a recorder,
+// such as in tests, record nothing.
+func recordEvent(recorder record.EventRecorder, obj runtime.Object, eventType, reason, messageFmt string, args ...interface{}) {
+	if recorder == nil {
+		return
+	}
+	recorder.Eventf(obj, eventType, reason, messageFmt, args...)
+}
+
+// conditionTransitions reports whether setting cond on conditions changes its
+// status, reason or message, so Events are only recorded on transitions.
+func conditionTransitions(conditions []metav1.Condition, cond metav1.Condition) bool {
+	prev := meta.FindStatusCondition(conditions, cond.Type)
+	return prev == nil || prev.Status != cond.Status || prev.Reason != cond.Reason || prev.Message != cond.Message
+}
+
+// recordScheduleChanges records how the status of a schedule moved from old
+// to next: new weights, and replica ceilings imposed or lifted.
+func recordScheduleChanges(recorder record.EventRecorder, ts *schedulingv1alpha1.TrafficSchedule, old, next schedulingv1alpha1.TrafficScheduleStatus) {
+	if weights := formatWeights(next.Flavours); weights != formatWeights(old.Flavours) {
+		recordEvent(recorder, ts, corev1.EventTypeNormal, eventAppliedSchedule,
+			"Applied schedule of policy %s valid until %s: %s", next.ActivePolicy, next.ValidUntil.UTC().Format("15:04:05"), weights)
+	}
+	if maps.Equal(old.EffectiveReplicaCeilings, next.EffectiveReplicaCeilings) {
+		return
+	}
+	if len(next.EffectiveReplicaCeilings) == 0 {
+		recordEvent(recorder, ts, corev1.EventTypeNormal, eventCeilingLifted, "Replica ceilings lifted")
+		return
+	}
+	recordEvent(recorder, ts, corev1.EventTypeNormal, eventCeilingThrottled,
+		"Replica ceilings %s at processing throttle %s", formatCeilings(next.EffectiveReplicaCeilings), next.ProcessingThrottle)
+}
+
+// formatWeights renders weights as "precision-100=60%, precision-50=40%".
+func formatWeights(flavours []schedulingv1alpha1.FlavourDecision) string {
+	parts := make([]string, 0, len(flavours))
+	for _, flavour := range flavours {
+		parts = append(parts, fmt.Sprintf("%s=%d%%", precisionQueueSuffix(flavour.Precision), flavour.Weight))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatCeilings(ceilings map[string]int32) string {
+	parts := make([]string, 0, len(ceilings))
+	for _, component := range slices.Sorted(maps.Keys(ceilings)) {
+		parts = append(parts, fmt.Sprintf("%s=%d", component, ceilings[component]))
+	}
+	return strings.Join(parts, ", ")
+}
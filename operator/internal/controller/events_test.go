@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+// drainEvents returns the Events recorded so far.
+func drainEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case e := <-recorder.Events:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func TestConditionTransitions(t *testing.T) {
+	conditions := []metav1.Condition{{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Fine", Message: "ok"}}
+	tests := []struct {
+		cond metav1.Condition
+		want bool
+	}{
+		{cond: metav1.Condition{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Fine", Message: "ok", ObservedGeneration: 4}},
+		{cond: metav1.Condition{Type: "Ready", Status: metav1.ConditionFalse, Reason: "Fine", Message: "ok"}, want: true},
+		{cond: metav1.Condition{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Other", Message: "ok"}, want: true},
+		{cond: metav1.Condition{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Fine", Message: "changed"}, want: true},
+		{cond: metav1.Condition{Type: "Other", Status: metav1.ConditionTrue}, want: true},
+	}
+	for _, tt := range tests {
+		if got := conditionTransitions(conditions, tt.cond); got != tt.want {
+			t.Errorf("%+v: got %v, want %v", tt.cond, got, tt.want)
+		}
+	}
+}
+
+func TestRecordScheduleChanges(t *testing.T) {
+	ts := &schedulingv1alpha1.TrafficSchedule{ObjectMeta: metav1.ObjectMeta{Namespace: "ops", Name: "default"}}
+	old := schedulingv1alpha1.TrafficScheduleStatus{
+		Flavours: []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 100}, {Precision: 50, Weight: 0}},
+	}
+	next := schedulingv1alpha1.TrafficScheduleStatus{
+		Flavours:                 []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 40}, {Precision: 50, Weight: 60}},
+		ActivePolicy:             "credit-greedy",
+		ValidUntil:               metav1.NewTime(time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)),
+		ProcessingThrottle:       "0.5",
+		EffectiveReplicaCeilings: map[string]int32{"router": 3, "consumer": 2},
+	}
+	recorder := record.NewFakeRecorder(10)
+
+	recordScheduleChanges(recorder, ts, old, next)
+	want := []string{
+		"Normal AppliedSchedule Applied schedule of policy credit-greedy valid until 12:30:00: precision-100=40%, precision-50=60%",
+		"Normal CeilingThrottled Replica ceilings consumer=2, router=3 at processing throttle 0.5",
+	}
+	if got := drainEvents(recorder); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got events %q, want %q", got, want)
+	}
+
+	// Only the expiry moved
+	same := *next.DeepCopy()
+	same.ValidUntil = metav1.NewTime(next.ValidUntil.Add(time.Minute))
+	recordScheduleChanges(recorder, ts, next, same)
+	if got := drainEvents(recorder); len(got) != 0 {
+		t.Errorf("got events %q, want none", got)
+	}
+
+	lifted := *next.DeepCopy()
+	lifted.EffectiveReplicaCeilings = nil
+	recordScheduleChanges(recorder, ts, next, lifted)
+	if got := drainEvents(recorder); len(got) != 1 || got[0] != "Normal CeilingLifted Replica ceilings lifted" {
+		t.Errorf("got events %q, want the ceilings lifted", got)
+	}
+
+	// Reconcilers without a recorder record nothing
+	recordScheduleChanges(nil, ts, old, next)
+}
+
+func TestApplyFallback(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &TrafficScheduleReconciler{Recorder: recorder}
+	expired := time.Now().Add(-time.Hour)
+	ts := &schedulingv1alpha1.TrafficSchedule{}
+	ts.Spec.Scheduler.FallbackGraceSeconds = ptr.To[int32](7200)
+	ts.Status.Flavours = []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 30}, {Precision: 50, Weight: 70}}
+	ts.Status.ValidUntil = metav1.NewTime(expired)
+	ts.Status.LastKnownGood = lastKnownGood(ts.Status)
+
+	if !r.applyFallback(ts) {
+		t.Fatal("fallback not applied to an expired schedule")
+	}
+	if got := drainEvents(recorder); len(got) != 1 {
+		t.Errorf("got events %q, want one as the fallback starts", got)
+	}
+	ts.Status.ValidUntil = metav1.NewTime(expired)
+	r.applyFallback(ts)
+	if got := drainEvents(recorder); len(got) != 0 {
+		t.Errorf("got events %q while the fallback goes on, want none", got)
+	}
+
+	ts.Spec.Scheduler.FallbackGraceSeconds = ptr.To[int32](60)
+	ts.Status.ValidUntil = metav1.NewTime(expired)
+	r.applyFallback(ts)
+	if got := drainEvents(recorder); len(got) != 1 {
+		t.Errorf("got events %q, want one as the grace period ends", got)
+	}
+
+	ts.Status.ValidUntil = metav1.NewTime(time.Now().Add(time.Hour))
+	if r.applyFallback(ts) {
+		t.Error("fallback applied to a valid schedule")
+	}
+}
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// cleanupFinalizer keeps an opted-in Service around until its managed
+	// resources, including cluster-scoped RBAC and broker queues, are removed.
+	cleanupFinalizer = "carbonrouter.io/cleanup"
+)
+
+// ensureFinalizer adds the cleanup finalizer to an opted-in Service.
+func (r *FlavourRouterReconciler) ensureFinalizer(ctx context.Context, svc *corev1.Service) error {
+	if controllerutil.ContainsFinalizer(svc, cleanupFinalizer) {
+		return nil
+	}
+	controllerutil.AddFinalizer(svc, cleanupFinalizer)
+	return r.Update(ctx, svc)
+}
+
+// finalize tears down everything created for the Service and then releases it.
+// The finalizer is kept while any Kubernetes resource fails to delete, so the
+// cleanup is retried instead of leaking cross-scope objects.
+func (r *FlavourRouterReconciler) finalize(ctx context.Context, svc *corev1.Service) error {
+	if err := r.cleanupResources(ctx, svc); err != nil {
+		return err
+	}
+	if !controllerutil.ContainsFinalizer(svc, cleanupFinalizer) {
+		return nil
+	}
+	controllerutil.RemoveFinalizer(svc, cleanupFinalizer)
+	return r.Update(ctx, svc)
+}
+
+// deleteServiceQueues removes the broker exchanges, the direct queue and the
+// buffered queues of bufferedTypes of each precision, the dead-letter queue and
+// the policies of a Service through the RabbitMQ management API. Failures are
+// reported but do not block the cleanup: an unreachable broker must not pin the
+// Service forever.
+func deleteServiceQueues(ctx context.Context, broker brokerEndpoint, namespace, service string, precisions []int, bufferedTypes []string) error {
+	var errs []error
+	del := func(kind, name string) {
+		req, err := broker.managementRequest(ctx, http.MethodDelete, broker.managementPath(kind, name), nil)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode != http.StatusNotFound {
+			errs = append(errs, fmt.Errorf("delete %s %s: %s", kind, name, resp.Status))
+		}
+	}
+
+	for _, precision := range precisions {
+		del("queues", broker.Naming.directQueue(namespace, service, precision))
+		for _, queueType := range bufferedTypes {
+			del("queues", broker.Naming.queueName(namespace, service, queueType, precision))
+		}
+	}
+	del("queues", deadLetterQueue(broker.Naming, namespace, service))
+	del("exchanges", broker.Naming.exchangeName(namespace, service))
+	del("exchanges", deadLetterExchange(broker.Naming, namespace, service))
+	del("policies", lazyQueuesPolicyName(namespace, service))
+	del("policies", topologyPolicyName(namespace, service))
+	return errors.Join(errs...)
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+func TestEnsureFinalizer(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout"}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(svc).Build()
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := r.ensureFinalizer(ctx, svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got corev1.Service
+	if err := c.Get(ctx, client.ObjectKeyFromObject(svc), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Finalizers) != 1 || !controllerutil.ContainsFinalizer(&got, cleanupFinalizer) {
+		t.Errorf("got finalizers %v, want %s once", got.Finalizers, cleanupFinalizer)
+	}
+}
+
+func TestDeleteServiceQueues(t *testing.T) {
+	var deleted []string
+	redirectAdmin(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodDelete {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		deleted = append(deleted, req.URL.EscapedPath())
+		switch {
+		case strings.HasSuffix(req.URL.Path, deadLetterQueueSuffix):
+			http.Error(w, "not found", http.StatusNotFound)
+		case strings.HasPrefix(req.URL.Path, "/api/policies/"):
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+
+	broker := brokerEndpoint{Host: "rabbitmq", VHost: "/", Naming: queueNaming{queue: defaultQueueNameTemplate, exchange: defaultExchangeNameTemplate}}
+	err := deleteServiceQueues(context.Background(), broker, "shop", "checkout", []int{100, 50}, []string{"queue", "queue-low"})
+	if err == nil || strings.Count(err.Error(), "503") != 2 {
+		t.Errorf("got %v, want both policy failures and nothing for the missing dead-letter queue", err)
+	}
+
+	sort.Strings(deleted)
+	kinds := map[string]int{}
+	for _, path := range deleted {
+		if !strings.HasPrefix(path, "/api/") || !strings.Contains(path, "/%2F/") {
+			t.Errorf("got path %s, want the escaped vhost under /api", path)
+		}
+		kinds[strings.Split(path, "/")[2]]++
+	}
+	// A direct and two buffered queues per precision, plus the dead-letter queue
+	if kinds["queues"] != 7 || kinds["exchanges"] != 2 || kinds["policies"] != 2 {
+		t.Errorf("got deletions %v, want 7 queues, 2 exchanges and 2 policies: %v", kinds, deleted)
+	}
+}
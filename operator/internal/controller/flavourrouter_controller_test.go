@@ -17,7 +17,25 @@ limitations under the License.
 package controller
 
 import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	kedav1alpha1 "github.com/kedacore/keda/v2/apis/keda/v1alpha1"
 	. "github.com/onsi/ginkgo/v2"
+	networkingapi "istio.io/api/networking/v1alpha3"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
 )
 
 var _ = Describe("FlavourRouter Controller", func() {
@@ -30,3 +48,419 @@ var _ = Describe("FlavourRouter Controller", func() {
 		})
 	})
 })
+
+func TestRoundPercentages(t *testing.T) {
+	tests := []struct {
+		name   string
+		shares []float64
+		want   []int
+	}{
+		{name: "empty", shares: nil, want: []int{}},
+		{name: "exact", shares: []float64{30, 70}, want: []int{30, 70}},
+		{name: "largest remainder first", shares: []float64{1, 1, 1}, want: []int{34, 33, 33}},
+		{name: "unnormalised", shares: []float64{1, 2}, want: []int{33, 67}},
+		{name: "zero total splits evenly", shares: []float64{0, 0, 0, 0}, want: []int{25, 25, 25, 25}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := roundPercentages(tt.shares); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildWeightedRoute(t *testing.T) {
+	host := "checkout.shop.svc.cluster.local"
+	weights := func(route *networkingapi.HTTPRoute) map[string]int32 {
+		out := map[string]int32{}
+		for _, dest := range route.Route {
+			if dest.Destination.Host != host {
+				t.Errorf("destination %s, want %s", dest.Destination.Host, host)
+			}
+			out[dest.Destination.Subset] = dest.Weight
+		}
+		return out
+	}
+	tests := []struct {
+		name       string
+		flavours   []schedulingv1alpha1.FlavourDecision
+		precisions []int
+		want       map[string]int32
+	}{
+		{name: "schedule weights", precisions: []int{100, 50},
+			flavours: []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 40}, {Precision: 50, Weight: 60}},
+			want:     map[string]int32{"precision-100": 40, "precision-50": 60}},
+		{name: "weights of missing precisions are spread over the deployed ones", precisions: []int{100, 50},
+			flavours: []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 20}, {Precision: 50, Weight: 20}, {Precision: 30, Weight: 60}},
+			want:     map[string]int32{"precision-100": 50, "precision-50": 50}},
+		{name: "zero-weight precisions are left out", precisions: []int{100, 50},
+			flavours: []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 100}},
+			want:     map[string]int32{"precision-100": 100}},
+		{name: "no decision yet splits evenly", precisions: []int{100, 50},
+			want: map[string]int32{"precision-100": 50, "precision-50": 50}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := buildWeightedRoute(host, tt.flavours, tt.precisions)
+			if route.Name != "carbonrouter-default" || len(route.Match) != 0 {
+				t.Errorf("got route %q with matches %v, want the catch-all default route", route.Name, route.Match)
+			}
+			if got := weights(route); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// scaledObjectRecorder returns a reconciler whose applied ScaledObjects are
+// kept by name.
+func scaledObjectRecorder(t *testing.T) (*FlavourRouterReconciler, map[string]*kedav1alpha1.ScaledObject) {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := kedav1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	applied := map[string]*kedav1alpha1.ScaledObject{}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			applied[obj.GetName()] = obj.(*kedav1alpha1.ScaledObject).DeepCopy()
+			return nil
+		},
+	}).Build()
+	return &FlavourRouterReconciler{Client: c, Scheme: scheme, Inventory: NewResourceInventory()}, applied
+}
+
+func TestEnsurePrecisionScaledObjectIdle(t *testing.T) {
+	r, applied := scaledObjectRecorder(t)
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout", UID: "checkout"}}
+	autoscaling := schedulingv1alpha1.AutoscalingConfig{MinReplicaCount: ptr.To[int32](2), MaxReplicaCount: ptr.To[int32](10), CPUUtilization: ptr.To[int32](70)}
+	naming := queueNaming{queue: defaultQueueNameTemplate, exchange: defaultExchangeNameTemplate}
+	broker := rabbitMQBackend{}
+	flavours := []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 100}, {Precision: 50, Weight: 0}}
+	ctx := context.Background()
+
+	tests := []struct {
+		precision   int
+		direct      bool
+		minReplicas int32
+		// activations of the queue triggers, in order
+		activations []string
+	}{
+		{precision: 100, minReplicas: 2, activations: []string{""}},
+		{precision: 50, minReplicas: 0, activations: []string{"0"}},
+		{precision: 30, direct: true, minReplicas: 0, activations: []string{"0", "0"}},
+	}
+	for _, tt := range tests {
+		idle := precisionWeight(flavours, tt.precision) == 0
+		if err := r.ensurePrecisionScaledObject(ctx, svc, tt.precision, "checkout-deploy", autoscaling, nil, 20, nil, naming, broker, idle, tt.direct, nil); err != nil {
+			t.Fatal(err)
+		}
+		so := applied[fmt.Sprintf("checkout-precision-%d", tt.precision)]
+		if so == nil {
+			t.Fatalf("precision %d: no ScaledObject applied", tt.precision)
+		}
+		if *so.Spec.MinReplicaCount != tt.minReplicas {
+			t.Errorf("precision %d: got min replicas %d, want %d", tt.precision, *so.Spec.MinReplicaCount, tt.minReplicas)
+		}
+		var activations []string
+		for _, trigger := range so.Spec.Triggers {
+			if trigger.Type == "rabbitmq" {
+				activations = append(activations, trigger.Metadata["activationValue"])
+			}
+		}
+		if !reflect.DeepEqual(activations, tt.activations) {
+			t.Errorf("precision %d: got queue activations %q, want %q", tt.precision, activations, tt.activations)
+		}
+	}
+	if direct := applied["checkout-precision-30"].Spec.Triggers[3].Metadata["queueName"]; direct != naming.directQueue("shop", "checkout", 30) {
+		t.Errorf("got last queue %s, want the direct queue", direct)
+	}
+	// Scale to zero leaves the configured autoscaling alone
+	if *autoscaling.MinReplicaCount != 2 {
+		t.Errorf("configured minimum changed to %d", *autoscaling.MinReplicaCount)
+	}
+}
+
+func TestEnsureConsumerScaledObjectTriggers(t *testing.T) {
+	r, applied := scaledObjectRecorder(t)
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout", UID: "checkout"}}
+	naming := queueNaming{queue: defaultQueueNameTemplate, exchange: defaultExchangeNameTemplate}
+	buffer := schedulingv1alpha1.BufferConfig{QueueLengthTarget: ptr.To[int32](200)}
+	ctx := context.Background()
+	thresholds := func(so *kedav1alpha1.ScaledObject) (queue, rate string) {
+		for _, trigger := range so.Spec.Triggers {
+			switch {
+			case trigger.Type == "rabbitmq":
+				queue = trigger.Metadata["value"]
+			case trigger.Type == "prometheus" && trigger.Metadata["activationThreshold"] != "":
+				rate = trigger.Metadata["threshold"]
+			}
+		}
+		return queue, rate
+	}
+
+	defaults := schedulingv1alpha1.AutoscalingConfig{CPUUtilization: ptr.To[int32](70)}
+	if err := r.ensureConsumerScaledObject(ctx, svc, defaults, []int{100}, nil, buffer, naming, rabbitMQBackend{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	so := applied["buffer-service-consumer-checkout"]
+	if queue, rate := thresholds(so); *so.Spec.PollingInterval != defaultPollingInterval || queue != "200" || rate != "500" {
+		t.Errorf("defaults: got polling %d, queue target %s and rate %s, want 5, the buffer target and 500", *so.Spec.PollingInterval, queue, rate)
+	}
+
+	tuned := schedulingv1alpha1.AutoscalingConfig{
+		CPUUtilization: ptr.To[int32](70), PollingInterval: ptr.To[int32](15), QueueLengthTarget: ptr.To[int32](40), RequestRateThreshold: ptr.To[int32](120),
+	}
+	if err := r.ensureConsumerScaledObject(ctx, svc, tuned, []int{100}, nil, buffer, naming, rabbitMQBackend{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	so = applied["buffer-service-consumer-checkout"]
+	if queue, rate := thresholds(so); *so.Spec.PollingInterval != 15 || queue != "40" || rate != "120" {
+		t.Errorf("tuned: got polling %d, queue target %s and rate %s, want 15, 40 and 120", *so.Spec.PollingInterval, queue, rate)
+	}
+}
+
+// deploymentRecorder returns a reconciler recording the buffer service
+// Deployments it applies. The other objects applied are created as they are.
+func deploymentRecorder(t *testing.T) (*FlavourRouterReconciler, map[string]*appsv1.Deployment) {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	applied := map[string]*appsv1.Deployment{}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if dep, ok := obj.(*appsv1.Deployment); ok {
+				applied[dep.Name] = dep.DeepCopy()
+				return nil
+			}
+			obj.SetResourceVersion("")
+			return c.Create(ctx, obj)
+		},
+	}).Build()
+	return &FlavourRouterReconciler{Client: c, Scheme: scheme, Inventory: NewResourceInventory()}, applied
+}
+
+// queuedSchedule is a TrafficSchedule buffering through RabbitMQ.
+func queuedSchedule() *schedulingv1alpha1.TrafficSchedule {
+	return &schedulingv1alpha1.TrafficSchedule{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "green"},
+		Spec: schedulingv1alpha1.TrafficScheduleSpec{
+			Broker: schedulingv1alpha1.BrokerConfig{SecretRef: &corev1.LocalObjectReference{Name: "rabbitmq-credentials"}},
+		},
+	}
+}
+
+func TestBufferServiceDeploymentSidecar(t *testing.T) {
+	r, applied := deploymentRecorder(t)
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout", UID: "checkout"}}
+	ctx := context.Background()
+
+	tests := []struct {
+		name          string
+		component     string
+		sidecar       schedulingv1alpha1.SidecarConfig
+		brokerless    bool
+		flagRevision  string
+		wantInject    string
+		wantRevision  string
+		revisionLabel bool
+	}{
+		{name: "consumer", component: "consumer", flagRevision: "default", wantInject: "true", wantRevision: "default", revisionLabel: true},
+		{name: "schedule revision", component: "consumer", sidecar: schedulingv1alpha1.SidecarConfig{Revision: "canary"}, flagRevision: "default",
+			wantInject: "true", wantRevision: "canary", revisionLabel: true},
+		{name: "no revision", component: "consumer", wantInject: "true"},
+		{name: "not injected", component: "consumer", sidecar: schedulingv1alpha1.SidecarConfig{Revision: "canary", Inject: ptr.To(false)}, flagRevision: "default",
+			wantInject: "false"},
+		{name: "router", component: "router", flagRevision: "default"},
+		{name: "router without a broker", component: "router", brokerless: true, flagRevision: "default", wantInject: "true", wantRevision: "default", revisionLabel: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r.IstioRevision = tt.flagRevision
+			ts := queuedSchedule()
+			ts.Spec.Routing.Sidecar = tt.sidecar
+			if tt.brokerless {
+				ts.Spec.Broker = schedulingv1alpha1.BrokerConfig{Type: brokerTypeNone}
+			}
+			if err := r.ensureBufferServiceDeployment(ctx, svc, tt.component, ts, nil); err != nil {
+				t.Fatal(err)
+			}
+			template := applied["buffer-service-"+tt.component+"-checkout"].Spec.Template
+			if got := template.Annotations["sidecar.istio.io/inject"]; got != tt.wantInject {
+				t.Errorf("got inject annotation %q, want %q", got, tt.wantInject)
+			}
+			if got, ok := template.Labels["istio.io/rev"]; got != tt.wantRevision || ok != tt.revisionLabel {
+				t.Errorf("got revision label %q (set: %v), want %q (set: %v)", got, ok, tt.wantRevision, tt.revisionLabel)
+			}
+			if template.Labels[parentServiceLabel] != "checkout" {
+				t.Errorf("got pod labels %v, want the common labels kept", template.Labels)
+			}
+		})
+	}
+	if _, ok := applied["buffer-service-router-checkout"].Labels["istio.io/rev"]; ok {
+		t.Error("revision label set on the Deployment itself, want the pods only")
+	}
+}
+
+func TestBufferServiceImage(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        schedulingv1alpha1.ImageConfig
+		wantImage  string
+		wantPolicy corev1.PullPolicy
+	}{
+		{name: "default", wantImage: defaultImageRepository + "/buffer-service-router:latest", wantPolicy: corev1.PullAlways},
+		{name: "tag", cfg: schedulingv1alpha1.ImageConfig{Tag: "v1.4.0"},
+			wantImage: defaultImageRepository + "/buffer-service-router:v1.4.0", wantPolicy: corev1.PullIfNotPresent},
+		{name: "mirror", cfg: schedulingv1alpha1.ImageConfig{Repository: "registry.internal/carbonrouter/router", Tag: "v1.4.0"},
+			wantImage: "registry.internal/carbonrouter/router:v1.4.0", wantPolicy: corev1.PullIfNotPresent},
+		{name: "digest wins over the tag", cfg: schedulingv1alpha1.ImageConfig{Tag: "latest", Digest: "sha256:abc"},
+			wantImage: defaultImageRepository + "/buffer-service-router@sha256:abc", wantPolicy: corev1.PullIfNotPresent},
+		{name: "explicit policy", cfg: schedulingv1alpha1.ImageConfig{PullPolicy: corev1.PullNever},
+			wantImage: defaultImageRepository + "/buffer-service-router:latest", wantPolicy: corev1.PullNever},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image, policy := bufferServiceImage("router", tt.cfg)
+			if image != tt.wantImage || policy != tt.wantPolicy {
+				t.Errorf("got %s pulled %s, want %s pulled %s", image, policy, tt.wantImage, tt.wantPolicy)
+			}
+		})
+	}
+
+	r, applied := deploymentRecorder(t)
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout", UID: "checkout"}}
+	ts := queuedSchedule()
+	ts.Spec.Consumer.Image = schedulingv1alpha1.ImageConfig{Tag: "v1.4.0", PullSecrets: []corev1.LocalObjectReference{{Name: "ghcr"}}}
+	for _, component := range []string{"router", "consumer"} {
+		if err := r.ensureBufferServiceDeployment(context.Background(), svc, component, ts, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if router := applied["buffer-service-router-checkout"].Spec.Template.Spec; router.Containers[0].Image != defaultImageRepository+"/buffer-service-router:latest" || router.ImagePullSecrets != nil {
+		t.Errorf("got router image %s with pull secrets %v, want the default", router.Containers[0].Image, router.ImagePullSecrets)
+	}
+	consumer := applied["buffer-service-consumer-checkout"].Spec.Template.Spec
+	if consumer.Containers[0].Image != defaultImageRepository+"/buffer-service-consumer:v1.4.0" || consumer.Containers[0].ImagePullPolicy != corev1.PullIfNotPresent {
+		t.Errorf("got consumer image %s pulled %s, want the configured tag", consumer.Containers[0].Image, consumer.Containers[0].ImagePullPolicy)
+	}
+	if len(consumer.ImagePullSecrets) != 1 || consumer.ImagePullSecrets[0].Name != "ghcr" {
+		t.Errorf("got consumer pull secrets %v, want ghcr", consumer.ImagePullSecrets)
+	}
+}
+
+func TestBufferServiceDeploymentScheduling(t *testing.T) {
+	r, applied := deploymentRecorder(t)
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout", UID: "checkout"}}
+	ts := queuedSchedule()
+	zones := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "other"}}
+	ts.Spec.Router = schedulingv1alpha1.ComponentConfig{
+		NodeSelector: map[string]string{"node.kubernetes.io/pool": "edge"},
+		Tolerations:  []corev1.Toleration{{Key: "edge", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule}},
+		Affinity:     &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{}},
+		TopologySpreadConstraints: []corev1.TopologySpreadConstraint{
+			{MaxSkew: 1, TopologyKey: corev1.LabelTopologyZone, WhenUnsatisfiable: corev1.ScheduleAnyway},
+			{MaxSkew: 2, TopologyKey: corev1.LabelHostname, WhenUnsatisfiable: corev1.DoNotSchedule, LabelSelector: zones},
+		},
+	}
+	if err := r.ensureBufferServiceDeployment(context.Background(), svc, "router", ts, nil); err != nil {
+		t.Fatal(err)
+	}
+	spec := applied["buffer-service-router-checkout"].Spec.Template.Spec
+	if !reflect.DeepEqual(spec.NodeSelector, ts.Spec.Router.NodeSelector) || !reflect.DeepEqual(spec.Tolerations, ts.Spec.Router.Tolerations) || spec.Affinity == nil || spec.Affinity.NodeAffinity == nil {
+		t.Errorf("got node selector %v, tolerations %v and affinity %v, want the router settings", spec.NodeSelector, spec.Tolerations, spec.Affinity)
+	}
+	if len(spec.TopologySpreadConstraints) != 2 {
+		t.Fatalf("got %d spread constraints, want 2", len(spec.TopologySpreadConstraints))
+	}
+	want := map[string]string{"app.kubernetes.io/name": "buffer-service-router", parentServiceLabel: "checkout"}
+	if got := spec.TopologySpreadConstraints[0].LabelSelector; got == nil || !reflect.DeepEqual(got.MatchLabels, want) {
+		t.Errorf("got selector %v, want the router pods of the Service", got)
+	}
+	if got := spec.TopologySpreadConstraints[1].LabelSelector; got == nil || !reflect.DeepEqual(got.MatchLabels, zones.MatchLabels) {
+		t.Errorf("got selector %v, want the configured one", got)
+	}
+	if ts.Spec.Router.TopologySpreadConstraints[0].LabelSelector != nil {
+		t.Error("the schedule constraints were modified")
+	}
+}
+
+func TestWithExtraEnv(t *testing.T) {
+	env := []corev1.EnvVar{{Name: "METRICS_PORT", Value: "8001"}, {Name: "DEBUG", Value: "false"}}
+	got := withExtraEnv(env, []corev1.EnvVar{{Name: "DEBUG", Value: "true"}, {Name: "OTEL_SERVICE_NAME", Value: "checkout-router"}})
+	want := []corev1.EnvVar{{Name: "METRICS_PORT", Value: "8001"}, {Name: "DEBUG", Value: "true"}, {Name: "OTEL_SERVICE_NAME", Value: "checkout-router"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := withExtraEnv(want, nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("no extra variables: got %v, want %v", got, want)
+	}
+
+	r, applied := deploymentRecorder(t)
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout", UID: "checkout"}}
+	ts := queuedSchedule()
+	ts.Spec.Consumer.ExtraEnv = []corev1.EnvVar{{Name: "DEBUG", Value: "verbose"}, {Name: "OTEL_SERVICE_NAME", Value: "checkout-consumer"}}
+	ts.Spec.Consumer.EnvFrom = []corev1.EnvFromSource{{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "tracing"}}}}
+	if err := r.ensureBufferServiceDeployment(context.Background(), svc, "consumer", ts, nil); err != nil {
+		t.Fatal(err)
+	}
+	container := applied["buffer-service-consumer-checkout"].Spec.Template.Spec.Containers[0]
+	values := map[string]string{}
+	for _, variable := range container.Env {
+		if _, ok := values[variable.Name]; ok {
+			t.Errorf("variable %s set twice", variable.Name)
+		}
+		values[variable.Name] = variable.Value
+	}
+	if values["DEBUG"] != "verbose" || values["OTEL_SERVICE_NAME"] != "checkout-consumer" || values["METRICS_PORT"] != "8001" {
+		t.Errorf("got env %v, want the extra variables over the generated ones", values)
+	}
+	if last := container.Env[len(container.Env)-1]; last.Name != "OTEL_SERVICE_NAME" {
+		t.Errorf("got %s last, want the new variable appended", last.Name)
+	}
+	if len(container.EnvFrom) != 1 || container.EnvFrom[0].ConfigMapRef.Name != "tracing" {
+		t.Errorf("got envFrom %v, want the tracing ConfigMap", container.EnvFrom)
+	}
+}
+
+func TestBufferServiceDeploymentSecurity(t *testing.T) {
+	r, applied := deploymentRecorder(t)
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout", UID: "checkout"}}
+	ts := queuedSchedule()
+	ts.Spec.Router = schedulingv1alpha1.ComponentConfig{
+		PodSecurityContext: &corev1.PodSecurityContext{RunAsNonRoot: ptr.To(true), SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}},
+		SecurityContext: &corev1.SecurityContext{
+			AllowPrivilegeEscalation: ptr.To(false),
+			ReadOnlyRootFilesystem:   ptr.To(true),
+			Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+		},
+		PriorityClassName:            "carbonrouter-critical",
+		AutomountServiceAccountToken: ptr.To(true),
+	}
+	for _, component := range []string{"router", "consumer"} {
+		if err := r.ensureBufferServiceDeployment(context.Background(), svc, component, ts, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	router := applied["buffer-service-router-checkout"].Spec.Template.Spec
+	if !ptr.Deref(router.SecurityContext.RunAsNonRoot, false) || router.SecurityContext.SeccompProfile.Type != corev1.SeccompProfileTypeRuntimeDefault {
+		t.Errorf("got pod security context %v, want non-root with the runtime seccomp profile", router.SecurityContext)
+	}
+	container := router.Containers[0].SecurityContext
+	if container == nil || ptr.Deref(container.AllowPrivilegeEscalation, true) || !ptr.Deref(container.ReadOnlyRootFilesystem, false) || container.Capabilities.Drop[0] != "ALL" {
+		t.Errorf("got container security context %v, want the hardened settings", container)
+	}
+	if router.PriorityClassName != "carbonrouter-critical" || !ptr.Deref(router.AutomountServiceAccountToken, false) {
+		t.Errorf("got priority class %q and token automount %v, want the router settings", router.PriorityClassName, router.AutomountServiceAccountToken)
+	}
+	consumer := applied["buffer-service-consumer-checkout"].Spec.Template.Spec
+	if consumer.SecurityContext != nil || consumer.Containers[0].SecurityContext != nil || consumer.PriorityClassName != "" || consumer.AutomountServiceAccountToken != nil {
+		t.Errorf("got consumer pod spec %v, want the cluster defaults", consumer)
+	}
+}
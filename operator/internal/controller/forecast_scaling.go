@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	kedav1alpha1 "github.com/kedacore/keda/v2/apis/keda/v1alpha1"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	defaultForecastLeadMinutes = 10
+	// maxForecastWindows bounds the cron triggers of a ScaledObject. The triggers
+	// are rebuilt with every schedule, so only the next windows matter.
+	maxForecastWindows = 3
+)
+
+// forecastWindow is a run of consecutive green forecast slots.
+type forecastWindow struct {
+	start, end time.Time
+}
+
+// greenWindows merges the upcoming green slots of the forecast into windows,
+// earliest first.
+func greenWindows(cfg schedulingv1alpha1.ForecastScalingConfig, slots []schedulingv1alpha1.ForecastSlot, now time.Time) ([]forecastWindow, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	maxForecast := -1.0
+	if cfg.MaxForecast != nil {
+		value, err := strconv.ParseFloat(*cfg.MaxForecast, 64)
+		if err != nil || value < 0 {
+			return nil, invalidConfigError(fmt.Errorf("spec.forecastScaling.maxForecast %q is not a non-negative number", *cfg.MaxForecast))
+		}
+		maxForecast = value
+	}
+	var windows []forecastWindow
+	for _, slot := range upcomingForecast(slots, now) {
+		start, err := time.Parse(time.RFC3339, slot.From)
+		if err != nil {
+			continue
+		}
+		end, _ := time.Parse(time.RFC3339, slot.To)
+		if !greenSlot(slot, maxForecast) {
+			continue
+		}
+		if n := len(windows); n > 0 && !start.After(windows[n-1].end) {
+			windows[n-1].end = end
+			continue
+		}
+		windows = append(windows, forecastWindow{start: start, end: end})
+	}
+	return windows, nil
+}
+
+func greenSlot(slot schedulingv1alpha1.ForecastSlot, maxForecast float64) bool {
+	if maxForecast < 0 {
+		return slot.Index == "very low" || slot.Index == "low"
+	}
+	forecast, err := strconv.ParseFloat(slot.Forecast, 64)
+	return err == nil && forecast <= maxForecast
+}
+
+// forecastCronTriggers holds replicas from the lead time before each green
+// window until the lead time before it closes, so the component is ready when
+// the weights shift and has wound down again when the carbon intensity rises.
+// A window already under way is active right away: KEDA keeps a cron trigger
+// active while its next end comes before its next start.
+func forecastCronTriggers(cfg schedulingv1alpha1.ForecastScalingConfig, windows []forecastWindow, replicas *int32, now time.Time) []kedav1alpha1.ScaleTriggers {
+	if replicas == nil {
+		return nil
+	}
+	lead := time.Duration(defaultForecastLeadMinutes) * time.Minute
+	if cfg.LeadMinutes != nil {
+		lead = time.Duration(*cfg.LeadMinutes) * time.Minute
+	}
+	var triggers []kedav1alpha1.ScaleTriggers
+	for _, window := range windows {
+		start := window.start.Add(-lead).Truncate(time.Minute)
+		end := window.end.Add(-lead).Truncate(time.Minute)
+		if !end.After(now) || !end.After(start) {
+			continue
+		}
+		triggers = append(triggers, kedav1alpha1.ScaleTriggers{
+			Type: "cron",
+			Name: fmt.Sprintf("green-window-%d", len(triggers)),
+			Metadata: map[string]string{
+				"timezone":        "Etc/UTC",
+				"start":           cronAt(start),
+				"end":             cronAt(end),
+				"desiredReplicas": strconv.Itoa(int(*replicas)),
+			},
+		})
+		if len(triggers) == maxForecastWindows {
+			break
+		}
+	}
+	return triggers
+}
+
+// cronAt is a cron expression firing at t, on that date only within a year.
+func cronAt(t time.Time) string {
+	t = t.UTC()
+	return fmt.Sprintf("%d %d %d %d *", t.Minute(), t.Hour(), t.Day(), int(t.Month()))
+}
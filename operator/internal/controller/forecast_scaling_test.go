@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/utils/ptr"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestGreenWindows(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 10, 0, 0, time.UTC)
+	slot := func(from string, forecast, index string) schedulingv1alpha1.ForecastSlot {
+		start, _ := time.Parse(time.RFC3339, "2025-06-01T"+from+":00Z")
+		return schedulingv1alpha1.ForecastSlot{
+			From: start.Format(time.RFC3339), To: start.Add(30 * time.Minute).Format(time.RFC3339), Forecast: forecast, Index: index,
+		}
+	}
+	slots := []schedulingv1alpha1.ForecastSlot{
+		slot("11:30", "50", "very low"),
+		slot("12:00", "140", "low"),
+		slot("12:30", "90", "very low"),
+		slot("13:00", "300", "high"),
+		slot("13:30", "150", "low"),
+		slot("14:00", "100", "moderate"),
+	}
+	format := func(windows []forecastWindow) []string {
+		var out []string
+		for _, window := range windows {
+			out = append(out, window.start.Format("15:04")+"-"+window.end.Format("15:04"))
+		}
+		return out
+	}
+	enabled := schedulingv1alpha1.ForecastScalingConfig{Enabled: true}
+
+	tests := []struct {
+		name string
+		cfg  schedulingv1alpha1.ForecastScalingConfig
+		want []string
+	}{
+		{name: "disabled", cfg: schedulingv1alpha1.ForecastScalingConfig{MaxForecast: ptr.To("1000")}},
+		{name: "low indexes", cfg: enabled, want: []string{"12:00-13:00", "13:30-14:00"}},
+		{name: "forecast threshold", cfg: schedulingv1alpha1.ForecastScalingConfig{Enabled: true, MaxForecast: ptr.To("150")},
+			want: []string{"12:00-13:00", "13:30-14:30"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			windows, err := greenWindows(tt.cfg, slots, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := format(windows); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got windows %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	_, err := greenWindows(schedulingv1alpha1.ForecastScalingConfig{Enabled: true, MaxForecast: ptr.To("-5")}, slots, now)
+	if classify(err) != failureInvalidConfig {
+		t.Errorf("negative maxForecast: got %v, want an invalid configuration", err)
+	}
+}
+
+func TestForecastCronTriggers(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 10, 0, 0, time.UTC)
+	window := func(start string, minutes int) forecastWindow {
+		from, _ := time.Parse(time.RFC3339, "2025-06-01T"+start+"Z")
+		return forecastWindow{start: from, end: from.Add(time.Duration(minutes) * time.Minute)}
+	}
+	windows := []forecastWindow{
+		window("11:00:00", 75), // closes within the lead time
+		window("12:00:30", 60), // under way
+		window("13:30:00", 60),
+		window("15:00:00", 30),
+		window("23:55:00", 30), // beyond the triggers kept
+	}
+	cfg := schedulingv1alpha1.ForecastScalingConfig{Enabled: true}
+
+	if triggers := forecastCronTriggers(cfg, windows, nil, now); triggers != nil {
+		t.Errorf("got %v without replicas, want no triggers", triggers)
+	}
+	triggers := forecastCronTriggers(cfg, windows, ptr.To[int32](4), now)
+	want := []string{"50 11 1 6 *-50 12 1 6 *", "20 13 1 6 *-20 14 1 6 *", "50 14 1 6 *-20 15 1 6 *"}
+	var got []string
+	for i, trigger := range triggers {
+		if trigger.Type != "cron" || trigger.Name != fmt.Sprintf("green-window-%d", i) || trigger.Metadata["desiredReplicas"] != "4" || trigger.Metadata["timezone"] != "Etc/UTC" {
+			t.Errorf("got trigger %+v, want a UTC cron holding 4 replicas", trigger)
+		}
+		got = append(got, trigger.Metadata["start"]+"-"+trigger.Metadata["end"])
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got windows %q, want %q", got, want)
+	}
+
+	triggers = forecastCronTriggers(schedulingv1alpha1.ForecastScalingConfig{LeadMinutes: ptr.To[int32](0)}, windows[2:3], ptr.To[int32](4), now)
+	if len(triggers) != 1 || triggers[0].Metadata["start"] != "30 13 1 6 *" {
+		t.Errorf("got %v, want the window itself without a lead", triggers)
+	}
+}
+
+func TestCronAt(t *testing.T) {
+	at := time.Date(2025, 12, 31, 23, 5, 0, 0, time.FixedZone("CET", 60*60))
+	if got := cronAt(at); got != "5 22 31 12 *" {
+		t.Errorf("got %q, want the time in UTC", got)
+	}
+}
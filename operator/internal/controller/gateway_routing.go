@@ -0,0 +1,488 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const gatewayAPIGroup = "gateway.networking.k8s.io"
+
+var (
+	httpRouteGVK = schema.GroupVersionKind{Group: gatewayAPIGroup, Version: "v1", Kind: "HTTPRoute"}
+	// linkerdHTTPRouteGVK is the Linkerd flavour of the HTTPRoute, which its
+	// proxies honour on any Linkerd release with weighted backends (2.14+).
+	linkerdHTTPRouteGVK = schema.GroupVersionKind{Group: "policy.linkerd.io", Version: "v1beta3", Kind: "HTTPRoute"}
+)
+
+// The subset of the Gateway API HTTPRoute the operator renders. The Gateway
+// API types are not vendored, so routes are applied as unstructured objects.
+type httpRouteSpec struct {
+	ParentRefs []httpParentRef `json:"parentRefs"`
+	Hostnames  []string        `json:"hostnames,omitempty"`
+	Rules      []httpRouteRule `json:"rules"`
+}
+
+type httpParentRef struct {
+	Group     *string `json:"group,omitempty"`
+	Kind      string  `json:"kind"`
+	Namespace string  `json:"namespace,omitempty"`
+	Name      string  `json:"name"`
+	Port      *int32  `json:"port,omitempty"`
+}
+
+type httpRouteRule struct {
+	Matches     []httpRouteMatch  `json:"matches,omitempty"`
+	Filters     []httpRouteFilter `json:"filters,omitempty"`
+	BackendRefs []httpBackendRef  `json:"backendRefs"`
+}
+
+type httpRouteMatch struct {
+	Path    *httpPathMatch    `json:"path,omitempty"`
+	Method  string            `json:"method,omitempty"`
+	Headers []httpHeaderMatch `json:"headers,omitempty"`
+}
+
+type httpPathMatch struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type httpHeaderMatch struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type httpRouteFilter struct {
+	Type                   string              `json:"type"`
+	RequestHeaderModifier  *httpHeaderModifier `json:"requestHeaderModifier,omitempty"`
+	ResponseHeaderModifier *httpHeaderModifier `json:"responseHeaderModifier,omitempty"`
+}
+
+type httpHeaderModifier struct {
+	Set []httpHeader `json:"set"`
+}
+
+type httpHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type httpBackendRef struct {
+	Name    string            `json:"name"`
+	Port    int32             `json:"port"`
+	Weight  int32             `json:"weight"`
+	Filters []httpRouteFilter `json:"filters,omitempty"`
+}
+
+func meshRouteName(svc *corev1.Service) string {
+	return fmt.Sprintf("%s-carbonrouter", svc.Name)
+}
+
+func gatewayRouteName(svc *corev1.Service) string {
+	return fmt.Sprintf("%s-carbonrouter-gateway", svc.Name)
+}
+
+// precisionServiceName names the Service selecting the pods of one precision,
+// which stands in for the DestinationRule subset as a backendRef.
+func precisionServiceName(svc *corev1.Service, precision int) string {
+	return fmt.Sprintf("%s-%s", svc.Name, precisionSubsetName(precision))
+}
+
+func exactHeader(name, value string) httpHeaderMatch {
+	return httpHeaderMatch{Type: "Exact", Name: name, Value: value}
+}
+
+// gatewayRouting splits traffic with HTTPRoutes over one Service per
+// precision, since neither the Gateway API nor Linkerd have subsets. The route
+// attached to the Service itself serves the mesh (GAMMA, or the Linkerd
+// proxies); with the Gateway API, spec.routing.gateways get a second route on
+// those Gateways. Features only Istio offers are skipped: locality load
+// balancing, connection rebalancing, source workload matches and
+// AuthorizationPolicies.
+type gatewayRouting struct {
+	r       *FlavourRouterReconciler
+	backend string
+	gvk     schema.GroupVersionKind
+}
+
+func (b gatewayRouting) name() string { return b.backend }
+
+// kind names the routes of the backend in the inventory and in Events.
+func (b gatewayRouting) kind() string {
+	if b.gvk == linkerdHTTPRouteGVK {
+		return "LinkerdHTTPRoute"
+	}
+	return "HTTPRoute"
+}
+
+func (b gatewayRouting) ensure(ctx context.Context, svc *corev1.Service, ts *schedulingv1alpha1.TrafficSchedule, precisions []int, header string) error {
+	log := ctrl.LoggerFrom(ctx).WithName("[FlavourRouter]")
+	if len(svc.Spec.Selector) == 0 || len(svc.Spec.Ports) == 0 {
+		return invalidConfigError(fmt.Errorf("the %s routing backend needs a Service with a selector and a port", b.backend))
+	}
+	routing := ts.Spec.Routing
+	if routing.ConnectionRebalancing.Enabled || ts.Spec.Locality.Enabled {
+		log.Info("Connection rebalancing and locality routing need the istio routing backend, ignoring them")
+	}
+	if err := b.ensurePrecisionServices(ctx, svc, precisions); err != nil {
+		return err
+	}
+
+	port := svc.Spec.Ports[0].Port
+	rules := gatewayRouteRules(svc, port, header, ts.Status.Flavours, routing, precisions)
+	// Linkerd spells the core API group out
+	group := ""
+	if b.gvk == linkerdHTTPRouteGVK {
+		group = "core"
+	}
+	mesh := httpRouteSpec{
+		ParentRefs: []httpParentRef{{Group: ptr.To(group), Kind: "Service", Name: svc.Name, Port: ptr.To(port)}},
+		Rules:      rules,
+	}
+	if err := b.applyRoute(ctx, svc, meshRouteName(svc), mesh); err != nil {
+		return err
+	}
+	if b.gvk == linkerdHTTPRouteGVK && len(routing.Gateways) > 0 {
+		log.Info("Linkerd routes only attach to Services, ignoring spec.routing.gateways")
+	}
+	if len(routing.Gateways) == 0 || b.gvk == linkerdHTTPRouteGVK {
+		return b.deleteRoute(ctx, svc, gatewayRouteName(svc))
+	}
+	gateway := httpRouteSpec{Hostnames: routing.Hosts, Rules: withAltSvc(rules, routing)}
+	for _, ref := range routing.Gateways {
+		namespace, name, found := strings.Cut(ref, "/")
+		if !found {
+			namespace, name = svc.Namespace, ref
+		}
+		gateway.ParentRefs = append(gateway.ParentRefs, httpParentRef{Group: ptr.To(gatewayAPIGroup), Kind: "Gateway", Namespace: namespace, Name: name})
+	}
+	return b.applyRoute(ctx, svc, gatewayRouteName(svc), gateway)
+}
+
+// gatewayRouteRules mirrors the VirtualService routes. The Gateway API ranks
+// rules matching a path or a method first, then those with more header
+// matches, and keeps the order otherwise, so the rules keep the precedence of
+// the VirtualService except that routing rules outrank client rules.
+func gatewayRouteRules(svc *corev1.Service, port int32, header string, flavours []schedulingv1alpha1.FlavourDecision, routing schedulingv1alpha1.RoutingConfig, precisions []int) []httpRouteRule {
+	single := func(precision int) []httpBackendRef {
+		return []httpBackendRef{{Name: precisionServiceName(svc, precision), Port: port, Weight: 100}}
+	}
+
+	var rules []httpRouteRule
+	// Only header matches identify clients outside of Istio
+	for _, rule := range routing.ClientRules {
+		allowed := allowedPrecisions(rule.Precisions, precisions)
+		if rule.Clients.Header == nil || len(rule.Clients.Header.Values) == 0 || len(allowed) == 0 {
+			continue
+		}
+		for _, precision := range allowed {
+			var matches []httpRouteMatch
+			for _, value := range rule.Clients.Header.Values {
+				matches = append(matches, httpRouteMatch{Headers: []httpHeaderMatch{
+					exactHeader(rule.Clients.Header.Name, value),
+					exactHeader(header, precisionHeaderValue(precision)),
+				}})
+			}
+			rules = append(rules, httpRouteRule{Matches: matches, BackendRefs: single(precision)})
+		}
+		var matches []httpRouteMatch
+		for _, value := range rule.Clients.Header.Values {
+			matches = append(matches, httpRouteMatch{Headers: []httpHeaderMatch{exactHeader(rule.Clients.Header.Name, value)}})
+		}
+		rules = append(rules, httpRouteRule{Matches: matches, BackendRefs: weightedBackendRefs(svc, port, flavours, allowed)})
+	}
+	// The Gateway API cannot match the authority of a request
+	for _, rule := range routing.RoutingRules {
+		matches := ruleRouteMatches(rule)
+		allowed := allowedPrecisions(rule.Precisions, precisions)
+		if len(matches) == 0 || len(allowed) == 0 || rule.Authority != "" {
+			continue
+		}
+		for _, precision := range allowed {
+			forced := make([]httpRouteMatch, 0, len(matches))
+			for _, match := range matches {
+				match.Headers = []httpHeaderMatch{exactHeader(header, precisionHeaderValue(precision))}
+				forced = append(forced, match)
+			}
+			rules = append(rules, httpRouteRule{Matches: forced, BackendRefs: single(precision)})
+		}
+		backends := weightedBackendRefs(svc, port, flavours, allowed)
+		if rule.GRPC != nil {
+			backends = withPrecisionHeader(svc, backends, header, precisions)
+		}
+		rules = append(rules, httpRouteRule{Matches: matches, BackendRefs: backends})
+	}
+	for _, precision := range precisions {
+		rules = append(rules, httpRouteRule{
+			Matches:     []httpRouteMatch{{Headers: []httpHeaderMatch{exactHeader(header, precisionHeaderValue(precision))}}},
+			BackendRefs: single(precision),
+		})
+	}
+	if routing.WebSocket {
+		// Each connection learns its precision from the routing header
+		backends := withPrecisionHeader(svc, weightedBackendRefs(svc, port, flavours, precisions), header, precisions)
+		rules = append(rules, httpRouteRule{
+			Matches:     []httpRouteMatch{{Headers: []httpHeaderMatch{{Type: "RegularExpression", Name: "upgrade", Value: "(?i)websocket"}}}},
+			BackendRefs: backends,
+		})
+	}
+	rules = append(rules, httpRouteRule{BackendRefs: weightedBackendRefs(svc, port, flavours, precisions)})
+	tagServedBackends(svc, rules, routing.ServedHeader, precisions)
+	return rules
+}
+
+// withPrecisionHeader sets the routing header of the requests of every backend
+// to its precision, like setPrecisionHeader.
+func withPrecisionHeader(svc *corev1.Service, backends []httpBackendRef, header string, precisions []int) []httpBackendRef {
+	precisionByBackend := make(map[string]int, len(precisions))
+	for _, precision := range precisions {
+		precisionByBackend[precisionServiceName(svc, precision)] = precision
+	}
+	for i := range backends {
+		backends[i].Filters = []httpRouteFilter{{
+			Type: "RequestHeaderModifier",
+			RequestHeaderModifier: &httpHeaderModifier{Set: []httpHeader{
+				{Name: header, Value: precisionHeaderValue(precisionByBackend[backends[i].Name])},
+			}},
+		}}
+	}
+	return backends
+}
+
+// tagServedBackends sets the served header on the responses of every backend
+// to its precision, like tagServedPrecision.
+func tagServedBackends(svc *corev1.Service, rules []httpRouteRule, header string, precisions []int) {
+	if header == "" {
+		return
+	}
+	precisionByBackend := make(map[string]int, len(precisions))
+	for _, precision := range precisions {
+		precisionByBackend[precisionServiceName(svc, precision)] = precision
+	}
+	for _, rule := range rules {
+		for i := range rule.BackendRefs {
+			backend := &rule.BackendRefs[i]
+			backend.Filters = append(backend.Filters, httpRouteFilter{
+				Type: "ResponseHeaderModifier",
+				ResponseHeaderModifier: &httpHeaderModifier{Set: []httpHeader{
+					{Name: header, Value: precisionHeaderValue(precisionByBackend[backend.Name])},
+				}},
+			})
+		}
+	}
+}
+
+// pathMatch translates the path of a routing rule to the Gateway API.
+func pathMatch(path schedulingv1alpha1.PathMatch) *httpPathMatch {
+	switch path.Type {
+	case pathMatchExact:
+		return &httpPathMatch{Type: "Exact", Value: path.Value}
+	case pathMatchRegex:
+		return &httpPathMatch{Type: "RegularExpression", Value: path.Value}
+	default:
+		return &httpPathMatch{Type: "PathPrefix", Value: path.Value}
+	}
+}
+
+// ruleRouteMatches returns the matches of a routing rule, like ruleMatches.
+func ruleRouteMatches(rule schedulingv1alpha1.RoutingRule) []httpRouteMatch {
+	var path *httpPathMatch
+	if match := rulePath(rule); match != nil {
+		path = pathMatch(*match)
+	}
+	if len(rule.Methods) == 0 {
+		if path == nil {
+			return nil
+		}
+		return []httpRouteMatch{{Path: path}}
+	}
+	matches := make([]httpRouteMatch, 0, len(rule.Methods))
+	for _, method := range rule.Methods {
+		matches = append(matches, httpRouteMatch{Path: path, Method: string(method)})
+	}
+	return matches
+}
+
+// weightedBackendRefs splits requests across the precision Services with the
+// schedule weights, like buildWeightedRoute.
+func weightedBackendRefs(svc *corev1.Service, port int32, flavours []schedulingv1alpha1.FlavourDecision, precisions []int) []httpBackendRef {
+	var backends []httpBackendRef
+	for _, destination := range buildWeightedRoute("", flavours, precisions).Route {
+		name := fmt.Sprintf("%s-%s", svc.Name, destination.Destination.Subset)
+		backends = append(backends, httpBackendRef{Name: name, Port: port, Weight: destination.Weight})
+	}
+	return backends
+}
+
+// withAltSvc advertises HTTP/3 on the responses of the gateway route.
+func withAltSvc(rules []httpRouteRule, routing schedulingv1alpha1.RoutingConfig) []httpRouteRule {
+	if !routing.HTTP3 {
+		return rules
+	}
+	port := int32(defaultHTTP3Port)
+	if routing.HTTP3Port != nil {
+		port = *routing.HTTP3Port
+	}
+	out := make([]httpRouteRule, len(rules))
+	for i, rule := range rules {
+		rule.Filters = append(append([]httpRouteFilter{}, rule.Filters...), httpRouteFilter{
+			Type:                   "ResponseHeaderModifier",
+			ResponseHeaderModifier: &httpHeaderModifier{Set: []httpHeader{{Name: "alt-svc", Value: fmt.Sprintf(`h3=":%d"; ma=86400`, port)}}},
+		})
+		out[i] = rule
+	}
+	return out
+}
+
+// ensurePrecisionServices applies one Service per active precision, with the
+// ports of svc and its selector narrowed to the precision, and deletes those of
+// retired precisions.
+func (b gatewayRouting) ensurePrecisionServices(ctx context.Context, svc *corev1.Service, precisions []int) error {
+	desired := map[string]struct{}{}
+	for _, precision := range precisions {
+		selector := maps.Clone(svc.Spec.Selector)
+		selector[precisionLabel] = precisionHeaderValue(precision)
+		ports := make([]corev1.ServicePort, 0, len(svc.Spec.Ports))
+		for _, port := range svc.Spec.Ports {
+			targetPort := port.TargetPort
+			if targetPort == (intstr.IntOrString{}) {
+				targetPort = intstr.FromInt32(port.Port)
+			}
+			ports = append(ports, corev1.ServicePort{
+				Name:        port.Name,
+				Protocol:    port.Protocol,
+				AppProtocol: port.AppProtocol,
+				Port:        port.Port,
+				TargetPort:  targetPort,
+			})
+		}
+		backend := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      precisionServiceName(svc, precision),
+				Namespace: svc.Namespace,
+				Labels: map[string]string{
+					parentServiceLabel:             svc.Name,
+					precisionLabel:                 precisionHeaderValue(precision),
+					"app.kubernetes.io/part-of":    "carbonrouter",
+					"app.kubernetes.io/managed-by": "carbonrouter-operator",
+				},
+			},
+			Spec: corev1.ServiceSpec{Selector: selector, Ports: ports, Type: corev1.ServiceTypeClusterIP},
+		}
+		if err := ctrl.SetControllerReference(svc, backend, b.r.Scheme); err != nil {
+			return err
+		}
+		if err := b.r.apply(ctx, svc, "Service", backend, &backend.Spec); err != nil {
+			return err
+		}
+		desired[backend.Name] = struct{}{}
+	}
+	return b.deletePrecisionServices(ctx, svc, desired)
+}
+
+// deletePrecisionServices deletes the precision Services of svc not in keep.
+func (b gatewayRouting) deletePrecisionServices(ctx context.Context, svc *corev1.Service, keep map[string]struct{}) error {
+	var existing corev1.ServiceList
+	if err := b.r.List(ctx, &existing, client.InNamespace(svc.Namespace), client.MatchingLabels{parentServiceLabel: svc.Name}, client.HasLabels{precisionLabel}); err != nil {
+		return err
+	}
+	for i := range existing.Items {
+		backend := &existing.Items[i]
+		if _, ok := keep[backend.Name]; ok {
+			continue
+		}
+		if err := b.r.Delete(ctx, backend); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		b.r.Inventory.Drop(client.ObjectKeyFromObject(svc), "Service", svc.Namespace, backend.Name)
+	}
+	return nil
+}
+
+func (b gatewayRouting) applyRoute(ctx context.Context, svc *corev1.Service, name string, spec httpRouteSpec) error {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&spec)
+	if err != nil {
+		return err
+	}
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(b.gvk)
+	route.SetName(name)
+	route.SetNamespace(svc.Namespace)
+	route.SetLabels(map[string]string{parentServiceLabel: svc.Name})
+	route.Object["spec"] = content
+	if err := ctrl.SetControllerReference(svc, route, b.r.Scheme); err != nil {
+		return err
+	}
+	return b.r.apply(ctx, svc, b.kind(), route, &spec)
+}
+
+func (b gatewayRouting) deleteRoute(ctx context.Context, svc *corev1.Service, name string) error {
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(b.gvk)
+	route.SetName(name)
+	route.SetNamespace(svc.Namespace)
+	if err := ignoreAbsent(b.r.Delete(ctx, route)); err != nil {
+		return err
+	}
+	b.r.Inventory.Drop(client.ObjectKeyFromObject(svc), b.kind(), svc.Namespace, name)
+	return nil
+}
+
+// pending reports routes whose parents have not accepted their latest
+// generation. Implementations without route status are trusted.
+func (b gatewayRouting) pending(ctx context.Context, svc *corev1.Service) (string, error) {
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(b.gvk)
+	if err := b.r.Get(ctx, client.ObjectKey{Namespace: svc.Namespace, Name: meshRouteName(svc)}, route); err != nil {
+		return "", ignoreAbsent(err)
+	}
+	parents, _, _ := unstructured.NestedSlice(route.Object, "status", "parents")
+	for _, parent := range parents {
+		conditions, _, _ := unstructured.NestedSlice(parent.(map[string]interface{}), "conditions")
+		for _, condition := range conditions {
+			fields, _ := condition.(map[string]interface{})
+			observed, _, _ := unstructured.NestedInt64(fields, "observedGeneration")
+			if fields["type"] == "Accepted" && observed != 0 && observed < route.GetGeneration() {
+				return b.kind(), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+func (b gatewayRouting) applied(ctx context.Context, svc *corev1.Service) (bool, error) {
+	routes := &unstructured.UnstructuredList{}
+	routes.SetGroupVersionKind(b.gvk.GroupVersion().WithKind(b.gvk.Kind + "List"))
+	if err := b.r.List(ctx, routes, client.InNamespace(svc.Namespace), client.MatchingLabels{parentServiceLabel: svc.Name}, client.Limit(1)); err != nil {
+		return false, ignoreAbsent(err)
+	}
+	return len(routes.Items) > 0, nil
+}
+
+func (b gatewayRouting) cleanup(ctx context.Context, svc *corev1.Service, next routingBackend) error {
+	errs := []error{
+		b.deleteRoute(ctx, svc, meshRouteName(svc)),
+		b.deleteRoute(ctx, svc, gatewayRouteName(svc)),
+	}
+	// The precision Services are shared with the other HTTPRoute backend
+	if _, shared := next.(gatewayRouting); !shared {
+		errs = append(errs, b.deletePrecisionServices(ctx, svc, nil))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,314 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestGatewayRouteRules(t *testing.T) {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout"}}
+	flavours := []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 30}, {Precision: 50, Weight: 70}}
+	routing := schedulingv1alpha1.RoutingConfig{
+		// Principals cannot be matched outside of Istio
+		ClientRules: []schedulingv1alpha1.ClientPrecisionRule{freeTier, batchJobs},
+	}
+	rules := gatewayRouteRules(svc, 8080, "x-carbonrouter", flavours, routing, []int{100, 50})
+
+	backends := func(rule httpRouteRule) map[string]int32 {
+		out := map[string]int32{}
+		for _, backend := range rule.BackendRefs {
+			if backend.Port != 8080 {
+				t.Errorf("got backend %v, want the Service port", backend)
+			}
+			out[backend.Name] = backend.Weight
+		}
+		return out
+	}
+	want := []struct {
+		matches  int
+		backends map[string]int32
+	}{
+		{matches: 2, backends: map[string]int32{"checkout-precision-50": 100}},
+		{matches: 2, backends: map[string]int32{"checkout-precision-50": 100}},
+		{matches: 1, backends: map[string]int32{"checkout-precision-100": 100}},
+		{matches: 1, backends: map[string]int32{"checkout-precision-50": 100}},
+		{matches: 0, backends: map[string]int32{"checkout-precision-100": 30, "checkout-precision-50": 70}},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("got %d rules, want %d", len(rules), len(want))
+	}
+	for i, rule := range rules {
+		if len(rule.Matches) != want[i].matches || !reflect.DeepEqual(backends(rule), want[i].backends) {
+			t.Errorf("rule %d: got %v, want %d matches to %v", i, rule, want[i].matches, want[i].backends)
+		}
+	}
+	forced := rules[0].Matches[0].Headers
+	if !reflect.DeepEqual(forced, []httpHeaderMatch{exactHeader("x-plan", "free"), exactHeader("x-carbonrouter", "50")}) {
+		t.Errorf("got forced client match %v, want the client and the requested precision", forced)
+	}
+	if got := rules[2].Matches[0].Headers; !reflect.DeepEqual(got, []httpHeaderMatch{exactHeader("x-carbonrouter", "100")}) {
+		t.Errorf("got forced match %v, want the routing header", got)
+	}
+
+	routing = schedulingv1alpha1.RoutingConfig{WebSocket: true, HTTP3: true}
+	rules = gatewayRouteRules(svc, 8080, "x-carbonrouter", flavours, routing, []int{100, 50})
+	upgrade := rules[2]
+	if upgrade.Matches[0].Headers[0].Name != "upgrade" {
+		t.Fatalf("got rule %v, want the WebSocket upgrades before the default route", upgrade)
+	}
+	for _, backend := range upgrade.BackendRefs {
+		set := backend.Filters[0].RequestHeaderModifier.Set[0]
+		if set.Name != "x-carbonrouter" || "checkout-precision-"+set.Value != backend.Name {
+			t.Errorf("got filter %v on %s, want the routing header set to its precision", set, backend.Name)
+		}
+	}
+	for _, rule := range withAltSvc(rules, routing) {
+		if len(rule.Filters) != 1 || rule.Filters[0].ResponseHeaderModifier.Set[0].Value != `h3=":443"; ma=86400` {
+			t.Errorf("got filters %v, want HTTP/3 advertised on the gateway", rule.Filters)
+		}
+	}
+	if len(rules[0].Filters) != 0 {
+		t.Error("alt-svc leaked into the mesh route")
+	}
+}
+
+func TestGatewayRuleRoutes(t *testing.T) {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout"}}
+	flavours := []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 30}, {Precision: 50, Weight: 70}}
+	search := schedulingv1alpha1.RoutingRule{Name: "search", Path: &schedulingv1alpha1.PathMatch{Type: pathMatchRegex, Value: "/v[0-9]+/search"}, Precisions: []int{100, 50}}
+	routing := schedulingv1alpha1.RoutingConfig{RoutingRules: []schedulingv1alpha1.RoutingRule{reportsRule, search}}
+	rules := gatewayRouteRules(svc, 8080, "x-carbonrouter", flavours, routing, []int{100, 50})
+
+	want := []struct {
+		path     httpPathMatch
+		header   string
+		backends int
+	}{
+		{path: httpPathMatch{Type: "PathPrefix", Value: "/reports"}, header: "100", backends: 1},
+		{path: httpPathMatch{Type: "PathPrefix", Value: "/reports"}, backends: 1},
+		{path: httpPathMatch{Type: "RegularExpression", Value: "/v[0-9]+/search"}, header: "100", backends: 1},
+		{path: httpPathMatch{Type: "RegularExpression", Value: "/v[0-9]+/search"}, header: "50", backends: 1},
+		{path: httpPathMatch{Type: "RegularExpression", Value: "/v[0-9]+/search"}, backends: 2},
+	}
+	// then the forced precisions and the default
+	if len(rules) != len(want)+3 {
+		t.Fatalf("got %d rules, want %d", len(rules), len(want)+3)
+	}
+	for i, w := range want {
+		match := rules[i].Matches[0]
+		header := ""
+		if len(match.Headers) == 1 && match.Headers[0].Name == "x-carbonrouter" {
+			header = match.Headers[0].Value
+		}
+		if match.Path == nil || *match.Path != w.path || header != w.header || len(rules[i].BackendRefs) != w.backends {
+			t.Errorf("rule %d: got %v, want path %v forcing %q to %d backends", i, rules[i], w.path, w.header, w.backends)
+		}
+	}
+}
+
+func TestTagServedBackends(t *testing.T) {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout"}}
+	flavours := []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 30}, {Precision: 50, Weight: 70}}
+	routing := schedulingv1alpha1.RoutingConfig{WebSocket: true}
+	for _, rule := range gatewayRouteRules(svc, 8080, "x-carbonrouter", flavours, routing, []int{100, 50}) {
+		for _, backend := range rule.BackendRefs {
+			for _, filter := range backend.Filters {
+				if filter.ResponseHeaderModifier != nil {
+					t.Errorf("got response filter %v on %s without a served header", filter, backend.Name)
+				}
+			}
+		}
+	}
+
+	routing.ServedHeader = "x-carbonrouter-served"
+	rules := gatewayRouteRules(svc, 8080, "x-carbonrouter", flavours, routing, []int{100, 50})
+	for i, rule := range rules {
+		for _, backend := range rule.BackendRefs {
+			last := backend.Filters[len(backend.Filters)-1]
+			if last.Type != "ResponseHeaderModifier" || !reflect.DeepEqual(last.ResponseHeaderModifier.Set, []httpHeader{{Name: "x-carbonrouter-served", Value: backend.Name[len("checkout-precision-"):]}}) {
+				t.Errorf("rule %d: got filter %v on %s, want the served header set to its precision", i, last, backend.Name)
+			}
+		}
+	}
+	// The WebSocket upgrades keep setting the routing header on the request
+	if upgrade := rules[2].BackendRefs[0]; len(upgrade.Filters) != 2 || upgrade.Filters[0].RequestHeaderModifier == nil {
+		t.Errorf("got filters %v, want the request and the response header set", upgrade.Filters)
+	}
+}
+
+func TestGatewayRouting(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	for _, gvk := range []schema.GroupVersionKind{httpRouteGVK, linkerdHTTPRouteGVK} {
+		scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+		scheme.AddKnownTypeWithName(gvk.GroupVersion().WithKind(gvk.Kind+"List"), &unstructured.UnstructuredList{})
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout", UID: "checkout"},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": "checkout"},
+			Ports:    []corev1.ServicePort{{Name: "http", Port: 80, TargetPort: intstr.FromInt32(8080)}, {Name: "metrics", Port: 9090}},
+		},
+	}
+	routes := map[schema.GroupVersionKind]map[string]httpRouteSpec{httpRouteGVK: {}, linkerdHTTPRouteGVK: {}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if route, ok := obj.(*unstructured.Unstructured); ok {
+				var spec httpRouteSpec
+				if err := runtime.DefaultUnstructuredConverter.FromUnstructured(route.Object["spec"].(map[string]interface{}), &spec); err != nil {
+					return err
+				}
+				routes[route.GroupVersionKind()][route.GetName()] = spec
+			}
+			created := obj.DeepCopyObject().(client.Object)
+			created.SetResourceVersion("")
+			if err := c.Create(ctx, created); !apierrors.IsAlreadyExists(err) {
+				return err
+			}
+			return nil
+		},
+	}).Build()
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme, Inventory: NewResourceInventory()}
+	ctx := context.Background()
+	exists := func(gvk schema.GroupVersionKind, name string) bool {
+		route := &unstructured.Unstructured{}
+		route.SetGroupVersionKind(gvk)
+		err := c.Get(ctx, client.ObjectKey{Namespace: "shop", Name: name}, route)
+		if err != nil && !apierrors.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		return err == nil
+	}
+	ts := &schedulingv1alpha1.TrafficSchedule{}
+	ts.Spec.Routing.Gateways = []string{"ingress", "infra/public"}
+	ts.Spec.Routing.Hosts = []string{"shop.example.com"}
+	ts.Status.Flavours = []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 30}, {Precision: 50, Weight: 70}}
+	gateway := gatewayRouting{r: r, backend: RoutingBackendGatewayAPI, gvk: httpRouteGVK}
+
+	if err := gateway.ensure(ctx, svc, ts, []int{100, 50}, "x-carbonrouter"); err != nil {
+		t.Fatal(err)
+	}
+	var backend corev1.Service
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "shop", Name: "checkout-precision-50"}, &backend); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(backend.Spec.Selector, map[string]string{"app": "checkout", precisionLabel: "50"}) {
+		t.Errorf("got selector %v, want the Service selector narrowed to precision 50", backend.Spec.Selector)
+	}
+	if got := []intstr.IntOrString{backend.Spec.Ports[0].TargetPort, backend.Spec.Ports[1].TargetPort}; !reflect.DeepEqual(got, []intstr.IntOrString{intstr.FromInt32(8080), intstr.FromInt32(9090)}) {
+		t.Errorf("got target ports %v, want the Service target ports, defaulted to the port", got)
+	}
+	mesh := routes[httpRouteGVK][meshRouteName(svc)]
+	if len(mesh.ParentRefs) != 1 || *mesh.ParentRefs[0].Group != "" || mesh.ParentRefs[0].Kind != "Service" || *mesh.ParentRefs[0].Port != 80 {
+		t.Errorf("got parents %v, want the Service port", mesh.ParentRefs)
+	}
+	edge := routes[httpRouteGVK][gatewayRouteName(svc)]
+	var parents []string
+	for _, parent := range edge.ParentRefs {
+		parents = append(parents, parent.Namespace+"/"+parent.Name)
+	}
+	if !reflect.DeepEqual(parents, []string{"shop/ingress", "infra/public"}) || !reflect.DeepEqual(edge.Hostnames, ts.Spec.Routing.Hosts) {
+		t.Errorf("got parents %v for hosts %v, want both Gateways", parents, edge.Hostnames)
+	}
+
+	ts.Spec.Routing.Gateways = nil
+	if err := gateway.ensure(ctx, svc, ts, []int{100}, "x-carbonrouter"); err != nil {
+		t.Fatal(err)
+	}
+	if exists(httpRouteGVK, gatewayRouteName(svc)) || !exists(httpRouteGVK, meshRouteName(svc)) {
+		t.Error("want the gateway route removed without Gateways and the mesh route kept")
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(&backend), &corev1.Service{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Service of the retired precision kept: %v", err)
+	}
+
+	// Linkerd routes attach to the Service only
+	linkerd := gatewayRouting{r: r, backend: RoutingBackendLinkerd, gvk: linkerdHTTPRouteGVK}
+	ts.Spec.Routing.Gateways = []string{"ingress"}
+	if err := linkerd.ensure(ctx, svc, ts, []int{100}, "x-carbonrouter"); err != nil {
+		t.Fatal(err)
+	}
+	if parent := routes[linkerdHTTPRouteGVK][meshRouteName(svc)].ParentRefs[0]; *parent.Group != "core" {
+		t.Errorf("got parent %v, want the core group spelled out", parent)
+	}
+	if exists(linkerdHTTPRouteGVK, gatewayRouteName(svc)) {
+		t.Error("Linkerd route attached to a Gateway")
+	}
+
+	// Switching between the HTTPRoute backends keeps the precision Services
+	if err := gateway.cleanup(ctx, svc, linkerd); err != nil {
+		t.Fatal(err)
+	}
+	if exists(httpRouteGVK, meshRouteName(svc)) {
+		t.Error("route of the previous backend kept")
+	}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "shop", Name: "checkout-precision-100"}, &corev1.Service{}); err != nil {
+		t.Errorf("precision Service removed while Linkerd uses it: %v", err)
+	}
+	if err := linkerd.cleanup(ctx, svc, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "shop", Name: "checkout-precision-100"}, &corev1.Service{}); !apierrors.IsNotFound(err) {
+		t.Errorf("precision Service kept once the Service left carbonrouter: %v", err)
+	}
+
+	headless := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "headless"}}
+	if err := gateway.ensure(ctx, headless, ts, []int{100}, "x-carbonrouter"); classify(err) != failureInvalidConfig {
+		t.Errorf("Service without a selector: got %v, want an invalid configuration", err)
+	}
+}
+
+func TestGatewayRoutingPending(t *testing.T) {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypeWithName(httpRouteGVK, &unstructured.Unstructured{})
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout"}}
+	route := func(generation, observed int64) *unstructured.Unstructured {
+		route := &unstructured.Unstructured{Object: map[string]interface{}{
+			"status": map[string]interface{}{"parents": []interface{}{map[string]interface{}{
+				"conditions": []interface{}{map[string]interface{}{"type": "Accepted", "status": "True", "observedGeneration": observed}},
+			}}},
+		}}
+		route.SetGroupVersionKind(httpRouteGVK)
+		route.SetNamespace("shop")
+		route.SetName(meshRouteName(svc))
+		route.SetGeneration(generation)
+		return route
+	}
+	tests := []struct {
+		name   string
+		routes []client.Object
+		want   string
+	}{
+		{name: "not applied yet"},
+		{name: "accepted", routes: []client.Object{route(3, 3)}},
+		{name: "lagging", routes: []client.Object{route(3, 2)}, want: "HTTPRoute"},
+		{name: "no route status", routes: []client.Object{route(3, 0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tt.routes...).Build()
+			r := &FlavourRouterReconciler{Client: c, Scheme: scheme}
+			got, err := gatewayRouting{r: r, backend: RoutingBackendGatewayAPI, gvk: httpRouteGVK}.pending(context.Background(), svc)
+			if err != nil || got != tt.want {
+				t.Errorf("got %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	defaultTrustDomain  = "cluster.local"
+	defaultIdentityPort = 443
+	identityVolumeName  = "carbonrouter-identity"
+	identityMountPath   = "/etc/carbonrouter/identity"
+	certManagerGroup    = "cert-manager.io"
+	defaultIssuerKind   = "ClusterIssuer"
+)
+
+// certificateGVK is referenced without importing cert-manager, which stays an
+// optional dependency of the cluster.
+var certificateGVK = schema.GroupVersionKind{Group: certManagerGroup, Version: "v1", Kind: "Certificate"}
+
+func identitySecretName(svc *corev1.Service, component string) string {
+	return fmt.Sprintf("buffer-service-%s-%s-identity", component, svc.Name)
+}
+
+// spiffeID follows the Istio layout, so mesh AuthorizationPolicies can match
+// buffer services by principal whether or not they run a sidecar.
+func spiffeID(trustDomain, namespace, serviceAccount string) string {
+	if trustDomain == "" {
+		trustDomain = defaultTrustDomain
+	}
+	return fmt.Sprintf("spiffe://%s/ns/%s/sa/%s", trustDomain, namespace, serviceAccount)
+}
+
+// ensureIdentity manages the cert-manager Certificate holding the identity of a
+// buffer service component. When identities are disabled the Certificate and
+// its Secret are removed.
+func (r *FlavourRouterReconciler) ensureIdentity(ctx context.Context, svc *corev1.Service, component string, cfg schedulingv1alpha1.IdentityConfig) error {
+	name := identitySecretName(svc, component)
+	if !cfg.Enabled {
+		return r.deleteIdentity(ctx, svc, component)
+	}
+	if cfg.IssuerRef.Name == "" {
+		return invalidConfigError(fmt.Errorf("spec.identity.issuerRef.name is required when identities are enabled"))
+	}
+
+	issuerKind := cfg.IssuerRef.Kind
+	if issuerKind == "" {
+		issuerKind = defaultIssuerKind
+	}
+	issuerGroup := cfg.IssuerRef.Group
+	if issuerGroup == "" {
+		issuerGroup = certManagerGroup
+	}
+	saName := fmt.Sprintf("%s-trafficschedule-viewer", svc.Name)
+	serviceName := fmt.Sprintf("buffer-service-%s-%s", component, svc.Name)
+	spec := map[string]interface{}{
+		"secretName": name,
+		"uris":       []interface{}{spiffeID(cfg.TrustDomain, svc.Namespace, saName)},
+		"dnsNames": []interface{}{
+			serviceName,
+			fmt.Sprintf("%s.%s.svc", serviceName, svc.Namespace),
+		},
+		"usages":     []interface{}{"digital signature", "key encipherment", "server auth", "client auth"},
+		"privateKey": map[string]interface{}{"algorithm": "ECDSA", "size": int64(256), "rotationPolicy": "Always"},
+		"issuerRef": map[string]interface{}{
+			"name":  cfg.IssuerRef.Name,
+			"kind":  issuerKind,
+			"group": issuerGroup,
+		},
+		"secretTemplate": map[string]interface{}{
+			"labels": map[string]interface{}{
+				parentServiceLabel:             svc.Name,
+				"app.kubernetes.io/managed-by": "carbonrouter-operator",
+			},
+		},
+	}
+
+	cert := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	cert.SetGroupVersionKind(certificateGVK)
+	cert.SetName(name)
+	cert.SetNamespace(svc.Namespace)
+	cert.SetLabels(map[string]string{parentServiceLabel: svc.Name})
+	if err := ctrl.SetControllerReference(svc, cert, r.Scheme); err != nil {
+		return err
+	}
+
+	return r.apply(ctx, svc, "Certificate", cert, spec)
+}
+
+// deleteIdentity removes the Certificate of a component and the Secret issued
+// for it, which cert-manager leaves behind. Clusters without cert-manager have
+// nothing to delete.
+func (r *FlavourRouterReconciler) deleteIdentity(ctx context.Context, svc *corev1.Service, component string) error {
+	name := identitySecretName(svc, component)
+	cert := &unstructured.Unstructured{}
+	cert.SetGroupVersionKind(certificateGVK)
+	if err := r.Get(ctx, client.ObjectKey{Namespace: svc.Namespace, Name: name}, cert); err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil
+		}
+		return client.IgnoreNotFound(err)
+	}
+	if err := r.Delete(ctx, cert); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: svc.Namespace}}
+	if err := r.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	r.Inventory.Drop(client.ObjectKeyFromObject(svc), "Certificate", svc.Namespace, name)
+	return nil
+}
+
+// identityVolume mounts the issued certificate, key and CA bundle into a
+// buffer service container and points it at them.
+func identityVolume(svc *corev1.Service, component string, cfg schedulingv1alpha1.IdentityConfig) (corev1.Volume, corev1.VolumeMount, []corev1.EnvVar) {
+	volume := corev1.Volume{
+		Name: identityVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: identitySecretName(svc, component)},
+		},
+	}
+	mount := corev1.VolumeMount{Name: identityVolumeName, MountPath: identityMountPath, ReadOnly: true}
+	env := []corev1.EnvVar{
+		{Name: "TLS_CERT_FILE", Value: identityMountPath + "/tls.crt"},
+		{Name: "TLS_KEY_FILE", Value: identityMountPath + "/tls.key"},
+		{Name: "TLS_CA_FILE", Value: identityMountPath + "/ca.crt"},
+	}
+	if cfg.ClientAuth {
+		env = append(env, corev1.EnvVar{Name: "TLS_CLIENT_AUTH", Value: "required"})
+	}
+	return volume, mount, env
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestSpiffeID(t *testing.T) {
+	if got := spiffeID("", "shop", "checkout-trafficschedule-viewer"); got != "spiffe://cluster.local/ns/shop/sa/checkout-trafficschedule-viewer" {
+		t.Errorf("default trust domain: got %s", got)
+	}
+	if got := spiffeID("example.org", "shop", "sa"); got != "spiffe://example.org/ns/shop/sa/sa" {
+		t.Errorf("custom trust domain: got %s", got)
+	}
+}
+
+func TestIdentityVolume(t *testing.T) {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout"}}
+	volume, mount, env := identityVolume(svc, "router", schedulingv1alpha1.IdentityConfig{Enabled: true})
+	if volume.Secret.SecretName != "buffer-service-router-checkout-identity" || mount.Name != volume.Name || !mount.ReadOnly {
+		t.Errorf("got volume %+v mounted as %+v, want the identity Secret read-only", volume, mount)
+	}
+	if len(env) != 3 {
+		t.Errorf("got env %v, want the certificate, key and CA only", env)
+	}
+	_, _, env = identityVolume(svc, "router", schedulingv1alpha1.IdentityConfig{Enabled: true, ClientAuth: true})
+	if last := env[len(env)-1]; last.Name != "TLS_CLIENT_AUTH" || last.Value != "required" {
+		t.Errorf("got env %v, want client certificates required", env)
+	}
+}
+
+func TestEnsureIdentity(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	scheme.AddKnownTypeWithName(certificateGVK, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(certificateGVK.GroupVersion().WithKind("CertificateList"), &unstructured.UnstructuredList{})
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout", UID: "checkout"}}
+	var applied map[string]interface{}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			cert := obj.(*unstructured.Unstructured).DeepCopy()
+			applied = cert.Object["spec"].(map[string]interface{})
+			cert.SetResourceVersion("")
+			return c.Create(ctx, cert)
+		},
+	}).Build()
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme, Inventory: NewResourceInventory()}
+	ctx := context.Background()
+
+	err := r.ensureIdentity(ctx, svc, "router", schedulingv1alpha1.IdentityConfig{Enabled: true})
+	if classify(err) != failureInvalidConfig {
+		t.Errorf("missing issuer: got %v, want an invalid configuration", err)
+	}
+
+	cfg := schedulingv1alpha1.IdentityConfig{Enabled: true, IssuerRef: schedulingv1alpha1.IssuerReference{Name: "mesh-ca"}}
+	if err := r.ensureIdentity(ctx, svc, "router", cfg); err != nil {
+		t.Fatal(err)
+	}
+	wantIssuer := map[string]interface{}{"name": "mesh-ca", "kind": defaultIssuerKind, "group": certManagerGroup}
+	if !reflect.DeepEqual(applied["issuerRef"], wantIssuer) {
+		t.Errorf("got issuer %v, want %v", applied["issuerRef"], wantIssuer)
+	}
+	wantURIs := []interface{}{"spiffe://cluster.local/ns/shop/sa/checkout-trafficschedule-viewer"}
+	if !reflect.DeepEqual(applied["uris"], wantURIs) || applied["secretName"] != identitySecretName(svc, "router") {
+		t.Errorf("got uris %v and secret %v, want the SPIFFE id in the identity Secret", applied["uris"], applied["secretName"])
+	}
+
+	name := identitySecretName(svc, "router")
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name}}
+	if err := c.Create(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ensureIdentity(ctx, svc, "router", schedulingv1alpha1.IdentityConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	cert := &unstructured.Unstructured{}
+	cert.SetGroupVersionKind(certificateGVK)
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "shop", Name: name}, cert); !apierrors.IsNotFound(err) {
+		t.Errorf("Certificate kept once disabled: %v", err)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(secret), &corev1.Secret{}); !apierrors.IsNotFound(err) {
+		t.Errorf("issued Secret kept once disabled: %v", err)
+	}
+
+	// Without cert-manager there is nothing to remove
+	plain := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(plain); err != nil {
+		t.Fatal(err)
+	}
+	r = &FlavourRouterReconciler{Client: fake.NewClientBuilder().WithScheme(plain).Build(), Scheme: plain, Inventory: NewResourceInventory()}
+	if err := r.ensureIdentity(ctx, svc, "router", schedulingv1alpha1.IdentityConfig{}); err != nil {
+		t.Errorf("without cert-manager: %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ManagedResource describes a single object the operator applies on behalf of a routed service.
+type ManagedResource struct {
+	Kind        string    `json:"kind"`
+	Namespace   string    `json:"namespace,omitempty"`
+	Name        string    `json:"name"`
+	Hash        string    `json:"hash"`
+	LastApplied time.Time `json:"lastApplied"`
+}
+
+// ServiceInventory groups the managed resources of one routed service.
+type ServiceInventory struct {
+	Namespace string            `json:"namespace"`
+	Service   string            `json:"service"`
+	Resources []ManagedResource `json:"resources"`
+}
+
+// ResourceInventory keeps an in-memory record of every resource managed per service.
+// It is rebuilt from scratch by the reconcilers after a restart, so it reflects what
+// the current leader has applied since it started.
+type ResourceInventory struct {
+	mu       sync.RWMutex
+	services map[types.NamespacedName]map[string]ManagedResource
+}
+
+// NewResourceInventory returns an empty inventory.
+func NewResourceInventory() *ResourceInventory {
+	return &ResourceInventory{services: map[types.NamespacedName]map[string]ManagedResource{}}
+}
+
+func inventoryKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+func specHash(spec interface{}) string {
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(raw))
+}
+
+// Record stores the desired state of a managed resource. LastApplied only moves
+// forward when the operator actually wrote the object (applied=true) or when the
+// resource is seen for the first time.
+func (i *ResourceInventory) Record(service types.NamespacedName, kind, namespace, name string, spec interface{}, applied bool) {
+	if i == nil {
+		return
+	}
+	hash := specHash(spec)
+	key := inventoryKey(kind, namespace, name)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	resources, ok := i.services[service]
+	if !ok {
+		resources = map[string]ManagedResource{}
+		i.services[service] = resources
+	}
+	entry, exists := resources[key]
+	if !exists || applied {
+		entry.LastApplied = time.Now().UTC()
+	}
+	entry.Kind = kind
+	entry.Namespace = namespace
+	entry.Name = name
+	entry.Hash = hash
+	resources[key] = entry
+}
+
+// Has reports whether a resource was already recorded for a service.
+func (i *ResourceInventory) Has(service types.NamespacedName, kind, namespace, name string) bool {
+	if i == nil {
+		return false
+	}
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	_, ok := i.services[service][inventoryKey(kind, namespace, name)]
+	return ok
+}
+
+// Drop removes one resource the operator deleted on purpose, so recreating it
+// later is not mistaken for out-of-band deletion.
+func (i *ResourceInventory) Drop(service types.NamespacedName, kind, namespace, name string) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.services[service], inventoryKey(kind, namespace, name))
+}
+
+// Forget drops every resource recorded for a service.
+func (i *ResourceInventory) Forget(service types.NamespacedName) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.services, service)
+}
+
+// Snapshot returns a sorted copy of the inventory, optionally filtered by namespace and service.
+func (i *ResourceInventory) Snapshot(namespace, service string) []ServiceInventory {
+	if i == nil {
+		return nil
+	}
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	out := make([]ServiceInventory, 0, len(i.services))
+	for key, resources := range i.services {
+		if namespace != "" && key.Namespace != namespace {
+			continue
+		}
+		if service != "" && key.Name != service {
+			continue
+		}
+		entry := ServiceInventory{Namespace: key.Namespace, Service: key.Name}
+		for _, res := range resources {
+			entry.Resources = append(entry.Resources, res)
+		}
+		sort.Slice(entry.Resources, func(a, b int) bool {
+			if entry.Resources[a].Kind != entry.Resources[b].Kind {
+				return entry.Resources[a].Kind < entry.Resources[b].Kind
+			}
+			return entry.Resources[a].Name < entry.Resources[b].Name
+		})
+		out = append(out, entry)
+	}
+	sort.Slice(out, func(a, b int) bool {
+		if out[a].Namespace != out[b].Namespace {
+			return out[a].Namespace < out[b].Namespace
+		}
+		return out[a].Service < out[b].Service
+	})
+	return out
+}
+
+// ServeHTTP renders the inventory as JSON. Supports ?namespace= and ?service= filters.
+func (i *ResourceInventory) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := req.URL.Query()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"services": i.Snapshot(query.Get("namespace"), query.Get("service")),
+	})
+}
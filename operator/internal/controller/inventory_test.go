@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestResourceInventoryRecord(t *testing.T) {
+	checkout := types.NamespacedName{Namespace: "shop", Name: "checkout"}
+	inv := NewResourceInventory()
+	resource := func() ManagedResource {
+		return inv.Snapshot("shop", "checkout")[0].Resources[0]
+	}
+
+	inv.Record(checkout, "VirtualService", "shop", "checkout", map[string]int{"weight": 50}, false)
+	first := resource()
+	if first.LastApplied.IsZero() || first.Hash != specHash(map[string]int{"weight": 50}) {
+		t.Fatalf("first sighting not recorded: %+v", first)
+	}
+
+	inv.Record(checkout, "VirtualService", "shop", "checkout", map[string]int{"weight": 70}, false)
+	unchanged := resource()
+	if !unchanged.LastApplied.Equal(first.LastApplied) {
+		t.Error("LastApplied moved without a write")
+	}
+	if unchanged.Hash == first.Hash {
+		t.Error("hash did not follow the desired state")
+	}
+
+	inv.Record(checkout, "VirtualService", "shop", "checkout", map[string]int{"weight": 70}, true)
+	if applied := resource(); applied.LastApplied.Before(first.LastApplied) {
+		t.Errorf("LastApplied went back on a write: %v before %v", applied.LastApplied, first.LastApplied)
+	}
+	if !inv.Has(checkout, "VirtualService", "shop", "checkout") || inv.Has(checkout, "DestinationRule", "shop", "checkout") {
+		t.Error("Has does not match what was recorded")
+	}
+}
+
+func TestResourceInventorySnapshot(t *testing.T) {
+	checkout := types.NamespacedName{Namespace: "shop", Name: "checkout"}
+	cart := types.NamespacedName{Namespace: "shop", Name: "cart"}
+	search := types.NamespacedName{Namespace: "catalog", Name: "search"}
+	inv := NewResourceInventory()
+	for _, svc := range []types.NamespacedName{checkout, cart, search} {
+		inv.Record(svc, "VirtualService", svc.Namespace, svc.Name, nil, true)
+		inv.Record(svc, "DestinationRule", svc.Namespace, svc.Name, nil, true)
+	}
+	inv.Drop(cart, "VirtualService", "shop", "cart")
+	inv.Forget(search)
+
+	names := func(snapshot []ServiceInventory) []string {
+		var out []string
+		for _, entry := range snapshot {
+			for _, res := range entry.Resources {
+				out = append(out, entry.Service+":"+res.Kind)
+			}
+		}
+		return out
+	}
+	tests := []struct {
+		name      string
+		namespace string
+		service   string
+		want      []string
+	}{
+		{name: "everything, sorted", want: []string{"cart:DestinationRule", "checkout:DestinationRule", "checkout:VirtualService"}},
+		{name: "by service", namespace: "shop", service: "checkout", want: []string{"checkout:DestinationRule", "checkout:VirtualService"}},
+		{name: "forgotten service", namespace: "catalog"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := names(inv.Snapshot(tt.namespace, tt.service)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResourceInventoryServeHTTP(t *testing.T) {
+	inv := NewResourceInventory()
+	inv.Record(types.NamespacedName{Namespace: "shop", Name: "checkout"}, "VirtualService", "shop", "checkout", nil, true)
+	inv.Record(types.NamespacedName{Namespace: "catalog", Name: "search"}, "VirtualService", "catalog", "search", nil, true)
+
+	rec := httptest.NewRecorder()
+	inv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/inventory?namespace=shop", nil))
+	var body struct {
+		Services []ServiceInventory `json:"services"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Services) != 1 || body.Services[0].Service != "checkout" {
+		t.Errorf("namespace filter not applied: %+v", body.Services)
+	}
+
+	rec = httptest.NewRecorder()
+	inv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/inventory", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: got status %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
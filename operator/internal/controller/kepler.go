@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	defaultCalibrationWindowMinutes = 10
+	// keplerInterval is how often the energy of a flavour is measured at most.
+	keplerInterval = time.Minute
+	// keplerMinRequestRate is the request rate, per second, under which the
+	// idle power of the pods would dominate the energy per request, so the
+	// flavour is not measured.
+	keplerMinRequestRate = 0.1
+	// keplerEnergyMetric is the energy Kepler attributes to each container.
+	keplerEnergyMetric = "kepler_container_joules_total"
+	// The requests a flavour served are those its own pods report.
+	keplerTelemetryReporter = "destination"
+	keplerRequestsMetric    = "istio_requests_total"
+	// calibrationTolerance is how far the relative cost of a flavour moves
+	// before the calibration sent to the decision engine is replaced. Every
+	// new configuration is pushed to the engine, which restarts its session.
+	calibrationTolerance = 0.05
+)
+
+// Kepler measures the energy per request of the flavour Deployments, from the
+// energy Kepler attributes to their containers and the requests the Istio
+// telemetry reports they served, both scraped by Prometheus.
+type Kepler struct {
+	prometheusURL string
+
+	mu       sync.Mutex
+	measured map[keplerKey]keplerMeasurement
+	// calibrated holds the relative costs last sent for each schedule.
+	calibrated map[types.NamespacedName]map[string]float64
+}
+
+// NewKepler returns a meter querying the Prometheus HTTP API at
+// prometheusURL.
+func NewKepler(prometheusURL string) *Kepler {
+	return &Kepler{prometheusURL: strings.TrimSuffix(prometheusURL, "/")}
+}
+
+type keplerKey struct {
+	deployment types.NamespacedName
+	window     time.Duration
+}
+
+type keplerMeasurement struct {
+	joulesPerRequest float64
+	ok               bool
+	at               time.Time
+}
+
+// joulesPerRequest measures the energy per request of dep over window, at
+// most every keplerInterval. ok is false when dep served fewer than
+// keplerMinRequestRate requests per second, or Kepler has no energy for it.
+func (k *Kepler) joulesPerRequest(ctx context.Context, dep *appsv1.Deployment, window time.Duration, now time.Time) (float64, bool, error) {
+	key := keplerKey{deployment: types.NamespacedName{Namespace: dep.Namespace, Name: dep.Name}, window: window}
+	k.mu.Lock()
+	cached, found := k.measured[key]
+	k.mu.Unlock()
+	if found && now.Sub(cached.at) < keplerInterval {
+		return cached.joulesPerRequest, cached.ok, nil
+	}
+
+	span := fmt.Sprintf("%dm", int(window.Minutes()))
+	// The pods of a Deployment are named after its ReplicaSets
+	pods := regexp.QuoteMeta(dep.Name) + "-[a-z0-9]+-[a-z0-9]+"
+	watts, ok, err := queryPrometheus(ctx, k.prometheusURL, fmt.Sprintf(`sum(rate(%s{container_namespace=%q,pod_name=~%q}[%s]))`,
+		keplerEnergyMetric, dep.Namespace, pods, span))
+	if err != nil {
+		return 0, false, err
+	}
+	var requests float64
+	if ok {
+		requests, ok, err = queryPrometheus(ctx, k.prometheusURL, fmt.Sprintf(`sum(rate(%s{reporter=%q,destination_workload_namespace=%q,destination_workload=%q}[%s]))`,
+			keplerRequestsMetric, keplerTelemetryReporter, dep.Namespace, dep.Name, span))
+		if err != nil {
+			return 0, false, err
+		}
+	}
+
+	measurement := keplerMeasurement{at: now}
+	if ok && watts > 0 && requests >= keplerMinRequestRate {
+		measurement.joulesPerRequest = watts / requests
+		measurement.ok = true
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.measured == nil {
+		k.measured = map[keplerKey]keplerMeasurement{}
+	}
+	// Deleted Deployments are not measured again
+	for key, entry := range k.measured {
+		if now.Sub(entry.at) > 10*keplerInterval {
+			delete(k.measured, key)
+		}
+	}
+	k.measured[key] = measurement
+	return measurement.joulesPerRequest, measurement.ok, nil
+}
+
+// calibration returns the window of spec.energyCalibration, or false when
+// the spec or the operator does not enable it.
+func (r *TrafficScheduleReconciler) calibration(ts *schedulingv1alpha1.TrafficSchedule) (time.Duration, bool) {
+	cfg := ts.Spec.EnergyCalibration
+	if !cfg.Enabled || r.Kepler == nil {
+		return 0, false
+	}
+	window := defaultCalibrationWindowMinutes * time.Minute
+	if cfg.WindowMinutes != nil {
+		window = time.Duration(*cfg.WindowMinutes) * time.Minute
+	}
+	return window, true
+}
+
+// calibrate replaces the carbon cost of flavours with the energy per request
+// Kepler measured for their Deployments in sources, relative to the costliest
+// flavour. The labels are relative costs too, so they are only replaced once
+// every flavour is measured, never mixed with measurements.
+func (r *TrafficScheduleReconciler) calibrate(ctx context.Context, ts *schedulingv1alpha1.TrafficSchedule, flavours []schedulerFlavour, sources map[string]*appsv1.Deployment) {
+	window, ok := r.calibration(ts)
+	if !ok || len(flavours) == 0 {
+		return
+	}
+	logger := ctrl.LoggerFrom(ctx).WithName("[TrafficSchedule][Calibration]")
+	now := time.Now()
+	joules := make(map[string]float64, len(flavours))
+	for _, flavour := range flavours {
+		dep := sources[flavour.Name]
+		if dep == nil {
+			continue
+		}
+		value, measured, err := r.Kepler.joulesPerRequest(ctx, dep, window, now)
+		if err != nil {
+			logger.Error(err, "Failed to measure the flavour energy", "deployment", dep.Name)
+			continue
+		}
+		if measured {
+			joules[flavour.Name] = value
+		}
+	}
+	for i, flavour := range flavours {
+		if value, ok := joules[flavour.Name]; ok {
+			flavours[i].JoulesPerRequest = &value
+		}
+	}
+	names := make([]string, 0, len(flavours))
+	for _, flavour := range flavours {
+		names = append(names, flavour.Name)
+	}
+	costs := relativeCosts(joules)
+	if len(costs) != len(flavours) {
+		costs = nil
+	}
+	costs = r.Kepler.settle(types.NamespacedName{Namespace: ts.Namespace, Name: ts.Name}, names, costs)
+	if costs == nil {
+		logger.V(1).Info("Keeping the carbonstat.emissions labels until every flavour is measured", "measured", len(joules), "flavours", len(flavours))
+		return
+	}
+	for i := range flavours {
+		flavours[i].CarbonIntensity = costs[flavours[i].Name]
+	}
+}
+
+// settle returns the relative costs the flavours of schedule, named names,
+// are sent with. Measurements are rounded to hundredths and only replace the
+// costs sent before when a flavour moved by more than calibrationTolerance, so
+// the noise of the measurements does not reconfigure the decision engine. While
+// a flavour cannot be measured (costs is nil), the costs sent before stay;
+// nil means the flavours were never calibrated as they are.
+func (k *Kepler) settle(schedule types.NamespacedName, names []string, costs map[string]float64) map[string]float64 {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	previous := k.calibrated[schedule]
+	if len(previous) != len(names) {
+		previous = nil
+	}
+	for _, name := range names {
+		if _, ok := previous[name]; !ok {
+			previous = nil
+		}
+	}
+	if costs == nil {
+		return previous
+	}
+	rounded := make(map[string]float64, len(costs))
+	moved := previous == nil
+	for name, cost := range costs {
+		rounded[name] = max(0.01, math.Round(cost*100)/100)
+		if math.Abs(rounded[name]-previous[name]) > calibrationTolerance {
+			moved = true
+		}
+	}
+	if !moved {
+		return previous
+	}
+	if k.calibrated == nil {
+		k.calibrated = map[types.NamespacedName]map[string]float64{}
+	}
+	k.calibrated[schedule] = rounded
+	return rounded
+}
+
+// forget drops the calibration of a deleted schedule.
+func (k *Kepler) forget(schedule types.NamespacedName) {
+	if k == nil {
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.calibrated, schedule)
+}
+
+// relativeCosts scales the energy per request of each flavour to the
+// costliest one, as the carbonstat.emissions labels and the CPU of right-sized
+// flavours are.
+func relativeCosts(joules map[string]float64) map[string]float64 {
+	highest := 0.0
+	for _, value := range joules {
+		highest = max(highest, value)
+	}
+	if highest <= 0 {
+		return nil
+	}
+	costs := make(map[string]float64, len(joules))
+	for name, value := range joules {
+		costs[name] = value / highest
+	}
+	return costs
+}
+
+// measuredJoules returns the energy per request measured for the flavour of
+// precision, empty when it was not.
+func measuredJoules(flavours []schedulerFlavour, precision int) string {
+	for _, flavour := range flavours {
+		if flavour.JoulesPerRequest != nil && int(math.Round(flavour.Precision*100)) == precision {
+			return formatFloat(*flavour.JoulesPerRequest)
+		}
+	}
+	return ""
+}
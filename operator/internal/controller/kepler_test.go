@@ -0,0 +1,241 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+// fakePrometheus answers the energy and request rate queries of each
+// Deployment with watts and requests, leaving out those it has no value for.
+type fakePrometheus struct {
+	watts    map[string]float64
+	requests map[string]float64
+	queries  atomic.Int32
+}
+
+func (p *fakePrometheus) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	p.queries.Add(1)
+	query := req.URL.Query().Get("query")
+	values := p.requests
+	if strings.Contains(query, keplerEnergyMetric) {
+		values = p.watts
+	}
+	result := "[]"
+	for name, value := range values {
+		if strings.Contains(query, fmt.Sprintf("%q", name)) || strings.Contains(query, fmt.Sprintf(`"%s-`, name)) {
+			result = fmt.Sprintf(`[{"metric":{},"value":[1700000000,"%g"]}]`, value)
+		}
+	}
+	fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":%s}}`, result)
+}
+
+func flavourDeployment(name string) *appsv1.Deployment {
+	return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name}}
+}
+
+func TestKeplerJoulesPerRequest(t *testing.T) {
+	prom := &fakePrometheus{
+		watts:    map[string]float64{"busy": 20, "idle": 5, "unscraped": 0},
+		requests: map[string]float64{"busy": 10, "idle": 0.05, "unscraped": 4},
+	}
+	server := httptest.NewServer(prom)
+	defer server.Close()
+
+	tests := []struct {
+		deployment string
+		joules     float64
+		ok         bool
+	}{
+		{deployment: "busy", joules: 2, ok: true},
+		{deployment: "idle"},
+		{deployment: "unscraped"},
+		{deployment: "missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.deployment, func(t *testing.T) {
+			k := NewKepler(server.URL + "/")
+			joules, ok, err := k.joulesPerRequest(context.Background(), flavourDeployment(tt.deployment), 10*time.Minute, time.Now())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok != tt.ok || joules != tt.joules {
+				t.Errorf("got %v joules (ok %v), want %v (ok %v)", joules, ok, tt.joules, tt.ok)
+			}
+		})
+	}
+}
+
+func TestKeplerJoulesPerRequestCached(t *testing.T) {
+	prom := &fakePrometheus{watts: map[string]float64{"busy": 20}, requests: map[string]float64{"busy": 10}}
+	server := httptest.NewServer(prom)
+	defer server.Close()
+
+	k := NewKepler(server.URL)
+	dep := flavourDeployment("busy")
+	now := time.Now()
+	for _, at := range []time.Time{now, now.Add(keplerInterval / 2)} {
+		if _, ok, err := k.joulesPerRequest(context.Background(), dep, 10*time.Minute, at); err != nil || !ok {
+			t.Fatalf("measurement failed: ok %v, err %v", ok, err)
+		}
+	}
+	if got := prom.queries.Load(); got != 2 {
+		t.Errorf("measured again within keplerInterval: %d queries, want 2", got)
+	}
+	if _, _, err := k.joulesPerRequest(context.Background(), dep, 10*time.Minute, now.Add(keplerInterval)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := prom.queries.Load(); got != 4 {
+		t.Errorf("not measured again after keplerInterval: %d queries, want 4", got)
+	}
+}
+
+func TestKeplerJoulesPerRequestUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	if _, ok, err := NewKepler(server.URL).joulesPerRequest(context.Background(), flavourDeployment("busy"), time.Minute, time.Now()); err == nil || ok {
+		t.Errorf("got ok %v, err %v, want an error", ok, err)
+	}
+}
+
+func TestCalibration(t *testing.T) {
+	kepler := NewKepler("http://prometheus")
+	tests := []struct {
+		name   string
+		kepler *Kepler
+		cfg    schedulingv1alpha1.EnergyCalibrationConfig
+		window time.Duration
+		ok     bool
+	}{
+		{name: "disabled", kepler: kepler},
+		{name: "without kepler", cfg: schedulingv1alpha1.EnergyCalibrationConfig{Enabled: true}},
+		{name: "default window", kepler: kepler, cfg: schedulingv1alpha1.EnergyCalibrationConfig{Enabled: true},
+			window: defaultCalibrationWindowMinutes * time.Minute, ok: true},
+		{name: "window", kepler: kepler, cfg: schedulingv1alpha1.EnergyCalibrationConfig{Enabled: true, WindowMinutes: ptr.To[int32](3)},
+			window: 3 * time.Minute, ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &TrafficScheduleReconciler{Kepler: tt.kepler}
+			ts := &schedulingv1alpha1.TrafficSchedule{Spec: schedulingv1alpha1.TrafficScheduleSpec{EnergyCalibration: tt.cfg}}
+			window, ok := r.calibration(ts)
+			if window != tt.window || ok != tt.ok {
+				t.Errorf("got %v (ok %v), want %v (ok %v)", window, ok, tt.window, tt.ok)
+			}
+		})
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	prom := &fakePrometheus{
+		watts:    map[string]float64{"p100": 40, "p50": 12, "p30": 5},
+		requests: map[string]float64{"p100": 10, "p50": 6, "p30": 0.01},
+	}
+	server := httptest.NewServer(prom)
+	defer server.Close()
+	ts := &schedulingv1alpha1.TrafficSchedule{Spec: schedulingv1alpha1.TrafficScheduleSpec{
+		EnergyCalibration: schedulingv1alpha1.EnergyCalibrationConfig{Enabled: true},
+	}}
+	flavours := func() []schedulerFlavour {
+		return []schedulerFlavour{
+			{Name: "precision-100", Precision: 1, CarbonIntensity: 1},
+			{Name: "precision-50", Precision: 0.5, CarbonIntensity: 0.6},
+			{Name: "precision-30", Precision: 0.3, CarbonIntensity: 0.3},
+		}
+	}
+	sources := map[string]*appsv1.Deployment{
+		"precision-100": flavourDeployment("p100"),
+		"precision-50":  flavourDeployment("p50"),
+		"precision-30":  flavourDeployment("p30"),
+	}
+	r := &TrafficScheduleReconciler{Kepler: NewKepler(server.URL)}
+
+	// precision-30 serves too few requests to be measured
+	partial := flavours()
+	r.calibrate(context.Background(), ts, partial, sources)
+	for i, want := range []float64{1, 0.6, 0.3} {
+		if partial[i].CarbonIntensity != want {
+			t.Errorf("%s: got %v, want the label %v", partial[i].Name, partial[i].CarbonIntensity, want)
+		}
+	}
+	if partial[0].JoulesPerRequest == nil || *partial[0].JoulesPerRequest != 4 || partial[2].JoulesPerRequest != nil {
+		t.Errorf("measured joules not reported: %+v", partial)
+	}
+
+	prom.requests["p30"] = 5
+	r = &TrafficScheduleReconciler{Kepler: NewKepler(server.URL)}
+	full := flavours()
+	r.calibrate(context.Background(), ts, full, sources)
+	for i, want := range []float64{1, 0.5, 0.25} {
+		if full[i].CarbonIntensity != want {
+			t.Errorf("%s: got %v, want %v", full[i].Name, full[i].CarbonIntensity, want)
+		}
+	}
+
+	// Once calibrated, a flavour losing its traffic keeps the calibration
+	prom.requests["p30"] = 0.01
+	r.Kepler.measured = nil
+	later := flavours()
+	r.calibrate(context.Background(), ts, later, sources)
+	for i, want := range []float64{1, 0.5, 0.25} {
+		if later[i].CarbonIntensity != want {
+			t.Errorf("%s: got %v, want the calibration %v", later[i].Name, later[i].CarbonIntensity, want)
+		}
+	}
+}
+
+func TestKeplerSettle(t *testing.T) {
+	schedule := types.NamespacedName{Namespace: "shop", Name: "green"}
+	names := []string{"precision-100", "precision-50"}
+	k := NewKepler("http://prometheus")
+
+	steps := []struct {
+		name  string
+		names []string
+		costs map[string]float64
+		want  map[string]float64
+	}{
+		{name: "never calibrated", names: names},
+		{name: "first calibration is rounded", names: names,
+			costs: map[string]float64{"precision-100": 1, "precision-50": 0.4321},
+			want:  map[string]float64{"precision-100": 1, "precision-50": 0.43}},
+		{name: "noise is ignored", names: names,
+			costs: map[string]float64{"precision-100": 1, "precision-50": 0.47},
+			want:  map[string]float64{"precision-100": 1, "precision-50": 0.43}},
+		{name: "unmeasured flavour keeps the calibration", names: names,
+			want: map[string]float64{"precision-100": 1, "precision-50": 0.43}},
+		{name: "a move beyond the tolerance replaces it", names: names,
+			costs: map[string]float64{"precision-100": 1, "precision-50": 0.6},
+			want:  map[string]float64{"precision-100": 1, "precision-50": 0.6}},
+		{name: "cheap flavours keep a cost", names: names,
+			costs: map[string]float64{"precision-100": 1, "precision-50": 0.001},
+			want:  map[string]float64{"precision-100": 1, "precision-50": 0.01}},
+		{name: "other flavours are not calibrated", names: []string{"precision-100", "precision-30"}},
+	}
+	for _, step := range steps {
+		if got := k.settle(schedule, step.names, step.costs); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: got %v, want %v", step.name, got, step.want)
+		}
+	}
+
+	k.forget(schedule)
+	if got := k.settle(schedule, names, nil); got != nil {
+		t.Errorf("forgotten schedule still calibrated: %v", got)
+	}
+}
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	// killSwitchConfigMap is the cluster-wide emergency switch. It lives in the
+	// operator namespace and is engaged while its "enabled" key is "true".
+	killSwitchConfigMap = "carbonrouter-kill-switch"
+	killSwitchKey       = "enabled"
+	killSwitchPolicy    = "kill-switch"
+)
+
+// killSwitchEngaged reports whether the emergency switch is on. An empty
+// namespace disables the switch altogether.
+func killSwitchEngaged(ctx context.Context, c client.Reader, namespace string) (bool, error) {
+	if namespace == "" {
+		return false, nil
+	}
+	var cm corev1.ConfigMap
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: killSwitchConfigMap}, &cm); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	engaged, err := strconv.ParseBool(strings.TrimSpace(cm.Data[killSwitchKey]))
+	return err == nil && engaged, nil
+}
+
+// killSwitchPredicate lets only the switch ConfigMap through.
+func killSwitchPredicate(namespace string) predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return obj.GetNamespace() == namespace && obj.GetName() == killSwitchConfigMap
+	})
+}
+
+// killSwitchStatus overrides a schedule with carbon-agnostic behaviour: all
+// traffic goes to the highest precision, no replica ceiling or processing
+// throttle applies and zone forecasts are dropped so locality falls back to
+// plain failover.
+func killSwitchStatus(status schedulingv1alpha1.TrafficScheduleStatus) schedulingv1alpha1.TrafficScheduleStatus {
+	return pinnedStatus(status, highestPrecision(status.Flavours), killSwitchPolicy)
+}
+
+func highestPrecision(flavours []schedulingv1alpha1.FlavourDecision) int {
+	highest := 0
+	for _, flavour := range flavours {
+		if flavour.Precision > highest {
+			highest = flavour.Precision
+		}
+	}
+	return highest
+}
+
+// pinnedStatus sends all the traffic of a schedule to precision, lifting the
+// replica ceilings and processing throttle, under policy.
+func pinnedStatus(status schedulingv1alpha1.TrafficScheduleStatus, precision int, policy string) schedulingv1alpha1.TrafficScheduleStatus {
+	out := *status.DeepCopy()
+	for i := range out.Flavours {
+		out.Flavours[i].Weight = 0
+		out.Flavours[i].Concurrency = ""
+		if out.Flavours[i].Precision == precision {
+			out.Flavours[i].Weight = 100
+		}
+	}
+	out.ActivePolicy = policy
+	out.ProcessingThrottle = "1"
+	out.EffectiveReplicaCeilings = nil
+	out.ZoneForecasts = nil
+	return out
+}
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestKillSwitchEngaged(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		namespace string
+		value     *string
+		want      bool
+	}{
+		{name: "disabled without a namespace", value: ptr.To("true")},
+		{name: "no ConfigMap", namespace: "carbonrouter-system"},
+		{name: "engaged", namespace: "carbonrouter-system", value: ptr.To(" TRUE "), want: true},
+		{name: "released", namespace: "carbonrouter-system", value: ptr.To("false")},
+		{name: "unparsable value", namespace: "carbonrouter-system", value: ptr.To("yes please")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := fake.NewClientBuilder().WithScheme(scheme)
+			if tt.value != nil {
+				builder = builder.WithObjects(&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "carbonrouter-system", Name: killSwitchConfigMap},
+					Data:       map[string]string{killSwitchKey: *tt.value},
+				})
+			}
+			got, err := killSwitchEngaged(context.Background(), builder.Build(), tt.namespace)
+			if err != nil || got != tt.want {
+				t.Errorf("got %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestKillSwitchPredicate(t *testing.T) {
+	pred := killSwitchPredicate("carbonrouter-system")
+	objects := []struct {
+		namespace, name string
+		want            bool
+	}{
+		{namespace: "carbonrouter-system", name: killSwitchConfigMap, want: true},
+		{namespace: "shop", name: killSwitchConfigMap},
+		{namespace: "carbonrouter-system", name: "other"},
+	}
+	for _, obj := range objects {
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: obj.namespace, Name: obj.name}}
+		if got := pred.Generic(event.GenericEvent{Object: cm}); got != obj.want {
+			t.Errorf("%s/%s: got %v, want %v", obj.namespace, obj.name, got, obj.want)
+		}
+	}
+}
+
+func TestKillSwitchStatus(t *testing.T) {
+	status := schedulingv1alpha1.TrafficScheduleStatus{
+		ActivePolicy:             "credit-greedy",
+		ProcessingThrottle:       "0.4",
+		EffectiveReplicaCeilings: map[string]int32{"consumer": 2},
+		ZoneForecasts:            map[string]string{"eu/a": "120"},
+		Flavours: []schedulingv1alpha1.FlavourDecision{
+			{Precision: 50, Weight: 70, Concurrency: "0.5"},
+			{Precision: 100, Weight: 30},
+			{Precision: 30, Weight: 0, Concurrency: "0.2"},
+		},
+	}
+	got := killSwitchStatus(status)
+	want := schedulingv1alpha1.TrafficScheduleStatus{
+		ActivePolicy:       killSwitchPolicy,
+		ProcessingThrottle: "1",
+		Flavours: []schedulingv1alpha1.FlavourDecision{
+			{Precision: 50},
+			{Precision: 100, Weight: 100},
+			{Precision: 30},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+	if status.Flavours[0].Weight != 70 || status.EffectiveReplicaCeilings == nil {
+		t.Error("the schedule itself was modified")
+	}
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"maps"
+	"slices"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	// conditionScheduleFallback is True while the operator stands in for an
+	// unreachable decision engine with the last known good schedule, or with
+	// full precision once its grace period is over.
+	conditionScheduleFallback = "carbonrouter.io/ScheduleFallback"
+	fallbackPolicy            = "fallback-full-precision"
+)
+
+// engineError marks a failure to get a schedule out of the decision engine, as
+// opposed to a failure of the API server.
+type engineError struct {
+	err error
+}
+
+func (e *engineError) Error() string { return e.err.Error() }
+
+func (e *engineError) Unwrap() error { return e.err }
+
+func engineFailure(err error) error {
+	return &engineError{err: err}
+}
+
+// lastKnownGood keeps the routing and scaling part of a schedule published by
+// the decision engine.
+func lastKnownGood(status schedulingv1alpha1.TrafficScheduleStatus) *schedulingv1alpha1.LastKnownGoodSchedule {
+	return &schedulingv1alpha1.LastKnownGoodSchedule{
+		Flavours:                 slices.Clone(status.Flavours),
+		ActivePolicy:             status.ActivePolicy,
+		ProcessingThrottle:       status.ProcessingThrottle,
+		EffectiveReplicaCeilings: maps.Clone(status.EffectiveReplicaCeilings),
+		ValidUntil:               status.ValidUntil,
+	}
+}
+
+// applyLastKnownGood replaces the expired schedule of ts with its last known
+// good schedule, or with full precision and no ceilings once
+// spec.scheduler.fallbackGraceSeconds have passed since that schedule expired.
+// The replacement is valid for one poll interval, so routers and ScaledObjects
+// keep being reconciled against it. It reports whether the status changed;
+// schedules that are still valid or were never computed are left alone.
+func applyLastKnownGood(ts *schedulingv1alpha1.TrafficSchedule, now time.Time) bool {
+	lkg := ts.Status.LastKnownGood
+	if lkg == nil || now.Before(ts.Status.ValidUntil.Time) {
+		return false
+	}
+	status := *ts.Status.DeepCopy()
+	cond := metav1.Condition{
+		Type:               conditionScheduleFallback,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: ts.Generation,
+	}
+	grace := ts.Spec.Scheduler.FallbackGraceSeconds
+	if grace != nil && now.After(lkg.ValidUntil.Add(time.Duration(*grace)*time.Second)) {
+		status.Flavours = slices.Clone(lkg.Flavours)
+		status = killSwitchStatus(status)
+		status.ActivePolicy = fallbackPolicy
+		cond.Reason = "GracePeriodExpired"
+		cond.Message = "decision engine unreachable past the grace period, routing at full precision"
+	} else {
+		status.Flavours = slices.Clone(lkg.Flavours)
+		status.ActivePolicy = lkg.ActivePolicy
+		status.ProcessingThrottle = lkg.ProcessingThrottle
+		status.EffectiveReplicaCeilings = maps.Clone(lkg.EffectiveReplicaCeilings)
+		cond.Reason = "LastKnownGood"
+		cond.Message = "decision engine unreachable, applying the schedule valid until " + lkg.ValidUntil.UTC().Format(time.RFC3339)
+	}
+	status.ValidUntil = metav1.NewTime(now.Add(pollInterval).UTC().Truncate(time.Second))
+	meta.SetStatusCondition(&status.Conditions, cond)
+	ts.Status = status
+	return true
+}
+
+// fallbackRequeue returns when a schedule standing in for the decision engine
+// must be refreshed, and false when no fallback is active.
+func fallbackRequeue(ts *schedulingv1alpha1.TrafficSchedule) (time.Duration, bool) {
+	if !meta.IsStatusConditionTrue(ts.Status.Conditions, conditionScheduleFallback) {
+		return 0, false
+	}
+	return max(time.Until(ts.Status.ValidUntil.Time), time.Second), true
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestApplyLastKnownGood(t *testing.T) {
+	expiry := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	good := schedulingv1alpha1.TrafficScheduleStatus{
+		Flavours:                 []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 20}, {Precision: 50, Weight: 80}},
+		ActivePolicy:             "credit-greedy",
+		ProcessingThrottle:       "0.5",
+		EffectiveReplicaCeilings: map[string]int32{"consumer": 2},
+		ValidUntil:               metav1.NewTime(expiry),
+	}
+	schedule := func(grace *int32) *schedulingv1alpha1.TrafficSchedule {
+		ts := &schedulingv1alpha1.TrafficSchedule{ObjectMeta: metav1.ObjectMeta{Generation: 2}}
+		ts.Spec.Scheduler.FallbackGraceSeconds = grace
+		ts.Status = *good.DeepCopy()
+		ts.Status.LastKnownGood = lastKnownGood(good)
+		// The engine answered with a degraded schedule before going away
+		ts.Status.Flavours[1].Weight = 0
+		ts.Status.ActivePolicy = "stale"
+		return ts
+	}
+
+	ts := schedule(nil)
+	if applyLastKnownGood(ts, expiry.Add(-time.Second)) {
+		t.Error("schedule replaced before its expiry")
+	}
+	ts.Status.LastKnownGood = nil
+	if applyLastKnownGood(ts, expiry.Add(time.Hour)) {
+		t.Error("schedule replaced without a last known good one")
+	}
+
+	now := expiry.Add(time.Hour)
+	ts = schedule(nil)
+	if !applyLastKnownGood(ts, now) {
+		t.Fatal("expired schedule kept")
+	}
+	if ts.Status.ActivePolicy != "credit-greedy" || ts.Status.Flavours[1].Weight != 80 || ts.Status.EffectiveReplicaCeilings["consumer"] != 2 {
+		t.Errorf("got %+v, want the last known good schedule", ts.Status)
+	}
+	if want := now.Add(pollInterval); !ts.Status.ValidUntil.Time.Equal(want) {
+		t.Errorf("got valid until %v, want one poll interval from now", ts.Status.ValidUntil)
+	}
+	cond := meta.FindStatusCondition(ts.Status.Conditions, conditionScheduleFallback)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != "LastKnownGood" || cond.ObservedGeneration != 2 {
+		t.Errorf("got condition %v, want the last known good fallback", cond)
+	}
+	ts.Status.Flavours[0].Weight = 0
+	if ts.Status.LastKnownGood.Flavours[0].Weight != 20 {
+		t.Error("fallback shares its flavours with the last known good schedule")
+	}
+
+	// Within the grace period
+	ts = schedule(ptr.To[int32](7200))
+	applyLastKnownGood(ts, now)
+	if ts.Status.ActivePolicy != "credit-greedy" {
+		t.Errorf("got policy %q within the grace period, want the last known good one", ts.Status.ActivePolicy)
+	}
+
+	// Past the grace period
+	ts = schedule(ptr.To[int32](600))
+	applyLastKnownGood(ts, now)
+	if ts.Status.ActivePolicy != fallbackPolicy || ts.Status.Flavours[0].Weight != 100 || ts.Status.Flavours[1].Weight != 0 {
+		t.Errorf("got %+v past the grace period, want full precision", ts.Status)
+	}
+	if ts.Status.ProcessingThrottle != "1" || ts.Status.EffectiveReplicaCeilings != nil {
+		t.Errorf("got throttle %q and ceilings %v, want both lifted", ts.Status.ProcessingThrottle, ts.Status.EffectiveReplicaCeilings)
+	}
+	if cond := meta.FindStatusCondition(ts.Status.Conditions, conditionScheduleFallback); cond.Reason != "GracePeriodExpired" {
+		t.Errorf("got reason %q, want GracePeriodExpired", cond.Reason)
+	}
+}
+
+func TestFallbackRequeue(t *testing.T) {
+	ts := &schedulingv1alpha1.TrafficSchedule{}
+	if _, ok := fallbackRequeue(ts); ok {
+		t.Error("requeue asked without a fallback")
+	}
+	meta.SetStatusCondition(&ts.Status.Conditions, metav1.Condition{Type: conditionScheduleFallback, Status: metav1.ConditionTrue, Reason: "LastKnownGood"})
+	ts.Status.ValidUntil = metav1.NewTime(time.Now().Add(30 * time.Second))
+	if after, ok := fallbackRequeue(ts); !ok || after <= 20*time.Second || after > 30*time.Second {
+		t.Errorf("got requeue after %v (%v), want the fallback expiry", after, ok)
+	}
+	ts.Status.ValidUntil = metav1.NewTime(time.Now().Add(-time.Minute))
+	if after, _ := fallbackRequeue(ts); after != time.Second {
+		t.Errorf("expired fallback: got requeue after %v, want 1s", after)
+	}
+}
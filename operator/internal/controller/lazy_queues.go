@@ -0,0 +1,266 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	defaultLazyQueuesAfter    = 300 * time.Second
+	defaultLazyQueuesOverflow = "reject-publish"
+	// defaultLazyQueuesPriority only outranks the topology policy of the
+	// Service, so policies set by the broker operators keep precedence.
+	defaultLazyQueuesPriority = 1
+	// lazyQueuesSinceAnnotation records on a Service since when its schedule
+	// throttles processing, so the countdown and the policy outlive restarts.
+	lazyQueuesSinceAnnotation = "carbonrouter.io/lazy-queues-since"
+)
+
+// lazyQueuesTracker remembers, per Service, which broker policy was last set.
+// It starts empty, so after a restart the first reconcile of each Service sets
+// or removes the policy.
+type lazyQueuesTracker struct {
+	mu    sync.Mutex
+	state map[types.NamespacedName]lazyQueuesState
+}
+
+type lazyQueuesState struct {
+	// applied is the policy body in place on the broker, empty when none is.
+	applied string
+	synced  bool
+}
+
+func (t *lazyQueuesTracker) get(key types.NamespacedName) lazyQueuesState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state[key]
+}
+
+func (t *lazyQueuesTracker) set(key types.NamespacedName, state lazyQueuesState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.state == nil {
+		t.state = map[types.NamespacedName]lazyQueuesState{}
+	}
+	t.state[key] = state
+}
+
+func (t *lazyQueuesTracker) forget(key types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.state, key)
+}
+
+// processingThrottled reports whether the schedule holds messages back in the
+// buffered queues until the carbon intensity drops.
+func processingThrottled(status schedulingv1alpha1.TrafficScheduleStatus) bool {
+	throttle, err := strconv.ParseFloat(strings.TrimSpace(status.ProcessingThrottle), 64)
+	return err == nil && throttle < 1
+}
+
+// lazyQueuesPolicyName names the policy of a Service. Kubernetes names hold no
+// dots, so the names of different Services cannot collide.
+func lazyQueuesPolicyName(namespace, service string) string {
+	return fmt.Sprintf("carbonrouter.lazy.%s.%s", namespace, service)
+}
+
+// lazyQueuesPolicy renders the policy body for the buffered queues of a Service,
+// empty when it would set nothing. Only the highest priority policy applies to
+// a queue, so it carries the queue arguments of the managed topology too.
+// Without lazyMode, for brokers ignoring it, only the length cap is left.
+func lazyQueuesPolicy(naming queueNaming, namespace, service string, cfg schedulingv1alpha1.LazyQueuesConfig, topology schedulingv1alpha1.QueueTopologyConfig, lazyMode bool) (string, error) {
+	definition := map[string]interface{}{}
+	for key, value := range topologyDefinition(naming, namespace, service, topology) {
+		definition[key] = value
+	}
+	if lazyMode {
+		definition["queue-mode"] = "lazy"
+	} else {
+		delete(definition, "queue-mode")
+	}
+	if cfg.MaxLength != nil {
+		overflow := cfg.Overflow
+		if overflow == "" {
+			overflow = defaultLazyQueuesOverflow
+		}
+		definition["max-length"] = *cfg.MaxLength
+		definition["overflow"] = overflow
+	}
+	if len(definition) == 0 {
+		return "", nil
+	}
+	priority := int32(defaultLazyQueuesPriority)
+	if cfg.Priority != nil {
+		priority = *cfg.Priority
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"pattern":    "^" + naming.bufferedQueuePattern(namespace, service) + "$",
+		"apply-to":   "queues",
+		"priority":   priority,
+		"definition": definition,
+	})
+	return string(body), err
+}
+
+// ensureLazyQueues sets the lazy queue policy of svc once its schedule has
+// throttled processing for spec.broker.lazyQueues.afterSeconds, and removes it
+// when the throttle lifts or the policy is disabled. It returns how long until a
+// pending policy is due. The broker is only called when the policy changes.
+func (r *FlavourRouterReconciler) ensureLazyQueues(ctx context.Context, svc *corev1.Service, ts *schedulingv1alpha1.TrafficSchedule, naming queueNaming) (time.Duration, error) {
+	cfg := ts.Spec.Broker.LazyQueues
+	// Lazy queues are a RabbitMQ policy
+	if brokerType(ts.Spec.Broker) != brokerTypeRabbitMQ {
+		cfg.Enabled = false
+	}
+	key := client.ObjectKeyFromObject(svc)
+	now := time.Now()
+	state := r.lazyQueues.get(key)
+	since, _ := time.Parse(time.RFC3339, svc.Annotations[lazyQueuesSinceAnnotation])
+	if !cfg.Enabled || !processingThrottled(ts.Status) {
+		since = time.Time{}
+	} else if since.IsZero() {
+		since = now
+	}
+	if err := r.setLazyQueuesSince(ctx, svc, since); err != nil {
+		return 0, err
+	}
+
+	desired := ""
+	var wait time.Duration
+	if !since.IsZero() {
+		after := defaultLazyQueuesAfter
+		if cfg.AfterSeconds != nil {
+			after = time.Duration(*cfg.AfterSeconds) * time.Second
+		}
+		if due := since.Add(after); now.Before(due) {
+			wait = due.Sub(now)
+		} else {
+			policy, err := lazyQueuesPolicy(naming, svc.Namespace, svc.Name, cfg, ts.Spec.Broker.Topology, true)
+			if err != nil {
+				return 0, err
+			}
+			desired = policy
+		}
+	}
+	// Services that never enabled the policy have none to remove
+	if state.applied == desired && (state.synced || !cfg.Enabled) {
+		return wait, nil
+	}
+
+	broker, err := r.brokerFor(ctx, svc.Namespace, ts.Spec.Broker)
+	if err == nil {
+		body := desired
+		if desired != "" {
+			// desired is what the tracker compares; the broker may not take the lazy mode
+			var lazyMode bool
+			if lazyMode, err = brokerHonoursLazyMode(ctx, broker); err == nil {
+				body, err = lazyQueuesPolicy(naming, svc.Namespace, svc.Name, cfg, ts.Spec.Broker.Topology, lazyMode)
+			}
+		}
+		if err == nil {
+			err = syncLazyQueuesPolicy(ctx, broker, lazyQueuesPolicyName(svc.Namespace, svc.Name), body)
+		}
+	}
+	if err != nil {
+		state.synced = false
+		r.lazyQueues.set(key, state)
+		return wait, err
+	}
+	switch {
+	case desired != "" && state.applied == "":
+		recordEvent(r.Recorder, svc, corev1.EventTypeNormal, eventLazyQueuesApplied,
+			"Buffered queues switched to lazy mode after %s of throttled processing", now.Sub(since).Round(time.Second))
+	case desired == "" && state.applied != "":
+		recordEvent(r.Recorder, svc, corev1.EventTypeNormal, eventLazyQueuesReverted, "Lazy queue policy removed, buffered queues back to their default mode")
+	}
+	state.applied = desired
+	state.synced = true
+	r.lazyQueues.set(key, state)
+	return wait, nil
+}
+
+// setLazyQueuesSince records since on svc, removing the annotation when zero.
+func (r *FlavourRouterReconciler) setLazyQueuesSince(ctx context.Context, svc *corev1.Service, since time.Time) error {
+	value := ""
+	if !since.IsZero() {
+		value = since.UTC().Format(time.RFC3339)
+	}
+	if svc.Annotations[lazyQueuesSinceAnnotation] == value {
+		return nil
+	}
+	patch := client.MergeFrom(svc.DeepCopy())
+	if value == "" {
+		delete(svc.Annotations, lazyQueuesSinceAnnotation)
+	} else {
+		if svc.Annotations == nil {
+			svc.Annotations = map[string]string{}
+		}
+		svc.Annotations[lazyQueuesSinceAnnotation] = value
+	}
+	return r.Patch(ctx, svc, patch)
+}
+
+// brokerHonoursLazyMode reports whether broker still implements the lazy queue
+// mode. RabbitMQ 3.12 and later keep every classic queue on disk and ignore it.
+func brokerHonoursLazyMode(ctx context.Context, broker brokerEndpoint) (bool, error) {
+	var overview struct {
+		Version string `json:"rabbitmq_version"`
+	}
+	if err := managementCall(ctx, broker, http.MethodGet, "overview", nil, &overview); err != nil {
+		return false, err
+	}
+	return lazyModeSupported(overview.Version), nil
+}
+
+// lazyModeSupported reports whether a RabbitMQ version predates 3.12. Versions
+// it cannot parse are given the lazy mode, which they ignore at worst.
+func lazyModeSupported(version string) bool {
+	fields := strings.SplitN(version, ".", 3)
+	if len(fields) < 2 {
+		return true
+	}
+	major, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return true
+	}
+	minor, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return true
+	}
+	return major < 3 || major == 3 && minor < 12
+}
+
+// syncLazyQueuesPolicy puts policy on the broker, or deletes it when empty.
+func syncLazyQueuesPolicy(ctx context.Context, broker brokerEndpoint, name, policy string) error {
+	method := http.MethodDelete
+	var body io.Reader
+	if policy != "" {
+		method, body = http.MethodPut, strings.NewReader(policy)
+	}
+	req, err := broker.managementRequest(ctx, method, broker.managementPath("policies", name), body)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("%s policy %s: %s", method, name, resp.Status)
+	}
+	return nil
+}
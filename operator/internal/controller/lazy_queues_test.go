@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"k8s.io/utils/ptr"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestLazyModeSupported(t *testing.T) {
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{version: "3.11.28", want: true},
+		{version: "3.12.0"},
+		{version: "3.13.7"},
+		{version: "4.0.5"},
+		{version: "2.8.7", want: true},
+		{version: "", want: true},
+		{version: "unknown", want: true},
+	}
+	for _, tt := range tests {
+		if got := lazyModeSupported(tt.version); got != tt.want {
+			t.Errorf("%q: got %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestLazyQueuesPolicy(t *testing.T) {
+	naming := queueNaming{queue: defaultQueueNameTemplate, exchange: defaultExchangeNameTemplate}
+	capped := schedulingv1alpha1.LazyQueuesConfig{Enabled: true, MaxLength: ptr.To[int64](1000)}
+	tests := []struct {
+		name       string
+		cfg        schedulingv1alpha1.LazyQueuesConfig
+		lazyMode   bool
+		definition map[string]interface{}
+		priority   float64
+	}{
+		{name: "lazy", cfg: schedulingv1alpha1.LazyQueuesConfig{Enabled: true}, lazyMode: true,
+			definition: map[string]interface{}{"queue-mode": "lazy"}, priority: defaultLazyQueuesPriority},
+		{name: "without the lazy mode nothing is left", cfg: schedulingv1alpha1.LazyQueuesConfig{Enabled: true}},
+		{name: "without the lazy mode the cap stays", cfg: capped,
+			definition: map[string]interface{}{"max-length": float64(1000), "overflow": defaultLazyQueuesOverflow}, priority: defaultLazyQueuesPriority},
+		{name: "priority", cfg: schedulingv1alpha1.LazyQueuesConfig{Enabled: true, Priority: ptr.To[int32](20)}, lazyMode: true,
+			definition: map[string]interface{}{"queue-mode": "lazy"}, priority: 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := lazyQueuesPolicy(naming, "shop", "checkout", tt.cfg, schedulingv1alpha1.QueueTopologyConfig{}, tt.lazyMode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.definition == nil {
+				if body != "" {
+					t.Errorf("got policy %s, want none", body)
+				}
+				return
+			}
+			var policy struct {
+				Definition map[string]interface{} `json:"definition"`
+				Priority   float64                `json:"priority"`
+			}
+			if err := json.Unmarshal([]byte(body), &policy); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(policy.Definition, tt.definition) || policy.Priority != tt.priority {
+				t.Errorf("got %+v, want definition %v with priority %v", policy, tt.definition, tt.priority)
+			}
+		})
+	}
+}
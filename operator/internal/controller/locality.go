@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	networkingapi "istio.io/api/networking/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const defaultMinLocalPercent = 50
+
+// buildLocalityTrafficPolicy returns the DestinationRule traffic policy that steers
+// traffic towards the greener zones, or nil when locality routing is disabled.
+// Each zone keeps at least MinLocalPercent of its own traffic; the rest is spread
+// over the other zones in inverse proportion to their carbon intensity.
+func buildLocalityTrafficPolicy(cfg schedulingv1alpha1.LocalityConfig, forecasts map[string]string) *networkingapi.TrafficPolicy {
+	if !cfg.Enabled || len(cfg.Zones) == 0 {
+		return nil
+	}
+	localities := make([]string, 0, len(cfg.Zones))
+	for _, zone := range cfg.Zones {
+		localities = append(localities, zone.Name)
+	}
+	return localityTrafficPolicy(cfg, localities, forecasts)
+}
+
+// localityTrafficPolicy distributes traffic over localities by the forecasts
+// keyed by locality, leaving out those without one.
+func localityTrafficPolicy(cfg schedulingv1alpha1.LocalityConfig, localities []string, forecasts map[string]string) *networkingapi.TrafficPolicy {
+	greenness := map[string]float64{}
+	zones := make([]string, 0, len(localities))
+	for _, locality := range localities {
+		value, err := strconv.ParseFloat(strings.TrimSpace(forecasts[locality]), 64)
+		if err != nil {
+			continue
+		}
+		greenness[locality] = 1 / math.Max(value, 1)
+		zones = append(zones, locality)
+	}
+	sort.Strings(zones)
+
+	setting := &networkingapi.LocalityLoadBalancerSetting{Enabled: wrapperspb.Bool(true)}
+	if len(zones) >= 2 {
+		minLocal := int32(defaultMinLocalPercent)
+		if cfg.MinLocalPercent != nil {
+			minLocal = *cfg.MinLocalPercent
+		}
+		for _, from := range zones {
+			setting.Distribute = append(setting.Distribute, &networkingapi.LocalityLoadBalancerSetting_Distribute{
+				From: from + "/*",
+				To:   distributeFrom(from, zones, greenness, int(minLocal)),
+			})
+		}
+	} else {
+		if len(cfg.Failover) == 0 {
+			return nil
+		}
+		for _, pair := range cfg.Failover {
+			setting.Failover = append(setting.Failover, &networkingapi.LocalityLoadBalancerSetting_Failover{From: pair.From, To: pair.To})
+		}
+	}
+
+	// Istio only honours locality load balancing when outlier detection is configured.
+	return &networkingapi.TrafficPolicy{
+		LoadBalancer: &networkingapi.LoadBalancerSettings{LocalityLbSetting: setting},
+		OutlierDetection: &networkingapi.OutlierDetection{
+			Consecutive_5XxErrors: wrapperspb.UInt32(5),
+			Interval:              durationpb.New(10 * time.Second),
+			BaseEjectionTime:      durationpb.New(30 * time.Second),
+		},
+	}
+}
+
+// distributeFrom computes the percentage split for callers in zone from. Weights are
+// rounded with roundPercentages so they always add up to 100.
+func distributeFrom(from string, zones []string, greenness map[string]float64, minLocal int) map[string]uint32 {
+	total := 0.0
+	for _, zone := range zones {
+		total += greenness[zone]
+	}
+	local := greenness[from] / total * 100
+	if local < float64(minLocal) {
+		local = float64(minLocal)
+	}
+
+	others := total - greenness[from]
+	shares := map[string]float64{from: local}
+	for _, zone := range zones {
+		if zone != from && others > 0 {
+			shares[zone] = (100 - local) * greenness[zone] / others
+		}
+	}
+
+	values := make([]float64, len(zones))
+	for i, zone := range zones {
+		values[i] = shares[zone]
+	}
+	out := map[string]uint32{}
+	for i, weight := range roundPercentages(values) {
+		out[zones[i]+"/*"] = uint32(weight)
+	}
+	for key, weight := range out {
+		if weight == 0 {
+			delete(out, key)
+		}
+	}
+	return out
+}
+
+// podLocalities returns the localities, as "region/zone", of the nodes
+// running the pods selected by svc, from their topology.kubernetes.io labels.
+// Nodes without a region or zone label are left out, as Istio cannot place
+// their endpoints.
+func (r *FlavourRouterReconciler) podLocalities(ctx context.Context, svc *corev1.Service) ([]string, error) {
+	if len(svc.Spec.Selector) == 0 {
+		return nil, nil
+	}
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(svc.Namespace), client.MatchingLabels(svc.Spec.Selector)); err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var localities []string
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning || pod.Spec.NodeName == "" || seen[pod.Spec.NodeName] {
+			continue
+		}
+		seen[pod.Spec.NodeName] = true
+		var node corev1.Node
+		if err := r.Get(ctx, client.ObjectKey{Name: pod.Spec.NodeName}, &node); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return nil, err
+			}
+			continue
+		}
+		region, zone := node.Labels[corev1.LabelTopologyRegion], node.Labels[corev1.LabelTopologyZone]
+		if region == "" || zone == "" {
+			continue
+		}
+		locality := region + "/" + zone
+		if !slices.Contains(localities, locality) {
+			localities = append(localities, locality)
+		}
+	}
+	return localities, nil
+}
+
+// FlavourPodSelector selects the flavour pods, labelled with their precision.
+// They are the only pods the FlavourRouter reads from the cache, so the
+// manager caches them alone instead of every Pod of the cluster.
+func FlavourPodSelector() labels.Selector {
+	flavour, err := labels.NewRequirement(precisionLabel, selection.Exists, nil)
+	if err != nil {
+		panic(err)
+	}
+	return labels.NewSelector().Add(*flavour)
+}
+
+// flavourPodPredicate passes the events of the flavour pods.
+var flavourPodPredicate = predicate.NewPredicateFuncs(func(obj client.Object) bool {
+	return FlavourPodSelector().Matches(labels.Set(obj.GetLabels()))
+})
+
+// podPlacementPredicate passes the Pod events that can change what
+// podLocalities returns: a pod bound to another node, changing phase, or
+// coming and going while it runs on a node.
+func podPlacementPredicate() predicate.Predicate {
+	placed := func(obj client.Object) bool {
+		pod, ok := obj.(*corev1.Pod)
+		return ok && pod.Spec.NodeName != "" && pod.Status.Phase == corev1.PodRunning
+	}
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool { return placed(e.Object) },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldPod, okOld := e.ObjectOld.(*corev1.Pod)
+			newPod, okNew := e.ObjectNew.(*corev1.Pod)
+			return okOld && okNew && (oldPod.Spec.NodeName != newPod.Spec.NodeName || oldPod.Status.Phase != newPod.Status.Phase)
+		},
+		DeleteFunc:  func(e event.DeleteEvent) bool { return placed(e.Object) },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+}
+
+// podServiceRequests maps a Pod to the opted-in Services selecting it, whose
+// DestinationRule follows the localities of their pods.
+func podServiceRequests(c client.Reader) func(context.Context, client.Object) []reconcile.Request {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		services, err := listRoutedServices(ctx, c, client.InNamespace(obj.GetNamespace()))
+		if err != nil {
+			return nil
+		}
+		var out []reconcile.Request
+		for _, svc := range services {
+			if len(svc.Spec.Selector) > 0 && labels.SelectorFromSet(svc.Spec.Selector).Matches(labels.Set(obj.GetLabels())) {
+				out = append(out, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&svc)})
+			}
+		}
+		return out
+	}
+}
+
+// localityForecasts maps each locality to the forecast of its zone in
+// spec.locality, named "region/zone" or by the zone alone.
+func localityForecasts(localities []string, forecasts map[string]string) map[string]string {
+	out := make(map[string]string, len(localities))
+	for _, locality := range localities {
+		if forecast, ok := forecasts[locality]; ok {
+			out[locality] = forecast
+			continue
+		}
+		_, zone, _ := strings.Cut(locality, "/")
+		if forecast, ok := forecasts[zone]; ok {
+			out[locality] = forecast
+		}
+	}
+	return out
+}
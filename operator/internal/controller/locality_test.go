@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	networkingapi "istio.io/api/networking/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func placedPod(node string, phase corev1.PodPhase) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout-0", Labels: map[string]string{"app": "checkout"}},
+		Spec:       corev1.PodSpec{NodeName: node},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+}
+
+func TestPodPlacementPredicate(t *testing.T) {
+	pred := podPlacementPredicate()
+	updates := []struct {
+		name     string
+		old, new *corev1.Pod
+		want     bool
+	}{
+		{name: "bound to a node", old: placedPod("", corev1.PodPending), new: placedPod("node-a", corev1.PodPending), want: true},
+		{name: "starts running", old: placedPod("node-a", corev1.PodPending), new: placedPod("node-a", corev1.PodRunning), want: true},
+		{name: "stops running", old: placedPod("node-a", corev1.PodRunning), new: placedPod("node-a", corev1.PodFailed), want: true},
+		{name: "status churn", old: placedPod("node-a", corev1.PodRunning), new: placedPod("node-a", corev1.PodRunning)},
+	}
+	for _, tt := range updates {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pred.Update(event.UpdateEvent{ObjectOld: tt.old, ObjectNew: tt.new}); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if !pred.Delete(event.DeleteEvent{Object: placedPod("node-a", corev1.PodRunning)}) {
+		t.Error("deleting a running pod was filtered out")
+	}
+	if pred.Create(event.CreateEvent{Object: placedPod("", corev1.PodPending)}) {
+		t.Error("creating an unscheduled pod was let through")
+	}
+}
+
+func TestPodServiceRequests(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := schedulingv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	service := func(name string, routed bool, selector map[string]string) *corev1.Service {
+		svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name}, Spec: corev1.ServiceSpec{Selector: selector}}
+		if routed {
+			svc.Labels = map[string]string{enableLabel: "true"}
+		}
+		return svc
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		service("checkout", true, map[string]string{"app": "checkout"}),
+		service("checkout-plain", false, map[string]string{"app": "checkout"}),
+		service("cart", true, map[string]string{"app": "cart"}),
+		service("headless", true, nil),
+	).Build()
+
+	got := podServiceRequests(c)(context.Background(), placedPod("node-a", corev1.PodRunning))
+	want := []reconcile.Request{{NamespacedName: client.ObjectKey{Namespace: "shop", Name: "checkout"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFlavourPodPredicate(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   bool
+	}{
+		{name: "flavour pod", labels: map[string]string{"app": "checkout", precisionLabel: "50"}, want: true},
+		{name: "buffer service pod", labels: map[string]string{"app.kubernetes.io/name": "buffer-service-router", parentServiceLabel: "checkout"}},
+		{name: "unrelated pod", labels: map[string]string{"app": "checkout"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := placedPod("node-a", corev1.PodRunning)
+			pod.Labels = tt.labels
+			if got := flavourPodPredicate.Create(event.CreateEvent{Object: pod}); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildLocalityTrafficPolicy(t *testing.T) {
+	zones := []schedulingv1alpha1.LocalityZone{{Name: "eu/a"}, {Name: "eu/b"}, {Name: "eu/c"}}
+	forecasts := map[string]string{"eu/a": "100", "eu/b": "200", "eu/c": "400"}
+	failover := []schedulingv1alpha1.LocalityFailover{{From: "eu", To: "us"}}
+	distribution := func(policy *networkingapi.TrafficPolicy) map[string]map[string]uint32 {
+		out := map[string]map[string]uint32{}
+		for _, d := range policy.GetLoadBalancer().GetLocalityLbSetting().GetDistribute() {
+			out[d.From] = d.To
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		cfg       schedulingv1alpha1.LocalityConfig
+		forecasts map[string]string
+		want      map[string]map[string]uint32
+		failover  bool
+		disabled  bool
+	}{
+		{name: "disabled", cfg: schedulingv1alpha1.LocalityConfig{Zones: zones}, forecasts: forecasts, disabled: true},
+		{name: "greener zones draw the traffic", cfg: schedulingv1alpha1.LocalityConfig{Enabled: true, Zones: zones}, forecasts: forecasts,
+			want: map[string]map[string]uint32{
+				"eu/a/*": {"eu/a/*": 57, "eu/b/*": 29, "eu/c/*": 14},
+				"eu/b/*": {"eu/a/*": 40, "eu/b/*": 50, "eu/c/*": 10},
+				"eu/c/*": {"eu/a/*": 33, "eu/b/*": 17, "eu/c/*": 50},
+			}},
+		{name: "every zone keeps its own traffic", cfg: schedulingv1alpha1.LocalityConfig{Enabled: true, Zones: zones[:2], MinLocalPercent: ptr.To[int32](100)}, forecasts: forecasts,
+			want: map[string]map[string]uint32{
+				"eu/a/*": {"eu/a/*": 100},
+				"eu/b/*": {"eu/b/*": 100},
+			}},
+		{name: "failover without forecasts", cfg: schedulingv1alpha1.LocalityConfig{Enabled: true, Zones: zones, Failover: failover},
+			forecasts: map[string]string{"eu/a": "100", "eu/b": "n/a"}, failover: true},
+		{name: "nothing to distribute", cfg: schedulingv1alpha1.LocalityConfig{Enabled: true, Zones: zones}, disabled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := buildLocalityTrafficPolicy(tt.cfg, tt.forecasts)
+			if tt.disabled {
+				if policy != nil {
+					t.Fatalf("got %v, want no traffic policy", policy)
+				}
+				return
+			}
+			if policy == nil || policy.OutlierDetection == nil {
+				t.Fatalf("got %v, want a policy with outlier detection", policy)
+			}
+			setting := policy.LoadBalancer.LocalityLbSetting
+			if tt.failover {
+				if len(setting.Distribute) != 0 || len(setting.Failover) != 1 || setting.Failover[0].To != "us" {
+					t.Errorf("got %v, want the configured failover only", setting)
+				}
+				return
+			}
+			if got := distribution(policy); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	securityapi "istio.io/api/security/v1beta1"
+	typeapi "istio.io/api/type/v1beta1"
+	securitykube "istio.io/client-go/pkg/apis/security/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func meshPolicyName(svc *corev1.Service) string {
+	return fmt.Sprintf("%s-carbonrouter-mesh", svc.Name)
+}
+
+// ensureMeshSecurity requires mTLS on the precision pods of a Service and lets
+// only the buffer service, whose router and consumer share one service
+// account, and the allowed principals call them. The policies are scoped to
+// the pods of the Service rather than its namespace, so other workloads there
+// keep accepting plaintext. Turning it off removes both.
+func (r *FlavourRouterReconciler) ensureMeshSecurity(ctx context.Context, svc *corev1.Service, cfg schedulingv1alpha1.MeshSecurityConfig) error {
+	name := meshPolicyName(svc)
+	if !cfg.Enabled || len(svc.Spec.Selector) == 0 {
+		return r.deleteMeshSecurity(ctx, svc)
+	}
+	trustDomain := cfg.TrustDomain
+	if trustDomain == "" {
+		trustDomain = defaultTrustDomain
+	}
+	saName := fmt.Sprintf("%s-trafficschedule-viewer", svc.Name)
+	principals := append([]string{fmt.Sprintf("%s/ns/%s/sa/%s", trustDomain, svc.Namespace, saName)}, cfg.AllowedPrincipals...)
+	meta := metav1.ObjectMeta{
+		Name:      name,
+		Namespace: svc.Namespace,
+		Labels:    map[string]string{parentServiceLabel: svc.Name},
+	}
+	selector := &typeapi.WorkloadSelector{MatchLabels: svc.Spec.Selector}
+
+	peer := &securitykube.PeerAuthentication{
+		ObjectMeta: meta,
+		Spec: securityapi.PeerAuthentication{
+			Selector: selector,
+			Mtls:     &securityapi.PeerAuthentication_MutualTLS{Mode: securityapi.PeerAuthentication_MutualTLS_STRICT},
+		},
+	}
+	if err := ctrl.SetControllerReference(svc, peer, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.apply(ctx, svc, "PeerAuthentication", peer, &peer.Spec); err != nil {
+		return err
+	}
+
+	policy := &securitykube.AuthorizationPolicy{
+		ObjectMeta: *meta.DeepCopy(),
+		Spec: securityapi.AuthorizationPolicy{
+			Selector: selector,
+			Action:   securityapi.AuthorizationPolicy_ALLOW,
+			Rules: []*securityapi.Rule{{
+				From: []*securityapi.Rule_From{{Source: &securityapi.Source{Principals: principals}}},
+			}},
+		},
+	}
+	if err := ctrl.SetControllerReference(svc, policy, r.Scheme); err != nil {
+		return err
+	}
+	return r.apply(ctx, svc, "AuthorizationPolicy", policy, &policy.Spec)
+}
+
+// deleteMeshSecurity removes the mesh policies of a Service, looking them up
+// in the cache first so Services without them cost no API call.
+func (r *FlavourRouterReconciler) deleteMeshSecurity(ctx context.Context, svc *corev1.Service) error {
+	key := client.ObjectKey{Namespace: svc.Namespace, Name: meshPolicyName(svc)}
+	for kind, obj := range map[string]client.Object{
+		"PeerAuthentication":  &securitykube.PeerAuthentication{},
+		"AuthorizationPolicy": &securitykube.AuthorizationPolicy{},
+	} {
+		if err := r.Get(ctx, key, obj); err != nil {
+			if ignoreAbsent(err) != nil {
+				return err
+			}
+			continue
+		}
+		if err := ignoreAbsent(r.Delete(ctx, obj)); err != nil {
+			return err
+		}
+		r.Inventory.Drop(client.ObjectKeyFromObject(svc), kind, svc.Namespace, key.Name)
+	}
+	return nil
+}
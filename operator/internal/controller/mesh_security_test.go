@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	securitykube "istio.io/client-go/pkg/apis/security/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestEnsureMeshSecurity(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := securitykube.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout", UID: "checkout"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "checkout"}},
+	}
+	applied := map[string]client.Object{}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			obj = obj.DeepCopyObject().(client.Object)
+			obj.SetResourceVersion("")
+			applied[obj.GetObjectKind().GroupVersionKind().Kind] = obj
+			return c.Create(ctx, obj)
+		},
+	}).Build()
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme, Inventory: NewResourceInventory()}
+	ctx := context.Background()
+	gateway := "cluster.local/ns/istio-system/sa/istio-ingressgateway-service-account"
+
+	cfg := schedulingv1alpha1.MeshSecurityConfig{Enabled: true, TrustDomain: "example.org", AllowedPrincipals: []string{gateway}}
+	if err := r.ensureMeshSecurity(ctx, svc, cfg); err != nil {
+		t.Fatal(err)
+	}
+	peer, ok := applied["PeerAuthentication"].(*securitykube.PeerAuthentication)
+	if !ok || peer.Name != meshPolicyName(svc) {
+		t.Fatalf("got %v, want the PeerAuthentication of the Service", applied["PeerAuthentication"])
+	}
+	if peer.Spec.Mtls.GetMode().String() != "STRICT" || peer.Spec.Selector.GetMatchLabels()["app"] != "checkout" {
+		t.Errorf("got %v, want STRICT mTLS on the pods of the Service", &peer.Spec)
+	}
+	policy, ok := applied["AuthorizationPolicy"].(*securitykube.AuthorizationPolicy)
+	if !ok || policy.Labels[parentServiceLabel] != "checkout" {
+		t.Fatalf("got %v, want the AuthorizationPolicy of the Service", applied["AuthorizationPolicy"])
+	}
+	if policy.Spec.Action.String() != "ALLOW" || policy.Spec.Selector.GetMatchLabels()["app"] != "checkout" || len(policy.Spec.Rules) != 1 {
+		t.Errorf("got %v, want a single ALLOW rule on the pods of the Service", &policy.Spec)
+	}
+	want := []string{"example.org/ns/shop/sa/checkout-trafficschedule-viewer", gateway}
+	if got := policy.Spec.Rules[0].From[0].Source.Principals; !reflect.DeepEqual(got, want) {
+		t.Errorf("got principals %v, want %v", got, want)
+	}
+
+	unselected := svc.DeepCopy()
+	unselected.Spec.Selector = nil
+	tests := []struct {
+		name string
+		svc  *corev1.Service
+		cfg  schedulingv1alpha1.MeshSecurityConfig
+	}{
+		{name: "disabled", svc: svc},
+		{name: "no selector", svc: unselected, cfg: schedulingv1alpha1.MeshSecurityConfig{Enabled: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := r.ensureMeshSecurity(ctx, tt.svc, tt.cfg); err != nil {
+				t.Fatal(err)
+			}
+			key := client.ObjectKey{Namespace: "shop", Name: meshPolicyName(svc)}
+			if err := c.Get(ctx, key, &securitykube.PeerAuthentication{}); !apierrors.IsNotFound(err) {
+				t.Errorf("PeerAuthentication kept: %v", err)
+			}
+			if err := c.Get(ctx, key, &securitykube.AuthorizationPolicy{}); !apierrors.IsNotFound(err) {
+				t.Errorf("AuthorizationPolicy kept: %v", err)
+			}
+			if r.Inventory.Has(client.ObjectKeyFromObject(svc), "AuthorizationPolicy", "shop", key.Name) {
+				t.Error("AuthorizationPolicy kept in the inventory")
+			}
+		})
+		// Recreate the policies for the next case
+		if err := r.ensureMeshSecurity(ctx, svc, schedulingv1alpha1.MeshSecurityConfig{Enabled: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := applied["AuthorizationPolicy"].(*securitykube.AuthorizationPolicy).Spec.Rules[0].From[0].Source.Principals; !reflect.DeepEqual(got, []string{"cluster.local/ns/shop/sa/checkout-trafficschedule-viewer"}) {
+		t.Errorf("got principals %v, want the buffer service in the default trust domain", got)
+	}
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// Namespaces the buffer service pods talk to besides their own. The consumer
+// carries an Istio sidecar, which fetches its configuration from istiod.
+const (
+	istioNamespace   = "istio-system"
+	istiodXDSPort    = 15012
+	envoyMetricsPort = 15090
+)
+
+// ensureNetworkPolicy restricts the pods of a buffer service component. They
+// may reach the cluster DNS, the API server for the TrafficSchedule watch and
+// the broker, and the consumer, or the router without a broker, the pods of
+// the target Service and istiod. The operator and Prometheus, from the
+// operator namespace, may reach the metrics and admin ports, and anyone the
+// router port. The decision engine is left out: the components read the
+// schedule from the TrafficSchedule status and never call it.
+func (r *FlavourRouterReconciler) ensureNetworkPolicy(ctx context.Context, svc *corev1.Service, component string, broker bufferBackend) error {
+	ctrl.LoggerFrom(ctx).WithName("[FlavourRouter]").Info("Ensuring NetworkPolicy for buffer service", "component", component)
+	tcp, udp := ptr.To(corev1.ProtocolTCP), ptr.To(corev1.ProtocolUDP)
+	port := func(protocol *corev1.Protocol, number int) networkingv1.NetworkPolicyPort {
+		return networkingv1.NetworkPolicyPort{Protocol: protocol, Port: ptr.To(intstr.FromInt(number))}
+	}
+	fromNamespace := func(namespace string) networkingv1.NetworkPolicyPeer {
+		return networkingv1.NetworkPolicyPeer{NamespaceSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{corev1.LabelMetadataName: namespace},
+		}}
+	}
+
+	egress := []networkingv1.NetworkPolicyEgressRule{
+		{Ports: []networkingv1.NetworkPolicyPort{port(udp, 53), port(tcp, 53)}},
+		// The API server is not a pod, so it cannot be selected
+		{Ports: []networkingv1.NetworkPolicyPort{port(tcp, 443), port(tcp, 6443)}},
+	}
+	for _, address := range broker.addresses() {
+		brokerRule := networkingv1.NetworkPolicyEgressRule{Ports: []networkingv1.NetworkPolicyPort{port(tcp, int(address.port))}}
+		if namespace, ok := clusterServiceNamespace(address.host, svc.Namespace); ok {
+			brokerRule.To = []networkingv1.NetworkPolicyPeer{fromNamespace(namespace)}
+		}
+		egress = append(egress, brokerRule)
+	}
+	ingress := []networkingv1.NetworkPolicyIngressRule{{
+		From:  []networkingv1.NetworkPolicyPeer{fromNamespace(r.OperatorNamespace)},
+		Ports: []networkingv1.NetworkPolicyPort{port(tcp, 8001), port(tcp, 8002)},
+	}}
+	if component == "router" {
+		ingress = append(ingress, networkingv1.NetworkPolicyIngressRule{
+			Ports: []networkingv1.NetworkPolicyPort{port(tcp, 8000)},
+		})
+	}
+	if forwardsRequests(component, broker) {
+		// Any port of the targets, as the identity settings pick it
+		egress = append(egress,
+			networkingv1.NetworkPolicyEgressRule{To: []networkingv1.NetworkPolicyPeer{{
+				PodSelector: &metav1.LabelSelector{MatchLabels: svc.Spec.Selector},
+			}}},
+			networkingv1.NetworkPolicyEgressRule{
+				To:    []networkingv1.NetworkPolicyPeer{fromNamespace(istioNamespace)},
+				Ports: []networkingv1.NetworkPolicyPort{port(tcp, istiodXDSPort)},
+			},
+		)
+		ingress[0].Ports = append(ingress[0].Ports, port(tcp, envoyMetricsPort))
+	}
+
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("buffer-service-%s-%s", component, svc.Name),
+			Namespace: svc.Namespace,
+			Labels: map[string]string{
+				parentServiceLabel:             svc.Name,
+				"app.kubernetes.io/managed-by": "carbonrouter-operator",
+			},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{
+				"app.kubernetes.io/name": fmt.Sprintf("buffer-service-%s", component),
+				parentServiceLabel:       svc.Name,
+			}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+			Ingress:     ingress,
+			Egress:      egress,
+		},
+	}
+	if err := ctrl.SetControllerReference(svc, policy, r.Scheme); err != nil {
+		return err
+	}
+	return r.apply(ctx, svc, "NetworkPolicy", policy, &policy.Spec)
+}
+
+// clusterServiceNamespace returns the namespace of a Service host name such as
+// "rabbitmq", "rabbitmq.messaging" or "rabbitmq.messaging.svc.cluster.local".
+// Other host names are outside the cluster.
+func clusterServiceNamespace(host, namespace string) (string, bool) {
+	labels := strings.Split(strings.TrimSuffix(host, "."), ".")
+	switch {
+	case len(labels) == 1:
+		return namespace, true
+	case len(labels) == 2, labels[2] == "svc":
+		return labels[1], true
+	}
+	return "", false
+}
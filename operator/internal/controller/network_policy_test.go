@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestClusterServiceNamespace(t *testing.T) {
+	tests := []struct {
+		host      string
+		namespace string
+		inCluster bool
+	}{
+		{host: "rabbitmq", namespace: "shop", inCluster: true},
+		{host: "rabbitmq.messaging", namespace: "messaging", inCluster: true},
+		{host: "rabbitmq.messaging.svc", namespace: "messaging", inCluster: true},
+		{host: "rabbitmq.messaging.svc.cluster.local.", namespace: "messaging", inCluster: true},
+		{host: "mq.example.com"},
+	}
+	for _, tt := range tests {
+		namespace, inCluster := clusterServiceNamespace(tt.host, "shop")
+		if namespace != tt.namespace || inCluster != tt.inCluster {
+			t.Errorf("%s: got %q, %v, want %q, %v", tt.host, namespace, inCluster, tt.namespace, tt.inCluster)
+		}
+	}
+}
+
+func TestEnsureNetworkPolicy(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout", UID: "checkout"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "checkout"}},
+	}
+	applied := map[string]*networkingv1.NetworkPolicy{}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			applied[obj.GetName()] = obj.(*networkingv1.NetworkPolicy).DeepCopy()
+			return nil
+		},
+	}).Build()
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme, Inventory: NewResourceInventory(), OperatorNamespace: "carbonrouter-system"}
+	ctx := context.Background()
+	rabbitmq := rabbitMQBackend{cfg: schedulingv1alpha1.BrokerConfig{Host: "rabbitmq.messaging", Port: ptr.To[int32](5671)}}
+
+	ports := func(rule []networkingv1.NetworkPolicyPort) []int {
+		var out []int
+		for _, port := range rule {
+			out = append(out, port.Port.IntValue())
+		}
+		return out
+	}
+	tests := []struct {
+		name         string
+		component    string
+		broker       bufferBackend
+		egress       int
+		ingressPorts []int
+		router       bool
+	}{
+		// DNS, the API server and the broker
+		{name: "router", component: "router", broker: rabbitmq, egress: 3, ingressPorts: []int{8001, 8002}, router: true},
+		// and the targets and istiod
+		{name: "consumer", component: "consumer", broker: rabbitmq, egress: 5, ingressPorts: []int{8001, 8002, envoyMetricsPort}},
+		{name: "router without a broker", component: "router", broker: directBackend{}, egress: 4, ingressPorts: []int{8001, 8002, envoyMetricsPort}, router: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := r.ensureNetworkPolicy(ctx, svc, tt.component, tt.broker); err != nil {
+				t.Fatal(err)
+			}
+			policy := applied["buffer-service-"+tt.component+"-checkout"]
+			if policy == nil {
+				t.Fatalf("got policies %v, want one for the %s", applied, tt.component)
+			}
+			spec := policy.Spec
+			if spec.PodSelector.MatchLabels["app.kubernetes.io/name"] != "buffer-service-"+tt.component || spec.PodSelector.MatchLabels[parentServiceLabel] != "checkout" {
+				t.Errorf("got pod selector %v, want the %s pods of the Service", spec.PodSelector, tt.component)
+			}
+			if len(spec.PolicyTypes) != 2 || len(spec.Egress) != tt.egress {
+				t.Errorf("got policy types %v and %d egress rules, want both types and %d rules", spec.PolicyTypes, len(spec.Egress), tt.egress)
+			}
+			operator := spec.Ingress[0]
+			if operator.From[0].NamespaceSelector.MatchLabels[corev1.LabelMetadataName] != "carbonrouter-system" || !slices.Equal(ports(operator.Ports), tt.ingressPorts) {
+				t.Errorf("got operator ingress %v, want ports %v from the operator namespace", operator, tt.ingressPorts)
+			}
+			if open := len(spec.Ingress) == 2 && spec.Ingress[1].From == nil && spec.Ingress[1].Ports[0].Port.IntValue() == 8000; open != tt.router {
+				t.Errorf("got ingress %v, want the router port open to anyone: %v", spec.Ingress, tt.router)
+			}
+		})
+	}
+
+	broker := applied["buffer-service-consumer-checkout"].Spec.Egress[2]
+	if broker.Ports[0].Port.IntValue() != 5671 || broker.To[0].NamespaceSelector.MatchLabels[corev1.LabelMetadataName] != "messaging" {
+		t.Errorf("got broker egress %v, want port 5671 to the messaging namespace", broker)
+	}
+	target := applied["buffer-service-consumer-checkout"].Spec.Egress[3]
+	if target.To[0].PodSelector.MatchLabels["app"] != "checkout" || target.Ports != nil {
+		t.Errorf("got target egress %v, want any port of the Service pods", target)
+	}
+
+	external := rabbitMQBackend{cfg: schedulingv1alpha1.BrokerConfig{Host: "mq.example.com"}}
+	if err := r.ensureNetworkPolicy(ctx, svc, "router", external); err != nil {
+		t.Fatal(err)
+	}
+	if broker := applied["buffer-service-router-checkout"].Spec.Egress[2]; broker.To != nil {
+		t.Errorf("got broker egress %v, want any destination for a broker outside the cluster", broker)
+	}
+}
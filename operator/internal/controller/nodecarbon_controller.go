@@ -0,0 +1,168 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/schedextender"
+)
+
+const (
+	nodeCarbonResync          = 5 * time.Minute
+	nodeCarbonReconcileTarget = "node-carbon"
+)
+
+// NodeCarbonReconciler labels every node with the current forecast of its zone,
+// from the zone forecasts of the TrafficSchedules with spec.locality, for the
+// scheduler extender to score. Nodes of zones without a forecast are left
+// unlabelled, and so is every node while the kill-switch is engaged.
+type NodeCarbonReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// KillSwitchNamespace holds the emergency kill-switch ConfigMap; empty
+	// disables it.
+	KillSwitchNamespace string
+}
+
+// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=scheduling.carbonrouter.io,resources=trafficschedules,verbs=get;list;watch
+
+func (r *NodeCarbonReconciler) Reconcile(ctx context.Context, _ ctrl.Request) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx).WithName("[NodeCarbon]")
+
+	var tsList schedulingv1alpha1.TrafficScheduleList
+	if err := r.List(ctx, &tsList); err != nil {
+		return ctrl.Result{}, err
+	}
+	intensities := zoneIntensities(tsList.Items)
+	killed, err := killSwitchEngaged(ctx, r.Client, r.KillSwitchNamespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if killed {
+		log.Info("Kill-switch engaged, removing node carbon intensities")
+		intensities = nil
+	}
+
+	var nodes corev1.NodeList
+	if err := r.List(ctx, &nodes); err != nil {
+		return ctrl.Result{}, err
+	}
+	labelled := 0
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		current, has := node.Labels[schedextender.IntensityLabel]
+		intensity, wanted := nodeIntensity(node, intensities)
+		value := strconv.Itoa(int(math.Round(intensity)))
+		if wanted {
+			labelled++
+		}
+		if (wanted && current == value) || (!wanted && !has) {
+			continue
+		}
+		original := node.DeepCopy()
+		if wanted {
+			if node.Labels == nil {
+				node.Labels = map[string]string{}
+			}
+			node.Labels[schedextender.IntensityLabel] = value
+		} else {
+			delete(node.Labels, schedextender.IntensityLabel)
+		}
+		if err := r.Patch(ctx, node, client.MergeFrom(original)); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	log.V(1).Info("Node carbon intensities labelled", "zones", len(intensities), "nodes", labelled)
+	return ctrl.Result{RequeueAfter: nodeCarbonResync}, nil
+}
+
+// zoneIntensities averages the current forecast of each zone over the
+// schedules reporting one.
+func zoneIntensities(schedules []schedulingv1alpha1.TrafficSchedule) map[string]float64 {
+	sums := map[string]float64{}
+	counts := map[string]int{}
+	for _, ts := range schedules {
+		for zone, forecast := range ts.Status.ZoneForecasts {
+			value, err := strconv.ParseFloat(forecast, 64)
+			if err != nil {
+				continue
+			}
+			sums[zone] += value
+			counts[zone]++
+		}
+	}
+	intensities := make(map[string]float64, len(sums))
+	for zone, sum := range sums {
+		intensities[zone] = sum / float64(counts[zone])
+	}
+	return intensities
+}
+
+// nodeIntensity returns the forecast of the locality of node, as
+// "region/zone" like spec.locality, or of its zone alone.
+func nodeIntensity(node *corev1.Node, intensities map[string]float64) (float64, bool) {
+	region, zone := node.Labels[corev1.LabelTopologyRegion], node.Labels[corev1.LabelTopologyZone]
+	if zone == "" {
+		return 0, false
+	}
+	if intensity, ok := intensities[region+"/"+zone]; ok && region != "" {
+		return intensity, true
+	}
+	intensity, ok := intensities[zone]
+	return intensity, ok
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *NodeCarbonReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	singleton := handler.EnqueueRequestsFromMapFunc(func(context.Context, client.Object) []reconcile.Request {
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: nodeCarbonReconcileTarget}}}
+	})
+	// New nodes and zone changes only, not the label updates of this controller
+	nodeLocality := predicate.Funcs{
+		CreateFunc: func(event.CreateEvent) bool { return true },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldLabels, newLabels := e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels()
+			return oldLabels[corev1.LabelTopologyZone] != newLabels[corev1.LabelTopologyZone] ||
+				oldLabels[corev1.LabelTopologyRegion] != newLabels[corev1.LabelTopologyRegion]
+		},
+		DeleteFunc:  func(event.DeleteEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("nodecarbon").
+		Watches(&schedulingv1alpha1.TrafficSchedule{}, singleton).
+		Watches(&corev1.Node{}, singleton, builder.WithPredicates(nodeLocality)).
+		Watches(&corev1.ConfigMap{}, singleton, builder.WithPredicates(killSwitchPredicate(r.KillSwitchNamespace))).
+		Complete(r)
+}
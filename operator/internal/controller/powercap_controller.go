@@ -0,0 +1,374 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/poweragent"
+)
+
+const (
+	powerAgentName          = "carbonrouter-power-agent"
+	powerCapResync          = 1 * time.Minute
+	defaultMinCapPercent    = 50
+	defaultDominanceRatio   = 0.5
+	powerCapReconcileTarget = "power-cap"
+)
+
+// PowerCapReconciler manages the optional node power-cap agent and decides which
+// nodes are capped. Nodes dominated by carbonrouter-managed pods receive the
+// poweragent.CapAnnotation during extreme carbon windows; the agent applies the cap
+// and reverts it as soon as the annotation disappears.
+type PowerCapReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// Namespace hosts the node agent DaemonSet.
+	Namespace string
+	// AgentImage provides the /power-agent binary (the operator image by default).
+	AgentImage string
+}
+
+// powerCapDecision is the cluster-wide cap derived from every TrafficSchedule.
+type powerCapDecision struct {
+	enabled   bool
+	percent   int
+	dominance float64
+}
+
+// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=clusterroles,verbs=get;list;watch;create;update;patch
+
+func (r *PowerCapReconciler) Reconcile(ctx context.Context, _ ctrl.Request) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx).WithName("[PowerCap]")
+
+	var tsList schedulingv1alpha1.TrafficScheduleList
+	if err := r.List(ctx, &tsList); err != nil {
+		return ctrl.Result{}, err
+	}
+	decision := decidePowerCap(tsList.Items, time.Now())
+
+	// The kill-switch lifts every cap but keeps the agent, so re-arming is instant.
+	engaged, err := killSwitchEngaged(ctx, r.Client, r.Namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if engaged && decision.enabled {
+		log.Info("Kill-switch engaged, lifting node power caps")
+		return ctrl.Result{RequeueAfter: powerCapResync}, r.annotateNodes(ctx, nil, 0)
+	}
+
+	if !decision.enabled {
+		if err := r.removeAgent(ctx); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, r.annotateNodes(ctx, nil, 0)
+	}
+
+	if err := r.ensureAgent(ctx); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	capped := map[string]struct{}{}
+	if decision.percent > 0 {
+		dominated, err := r.dominatedNodes(ctx, decision.dominance)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		capped = dominated
+	}
+	log.Info("Power cap evaluated", "percent", decision.percent, "nodes", len(capped))
+	if err := r.annotateNodes(ctx, capped, decision.percent); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: powerCapResync}, nil
+}
+
+// decidePowerCap picks the most restrictive cap among schedules in an extreme window.
+// The cap follows the processing throttle, so it tightens together with replica ceilings.
+func decidePowerCap(schedules []schedulingv1alpha1.TrafficSchedule, now time.Time) powerCapDecision {
+	decision := powerCapDecision{dominance: defaultDominanceRatio}
+	for _, ts := range schedules {
+		cfg := ts.Spec.PowerCap
+		if !cfg.Enabled {
+			continue
+		}
+		decision.enabled = true
+
+		threshold, ok := parseOptionalFloat(cfg.IntensityThreshold)
+		if !ok {
+			continue
+		}
+		forecast, ok := currentForecast(ts.Status, now)
+		if !ok || forecast < threshold {
+			continue
+		}
+		throttle := 1.0
+		if value, err := strconv.ParseFloat(ts.Status.ProcessingThrottle, 64); err == nil {
+			throttle = value
+		}
+		minCap := int32(defaultMinCapPercent)
+		if cfg.MinCapPercent != nil {
+			minCap = *cfg.MinCapPercent
+		}
+		percent := int(math.Round(throttle * 100))
+		if percent < int(minCap) {
+			percent = int(minCap)
+		}
+		if percent >= 100 {
+			continue
+		}
+		if decision.percent == 0 || percent < decision.percent {
+			decision.percent = percent
+			decision.dominance = defaultDominanceRatio
+			if ratio, ok := parseOptionalFloat(cfg.DominanceRatio); ok {
+				decision.dominance = ratio
+			}
+		}
+	}
+	return decision
+}
+
+// currentForecast returns the forecast of the slot of status covering now,
+// or else carbonForecastNow. Both are set from the carbon data of the decision
+// engine; the slots also stay current while a fallback schedule is applied.
+func currentForecast(status schedulingv1alpha1.TrafficScheduleStatus, now time.Time) (float64, bool) {
+	for _, slot := range status.ForecastSchedule {
+		from, errFrom := time.Parse(time.RFC3339, slot.From)
+		to, errTo := time.Parse(time.RFC3339, slot.To)
+		if errFrom != nil || errTo != nil || now.Before(from) || !now.Before(to) {
+			continue
+		}
+		if forecast, err := strconv.ParseFloat(slot.Forecast, 64); err == nil {
+			return forecast, true
+		}
+	}
+	forecast, err := strconv.ParseFloat(strings.TrimSpace(status.CarbonForecastNow), 64)
+	return forecast, err == nil
+}
+
+func parseOptionalFloat(value *string) (float64, bool) {
+	if value == nil {
+		return 0, false
+	}
+	parsed, err := strconv.ParseFloat(strings.TrimSpace(*value), 64)
+	if err != nil {
+		return 0, false
+	}
+	return parsed, true
+}
+
+// dominatedNodes returns the nodes where carbonrouter-managed pods make up at least
+// the given share of running pods.
+func (r *PowerCapReconciler) dominatedNodes(ctx context.Context, ratio float64) (map[string]struct{}, error) {
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods); err != nil {
+		return nil, err
+	}
+	total := map[string]int{}
+	managed := map[string]int{}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" || pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		total[pod.Spec.NodeName]++
+		if pod.Labels[precisionLabel] != "" || pod.Labels[parentServiceLabel] != "" {
+			managed[pod.Spec.NodeName]++
+		}
+	}
+	out := map[string]struct{}{}
+	for node, count := range total {
+		if count > 0 && float64(managed[node])/float64(count) >= ratio {
+			out[node] = struct{}{}
+		}
+	}
+	return out, nil
+}
+
+// annotateNodes sets the cap annotation on capped nodes and removes it everywhere else.
+func (r *PowerCapReconciler) annotateNodes(ctx context.Context, capped map[string]struct{}, percent int) error {
+	var nodes corev1.NodeList
+	if err := r.List(ctx, &nodes); err != nil {
+		return err
+	}
+	value := strconv.Itoa(percent)
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		current, has := node.Annotations[poweragent.CapAnnotation]
+		_, wanted := capped[node.Name]
+		if (wanted && current == value) || (!wanted && !has) {
+			continue
+		}
+		original := node.DeepCopy()
+		if wanted {
+			if node.Annotations == nil {
+				node.Annotations = map[string]string{}
+			}
+			node.Annotations[poweragent.CapAnnotation] = value
+		} else {
+			delete(node.Annotations, poweragent.CapAnnotation)
+		}
+		if err := r.Patch(ctx, node, client.MergeFrom(original)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *PowerCapReconciler) ensureAgent(ctx context.Context) error {
+	log := ctrl.LoggerFrom(ctx).WithName("[PowerCap]")
+	labels := map[string]string{
+		"app.kubernetes.io/name":       powerAgentName,
+		"app.kubernetes.io/part-of":    "carbonrouter",
+		"app.kubernetes.io/managed-by": "carbonrouter-operator",
+	}
+
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: powerAgentName, Namespace: r.Namespace, Labels: labels}}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(sa), &corev1.ServiceAccount{}); apierrors.IsNotFound(err) {
+		if err := r.Create(ctx, sa); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	role := &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: powerAgentName, Labels: labels},
+		Rules: []rbacv1.PolicyRule{{
+			APIGroups: []string{""},
+			Resources: []string{"nodes"},
+			Verbs:     []string{"get"},
+		}},
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(role), &rbacv1.ClusterRole{}); apierrors.IsNotFound(err) {
+		if err := r.Create(ctx, role); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	binding := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: powerAgentName, Labels: labels},
+		Subjects:   []rbacv1.Subject{{Kind: "ServiceAccount", Name: powerAgentName, Namespace: r.Namespace}},
+		RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: powerAgentName, APIGroup: "rbac.authorization.k8s.io"},
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(binding), &rbacv1.ClusterRoleBinding{}); apierrors.IsNotFound(err) {
+		if err := r.Create(ctx, binding); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: powerAgentName, Namespace: r.Namespace, Labels: labels},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app.kubernetes.io/name": powerAgentName}},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: powerAgentName,
+					NodeSelector:       map[string]string{"kubernetes.io/os": "linux"},
+					Tolerations:        []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+					Containers: []corev1.Container{{
+						Name:    "power-agent",
+						Image:   r.AgentImage,
+						Command: []string{"/power-agent"},
+						Args:    []string{"--sysfs-root=/host/sys"},
+						Env: []corev1.EnvVar{{
+							Name:      "NODE_NAME",
+							ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"}},
+						}},
+						SecurityContext: &corev1.SecurityContext{
+							Privileged: ptr.To(true),
+							RunAsUser:  ptr.To[int64](0),
+						},
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceCPU:    resource.MustParse("5m"),
+								corev1.ResourceMemory: resource.MustParse("32Mi"),
+							},
+							Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("64Mi")},
+						},
+						VolumeMounts: []corev1.VolumeMount{{Name: "sys", MountPath: "/host/sys"}},
+					}},
+					Volumes: []corev1.Volume{{
+						Name:         "sys",
+						VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/sys"}},
+					}},
+				},
+			},
+		},
+	}
+
+	var current appsv1.DaemonSet
+	err := r.Get(ctx, client.ObjectKeyFromObject(ds), &current)
+	if apierrors.IsNotFound(err) {
+		log.Info("Creating power-cap agent DaemonSet", "namespace", r.Namespace)
+		return r.Create(ctx, ds)
+	}
+	if err != nil {
+		return err
+	}
+	if !equality.Semantic.DeepDerivative(ds.Spec, current.Spec) {
+		current.Spec = ds.Spec
+		log.Info("Updating power-cap agent DaemonSet", "namespace", r.Namespace)
+		return r.Update(ctx, &current)
+	}
+	return nil
+}
+
+// removeAgent deletes the DaemonSet; agents revert their caps on termination.
+func (r *PowerCapReconciler) removeAgent(ctx context.Context) error {
+	ds := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: powerAgentName, Namespace: r.Namespace}}
+	return client.IgnoreNotFound(r.Delete(ctx, ds, client.PropagationPolicy(metav1.DeletePropagationBackground)))
+}
+
+func (r *PowerCapReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	singleton := handler.EnqueueRequestsFromMapFunc(func(context.Context, client.Object) []reconcile.Request {
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: r.Namespace, Name: powerCapReconcileTarget}}}
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("powercap").
+		Watches(&schedulingv1alpha1.TrafficSchedule{}, singleton).
+		Watches(&corev1.ConfigMap{}, singleton, builder.WithPredicates(killSwitchPredicate(r.Namespace))).
+		Complete(r)
+}
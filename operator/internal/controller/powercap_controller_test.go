@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/poweragent"
+)
+
+func TestDecidePowerCap(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 10, 0, 0, time.UTC)
+	capped := schedulingv1alpha1.PowerCapConfig{Enabled: true, IntensityThreshold: ptr.To("300")}
+	slots := []schedulingv1alpha1.ForecastSlot{
+		{From: "2025-06-01T11:30:00Z", To: "2025-06-01T12:00:00Z", Forecast: "200"},
+		{From: "2025-06-01T12:00:00Z", To: "2025-06-01T12:30:00Z", Forecast: "450"},
+	}
+	schedule := func(cfg schedulingv1alpha1.PowerCapConfig, status schedulingv1alpha1.TrafficScheduleStatus) schedulingv1alpha1.TrafficSchedule {
+		return schedulingv1alpha1.TrafficSchedule{Spec: schedulingv1alpha1.TrafficScheduleSpec{PowerCap: cfg}, Status: status}
+	}
+	tests := []struct {
+		name      string
+		schedules []schedulingv1alpha1.TrafficSchedule
+		want      powerCapDecision
+	}{
+		{name: "disabled", schedules: []schedulingv1alpha1.TrafficSchedule{
+			schedule(schedulingv1alpha1.PowerCapConfig{}, schedulingv1alpha1.TrafficScheduleStatus{CarbonForecastNow: "450", ProcessingThrottle: "0.5"}),
+		}, want: powerCapDecision{dominance: defaultDominanceRatio}},
+		{name: "below the threshold", schedules: []schedulingv1alpha1.TrafficSchedule{
+			schedule(capped, schedulingv1alpha1.TrafficScheduleStatus{CarbonForecastNow: "250", ProcessingThrottle: "0.5"}),
+		}, want: powerCapDecision{enabled: true, dominance: defaultDominanceRatio}},
+		{name: "current forecast", schedules: []schedulingv1alpha1.TrafficSchedule{
+			schedule(capped, schedulingv1alpha1.TrafficScheduleStatus{CarbonForecastNow: "450", ProcessingThrottle: "0.5"}),
+		}, want: powerCapDecision{enabled: true, percent: 50, dominance: defaultDominanceRatio}},
+		{name: "slot covering now wins over a stale forecast", schedules: []schedulingv1alpha1.TrafficSchedule{
+			schedule(capped, schedulingv1alpha1.TrafficScheduleStatus{CarbonForecastNow: "200", ForecastSchedule: slots, ProcessingThrottle: "0.6"}),
+		}, want: powerCapDecision{enabled: true, percent: 60, dominance: defaultDominanceRatio}},
+		{name: "no forecast", schedules: []schedulingv1alpha1.TrafficSchedule{
+			schedule(capped, schedulingv1alpha1.TrafficScheduleStatus{ProcessingThrottle: "0.5"}),
+		}, want: powerCapDecision{enabled: true, dominance: defaultDominanceRatio}},
+		{name: "most restrictive schedule, floored", schedules: []schedulingv1alpha1.TrafficSchedule{
+			schedule(capped, schedulingv1alpha1.TrafficScheduleStatus{CarbonForecastNow: "450", ProcessingThrottle: "0.8"}),
+			schedule(schedulingv1alpha1.PowerCapConfig{Enabled: true, IntensityThreshold: ptr.To("300"), MinCapPercent: ptr.To[int32](40), DominanceRatio: ptr.To("0.7")},
+				schedulingv1alpha1.TrafficScheduleStatus{CarbonForecastNow: "450", ProcessingThrottle: "0.1"}),
+		}, want: powerCapDecision{enabled: true, percent: 40, dominance: 0.7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decidePowerCap(tt.schedules, now); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPowerCapNodes(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	var objs []runtime.Object
+	pod := func(node string, phase corev1.PodPhase, labels map[string]string) {
+		p := placedPod(node, phase)
+		p.Name = fmt.Sprintf("pod-%d", len(objs))
+		p.Labels = labels
+		objs = append(objs, p)
+	}
+	flavour := map[string]string{precisionLabel: "50"}
+	buffer := map[string]string{parentServiceLabel: "checkout"}
+	// node-a: 2 of 3 running pods are managed; node-b: 1 of 3; node-c: none running.
+	pod("node-a", corev1.PodRunning, flavour)
+	pod("node-a", corev1.PodRunning, buffer)
+	pod("node-a", corev1.PodRunning, nil)
+	pod("node-b", corev1.PodRunning, flavour)
+	pod("node-b", corev1.PodRunning, nil)
+	pod("node-b", corev1.PodRunning, nil)
+	pod("node-b", corev1.PodPending, flavour)
+	pod("node-c", corev1.PodSucceeded, flavour)
+	pod("", corev1.PodPending, flavour)
+	for _, name := range []string{"node-a", "node-b", "node-c"} {
+		node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if name != "node-a" {
+			node.Annotations = map[string]string{poweragent.CapAnnotation: "70"}
+		}
+		objs = append(objs, node)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objs...).Build()
+	r := &PowerCapReconciler{Client: c, Scheme: scheme}
+	ctx := context.Background()
+
+	ratios := []struct {
+		ratio float64
+		want  []string
+	}{
+		{ratio: 0.5, want: []string{"node-a"}},
+		{ratio: 0.3, want: []string{"node-a", "node-b"}},
+		{ratio: 0.9},
+	}
+	for _, tt := range ratios {
+		got, err := r.dominatedNodes(ctx, tt.ratio)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]struct{}{}
+		for _, name := range tt.want {
+			want[name] = struct{}{}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ratio %v: got %v, want %v", tt.ratio, got, want)
+		}
+	}
+
+	if err := r.annotateNodes(ctx, map[string]struct{}{"node-a": {}, "node-b": {}}, 60); err != nil {
+		t.Fatal(err)
+	}
+	var nodes corev1.NodeList
+	if err := c.List(ctx, &nodes); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"node-a": "60", "node-b": "60", "node-c": ""}
+	for _, node := range nodes.Items {
+		if got := node.Annotations[poweragent.CapAnnotation]; got != want[node.Name] {
+			t.Errorf("%s: got cap %q, want %q", node.Name, got, want[node.Name])
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// conditionPrecisionDrift is True while the flavour Deployments of a routed
+// Service differ in ways that break some of its subsets.
+const conditionPrecisionDrift = "carbonrouter.io/PrecisionDrift"
+
+// metricsAnnotations are the pod template annotations telling Prometheus how
+// to scrape a flavour. A flavour scraped differently drops out of the
+// per-precision dashboards and ScaledObject queries.
+var metricsAnnotations = []string{"prometheus.io/scrape", "prometheus.io/port", "prometheus.io/path"}
+
+var precisionDriftGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "carbonrouter_precision_drift",
+	Help: "1 while the flavour Deployments of a routed service diverge in ports, protocols or metrics endpoints.",
+}, []string{"namespace", "service"})
+
+func init() {
+	metrics.Registry.MustRegister(precisionDriftGauge)
+}
+
+// servedPort is what a flavour serves behind one port of the Service.
+type servedPort struct {
+	number   int32
+	protocol corev1.Protocol
+	// scheme is the port name up to the first dash, which is how Istio tells
+	// http, http2 and grpc apart when the Service does not say.
+	scheme string
+}
+
+func (p servedPort) String() string {
+	if p.scheme == "" {
+		return fmt.Sprintf("%d/%s", p.number, p.protocol)
+	}
+	return fmt.Sprintf("%d/%s (%s)", p.number, p.protocol, p.scheme)
+}
+
+// resolveServedPort finds the container port a Service port reaches in a pod
+// template, the way the endpoints controller does. Named target ports must be
+// declared; numeric ones work undeclared, so they only fail to resolve a scheme.
+func resolveServedPort(sp corev1.ServicePort, spec corev1.PodSpec) (servedPort, bool) {
+	target := sp.TargetPort
+	if target.Type == intstr.Int && target.IntVal == 0 {
+		target = intstr.FromInt32(sp.Port)
+	}
+	protocol := sp.Protocol
+	if protocol == "" {
+		protocol = corev1.ProtocolTCP
+	}
+	for _, container := range spec.Containers {
+		for _, port := range container.Ports {
+			portProtocol := port.Protocol
+			if portProtocol == "" {
+				portProtocol = corev1.ProtocolTCP
+			}
+			if portProtocol != protocol {
+				continue
+			}
+			if (target.Type == intstr.String && port.Name == target.StrVal) || (target.Type == intstr.Int && port.ContainerPort == target.IntVal) {
+				scheme, _, _ := strings.Cut(strings.ToLower(port.Name), "-")
+				return servedPort{number: port.ContainerPort, protocol: portProtocol, scheme: scheme}, true
+			}
+		}
+	}
+	if target.Type == intstr.String {
+		return servedPort{}, false
+	}
+	return servedPort{number: target.IntVal, protocol: protocol}, true
+}
+
+// precisionDrift compares every flavour Deployment of svc with the highest
+// precision one and returns what differs: the container port or protocol
+// behind each Service port, and the metrics scrape annotations. Such drift
+// only shows up as 503s on some subsets, so it is reported instead of guessed at.
+func precisionDrift(svc *corev1.Service, deployments map[int]*appsv1.Deployment) []string {
+	precisions := slices.Sorted(maps.Keys(deployments))
+	if len(precisions) == 0 {
+		return nil
+	}
+	reference := precisions[len(precisions)-1]
+	refSpec := deployments[reference].Spec.Template
+	var drift []string
+	for _, precision := range precisions {
+		dep := deployments[precision]
+		spec := dep.Spec.Template
+		subject := fmt.Sprintf("%s (deployment %s)", precisionSubsetName(precision), dep.Name)
+		for _, sp := range svc.Spec.Ports {
+			served, ok := resolveServedPort(sp, spec.Spec)
+			if !ok {
+				drift = append(drift, fmt.Sprintf("%s does not declare port %q targeted by service port %d", subject, sp.TargetPort.StrVal, sp.Port))
+				continue
+			}
+			if precision == reference {
+				continue
+			}
+			want, ok := resolveServedPort(sp, refSpec.Spec)
+			if ok && served != want {
+				drift = append(drift, fmt.Sprintf("%s serves service port %d on %s, %s serves it on %s", subject, sp.Port, served, precisionSubsetName(reference), want))
+			}
+		}
+		if precision == reference {
+			continue
+		}
+		for _, annotation := range metricsAnnotations {
+			got, want := spec.Annotations[annotation], refSpec.Annotations[annotation]
+			if got != want {
+				drift = append(drift, fmt.Sprintf("%s has %s=%q, %s has %q", subject, annotation, got, precisionSubsetName(reference), want))
+			}
+		}
+	}
+	return drift
+}
+
+func precisionDriftCondition(drift []string) metav1.Condition {
+	return metav1.Condition{
+		Type:    conditionPrecisionDrift,
+		Status:  metav1.ConditionTrue,
+		Reason:  "TemplateDrift",
+		Message: strings.Join(drift, "; "),
+	}
+}
+
+// reportPrecisionDrift sets or clears the PrecisionDrift condition of svc and
+// its gauge. Drift is reported only; routing goes on with the subsets that work.
+func (r *FlavourRouterReconciler) reportPrecisionDrift(ctx context.Context, svc *corev1.Service, deployments map[int]*appsv1.Deployment) error {
+	drift := precisionDrift(svc, deployments)
+	if len(drift) == 0 {
+		precisionDriftGauge.WithLabelValues(svc.Namespace, svc.Name).Set(0)
+		return r.clearServiceCondition(ctx, svc, conditionPrecisionDrift)
+	}
+	ctrl.LoggerFrom(ctx).WithName("[FlavourRouter]").Info("Flavour deployments diverge", "service", svc.Name, "drift", drift)
+	precisionDriftGauge.WithLabelValues(svc.Namespace, svc.Name).Set(1)
+	cond := precisionDriftCondition(drift)
+	if conditionTransitions(svc.Status.Conditions, cond) {
+		recordEvent(r.Recorder, svc, corev1.EventTypeWarning, eventPrecisionDriftFound, "%s", cond.Message)
+	}
+	return r.setServiceCondition(ctx, svc, cond)
+}
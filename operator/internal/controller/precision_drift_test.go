@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func flavourTemplate(name string, ports []corev1.ContainerPort, annotations map[string]string) *appsv1.Deployment {
+	dep := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name}}
+	dep.Spec.Template.Annotations = annotations
+	dep.Spec.Template.Spec.Containers = []corev1.Container{{Name: "app", Ports: ports}}
+	return dep
+}
+
+func TestResolveServedPort(t *testing.T) {
+	spec := corev1.PodSpec{Containers: []corev1.Container{
+		{Name: "sidecar", Ports: []corev1.ContainerPort{{Name: "metrics", ContainerPort: 9090}}},
+		{Name: "app", Ports: []corev1.ContainerPort{
+			{Name: "HTTP-web", ContainerPort: 8080},
+			{Name: "dns", ContainerPort: 53, Protocol: corev1.ProtocolUDP},
+		}},
+	}}
+	tests := []struct {
+		name string
+		port corev1.ServicePort
+		want servedPort
+		ok   bool
+	}{
+		{name: "named", port: corev1.ServicePort{Port: 80, TargetPort: intstr.FromString("HTTP-web")},
+			want: servedPort{number: 8080, protocol: corev1.ProtocolTCP, scheme: "http"}, ok: true},
+		{name: "numbered", port: corev1.ServicePort{Port: 80, TargetPort: intstr.FromInt32(9090)},
+			want: servedPort{number: 9090, protocol: corev1.ProtocolTCP, scheme: "metrics"}, ok: true},
+		{name: "defaults to the port", port: corev1.ServicePort{Port: 8080},
+			want: servedPort{number: 8080, protocol: corev1.ProtocolTCP, scheme: "http"}, ok: true},
+		{name: "undeclared number", port: corev1.ServicePort{Port: 80, TargetPort: intstr.FromInt32(3000)},
+			want: servedPort{number: 3000, protocol: corev1.ProtocolTCP}, ok: true},
+		{name: "other protocol", port: corev1.ServicePort{Port: 53, Protocol: corev1.ProtocolTCP, TargetPort: intstr.FromString("dns")}},
+		{name: "undeclared name", port: corev1.ServicePort{Port: 80, TargetPort: intstr.FromString("grpc")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := resolveServedPort(tt.port, spec)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("got %v (%v), want %v (%v)", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestPrecisionDrift(t *testing.T) {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout"}, Spec: corev1.ServiceSpec{
+		Ports: []corev1.ServicePort{{Port: 80, TargetPort: intstr.FromString("http")}},
+	}}
+	scrape := map[string]string{"prometheus.io/scrape": "true", "prometheus.io/port": "8080"}
+	httpPort := []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}}
+
+	if drift := precisionDrift(svc, nil); drift != nil {
+		t.Errorf("no deployments: got %v", drift)
+	}
+	aligned := map[int]*appsv1.Deployment{
+		100: flavourTemplate("checkout-100", httpPort, scrape),
+		50:  flavourTemplate("checkout-50", httpPort, scrape),
+	}
+	if drift := precisionDrift(svc, aligned); len(drift) != 0 {
+		t.Errorf("aligned: got %v", drift)
+	}
+
+	drift := precisionDrift(svc, map[int]*appsv1.Deployment{
+		100: flavourTemplate("checkout-100", httpPort, scrape),
+		50:  flavourTemplate("checkout-50", []corev1.ContainerPort{{Name: "http", ContainerPort: 9000}}, scrape),
+		30:  flavourTemplate("checkout-30", []corev1.ContainerPort{{Name: "web", ContainerPort: 8080}}, map[string]string{"prometheus.io/scrape": "true"}),
+	})
+	want := []string{
+		`precision-30 (deployment checkout-30) does not declare port "http"`,
+		`precision-30 (deployment checkout-30) has prometheus.io/port=""`,
+		`precision-50 (deployment checkout-50) serves service port 80 on 9000/TCP (http), precision-100 serves it on 8080/TCP (http)`,
+	}
+	if len(drift) != len(want) {
+		t.Fatalf("got drift %q, want %d findings", drift, len(want))
+	}
+	for i := range want {
+		if !strings.HasPrefix(drift[i], want[i]) {
+			t.Errorf("got %q, want %q", drift[i], want[i])
+		}
+	}
+}
+
+func TestReportPrecisionDrift(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout"}, Spec: corev1.ServiceSpec{
+		Ports: []corev1.ServicePort{{Port: 80, TargetPort: intstr.FromInt32(8080)}},
+	}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(svc).WithStatusSubresource(svc).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme, Recorder: recorder}
+	ctx := context.Background()
+	drifting := map[int]*appsv1.Deployment{
+		100: flavourTemplate("checkout-100", nil, map[string]string{"prometheus.io/scrape": "true"}),
+		50:  flavourTemplate("checkout-50", nil, nil),
+	}
+	condition := func() *metav1.Condition {
+		var got corev1.Service
+		if err := c.Get(ctx, client.ObjectKeyFromObject(svc), &got); err != nil {
+			t.Fatal(err)
+		}
+		return meta.FindStatusCondition(got.Status.Conditions, conditionPrecisionDrift)
+	}
+
+	for range 2 {
+		if err := r.reportPrecisionDrift(ctx, svc, drifting); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cond := condition(); cond == nil || cond.Status != metav1.ConditionTrue || !strings.Contains(cond.Message, "prometheus.io/scrape") {
+		t.Errorf("got condition %v, want the scrape annotation drift", cond)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("got %d events, want one on the transition", len(recorder.Events))
+	}
+
+	drifting[50] = drifting[100]
+	if err := r.reportPrecisionDrift(ctx, svc, drifting); err != nil {
+		t.Fatal(err)
+	}
+	if cond := condition(); cond != nil {
+		t.Errorf("got condition %v once aligned, want it cleared", cond)
+	}
+}
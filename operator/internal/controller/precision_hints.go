@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+// PrecisionHintsPattern is the operator API route clients read the precision
+// hints of a routed Service from.
+const PrecisionHintsPattern = "GET /hints/{namespace}/{service}"
+
+// PrecisionHints tells smart clients which precision the schedule of a routed
+// Service currently favours and when the grid will be greenest, so they can
+// pre-set the routing header or defer batch work themselves.
+type PrecisionHints struct {
+	reader              client.Reader
+	token               []byte
+	killSwitchNamespace string
+}
+
+// NewPrecisionHints returns a PrecisionHints reading Services and schedules
+// through reader. Clients must send token as a bearer token.
+func NewPrecisionHints(reader client.Reader, token, killSwitchNamespace string) *PrecisionHints {
+	return &PrecisionHints{reader: reader, token: []byte(token), killSwitchNamespace: killSwitchNamespace}
+}
+
+// precisionHint is the JSON document served for a Service.
+type precisionHint struct {
+	Service  string `json:"service"`
+	Schedule string `json:"schedule"`
+	// Header and HeaderValue pin a request to RecommendedPrecision.
+	Header               string                            `json:"header"`
+	HeaderValue          string                            `json:"headerValue"`
+	RecommendedPrecision int                               `json:"recommendedPrecision"`
+	Weights              map[string]int                    `json:"weights"`
+	ValidUntil           time.Time                         `json:"validUntil"`
+	CarbonNow            string                            `json:"carbonNow,omitempty"`
+	CarbonNext           string                            `json:"carbonNext,omitempty"`
+	GreenWindow          *schedulingv1alpha1.ForecastSlot  `json:"greenWindow,omitempty"`
+	Forecast             []schedulingv1alpha1.ForecastSlot `json:"forecast,omitempty"`
+}
+
+// ServeHTTP serves the hints of the routed Service {namespace}/{service}.
+func (h *PrecisionHints) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	token, _ := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), h.token) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ctx := req.Context()
+	key := types.NamespacedName{Namespace: req.PathValue("namespace"), Name: req.PathValue("service")}
+	var svc corev1.Service
+	if err := h.reader.Get(ctx, key, &svc); err != nil {
+		h.fail(w, err)
+		return
+	}
+	routed, err := routedServiceFor(ctx, h.reader, &svc)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	if !optedIn(&svc, routed) {
+		http.Error(w, "service is not routed by carbonrouter", http.StatusNotFound)
+		return
+	}
+	var schedules schedulingv1alpha1.TrafficScheduleList
+	if err := h.reader.List(ctx, &schedules); err != nil {
+		h.fail(w, err)
+		return
+	}
+	ts, _, _ := bindSchedule(&svc, schedules.Items)
+	if ts == nil || len(ts.Status.Flavours) == 0 {
+		http.Error(w, "no schedule applies to the service yet", http.StatusServiceUnavailable)
+		return
+	}
+	status := ts.Status
+	killed, err := killSwitchEngaged(ctx, h.reader, h.killSwitchNamespace)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	if killed {
+		status = killSwitchStatus(status)
+	} else if override := activeOverride(routed, time.Now()); override != nil {
+		if pinned, err := overriddenStatus(status, override); err == nil {
+			status = pinned
+		}
+	} else if routed != nil && routed.Spec.SLOGuard != nil && routed.Status.SLOGuard != nil && routed.Status.SLOGuard.Intervening {
+		if guarded, err := sloGuardedStatus(status, routed.Spec.SLOGuard); err == nil {
+			status = guarded
+		}
+	}
+
+	forecast := upcomingForecast(status.ForecastSchedule, time.Now())
+	hint := precisionHint{
+		Service:     key.String(),
+		Schedule:    ts.Namespace + "/" + ts.Name,
+		Header:      routingHeader(routed),
+		Weights:     make(map[string]int, len(status.Flavours)),
+		ValidUntil:  status.ValidUntil.Time,
+		CarbonNow:   status.CarbonForecastNow,
+		CarbonNext:  status.CarbonForecastNext,
+		GreenWindow: greenWindow(forecast),
+		Forecast:    forecast,
+	}
+	best := status.Flavours[0]
+	for _, flavour := range status.Flavours {
+		hint.Weights[precisionSubsetName(flavour.Precision)] = flavour.Weight
+		// Ties go to the higher precision
+		if flavour.Weight > best.Weight || (flavour.Weight == best.Weight && flavour.Precision > best.Precision) {
+			best = flavour
+		}
+	}
+	hint.RecommendedPrecision = best.Precision
+	hint.HeaderValue = precisionHeaderValue(best.Precision)
+
+	w.Header().Set("Content-Type", "application/json")
+	// Hints change with the schedule, so clients may cache them until then
+	if maxAge := int(time.Until(status.ValidUntil.Time).Seconds()); maxAge > 0 {
+		w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(maxAge))
+	}
+	_ = json.NewEncoder(w).Encode(hint)
+}
+
+func (h *PrecisionHints) fail(w http.ResponseWriter, err error) {
+	if apierrors.IsNotFound(err) {
+		http.Error(w, "service not found", http.StatusNotFound)
+		return
+	}
+	ctrl.Log.WithName("[PrecisionHints]").Error(err, "Failed to serve precision hints")
+	http.Error(w, "internal error", http.StatusInternalServerError)
+}
+
+// upcomingForecast drops the slots that ended since the schedule was computed.
+func upcomingForecast(slots []schedulingv1alpha1.ForecastSlot, now time.Time) []schedulingv1alpha1.ForecastSlot {
+	var upcoming []schedulingv1alpha1.ForecastSlot
+	for _, slot := range slots {
+		if end, err := time.Parse(time.RFC3339, slot.To); err == nil && end.After(now) {
+			upcoming = append(upcoming, slot)
+		}
+	}
+	return upcoming
+}
+
+// greenWindow returns the slot with the lowest forecast, the earliest one on
+// ties.
+func greenWindow(slots []schedulingv1alpha1.ForecastSlot) *schedulingv1alpha1.ForecastSlot {
+	var best *schedulingv1alpha1.ForecastSlot
+	bestForecast := 0.0
+	for i := range slots {
+		forecast, err := strconv.ParseFloat(slots[i].Forecast, 64)
+		if err != nil {
+			continue
+		}
+		if best == nil || forecast < bestForecast {
+			best, bestForecast = &slots[i], forecast
+		}
+	}
+	return best
+}
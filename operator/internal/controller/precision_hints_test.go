@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestGreenWindow(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 10, 0, 0, time.UTC)
+	slots := []schedulingv1alpha1.ForecastSlot{
+		{From: "2025-06-01T11:30:00Z", To: "2025-06-01T12:00:00Z", Forecast: "50"},
+		{From: "2025-06-01T12:00:00Z", To: "2025-06-01T12:30:00Z", Forecast: "210"},
+		{From: "2025-06-01T12:30:00Z", To: "2025-06-01T13:00:00Z"},
+		{From: "2025-06-01T13:00:00Z", To: "2025-06-01T13:30:00Z", Forecast: "120"},
+		{From: "2025-06-01T13:30:00Z", To: "2025-06-01T14:00:00Z", Forecast: "120"},
+		{From: "2025-06-01T14:00:00Z", To: "soon", Forecast: "10"},
+	}
+	upcoming := upcomingForecast(slots, now)
+	if len(upcoming) != 4 || upcoming[0].Forecast != "210" {
+		t.Fatalf("got %v, want the ended and unparsable slots dropped", upcoming)
+	}
+	if window := greenWindow(upcoming); window == nil || window.From != "2025-06-01T13:00:00Z" {
+		t.Errorf("got window %v, want the earliest of the greenest slots", window)
+	}
+	if window := greenWindow(upcoming[1:2]); window != nil {
+		t.Errorf("got window %v without forecasts, want none", window)
+	}
+}
+
+func TestPrecisionHints(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := schedulingv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	enabled := map[string]string{enableLabel: "true"}
+	ts := boundSchedule("ops", "default", 0, schedulingv1alpha1.ServiceSelector{})
+	ts.Status = schedulingv1alpha1.TrafficScheduleStatus{
+		Flavours:           []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 40}, {Precision: 50, Weight: 40}, {Precision: 30, Weight: 20}},
+		ValidUntil:         metav1.NewTime(time.Now().Add(5 * time.Minute)),
+		CarbonForecastNow:  "210",
+		CarbonForecastNext: "180",
+		ForecastSchedule: []schedulingv1alpha1.ForecastSlot{
+			{From: "2099-06-01T12:00:00Z", To: "2099-06-01T12:30:00Z", Forecast: "210"},
+			{From: "2099-06-01T12:30:00Z", To: "2099-06-01T13:00:00Z", Forecast: "90"},
+		},
+	}
+	objs := []client.Object{
+		&ts,
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout", Labels: enabled}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "legacy"}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "cart"}},
+		&schedulingv1alpha1.CarbonRoutedService{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "cart"},
+			Spec:       schedulingv1alpha1.CarbonRoutedServiceSpec{ServiceName: "cart", RoutingHeader: "x-precision"},
+		},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "catalog", Name: "search", Labels: enabled}},
+	}
+	// Only the schedule of catalog has not been computed yet
+	pending := boundSchedule("catalog", "local", 0, schedulingv1alpha1.ServiceSelector{Namespaces: []string{"catalog"}})
+	objs = append(objs, &pending)
+
+	serve := func(c client.Reader, path, token string) *httptest.ResponseRecorder {
+		mux := http.NewServeMux()
+		mux.Handle(PrecisionHintsPattern, NewPrecisionHints(c, "s3cret", "carbonrouter-system"))
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+
+	tests := []struct {
+		path  string
+		token string
+		code  int
+	}{
+		{path: "/hints/shop/checkout", token: "guess", code: http.StatusUnauthorized},
+		{path: "/hints/shop/missing", token: "s3cret", code: http.StatusNotFound},
+		{path: "/hints/shop/legacy", token: "s3cret", code: http.StatusNotFound},
+		{path: "/hints/catalog/search", token: "s3cret", code: http.StatusServiceUnavailable},
+		{path: "/hints/shop/checkout", token: "s3cret", code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		if rec := serve(c, tt.path, tt.token); rec.Code != tt.code {
+			t.Errorf("%s with token %q: got %d, want %d", tt.path, tt.token, rec.Code, tt.code)
+		}
+	}
+
+	decode := func(rec *httptest.ResponseRecorder) precisionHint {
+		var hint precisionHint
+		if err := json.NewDecoder(rec.Body).Decode(&hint); err != nil {
+			t.Fatal(err)
+		}
+		return hint
+	}
+	rec := serve(c, "/hints/shop/checkout", "s3cret")
+	if cache := rec.Header().Get("Cache-Control"); cache == "" || cache == "private, max-age=0" {
+		t.Errorf("got Cache-Control %q, want the hints cached until the schedule expires", cache)
+	}
+	hint := decode(rec)
+	// 100 and 50 tie on weight
+	if hint.Schedule != "ops/default" || hint.RecommendedPrecision != 100 || hint.Header != defaultRoutingHeader || hint.HeaderValue != "100" {
+		t.Errorf("got %+v, want precision 100 recommended", hint)
+	}
+	if hint.GreenWindow == nil || hint.GreenWindow.Forecast != "90" || len(hint.Forecast) != 2 || hint.Weights["precision-30"] != 20 {
+		t.Errorf("got %+v, want the weights, the forecast and its greenest slot", hint)
+	}
+	if hint := decode(serve(c, "/hints/shop/cart", "s3cret")); hint.Header != "x-precision" {
+		t.Errorf("got header %q, want the one of the CarbonRoutedService", hint.Header)
+	}
+
+	// The kill switch sends everything to the highest precision
+	killed := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).WithObjects(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "carbonrouter-system", Name: killSwitchConfigMap},
+		Data:       map[string]string{killSwitchKey: "true"},
+	}).Build()
+	if hint := decode(serve(killed, "/hints/shop/checkout", "s3cret")); hint.RecommendedPrecision != 100 || hint.Weights["precision-100"] != 100 {
+		t.Errorf("got %+v with the kill switch engaged, want everything on precision 100", hint)
+	}
+}
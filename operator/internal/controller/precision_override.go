@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+// precisionOverridePolicy is the active policy of a schedule pinned by the
+// spec.override of a CarbonRoutedService.
+const precisionOverridePolicy = "override"
+
+// activeOverride returns the spec.override of routed while in force at now.
+func activeOverride(routed *schedulingv1alpha1.CarbonRoutedService, now time.Time) *schedulingv1alpha1.PrecisionOverride {
+	if routed == nil || routed.Spec.Override == nil {
+		return nil
+	}
+	override := routed.Spec.Override
+	if override.Until != nil && !now.Before(override.Until.Time) {
+		return nil
+	}
+	return override
+}
+
+// overriddenStatus pins the schedule of a Service to the precision of
+// override. The schedule expires with the override at the latest, so the
+// Service is reconciled back to the schedule when it lapses.
+func overriddenStatus(status schedulingv1alpha1.TrafficScheduleStatus, override *schedulingv1alpha1.PrecisionOverride) (schedulingv1alpha1.TrafficScheduleStatus, error) {
+	precision := highestPrecision(status.Flavours)
+	if override.Precision != nil {
+		precision = *override.Precision
+		known := false
+		for _, flavour := range status.Flavours {
+			known = known || flavour.Precision == precision
+		}
+		if !known {
+			return status, invalidConfigError(fmt.Errorf("spec.override.precision: %d is not a precision of the bound schedule", precision))
+		}
+	}
+	out := pinnedStatus(status, precision, precisionOverridePolicy)
+	if override.Until != nil && (out.ValidUntil.IsZero() || override.Until.Before(&out.ValidUntil)) {
+		out.ValidUntil = *override.Until
+	}
+	return out, nil
+}
@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	kedav1alpha1 "github.com/kedacore/keda/v2/apis/keda/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/engine"
+)
+
+// flavourDeploymentPredicate passes flavour Deployments appearing, going away
+// or changing their labels, which changes the flavours of the schedules.
+func flavourDeploymentPredicate() predicate.Funcs {
+	isFlavour := func(obj client.Object) bool { return obj.GetLabels()[precisionLabel] != "" }
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool { return isFlavour(e.Object) },
+		DeleteFunc: func(e event.DeleteEvent) bool { return isFlavour(e.Object) },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return (isFlavour(e.ObjectOld) || isFlavour(e.ObjectNew)) && !maps.Equal(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels())
+		},
+		GenericFunc: func(event.GenericEvent) bool { return false },
+	}
+}
+
+// retireRemovedPrecisions drops the precisions of schedule whose Deployments
+// are gone, which the engine keeps weighting until it gets the new flavours.
+// Their weight moves onto the remaining precisions in proportion to their own
+// weight, or entirely onto the highest one when the others weigh nothing. A
+// schedule left without any discovered precision is returned as is.
+func retireRemovedPrecisions(log logr.Logger, schedule engine.Schedule, discovered []schedulerFlavour) engine.Schedule {
+	alive := make(map[string]struct{}, len(discovered))
+	for _, flavour := range discovered {
+		alive[flavour.Name] = struct{}{}
+	}
+	var kept, retired []engine.FlavourWeight
+	for _, flavour := range schedule.Flavours {
+		if _, ok := alive[precisionSubsetName(flavour.Precision)]; ok {
+			kept = append(kept, flavour)
+		} else {
+			retired = append(retired, flavour)
+		}
+	}
+	if len(discovered) == 0 || len(retired) == 0 || len(kept) == 0 {
+		return schedule
+	}
+	shares := make([]float64, len(kept))
+	highest := 0
+	for i, flavour := range kept {
+		shares[i] = float64(max(flavour.Weight, 0))
+		if flavour.Precision > kept[highest].Precision {
+			highest = i
+		}
+	}
+	if slices.Max(shares) == 0 {
+		shares[highest] = 1
+	}
+	weights := roundPercentages(shares)
+	schedule.FlavourWeights = maps.Clone(schedule.FlavourWeights)
+	for i := range kept {
+		kept[i].Weight = weights[i]
+		if schedule.FlavourWeights != nil {
+			schedule.FlavourWeights[kept[i].Name] = weights[i]
+		}
+	}
+	for _, flavour := range retired {
+		delete(schedule.FlavourWeights, flavour.Name)
+		log.Info("Retiring precision whose deployment was removed",
+			"event", "PrecisionRetired", "precision", flavour.Precision, "weight", flavour.Weight, "validUntil", schedule.ValidUntil)
+	}
+	schedule.Flavours = kept
+	return schedule
+}
+
+// retirePrecisionScaledObjects deletes the precision ScaledObjects of svc whose
+// Deployment is gone, rather than leaving them to scale a missing target until
+// the schedule drops the precision.
+func (r *FlavourRouterReconciler) retirePrecisionScaledObjects(ctx context.Context, svc *corev1.Service, deployments map[int]*appsv1.Deployment) error {
+	log := ctrl.LoggerFrom(ctx).WithName("[FlavourRouter]")
+	prefix := svc.Name + "-precision-"
+	for _, name := range r.precisionScaledObjectNames(ctx, svc) {
+		suffix, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		precision, err := strconv.Atoi(suffix)
+		if _, alive := deployments[precision]; err != nil || alive {
+			continue
+		}
+		so := &kedav1alpha1.ScaledObject{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: svc.Namespace}}
+		if err := r.Delete(ctx, so); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		r.Inventory.Drop(client.ObjectKeyFromObject(svc), "ScaledObject", svc.Namespace, name)
+		log.Info("Retired ScaledObject of removed precision", "event", "PrecisionRetired", "service", svc.Name, "precision", precision, "scaledObject", name)
+	}
+	return nil
+}
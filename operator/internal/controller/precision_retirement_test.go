@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/go-logr/logr"
+	kedav1alpha1 "github.com/kedacore/keda/v2/apis/keda/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/engine"
+)
+
+func TestRetireRemovedPrecisions(t *testing.T) {
+	discovered := func(precisions ...int) []schedulerFlavour {
+		var out []schedulerFlavour
+		for _, precision := range precisions {
+			out = append(out, schedulerFlavour{Name: precisionSubsetName(precision), Precision: float64(precision)})
+		}
+		return out
+	}
+	schedule := func(weights map[int]int) engine.Schedule {
+		s := engine.Schedule{FlavourWeights: map[string]int{}}
+		for _, precision := range []int{100, 50, 30} {
+			if weight, ok := weights[precision]; ok {
+				s.Flavours = append(s.Flavours, engine.FlavourWeight{Name: precisionSubsetName(precision), Precision: precision, Weight: weight})
+				s.FlavourWeights[precisionSubsetName(precision)] = weight
+			}
+		}
+		return s
+	}
+	tests := []struct {
+		name       string
+		schedule   engine.Schedule
+		discovered []schedulerFlavour
+		want       map[string]int
+	}{
+		{name: "nothing removed", schedule: schedule(map[int]int{100: 20, 50: 80}), discovered: discovered(100, 50),
+			want: map[string]int{"precision-100": 20, "precision-50": 80}},
+		{name: "weight moves in proportion", schedule: schedule(map[int]int{100: 20, 50: 40, 30: 40}), discovered: discovered(100, 50),
+			want: map[string]int{"precision-100": 33, "precision-50": 67}},
+		{name: "weightless survivors fall back to the highest", schedule: schedule(map[int]int{100: 0, 50: 0, 30: 100}), discovered: discovered(100, 50),
+			want: map[string]int{"precision-100": 100, "precision-50": 0}},
+		{name: "no survivor", schedule: schedule(map[int]int{30: 100}), discovered: discovered(100),
+			want: map[string]int{"precision-30": 100}},
+		{name: "nothing discovered", schedule: schedule(map[int]int{100: 50, 30: 50}),
+			want: map[string]int{"precision-100": 50, "precision-30": 50}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := tt.schedule.FlavourWeights
+			before := len(original)
+			got := retireRemovedPrecisions(logr.Discard(), tt.schedule, tt.discovered)
+			if !reflect.DeepEqual(got.FlavourWeights, tt.want) {
+				t.Errorf("got weights %v, want %v", got.FlavourWeights, tt.want)
+			}
+			total := 0
+			for _, flavour := range got.Flavours {
+				if got.FlavourWeights[flavour.Name] != flavour.Weight {
+					t.Errorf("%s: flavour weight %d differs from %d", flavour.Name, flavour.Weight, got.FlavourWeights[flavour.Name])
+				}
+				total += flavour.Weight
+			}
+			if total != 100 {
+				t.Errorf("got weights summing to %d, want 100", total)
+			}
+			if len(original) != before {
+				t.Error("weights of the engine schedule changed in place")
+			}
+		})
+	}
+}
+
+func TestFlavourDeploymentPredicate(t *testing.T) {
+	deployment := func(labels map[string]string) *appsv1.Deployment {
+		return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout-50", Labels: labels}}
+	}
+	flavour := deployment(map[string]string{precisionLabel: "50"})
+	plain := deployment(map[string]string{"app": "checkout"})
+	p := flavourDeploymentPredicate()
+
+	if !p.Create(event.CreateEvent{Object: flavour}) || p.Create(event.CreateEvent{Object: plain}) {
+		t.Error("create: want flavour Deployments only")
+	}
+	if !p.Delete(event.DeleteEvent{Object: flavour}) || p.Delete(event.DeleteEvent{Object: plain}) {
+		t.Error("delete: want flavour Deployments only")
+	}
+	scaled := flavour.DeepCopy()
+	scaled.Spec.Replicas = new(int32)
+	if p.Update(event.UpdateEvent{ObjectOld: flavour, ObjectNew: scaled}) {
+		t.Error("update without label change passed")
+	}
+	if !p.Update(event.UpdateEvent{ObjectOld: flavour, ObjectNew: plain}) || !p.Update(event.UpdateEvent{ObjectOld: plain, ObjectNew: flavour}) {
+		t.Error("precision label added or removed: want passed")
+	}
+	if p.Generic(event.GenericEvent{Object: flavour}) {
+		t.Error("generic event passed")
+	}
+}
+
+func TestRetirePrecisionScaledObjects(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := kedav1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout"}}
+	scaledObject := func(name string) *kedav1alpha1.ScaledObject {
+		return &kedav1alpha1.ScaledObject{ObjectMeta: metav1.ObjectMeta{
+			Namespace: "shop", Name: name, Labels: map[string]string{parentServiceLabel: "checkout"},
+		}}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		scaledObject("checkout-precision-100"),
+		scaledObject("checkout-precision-30"),
+		scaledObject("checkout-consumer"),
+	).Build()
+	inventory := NewResourceInventory()
+	key := client.ObjectKeyFromObject(svc)
+	inventory.Record(key, "ScaledObject", "shop", "checkout-precision-30", nil, true)
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme, Inventory: inventory}
+	ctx := context.Background()
+
+	if err := r.retirePrecisionScaledObjects(ctx, svc, map[int]*appsv1.Deployment{100: {}}); err != nil {
+		t.Fatal(err)
+	}
+	var remaining kedav1alpha1.ScaledObjectList
+	if err := c.List(ctx, &remaining); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, so := range remaining.Items {
+		names = append(names, so.Name)
+	}
+	sort.Strings(names)
+	if want := []string{"checkout-consumer", "checkout-precision-100"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got ScaledObjects %v, want %v", names, want)
+	}
+	if inventory.Has(key, "ScaledObject", "shop", "checkout-precision-30") {
+		t.Error("retired ScaledObject kept in the inventory")
+	}
+}
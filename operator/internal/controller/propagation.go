@@ -0,0 +1,274 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/yaml"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	// conditionPropagated reports whether the schedule reached its member clusters.
+	conditionPropagated = "carbonrouter.io/Propagated"
+
+	propagationKarmada    = "karmada"
+	propagationClusterAPI = "cluster-api"
+	// propagatedFromLabel marks the propagation objects of a schedule with its
+	// name, to find those of removed members.
+	propagatedFromLabel = "carbonrouter/propagated-from"
+	// clusterNameLabel selects a Cluster API Cluster by name.
+	clusterNameLabel = "cluster.x-k8s.io/cluster-name"
+	// propagatedScheduleKey holds the member schedule in the ConfigMap of a
+	// ClusterResourceSet.
+	propagatedScheduleKey = "trafficschedule.yaml"
+)
+
+var (
+	karmadaPropagationPolicyGVK = schema.GroupVersionKind{Group: "policy.karmada.io", Version: "v1alpha1", Kind: "PropagationPolicy"}
+	karmadaOverridePolicyGVK    = schema.GroupVersionKind{Group: "policy.karmada.io", Version: "v1alpha1", Kind: "OverridePolicy"}
+	clusterResourceSetGVK       = schema.GroupVersionKind{Group: "addons.cluster.x-k8s.io", Version: "v1beta1", Kind: "ClusterResourceSet"}
+)
+
+// propagationName is the name of the propagation objects of ts, suffixed
+// with the member for those of a single one.
+func propagationName(ts *schedulingv1alpha1.TrafficSchedule, member string) string {
+	if member == "" {
+		return ts.Name + "-propagation"
+	}
+	return ts.Name + "-propagation-" + member
+}
+
+// memberSchedule is the schedule a member cluster receives: the spec of ts
+// without spec.propagation, and with the carbon target of the member.
+func memberSchedule(ts *schedulingv1alpha1.TrafficSchedule, member schedulingv1alpha1.MemberCluster) *schedulingv1alpha1.TrafficSchedule {
+	out := &schedulingv1alpha1.TrafficSchedule{
+		TypeMeta:   metav1.TypeMeta{APIVersion: schedulingv1alpha1.GroupVersion.String(), Kind: "TrafficSchedule"},
+		ObjectMeta: metav1.ObjectMeta{Name: ts.Name, Namespace: ts.Namespace, Labels: ts.Labels},
+		Spec:       *ts.Spec.DeepCopy(),
+	}
+	out.Spec.Propagation = schedulingv1alpha1.PropagationConfig{}
+	if member.CarbonTarget != "" {
+		target := member.CarbonTarget
+		out.Spec.Scheduler.CarbonTarget = &target
+	}
+	return out
+}
+
+// ensurePropagation applies the objects propagating ts to its member clusters
+// through the provider of spec.propagation, and deletes those of members, or
+// providers, it no longer lists. Clusters without the CRDs of a provider have
+// none of its objects to delete.
+func (r *TrafficScheduleReconciler) ensurePropagation(ctx context.Context, ts *schedulingv1alpha1.TrafficSchedule) error {
+	cfg := ts.Spec.Propagation
+	var desired []*unstructured.Unstructured
+	if cfg.Enabled && len(cfg.Clusters) > 0 {
+		var err error
+		switch cfg.Provider {
+		case propagationClusterAPI:
+			desired, err = clusterAPIPropagation(ts)
+		default:
+			desired, err = karmadaPropagation(ts)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	keep := map[string]struct{}{}
+	for _, obj := range desired {
+		obj.SetNamespace(ts.Namespace)
+		obj.SetLabels(map[string]string{
+			"app.kubernetes.io/managed-by": "carbonrouter-operator",
+			propagatedFromLabel:            ts.Name,
+		})
+		if err := controllerutil.SetOwnerReference(ts, obj, r.Scheme); err != nil {
+			return err
+		}
+		err := r.Patch(ctx, obj, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
+		if meta.IsNoMatchError(err) {
+			provider := "Karmada"
+			if cfg.Provider == propagationClusterAPI {
+				provider = "Cluster API"
+			}
+			return dependencyMissingError(fmt.Errorf("spec.propagation requires the %s CRDs: %w", provider, err))
+		}
+		if err != nil {
+			return err
+		}
+		keep[obj.GroupVersionKind().Kind+"/"+obj.GetName()] = struct{}{}
+	}
+
+	for _, gvk := range []schema.GroupVersionKind{karmadaPropagationPolicyGVK, karmadaOverridePolicyGVK, clusterResourceSetGVK, corev1.SchemeGroupVersion.WithKind("ConfigMap")} {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		err := r.List(ctx, list, client.InNamespace(ts.Namespace), client.MatchingLabels{propagatedFromLabel: ts.Name})
+		if meta.IsNoMatchError(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for i := range list.Items {
+			obj := &list.Items[i]
+			if _, ok := keep[gvk.Kind+"/"+obj.GetName()]; ok {
+				continue
+			}
+			if err := client.IgnoreNotFound(r.Delete(ctx, obj)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// propagate runs ensurePropagation once the schedule is published and reports
+// the outcome in the Propagated condition of ts, so that a failing member
+// cluster provider never holds up the schedule of the management cluster. It
+// returns when to try again, zero when there is nothing to retry.
+func (r *TrafficScheduleReconciler) propagate(ctx context.Context, ts *schedulingv1alpha1.TrafficSchedule) time.Duration {
+	log := ctrl.LoggerFrom(ctx).WithName("[TrafficSchedule][Propagation]")
+	err := r.ensurePropagation(ctx, ts)
+	original := ts.DeepCopy()
+	var (
+		retry   time.Duration
+		changed bool
+	)
+	cfg := ts.Spec.Propagation
+	switch {
+	case err != nil:
+		log.Error(err, "Failed to propagate the schedule to the member clusters")
+		class := classify(err)
+		if class != failureInvalidConfig {
+			retry = dependencyRetryInterval
+		}
+		changed = meta.SetStatusCondition(&ts.Status.Conditions, metav1.Condition{
+			Type:               conditionPropagated,
+			Status:             metav1.ConditionFalse,
+			Reason:             string(class),
+			Message:            err.Error(),
+			ObservedGeneration: ts.Generation,
+		})
+	case cfg.Enabled && len(cfg.Clusters) > 0:
+		changed = meta.SetStatusCondition(&ts.Status.Conditions, metav1.Condition{
+			Type:               conditionPropagated,
+			Status:             metav1.ConditionTrue,
+			Reason:             "Propagated",
+			Message:            fmt.Sprintf("propagated to %d member cluster(s)", len(cfg.Clusters)),
+			ObservedGeneration: ts.Generation,
+		})
+	default:
+		changed = meta.RemoveStatusCondition(&ts.Status.Conditions, conditionPropagated)
+	}
+	if changed {
+		if err := r.Status().Patch(ctx, ts, client.MergeFrom(original)); err != nil {
+			log.Error(err, "Failed to report the propagation")
+			return dependencyRetryInterval
+		}
+	}
+	return retry
+}
+
+// karmadaPropagation propagates ts to its members with a PropagationPolicy,
+// and an OverridePolicy removing spec.propagation and setting the carbon
+// target of each member.
+func karmadaPropagation(ts *schedulingv1alpha1.TrafficSchedule) ([]*unstructured.Unstructured, error) {
+	clusters := ts.Spec.Propagation.Clusters
+	selectors := []interface{}{map[string]interface{}{
+		"apiVersion": schedulingv1alpha1.GroupVersion.String(),
+		"kind":       "TrafficSchedule",
+		"name":       ts.Name,
+	}}
+	names := make([]interface{}, 0, len(clusters))
+	for _, member := range clusters {
+		names = append(names, member.Name)
+	}
+	rules := []interface{}{map[string]interface{}{
+		"targetCluster": map[string]interface{}{"clusterNames": names},
+		"overriders": map[string]interface{}{"plaintext": []interface{}{
+			map[string]interface{}{"path": "/spec/propagation", "operator": "remove"},
+		}},
+	}}
+	for _, member := range clusters {
+		if member.CarbonTarget == "" {
+			continue
+		}
+		// The whole scheduler block is replaced, as spec.scheduler may be
+		// missing from the resource template
+		scheduler, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&memberSchedule(ts, member).Spec.Scheduler)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, map[string]interface{}{
+			"targetCluster": map[string]interface{}{"clusterNames": []interface{}{member.Name}},
+			"overriders": map[string]interface{}{"plaintext": []interface{}{
+				map[string]interface{}{"path": "/spec/scheduler", "operator": "add", "value": scheduler},
+			}},
+		})
+	}
+
+	propagation := &unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{
+		"resourceSelectors": selectors,
+		"placement": map[string]interface{}{
+			"clusterAffinity": map[string]interface{}{"clusterNames": slices.Clone(names)},
+		},
+	}}}
+	propagation.SetGroupVersionKind(karmadaPropagationPolicyGVK)
+	propagation.SetName(propagationName(ts, ""))
+	override := &unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{
+		"resourceSelectors": runtime.DeepCopyJSONValue(selectors),
+		"overrideRules":     rules,
+	}}}
+	override.SetGroupVersionKind(karmadaOverridePolicyGVK)
+	override.SetName(propagationName(ts, ""))
+	return []*unstructured.Unstructured{propagation, override}, nil
+}
+
+// clusterAPIPropagation propagates ts to each member with a ConfigMap holding
+// its member schedule and a ClusterResourceSet applying it to the Clusters
+// labelled with the member name, again whenever it changes.
+func clusterAPIPropagation(ts *schedulingv1alpha1.TrafficSchedule) ([]*unstructured.Unstructured, error) {
+	var out []*unstructured.Unstructured
+	for _, member := range ts.Spec.Propagation.Clusters {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(memberSchedule(ts, member))
+		if err != nil {
+			return nil, err
+		}
+		delete(content, "status")
+		unstructured.RemoveNestedField(content, "metadata", "creationTimestamp")
+		manifest, err := yaml.Marshal(content)
+		if err != nil {
+			return nil, err
+		}
+		name := propagationName(ts, member.Name)
+
+		cm := &unstructured.Unstructured{Object: map[string]interface{}{
+			"data": map[string]interface{}{propagatedScheduleKey: string(manifest)},
+		}}
+		cm.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+		cm.SetName(name)
+		set := &unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{
+			"strategy": "Reconcile",
+			"clusterSelector": map[string]interface{}{
+				"matchLabels": map[string]interface{}{clusterNameLabel: member.Name},
+			},
+			"resources": []interface{}{map[string]interface{}{"kind": "ConfigMap", "name": name}},
+		}}}
+		set.SetGroupVersionKind(clusterResourceSetGVK)
+		set.SetName(name)
+		out = append(out, cm, set)
+	}
+	return out, nil
+}
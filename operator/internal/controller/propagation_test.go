@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestPropagateWithoutProviderCRDs(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := schedulingv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	ts := &schedulingv1alpha1.TrafficSchedule{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "green", Generation: 2},
+		Spec: schedulingv1alpha1.TrafficScheduleSpec{Propagation: schedulingv1alpha1.PropagationConfig{
+			Enabled:  true,
+			Clusters: []schedulingv1alpha1.MemberCluster{{Name: "edge"}},
+		}},
+	}
+	// The fake client knows no Karmada kinds, like a cluster without its CRDs
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ts).WithStatusSubresource(ts).Build()
+	r := &TrafficScheduleReconciler{Client: c, Scheme: scheme}
+
+	if retry := r.propagate(context.Background(), ts); retry != dependencyRetryInterval {
+		t.Errorf("got retry %v, want %v", retry, dependencyRetryInterval)
+	}
+	cond := meta.FindStatusCondition(ts.Status.Conditions, conditionPropagated)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != string(failureDependencyMissing) || cond.ObservedGeneration != 2 {
+		t.Fatalf("got condition %+v, want a DependencyMissing failure", cond)
+	}
+
+	ts.Spec.Propagation = schedulingv1alpha1.PropagationConfig{}
+	if retry := r.propagate(context.Background(), ts); retry != 0 {
+		t.Errorf("got retry %v once disabled, want none", retry)
+	}
+	if cond := meta.FindStatusCondition(ts.Status.Conditions, conditionPropagated); cond != nil {
+		t.Errorf("condition kept once disabled: %+v", cond)
+	}
+}
@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	defaultQueueNameTemplate    = "{namespace}.{service}.{type}.{flavour}"
+	defaultExchangeNameTemplate = "{namespace}.{service}"
+
+	queueTypeDirect   = "direct"
+	queueTypeBuffered = "queue"
+	// maxPriorityClassName bounds the names of the priority classes, whose
+	// buffered queues are of type "queue-<class>".
+	maxPriorityClassName = 32
+
+	// maxBrokerNameBytes is the AMQP limit on queue and exchange names.
+	maxBrokerNameBytes = 255
+	// reservedBrokerPrefix starts the names RabbitMQ keeps for itself.
+	reservedBrokerPrefix = "amq."
+)
+
+// placeholderWidths bounds what each placeholder expands to: Kubernetes names
+// take up to 63 bytes, types are at most the buffered queue type of a priority
+// class, and flavours are "precision-<0..100>".
+var placeholderWidths = map[string]int{
+	"namespace": 63,
+	"service":   63,
+	"type":      len(queueTypeBuffered) + 1 + maxPriorityClassName,
+	"flavour":   len("precision-100"),
+}
+
+var placeholderPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// queueNaming renders the broker names of a Service from the templates of
+// spec.broker. The buffer services render the same templates.
+type queueNaming struct {
+	queue    string
+	exchange string
+}
+
+// queueNamingFor validates the templates of cfg, so that every name they can
+// produce is unique per Service and precision and fits the broker limits.
+func queueNamingFor(cfg schedulingv1alpha1.BrokerConfig) (queueNaming, error) {
+	naming := queueNaming{queue: cfg.QueueNameTemplate, exchange: cfg.ExchangeNameTemplate}
+	if naming.queue == "" {
+		naming.queue = defaultQueueNameTemplate
+	}
+	if naming.exchange == "" {
+		naming.exchange = defaultExchangeNameTemplate
+	}
+	err := errors.Join(
+		validateNameTemplate("queueNameTemplate", naming.queue, "namespace", "service", "type", "flavour"),
+		validateNameTemplate("exchangeNameTemplate", naming.exchange, "namespace", "service"),
+	)
+	if err != nil {
+		return queueNaming{}, invalidConfigError(err)
+	}
+	return naming, nil
+}
+
+func validateNameTemplate(field, template string, required ...string) error {
+	literal := placeholderPattern.ReplaceAllString(template, "")
+	if strings.ContainsAny(literal, "{}") {
+		return fmt.Errorf("spec.broker.%s: unbalanced braces in %q", field, template)
+	}
+	width := len(literal)
+	used := map[string]bool{}
+	for _, match := range placeholderPattern.FindAllString(template, -1) {
+		name := strings.Trim(match, "{}")
+		if !slices.Contains(required, name) {
+			return fmt.Errorf("spec.broker.%s: unknown placeholder %s, expected %s", field, match, placeholderList(required))
+		}
+		used[name] = true
+		width += placeholderWidths[name]
+	}
+	for _, name := range required {
+		if !used[name] {
+			return fmt.Errorf("spec.broker.%s: missing {%s}, names must use all of %s", field, name, placeholderList(required))
+		}
+	}
+	if strings.HasPrefix(template, reservedBrokerPrefix) {
+		return fmt.Errorf("spec.broker.%s: names starting with %q are reserved by the broker", field, reservedBrokerPrefix)
+	}
+	if width > maxBrokerNameBytes {
+		return fmt.Errorf("spec.broker.%s: names can reach %d bytes, the broker allows %d", field, width, maxBrokerNameBytes)
+	}
+	return nil
+}
+
+func placeholderList(names []string) string {
+	out := make([]string, len(names))
+	for i, name := range names {
+		out[i] = "{" + name + "}"
+	}
+	return strings.Join(out, ", ")
+}
+
+func renderName(template string, values map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(template, func(match string) string {
+		return values[strings.Trim(match, "{}")]
+	})
+}
+
+func (n queueNaming) queueName(namespace, service, queueType string, precision int) string {
+	return renderName(n.queue, map[string]string{
+		"namespace": namespace,
+		"service":   service,
+		"type":      queueType,
+		"flavour":   precisionQueueSuffix(precision),
+	})
+}
+
+func (n queueNaming) directQueue(namespace, service string, precision int) string {
+	return n.queueName(namespace, service, queueTypeDirect, precision)
+}
+
+func (n queueNaming) bufferedQueue(namespace, service string, precision int) string {
+	return n.queueName(namespace, service, queueTypeBuffered, precision)
+}
+
+// priorityQueueType is the type of the buffered queues of a priority class.
+func priorityQueueType(class string) string {
+	return queueTypeBuffered + "-" + class
+}
+
+// bufferedQueueTypes lists the types of the buffered queues of each
+// precision: the one of the default class, then one per priority class.
+func bufferedQueueTypes(classes []schedulingv1alpha1.PriorityClass) []string {
+	types := []string{queueTypeBuffered}
+	for _, class := range classes {
+		types = append(types, priorityQueueType(class.Name))
+	}
+	return types
+}
+
+func (n queueNaming) exchangeName(namespace, service string) string {
+	return renderName(n.exchange, map[string]string{"namespace": namespace, "service": service})
+}
+
+// bufferedQueuePattern is a regular expression matching the buffered queues
+// of a Service, priority classes included, or of every Service when namespace
+// and service are empty.
+func (n queueNaming) bufferedQueuePattern(namespace, service string) string {
+	var pattern strings.Builder
+	literals := placeholderPattern.Split(n.queue, -1)
+	for i, match := range placeholderPattern.FindAllString(n.queue, -1) {
+		pattern.WriteString(regexp.QuoteMeta(literals[i]))
+		value := map[string]string{"namespace": namespace, "service": service}[strings.Trim(match, "{}")]
+		switch {
+		case match == "{flavour}":
+			pattern.WriteString(`precision-\d+`)
+		case match == "{type}":
+			pattern.WriteString(regexp.QuoteMeta(queueTypeBuffered) + `(-[a-z0-9-]+)?`)
+		case value == "":
+			pattern.WriteString(`.+`)
+		default:
+			pattern.WriteString(regexp.QuoteMeta(value))
+		}
+	}
+	pattern.WriteString(regexp.QuoteMeta(literals[len(literals)-1]))
+	return pattern.String()
+}
+
+// env passes custom templates to the buffer services, which default to the
+// same names as the operator.
+func (n queueNaming) env() []corev1.EnvVar {
+	var env []corev1.EnvVar
+	if n.queue != defaultQueueNameTemplate {
+		env = append(env, corev1.EnvVar{Name: "QUEUE_NAME_TEMPLATE", Value: n.queue})
+	}
+	if n.exchange != defaultExchangeNameTemplate {
+		env = append(env, corev1.EnvVar{Name: "EXCHANGE_NAME_TEMPLATE", Value: n.exchange})
+	}
+	return env
+}
+
+// promQLString escapes a regular expression for a PromQL string literal.
+func promQLString(pattern string) string {
+	return strings.ReplaceAll(pattern, `\`, `\\`)
+}
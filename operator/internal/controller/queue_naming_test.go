@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"regexp"
+	"testing"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestBufferedQueuePattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		matches  []string
+		rejects  []string
+	}{
+		{
+			name:    "default template",
+			matches: []string{"shop.checkout.queue.precision-30", "shop.checkout.queue-gold.precision-100"},
+			rejects: []string{"shop.checkout.direct.precision-30", "shop.cart.queue.precision-30", "shop.checkout.queue.precision-30.dlq"},
+		},
+		{
+			name:     "custom template",
+			template: "cr-{service}_{flavour}_{type}@{namespace}",
+			matches:  []string{"cr-checkout_precision-50_queue@shop", "cr-checkout_precision-50_queue-gold@shop"},
+			rejects:  []string{"shop.checkout.queue.precision-50", "cr-checkout_precision-50_direct@shop"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			naming, err := queueNamingFor(schedulingv1alpha1.BrokerConfig{QueueNameTemplate: tt.template})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Prometheus anchors label matchers at both ends
+			pattern := regexp.MustCompile("^(?:" + naming.bufferedQueuePattern("shop", "checkout") + ")$")
+			for _, queue := range tt.matches {
+				if !pattern.MatchString(queue) {
+					t.Errorf("%s not matched by %s", queue, pattern)
+				}
+			}
+			for _, queue := range tt.rejects {
+				if pattern.MatchString(queue) {
+					t.Errorf("%s matched by %s", queue, pattern)
+				}
+			}
+		})
+	}
+}
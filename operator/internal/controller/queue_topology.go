@@ -0,0 +1,241 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	// queueTopologyResync re-declares the topology of a Service, recreating
+	// what was deleted on the broker behind the operator's back.
+	queueTopologyResync      = 10 * time.Minute
+	defaultTopologyOverflow  = "reject-publish"
+	deadLetterExchangeSuffix = ".dlx"
+	deadLetterQueueSuffix    = ".dead-letter"
+)
+
+// queueTopologyTracker remembers, per Service, the topology last declared on
+// the broker and when, so the broker is only called when it changes or is due
+// a resync. It starts empty, so after a restart every topology is re-declared.
+type queueTopologyTracker struct {
+	mu    sync.Mutex
+	state map[types.NamespacedName]queueTopologyState
+}
+
+type queueTopologyState struct {
+	// applied identifies the declared topology, empty when none is managed.
+	applied  string
+	syncedAt time.Time
+}
+
+func (t *queueTopologyTracker) get(key types.NamespacedName) queueTopologyState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.state[key]
+}
+
+func (t *queueTopologyTracker) set(key types.NamespacedName, state queueTopologyState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.state == nil {
+		t.state = map[types.NamespacedName]queueTopologyState{}
+	}
+	t.state[key] = state
+}
+
+func (t *queueTopologyTracker) forget(key types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.state, key)
+}
+
+// topologyPolicyName names the queue argument policy of a Service.
+func topologyPolicyName(namespace, service string) string {
+	return fmt.Sprintf("carbonrouter.topology.%s.%s", namespace, service)
+}
+
+func deadLetterExchange(naming queueNaming, namespace, service string) string {
+	return naming.exchangeName(namespace, service) + deadLetterExchangeSuffix
+}
+
+func deadLetterQueue(naming queueNaming, namespace, service string) string {
+	return naming.exchangeName(namespace, service) + deadLetterQueueSuffix
+}
+
+// topologyDefinition renders the policy definition carrying the buffered
+// queue arguments of cfg, nil when it sets none.
+func topologyDefinition(naming queueNaming, namespace, service string, cfg schedulingv1alpha1.QueueTopologyConfig) map[string]interface{} {
+	if !cfg.Managed {
+		return nil
+	}
+	definition := map[string]interface{}{}
+	if cfg.MessageTTLSeconds != nil {
+		definition["message-ttl"] = int64(*cfg.MessageTTLSeconds) * 1000
+	}
+	if cfg.MaxLength != nil {
+		overflow := cfg.Overflow
+		if overflow == "" {
+			overflow = defaultTopologyOverflow
+		}
+		definition["max-length"] = *cfg.MaxLength
+		definition["overflow"] = overflow
+	}
+	if cfg.DeadLetter {
+		definition["dead-letter-exchange"] = deadLetterExchange(naming, namespace, service)
+	}
+	if cfg.Lazy {
+		definition["queue-mode"] = "lazy"
+	}
+	if len(definition) == 0 {
+		return nil
+	}
+	return definition
+}
+
+// topologyPolicy renders the policy body for the buffered queues of a
+// Service, empty when cfg sets no queue argument. It ranks below the lazy queue
+// policy, which carries the same arguments.
+func topologyPolicy(naming queueNaming, namespace, service string, cfg schedulingv1alpha1.QueueTopologyConfig) (string, error) {
+	definition := topologyDefinition(naming, namespace, service, cfg)
+	if definition == nil {
+		return "", nil
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"pattern":    "^" + naming.bufferedQueuePattern(namespace, service) + "$",
+		"apply-to":   "queues",
+		"priority":   0,
+		"definition": definition,
+	})
+	return string(body), err
+}
+
+// ensureQueueTopology declares the exchange, queues and bindings of every
+// active precision and priority class of svc and the policy of their arguments when
+// spec.broker.topology.managed is set, and removes the policy when it is unset.
+// Declarations are idempotent, so the consumers declaring the same queues on
+// start do not conflict with them.
+func (r *FlavourRouterReconciler) ensureQueueTopology(ctx context.Context, svc *corev1.Service, ts *schedulingv1alpha1.TrafficSchedule, naming queueNaming, precisions []int, classes []schedulingv1alpha1.PriorityClass) error {
+	cfg := ts.Spec.Broker.Topology
+	if brokerType(ts.Spec.Broker) != brokerTypeRabbitMQ || r.Offline {
+		return nil
+	}
+	key := client.ObjectKeyFromObject(svc)
+	state := r.queueTopology.get(key)
+	policy, err := topologyPolicy(naming, svc.Namespace, svc.Name, cfg)
+	if err != nil {
+		return err
+	}
+	queueTypes := append([]string{queueTypeDirect}, bufferedQueueTypes(classes)...)
+	desired := ""
+	if cfg.Managed {
+		desired = fmt.Sprintf("%v|%v|%t|%s", precisions, queueTypes, cfg.DeadLetter, policy)
+	}
+	// Services that never managed their topology have no policy to remove
+	if state.applied == desired && (desired == "" || time.Since(state.syncedAt) < queueTopologyResync) {
+		return nil
+	}
+
+	broker, err := r.brokerFor(ctx, svc.Namespace, ts.Spec.Broker)
+	if err != nil {
+		return err
+	}
+	if cfg.Managed {
+		if err := declareQueueTopology(ctx, broker, svc.Namespace, svc.Name, precisions, queueTypes, cfg.DeadLetter); err != nil {
+			return err
+		}
+	}
+	if err := syncLazyQueuesPolicy(ctx, broker, topologyPolicyName(svc.Namespace, svc.Name), policy); err != nil {
+		return err
+	}
+	r.queueTopology.set(key, queueTopologyState{applied: desired, syncedAt: time.Now()})
+	return nil
+}
+
+// declareQueueTopology declares the headers exchange of a Service, the queue
+// of each precision and queue type bound to it the way the consumers bind
+// them, and, with deadLetter, the dead-letter exchange and queue.
+func declareQueueTopology(ctx context.Context, broker brokerEndpoint, namespace, service string, precisions []int, queueTypes []string, deadLetter bool) error {
+	exchange := broker.Naming.exchangeName(namespace, service)
+	if err := managementCall(ctx, broker, http.MethodPut, broker.managementPath("exchanges", exchange),
+		map[string]interface{}{"type": "headers", "durable": true}, nil); err != nil {
+		return err
+	}
+	for _, precision := range precisions {
+		for _, queueType := range queueTypes {
+			queue := broker.Naming.queueName(namespace, service, queueType, precision)
+			if err := managementCall(ctx, broker, http.MethodPut, broker.managementPath("queues", queue),
+				map[string]interface{}{"durable": true}, nil); err != nil {
+				return err
+			}
+			// Bindings are keyed by their arguments, so posting one again is a no-op
+			if err := managementCall(ctx, broker, http.MethodPost, bindingPath(broker, exchange, queue),
+				map[string]interface{}{
+					"routing_key": "",
+					"arguments":   map[string]string{"x-match": "all", "q_type": queueType, "flavour": precisionSubsetName(precision)},
+				}, nil); err != nil {
+				return err
+			}
+		}
+	}
+	if !deadLetter {
+		return nil
+	}
+	dlx := deadLetterExchange(broker.Naming, namespace, service)
+	dlq := deadLetterQueue(broker.Naming, namespace, service)
+	if err := managementCall(ctx, broker, http.MethodPut, broker.managementPath("exchanges", dlx),
+		map[string]interface{}{"type": "fanout", "durable": true}, nil); err != nil {
+		return err
+	}
+	if err := managementCall(ctx, broker, http.MethodPut, broker.managementPath("queues", dlq),
+		map[string]interface{}{"durable": true}, nil); err != nil {
+		return err
+	}
+	return managementCall(ctx, broker, http.MethodPost, bindingPath(broker, dlx, dlq),
+		map[string]interface{}{"routing_key": ""}, nil)
+}
+
+func bindingPath(broker brokerEndpoint, exchange, queue string) string {
+	return fmt.Sprintf("bindings/%s/e/%s/q/%s", url.PathEscape(broker.VHost), url.PathEscape(exchange), url.PathEscape(queue))
+}
+
+// managementCall sends body, as JSON, to path on the management API of broker
+// and decodes the response into out, unless nil.
+func managementCall(ctx context.Context, broker brokerEndpoint, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = strings.NewReader(string(payload))
+	}
+	req, err := broker.managementRequest(ctx, method, path, reader)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/types/known/structpb"
+	networkingapi "istio.io/api/networking/v1alpha3"
+	networkingkube "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+// rateLimitedHeader marks the responses of requests shed by the rate limit.
+const rateLimitedHeader = "x-carbonrouter-rate-limited"
+
+func rateLimitFilterName(svc *corev1.Service) string {
+	return fmt.Sprintf("%s-carbonrouter-ratelimit", svc.Name)
+}
+
+// rateLimitTokens returns the requests per second each pod accepts under the
+// throttle of status, or 0 when no limit applies.
+func rateLimitTokens(cfg *schedulingv1alpha1.RateLimitConfig, status schedulingv1alpha1.TrafficScheduleStatus) int {
+	if cfg == nil {
+		return 0
+	}
+	throttle, err := strconv.ParseFloat(strings.TrimSpace(status.ProcessingThrottle), 64)
+	if err != nil {
+		return 0
+	}
+	below := 1.0
+	if value, ok := parseOptionalFloat(cfg.ThrottleBelow); ok {
+		below = value
+	}
+	if throttle >= below {
+		return 0
+	}
+	return max(int(math.Ceil(float64(cfg.RequestsPerSecond)*max(throttle, 0))), 1)
+}
+
+// ensureRateLimitFilter manages the EnvoyFilter adding a local rate limit to
+// the inbound HTTP traffic of the target pods while the schedule throttles
+// processing, so excess load is shed at the sidecar instead of queueing up
+// behind the replica ceilings.
+func (r *FlavourRouterReconciler) ensureRateLimitFilter(ctx context.Context, svc *corev1.Service, ts *schedulingv1alpha1.TrafficSchedule) error {
+	name := rateLimitFilterName(svc)
+	tokens := rateLimitTokens(ts.Spec.Routing.RateLimit, ts.Status)
+	if tokens == 0 || len(svc.Spec.Selector) == 0 {
+		var existing networkingkube.EnvoyFilter
+		if err := r.Get(ctx, client.ObjectKey{Namespace: svc.Namespace, Name: name}, &existing); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if err := r.Delete(ctx, &existing); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		r.Inventory.Drop(client.ObjectKeyFromObject(svc), "EnvoyFilter", svc.Namespace, name)
+		return nil
+	}
+
+	enabled := map[string]interface{}{
+		"runtime_key":   "carbonrouter_rate_limit_enabled",
+		"default_value": map[string]interface{}{"numerator": 100, "denominator": "HUNDRED"},
+	}
+	value, err := structpb.NewStruct(map[string]interface{}{
+		"name": "envoy.filters.http.local_ratelimit",
+		"typed_config": map[string]interface{}{
+			"@type":       "type.googleapis.com/envoy.extensions.filters.http.local_ratelimit.v3.LocalRateLimit",
+			"stat_prefix": "carbonrouter_rate_limit",
+			"token_bucket": map[string]interface{}{
+				"max_tokens":      tokens,
+				"tokens_per_fill": tokens,
+				"fill_interval":   "1s",
+			},
+			"filter_enabled":  enabled,
+			"filter_enforced": enabled,
+			"response_headers_to_add": []interface{}{
+				map[string]interface{}{
+					"append_action": "OVERWRITE_IF_EXISTS_OR_ADD",
+					"header":        map[string]interface{}{"key": rateLimitedHeader, "value": "true"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctrl.LoggerFrom(ctx).WithName("[FlavourRouter]").Info("Ensuring rate limit EnvoyFilter", "service", svc.Name, "requestsPerSecond", tokens, "throttle", ts.Status.ProcessingThrottle)
+	ef := networkingkube.EnvoyFilter{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: svc.Namespace},
+		Spec: networkingapi.EnvoyFilter{
+			WorkloadSelector: &networkingapi.WorkloadSelector{Labels: svc.Spec.Selector},
+			ConfigPatches: []*networkingapi.EnvoyFilter_EnvoyConfigObjectPatch{{
+				ApplyTo: networkingapi.EnvoyFilter_HTTP_FILTER,
+				Match: &networkingapi.EnvoyFilter_EnvoyConfigObjectMatch{
+					Context: networkingapi.EnvoyFilter_SIDECAR_INBOUND,
+					ObjectTypes: &networkingapi.EnvoyFilter_EnvoyConfigObjectMatch_Listener{
+						Listener: &networkingapi.EnvoyFilter_ListenerMatch{
+							FilterChain: &networkingapi.EnvoyFilter_ListenerMatch_FilterChainMatch{
+								Filter: &networkingapi.EnvoyFilter_ListenerMatch_FilterMatch{
+									Name:      "envoy.filters.network.http_connection_manager",
+									SubFilter: &networkingapi.EnvoyFilter_ListenerMatch_SubFilterMatch{Name: "envoy.filters.http.router"},
+								},
+							},
+						},
+					},
+				},
+				Patch: &networkingapi.EnvoyFilter_Patch{Operation: networkingapi.EnvoyFilter_Patch_INSERT_BEFORE, Value: value},
+			}},
+		},
+	}
+	if err := ctrl.SetControllerReference(svc, &ef, r.Scheme); err != nil {
+		return err
+	}
+	return r.apply(ctx, svc, "EnvoyFilter", &ef, &ef.Spec)
+}
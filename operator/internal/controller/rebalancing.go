@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	networkingapi "istio.io/api/networking/v1alpha3"
+	networkingkube "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	defaultMaxConnectionDurationSeconds = 300
+	defaultDrainGraceSeconds            = 30
+)
+
+func drainFilterName(svc *corev1.Service) string {
+	return fmt.Sprintf("%s-carbonrouter-drain", svc.Name)
+}
+
+func rebalancingDurations(cfg schedulingv1alpha1.ConnectionRebalancingConfig) (time.Duration, time.Duration) {
+	maxAge := int32(defaultMaxConnectionDurationSeconds)
+	if cfg.MaxConnectionDurationSeconds != nil {
+		maxAge = *cfg.MaxConnectionDurationSeconds
+	}
+	grace := int32(defaultDrainGraceSeconds)
+	if cfg.DrainGraceSeconds != nil {
+		grace = *cfg.DrainGraceSeconds
+	}
+	return time.Duration(maxAge) * time.Second, time.Duration(grace) * time.Second
+}
+
+// withConnectionRebalancing caps the age of the upstream connections opened by
+// client sidecars, so new streams are re-routed with the current weights.
+func withConnectionRebalancing(policy *networkingapi.TrafficPolicy, cfg schedulingv1alpha1.ConnectionRebalancingConfig) *networkingapi.TrafficPolicy {
+	if !cfg.Enabled {
+		return policy
+	}
+	maxAge, _ := rebalancingDurations(cfg)
+	if policy == nil {
+		policy = &networkingapi.TrafficPolicy{}
+	}
+	policy.ConnectionPool = &networkingapi.ConnectionPoolSettings{
+		Tcp: &networkingapi.ConnectionPoolSettings_TCPSettings{MaxConnectionDuration: durationpb.New(maxAge)},
+	}
+	return policy
+}
+
+// ensureDrainFilter manages the EnvoyFilter that drains long-lived downstream
+// connections on the target pods. Streams still open after the grace period
+// are closed, and clients reconnect through the current weighted routes.
+func (r *FlavourRouterReconciler) ensureDrainFilter(ctx context.Context, svc *corev1.Service, cfg schedulingv1alpha1.ConnectionRebalancingConfig) error {
+	name := drainFilterName(svc)
+	if !cfg.Enabled || len(svc.Spec.Selector) == 0 {
+		var existing networkingkube.EnvoyFilter
+		if err := r.Get(ctx, client.ObjectKey{Namespace: svc.Namespace, Name: name}, &existing); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if err := r.Delete(ctx, &existing); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		r.Inventory.Drop(client.ObjectKeyFromObject(svc), "EnvoyFilter", svc.Namespace, name)
+		return nil
+	}
+
+	maxAge, grace := rebalancingDurations(cfg)
+	value, err := structpb.NewStruct(map[string]interface{}{
+		"typed_config": map[string]interface{}{
+			"@type": "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager",
+			"common_http_protocol_options": map[string]interface{}{
+				"max_connection_duration": fmt.Sprintf("%ds", int(maxAge.Seconds())),
+				"max_stream_duration":     fmt.Sprintf("%ds", int((maxAge + grace).Seconds())),
+			},
+			"drain_timeout": fmt.Sprintf("%ds", int(grace.Seconds())),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	ctrl.LoggerFrom(ctx).WithName("[FlavourRouter]").Info("Ensuring connection drain EnvoyFilter", "service", svc.Name, "maxConnectionDuration", maxAge, "drainGrace", grace)
+	ef := networkingkube.EnvoyFilter{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: svc.Namespace},
+		Spec: networkingapi.EnvoyFilter{
+			WorkloadSelector: &networkingapi.WorkloadSelector{Labels: svc.Spec.Selector},
+			ConfigPatches: []*networkingapi.EnvoyFilter_EnvoyConfigObjectPatch{{
+				ApplyTo: networkingapi.EnvoyFilter_NETWORK_FILTER,
+				Match: &networkingapi.EnvoyFilter_EnvoyConfigObjectMatch{
+					Context: networkingapi.EnvoyFilter_SIDECAR_INBOUND,
+					ObjectTypes: &networkingapi.EnvoyFilter_EnvoyConfigObjectMatch_Listener{
+						Listener: &networkingapi.EnvoyFilter_ListenerMatch{
+							FilterChain: &networkingapi.EnvoyFilter_ListenerMatch_FilterChainMatch{
+								Filter: &networkingapi.EnvoyFilter_ListenerMatch_FilterMatch{Name: "envoy.filters.network.http_connection_manager"},
+							},
+						},
+					},
+				},
+				Patch: &networkingapi.EnvoyFilter_Patch{Operation: networkingapi.EnvoyFilter_Patch_MERGE, Value: value},
+			}},
+		},
+	}
+	if err := ctrl.SetControllerReference(svc, &ef, r.Scheme); err != nil {
+		return err
+	}
+	return r.apply(ctx, svc, "EnvoyFilter", &ef, &ef.Spec)
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	networkingapi "istio.io/api/networking/v1alpha3"
+	networkingkube "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestWithConnectionRebalancing(t *testing.T) {
+	if got := withConnectionRebalancing(nil, schedulingv1alpha1.ConnectionRebalancingConfig{}); got != nil {
+		t.Errorf("disabled: got %v, want the policy untouched", got)
+	}
+	outlier := &networkingapi.OutlierDetection{}
+	policy := withConnectionRebalancing(&networkingapi.TrafficPolicy{OutlierDetection: outlier},
+		schedulingv1alpha1.ConnectionRebalancingConfig{Enabled: true})
+	if got := policy.GetConnectionPool().GetTcp().GetMaxConnectionDuration().AsDuration(); got != defaultMaxConnectionDurationSeconds*time.Second {
+		t.Errorf("got max connection duration %v, want the default", got)
+	}
+	if policy.OutlierDetection != outlier {
+		t.Error("existing traffic policy dropped")
+	}
+	policy = withConnectionRebalancing(nil, schedulingv1alpha1.ConnectionRebalancingConfig{Enabled: true, MaxConnectionDurationSeconds: ptr.To[int32](60)})
+	if got := policy.GetConnectionPool().GetTcp().GetMaxConnectionDuration().AsDuration(); got != time.Minute {
+		t.Errorf("got max connection duration %v, want 1m", got)
+	}
+}
+
+func TestEnsureDrainFilter(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := networkingkube.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout", UID: "checkout"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "checkout"}},
+	}
+	var applied *networkingkube.EnvoyFilter
+	c := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			applied = obj.(*networkingkube.EnvoyFilter).DeepCopy()
+			applied.ResourceVersion = ""
+			return c.Create(ctx, applied)
+		},
+	}).Build()
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme, Inventory: NewResourceInventory()}
+	ctx := context.Background()
+	cfg := schedulingv1alpha1.ConnectionRebalancingConfig{Enabled: true, MaxConnectionDurationSeconds: ptr.To[int32](120), DrainGraceSeconds: ptr.To[int32](15)}
+
+	if err := r.ensureDrainFilter(ctx, svc, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if applied == nil {
+		t.Fatal("no EnvoyFilter applied")
+	}
+	if got := applied.Spec.WorkloadSelector.GetLabels()["app"]; got != "checkout" {
+		t.Errorf("got workload selector %v, want the Service selector", applied.Spec.WorkloadSelector)
+	}
+	patch := applied.Spec.ConfigPatches[0]
+	if patch.Match.Context != networkingapi.EnvoyFilter_SIDECAR_INBOUND {
+		t.Errorf("got context %v, want the inbound sidecar", patch.Match.Context)
+	}
+	typed := patch.Patch.Value.GetFields()["typed_config"].GetStructValue().GetFields()
+	options := typed["common_http_protocol_options"].GetStructValue().GetFields()
+	if got := options["max_connection_duration"].GetStringValue(); got != "120s" {
+		t.Errorf("got max_connection_duration %q, want 120s", got)
+	}
+	if got := options["max_stream_duration"].GetStringValue(); got != "135s" {
+		t.Errorf("got max_stream_duration %q, want the duration plus the grace", got)
+	}
+	if got := typed["drain_timeout"].GetStringValue(); got != "15s" {
+		t.Errorf("got drain_timeout %q, want 15s", got)
+	}
+
+	if err := r.ensureDrainFilter(ctx, svc, schedulingv1alpha1.ConnectionRebalancingConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	key := client.ObjectKey{Namespace: "shop", Name: drainFilterName(svc)}
+	if err := c.Get(ctx, key, &networkingkube.EnvoyFilter{}); !apierrors.IsNotFound(err) {
+		t.Errorf("EnvoyFilter kept once disabled: %v", err)
+	}
+	if r.Inventory.Has(client.ObjectKeyFromObject(svc), "EnvoyFilter", "shop", key.Name) {
+		t.Error("EnvoyFilter kept in the inventory once disabled")
+	}
+}
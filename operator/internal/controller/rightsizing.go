@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The VerticalPodAutoscaler types are not vendored, so they are read as
+// unstructured objects.
+var vpaListGVK = schema.GroupVersionKind{Group: "autoscaling.k8s.io", Version: "v1", Kind: "VerticalPodAutoscalerList"}
+
+// rightsizingTolerance is the relative drift from the recommendation within
+// which the requests of a component are kept.
+const rightsizingTolerance = 0.15
+
+// flavourResources are the per-pod requests of a flavour sent to the decision
+// engine: CPU in cores and memory in bytes.
+type flavourResources struct {
+	CPU    float64 `json:"cpu"`
+	Memory float64 `json:"memory"`
+	// Source is "vpa" for a recommendation and "requests" for the declared requests.
+	Source string `json:"source"`
+}
+
+// vpaRecommendations returns the target recommendation of every Deployment of
+// namespace targeted by a VerticalPodAutoscaler, summed over its containers.
+// Clusters without the VerticalPodAutoscaler CRDs have none.
+func vpaRecommendations(ctx context.Context, reader client.Reader, namespace string) (map[string]corev1.ResourceList, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(vpaListGVK)
+	if err := reader.List(ctx, list, client.InNamespace(namespace)); err != nil {
+		if meta.IsNoMatchError(err) || runtime.IsNotRegisteredError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	recommendations := make(map[string]corev1.ResourceList, len(list.Items))
+	for _, vpa := range list.Items {
+		kind, _, _ := unstructured.NestedString(vpa.Object, "spec", "targetRef", "kind")
+		name, _, _ := unstructured.NestedString(vpa.Object, "spec", "targetRef", "name")
+		if kind != "Deployment" || name == "" {
+			continue
+		}
+		containers, _, _ := unstructured.NestedSlice(vpa.Object, "status", "recommendation", "containerRecommendations")
+		total := corev1.ResourceList{}
+		for _, container := range containers {
+			fields, _ := container.(map[string]interface{})
+			target, _, _ := unstructured.NestedStringMap(fields, "target")
+			for _, resourceName := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+				quantity, err := resource.ParseQuantity(target[string(resourceName)])
+				if err != nil {
+					continue
+				}
+				sum := total[resourceName]
+				sum.Add(quantity)
+				total[resourceName] = sum
+			}
+		}
+		if len(total) > 0 {
+			recommendations[name] = total
+		}
+	}
+	return recommendations, nil
+}
+
+// podRequests sums the requests of the containers of spec.
+func podRequests(spec corev1.PodSpec) corev1.ResourceList {
+	total := corev1.ResourceList{}
+	for _, container := range spec.Containers {
+		for name, quantity := range container.Resources.Requests {
+			sum := total[name]
+			sum.Add(quantity)
+			total[name] = sum
+		}
+	}
+	return total
+}
+
+// resourcesOf prefers the recommendation of a flavour over its declared
+// requests, and returns nil when it has neither.
+func resourcesOf(recommended, declared corev1.ResourceList) *flavourResources {
+	source, requests := "vpa", recommended
+	if len(requests) == 0 {
+		source, requests = "requests", declared
+	}
+	if len(requests) == 0 {
+		return nil
+	}
+	return &flavourResources{
+		CPU:    requests.Cpu().AsApproximateFloat64(),
+		Memory: requests.Memory().AsApproximateFloat64(),
+		Source: source,
+	}
+}
+
+// rightsizedRequests returns the recommendation, or current when every
+// recommended resource is within rightsizingTolerance of it.
+func rightsizedRequests(current, recommended corev1.ResourceList) corev1.ResourceList {
+	for name, want := range recommended {
+		have, ok := current[name]
+		if !ok {
+			return recommended
+		}
+		if want.IsZero() {
+			continue
+		}
+		ratio := have.AsApproximateFloat64() / want.AsApproximateFloat64()
+		if ratio < 1-rightsizingTolerance || ratio > 1+rightsizingTolerance {
+			return recommended
+		}
+	}
+	return current
+}
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func vpa(name, kind, target string, recommendations ...map[string]interface{}) *unstructured.Unstructured {
+	containers := make([]interface{}, 0, len(recommendations))
+	for _, recommendation := range recommendations {
+		containers = append(containers, map[string]interface{}{"containerName": "app", "target": recommendation})
+	}
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec":   map[string]interface{}{"targetRef": map[string]interface{}{"kind": kind, "name": target}},
+		"status": map[string]interface{}{"recommendation": map[string]interface{}{"containerRecommendations": containers}},
+	}}
+	obj.SetGroupVersionKind(vpaListGVK.GroupVersion().WithKind("VerticalPodAutoscaler"))
+	obj.SetNamespace("shop")
+	obj.SetName(name)
+	return obj
+}
+
+func requestsOf(cpu, memory string) corev1.ResourceList {
+	return corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu), corev1.ResourceMemory: resource.MustParse(memory)}
+}
+
+func vpaScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	scheme.AddKnownTypeWithName(vpaListGVK.GroupVersion().WithKind("VerticalPodAutoscaler"), &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(vpaListGVK, &unstructured.UnstructuredList{})
+	return scheme
+}
+
+func TestVPARecommendations(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(vpaScheme(t)).WithObjects(
+		vpa("checkout-100", "Deployment", "checkout-precision-100",
+			map[string]interface{}{"cpu": "500m", "memory": "256Mi"},
+			map[string]interface{}{"cpu": "100m", "memory": "64Mi"}),
+		vpa("checkout-50", "Deployment", "checkout-precision-50"),
+		vpa("cache", "StatefulSet", "cache", map[string]interface{}{"cpu": "1"}),
+	).Build()
+
+	recommendations, err := vpaRecommendations(context.Background(), c, "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recommendations) != 1 {
+		t.Fatalf("got %v, want the Deployments with a recommendation only", recommendations)
+	}
+	got := recommendations["checkout-precision-100"]
+	if got.Cpu().MilliValue() != 600 || got.Memory().Value() != 320<<20 {
+		t.Errorf("got %v, want the containers summed", got)
+	}
+
+	// Clusters without the VerticalPodAutoscaler CRDs
+	missing := fake.NewClientBuilder().WithScheme(vpaScheme(t)).WithInterceptorFuncs(interceptor.Funcs{
+		List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			return &meta.NoKindMatchError{GroupKind: vpaListGVK.GroupKind()}
+		},
+	}).Build()
+	if recommendations, err := vpaRecommendations(context.Background(), missing, "shop"); recommendations != nil || err != nil {
+		t.Errorf("got %v, %v without the CRDs, want nothing", recommendations, err)
+	}
+}
+
+func TestResourcesOf(t *testing.T) {
+	if got := resourcesOf(nil, nil); got != nil {
+		t.Errorf("got %+v, want nil without requests", got)
+	}
+	got := resourcesOf(nil, requestsOf("250m", "1Gi"))
+	if got.Source != "requests" || got.CPU != 0.25 || got.Memory != 1<<30 {
+		t.Errorf("got %+v, want the declared requests", got)
+	}
+	if got := resourcesOf(requestsOf("2", "1Gi"), requestsOf("250m", "1Gi")); got.Source != "vpa" || got.CPU != 2 {
+		t.Errorf("got %+v, want the recommendation", got)
+	}
+}
+
+func TestRightsizedRequests(t *testing.T) {
+	current := requestsOf("500m", "512Mi")
+	tests := []struct {
+		name        string
+		recommended corev1.ResourceList
+		keep        bool
+	}{
+		{name: "within the tolerance", recommended: requestsOf("550m", "480Mi"), keep: true},
+		{name: "cpu drifted", recommended: requestsOf("700m", "512Mi")},
+		{name: "memory drifted", recommended: requestsOf("500m", "256Mi")},
+		{name: "new resource", recommended: corev1.ResourceList{corev1.ResourceEphemeralStorage: resource.MustParse("1Gi")}},
+	}
+	for _, tt := range tests {
+		got := rightsizedRequests(current, tt.recommended)
+		if kept := got.Cpu().Equal(*current.Cpu()) && got.Memory().Equal(*current.Memory()) && len(got) == len(current); kept != tt.keep {
+			t.Errorf("%s: got %v, want the current requests kept: %v", tt.name, got, tt.keep)
+		}
+	}
+}
+
+func TestComponentRequests(t *testing.T) {
+	router := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "buffer-service-router-checkout"},
+		Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "router", Resources: corev1.ResourceRequirements{Requests: requestsOf("200m", "128Mi")}},
+		}}}},
+	}
+	c := fake.NewClientBuilder().WithScheme(vpaScheme(t)).WithObjects(router,
+		vpa("router", "Deployment", router.Name, map[string]interface{}{"cpu": "210m", "memory": "130Mi"}),
+		vpa("consumer", "Deployment", "buffer-service-consumer-checkout", map[string]interface{}{"cpu": "1", "memory": "1Gi"}),
+	).Build()
+	r := &FlavourRouterReconciler{Client: c}
+	ctx := context.Background()
+
+	requests, err := r.componentRequests(ctx, "shop", router.Name)
+	if err != nil || !requests.Cpu().Equal(resource.MustParse("200m")) {
+		t.Errorf("router: got %v, %v, want its requests kept within the tolerance", requests, err)
+	}
+	requests, err = r.componentRequests(ctx, "shop", "buffer-service-consumer-checkout")
+	if err != nil || !requests.Cpu().Equal(resource.MustParse("1")) {
+		t.Errorf("new consumer: got %v, %v, want the recommendation", requests, err)
+	}
+	if requests, err := r.componentRequests(ctx, "shop", "unknown"); requests != nil || err != nil {
+		t.Errorf("no recommendation: got %v, %v, want nothing", requests, err)
+	}
+}
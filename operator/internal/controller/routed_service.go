@@ -0,0 +1,443 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	defaultRoutingHeader      = "x-carbonrouter"
+	defaultQueueLengthTarget  = 300
+	defaultMinRequestDuration = "0.02"
+)
+
+// routedServiceFor returns the live CarbonRoutedService pointing at svc, or nil.
+// When several do, the oldest wins.
+func routedServiceFor(ctx context.Context, c client.Reader, svc *corev1.Service) (*schedulingv1alpha1.CarbonRoutedService, error) {
+	var list schedulingv1alpha1.CarbonRoutedServiceList
+	if err := c.List(ctx, &list, client.InNamespace(svc.Namespace)); err != nil {
+		return nil, err
+	}
+	var routed *schedulingv1alpha1.CarbonRoutedService
+	for i := range list.Items {
+		crs := &list.Items[i]
+		if crs.Spec.ServiceName != svc.Name || !crs.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if routed == nil || crs.CreationTimestamp.Before(&routed.CreationTimestamp) {
+			routed = crs
+		}
+	}
+	return routed, nil
+}
+
+// optedIn reports whether svc takes part in carbon-aware routing, either through
+// a CarbonRoutedService or the legacy enable label.
+func optedIn(svc *corev1.Service, routed *schedulingv1alpha1.CarbonRoutedService) bool {
+	return routed != nil || svc.Labels[enableLabel] == "true"
+}
+
+// Enrolled reports whether svc takes part in carbon-aware routing, reading its
+// CarbonRoutedServices through c.
+func Enrolled(ctx context.Context, c client.Reader, svc *corev1.Service) (bool, error) {
+	routed, err := routedServiceFor(ctx, c, svc)
+	if err != nil {
+		return false, err
+	}
+	return optedIn(svc, routed), nil
+}
+
+// listRoutedServices returns every opted-in Service in the cluster, or in the
+// namespace selected by opts.
+func listRoutedServices(ctx context.Context, c client.Reader, opts ...client.ListOption) ([]corev1.Service, error) {
+	var services corev1.ServiceList
+	if err := c.List(ctx, &services, opts...); err != nil {
+		return nil, err
+	}
+	var routedList schedulingv1alpha1.CarbonRoutedServiceList
+	if err := c.List(ctx, &routedList, opts...); err != nil {
+		return nil, err
+	}
+	referenced := make(map[client.ObjectKey]struct{}, len(routedList.Items))
+	for _, crs := range routedList.Items {
+		if crs.DeletionTimestamp.IsZero() {
+			referenced[client.ObjectKey{Namespace: crs.Namespace, Name: crs.Spec.ServiceName}] = struct{}{}
+		}
+	}
+	var out []corev1.Service
+	for _, svc := range services.Items {
+		if _, ok := referenced[client.ObjectKeyFromObject(&svc)]; ok || svc.Labels[enableLabel] == "true" {
+			out = append(out, svc)
+		}
+	}
+	return out, nil
+}
+
+// routedServiceRequest maps a CarbonRoutedService to the Service it points at.
+func routedServiceRequest(_ context.Context, obj client.Object) []reconcile.Request {
+	crs, ok := obj.(*schedulingv1alpha1.CarbonRoutedService)
+	if !ok || crs.Spec.ServiceName == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: client.ObjectKey{Namespace: crs.Namespace, Name: crs.Spec.ServiceName}}}
+}
+
+func mergeAutoscaling(base, override schedulingv1alpha1.AutoscalingConfig) schedulingv1alpha1.AutoscalingConfig {
+	if override.MinReplicaCount != nil {
+		base.MinReplicaCount = override.MinReplicaCount
+	}
+	if override.MaxReplicaCount != nil {
+		base.MaxReplicaCount = override.MaxReplicaCount
+	}
+	if override.CooldownPeriod != nil {
+		base.CooldownPeriod = override.CooldownPeriod
+	}
+	if override.CPUUtilization != nil {
+		base.CPUUtilization = override.CPUUtilization
+	}
+	if override.PollingInterval != nil {
+		base.PollingInterval = override.PollingInterval
+	}
+	if override.QueueLengthTarget != nil {
+		base.QueueLengthTarget = override.QueueLengthTarget
+	}
+	if override.RequestRateThreshold != nil {
+		base.RequestRateThreshold = override.RequestRateThreshold
+	}
+	return base
+}
+
+func mergeComponent(base schedulingv1alpha1.ComponentConfig, override *schedulingv1alpha1.ComponentConfig) schedulingv1alpha1.ComponentConfig {
+	if override == nil {
+		return base
+	}
+	base.Autoscaling = mergeAutoscaling(base.Autoscaling, override.Autoscaling)
+	if len(override.Resources.Limits) > 0 || len(override.Resources.Requests) > 0 {
+		base.Resources = override.Resources
+	}
+	base.Debug = base.Debug || override.Debug
+	if override.MinAvailable != nil {
+		base.MinAvailable = override.MinAvailable
+	}
+	base.Image = mergeImage(base.Image, override.Image)
+	if override.NodeSelector != nil {
+		base.NodeSelector = override.NodeSelector
+	}
+	if override.Tolerations != nil {
+		base.Tolerations = override.Tolerations
+	}
+	if override.Affinity != nil {
+		base.Affinity = override.Affinity
+	}
+	if override.TopologySpreadConstraints != nil {
+		base.TopologySpreadConstraints = override.TopologySpreadConstraints
+	}
+	if override.ExtraEnv != nil {
+		base.ExtraEnv = override.ExtraEnv
+	}
+	if override.EnvFrom != nil {
+		base.EnvFrom = override.EnvFrom
+	}
+	if override.PodSecurityContext != nil {
+		base.PodSecurityContext = override.PodSecurityContext
+	}
+	if override.SecurityContext != nil {
+		base.SecurityContext = override.SecurityContext
+	}
+	if override.PriorityClassName != "" {
+		base.PriorityClassName = override.PriorityClassName
+	}
+	if override.AutomountServiceAccountToken != nil {
+		base.AutomountServiceAccountToken = override.AutomountServiceAccountToken
+	}
+	return base
+}
+
+// mergeImage replaces the fields of base set in override. A digest or tag
+// override replaces both, so an inherited digest cannot shadow a new tag.
+func mergeImage(base, override schedulingv1alpha1.ImageConfig) schedulingv1alpha1.ImageConfig {
+	if override.Repository != "" {
+		base.Repository = override.Repository
+	}
+	if override.Tag != "" || override.Digest != "" {
+		base.Tag, base.Digest = override.Tag, override.Digest
+	}
+	if override.PullPolicy != "" {
+		base.PullPolicy = override.PullPolicy
+	}
+	if override.PullSecrets != nil {
+		base.PullSecrets = override.PullSecrets
+	}
+	return base
+}
+
+// routedServiceOverrides lists the sections of routed merged over the schedule
+// spec by withRoutedServiceOverrides.
+func routedServiceOverrides(routed *schedulingv1alpha1.CarbonRoutedService) []string {
+	var sections []string
+	if routed.Spec.Router != nil {
+		sections = append(sections, "router")
+	}
+	if routed.Spec.Consumer != nil {
+		sections = append(sections, "consumer")
+	}
+	if routed.Spec.Target != nil {
+		sections = append(sections, "target")
+	}
+	if routed.Spec.RoutingRules != nil {
+		sections = append(sections, "routingRules")
+	}
+	if routed.Spec.Resilience != nil {
+		sections = append(sections, "resilience")
+	}
+	if routed.Spec.Ingress != nil {
+		sections = append(sections, "ingress")
+	}
+	if activeOverride(routed, time.Now()) != nil {
+		sections = append(sections, "override")
+	}
+	return sections
+}
+
+// withRoutedServiceOverrides applies the per-service settings of routed on top
+// of the schedule spec. The schedule bound by bindSchedule is the base, and
+// every field set on routed replaces its value.
+func withRoutedServiceOverrides(spec schedulingv1alpha1.TrafficScheduleSpec, routed *schedulingv1alpha1.CarbonRoutedService) schedulingv1alpha1.TrafficScheduleSpec {
+	if routed == nil {
+		return spec
+	}
+	spec.Router = mergeComponent(spec.Router, routed.Spec.Router)
+	spec.Consumer = mergeComponent(spec.Consumer, routed.Spec.Consumer)
+	if routed.Spec.Target != nil {
+		spec.Target.Autoscaling = mergeAutoscaling(spec.Target.Autoscaling, routed.Spec.Target.Autoscaling)
+		spec.Target.PerFlavour = mergePerFlavour(spec.Target.PerFlavour, routed.Spec.Target.PerFlavour)
+	}
+	if routed.Spec.RoutingRules != nil {
+		spec.Routing.RoutingRules = routed.Spec.RoutingRules
+	}
+	if routed.Spec.Resilience != nil {
+		spec.Routing.Resilience = routed.Spec.Resilience
+	}
+	if routed.Spec.Ingress != nil {
+		spec.Routing.Gateways = routed.Spec.Ingress.Gateways
+		spec.Routing.Hosts = routed.Spec.Ingress.Hosts
+	}
+	return spec
+}
+
+// mergePerFlavour merges the per-precision overrides of override over those of
+// base, precision by precision.
+func mergePerFlavour(base, override []schedulingv1alpha1.FlavourAutoscaling) []schedulingv1alpha1.FlavourAutoscaling {
+	if len(override) == 0 {
+		return base
+	}
+	merged := slices.Clone(base)
+	for _, flavour := range override {
+		i := slices.IndexFunc(merged, func(f schedulingv1alpha1.FlavourAutoscaling) bool { return f.Precision == flavour.Precision })
+		if i < 0 {
+			merged = append(merged, flavour)
+			continue
+		}
+		merged[i].Autoscaling = mergeAutoscaling(merged[i].Autoscaling, flavour.Autoscaling)
+	}
+	return merged
+}
+
+// flavourAutoscaling is the autoscaling of the Deployment of precision: the
+// target settings with the per-precision overrides on top.
+func flavourAutoscaling(target schedulingv1alpha1.TargetConfig, precision int) schedulingv1alpha1.AutoscalingConfig {
+	for _, flavour := range target.PerFlavour {
+		if flavour.Precision == precision {
+			return mergeAutoscaling(target.Autoscaling, flavour.Autoscaling)
+		}
+	}
+	return target.Autoscaling
+}
+
+// flavourReplicaCeilings returns the carbon-aware ceilings for the Deployment
+// of precision. The decision engine throttles the "target" ceiling from the
+// shared target maxReplicaCount; a precision whose perFlavour entry sets its
+// own maxReplicaCount gets that ceiling scaled to it, so its bound applies on
+// its own rather than under the shared ceiling.
+func flavourReplicaCeilings(ceilings map[string]int32, target schedulingv1alpha1.TargetConfig, precision int) map[string]int32 {
+	ceiling, ok := ceilings["target"]
+	shared, own := target.Autoscaling.MaxReplicaCount, flavourAutoscaling(target, precision).MaxReplicaCount
+	if !ok || ceiling <= 0 || shared == nil || *shared <= 0 || own == nil || *own == *shared {
+		return ceilings
+	}
+	out := maps.Clone(ceilings)
+	out["target"] = max(int32(math.Ceil(float64(ceiling)*float64(*own)/float64(*shared))), 1)
+	return out
+}
+
+func routingHeader(routed *schedulingv1alpha1.CarbonRoutedService) string {
+	if routed == nil || routed.Spec.RoutingHeader == "" {
+		return defaultRoutingHeader
+	}
+	return routed.Spec.RoutingHeader
+}
+
+func bufferConfig(routed *schedulingv1alpha1.CarbonRoutedService) schedulingv1alpha1.BufferConfig {
+	if routed == nil {
+		return schedulingv1alpha1.BufferConfig{}
+	}
+	return routed.Spec.Buffer
+}
+
+// queueLengthTarget is the queue length at which a component scales out, from
+// its autoscaling settings or else the buffer of the Service.
+func queueLengthTarget(autoscaling schedulingv1alpha1.AutoscalingConfig, cfg schedulingv1alpha1.BufferConfig) int32 {
+	switch {
+	case autoscaling.QueueLengthTarget != nil:
+		return *autoscaling.QueueLengthTarget
+	case cfg.QueueLengthTarget != nil:
+		return *cfg.QueueLengthTarget
+	}
+	return defaultQueueLengthTarget
+}
+
+// queueDepths reads the ready messages of the buffered queues of a Service from
+// the RabbitMQ management API, keyed by precision subset. The queues of the
+// priority classes add up with the one of the default class.
+func queueDepths(ctx context.Context, broker brokerEndpoint, namespace, service string, precisions []int, bufferedTypes []string) (map[string]int64, error) {
+	depths := make(map[string]int64, len(precisions))
+	var errs []error
+	for _, precision := range precisions {
+		// A precision is only reported when all of its queues are read
+		failed := len(errs)
+		for _, queueType := range bufferedTypes {
+			name := broker.Naming.queueName(namespace, service, queueType, precision)
+			req, err := broker.managementRequest(ctx, http.MethodGet, broker.managementPath("queues", name), nil)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			resp, err := httpClient.Do(req)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			var queue struct {
+				MessagesReady int64 `json:"messages_ready"`
+			}
+			switch {
+			case resp.StatusCode == http.StatusNotFound:
+				// Queues are declared lazily by the router
+				depths[precisionSubsetName(precision)] += 0
+			case resp.StatusCode >= http.StatusBadRequest:
+				errs = append(errs, fmt.Errorf("get queue %s: %s", name, resp.Status))
+			default:
+				if err := json.NewDecoder(resp.Body).Decode(&queue); err != nil {
+					errs = append(errs, fmt.Errorf("decode queue %s: %w", name, err))
+				} else {
+					depths[precisionSubsetName(precision)] += queue.MessagesReady
+				}
+			}
+			resp.Body.Close()
+		}
+		if len(errs) > failed {
+			delete(depths, precisionSubsetName(precision))
+		}
+	}
+	return depths, errors.Join(errs...)
+}
+
+func (r *FlavourRouterReconciler) routedServiceQueueDepths(ctx context.Context, routed *schedulingv1alpha1.CarbonRoutedService, ts *schedulingv1alpha1.TrafficSchedule, precisions []int) (map[string]int64, error) {
+	broker, err := r.brokerFor(ctx, routed.Namespace, ts.Spec.Broker)
+	if errors.Is(err, errNoManagementAPI) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return queueDepths(ctx, broker, routed.Namespace, routed.Spec.ServiceName, precisions, bufferedQueueTypes(routed.Spec.Buffer.PriorityClasses))
+}
+
+// routedServiceDeadLetters counts the requests in the dead-letter queue of the
+// Service of routed, zero until the queue is declared.
+func (r *FlavourRouterReconciler) routedServiceDeadLetters(ctx context.Context, routed *schedulingv1alpha1.CarbonRoutedService, ts *schedulingv1alpha1.TrafficSchedule) (int64, error) {
+	broker, err := r.brokerFor(ctx, routed.Namespace, ts.Spec.Broker)
+	if err != nil {
+		return 0, err
+	}
+	count, err := deadLetterCount(ctx, broker, routed.Namespace, routed.Spec.ServiceName)
+	if errors.Is(err, errNoDeadLetterQueue) {
+		return 0, nil
+	}
+	return count, err
+}
+
+// updateRoutedServiceStatus reports the routing state applied to the Service of
+// routed, with the drain of the backlog by its burst reserve and the last
+// evaluation of its SLO guard. Queue depths and dead letters that cannot be
+// read keep their previous value.
+func (r *FlavourRouterReconciler) updateRoutedServiceStatus(ctx context.Context, routed *schedulingv1alpha1.CarbonRoutedService, ts *schedulingv1alpha1.TrafficSchedule, precisions []int, ceilings map[string]int32, burst *schedulingv1alpha1.BurstReserveStatus, guard *schedulingv1alpha1.SLOGuardStatus) error {
+	active := make(map[int]struct{}, len(precisions))
+	for _, precision := range precisions {
+		active[precision] = struct{}{}
+	}
+	status := schedulingv1alpha1.CarbonRoutedServiceStatus{
+		ObservedGeneration: routed.Generation,
+		Schedule:           ts.Namespace + "/" + ts.Name,
+		ScheduleScope:      scheduleScope(ts, routed.Namespace),
+		Overrides:          routedServiceOverrides(routed),
+		LastUpdated:        routed.Status.LastUpdated,
+	}
+	for _, flavour := range ts.Status.Flavours {
+		if _, ok := active[flavour.Precision]; ok {
+			status.ActiveWeights = append(status.ActiveWeights, flavour)
+		}
+	}
+	if len(ceilings) > 0 {
+		status.ReplicaCeilings = ceilings
+	}
+	depths, err := r.routedServiceQueueDepths(ctx, routed, ts, precisions)
+	if err != nil {
+		ctrl.LoggerFrom(ctx).WithName("[FlavourRouter]").Error(err, "Failed to read queue depths")
+	}
+	status.QueueDepths = routed.Status.QueueDepths
+	if len(depths) > 0 {
+		status.QueueDepths = depths
+	}
+	if ts.Spec.Broker.Topology.DeadLetter && brokerType(ts.Spec.Broker) == brokerTypeRabbitMQ {
+		status.DeadLetteredRequests = routed.Status.DeadLetteredRequests
+		if count, err := r.routedServiceDeadLetters(ctx, routed, ts); err != nil {
+			ctrl.LoggerFrom(ctx).WithName("[FlavourRouter]").Error(err, "Failed to count dead letters")
+		} else {
+			status.DeadLetteredRequests = count
+		}
+	}
+	if burst != nil {
+		reportBurstDrain(burst, status.QueueDepths)
+		status.BurstReserve = burst
+	}
+	if guard != nil {
+		status.SLOGuard = guard
+		if guard.Intervening {
+			status.Overrides = append(status.Overrides, "sloGuard")
+		}
+	}
+	if equality.Semantic.DeepEqual(status, routed.Status) {
+		return nil
+	}
+	status.LastUpdated = metav1.Now()
+	patch := client.MergeFrom(routed.DeepCopy())
+	routed.Status = status
+	return r.Status().Patch(ctx, routed, patch)
+}
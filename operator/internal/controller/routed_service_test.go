@@ -0,0 +1,353 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestFlavourReplicaCeilings(t *testing.T) {
+	target := schedulingv1alpha1.TargetConfig{
+		Autoscaling: schedulingv1alpha1.AutoscalingConfig{MaxReplicaCount: ptr.To[int32](10)},
+		PerFlavour: []schedulingv1alpha1.FlavourAutoscaling{
+			{Precision: 60, Autoscaling: schedulingv1alpha1.AutoscalingConfig{MaxReplicaCount: ptr.To[int32](30)}},
+			{Precision: 30, Autoscaling: schedulingv1alpha1.AutoscalingConfig{MaxReplicaCount: ptr.To[int32](3)}},
+			{Precision: 85, Autoscaling: schedulingv1alpha1.AutoscalingConfig{MinReplicaCount: ptr.To[int32](2)}},
+		},
+	}
+	tests := []struct {
+		name      string
+		target    schedulingv1alpha1.TargetConfig
+		ceilings  map[string]int32
+		precision int
+		want      map[string]int32
+	}{
+		{name: "shared max", target: target, ceilings: map[string]int32{"target": 5, "consumer": 4}, precision: 100,
+			want: map[string]int32{"target": 5, "consumer": 4}},
+		{name: "max not overridden", target: target, ceilings: map[string]int32{"target": 5}, precision: 85,
+			want: map[string]int32{"target": 5}},
+		{name: "higher own max", target: target, ceilings: map[string]int32{"target": 5, "consumer": 4}, precision: 60,
+			want: map[string]int32{"target": 15, "consumer": 4}},
+		{name: "lower own max keeps a replica", target: target, ceilings: map[string]int32{"target": 1}, precision: 30,
+			want: map[string]int32{"target": 1}},
+		{name: "no ceiling", target: target, ceilings: map[string]int32{"consumer": 4}, precision: 60,
+			want: map[string]int32{"consumer": 4}},
+		{name: "no shared max", target: schedulingv1alpha1.TargetConfig{PerFlavour: target.PerFlavour}, ceilings: map[string]int32{"target": 5}, precision: 60,
+			want: map[string]int32{"target": 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ceilings := map[string]int32{}
+			for key, value := range tt.ceilings {
+				ceilings[key] = value
+			}
+			if got := flavourReplicaCeilings(ceilings, tt.target, tt.precision); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(ceilings, tt.ceilings) {
+				t.Errorf("shared ceilings changed to %v", ceilings)
+			}
+		})
+	}
+}
+
+func TestRoutedServiceLookup(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := schedulingv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	routed := func(name, service string, created time.Duration, deleting bool) *schedulingv1alpha1.CarbonRoutedService {
+		crs := &schedulingv1alpha1.CarbonRoutedService{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name, CreationTimestamp: metav1.NewTime(start.Add(created))},
+			Spec:       schedulingv1alpha1.CarbonRoutedServiceSpec{ServiceName: service},
+		}
+		if deleting {
+			crs.DeletionTimestamp = &metav1.Time{Time: start}
+			crs.Finalizers = []string{"example.com/hold"}
+		}
+		return crs
+	}
+	service := func(name string, labels map[string]string) *corev1.Service {
+		return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name, Labels: labels}}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		service("checkout", nil),
+		service("cart", map[string]string{enableLabel: "true"}),
+		service("search", nil),
+		service("payments", nil),
+		routed("checkout-old", "checkout", 0, true),
+		routed("checkout-new", "checkout", 2*time.Hour, false),
+		routed("checkout-mid", "checkout", time.Hour, false),
+		routed("payments", "payments", 0, true),
+	).Build()
+	ctx := context.Background()
+
+	crs, err := routedServiceFor(ctx, c, service("checkout", nil))
+	if err != nil || crs == nil || crs.Name != "checkout-mid" {
+		t.Errorf("got %v, %v, want the oldest live CarbonRoutedService", crs, err)
+	}
+	for name, want := range map[string]bool{"checkout": true, "cart": true, "search": false, "payments": false} {
+		var svc corev1.Service
+		if err := c.Get(ctx, client.ObjectKey{Namespace: "shop", Name: name}, &svc); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := Enrolled(ctx, c, &svc); err != nil || got != want {
+			t.Errorf("%s: got enrolled %v, %v, want %v", name, got, err, want)
+		}
+	}
+
+	services, err := listRoutedServices(ctx, c, client.InNamespace("shop"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, svc := range services {
+		names = append(names, svc.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"cart", "checkout"}) {
+		t.Errorf("got routed services %v, want cart and checkout", names)
+	}
+
+	if got := routedServiceRequest(ctx, routed("checkout-mid", "checkout", 0, false)); len(got) != 1 || got[0].Name != "checkout" {
+		t.Errorf("got requests %v, want the target Service", got)
+	}
+	if got := routedServiceRequest(ctx, routed("empty", "", 0, false)); got != nil {
+		t.Errorf("got requests %v for a CarbonRoutedService without a Service", got)
+	}
+}
+
+func TestWithRoutedServiceOverrides(t *testing.T) {
+	requests := corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("200m")}}
+	spec := schedulingv1alpha1.TrafficScheduleSpec{
+		Router: schedulingv1alpha1.ComponentConfig{
+			Autoscaling: schedulingv1alpha1.AutoscalingConfig{MinReplicaCount: ptr.To[int32](1), MaxReplicaCount: ptr.To[int32](5)},
+			Resources:   requests,
+		},
+		Consumer: schedulingv1alpha1.ComponentConfig{Debug: true},
+	}
+	if got := withRoutedServiceOverrides(spec, nil); !reflect.DeepEqual(got, spec) {
+		t.Errorf("no CarbonRoutedService: got %+v, want the schedule spec", got)
+	}
+
+	routed := &schedulingv1alpha1.CarbonRoutedService{Spec: schedulingv1alpha1.CarbonRoutedServiceSpec{
+		Router:   &schedulingv1alpha1.ComponentConfig{Autoscaling: schedulingv1alpha1.AutoscalingConfig{MaxReplicaCount: ptr.To[int32](10)}},
+		Consumer: &schedulingv1alpha1.ComponentConfig{},
+	}}
+	got := withRoutedServiceOverrides(spec, routed)
+	if *got.Router.Autoscaling.MinReplicaCount != 1 || *got.Router.Autoscaling.MaxReplicaCount != 10 {
+		t.Errorf("got router autoscaling %+v, want min inherited and max overridden", got.Router.Autoscaling)
+	}
+	if !reflect.DeepEqual(got.Router.Resources, requests) || !got.Consumer.Debug {
+		t.Errorf("unset overrides replaced the schedule: %+v", got)
+	}
+	if *spec.Router.Autoscaling.MaxReplicaCount != 5 {
+		t.Error("the schedule spec itself was modified")
+	}
+	if sections := routedServiceOverrides(routed); !reflect.DeepEqual(sections, []string{"router", "consumer"}) {
+		t.Errorf("got overridden sections %v, want router and consumer", sections)
+	}
+}
+
+func TestRoutedServiceOverrides(t *testing.T) {
+	routed := &schedulingv1alpha1.CarbonRoutedService{}
+	if got := routedServiceOverrides(routed); got != nil {
+		t.Errorf("no overrides: got %v", got)
+	}
+	routed.Spec.Router = &schedulingv1alpha1.ComponentConfig{}
+	routed.Spec.Target = &schedulingv1alpha1.TargetConfig{}
+	if got := routedServiceOverrides(routed); !reflect.DeepEqual(got, []string{"router", "target"}) {
+		t.Errorf("got %v, want router and target", got)
+	}
+}
+
+func TestMergeAutoscalingTriggers(t *testing.T) {
+	base := schedulingv1alpha1.AutoscalingConfig{PollingInterval: ptr.To[int32](5), QueueLengthTarget: ptr.To[int32](300), RequestRateThreshold: ptr.To[int32](500)}
+	got := mergeAutoscaling(base, schedulingv1alpha1.AutoscalingConfig{PollingInterval: ptr.To[int32](30), RequestRateThreshold: ptr.To[int32](50)})
+	if *got.PollingInterval != 30 || *got.QueueLengthTarget != 300 || *got.RequestRateThreshold != 50 {
+		t.Errorf("got %+v, want the interval and rate overridden and the queue target inherited", got)
+	}
+}
+
+func TestQueueLengthTarget(t *testing.T) {
+	buffer := schedulingv1alpha1.BufferConfig{QueueLengthTarget: ptr.To[int32](200)}
+	tests := []struct {
+		name        string
+		autoscaling schedulingv1alpha1.AutoscalingConfig
+		buffer      schedulingv1alpha1.BufferConfig
+		want        int32
+	}{
+		{name: "default", want: defaultQueueLengthTarget},
+		{name: "buffer of the Service", buffer: buffer, want: 200},
+		{name: "autoscaling of the component", autoscaling: schedulingv1alpha1.AutoscalingConfig{QueueLengthTarget: ptr.To[int32](50)}, buffer: buffer, want: 50},
+	}
+	for _, tt := range tests {
+		if got := queueLengthTarget(tt.autoscaling, tt.buffer); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFlavourAutoscaling(t *testing.T) {
+	target := schedulingv1alpha1.TargetConfig{
+		Autoscaling: schedulingv1alpha1.AutoscalingConfig{MinReplicaCount: ptr.To[int32](1), MaxReplicaCount: ptr.To[int32](10)},
+		PerFlavour: []schedulingv1alpha1.FlavourAutoscaling{
+			{Precision: 30, Autoscaling: schedulingv1alpha1.AutoscalingConfig{MaxReplicaCount: ptr.To[int32](3)}},
+		},
+	}
+	if got := flavourAutoscaling(target, 100); !reflect.DeepEqual(got, target.Autoscaling) {
+		t.Errorf("precision 100: got %+v, want the target settings", got)
+	}
+	if got := flavourAutoscaling(target, 30); *got.MinReplicaCount != 1 || *got.MaxReplicaCount != 3 {
+		t.Errorf("precision 30: got %+v, want min inherited and max overridden", got)
+	}
+	if *target.Autoscaling.MaxReplicaCount != 10 {
+		t.Error("the target settings were modified")
+	}
+}
+
+func TestMergePerFlavour(t *testing.T) {
+	base := []schedulingv1alpha1.FlavourAutoscaling{
+		{Precision: 50, Autoscaling: schedulingv1alpha1.AutoscalingConfig{MinReplicaCount: ptr.To[int32](2), MaxReplicaCount: ptr.To[int32](4)}},
+		{Precision: 30, Autoscaling: schedulingv1alpha1.AutoscalingConfig{MaxReplicaCount: ptr.To[int32](3)}},
+	}
+	if got := mergePerFlavour(base, nil); !reflect.DeepEqual(got, base) {
+		t.Errorf("no overrides: got %+v, want the schedule overrides", got)
+	}
+	got := mergePerFlavour(base, []schedulingv1alpha1.FlavourAutoscaling{
+		{Precision: 50, Autoscaling: schedulingv1alpha1.AutoscalingConfig{MaxReplicaCount: ptr.To[int32](8)}},
+		{Precision: 85, Autoscaling: schedulingv1alpha1.AutoscalingConfig{MinReplicaCount: ptr.To[int32](1)}},
+	})
+	if len(got) != 3 || got[0].Precision != 50 || got[1].Precision != 30 || got[2].Precision != 85 {
+		t.Fatalf("got %+v, want the schedule precisions followed by the new one", got)
+	}
+	if *got[0].Autoscaling.MinReplicaCount != 2 || *got[0].Autoscaling.MaxReplicaCount != 8 {
+		t.Errorf("precision 50: got %+v, want min inherited and max overridden", got[0].Autoscaling)
+	}
+	if *base[0].Autoscaling.MaxReplicaCount != 4 {
+		t.Error("the schedule overrides were modified")
+	}
+}
+
+func TestMergeImage(t *testing.T) {
+	base := schedulingv1alpha1.ImageConfig{
+		Repository:  "registry.internal/router",
+		Digest:      "sha256:abc",
+		PullPolicy:  corev1.PullIfNotPresent,
+		PullSecrets: []corev1.LocalObjectReference{{Name: "internal"}},
+	}
+	tests := []struct {
+		name     string
+		override schedulingv1alpha1.ImageConfig
+		want     schedulingv1alpha1.ImageConfig
+	}{
+		{name: "nothing set", want: base},
+		{name: "tag replaces the digest", override: schedulingv1alpha1.ImageConfig{Tag: "v2"},
+			want: schedulingv1alpha1.ImageConfig{Repository: base.Repository, Tag: "v2", PullPolicy: base.PullPolicy, PullSecrets: base.PullSecrets}},
+		{name: "repository and policy", override: schedulingv1alpha1.ImageConfig{Repository: "ghcr.io/shop/router", PullPolicy: corev1.PullAlways},
+			want: schedulingv1alpha1.ImageConfig{Repository: "ghcr.io/shop/router", Digest: base.Digest, PullPolicy: corev1.PullAlways, PullSecrets: base.PullSecrets}},
+		{name: "empty pull secrets clear them", override: schedulingv1alpha1.ImageConfig{PullSecrets: []corev1.LocalObjectReference{}},
+			want: schedulingv1alpha1.ImageConfig{Repository: base.Repository, Digest: base.Digest, PullPolicy: base.PullPolicy, PullSecrets: []corev1.LocalObjectReference{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeImage(base, tt.override); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeComponentScheduling(t *testing.T) {
+	base := schedulingv1alpha1.ComponentConfig{
+		NodeSelector: map[string]string{"pool": "general"},
+		Tolerations:  []corev1.Toleration{{Key: "general", Operator: corev1.TolerationOpExists}},
+	}
+	got := mergeComponent(base, &schedulingv1alpha1.ComponentConfig{
+		NodeSelector:              map[string]string{"pool": "edge"},
+		TopologySpreadConstraints: []corev1.TopologySpreadConstraint{{MaxSkew: 1, TopologyKey: corev1.LabelTopologyZone}},
+	})
+	if got.NodeSelector["pool"] != "edge" || len(got.TopologySpreadConstraints) != 1 {
+		t.Errorf("got %+v, want the node selector and spread constraints overridden", got)
+	}
+	if !reflect.DeepEqual(got.Tolerations, base.Tolerations) || got.Affinity != nil {
+		t.Errorf("got tolerations %v and affinity %v, want them inherited", got.Tolerations, got.Affinity)
+	}
+}
+
+func TestMergeComponentEnv(t *testing.T) {
+	base := schedulingv1alpha1.ComponentConfig{
+		ExtraEnv: []corev1.EnvVar{{Name: "LOG_FORMAT", Value: "json"}},
+		EnvFrom:  []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "tracing"}}}},
+	}
+	got := mergeComponent(base, &schedulingv1alpha1.ComponentConfig{ExtraEnv: []corev1.EnvVar{{Name: "LOG_FORMAT", Value: "text"}}})
+	if len(got.ExtraEnv) != 1 || got.ExtraEnv[0].Value != "text" || !reflect.DeepEqual(got.EnvFrom, base.EnvFrom) {
+		t.Errorf("got env %v from %v, want the variables replaced and envFrom inherited", got.ExtraEnv, got.EnvFrom)
+	}
+}
+
+func TestMergeComponentSecurity(t *testing.T) {
+	base := schedulingv1alpha1.ComponentConfig{
+		PodSecurityContext: &corev1.PodSecurityContext{RunAsNonRoot: ptr.To(true)},
+		PriorityClassName:  "carbonrouter-critical",
+	}
+	got := mergeComponent(base, &schedulingv1alpha1.ComponentConfig{
+		SecurityContext:              &corev1.SecurityContext{ReadOnlyRootFilesystem: ptr.To(true)},
+		AutomountServiceAccountToken: ptr.To(false),
+	})
+	if got.PodSecurityContext != base.PodSecurityContext || got.PriorityClassName != "carbonrouter-critical" {
+		t.Errorf("got %+v, want the pod security context and priority class inherited", got)
+	}
+	if !ptr.Deref(got.SecurityContext.ReadOnlyRootFilesystem, false) || ptr.Deref(got.AutomountServiceAccountToken, true) {
+		t.Errorf("got %+v, want the container security context and token automount overridden", got)
+	}
+}
+
+func TestRoutedServiceRoutingRules(t *testing.T) {
+	spec := schedulingv1alpha1.TrafficScheduleSpec{Routing: schedulingv1alpha1.RoutingConfig{RoutingRules: []schedulingv1alpha1.RoutingRule{reportsRule}}}
+	search := schedulingv1alpha1.RoutingRule{Name: "search", Path: &schedulingv1alpha1.PathMatch{Value: "/search"}, Precisions: []int{50}}
+	routed := &schedulingv1alpha1.CarbonRoutedService{Spec: schedulingv1alpha1.CarbonRoutedServiceSpec{RoutingRules: []schedulingv1alpha1.RoutingRule{search}}}
+
+	got := withRoutedServiceOverrides(spec, routed)
+	if len(got.Routing.RoutingRules) != 1 || got.Routing.RoutingRules[0].Name != "search" {
+		t.Errorf("got rules %v, want the Service rules replacing the schedule ones", got.Routing.RoutingRules)
+	}
+	if sections := routedServiceOverrides(routed); !reflect.DeepEqual(sections, []string{"routingRules"}) {
+		t.Errorf("got overridden sections %v, want routingRules", sections)
+	}
+	if got := withRoutedServiceOverrides(spec, &schedulingv1alpha1.CarbonRoutedService{}); len(got.Routing.RoutingRules) != 1 || got.Routing.RoutingRules[0].Name != "reports" {
+		t.Errorf("got rules %v, want the schedule rules without an override", got.Routing.RoutingRules)
+	}
+}
+
+func TestRoutedServiceResilience(t *testing.T) {
+	spec := schedulingv1alpha1.TrafficScheduleSpec{Routing: schedulingv1alpha1.RoutingConfig{Resilience: &schedulingv1alpha1.ResilienceConfig{
+		RouteResilience: schedulingv1alpha1.RouteResilience{TimeoutSeconds: ptr.To[int32](5)},
+	}}}
+	routed := &schedulingv1alpha1.CarbonRoutedService{Spec: schedulingv1alpha1.CarbonRoutedServiceSpec{Resilience: &schedulingv1alpha1.ResilienceConfig{
+		RouteResilience: schedulingv1alpha1.RouteResilience{Retries: &schedulingv1alpha1.RetryConfig{Attempts: 3}},
+	}}}
+
+	got := withRoutedServiceOverrides(spec, routed).Routing.Resilience
+	if got.TimeoutSeconds != nil || got.Retries.Attempts != 3 {
+		t.Errorf("got %v, want the Service policy replacing the schedule one", got)
+	}
+	if sections := routedServiceOverrides(routed); !reflect.DeepEqual(sections, []string{"resilience"}) {
+		t.Errorf("got overridden sections %v, want resilience", sections)
+	}
+}
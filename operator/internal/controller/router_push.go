@@ -0,0 +1,345 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	// conditionScheduleSynced reports whether every router and consumer acknowledged the current schedule.
+	conditionScheduleSynced = "carbonrouter.io/ScheduleSynced"
+
+	adminPort       = 8002
+	routerSyncRetry = 15 * time.Second
+	// adminTokenKey holds the bearer token of the admin API in the admin Secret.
+	adminTokenKey   = "token"
+	adminTokenBytes = 24
+)
+
+// pushComponents are the buffer-service components receiving schedule pushes.
+var pushComponents = []string{"router", "consumer"}
+
+// RouterSync is the acknowledgement state of one buffer-service component of a service.
+type RouterSync struct {
+	Namespace    string    `json:"namespace"`
+	Service      string    `json:"service"`
+	Component    string    `json:"component"`
+	Version      string    `json:"version"`
+	Acknowledged []string  `json:"acknowledged"`
+	Pending      []string  `json:"pending"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// syncKey identifies one component of a routed service.
+type syncKey struct {
+	service   types.NamespacedName
+	component string
+}
+
+// RouterSyncTracker remembers which router and consumer pods acknowledged which
+// schedule version. It is safe for concurrent use and tolerates a nil receiver.
+type RouterSyncTracker struct {
+	mu      sync.RWMutex
+	acked   map[syncKey]map[types.UID]string
+	summary map[syncKey]RouterSync
+}
+
+// NewRouterSyncTracker returns an empty tracker.
+func NewRouterSyncTracker() *RouterSyncTracker {
+	return &RouterSyncTracker{
+		acked:   map[syncKey]map[types.UID]string{},
+		summary: map[syncKey]RouterSync{},
+	}
+}
+
+func (t *RouterSyncTracker) ackedVersion(key syncKey, pod types.UID) string {
+	if t == nil {
+		return ""
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.acked[key][pod]
+}
+
+// record stores the outcome of a push round. Only pods seen in this round are
+// kept, so the tracker does not grow across router rollouts.
+func (t *RouterSyncTracker) record(key syncKey, state RouterSync, acked map[types.UID]string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.acked[key] = acked
+	t.summary[key] = state
+}
+
+// Forget drops every record of a service.
+func (t *RouterSyncTracker) Forget(service types.NamespacedName) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, component := range pushComponents {
+		delete(t.acked, syncKey{service, component})
+		delete(t.summary, syncKey{service, component})
+	}
+}
+
+// ServeHTTP lists the router acknowledgement state, optionally filtered by
+// ?namespace= and ?service=.
+func (t *RouterSyncTracker) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	namespace := req.URL.Query().Get("namespace")
+	service := req.URL.Query().Get("service")
+
+	out := []RouterSync{}
+	if t != nil {
+		t.mu.RLock()
+		for key, state := range t.summary {
+			if (namespace == "" || key.service.Namespace == namespace) && (service == "" || key.service.Name == service) {
+				out = append(out, state)
+			}
+		}
+		t.mu.RUnlock()
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Namespace != out[j].Namespace {
+			return out[i].Namespace < out[j].Namespace
+		}
+		if out[i].Service != out[j].Service {
+			return out[i].Service < out[j].Service
+		}
+		return out[i].Component < out[j].Component
+	})
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// scheduleVersion identifies a schedule status by content.
+func scheduleVersion(status *schedulingv1alpha1.TrafficScheduleStatus) (string, []byte, error) {
+	// The savings are accounting, not routing, and left to the watch
+	pushed := *status
+	pushed.Savings = nil
+	raw, err := json.Marshal(&pushed)
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(raw))[:12], raw, nil
+}
+
+// pushScheduleToComponents sends the current schedule to the admin port of
+// every ready router and consumer pod that has not acknowledged it yet, and
+// reports the outcome in the ScheduleSynced condition of the Service. Both
+// components keep watching the TrafficSchedule, so a failed push only delays
+// them. It returns the schedule version and whether some pod is still pending.
+// published is the status of the TrafficSchedule itself, which the status of ts
+// departs from when it is overridden, guarded or killed for this Service.
+func (r *FlavourRouterReconciler) pushScheduleToComponents(ctx context.Context, svc *corev1.Service, ts *schedulingv1alpha1.TrafficSchedule, published *schedulingv1alpha1.TrafficScheduleStatus) (string, bool, error) {
+	version, status, err := scheduleVersion(&ts.Status)
+	if err != nil {
+		return "", false, err
+	}
+	publishedVersion, _, err := scheduleVersion(published)
+	if err != nil {
+		return "", false, err
+	}
+	// A schedule departing from the TrafficSchedule must not be replaced by
+	// the components with the one they watch
+	pinned := version != publishedVersion
+	body := []byte(fmt.Sprintf(`{"version":%q,"schedule":%s,"pinned":%t}`, version, status, pinned))
+
+	token, err := r.adminToken(ctx, svc)
+	if err != nil {
+		return version, false, err
+	}
+
+	acknowledged := 0
+	var pending []string
+	for _, component := range pushComponents {
+		state, err := r.pushScheduleToPods(ctx, svc, component, version, token, body)
+		if err != nil {
+			return version, false, err
+		}
+		acknowledged += len(state.Acknowledged)
+		pending = append(pending, state.Pending...)
+	}
+
+	cond := metav1.Condition{
+		Type:    conditionScheduleSynced,
+		Status:  metav1.ConditionTrue,
+		Reason:  "AllPodsAcknowledged",
+		Message: fmt.Sprintf("%d pod(s) acknowledged schedule version %s", acknowledged, version),
+	}
+	if len(pending) > 0 {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "PodsPending"
+		cond.Message = fmt.Sprintf("schedule version %s not acknowledged by %s", version, strings.Join(pending, ", "))
+	} else if prev := meta.FindStatusCondition(svc.Status.Conditions, conditionScheduleSynced); prev == nil || !strings.HasSuffix(prev.Message, " "+version) || prev.Status != metav1.ConditionTrue {
+		recordEvent(r.Recorder, svc, corev1.EventTypeNormal, eventAppliedSchedule,
+			"Schedule %s/%s version %s acknowledged by %d pod(s): %s", ts.Namespace, ts.Name, version, acknowledged, formatWeights(ts.Status.Flavours))
+	}
+	return version, len(pending) > 0, r.setServiceCondition(ctx, svc, cond)
+}
+
+// bufferPods lists the pods of the component of the buffer services of svc.
+// The manager only caches the flavour pods, see FlavourPodSelector, so they
+// are read through the APIReader.
+func (r *FlavourRouterReconciler) bufferPods(ctx context.Context, svc *corev1.Service, component string) (*corev1.PodList, error) {
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+	var pods corev1.PodList
+	if err := reader.List(ctx, &pods, client.InNamespace(svc.Namespace), client.MatchingLabels{
+		"app.kubernetes.io/name": fmt.Sprintf("buffer-service-%s", component),
+		parentServiceLabel:       svc.Name,
+	}); err != nil {
+		return nil, err
+	}
+	return &pods, nil
+}
+
+func (r *FlavourRouterReconciler) pushScheduleToPods(ctx context.Context, svc *corev1.Service, component, version, token string, body []byte) (RouterSync, error) {
+	log := ctrl.LoggerFrom(ctx).WithName("[FlavourRouter]")
+	pods, err := r.bufferPods(ctx, svc, component)
+	if err != nil {
+		return RouterSync{}, err
+	}
+
+	key := syncKey{service: client.ObjectKeyFromObject(svc), component: component}
+	state := RouterSync{Namespace: svc.Namespace, Service: svc.Name, Component: component, Version: version, Acknowledged: []string{}, Pending: []string{}}
+	acked := map[types.UID]string{}
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" {
+			continue
+		}
+		if r.RouterSync.ackedVersion(key, pod.UID) == version {
+			acked[pod.UID] = version
+			state.Acknowledged = append(state.Acknowledged, pod.Name)
+			continue
+		}
+		if err := pushSchedule(ctx, pod.Status.PodIP, token, body, version); err != nil {
+			log.V(1).Info("Pod did not acknowledge schedule", "pod", pod.Name, "error", err.Error())
+			state.Pending = append(state.Pending, pod.Name)
+			continue
+		}
+		acked[pod.UID] = version
+		state.Acknowledged = append(state.Acknowledged, pod.Name)
+	}
+	sort.Strings(state.Acknowledged)
+	sort.Strings(state.Pending)
+	state.UpdatedAt = time.Now().UTC()
+	r.RouterSync.record(key, state, acked)
+	return state, nil
+}
+
+func pushSchedule(ctx context.Context, podIP, token string, body []byte, version string) error {
+	url := fmt.Sprintf("http://%s:%d/admin/schedule", podIP, adminPort)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %s", resp.Status)
+	}
+	var ack struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ack); err != nil {
+		return err
+	}
+	if ack.Version != version {
+		return fmt.Errorf("router acknowledged version %q instead of %q", ack.Version, version)
+	}
+	return nil
+}
+
+// adminSecretName is the Secret holding the admin API token of the router and
+// consumer of svc.
+func adminSecretName(svc *corev1.Service) string {
+	return fmt.Sprintf("buffer-service-admin-%s", svc.Name)
+}
+
+// adminToken returns the bearer token the router and consumer of svc require
+// on their admin API, creating its Secret with a new one when missing. The
+// Secret goes away with the Service.
+func (r *FlavourRouterReconciler) adminToken(ctx context.Context, svc *corev1.Service) (string, error) {
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+	name := adminSecretName(svc)
+	var existing corev1.Secret
+	err := reader.Get(ctx, client.ObjectKey{Namespace: svc.Namespace, Name: name}, &existing)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+	found := err == nil
+	if token := string(existing.Data[adminTokenKey]); found && token != "" {
+		r.track(svc, "Secret", svc.Namespace, name, nil, false)
+		return token, nil
+	}
+
+	random := make([]byte, adminTokenBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(random)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: svc.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": "carbonrouter-operator",
+				parentServiceLabel:             svc.Name,
+			},
+		},
+		Data: map[string][]byte{adminTokenKey: []byte(token)},
+	}
+	if err := ctrl.SetControllerReference(svc, secret, r.Scheme); err != nil {
+		return "", err
+	}
+	if found {
+		// Emptied by hand, refill it
+		patch := client.MergeFrom(existing.DeepCopy())
+		existing.Data = secret.Data
+		if err := r.Patch(ctx, &existing, patch); err != nil {
+			return "", err
+		}
+	} else if err := r.Create(ctx, secret); err != nil {
+		return "", err
+	}
+	r.track(svc, "Secret", svc.Namespace, name, nil, true)
+	return token, nil
+}
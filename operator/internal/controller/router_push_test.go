@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestScheduleVersion(t *testing.T) {
+	status := schedulingv1alpha1.TrafficScheduleStatus{Flavours: []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 100}}}
+	version, _, err := scheduleVersion(&status)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withSavings := status
+	withSavings.Savings = &schedulingv1alpha1.CarbonSavings{}
+	if got, _, _ := scheduleVersion(&withSavings); got != version {
+		t.Errorf("savings changed the version: %s, want %s", got, version)
+	}
+	reweighted := status
+	reweighted.Flavours = []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 50}, {Precision: 50, Weight: 50}}
+	if got, _, _ := scheduleVersion(&reweighted); got == version {
+		t.Error("new weights kept the version")
+	}
+}
+
+// redirectAdmin sends the admin API requests of the pods to handler.
+func redirectAdmin(t *testing.T, handler http.Handler) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := httpClient
+	transport := server.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(target)
+	httpClient = &http.Client{Transport: transport}
+	t.Cleanup(func() {
+		httpClient = previous
+		server.Close()
+	})
+}
+
+func TestPushScheduleToPods(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout"}}
+	pod := func(name, ip string, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name, UID: types.UID(name), Labels: map[string]string{
+				"app.kubernetes.io/name": "buffer-service-router",
+				parentServiceLabel:       "checkout",
+			}},
+			Status: corev1.PodStatus{Phase: phase, PodIP: ip},
+		}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		pod("router-a", "10.0.0.1", corev1.PodRunning),
+		pod("router-b", "10.0.0.2", corev1.PodRunning),
+		pod("router-c", "", corev1.PodPending),
+	).Build()
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme, RouterSync: NewRouterSyncTracker()}
+
+	pushes := map[string]int{}
+	stale := true
+	redirectAdmin(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host := req.URL.Hostname()
+		pushes[host]++
+		if req.URL.Path != "/admin/schedule" || req.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var body struct {
+			Version string `json:"version"`
+		}
+		_ = json.NewDecoder(req.Body).Decode(&body)
+		if host == "10.0.0.2" && stale {
+			body.Version = "old"
+		}
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+
+	ctx := context.Background()
+	body := []byte(`{"version":"v1"}`)
+	state, err := r.pushScheduleToPods(ctx, svc, "router", "v1", "secret", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(state.Acknowledged, []string{"router-a"}) || !reflect.DeepEqual(state.Pending, []string{"router-b"}) {
+		t.Fatalf("got acknowledged %v pending %v, want router-a and router-b", state.Acknowledged, state.Pending)
+	}
+
+	stale = false
+	if state, err = r.pushScheduleToPods(ctx, svc, "router", "v1", "secret", body); err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Acknowledged) != 2 || len(state.Pending) != 0 {
+		t.Errorf("retry: got acknowledged %v pending %v, want both pods acknowledged", state.Acknowledged, state.Pending)
+	}
+	if pushes["10.0.0.1"] != 1 || pushes["10.0.0.2"] != 2 {
+		t.Errorf("got pushes %v, want acknowledged pods skipped", pushes)
+	}
+
+	rec := httptest.NewRecorder()
+	r.RouterSync.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/router-sync?service=checkout", nil))
+	if !strings.Contains(rec.Body.String(), `"acknowledged":["router-a","router-b"]`) {
+		t.Errorf("got %s, want both pods acknowledged", rec.Body.String())
+	}
+	r.RouterSync.Forget(client.ObjectKeyFromObject(svc))
+	if got := r.RouterSync.ackedVersion(syncKey{client.ObjectKeyFromObject(svc), "router"}, "router-a"); got != "" {
+		t.Errorf("forgotten service still acknowledged %q", got)
+	}
+}
+
+func TestAdminToken(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout", UID: types.UID("checkout")}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(svc).Build()
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme, Inventory: NewResourceInventory()}
+	ctx := context.Background()
+
+	token, err := r.adminToken(ctx, svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(token) != 2*adminTokenBytes {
+		t.Fatalf("got token %q, want %d hex characters", token, 2*adminTokenBytes)
+	}
+	if again, err := r.adminToken(ctx, svc); err != nil || again != token {
+		t.Errorf("got %q, %v, want the stored token", again, err)
+	}
+
+	var secret corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "shop", Name: adminSecretName(svc)}, &secret); err != nil {
+		t.Fatal(err)
+	}
+	if len(secret.OwnerReferences) != 1 || secret.OwnerReferences[0].Name != "checkout" {
+		t.Errorf("got owners %+v, want the Service", secret.OwnerReferences)
+	}
+	secret.Data = nil
+	if err := c.Update(ctx, &secret); err != nil {
+		t.Fatal(err)
+	}
+	refilled, err := r.adminToken(ctx, svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refilled == "" || refilled == token {
+		t.Errorf("emptied Secret not refilled: got %q", refilled)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(&secret), &secret); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(secret.Data[adminTokenKey]); got != refilled {
+		t.Errorf("Secret holds %q, want %q", got, refilled)
+	}
+}
@@ -0,0 +1,264 @@
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+	networkingapi "istio.io/api/networking/v1alpha3"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	defaultHTTP3Port = 443
+	meshGateway      = "mesh"
+)
+
+// buildWebSocketRoute matches WebSocket upgrades and splits them with the
+// schedule weights. Istio routes the upgrade request once, so every connection
+// stays on the precision chosen at establishment; the routing header tells the
+// backend which one it got.
+func buildWebSocketRoute(host, header string, flavours []schedulingv1alpha1.FlavourDecision, precisions []int) *networkingapi.HTTPRoute {
+	route := buildWeightedRoute(host, flavours, precisions)
+	route.Name = "carbonrouter-websocket"
+	route.Match = []*networkingapi.HTTPMatchRequest{{
+		Headers: map[string]*networkingapi.StringMatch{
+			"upgrade": {MatchType: &networkingapi.StringMatch_Regex{Regex: "(?i)websocket"}},
+		},
+	}}
+	setPrecisionHeader(route, header, precisions)
+	return route
+}
+
+// setPrecisionHeader sets the routing header of the requests of every
+// destination of route to the precision of its subset, so the backend learns
+// the precision it serves.
+func setPrecisionHeader(route *networkingapi.HTTPRoute, header string, precisions []int) {
+	precisionBySubset := make(map[string]int, len(precisions))
+	for _, precision := range precisions {
+		precisionBySubset[precisionSubsetName(precision)] = precision
+	}
+	for _, destination := range route.Route {
+		destination.Headers = &networkingapi.Headers{
+			Request: &networkingapi.Headers_HeaderOperations{
+				Set: map[string]string{header: precisionHeaderValue(precisionBySubset[destination.Destination.Subset])},
+			},
+		}
+	}
+}
+
+// advertiseHTTP3 makes gateway responses announce the HTTP/3 endpoint, so
+// h3-capable clients upgrade on their next connection.
+func advertiseHTTP3(routes []*networkingapi.HTTPRoute, cfg schedulingv1alpha1.RoutingConfig) {
+	if !cfg.HTTP3 || len(cfg.Gateways) == 0 {
+		return
+	}
+	port := int32(defaultHTTP3Port)
+	if cfg.HTTP3Port != nil {
+		port = *cfg.HTTP3Port
+	}
+	altSvc := fmt.Sprintf(`h3=":%d"; ma=86400`, port)
+	for _, route := range routes {
+		if route.Headers == nil {
+			route.Headers = &networkingapi.Headers{}
+		}
+		if route.Headers.Response == nil {
+			route.Headers.Response = &networkingapi.Headers_HeaderOperations{}
+		}
+		if route.Headers.Response.Set == nil {
+			route.Headers.Response.Set = map[string]string{}
+		}
+		route.Headers.Response.Set["alt-svc"] = altSvc
+	}
+}
+
+// tagServedPrecision sets the served header on the responses of every
+// destination to the precision of its subset.
+func tagServedPrecision(routes []*networkingapi.HTTPRoute, header string, precisions []int) {
+	if header == "" {
+		return
+	}
+	precisionBySubset := make(map[string]int, len(precisions))
+	for _, precision := range precisions {
+		precisionBySubset[precisionSubsetName(precision)] = precision
+	}
+	for _, route := range routes {
+		for _, destination := range route.Route {
+			precision, ok := precisionBySubset[destination.Destination.Subset]
+			if !ok {
+				continue
+			}
+			if destination.Headers == nil {
+				destination.Headers = &networkingapi.Headers{}
+			}
+			if destination.Headers.Response == nil {
+				destination.Headers.Response = &networkingapi.Headers_HeaderOperations{}
+			}
+			if destination.Headers.Response.Set == nil {
+				destination.Headers.Response.Set = map[string]string{}
+			}
+			destination.Headers.Response.Set[header] = precisionHeaderValue(precision)
+		}
+	}
+}
+
+// applyResilience sets the timeout and retries of the routes. Routes sending
+// all their requests to one precision take its overrides on top.
+func applyResilience(routes []*networkingapi.HTTPRoute, cfg *schedulingv1alpha1.ResilienceConfig, precisions []int) {
+	if cfg == nil {
+		return
+	}
+	for _, route := range routes {
+		if route.Name == "carbonrouter-websocket" || len(route.Route) == 0 {
+			continue
+		}
+		policy := cfg.RouteResilience
+		if precision, ok := singlePrecision(route, precisions); ok {
+			for _, override := range cfg.PerPrecision {
+				if override.Precision == precision {
+					policy = mergeResilience(policy, override.RouteResilience)
+				}
+			}
+		}
+		if policy.TimeoutSeconds != nil {
+			route.Timeout = durationpb.New(time.Duration(*policy.TimeoutSeconds) * time.Second)
+		}
+		if retries := policy.Retries; retries != nil {
+			route.Retries = &networkingapi.HTTPRetry{Attempts: retries.Attempts, RetryOn: retries.RetryOn}
+			if retries.PerTryTimeoutSeconds != nil {
+				route.Retries.PerTryTimeout = durationpb.New(time.Duration(*retries.PerTryTimeoutSeconds) * time.Second)
+			}
+		}
+	}
+}
+
+// singlePrecision returns the precision a route sends all its requests to.
+func singlePrecision(route *networkingapi.HTTPRoute, precisions []int) (int, bool) {
+	if len(route.Route) != 1 {
+		return 0, false
+	}
+	for _, precision := range precisions {
+		if route.Route[0].Destination.Subset == precisionSubsetName(precision) {
+			return precision, true
+		}
+	}
+	return 0, false
+}
+
+// applyFaults injects the delays and aborts of each precision into the routes
+// sending all their requests to it. Istio injects faults before picking a
+// destination, so weighted routes are left alone.
+func applyFaults(routes []*networkingapi.HTTPRoute, cfg *schedulingv1alpha1.FaultInjectionConfig, precisions []int) error {
+	if cfg == nil {
+		return nil
+	}
+	faults := make(map[int]*networkingapi.HTTPFaultInjection, len(cfg.PerPrecision))
+	for _, fault := range cfg.PerPrecision {
+		injection := &networkingapi.HTTPFaultInjection{}
+		if delay := fault.Delay; delay != nil {
+			percentage, err := faultPercentage(delay.Percentage, fault.Precision, "delay")
+			if err != nil {
+				return err
+			}
+			injection.Delay = &networkingapi.HTTPFaultInjection_Delay{
+				HttpDelayType: &networkingapi.HTTPFaultInjection_Delay_FixedDelay{
+					FixedDelay: durationpb.New(time.Duration(delay.FixedDelayMilliseconds) * time.Millisecond),
+				},
+				Percentage: percentage,
+			}
+		}
+		if abort := fault.Abort; abort != nil {
+			percentage, err := faultPercentage(abort.Percentage, fault.Precision, "abort")
+			if err != nil {
+				return err
+			}
+			injection.Abort = &networkingapi.HTTPFaultInjection_Abort{
+				ErrorType:  &networkingapi.HTTPFaultInjection_Abort_HttpStatus{HttpStatus: abort.HTTPStatus},
+				Percentage: percentage,
+			}
+		}
+		if injection.Delay != nil || injection.Abort != nil {
+			faults[fault.Precision] = injection
+		}
+	}
+	for _, route := range routes {
+		if precision, ok := singlePrecision(route, precisions); ok && faults[precision] != nil {
+			route.Fault = faults[precision]
+		}
+	}
+	return nil
+}
+
+// faultPercentage parses the percentage of a fault of precision.
+func faultPercentage(value string, precision int, kind string) (*networkingapi.Percent, error) {
+	percentage, err := strconv.ParseFloat(value, 64)
+	if err != nil || percentage < 0 || percentage > 100 {
+		return nil, invalidConfigError(fmt.Errorf("spec.routing.faultInjection: %s percentage %q of precision %d is not a percentage", kind, value, precision))
+	}
+	return &networkingapi.Percent{Value: percentage}, nil
+}
+
+// mergeResilience returns base with the fields set on override replaced.
+func mergeResilience(base, override schedulingv1alpha1.RouteResilience) schedulingv1alpha1.RouteResilience {
+	if override.TimeoutSeconds != nil {
+		base.TimeoutSeconds = override.TimeoutSeconds
+	}
+	if override.Retries != nil {
+		base.Retries = override.Retries
+	}
+	return base
+}
+
+// mirrorToFlavour shadows a share of the full-precision routes to the mirror
+// precision: the routes sending everything to the highest precision subset and
+// the weighted route while it serves any. Envoy mirrors a route before picking
+// its destination, so the sample of the weighted route also holds requests it
+// serves at lower precisions. WebSocket upgrades are never mirrored.
+func mirrorToFlavour(routes []*networkingapi.HTTPRoute, host string, cfg *schedulingv1alpha1.MirrorConfig, precisions []int) error {
+	if cfg == nil || len(precisions) == 0 {
+		return nil
+	}
+	percentage, err := strconv.ParseFloat(cfg.MirrorPercentage, 64)
+	if err != nil || percentage < 0 || percentage > 100 {
+		return invalidConfigError(fmt.Errorf("spec.routing.mirror.mirrorPercentage %q is not a percentage", cfg.MirrorPercentage))
+	}
+	highest := slices.Max(precisions)
+	if cfg.Precision >= highest {
+		return invalidConfigError(fmt.Errorf("spec.routing.mirror.precision %d is not below the highest precision %d", cfg.Precision, highest))
+	}
+	if !slices.Contains(precisions, cfg.Precision) || percentage == 0 {
+		return nil
+	}
+	fullPrecision := precisionSubsetName(highest)
+	for _, route := range routes {
+		if route.Name == "carbonrouter-websocket" {
+			continue
+		}
+		full := 0
+		for _, destination := range route.Route {
+			if destination.Destination.Subset == fullPrecision {
+				full++
+			}
+		}
+		if full == 0 || full < len(route.Route) && route.Name != "carbonrouter-default" {
+			continue
+		}
+		route.Mirror = &networkingapi.Destination{Host: host, Subset: precisionSubsetName(cfg.Precision)}
+		route.MirrorPercentage = &networkingapi.Percent{Value: percentage}
+	}
+	return nil
+}
+
+// virtualServiceBinding returns the hosts and gateways of the VirtualService.
+// Without gateways it stays mesh-only, as before.
+func virtualServiceBinding(meshHost string, cfg schedulingv1alpha1.RoutingConfig) ([]string, []string) {
+	if len(cfg.Gateways) == 0 {
+		return []string{meshHost}, nil
+	}
+	hosts := append([]string{meshHost}, cfg.Hosts...)
+	gateways := append(append([]string{}, cfg.Gateways...), meshGateway)
+	return hosts, gateways
+}
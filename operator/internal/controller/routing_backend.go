@@ -0,0 +1,235 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	networkingkube "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	securitykube "istio.io/client-go/pkg/apis/security/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	RoutingBackendIstio      = "istio"
+	RoutingBackendGatewayAPI = "gateway-api"
+	RoutingBackendLinkerd    = "linkerd"
+	// routingBackendAnnotation picks the routing backend of one Service,
+	// overriding --routing-backend.
+	routingBackendAnnotation = "carbonrouter.io/routing-backend"
+	// routingModeAnnotation overrides spec.routing.mode for one Service.
+	routingModeAnnotation = "carbonrouter.io/routing-mode"
+	routingModeHTTP       = "http"
+	routingModeNone       = "none"
+)
+
+// RoutingBackends lists the accepted values of --routing-backend and of the
+// routing backend annotation.
+var RoutingBackends = []string{RoutingBackendIstio, RoutingBackendGatewayAPI, RoutingBackendLinkerd}
+
+// routingBackend renders how the traffic of a routed Service is split across
+// its precisions: forced precisions through the routing header, client rules,
+// WebSocket pinning and the schedule weights for everything else.
+type routingBackend interface {
+	name() string
+	// ensure applies the routes of svc for the active precisions.
+	ensure(ctx context.Context, svc *corev1.Service, ts *schedulingv1alpha1.TrafficSchedule, precisions []int, header string) error
+	// pending reports, as the kind of the lagging resource, routes the data
+	// plane has not picked up yet.
+	pending(ctx context.Context, svc *corev1.Service) (string, error)
+	// applied reports whether the cluster holds routes of svc from this
+	// backend, listed by their parent service label.
+	applied(ctx context.Context, svc *corev1.Service) (bool, error)
+	// cleanup removes the routes of svc, keeping what next, the backend taking
+	// over, still uses; next is nil when svc leaves carbonrouter. Kinds whose
+	// CRDs are not installed have nothing to remove.
+	cleanup(ctx context.Context, svc *corev1.Service, next routingBackend) error
+}
+
+func (r *FlavourRouterReconciler) routingBackends() []routingBackend {
+	return []routingBackend{
+		istioRouting{r},
+		gatewayRouting{r: r, backend: RoutingBackendGatewayAPI, gvk: httpRouteGVK},
+		gatewayRouting{r: r, backend: RoutingBackendLinkerd, gvk: linkerdHTTPRouteGVK},
+	}
+}
+
+// routingBackendFor returns the backend selected by the annotation of svc, or
+// by --routing-backend. Services without HTTP routing get noRouting.
+func (r *FlavourRouterReconciler) routingBackendFor(svc *corev1.Service, routing schedulingv1alpha1.RoutingConfig) (routingBackend, error) {
+	mode := routing.Mode
+	if value := svc.Annotations[routingModeAnnotation]; value != "" {
+		mode = value
+	}
+	switch mode {
+	case "", routingModeHTTP:
+	case routingModeNone:
+		return noRouting{}, nil
+	default:
+		return nil, invalidConfigError(fmt.Errorf("annotation %s: unknown routing mode %q, expected %s or %s", routingModeAnnotation, mode, routingModeHTTP, routingModeNone))
+	}
+	selected := r.RoutingBackend
+	if value := svc.Annotations[routingBackendAnnotation]; value != "" {
+		selected = value
+	}
+	if selected == "" {
+		selected = RoutingBackendIstio
+	}
+	for _, backend := range r.routingBackends() {
+		if backend.name() == selected {
+			return backend, nil
+		}
+	}
+	return nil, invalidConfigError(fmt.Errorf("annotation %s: unknown routing backend %q, expected one of %v", routingBackendAnnotation, selected, RoutingBackends))
+}
+
+// retireRoutingBackends removes what the other backends left behind after svc
+// switched to backend. The routes are looked up in the cluster rather than the
+// inventory, which starts empty after a restart.
+func (r *FlavourRouterReconciler) retireRoutingBackends(ctx context.Context, svc *corev1.Service, backend routingBackend) error {
+	var errs []error
+	for _, other := range r.routingBackends() {
+		if other.name() == backend.name() {
+			continue
+		}
+		applied, err := other.applied(ctx, svc)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !applied {
+			continue
+		}
+		ctrl.LoggerFrom(ctx).WithName("[FlavourRouter]").Info("Removing routes of the previous routing backend", "backend", other.name())
+		errs = append(errs, other.cleanup(ctx, svc, backend))
+	}
+	return errors.Join(errs...)
+}
+
+// ignoreAbsent ignores deletions of objects that do not exist, or whose kind
+// is not installed in the cluster.
+func ignoreAbsent(err error) error {
+	if meta.IsNoMatchError(err) {
+		return nil
+	}
+	return client.IgnoreNotFound(err)
+}
+
+func virtualServiceName(svc *corev1.Service) string {
+	return fmt.Sprintf("%s-carbonrouter-vs", svc.Name)
+}
+
+func destinationRuleName(svc *corev1.Service) string {
+	return fmt.Sprintf("%s-carbonrouter-dr", svc.Name)
+}
+
+// noRouting serves queue-only workers, which receive no HTTP traffic to split.
+// Switching a Service to it removes the routes of its previous backend.
+type noRouting struct{}
+
+func (noRouting) name() string { return routingModeNone }
+
+func (noRouting) ensure(context.Context, *corev1.Service, *schedulingv1alpha1.TrafficSchedule, []int, string) error {
+	return nil
+}
+
+func (noRouting) pending(context.Context, *corev1.Service) (string, error) { return "", nil }
+
+func (noRouting) applied(context.Context, *corev1.Service) (bool, error) { return false, nil }
+
+func (noRouting) cleanup(context.Context, *corev1.Service, routingBackend) error { return nil }
+
+// istioRouting splits traffic with a VirtualService over the precision subsets
+// of a DestinationRule. Client rules and mesh security are enforced with
+// AuthorizationPolicies, and connection rebalancing and carbon rate limits use
+// EnvoyFilters. Brownouts are served by a responder Deployment.
+type istioRouting struct {
+	r *FlavourRouterReconciler
+}
+
+func (istioRouting) name() string { return RoutingBackendIstio }
+
+func (b istioRouting) ensure(ctx context.Context, svc *corev1.Service, ts *schedulingv1alpha1.TrafficSchedule, precisions []int, header string) error {
+	if err := b.r.ensureDR(ctx, svc, precisions, ts); err != nil {
+		return err
+	}
+	if err := b.r.ensureBrownoutResponder(ctx, svc, ts.Spec.Routing.Brownout); err != nil {
+		return err
+	}
+	brownout, err := brownoutShare(ts.Spec.Routing.Brownout, ts.Status)
+	if err != nil {
+		return err
+	}
+	if err := b.r.ensureVS(ctx, svc, precisions, ts.Status.Flavours, ts.Spec.Routing, header, brownout); err != nil {
+		return err
+	}
+	if err := b.r.ensureClientPolicies(ctx, svc, ts.Spec.Routing.ClientRules, precisions); err != nil {
+		return err
+	}
+	if err := b.r.ensureMeshSecurity(ctx, svc, ts.Spec.Routing.MeshSecurity); err != nil {
+		return err
+	}
+	if err := b.r.ensureRateLimitFilter(ctx, svc, ts); err != nil {
+		return err
+	}
+	return b.r.ensureDrainFilter(ctx, svc, ts.Spec.Routing.ConnectionRebalancing)
+}
+
+func (b istioRouting) pending(ctx context.Context, svc *corev1.Service) (string, error) {
+	pending, err := b.r.virtualServicePending(ctx, svc)
+	if err != nil || !pending {
+		return "", err
+	}
+	return "VirtualService", nil
+}
+
+func (b istioRouting) applied(ctx context.Context, svc *corev1.Service) (bool, error) {
+	for _, list := range []client.ObjectList{&networkingkube.VirtualServiceList{}, &networkingkube.DestinationRuleList{}} {
+		if err := b.r.List(ctx, list, client.InNamespace(svc.Namespace), client.MatchingLabels{parentServiceLabel: svc.Name}, client.Limit(1)); err != nil {
+			return false, ignoreAbsent(err)
+		}
+		if meta.LenList(list) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (b istioRouting) cleanup(ctx context.Context, svc *corev1.Service, _ routingBackend) error {
+	log := ctrl.LoggerFrom(ctx).WithName("[FlavourRouter][Cleanup]").WithValues("service", svc.Name)
+	key := client.ObjectKeyFromObject(svc)
+	var errs []error
+	for _, object := range []struct {
+		kind string
+		obj  client.Object
+	}{
+		{"VirtualService", &networkingkube.VirtualService{ObjectMeta: metav1.ObjectMeta{Name: virtualServiceName(svc), Namespace: svc.Namespace}}},
+		{"DestinationRule", &networkingkube.DestinationRule{ObjectMeta: metav1.ObjectMeta{Name: destinationRuleName(svc), Namespace: svc.Namespace}}},
+		{"EnvoyFilter", &networkingkube.EnvoyFilter{ObjectMeta: metav1.ObjectMeta{Name: drainFilterName(svc), Namespace: svc.Namespace}}},
+		{"EnvoyFilter", &networkingkube.EnvoyFilter{ObjectMeta: metav1.ObjectMeta{Name: rateLimitFilterName(svc), Namespace: svc.Namespace}}},
+		{"PeerAuthentication", &securitykube.PeerAuthentication{ObjectMeta: metav1.ObjectMeta{Name: meshPolicyName(svc), Namespace: svc.Namespace}}},
+	} {
+		kind, obj := object.kind, object.obj
+		if err := ignoreAbsent(b.r.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground))); err != nil {
+			errs = append(errs, err)
+			log.Error(err, "Failed to delete "+kind)
+			continue
+		}
+		b.r.Inventory.Drop(key, kind, svc.Namespace, obj.GetName())
+	}
+	if err := b.r.deleteBrownoutResponder(ctx, svc); err != nil {
+		errs = append(errs, err)
+		log.Error(err, "Failed to delete brownout responder")
+	}
+	if err := b.r.DeleteAllOf(ctx, &securitykube.AuthorizationPolicy{}, client.InNamespace(svc.Namespace), client.MatchingLabels{parentServiceLabel: svc.Name}); ignoreAbsent(err) != nil {
+		errs = append(errs, err)
+		log.Error(err, "Failed to delete client and mesh AuthorizationPolicies")
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	networkingkube "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	securitykube "istio.io/client-go/pkg/apis/security/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestRetireRoutingBackendsAfterRestart(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := networkingkube.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := securitykube.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout"}}
+	vs := &networkingkube.VirtualService{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "shop", Name: virtualServiceName(svc), Labels: map[string]string{parentServiceLabel: svc.Name},
+	}}
+	other := &networkingkube.VirtualService{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "shop", Name: "cart-carbonrouter-vs", Labels: map[string]string{parentServiceLabel: "cart"},
+	}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(vs, other).Build()
+	// A restarted operator has an empty inventory
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme, Inventory: NewResourceInventory()}
+
+	if applied, err := (istioRouting{r}).applied(context.Background(), svc); err != nil || !applied {
+		t.Fatalf("got applied %v, err %v, want the labelled VirtualService found", applied, err)
+	}
+	if err := r.retireRoutingBackends(context.Background(), svc, noRouting{}); err != nil {
+		t.Fatalf("retire: %v", err)
+	}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(vs), &networkingkube.VirtualService{}); !apierrors.IsNotFound(err) {
+		t.Errorf("VirtualService of the previous backend kept: %v", err)
+	}
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(other), &networkingkube.VirtualService{}); err != nil {
+		t.Errorf("VirtualService of another Service removed: %v", err)
+	}
+}
+
+func TestRoutingBackendFor(t *testing.T) {
+	r := &FlavourRouterReconciler{RoutingBackend: RoutingBackendGatewayAPI}
+	annotated := func(annotations map[string]string) *corev1.Service {
+		return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout", Annotations: annotations}}
+	}
+	tests := []struct {
+		name    string
+		svc     *corev1.Service
+		routing schedulingv1alpha1.RoutingConfig
+		want    string
+		invalid bool
+	}{
+		{name: "flag", svc: annotated(nil), want: RoutingBackendGatewayAPI},
+		{name: "annotation", svc: annotated(map[string]string{routingBackendAnnotation: RoutingBackendLinkerd}), want: RoutingBackendLinkerd},
+		{name: "queue only", svc: annotated(nil), routing: schedulingv1alpha1.RoutingConfig{Mode: routingModeNone}, want: routingModeNone},
+		{name: "annotation overrides the mode", svc: annotated(map[string]string{routingModeAnnotation: routingModeHTTP}),
+			routing: schedulingv1alpha1.RoutingConfig{Mode: routingModeNone}, want: RoutingBackendGatewayAPI},
+		{name: "unknown backend", svc: annotated(map[string]string{routingBackendAnnotation: "nginx"}), invalid: true},
+		{name: "unknown mode", svc: annotated(map[string]string{routingModeAnnotation: "grpc"}), invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend, err := r.routingBackendFor(tt.svc, tt.routing)
+			if tt.invalid {
+				if classify(err) != failureInvalidConfig {
+					t.Errorf("got %v, want an invalid configuration", err)
+				}
+				return
+			}
+			if err != nil || backend.name() != tt.want {
+				t.Errorf("got %v, %v, want the %s backend", backend, err, tt.want)
+			}
+		})
+	}
+	if backend, _ := (&FlavourRouterReconciler{}).routingBackendFor(annotated(nil), schedulingv1alpha1.RoutingConfig{}); backend.name() != RoutingBackendIstio {
+		t.Errorf("got the %s backend, want istio by default", backend.name())
+	}
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	networkingapi "istio.io/api/networking/v1alpha3"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+// Path match types besides the default Prefix.
+const (
+	pathMatchExact = "Exact"
+	pathMatchRegex = "Regex"
+)
+
+// uriMatch returns the VirtualService match of the path of a rule.
+func uriMatch(path schedulingv1alpha1.PathMatch) *networkingapi.StringMatch {
+	switch path.Type {
+	case pathMatchExact:
+		return &networkingapi.StringMatch{MatchType: &networkingapi.StringMatch_Exact{Exact: path.Value}}
+	case pathMatchRegex:
+		return &networkingapi.StringMatch{MatchType: &networkingapi.StringMatch_Regex{Regex: path.Value}}
+	default:
+		return &networkingapi.StringMatch{MatchType: &networkingapi.StringMatch_Prefix{Prefix: path.Value}}
+	}
+}
+
+// rulePath returns the path matched by a rule. gRPC calls are requests to
+// "/<service>/<method>".
+func rulePath(rule schedulingv1alpha1.RoutingRule) *schedulingv1alpha1.PathMatch {
+	if rule.GRPC == nil {
+		return rule.Path
+	}
+	if rule.GRPC.Method == "" {
+		return &schedulingv1alpha1.PathMatch{Value: "/" + rule.GRPC.Service + "/"}
+	}
+	return &schedulingv1alpha1.PathMatch{Type: pathMatchExact, Value: "/" + rule.GRPC.Service + "/" + rule.GRPC.Method}
+}
+
+// ruleMatches returns the VirtualService matches of a routing rule: one per
+// method, each also matching the path and authority. Rules matching none have
+// none.
+func ruleMatches(rule schedulingv1alpha1.RoutingRule) []*networkingapi.HTTPMatchRequest {
+	var uri, authority *networkingapi.StringMatch
+	if path := rulePath(rule); path != nil {
+		uri = uriMatch(*path)
+	}
+	if rule.Authority != "" {
+		authority = &networkingapi.StringMatch{MatchType: &networkingapi.StringMatch_Exact{Exact: rule.Authority}}
+	}
+	if len(rule.Methods) == 0 {
+		if uri == nil && authority == nil {
+			return nil
+		}
+		return []*networkingapi.HTTPMatchRequest{{Uri: uri, Authority: authority}}
+	}
+	matches := make([]*networkingapi.HTTPMatchRequest, 0, len(rule.Methods))
+	for _, method := range rule.Methods {
+		matches = append(matches, &networkingapi.HTTPMatchRequest{
+			Uri:       uri,
+			Method:    &networkingapi.StringMatch{MatchType: &networkingapi.StringMatch_Exact{Exact: string(method)}},
+			Authority: authority,
+		})
+	}
+	return matches
+}
+
+// buildRuleRoutes compiles the routing rules into routes placed after the
+// client ones, so a client contract still wins over the endpoint it calls. A
+// request forcing an allowed precision gets it; any other matching request is
+// split across the allowed precisions with the schedule weights. Rules without
+// a matcher or an active allowed precision are skipped, leaving their requests
+// to the shared routes. Forced gRPC calls carry the routing header already,
+// and it is set on the weighted ones.
+func buildRuleRoutes(host, header string, rules []schedulingv1alpha1.RoutingRule, flavours []schedulingv1alpha1.FlavourDecision, precisions []int) []*networkingapi.HTTPRoute {
+	var routes []*networkingapi.HTTPRoute
+	for _, rule := range rules {
+		matches := ruleMatches(rule)
+		allowed := allowedPrecisions(rule.Precisions, precisions)
+		if len(matches) == 0 || len(allowed) == 0 {
+			continue
+		}
+		for _, precision := range allowed {
+			forced := make([]*networkingapi.HTTPMatchRequest, 0, len(matches))
+			for _, match := range matches {
+				forced = append(forced, &networkingapi.HTTPMatchRequest{
+					Uri:       match.Uri,
+					Method:    match.Method,
+					Authority: match.Authority,
+					Headers: map[string]*networkingapi.StringMatch{
+						header: {MatchType: &networkingapi.StringMatch_Exact{Exact: precisionHeaderValue(precision)}},
+					},
+				})
+			}
+			routes = append(routes, &networkingapi.HTTPRoute{
+				Match: forced,
+				Route: []*networkingapi.HTTPRouteDestination{{
+					Destination: &networkingapi.Destination{Host: host, Subset: precisionSubsetName(precision)},
+					Weight:      100,
+				}},
+			})
+		}
+		route := buildWeightedRoute(host, flavours, allowed)
+		route.Name = "carbonrouter-rule-" + rule.Name
+		route.Match = matches
+		// gRPC servers read the precision from the call metadata
+		if rule.GRPC != nil {
+			setPrecisionHeader(route, header, precisions)
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
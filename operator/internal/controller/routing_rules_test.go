@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	networkingapi "istio.io/api/networking/v1alpha3"
+	networkingkube "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+var reportsRule = schedulingv1alpha1.RoutingRule{
+	Name:       "reports",
+	Path:       &schedulingv1alpha1.PathMatch{Value: "/reports"},
+	Precisions: []int{100},
+}
+
+func TestURIMatch(t *testing.T) {
+	tests := []struct {
+		path schedulingv1alpha1.PathMatch
+		want *networkingapi.StringMatch
+	}{
+		{path: schedulingv1alpha1.PathMatch{Value: "/reports"}, want: &networkingapi.StringMatch{MatchType: &networkingapi.StringMatch_Prefix{Prefix: "/reports"}}},
+		{path: schedulingv1alpha1.PathMatch{Type: pathMatchExact, Value: "/checkout"}, want: &networkingapi.StringMatch{MatchType: &networkingapi.StringMatch_Exact{Exact: "/checkout"}}},
+		{path: schedulingv1alpha1.PathMatch{Type: pathMatchRegex, Value: "/v[0-9]+/search"}, want: &networkingapi.StringMatch{MatchType: &networkingapi.StringMatch_Regex{Regex: "/v[0-9]+/search"}}},
+	}
+	for _, tt := range tests {
+		if got := uriMatch(tt.path); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v: got %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	reports := schedulingv1alpha1.PathMatch{Value: "/reports"}
+	tests := []struct {
+		name string
+		rule schedulingv1alpha1.RoutingRule
+		// method and path prefix of each match
+		want [][2]string
+	}{
+		{name: "no matcher"},
+		{name: "path", rule: schedulingv1alpha1.RoutingRule{Path: &reports}, want: [][2]string{{"", "/reports"}}},
+		{name: "methods", rule: schedulingv1alpha1.RoutingRule{Methods: []schedulingv1alpha1.HTTPMethod{"POST", "PUT"}}, want: [][2]string{{"POST", ""}, {"PUT", ""}}},
+		{name: "methods on a path", rule: schedulingv1alpha1.RoutingRule{Path: &reports, Methods: []schedulingv1alpha1.HTTPMethod{"DELETE"}}, want: [][2]string{{"DELETE", "/reports"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][2]string
+			for _, match := range ruleMatches(tt.rule) {
+				got = append(got, [2]string{match.Method.GetExact(), match.Uri.GetPrefix()})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			var gateway [][2]string
+			for _, match := range ruleRouteMatches(tt.rule) {
+				path := ""
+				if match.Path != nil {
+					path = match.Path.Value
+				}
+				gateway = append(gateway, [2]string{match.Method, path})
+			}
+			if !reflect.DeepEqual(gateway, tt.want) {
+				t.Errorf("Gateway API: got %v, want %v", gateway, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildRuleRoutes(t *testing.T) {
+	host := "checkout.shop.svc.cluster.local"
+	flavours := []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 20}, {Precision: 50, Weight: 40}, {Precision: 30, Weight: 40}}
+	search := schedulingv1alpha1.RoutingRule{Name: "search", Path: &schedulingv1alpha1.PathMatch{Type: pathMatchExact, Value: "/search"}, Precisions: []int{100, 50}}
+	rules := []schedulingv1alpha1.RoutingRule{
+		{Name: "unmatched", Precisions: []int{100}},
+		// only precision 30 is allowed, which is not deployed
+		{Name: "archive", Path: &schedulingv1alpha1.PathMatch{Value: "/archive"}, Precisions: []int{30}},
+		search,
+	}
+	routes := buildRuleRoutes(host, "x-carbonrouter", rules, flavours, []int{100, 50})
+	if len(routes) != 3 {
+		t.Fatalf("got %d routes, want the forced and the weighted routes of search", len(routes))
+	}
+	for i, precision := range []int{100, 50} {
+		forced := routes[i]
+		match := forced.Match[0]
+		if match.Uri.GetExact() != "/search" || match.Headers["x-carbonrouter"].GetExact() != precisionHeaderValue(precision) {
+			t.Errorf("got forced match %v, want the path and the requested precision %d", match, precision)
+		}
+		if forced.Route[0].Destination.Subset != precisionSubsetName(precision) || forced.Route[0].Weight != 100 {
+			t.Errorf("got forced destinations %v, want precision %d", forced.Route, precision)
+		}
+	}
+	weighted := routes[2]
+	if weighted.Name != "carbonrouter-rule-search" || len(weighted.Match) != 1 || weighted.Match[0].Uri.GetExact() != "/search" || weighted.Match[0].Headers != nil {
+		t.Errorf("got route %q matching %v, want the rule weighted route on the path only", weighted.Name, weighted.Match)
+	}
+	got := map[string]int32{}
+	for _, destination := range weighted.Route {
+		got[destination.Destination.Subset] = destination.Weight
+	}
+	// the allowed precisions keep the ratio of their weights
+	if want := map[string]int32{"precision-100": 33, "precision-50": 67}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got weights %v, want %v", got, want)
+	}
+}
+
+func TestEnsureVSRouteOrder(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := networkingkube.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	var applied *networkingkube.VirtualService
+	c := fake.NewClientBuilder().WithScheme(scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			applied = obj.(*networkingkube.VirtualService).DeepCopy()
+			return nil
+		},
+	}).Build()
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme, Inventory: NewResourceInventory()}
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout", UID: "checkout"}}
+	flavours := []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 40}, {Precision: 50, Weight: 60}}
+	routing := schedulingv1alpha1.RoutingConfig{
+		ClientRules:     []schedulingv1alpha1.ClientPrecisionRule{freeTier},
+		RoutingRules:    []schedulingv1alpha1.RoutingRule{reportsRule},
+		SessionAffinity: schedulingv1alpha1.SessionAffinityConfig{Enabled: true, Header: "x-session-id"},
+		WebSocket:       true,
+	}
+	if err := r.ensureVS(context.Background(), svc, []int{100, 50}, flavours, routing, "x-carbonrouter", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, route := range applied.Spec.Http {
+		label := route.Name
+		if label == "" {
+			match := route.Match[0]
+			label = "forced " + route.Route[0].Destination.Subset
+			if prefix := match.Uri.GetPrefix(); prefix != "" {
+				label += " " + prefix
+			}
+			if match.Headers["x-plan"] != nil {
+				label += " client"
+			}
+		}
+		got = append(got, label)
+	}
+	// Client contracts, then the routing rules, then the forced precisions,
+	// sessions and WebSocket upgrades before the weighted default
+	want := []string{
+		"forced precision-50 client",
+		"carbonrouter-client-free",
+		"forced precision-100 /reports",
+		"carbonrouter-rule-reports",
+		"forced precision-100",
+		"forced precision-50",
+		"carbonrouter-session-precision-100",
+		"carbonrouter-session-precision-50",
+		"carbonrouter-websocket",
+		"carbonrouter-default",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got routes\n%v\nwant\n%v", got, want)
+	}
+}
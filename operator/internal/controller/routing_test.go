@@ -0,0 +1,243 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	networkingapi "istio.io/api/networking/v1alpha3"
+	"k8s.io/utils/ptr"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestBuildWebSocketRoute(t *testing.T) {
+	host := "checkout.shop.svc.cluster.local"
+	flavours := []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 25}, {Precision: 50, Weight: 75}}
+	route := buildWebSocketRoute(host, "x-carbonrouter", flavours, []int{100, 50})
+
+	if route.Name != "carbonrouter-websocket" || len(route.Match) != 1 {
+		t.Fatalf("got route %q with matches %v, want one upgrade match", route.Name, route.Match)
+	}
+	if upgrade := route.Match[0].Headers["upgrade"].GetRegex(); upgrade != "(?i)websocket" {
+		t.Errorf("got upgrade match %q, want a case-insensitive websocket", upgrade)
+	}
+	type destination struct {
+		header string
+		weight int32
+	}
+	got := map[string]destination{}
+	for _, dest := range route.Route {
+		got[dest.Destination.Subset] = destination{dest.Headers.GetRequest().GetSet()["x-carbonrouter"], dest.Weight}
+	}
+	want := map[string]destination{"precision-100": {"100", 25}, "precision-50": {"50", 75}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got header and weight per subset %v, want %v", got, want)
+	}
+}
+
+func TestAdvertiseHTTP3(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  schedulingv1alpha1.RoutingConfig
+		want string
+	}{
+		{name: "disabled", cfg: schedulingv1alpha1.RoutingConfig{Gateways: []string{"istio-system/public"}}},
+		{name: "mesh only", cfg: schedulingv1alpha1.RoutingConfig{HTTP3: true}},
+		{name: "default port", cfg: schedulingv1alpha1.RoutingConfig{HTTP3: true, Gateways: []string{"istio-system/public"}},
+			want: `h3=":443"; ma=86400`},
+		{name: "custom port", cfg: schedulingv1alpha1.RoutingConfig{HTTP3: true, HTTP3Port: ptr.To[int32](8443), Gateways: []string{"istio-system/public"}},
+			want: `h3=":8443"; ma=86400`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes := []*networkingapi.HTTPRoute{
+				{Name: "tagged"},
+				{Name: "default", Headers: &networkingapi.Headers{Response: &networkingapi.Headers_HeaderOperations{Set: map[string]string{"x-kept": "1"}}}},
+			}
+			advertiseHTTP3(routes, tt.cfg)
+			for _, route := range routes {
+				if got := route.Headers.GetResponse().GetSet()["alt-svc"]; got != tt.want {
+					t.Errorf("%s: got alt-svc %q, want %q", route.Name, got, tt.want)
+				}
+			}
+			if routes[1].Headers.Response.Set["x-kept"] != "1" {
+				t.Error("existing response headers dropped")
+			}
+		})
+	}
+}
+
+func TestVirtualServiceBinding(t *testing.T) {
+	meshHost := "checkout.shop.svc.cluster.local"
+	tests := []struct {
+		name     string
+		cfg      schedulingv1alpha1.RoutingConfig
+		hosts    []string
+		gateways []string
+	}{
+		{name: "mesh only", cfg: schedulingv1alpha1.RoutingConfig{Hosts: []string{"shop.example.com"}}, hosts: []string{meshHost}},
+		{name: "gateways keep the mesh", cfg: schedulingv1alpha1.RoutingConfig{Hosts: []string{"shop.example.com"}, Gateways: []string{"istio-system/public"}},
+			hosts: []string{meshHost, "shop.example.com"}, gateways: []string{"istio-system/public", meshGateway}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hosts, gateways := virtualServiceBinding(meshHost, tt.cfg)
+			if !reflect.DeepEqual(hosts, tt.hosts) || !reflect.DeepEqual(gateways, tt.gateways) {
+				t.Errorf("got hosts %v gateways %v, want %v and %v", hosts, gateways, tt.hosts, tt.gateways)
+			}
+		})
+	}
+}
+
+func TestMirrorToFlavour(t *testing.T) {
+	host := "checkout.shop.svc.cluster.local"
+	to := func(subsets ...string) []*networkingapi.HTTPRouteDestination {
+		var out []*networkingapi.HTTPRouteDestination
+		for _, subset := range subsets {
+			out = append(out, &networkingapi.HTTPRouteDestination{Destination: &networkingapi.Destination{Host: host, Subset: subset}})
+		}
+		return out
+	}
+	routes := func() []*networkingapi.HTTPRoute {
+		return []*networkingapi.HTTPRoute{
+			{Name: "carbonrouter-precision-100", Route: to("precision-100")},
+			{Name: "carbonrouter-precision-50", Route: to("precision-50")},
+			{Name: "carbonrouter-client-free", Route: to("precision-100", "precision-50")},
+			{Name: "carbonrouter-websocket", Route: to("precision-100", "precision-50")},
+			{Name: "carbonrouter-default", Route: to("precision-100", "precision-50")},
+		}
+	}
+	precisions := []int{100, 50, 30}
+
+	tests := []struct {
+		name     string
+		cfg      *schedulingv1alpha1.MirrorConfig
+		mirrored []string
+		invalid  bool
+	}{
+		{name: "disabled"},
+		{name: "full precision routes", cfg: &schedulingv1alpha1.MirrorConfig{Precision: 30, MirrorPercentage: "2.5"},
+			mirrored: []string{"carbonrouter-precision-100", "carbonrouter-default"}},
+		{name: "precision not deployed", cfg: &schedulingv1alpha1.MirrorConfig{Precision: 85, MirrorPercentage: "10"}},
+		{name: "zero percent", cfg: &schedulingv1alpha1.MirrorConfig{Precision: 30, MirrorPercentage: "0"}},
+		{name: "not a number", cfg: &schedulingv1alpha1.MirrorConfig{Precision: 30, MirrorPercentage: "ten"}, invalid: true},
+		{name: "above 100", cfg: &schedulingv1alpha1.MirrorConfig{Precision: 30, MirrorPercentage: "120"}, invalid: true},
+		{name: "full precision mirror", cfg: &schedulingv1alpha1.MirrorConfig{Precision: 100, MirrorPercentage: "10"}, invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes := routes()
+			err := mirrorToFlavour(routes, host, tt.cfg, precisions)
+			if tt.invalid {
+				if classify(err) != failureInvalidConfig {
+					t.Errorf("got %v, want an invalid configuration", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var mirrored []string
+			for _, route := range routes {
+				if route.Mirror == nil {
+					continue
+				}
+				mirrored = append(mirrored, route.Name)
+				if route.Mirror.Host != host || route.Mirror.Subset != precisionSubsetName(tt.cfg.Precision) || route.MirrorPercentage.GetValue() != 2.5 {
+					t.Errorf("%s: got mirror %v at %v%%, want 2.5%% to precision-30", route.Name, route.Mirror, route.MirrorPercentage.GetValue())
+				}
+			}
+			if !reflect.DeepEqual(mirrored, tt.mirrored) {
+				t.Errorf("got mirrored routes %v, want %v", mirrored, tt.mirrored)
+			}
+		})
+	}
+}
+
+func TestTagServedPrecision(t *testing.T) {
+	host := "checkout.shop.svc.cluster.local"
+	routes := []*networkingapi.HTTPRoute{
+		{Name: "carbonrouter-websocket", Route: []*networkingapi.HTTPRouteDestination{{
+			Destination: &networkingapi.Destination{Host: host, Subset: "precision-50"},
+			Headers:     &networkingapi.Headers{Request: &networkingapi.Headers_HeaderOperations{Set: map[string]string{"x-carbonrouter": "50"}}},
+		}}},
+		buildWeightedRoute(host, []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 40}, {Precision: 50, Weight: 60}}, []int{100, 50}),
+	}
+	tagServedPrecision(routes, "", []int{100, 50})
+	for _, route := range routes {
+		for _, destination := range route.Route {
+			if destination.Headers.GetResponse() != nil {
+				t.Errorf("%s: got response headers %v without a served header", route.Name, destination.Headers.Response)
+			}
+		}
+	}
+
+	tagServedPrecision(routes, "x-carbonrouter-served", []int{100, 50})
+	for _, route := range routes {
+		for _, destination := range route.Route {
+			want := destination.Destination.Subset[len("precision-"):]
+			if got := destination.Headers.GetResponse().GetSet()["x-carbonrouter-served"]; got != want {
+				t.Errorf("%s to %s: got served header %q, want %q", route.Name, destination.Destination.Subset, got, want)
+			}
+		}
+	}
+	if routes[0].Route[0].Headers.Request.Set["x-carbonrouter"] != "50" {
+		t.Error("request headers dropped")
+	}
+}
+
+func TestApplyResilience(t *testing.T) {
+	destination := func(subsets ...string) []*networkingapi.HTTPRouteDestination {
+		var out []*networkingapi.HTTPRouteDestination
+		for _, subset := range subsets {
+			out = append(out, &networkingapi.HTTPRouteDestination{Destination: &networkingapi.Destination{Subset: subset}})
+		}
+		return out
+	}
+	routes := []*networkingapi.HTTPRoute{
+		{Name: "forced precision-50", Route: destination("precision-50")},
+		{Name: "forced precision-100", Route: destination("precision-100")},
+		{Name: "carbonrouter-websocket", Route: destination("precision-50")},
+		{Name: "carbonrouter-default", Route: destination("precision-100", "precision-50")},
+	}
+	cfg := &schedulingv1alpha1.ResilienceConfig{
+		RouteResilience: schedulingv1alpha1.RouteResilience{
+			TimeoutSeconds: ptr.To[int32](5),
+			Retries:        &schedulingv1alpha1.RetryConfig{Attempts: 2, RetryOn: "5xx", PerTryTimeoutSeconds: ptr.To[int32](2)},
+		},
+		PerPrecision: []schedulingv1alpha1.PrecisionResilience{
+			{Precision: 50, RouteResilience: schedulingv1alpha1.RouteResilience{TimeoutSeconds: ptr.To[int32](30)}},
+		},
+	}
+
+	applyResilience(routes, nil, []int{100, 50})
+	if routes[0].Timeout != nil || routes[0].Retries != nil {
+		t.Fatalf("got %v, want the routes untouched without a config", routes[0])
+	}
+	applyResilience(routes, cfg, []int{100, 50})
+	tests := []struct {
+		timeout time.Duration
+		retries bool
+	}{
+		// the override only replaces the timeout
+		{timeout: 30 * time.Second, retries: true},
+		{timeout: 5 * time.Second, retries: true},
+		// WebSocket upgrades keep the Istio defaults
+		{},
+		// weighted routes keep the policy of the Service
+		{timeout: 5 * time.Second, retries: true},
+	}
+	for i, tt := range tests {
+		route := routes[i]
+		if got := route.Timeout.AsDuration(); got != tt.timeout {
+			t.Errorf("%s: got timeout %v, want %v", route.Name, got, tt.timeout)
+		}
+		if (route.Retries != nil) != tt.retries {
+			t.Errorf("%s: got retries %v, want %v", route.Name, route.Retries, tt.retries)
+		}
+	}
+	if retries := routes[0].Retries; retries.Attempts != 2 || retries.RetryOn != "5xx" || retries.PerTryTimeout.AsDuration() != 2*time.Second {
+		t.Errorf("got retries %v, want 2 attempts on 5xx of 2s each", retries)
+	}
+}
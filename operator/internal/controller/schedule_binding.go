@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+// conditionScheduleBound reports which TrafficSchedule drives a routed Service.
+const conditionScheduleBound = "carbonrouter.io/ScheduleBound"
+
+// The scopes a schedule can match a Service through, from the most specific.
+const (
+	scopeService   = "Service"
+	scopeNamespace = "Namespace"
+	scopeCluster   = "Cluster"
+)
+
+// scheduleMatches reports whether the serviceSelector of a schedule covers svc.
+func scheduleMatches(ts *schedulingv1alpha1.TrafficSchedule, svc *corev1.Service) (bool, error) {
+	sel := ts.Spec.ServiceSelector
+	if len(sel.Namespaces) > 0 && !slices.Contains(sel.Namespaces, svc.Namespace) {
+		return false, nil
+	}
+	if sel.Selector == nil {
+		return true, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(sel.Selector)
+	if err != nil {
+		return false, err
+	}
+	return selector.Matches(labels.Set(svc.Labels)), nil
+}
+
+func hasServiceSelector(ts *schedulingv1alpha1.TrafficSchedule) bool {
+	return ts.Spec.ServiceSelector.Selector != nil || len(ts.Spec.ServiceSelector.Namespaces) > 0
+}
+
+// scheduleScope returns the scope through which ts matches the Services of
+// namespace: a label selector targets Services, a namespaces list or the
+// schedule's own namespace targets the namespace, anything else is a cluster
+// default.
+func scheduleScope(ts *schedulingv1alpha1.TrafficSchedule, namespace string) string {
+	switch {
+	case ts.Spec.ServiceSelector.Selector != nil:
+		return scopeService
+	case len(ts.Spec.ServiceSelector.Namespaces) > 0, ts.Namespace == namespace:
+		return scopeNamespace
+	}
+	return scopeCluster
+}
+
+func scopeRank(scope string) int {
+	switch scope {
+	case scopeService:
+		return 2
+	case scopeNamespace:
+		return 1
+	}
+	return 0
+}
+
+// schedulePrecedes is the conflict policy between two schedules matching a
+// Service in namespace: the higher priority, then the more specific scope,
+// then the same namespace, then the oldest, then namespace/name order.
+func schedulePrecedes(a, b *schedulingv1alpha1.TrafficSchedule, namespace string) bool {
+	if a.Spec.Priority != b.Spec.Priority {
+		return a.Spec.Priority > b.Spec.Priority
+	}
+	if rankA, rankB := scopeRank(scheduleScope(a, namespace)), scopeRank(scheduleScope(b, namespace)); rankA != rankB {
+		return rankA > rankB
+	}
+	if (a.Namespace == namespace) != (b.Namespace == namespace) {
+		return a.Namespace == namespace
+	}
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
+	}
+	return a.Name < b.Name
+}
+
+// bindSchedule picks the schedule for svc among schedules and returns it with
+// the names of the other matching ones. Schedules with an invalid selector are
+// skipped and reported through errs.
+func bindSchedule(svc *corev1.Service, schedules []schedulingv1alpha1.TrafficSchedule) (*schedulingv1alpha1.TrafficSchedule, []string, []error) {
+	var matching []*schedulingv1alpha1.TrafficSchedule
+	var errs []error
+	for i := range schedules {
+		ok, err := scheduleMatches(&schedules[i], svc)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("TrafficSchedule %s/%s: invalid serviceSelector: %w", schedules[i].Namespace, schedules[i].Name, err))
+			continue
+		}
+		if ok {
+			matching = append(matching, &schedules[i])
+		}
+	}
+	if len(matching) == 0 {
+		return nil, nil, errs
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		return schedulePrecedes(matching[i], matching[j], svc.Namespace)
+	})
+	shadowed := make([]string, 0, len(matching)-1)
+	for _, ts := range matching[1:] {
+		shadowed = append(shadowed, ts.Namespace+"/"+ts.Name)
+	}
+	return matching[0], shadowed, errs
+}
+
+// resolveSchedule lists the TrafficSchedules, binds one to svc and records the
+// choice in the ScheduleBound condition. It returns nil when none matches.
+func (r *FlavourRouterReconciler) resolveSchedule(ctx context.Context, svc *corev1.Service) (*schedulingv1alpha1.TrafficSchedule, error) {
+	var tsList schedulingv1alpha1.TrafficScheduleList
+	if err := r.List(ctx, &tsList); err != nil {
+		return nil, err
+	}
+	ts, shadowed, errs := bindSchedule(svc, tsList.Items)
+	for _, err := range errs {
+		ctrl.LoggerFrom(ctx).WithName("[FlavourRouter]").Error(err, "Ignoring TrafficSchedule")
+	}
+
+	cond := metav1.Condition{
+		Type:    conditionScheduleBound,
+		Status:  metav1.ConditionFalse,
+		Reason:  "NoMatchingSchedule",
+		Message: "no TrafficSchedule selects this Service",
+	}
+	if ts != nil {
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = "Selected"
+		cond.Message = fmt.Sprintf("bound to TrafficSchedule %s/%s (scope %s, priority %d)",
+			ts.Namespace, ts.Name, scheduleScope(ts, svc.Namespace), ts.Spec.Priority)
+		if len(shadowed) > 0 {
+			cond.Reason = "Conflict"
+			cond.Message += fmt.Sprintf("; also matched by %s", strings.Join(shadowed, ", "))
+		}
+	}
+	if ts != nil && conditionTransitions(svc.Status.Conditions, cond) {
+		recordEvent(r.Recorder, svc, corev1.EventTypeNormal, eventScheduleBound, "%s", cond.Message)
+	}
+	return ts, r.setServiceCondition(ctx, svc, cond)
+}
+
+// boundServices returns the opted-in Services bound to ts. It only applies to
+// schedules with a serviceSelector; the others keep discovering cluster-wide.
+func boundServices(ctx context.Context, c client.Reader, ts *schedulingv1alpha1.TrafficSchedule) (map[string]struct{}, error) {
+	var schedules schedulingv1alpha1.TrafficScheduleList
+	if err := c.List(ctx, &schedules); err != nil {
+		return nil, err
+	}
+	services, err := listRoutedServices(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	bound := map[string]struct{}{}
+	for i := range services {
+		svc := &services[i]
+		winner, _, _ := bindSchedule(svc, schedules.Items)
+		if winner != nil && winner.Namespace == ts.Namespace && winner.Name == ts.Name {
+			bound[svc.Namespace+"/"+svc.Name] = struct{}{}
+		}
+	}
+	return bound, nil
+}
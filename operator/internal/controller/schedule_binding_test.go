@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func boundSchedule(namespace, name string, created time.Duration, sel schedulingv1alpha1.ServiceSelector) schedulingv1alpha1.TrafficSchedule {
+	return schedulingv1alpha1.TrafficSchedule{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         namespace,
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC).Add(created)),
+		},
+		Spec: schedulingv1alpha1.TrafficScheduleSpec{ServiceSelector: sel},
+	}
+}
+
+func withPriority(ts schedulingv1alpha1.TrafficSchedule, priority int32) schedulingv1alpha1.TrafficSchedule {
+	ts.Spec.Priority = priority
+	return ts
+}
+
+func TestBindSchedule(t *testing.T) {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout", Labels: map[string]string{"tier": "gold"}}}
+	gold := schedulingv1alpha1.ServiceSelector{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "gold"}}}
+	silver := schedulingv1alpha1.ServiceSelector{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "silver"}}}
+	shop := schedulingv1alpha1.ServiceSelector{Namespaces: []string{"shop"}}
+	catalog := schedulingv1alpha1.ServiceSelector{Namespaces: []string{"catalog"}}
+	invalid := schedulingv1alpha1.ServiceSelector{Selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tier", Operator: "Near"}}}}
+
+	tests := []struct {
+		name      string
+		schedules []schedulingv1alpha1.TrafficSchedule
+		want      string
+		shadowed  int
+		errs      int
+	}{
+		{name: "none", schedules: []schedulingv1alpha1.TrafficSchedule{boundSchedule("ops", "silver", 0, silver), boundSchedule("ops", "catalog", 0, catalog)}},
+		{name: "cluster default", schedules: []schedulingv1alpha1.TrafficSchedule{boundSchedule("ops", "default", 0, schedulingv1alpha1.ServiceSelector{})},
+			want: "ops/default"},
+		{name: "label selector beats the namespace", shadowed: 2, schedules: []schedulingv1alpha1.TrafficSchedule{
+			boundSchedule("ops", "default", 0, schedulingv1alpha1.ServiceSelector{}),
+			boundSchedule("ops", "shop", 0, shop),
+			boundSchedule("ops", "gold", time.Hour, gold),
+		}, want: "ops/gold"},
+		{name: "own namespace counts as the namespace scope", shadowed: 1, schedules: []schedulingv1alpha1.TrafficSchedule{
+			boundSchedule("ops", "default", 0, schedulingv1alpha1.ServiceSelector{}),
+			boundSchedule("shop", "local", time.Hour, schedulingv1alpha1.ServiceSelector{}),
+		}, want: "shop/local"},
+		{name: "same scope prefers the Service namespace", shadowed: 1, schedules: []schedulingv1alpha1.TrafficSchedule{
+			boundSchedule("ops", "gold", 0, gold),
+			boundSchedule("shop", "gold", time.Hour, gold),
+		}, want: "shop/gold"},
+		{name: "then the oldest", shadowed: 1, schedules: []schedulingv1alpha1.TrafficSchedule{
+			boundSchedule("ops", "new", time.Hour, gold),
+			boundSchedule("ops", "old", 0, gold),
+		}, want: "ops/old"},
+		{name: "then the name", shadowed: 1, schedules: []schedulingv1alpha1.TrafficSchedule{
+			boundSchedule("ops", "b", 0, gold),
+			boundSchedule("ops", "a", 0, gold),
+		}, want: "ops/a"},
+		{name: "priority beats the scope", shadowed: 2, schedules: []schedulingv1alpha1.TrafficSchedule{
+			boundSchedule("ops", "gold", 0, gold),
+			boundSchedule("shop", "local", 0, schedulingv1alpha1.ServiceSelector{}),
+			withPriority(boundSchedule("ops", "default", time.Hour, schedulingv1alpha1.ServiceSelector{}), 10),
+		}, want: "ops/default"},
+		{name: "negative priority yields to the default", shadowed: 1, schedules: []schedulingv1alpha1.TrafficSchedule{
+			withPriority(boundSchedule("ops", "gold", 0, gold), -1),
+			boundSchedule("ops", "default", time.Hour, schedulingv1alpha1.ServiceSelector{}),
+		}, want: "ops/default"},
+		{name: "same priority falls back to the scope", shadowed: 1, schedules: []schedulingv1alpha1.TrafficSchedule{
+			withPriority(boundSchedule("ops", "shop", 0, shop), 5),
+			withPriority(boundSchedule("ops", "gold", time.Hour, gold), 5),
+		}, want: "ops/gold"},
+		{name: "invalid selectors are skipped", errs: 1, schedules: []schedulingv1alpha1.TrafficSchedule{
+			boundSchedule("ops", "invalid", 0, invalid),
+			boundSchedule("ops", "default", time.Hour, schedulingv1alpha1.ServiceSelector{}),
+		}, want: "ops/default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, shadowed, errs := bindSchedule(svc, tt.schedules)
+			got := ""
+			if ts != nil {
+				got = ts.Namespace + "/" + ts.Name
+			}
+			if got != tt.want || len(shadowed) != tt.shadowed || len(errs) != tt.errs {
+				t.Errorf("got %q shadowing %v with errors %v, want %q shadowing %d with %d errors", got, shadowed, errs, tt.want, tt.shadowed, tt.errs)
+			}
+		})
+	}
+}
+
+func TestScheduleScope(t *testing.T) {
+	tests := []struct {
+		ts   schedulingv1alpha1.TrafficSchedule
+		want string
+	}{
+		{ts: boundSchedule("ops", "gold", 0, schedulingv1alpha1.ServiceSelector{Selector: &metav1.LabelSelector{}}), want: scopeService},
+		{ts: boundSchedule("ops", "shop", 0, schedulingv1alpha1.ServiceSelector{Namespaces: []string{"shop"}}), want: scopeNamespace},
+		{ts: boundSchedule("shop", "local", 0, schedulingv1alpha1.ServiceSelector{}), want: scopeNamespace},
+		{ts: boundSchedule("ops", "default", 0, schedulingv1alpha1.ServiceSelector{}), want: scopeCluster},
+	}
+	for _, tt := range tests {
+		if got := scheduleScope(&tt.ts, "shop"); got != tt.want {
+			t.Errorf("%s/%s: got scope %s, want %s", tt.ts.Namespace, tt.ts.Name, got, tt.want)
+		}
+	}
+}
+
+func TestResolveSchedule(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := schedulingv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout"}}
+	fallback := boundSchedule("ops", "default", 0, schedulingv1alpha1.ServiceSelector{})
+	urgent := withPriority(boundSchedule("ops", "urgent", time.Hour, schedulingv1alpha1.ServiceSelector{Namespaces: []string{"shop"}}), 100)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(svc, &fallback, &urgent).WithStatusSubresource(svc).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme, Recorder: recorder}
+	ctx := context.Background()
+
+	for range 2 {
+		ts, err := r.resolveSchedule(ctx, svc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ts == nil || ts.Name != "urgent" {
+			t.Fatalf("got schedule %v, want ops/urgent", ts)
+		}
+	}
+	var got corev1.Service
+	if err := c.Get(ctx, client.ObjectKeyFromObject(svc), &got); err != nil {
+		t.Fatal(err)
+	}
+	cond := meta.FindStatusCondition(got.Status.Conditions, conditionScheduleBound)
+	if cond == nil || cond.Reason != "Conflict" || !strings.Contains(cond.Message, "(scope Namespace, priority 100); also matched by ops/default") {
+		t.Errorf("got condition %v, want the scope, priority and shadowed schedule", cond)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("got %d events, want one on the binding", len(recorder.Events))
+	}
+
+	if err := c.Delete(ctx, &fallback); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete(ctx, &urgent); err != nil {
+		t.Fatal(err)
+	}
+	if ts, err := r.resolveSchedule(ctx, svc); ts != nil || err != nil {
+		t.Fatalf("got %v, %v, want no schedule", ts, err)
+	}
+	if cond := meta.FindStatusCondition(svc.Status.Conditions, conditionScheduleBound); cond.Status != metav1.ConditionFalse || cond.Reason != "NoMatchingSchedule" {
+		t.Errorf("got condition %v, want no matching schedule", cond)
+	}
+}
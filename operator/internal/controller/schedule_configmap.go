@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+// scheduleConfigMapName is the per-namespace ConfigMap mirroring the active schedule
+// of every routed service, keyed as "<service>.json". Applications can mount or
+// watch it to adapt in-process behaviour in sync with the routing decisions.
+const scheduleConfigMapName = "carbonrouter-schedule"
+
+// publishedSchedule is the application-facing view of a TrafficSchedule status.
+type publishedSchedule struct {
+	Schedule           string            `json:"schedule"`
+	Weights            map[string]int    `json:"weights"`
+	Concurrency        map[string]string `json:"concurrency,omitempty"`
+	ActivePolicy       string            `json:"activePolicy,omitempty"`
+	CarbonIndex        string            `json:"carbonIndex,omitempty"`
+	CarbonForecastNow  string            `json:"carbonForecastNow,omitempty"`
+	CarbonForecastNext string            `json:"carbonForecastNext,omitempty"`
+	ProcessingThrottle string            `json:"processingThrottle,omitempty"`
+	ValidUntil         string            `json:"validUntil,omitempty"`
+}
+
+func buildPublishedSchedule(ts *schedulingv1alpha1.TrafficSchedule, precisions []int) publishedSchedule {
+	active := make(map[int]struct{}, len(precisions))
+	for _, precision := range precisions {
+		active[precision] = struct{}{}
+	}
+	weights := make(map[string]int, len(precisions))
+	var concurrency map[string]string
+	for _, flavour := range ts.Status.Flavours {
+		if _, ok := active[flavour.Precision]; !ok {
+			continue
+		}
+		weights[precisionSubsetName(flavour.Precision)] = flavour.Weight
+		if flavour.Concurrency != "" {
+			if concurrency == nil {
+				concurrency = map[string]string{}
+			}
+			concurrency[precisionSubsetName(flavour.Precision)] = flavour.Concurrency
+		}
+	}
+	out := publishedSchedule{
+		Schedule:           ts.Namespace + "/" + ts.Name,
+		Weights:            weights,
+		Concurrency:        concurrency,
+		ActivePolicy:       ts.Status.ActivePolicy,
+		CarbonIndex:        ts.Status.CarbonIndex,
+		CarbonForecastNow:  ts.Status.CarbonForecastNow,
+		CarbonForecastNext: ts.Status.CarbonForecastNext,
+		ProcessingThrottle: ts.Status.ProcessingThrottle,
+	}
+	if !ts.Status.ValidUntil.IsZero() {
+		out.ValidUntil = ts.Status.ValidUntil.UTC().Format(time.RFC3339)
+	}
+	return out
+}
+
+// ensureScheduleConfigMap publishes the service's schedule into the namespace ConfigMap.
+// Every routed service adds itself as a (non-controller) owner so the ConfigMap is
+// garbage-collected once the last service is gone.
+func (r *FlavourRouterReconciler) ensureScheduleConfigMap(ctx context.Context, svc *corev1.Service, ts *schedulingv1alpha1.TrafficSchedule, precisions []int) error {
+	log := ctrl.LoggerFrom(ctx).WithName("[FlavourRouter]")
+	raw, err := json.Marshal(buildPublishedSchedule(ts, precisions))
+	if err != nil {
+		return err
+	}
+	key := svc.Name + ".json"
+	value := string(raw)
+
+	applied := false
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var cm corev1.ConfigMap
+		err := r.Get(ctx, client.ObjectKey{Namespace: svc.Namespace, Name: scheduleConfigMapName}, &cm)
+		if apierrors.IsNotFound(err) {
+			cm = corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      scheduleConfigMapName,
+					Namespace: svc.Namespace,
+					Labels: map[string]string{
+						"app.kubernetes.io/part-of":    "carbonrouter",
+						"app.kubernetes.io/managed-by": "carbonrouter-operator",
+					},
+				},
+				Data: map[string]string{key: value},
+			}
+			if err := controllerutil.SetOwnerReference(svc, &cm, r.Scheme); err != nil {
+				return err
+			}
+			log.Info("Creating schedule ConfigMap", "ConfigMap", scheduleConfigMapName)
+			applied = true
+			return r.Create(ctx, &cm)
+		}
+		if err != nil {
+			return err
+		}
+
+		original := cm.DeepCopy()
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[key] = value
+		if err := controllerutil.SetOwnerReference(svc, &cm, r.Scheme); err != nil {
+			return err
+		}
+		if cm.Data[key] == original.Data[key] && len(cm.OwnerReferences) == len(original.OwnerReferences) {
+			return nil
+		}
+		applied = true
+		return r.Update(ctx, &cm)
+	})
+	if err != nil {
+		return err
+	}
+	r.track(svc, "ConfigMap", svc.Namespace, scheduleConfigMapName, value, applied)
+	return nil
+}
+
+// removeFromScheduleConfigMap drops the service entry and owner reference, deleting
+// the ConfigMap when no routed service is left in the namespace.
+func (r *FlavourRouterReconciler) removeFromScheduleConfigMap(ctx context.Context, svc *corev1.Service) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var cm corev1.ConfigMap
+		if err := r.Get(ctx, client.ObjectKey{Namespace: svc.Namespace, Name: scheduleConfigMapName}, &cm); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		delete(cm.Data, svc.Name+".json")
+		if len(cm.Data) == 0 {
+			return client.IgnoreNotFound(r.Delete(ctx, &cm))
+		}
+		if owned, err := controllerutil.HasOwnerReference(cm.OwnerReferences, svc, r.Scheme); err != nil {
+			return err
+		} else if owned {
+			if err := controllerutil.RemoveOwnerReference(svc, &cm, r.Scheme); err != nil {
+				return err
+			}
+		}
+		return r.Update(ctx, &cm)
+	})
+}
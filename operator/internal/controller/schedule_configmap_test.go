@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestBuildPublishedSchedule(t *testing.T) {
+	validUntil := time.Date(2025, 6, 1, 14, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	ts := &schedulingv1alpha1.TrafficSchedule{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "green"},
+		Status: schedulingv1alpha1.TrafficScheduleStatus{
+			ActivePolicy: "credit-greedy",
+			ValidUntil:   metav1.NewTime(validUntil),
+			CarbonIndex:  "low",
+			Flavours: []schedulingv1alpha1.FlavourDecision{
+				{Precision: 100, Weight: 40},
+				{Precision: 50, Weight: 60, Concurrency: "0.5"},
+				{Precision: 30, Weight: 0, Concurrency: "0.2"},
+			},
+		},
+	}
+	tests := []struct {
+		name       string
+		ts         *schedulingv1alpha1.TrafficSchedule
+		precisions []int
+		want       publishedSchedule
+	}{
+		{
+			name:       "only the deployed precisions",
+			ts:         ts,
+			precisions: []int{100, 50},
+			want: publishedSchedule{
+				Schedule:     "shop/green",
+				Weights:      map[string]int{"precision-100": 40, "precision-50": 60},
+				Concurrency:  map[string]string{"precision-50": "0.5"},
+				ActivePolicy: "credit-greedy",
+				CarbonIndex:  "low",
+				ValidUntil:   "2025-06-01T12:00:00Z",
+			},
+		},
+		{
+			name:       "no decision yet",
+			ts:         &schedulingv1alpha1.TrafficSchedule{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "green"}},
+			precisions: []int{100},
+			want:       publishedSchedule{Schedule: "shop/green", Weights: map[string]int{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildPublishedSchedule(tt.ts, tt.precisions); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleConfigMapFollowsTheServices(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	checkout := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout", UID: types.UID("checkout")}}
+	cart := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "cart", UID: types.UID("cart")}}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(checkout, cart).Build()
+	r := &FlavourRouterReconciler{Client: c, Scheme: scheme}
+	ts := &schedulingv1alpha1.TrafficSchedule{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "green"},
+		Status:     schedulingv1alpha1.TrafficScheduleStatus{Flavours: []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 100}}},
+	}
+	ctx := context.Background()
+	key := client.ObjectKey{Namespace: "shop", Name: scheduleConfigMapName}
+	read := func() (*corev1.ConfigMap, error) {
+		var cm corev1.ConfigMap
+		err := c.Get(ctx, key, &cm)
+		return &cm, err
+	}
+
+	for _, svc := range []*corev1.Service{checkout, cart} {
+		if err := r.ensureScheduleConfigMap(ctx, svc, ts, []int{100}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cm, err := read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cm.Data) != 2 || len(cm.OwnerReferences) != 2 {
+		t.Fatalf("got keys %v and %d owners, want one of each per service", cm.Data, len(cm.OwnerReferences))
+	}
+
+	if err := r.removeFromScheduleConfigMap(ctx, checkout); err != nil {
+		t.Fatal(err)
+	}
+	if cm, err = read(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cm.Data["checkout.json"]; ok || len(cm.OwnerReferences) != 1 || cm.OwnerReferences[0].Name != "cart" {
+		t.Errorf("removed service still published: keys %v, owners %+v", cm.Data, cm.OwnerReferences)
+	}
+
+	if err := r.removeFromScheduleConfigMap(ctx, cart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := read(); !apierrors.IsNotFound(err) {
+		t.Errorf("ConfigMap kept after the last service: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+// The scheduling state of every TrafficSchedule, as published in its status,
+// so it can be graphed and alerted on without scraping the resources.
+var (
+	creditBalanceGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "carbonrouter_credit_balance",
+		Help: "Credit balance of the scheduler; negative values are quality debt.",
+	}, []string{"namespace", "schedule"})
+	creditVelocityGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "carbonrouter_credit_velocity",
+		Help: "Average rate of change of the credit balance.",
+	}, []string{"namespace", "schedule"})
+	carbonForecastGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "carbonrouter_carbon_forecast_gco2",
+		Help: "Carbon intensity forecast in gCO2/kWh for the current (now) and next slot.",
+	}, []string{"namespace", "schedule", "horizon"})
+	flavourWeightGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "carbonrouter_flavour_weight",
+		Help: "Percentage of traffic routed to each precision.",
+	}, []string{"namespace", "schedule", "precision"})
+	flavourConcurrencyGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "carbonrouter_flavour_concurrency",
+		Help: "Share of its worker pool the consumers run for each precision.",
+	}, []string{"namespace", "schedule", "precision"})
+	replicaCeilingGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "carbonrouter_replica_ceiling",
+		Help: "Replica ceiling applied to each component while processing is throttled.",
+	}, []string{"namespace", "schedule", "component"})
+	processingThrottleGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "carbonrouter_processing_throttle",
+		Help: "Throttle factor applied to downstream autoscaling, 1 when unthrottled.",
+	}, []string{"namespace", "schedule"})
+)
+
+var scheduleGauges = []*prometheus.GaugeVec{
+	creditBalanceGauge, creditVelocityGauge, carbonForecastGauge,
+	flavourWeightGauge, flavourConcurrencyGauge, replicaCeilingGauge, processingThrottleGauge,
+}
+
+func init() {
+	for _, gauge := range scheduleGauges {
+		metrics.Registry.MustRegister(gauge)
+	}
+}
+
+// recordScheduleMetrics exports the status of ts. Series of flavours and
+// components the status no longer holds are dropped, and so are values the
+// status leaves empty or that do not parse.
+func recordScheduleMetrics(ts *schedulingv1alpha1.TrafficSchedule) {
+	forgetScheduleMetrics(types.NamespacedName{Namespace: ts.Namespace, Name: ts.Name})
+	status := ts.Status
+	setParsed(creditBalanceGauge, status.CreditBalance, ts.Namespace, ts.Name)
+	setParsed(creditVelocityGauge, status.CreditVelocity, ts.Namespace, ts.Name)
+	setParsed(processingThrottleGauge, status.ProcessingThrottle, ts.Namespace, ts.Name)
+	setParsed(carbonForecastGauge, status.CarbonForecastNow, ts.Namespace, ts.Name, "now")
+	setParsed(carbonForecastGauge, status.CarbonForecastNext, ts.Namespace, ts.Name, "next")
+	for _, flavour := range status.Flavours {
+		flavourWeightGauge.WithLabelValues(ts.Namespace, ts.Name, strconv.Itoa(flavour.Precision)).Set(float64(flavour.Weight))
+		setParsed(flavourConcurrencyGauge, flavour.Concurrency, ts.Namespace, ts.Name, strconv.Itoa(flavour.Precision))
+	}
+	for component, ceiling := range status.EffectiveReplicaCeilings {
+		replicaCeilingGauge.WithLabelValues(ts.Namespace, ts.Name, component).Set(float64(ceiling))
+	}
+}
+
+// setParsed sets the series of labels to the number in value, if any.
+func setParsed(gauge *prometheus.GaugeVec, value string, labels ...string) {
+	if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+		gauge.WithLabelValues(labels...).Set(parsed)
+	}
+}
+
+// forgetScheduleMetrics drops every series of the schedule key.
+func forgetScheduleMetrics(key types.NamespacedName) {
+	for _, gauge := range scheduleGauges {
+		gauge.DeletePartialMatch(prometheus.Labels{"namespace": key.Namespace, "schedule": key.Name})
+	}
+}
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestRecordScheduleMetrics(t *testing.T) {
+	ts := &schedulingv1alpha1.TrafficSchedule{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "metrics", Name: "default"},
+		Status: schedulingv1alpha1.TrafficScheduleStatus{
+			CreditBalance:      "-0.25",
+			CreditVelocity:     "n/a",
+			ProcessingThrottle: " 0.5 ",
+			CarbonForecastNow:  "180",
+			Flavours: []schedulingv1alpha1.FlavourDecision{
+				{Precision: 100, Weight: 30, Concurrency: "1"},
+				{Precision: 50, Weight: 70},
+			},
+			EffectiveReplicaCeilings: map[string]int32{"consumer": 2},
+		},
+	}
+	defer forgetScheduleMetrics(types.NamespacedName{Namespace: "metrics", Name: "default"})
+	recordScheduleMetrics(ts)
+
+	values := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{name: "credit balance", got: testutil.ToFloat64(creditBalanceGauge.WithLabelValues("metrics", "default")), want: -0.25},
+		{name: "throttle", got: testutil.ToFloat64(processingThrottleGauge.WithLabelValues("metrics", "default")), want: 0.5},
+		{name: "forecast now", got: testutil.ToFloat64(carbonForecastGauge.WithLabelValues("metrics", "default", "now")), want: 180},
+		{name: "weight 50", got: testutil.ToFloat64(flavourWeightGauge.WithLabelValues("metrics", "default", "50")), want: 70},
+		{name: "concurrency 100", got: testutil.ToFloat64(flavourConcurrencyGauge.WithLabelValues("metrics", "default", "100")), want: 1},
+		{name: "ceiling", got: testutil.ToFloat64(replicaCeilingGauge.WithLabelValues("metrics", "default", "consumer")), want: 2},
+	}
+	for _, v := range values {
+		if v.got != v.want {
+			t.Errorf("%s: got %v, want %v", v.name, v.got, v.want)
+		}
+	}
+	// Empty and unparsable values are left out
+	counts := []struct {
+		name  string
+		count int
+		want  int
+	}{
+		{name: "velocity", count: testutil.CollectAndCount(creditVelocityGauge), want: 0},
+		{name: "forecast", count: testutil.CollectAndCount(carbonForecastGauge), want: 1},
+		{name: "concurrency", count: testutil.CollectAndCount(flavourConcurrencyGauge), want: 1},
+	}
+	for _, c := range counts {
+		if c.count != c.want {
+			t.Errorf("%s: got %d series, want %d", c.name, c.count, c.want)
+		}
+	}
+
+	// Flavours the status dropped lose their series
+	ts.Status.Flavours = ts.Status.Flavours[:1]
+	ts.Status.EffectiveReplicaCeilings = nil
+	recordScheduleMetrics(ts)
+	if got := testutil.CollectAndCount(flavourWeightGauge); got != 1 {
+		t.Errorf("got %d weight series, want the remaining flavour only", got)
+	}
+	if got := testutil.CollectAndCount(replicaCeilingGauge); got != 0 {
+		t.Errorf("got %d ceiling series, want none", got)
+	}
+
+	forgetScheduleMetrics(types.NamespacedName{Namespace: "metrics", Name: "default"})
+	for _, gauge := range scheduleGauges {
+		if got := testutil.CollectAndCount(gauge); got != 0 {
+			t.Errorf("got %d series after forgetting the schedule", got)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/engine"
+)
+
+const (
+	// ScheduleReceiverPattern is the operator API route the decision engine
+	// pushes schedules to.
+	ScheduleReceiverPattern = "POST /schedules/{namespace}/{name}"
+	// maxPushedScheduleBytes bounds the body of a pushed schedule.
+	maxPushedScheduleBytes = 1 << 20
+	// maxPushedSchedules bounds the schedules waiting to be applied.
+	maxPushedSchedules = 1024
+)
+
+// ScheduleReceiver accepts the schedules the decision engine pushes and
+// enqueues their TrafficSchedule, so a new decision is applied right away
+// instead of at the next poll. Polling goes on as a safety net for lost pushes.
+type ScheduleReceiver struct {
+	token  []byte
+	reader client.Reader
+	events chan event.GenericEvent
+
+	mu     sync.Mutex
+	pushed map[types.NamespacedName]engine.Schedule
+}
+
+// NewScheduleReceiver returns a ScheduleReceiver taking the schedules of the
+// TrafficSchedules reader finds, pushed with token as a bearer token.
+func NewScheduleReceiver(token string, reader client.Reader) (*ScheduleReceiver, error) {
+	if token == "" {
+		return nil, errors.New("the schedule receiver needs a token")
+	}
+	return &ScheduleReceiver{
+		token:  []byte(token),
+		reader: reader,
+		events: make(chan event.GenericEvent, 64),
+		pushed: map[types.NamespacedName]engine.Schedule{},
+	}, nil
+}
+
+// ServeHTTP stores a schedule pushed for {namespace}/{name} and enqueues it.
+// Only the leader reconciles, so it must be served behind
+// apiserver.LeaderOnly.
+func (s *ScheduleReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	token, _ := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if len(s.token) == 0 || subtle.ConstantTimeCompare([]byte(token), s.token) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	key := types.NamespacedName{Namespace: req.PathValue("namespace"), Name: req.PathValue("name")}
+	var ts schedulingv1alpha1.TrafficSchedule
+	if err := s.reader.Get(req.Context(), key, &ts); err != nil {
+		if apierrors.IsNotFound(err) {
+			http.Error(w, "unknown TrafficSchedule", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "cannot read the TrafficSchedule", http.StatusServiceUnavailable)
+		return
+	}
+	var schedule engine.Schedule
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxPushedScheduleBytes)).Decode(&schedule); err != nil {
+		http.Error(w, "invalid schedule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if schedule.ValidUntil == "" || len(schedule.Flavours) == 0 {
+		http.Error(w, "incomplete schedule", http.StatusBadRequest)
+		return
+	}
+	if !s.store(key, schedule, time.Now()) {
+		http.Error(w, "too many pending schedules", http.StatusServiceUnavailable)
+		return
+	}
+
+	obj := &schedulingv1alpha1.TrafficSchedule{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}}
+	select {
+	case s.events <- event.GenericEvent{Object: obj}:
+	default:
+		// The engine pushes again, rather than waiting for the next poll
+		ctrl.Log.WithName("[ScheduleReceiver]").Info("Schedule push queue is full, asking the engine to retry", "schedule", key)
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "too many pending schedules", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// store keeps schedule until it is taken for key, dropping the expired
+// schedules to stay within maxPushedSchedules. It reports false when the
+// pending schedules are all still valid.
+func (s *ScheduleReceiver) store(key types.NamespacedName, schedule engine.Schedule, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pushed[key]; !ok && len(s.pushed) >= maxPushedSchedules {
+		for pending, pushed := range s.pushed {
+			if !scheduleValid(pushed, now) {
+				delete(s.pushed, pending)
+			}
+		}
+		if len(s.pushed) >= maxPushedSchedules {
+			return false
+		}
+	}
+	s.pushed[key] = schedule
+	return true
+}
+
+// scheduleValid reports whether schedule has not expired at now.
+func scheduleValid(schedule engine.Schedule, now time.Time) bool {
+	validUntil, err := time.Parse(time.RFC3339, schedule.ValidUntil)
+	return err == nil && now.Before(validUntil)
+}
+
+// take returns and forgets the schedule last pushed for key, unless it has
+// already expired.
+func (s *ScheduleReceiver) take(key types.NamespacedName) (engine.Schedule, bool) {
+	if s == nil {
+		return engine.Schedule{}, false
+	}
+	s.mu.Lock()
+	schedule, ok := s.pushed[key]
+	delete(s.pushed, key)
+	s.mu.Unlock()
+	if !ok {
+		return engine.Schedule{}, false
+	}
+	return schedule, scheduleValid(schedule, time.Now())
+}
+
+// Forget drops the schedule pushed for key.
+func (s *ScheduleReceiver) Forget(key types.NamespacedName) {
+	s.take(key)
+}
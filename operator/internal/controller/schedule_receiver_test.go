@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/engine"
+)
+
+func newTestScheduleReceiver(t *testing.T) *ScheduleReceiver {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := schedulingv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	reader := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&schedulingv1alpha1.TrafficSchedule{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "green"}},
+	).Build()
+	receiver, err := NewScheduleReceiver("secret", reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return receiver
+}
+
+func TestNewScheduleReceiverNeedsAToken(t *testing.T) {
+	if _, err := NewScheduleReceiver("", nil); err == nil {
+		t.Error("receiver started without a token")
+	}
+}
+
+func TestScheduleReceiverServeHTTP(t *testing.T) {
+	validUntil := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	schedule := fmt.Sprintf(`{"validUntil":%q,"flavours":[{"precision":100,"weight":100}]}`, validUntil)
+	tests := []struct {
+		name     string
+		token    string
+		schedule string
+		body     string
+		status   int
+	}{
+		{name: "no token", schedule: "green", body: schedule, status: http.StatusUnauthorized},
+		{name: "wrong token", token: "guess", schedule: "green", body: schedule, status: http.StatusUnauthorized},
+		{name: "unknown schedule", token: "secret", schedule: "blue", body: schedule, status: http.StatusNotFound},
+		{name: "incomplete schedule", token: "secret", schedule: "green", body: `{"flavours":[]}`, status: http.StatusBadRequest},
+		{name: "accepted", token: "secret", schedule: "green", body: schedule, status: http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := newTestScheduleReceiver(t)
+			mux := http.NewServeMux()
+			mux.Handle(ScheduleReceiverPattern, receiver)
+			req := httptest.NewRequest(http.MethodPost, "/schedules/shop/"+tt.schedule, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			_, taken := receiver.take(types.NamespacedName{Namespace: "shop", Name: tt.schedule})
+			if want := tt.status == http.StatusAccepted; taken != want {
+				t.Errorf("schedule stored: got %v, want %v", taken, want)
+			}
+		})
+	}
+}
+
+func TestScheduleReceiverStoreIsBounded(t *testing.T) {
+	now := time.Now()
+	valid := engine.Schedule{ValidUntil: now.Add(time.Hour).UTC().Format(time.RFC3339)}
+	expired := engine.Schedule{ValidUntil: now.Add(-time.Hour).UTC().Format(time.RFC3339)}
+	receiver := newTestScheduleReceiver(t)
+	key := func(i int) types.NamespacedName {
+		return types.NamespacedName{Namespace: "shop", Name: fmt.Sprintf("schedule-%d", i)}
+	}
+
+	for i := range maxPushedSchedules {
+		schedule := valid
+		if i == 0 {
+			schedule = expired
+		}
+		if !receiver.store(key(i), schedule, now) {
+			t.Fatalf("schedule %d refused below the bound", i)
+		}
+	}
+	if !receiver.store(key(maxPushedSchedules), valid, now) {
+		t.Error("expired schedule not dropped to make room")
+	}
+	if !receiver.store(key(1), valid, now) {
+		t.Error("pending schedule not replaced at the bound")
+	}
+	if receiver.store(key(maxPushedSchedules+1), valid, now) {
+		t.Error("schedule stored beyond the bound")
+	}
+	if got := len(receiver.pushed); got != maxPushedSchedules {
+		t.Errorf("got %d pending schedules, want %d", got, maxPushedSchedules)
+	}
+}
+
+func TestScheduleReceiverQueueFull(t *testing.T) {
+	validUntil := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	receiver := newTestScheduleReceiver(t)
+	for len(receiver.events) < cap(receiver.events) {
+		receiver.events <- event.GenericEvent{}
+	}
+	mux := http.NewServeMux()
+	mux.Handle(ScheduleReceiverPattern, receiver)
+	req := httptest.NewRequest(http.MethodPost, "/schedules/shop/green",
+		strings.NewReader(fmt.Sprintf(`{"validUntil":%q,"flavours":[{"precision":100,"weight":100}]}`, validUntil)))
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("got status %d (Retry-After %q), want a 503 asking the engine to retry", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	networkingapi "istio.io/api/networking/v1alpha3"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+// sessionBuckets is the number of session buckets, one per value of the last
+// two hexadecimal digits of a session ID.
+const sessionBuckets = 256
+
+// buildSessionRoutes split the sessions across the precision subsets with the
+// schedule weights. Istio cannot hash a header, so each subset gets a
+// contiguous range of buckets matched by a regex on the end of the session ID,
+// and a session stays on its subset while the weights hold. Ranges follow the
+// precision order, so a weight change only moves the sessions of the buckets
+// that changed hands. Requests without a session ID fall through to the
+// weighted route.
+func buildSessionRoutes(host, header string, cfg schedulingv1alpha1.SessionAffinityConfig, flavours []schedulingv1alpha1.FlavourDecision, precisions []int) ([]*networkingapi.HTTPRoute, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if (cfg.Header == "") == (cfg.Cookie == "") {
+		return nil, invalidConfigError(fmt.Errorf("spec.routing.sessionAffinity needs either a header or a cookie"))
+	}
+	precisionBySubset := make(map[string]int, len(precisions))
+	for _, precision := range precisions {
+		precisionBySubset[precisionSubsetName(precision)] = precision
+	}
+
+	var routes []*networkingapi.HTTPRoute
+	cumulative := 0
+	for _, destination := range buildWeightedRoute(host, flavours, precisions).Route {
+		lo := cumulative * sessionBuckets / 100
+		cumulative += int(destination.Weight)
+		hi := cumulative * sessionBuckets / 100
+		if lo == hi {
+			continue
+		}
+		match := &networkingapi.HTTPMatchRequest{}
+		suffix := sessionBucketRegex(lo, hi)
+		if cfg.Header != "" {
+			match.Headers = map[string]*networkingapi.StringMatch{
+				strings.ToLower(cfg.Header): {MatchType: &networkingapi.StringMatch_Regex{Regex: ".*" + suffix}},
+			}
+		} else {
+			cookie := fmt.Sprintf(`(.*;\s*)?%s=[^;]*%s(;.*)?`, regexp.QuoteMeta(cfg.Cookie), suffix)
+			match.Headers = map[string]*networkingapi.StringMatch{
+				"cookie": {MatchType: &networkingapi.StringMatch_Regex{Regex: cookie}},
+			}
+		}
+		subset := destination.Destination.Subset
+		routes = append(routes, &networkingapi.HTTPRoute{
+			Name:  "carbonrouter-session-" + subset,
+			Match: []*networkingapi.HTTPMatchRequest{match},
+			Route: []*networkingapi.HTTPRouteDestination{{
+				Destination: destination.Destination,
+				Weight:      100,
+				Headers: &networkingapi.Headers{
+					Request: &networkingapi.Headers_HeaderOperations{
+						Set: map[string]string{header: precisionHeaderValue(precisionBySubset[subset])},
+					},
+				},
+			}},
+		})
+	}
+	return routes, nil
+}
+
+// sessionBucketRegex matches the session IDs ending in two hexadecimal digits
+// between lo, included, and hi, excluded, in either case.
+func sessionBucketRegex(lo, hi int) string {
+	var alternatives []string
+	// A partial first and last high digit, and the whole ones in between
+	if first := lo / 16; lo%16 != 0 || hi-lo < 16 {
+		alternatives = append(alternatives, hexDigits(first, first+1)+hexDigits(lo%16, min(hi-first*16, 16)))
+		lo = (first + 1) * 16
+	}
+	if whole := hi / 16; whole > lo/16 {
+		alternatives = append(alternatives, hexDigits(lo/16, whole)+hexDigits(0, 16))
+		lo = whole * 16
+	}
+	if lo < hi {
+		alternatives = append(alternatives, hexDigits(lo/16, lo/16+1)+hexDigits(0, hi%16))
+	}
+	return "(" + strings.Join(alternatives, "|") + ")"
+}
+
+// hexDigits matches the hexadecimal digits from lo, included, to hi, excluded.
+func hexDigits(lo, hi int) string {
+	span := func(from, to int, upper bool) string {
+		first, last := fmt.Sprintf("%x", from), fmt.Sprintf("%x", to-1)
+		if upper {
+			first, last = strings.ToUpper(first), strings.ToUpper(last)
+		}
+		if from == to-1 {
+			return first
+		}
+		return first + "-" + last
+	}
+	var class string
+	if lo < 10 {
+		class += span(lo, min(hi, 10), false)
+	}
+	if hi > 10 {
+		class += span(max(lo, 10), hi, false) + span(max(lo, 10), hi, true)
+	}
+	if lo == hi-1 && lo < 10 {
+		return class
+	}
+	return "[" + class + "]"
+}
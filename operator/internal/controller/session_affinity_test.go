@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+func TestSessionBucketRegex(t *testing.T) {
+	tests := []struct {
+		lo, hi int
+		want   string
+	}{
+		{lo: 0, hi: 1, want: "(00)"},
+		{lo: 0, hi: 16, want: "(0[0-9a-fA-F])"},
+		{lo: 0, hi: 256, want: "([0-9a-fA-F][0-9a-fA-F])"},
+		{lo: 10, hi: 12, want: "(0[a-bA-B])"},
+		{lo: 8, hi: 40, want: "(0[8-9a-fA-F]|1[0-9a-fA-F]|2[0-7])"},
+	}
+	for _, tt := range tests {
+		if got := sessionBucketRegex(tt.lo, tt.hi); got != tt.want {
+			t.Errorf("[%d, %d): got %s, want %s", tt.lo, tt.hi, got, tt.want)
+		}
+	}
+}
+
+func TestSessionBucketRegexMatchesItsBuckets(t *testing.T) {
+	for lo := 0; lo < sessionBuckets; lo += 7 {
+		for hi := lo + 1; hi <= sessionBuckets; hi += 5 {
+			pattern := regexp.MustCompile("^(?:.*" + sessionBucketRegex(lo, hi) + ")$")
+			for bucket := range sessionBuckets {
+				id := fmt.Sprintf("session-%02x", bucket)
+				want := bucket >= lo && bucket < hi
+				for _, session := range []string{id, strings.ToUpper(id)} {
+					if got := pattern.MatchString(session); got != want {
+						t.Fatalf("[%d, %d): %s matched %v, want %v (%s)", lo, hi, session, got, want, pattern)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestBuildSessionRoutes(t *testing.T) {
+	host := "checkout.shop.svc.cluster.local"
+	flavours := []schedulingv1alpha1.FlavourDecision{{Precision: 100, Weight: 25}, {Precision: 50, Weight: 75}, {Precision: 30}}
+	precisions := []int{100, 50, 30}
+
+	if routes, err := buildSessionRoutes(host, "x-carbonrouter", schedulingv1alpha1.SessionAffinityConfig{}, flavours, precisions); routes != nil || err != nil {
+		t.Errorf("disabled: got %v, %v, want nothing", routes, err)
+	}
+	for _, cfg := range []schedulingv1alpha1.SessionAffinityConfig{
+		{Enabled: true},
+		{Enabled: true, Header: "x-session-id", Cookie: "sid"},
+	} {
+		if _, err := buildSessionRoutes(host, "x-carbonrouter", cfg, flavours, precisions); classify(err) != failureInvalidConfig {
+			t.Errorf("%+v: got %v, want an invalid configuration", cfg, err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		cfg     schedulingv1alpha1.SessionAffinityConfig
+		matched string
+		// request values of the matched header landing on precision-100 and
+		// on precision-50
+		full, reduced string
+	}{
+		{name: "header", cfg: schedulingv1alpha1.SessionAffinityConfig{Enabled: true, Header: "X-Session-ID"}, matched: "x-session-id",
+			full: "7f2c3F", reduced: "7f2c40"},
+		{name: "cookie", cfg: schedulingv1alpha1.SessionAffinityConfig{Enabled: true, Cookie: "sid"}, matched: "cookie",
+			full: "theme=dark; sid=7f2c00; lang=en", reduced: "sid=7f2cff"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes, err := buildSessionRoutes(host, "x-carbonrouter", tt.cfg, flavours, precisions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// precision-30 has no weight and so no buckets
+			if len(routes) != 2 {
+				t.Fatalf("got %d routes, want one per weighted precision", len(routes))
+			}
+			for _, route := range routes {
+				destination := route.Route[0]
+				subset := destination.Destination.Subset
+				if route.Name != "carbonrouter-session-"+subset || destination.Weight != 100 {
+					t.Errorf("got route %q sending %d%% to %s, want all of it", route.Name, destination.Weight, subset)
+				}
+				if got := destination.Headers.Request.Set["x-carbonrouter"]; got != strings.TrimPrefix(subset, "precision-") {
+					t.Errorf("%s: got precision header %q", subset, got)
+				}
+				pattern := regexp.MustCompile("^(?:" + route.Match[0].Headers[tt.matched].GetRegex() + ")$")
+				if got := pattern.MatchString(tt.full); got != (subset == "precision-100") {
+					t.Errorf("%s: %q matched %v", subset, tt.full, got)
+				}
+				if got := pattern.MatchString(tt.reduced); got != (subset == "precision-50") {
+					t.Errorf("%s: %q matched %v", subset, tt.reduced, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	sloGuardRelaxThrottle       = "relax-throttle"
+	sloGuardBoostPrecision      = "boost-precision"
+	defaultSLOBurnRateThreshold = 14.4
+	defaultSLOWindowMinutes     = 5
+	defaultSLOHoldMinutes       = 10
+	defaultSLOBoostPercent      = 50
+	// sloGuardInterval is how often the burn rates are measured at most.
+	sloGuardInterval = 30 * time.Second
+	// The guard reads the requests as reported by the clients of a Service,
+	// so those buffered by the router count with their delay.
+	sloGuardTelemetryReporter     = "source"
+	sloGuardRequestsMetric        = "istio_requests_total"
+	sloGuardRequestDurationMetric = "istio_request_duration_milliseconds"
+)
+
+// SLOGuard measures how fast the routed Services burn the error budget of
+// their objectives, from the Istio telemetry scraped by Prometheus.
+type SLOGuard struct {
+	prometheusURL string
+}
+
+// NewSLOGuard returns a guard querying the Prometheus HTTP API at
+// prometheusURL.
+func NewSLOGuard(prometheusURL string) *SLOGuard {
+	return &SLOGuard{prometheusURL: strings.TrimSuffix(prometheusURL, "/")}
+}
+
+// sloGuardSettings are the settings of spec.sloGuard with the defaults
+// applied. An objective of zero is not guarded.
+type sloGuardSettings struct {
+	latencyObjective      float64
+	latencyThreshold      int32
+	availabilityObjective float64
+	burnRateThreshold     float64
+	window                time.Duration
+	hold                  time.Duration
+	action                string
+	boostPercent          int
+}
+
+func parseSLOGuard(cfg *schedulingv1alpha1.SLOGuardConfig) (sloGuardSettings, error) {
+	settings := sloGuardSettings{
+		burnRateThreshold: defaultSLOBurnRateThreshold,
+		window:            defaultSLOWindowMinutes * time.Minute,
+		hold:              defaultSLOHoldMinutes * time.Minute,
+		action:            sloGuardRelaxThrottle,
+		boostPercent:      defaultSLOBoostPercent,
+	}
+	objective := func(field, value string) (float64, error) {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 || parsed >= 100 {
+			return 0, invalidConfigError(fmt.Errorf("spec.sloGuard.%s.objective %q must be a percentage leaving an error budget", field, value))
+		}
+		return parsed, nil
+	}
+	var err error
+	if cfg.Latency != nil {
+		if settings.latencyObjective, err = objective("latency", cfg.Latency.Objective); err != nil {
+			return settings, err
+		}
+		settings.latencyThreshold = cfg.Latency.ThresholdMilliseconds
+	}
+	if cfg.Availability != nil {
+		if settings.availabilityObjective, err = objective("availability", cfg.Availability.Objective); err != nil {
+			return settings, err
+		}
+	}
+	if cfg.BurnRateThreshold != nil {
+		settings.burnRateThreshold, err = strconv.ParseFloat(*cfg.BurnRateThreshold, 64)
+		if err != nil || settings.burnRateThreshold <= 0 {
+			return settings, invalidConfigError(fmt.Errorf("spec.sloGuard.burnRateThreshold %q is not a positive number", *cfg.BurnRateThreshold))
+		}
+	}
+	if cfg.WindowMinutes != nil {
+		settings.window = time.Duration(*cfg.WindowMinutes) * time.Minute
+	}
+	if cfg.HoldMinutes != nil {
+		settings.hold = time.Duration(*cfg.HoldMinutes) * time.Minute
+	}
+	if cfg.Action != "" {
+		settings.action = cfg.Action
+	}
+	if cfg.BoostPercent != nil {
+		settings.boostPercent = int(*cfg.BoostPercent)
+	}
+	return settings, nil
+}
+
+// query runs an instant PromQL query returning a single sample. ok is false
+// when it returns none, or not a number, as when the Service had no traffic.
+func (g *SLOGuard) query(ctx context.Context, promql string) (float64, bool, error) {
+	return queryPrometheus(ctx, g.prometheusURL, promql)
+}
+
+// queryPrometheus runs an instant PromQL query against the Prometheus HTTP
+// API at baseURL, as SLOGuard.query.
+func queryPrometheus(ctx context.Context, baseURL, promql string) (float64, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/api/v1/query?"+url.Values{"query": {promql}}.Encode(), nil)
+	if err != nil {
+		return 0, false, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			Result []struct {
+				Value []interface{} `json:"value"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, false, fmt.Errorf("unexpected response (%s): %w", resp.Status, err)
+	}
+	if body.Status != "success" {
+		return 0, false, fmt.Errorf("query failed (%s): %s", resp.Status, body.Error)
+	}
+	if len(body.Data.Result) == 0 || len(body.Data.Result[0].Value) != 2 {
+		return 0, false, nil
+	}
+	sample, _ := body.Data.Result[0].Value[1].(string)
+	value, err := strconv.ParseFloat(sample, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false, nil
+	}
+	return value, true, nil
+}
+
+// burnRates measures the burn rate of each objective of settings over its
+// window, from the requests the clients of svc report. A rate is nil without
+// traffic or when its objective is not guarded.
+func (g *SLOGuard) burnRates(ctx context.Context, svc *corev1.Service, settings sloGuardSettings) (latency, availability *float64, err error) {
+	selector := fmt.Sprintf(`reporter=%q,destination_service_namespace=%q,destination_service_name=%q`, sloGuardTelemetryReporter, svc.Namespace, svc.Name)
+	window := fmt.Sprintf("%dm", int(settings.window.Minutes()))
+	burnRate := func(badRatio string, objective float64) (*float64, error) {
+		ratio, ok, err := g.query(ctx, badRatio)
+		if err != nil || !ok {
+			return nil, err
+		}
+		rate := max(0, ratio) / (1 - objective/100)
+		return &rate, nil
+	}
+	if settings.latencyObjective > 0 {
+		latency, err = burnRate(fmt.Sprintf(`1 - sum(rate(%s_bucket{%s,le="%d"}[%s])) / sum(rate(%s_count{%s}[%s]))`,
+			sloGuardRequestDurationMetric, selector, settings.latencyThreshold, window, sloGuardRequestDurationMetric, selector, window), settings.latencyObjective)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if settings.availabilityObjective > 0 {
+		availability, err = burnRate(fmt.Sprintf(`(sum(rate(%s{%s,response_code=~"5.."}[%s])) or vector(0)) / sum(rate(%s{%s}[%s]))`,
+			sloGuardRequestsMetric, selector, window, sloGuardRequestsMetric, selector, window), settings.availabilityObjective)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return latency, availability, nil
+}
+
+// evaluateSLOGuard measures the burn rates of the objectives of the Service of
+// routed, at most every sloGuardInterval, and decides whether the guard
+// intervenes: when a burn rate reaches the threshold, and until the hold after
+// the last breach lapses. While Prometheus cannot be read the last decision
+// stands. It returns nil when the Service or the operator has no guard.
+func (r *FlavourRouterReconciler) evaluateSLOGuard(ctx context.Context, svc *corev1.Service, routed *schedulingv1alpha1.CarbonRoutedService, now time.Time) (*schedulingv1alpha1.SLOGuardStatus, error) {
+	if r.SLOGuard == nil || routed == nil || routed.Spec.SLOGuard == nil {
+		return nil, nil
+	}
+	settings, err := parseSLOGuard(routed.Spec.SLOGuard)
+	if err != nil {
+		return nil, err
+	}
+	previous := routed.Status.SLOGuard
+	if previous != nil && now.Sub(previous.LastEvaluated.Time) < sloGuardInterval {
+		return previous.DeepCopy(), nil
+	}
+	latency, availability, err := r.SLOGuard.burnRates(ctx, svc, settings)
+	if err != nil {
+		ctrl.LoggerFrom(ctx).WithName("[FlavourRouter]").Error(err, "Failed to measure the SLO burn rates")
+		return previous.DeepCopy(), nil
+	}
+
+	out := &schedulingv1alpha1.SLOGuardStatus{LastEvaluated: metav1.NewTime(now)}
+	if previous != nil {
+		out.Action = previous.Action
+		out.Reason = previous.Reason
+		out.InterveningSince = previous.InterveningSince
+		out.HoldUntil = previous.HoldUntil
+		out.Interventions = previous.Interventions
+	}
+	var breaches []string
+	if latency != nil {
+		out.LatencyBurnRate = formatFloat(*latency)
+		if *latency >= settings.burnRateThreshold {
+			breaches = append(breaches, "latency burn rate "+out.LatencyBurnRate)
+		}
+	}
+	if availability != nil {
+		out.AvailabilityBurnRate = formatFloat(*availability)
+		if *availability >= settings.burnRateThreshold {
+			breaches = append(breaches, "availability burn rate "+out.AvailabilityBurnRate)
+		}
+	}
+	intervening := previous != nil && previous.Intervening
+	switch {
+	case len(breaches) > 0:
+		if !intervening {
+			out.Interventions++
+			out.InterveningSince = &out.LastEvaluated
+		}
+		out.Intervening = true
+		out.Action = settings.action
+		out.Reason = fmt.Sprintf("%s over %s", strings.Join(breaches, " and "), formatFloat(settings.burnRateThreshold))
+		out.HoldUntil = &metav1.Time{Time: now.Add(settings.hold)}
+	case intervening && out.HoldUntil != nil && now.Before(out.HoldUntil.Time):
+		out.Intervening = true
+	}
+
+	if out.Intervening && !intervening {
+		recordEvent(r.Recorder, svc, corev1.EventTypeWarning, eventSLOGuardIntervened, "SLO guard intervening (%s): %s", out.Action, out.Reason)
+	} else if intervening && !out.Intervening {
+		recordEvent(r.Recorder, svc, corev1.EventTypeNormal, eventSLOGuardStoodDown, "SLO guard stood down, carbon throttling applies again")
+	}
+	return out, nil
+}
+
+// sloGuardedStatus relaxes the carbon throttling of a schedule while the SLO
+// guard of cfg intervenes: the processing throttle, flavour concurrency limits
+// and replica ceilings are lifted, and with boost-precision boostPercent of
+// the traffic moves to the highest precision.
+func sloGuardedStatus(status schedulingv1alpha1.TrafficScheduleStatus, cfg *schedulingv1alpha1.SLOGuardConfig) (schedulingv1alpha1.TrafficScheduleStatus, error) {
+	settings, err := parseSLOGuard(cfg)
+	if err != nil {
+		return status, err
+	}
+	out := *status.DeepCopy()
+	for i := range out.Flavours {
+		out.Flavours[i].Concurrency = ""
+	}
+	out.ProcessingThrottle = "1"
+	out.EffectiveReplicaCeilings = nil
+	if settings.action != sloGuardBoostPrecision || len(out.Flavours) == 0 {
+		return out, nil
+	}
+	boost := float64(settings.boostPercent)
+	highest := highestPrecision(out.Flavours)
+	shares := make([]float64, len(out.Flavours))
+	for i, flavour := range out.Flavours {
+		shares[i] = float64(flavour.Weight) * (100 - boost) / 100
+		if flavour.Precision == highest {
+			shares[i] += boost
+		}
+	}
+	for i, weight := range roundPercentages(shares) {
+		out.Flavours[i].Weight = weight
+	}
+	return out, nil
+}
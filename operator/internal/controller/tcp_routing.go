@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"strings"
+
+	networkingapi "istio.io/api/networking/v1alpha3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+// Protocols of Service ports, as Istio selects them.
+const (
+	portProtocolHTTP = "http"
+	portProtocolTCP  = "tcp"
+	portProtocolTLS  = "tls"
+)
+
+// portProtocol returns how Istio handles the traffic of a Service port: from
+// its appProtocol or else the prefix of its name ("redis-cache"). Ports not
+// declared as TCP or TLS are left to the HTTP routes, which also cover the
+// ports whose protocol Istio sniffs.
+func portProtocol(port corev1.ServicePort) string {
+	protocol := ptr.Deref(port.AppProtocol, "")
+	if protocol == "" {
+		protocol, _, _ = strings.Cut(port.Name, "-")
+	}
+	switch strings.ToLower(protocol) {
+	case "tcp", "mongo", "mysql", "redis":
+		return portProtocolTCP
+	case "tls", "https":
+		return portProtocolTLS
+	default:
+		return portProtocolHTTP
+	}
+}
+
+// buildStreamRoutes splits the connections to the TCP and TLS ports of svc
+// with the schedule weights. Istio routes each connection once, so it stays on
+// the precision picked when it is opened; TLS is passed through, matched on
+// the SNI of the Service host.
+func buildStreamRoutes(svc *corev1.Service, host string, flavours []schedulingv1alpha1.FlavourDecision, precisions []int) ([]*networkingapi.TCPRoute, []*networkingapi.TLSRoute) {
+	var tcpRoutes []*networkingapi.TCPRoute
+	var tlsRoutes []*networkingapi.TLSRoute
+	for _, port := range svc.Spec.Ports {
+		protocol := portProtocol(port)
+		if protocol == portProtocolHTTP {
+			continue
+		}
+		weighted := buildWeightedRoute(host, flavours, precisions)
+		destinations := make([]*networkingapi.RouteDestination, 0, len(weighted.Route))
+		for _, destination := range weighted.Route {
+			destinations = append(destinations, &networkingapi.RouteDestination{
+				Destination: &networkingapi.Destination{
+					Host:   host,
+					Subset: destination.Destination.Subset,
+					Port:   &networkingapi.PortSelector{Number: uint32(port.Port)},
+				},
+				Weight: destination.Weight,
+			})
+		}
+		if protocol == portProtocolTLS {
+			tlsRoutes = append(tlsRoutes, &networkingapi.TLSRoute{
+				Match: []*networkingapi.TLSMatchAttributes{{SniHosts: []string{host}, Port: uint32(port.Port)}},
+				Route: destinations,
+			})
+			continue
+		}
+		tcpRoutes = append(tcpRoutes, &networkingapi.TCPRoute{
+			Match: []*networkingapi.L4MatchAttributes{{Port: uint32(port.Port)}},
+			Route: destinations,
+		})
+	}
+	return tcpRoutes, tlsRoutes
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	networkingapi "istio.io/api/networking/v1alpha3"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+)
+
+const (
+	defaultConsecutive5xxErrors    = 5
+	defaultOutlierIntervalSeconds  = 10
+	defaultBaseEjectionTimeSeconds = 30
+	defaultMaxEjectionPercent      = 10
+)
+
+// withSubsetPolicies applies the traffic policy shared by the subsets to the
+// DestinationRule policy, and gives the subsets with overrides their own. A
+// subset policy replaces the DestinationRule one field by field in Istio, so
+// it starts from a copy of the shared policy.
+func withSubsetPolicies(policy *networkingapi.TrafficPolicy, subsets []*networkingapi.Subset, cfg *schedulingv1alpha1.TrafficPolicyConfig) *networkingapi.TrafficPolicy {
+	if cfg == nil {
+		return policy
+	}
+	policy = withTrafficPolicy(policy, cfg.SubsetTrafficPolicy)
+	for _, override := range cfg.PerPrecision {
+		name := precisionSubsetName(override.Precision)
+		for _, subset := range subsets {
+			if subset.Name != name {
+				continue
+			}
+			var shared *networkingapi.TrafficPolicy
+			if policy != nil {
+				shared = proto.Clone(policy).(*networkingapi.TrafficPolicy)
+			}
+			subset.TrafficPolicy = withTrafficPolicy(shared, override.SubsetTrafficPolicy)
+		}
+	}
+	return policy
+}
+
+// withTrafficPolicy sets the fields of cfg on policy, keeping the others, such
+// as the locality settings and the connection age cap.
+func withTrafficPolicy(policy *networkingapi.TrafficPolicy, cfg schedulingv1alpha1.SubsetTrafficPolicy) *networkingapi.TrafficPolicy {
+	if cfg.ConnectionPool == nil && cfg.OutlierDetection == nil && cfg.LoadBalancer == "" {
+		return policy
+	}
+	if policy == nil {
+		policy = &networkingapi.TrafficPolicy{}
+	}
+	if pool := cfg.ConnectionPool; pool != nil {
+		if policy.ConnectionPool == nil {
+			policy.ConnectionPool = &networkingapi.ConnectionPoolSettings{}
+		}
+		if pool.MaxConnections != nil {
+			if policy.ConnectionPool.Tcp == nil {
+				policy.ConnectionPool.Tcp = &networkingapi.ConnectionPoolSettings_TCPSettings{}
+			}
+			policy.ConnectionPool.Tcp.MaxConnections = *pool.MaxConnections
+		}
+		if pool.MaxPendingRequests != nil || pool.MaxRequestsPerConnection != nil {
+			if policy.ConnectionPool.Http == nil {
+				policy.ConnectionPool.Http = &networkingapi.ConnectionPoolSettings_HTTPSettings{}
+			}
+			if pool.MaxPendingRequests != nil {
+				policy.ConnectionPool.Http.Http1MaxPendingRequests = *pool.MaxPendingRequests
+			}
+			if pool.MaxRequestsPerConnection != nil {
+				policy.ConnectionPool.Http.MaxRequestsPerConnection = *pool.MaxRequestsPerConnection
+			}
+		}
+	}
+	if outlier := cfg.OutlierDetection; outlier != nil {
+		if policy.OutlierDetection == nil {
+			policy.OutlierDetection = &networkingapi.OutlierDetection{
+				Consecutive_5XxErrors: wrapperspb.UInt32(defaultConsecutive5xxErrors),
+				Interval:              durationpb.New(defaultOutlierIntervalSeconds * time.Second),
+				BaseEjectionTime:      durationpb.New(defaultBaseEjectionTimeSeconds * time.Second),
+				MaxEjectionPercent:    defaultMaxEjectionPercent,
+			}
+		}
+		if outlier.Consecutive5xxErrors != nil {
+			policy.OutlierDetection.Consecutive_5XxErrors = wrapperspb.UInt32(uint32(*outlier.Consecutive5xxErrors))
+		}
+		if outlier.IntervalSeconds != nil {
+			policy.OutlierDetection.Interval = durationpb.New(time.Duration(*outlier.IntervalSeconds) * time.Second)
+		}
+		if outlier.BaseEjectionTimeSeconds != nil {
+			policy.OutlierDetection.BaseEjectionTime = durationpb.New(time.Duration(*outlier.BaseEjectionTimeSeconds) * time.Second)
+		}
+		if outlier.MaxEjectionPercent != nil {
+			policy.OutlierDetection.MaxEjectionPercent = *outlier.MaxEjectionPercent
+		}
+	}
+	if cfg.LoadBalancer != "" {
+		if policy.LoadBalancer == nil {
+			policy.LoadBalancer = &networkingapi.LoadBalancerSettings{}
+		}
+		policy.LoadBalancer.LbPolicy = &networkingapi.LoadBalancerSettings_Simple{
+			Simple: networkingapi.LoadBalancerSettings_SimpleLB(networkingapi.LoadBalancerSettings_SimpleLB_value[cfg.LoadBalancer]),
+		}
+	}
+	return policy
+}
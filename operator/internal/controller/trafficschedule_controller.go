@@ -21,33 +21,83 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"net/http"
 	"reflect"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 
 	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/engine"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // TrafficScheduleReconciler reconciles a TrafficSchedule object
 type TrafficScheduleReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// KillSwitchNamespace holds the emergency kill-switch ConfigMap; empty disables it.
+	KillSwitchNamespace string
+	// Engine computes schedules in-process; nil uses the external decision engine.
+	Engine *engine.Engine
+	// Dashboards publishes a Grafana dashboard ConfigMap per schedule.
+	Dashboards bool
+	// Streams talks to the external decision engine over gRPC instead of HTTP.
+	Streams *ScheduleStreams
+	// APIReader reads the decision engine credentials without caching Secrets.
+	APIReader client.Reader
+	// EngineURL is the base URL of the external decision engine over HTTP;
+	// empty uses DefaultEngineURL.
+	EngineURL string
+	// EngineHTTP is the client for EngineURL, see NewEngineHTTPClient; nil
+	// uses a plain client with DefaultEngineTimeout.
+	EngineHTTP *http.Client
+	// Receiver takes schedules pushed by the external decision engine over
+	// HTTP; optional.
+	Receiver *ScheduleReceiver
+	// Events subscribes to the schedule events of the external decision engine
+	// over HTTP; optional.
+	Events *ScheduleEvents
+	// Recorder records Events on the schedules; optional.
+	Recorder record.EventRecorder
+	// DecisionLog keeps an audit trail of the applied schedules; optional.
+	DecisionLog *DecisionLog
+	// Savings holds the carbon savings of the routed Services until they are
+	// rolled up in the status of their schedule; optional.
+	Savings *SavingsLedger
+	// CarbonProviderURLs are the APIs of spec.scheduler.carbonProvider.
+	CarbonProviderURLs CarbonProviderURLs
+	// Kepler measures the energy of the flavours of the schedules enabling
+	// spec.energyCalibration; optional.
+	Kepler *Kepler
+
+	// forecasts caches the forecasts the operator fetches for the external
+	// decision engine.
+	forecasts forecastCaches
 }
 
 const (
 	pollInterval            = 1 * time.Minute
-	engineBaseURL           = "http://carbonrouter-decision-engine.carbonrouter-system.svc.cluster.local"
 	configHashAnnotation    = "scheduling.carbonrouter.io/config-hash"
 	schedulePendingInterval = 5 * time.Second
 )
@@ -65,13 +115,22 @@ type schedulerFlavour struct {
 	CarbonIntensity float64           `json:"carbonIntensity"`
 	Enabled         bool              `json:"enabled"`
 	Annotations     map[string]string `json:"annotations,omitempty"`
+	Resources       *flavourResources `json:"resources,omitempty"`
+	// JoulesPerRequest is the energy CarbonIntensity was measured from.
+	JoulesPerRequest *float64 `json:"-"`
 }
 
 // +kubebuilder:rbac:groups=scheduling.carbonrouter.io,resources=trafficschedules,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=scheduling.carbonrouter.io,resources=trafficschedules/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=scheduling.carbonrouter.io,resources=trafficschedules/finalizers,verbs=update
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get
+// +kubebuilder:rbac:groups=autoscaling.k8s.io,resources=verticalpodautoscalers,verbs=get;list
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=rabbitmq.com,resources=rabbitmqclusters,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=policy.karmada.io,resources=propagationpolicies;overridepolicies,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=addons.cluster.x-k8s.io,resources=clusterresourcesets,verbs=get;list;watch;create;update;patch;delete
 
-func (r *TrafficScheduleReconciler) discoverFlavours(ctx context.Context, namespace string) ([]schedulerFlavour, error) {
+func (r *TrafficScheduleReconciler) discoverFlavours(ctx context.Context, ts *schedulingv1alpha1.TrafficSchedule) ([]schedulerFlavour, error) {
 	logger := ctrl.LoggerFrom(ctx).WithName("[TrafficSchedule][Discovery]")
 
 	var deployments appsv1.DeploymentList
@@ -79,9 +138,25 @@ func (r *TrafficScheduleReconciler) discoverFlavours(ctx context.Context, namesp
 	if err := r.List(ctx, &deployments); err != nil {
 		return nil, err
 	}
+	// A schedule with a serviceSelector only learns the flavours of the services bound to it
+	var bound map[string]struct{}
+	if hasServiceSelector(ts) {
+		var err error
+		if bound, err = boundServices(ctx, r.Client, ts); err != nil {
+			return nil, err
+		}
+	}
 
 	flavours := make([]schedulerFlavour, 0)
 	seen := make(map[string]struct{})
+	// Recommendations of the VerticalPodAutoscalers, read once per namespace
+	recommendations := map[string]map[string]corev1.ResourceList{}
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+	// Deployments of the flavours, whose energy spec.energyCalibration measures
+	sources := make(map[string]*appsv1.Deployment)
 
 	for _, dep := range deployments.Items {
 		labels := dep.GetLabels()
@@ -89,6 +164,11 @@ func (r *TrafficScheduleReconciler) discoverFlavours(ctx context.Context, namesp
 		if precisionValue == "" {
 			continue
 		}
+		if bound != nil {
+			if _, ok := bound[dep.Namespace+"/"+labels[parentServiceLabel]]; !ok {
+				continue
+			}
+		}
 
 		precision, err := strconv.ParseFloat(precisionValue, 64)
 		if err != nil {
@@ -126,19 +206,34 @@ func (r *TrafficScheduleReconciler) discoverFlavours(ctx context.Context, namesp
 			annotations[key] = value
 		}
 
+		var resources *flavourResources
+		if ts.Spec.Rightsizing.Enabled {
+			byDeployment, ok := recommendations[dep.Namespace]
+			if !ok {
+				if byDeployment, err = vpaRecommendations(ctx, reader, dep.Namespace); err != nil {
+					return nil, err
+				}
+				recommendations[dep.Namespace] = byDeployment
+			}
+			resources = resourcesOf(byDeployment[dep.Name], podRequests(dep.Spec.Template.Spec))
+		}
+
 		flavours = append(flavours, schedulerFlavour{
 			Name:            precisionName,
 			Precision:       precision,
 			CarbonIntensity: carbonIntensity,
 			Enabled:         true,
 			Annotations:     annotations,
+			Resources:       resources,
 		})
 		seen[precisionName] = struct{}{}
+		sources[precisionName] = &dep
 	}
 
 	sort.Slice(flavours, func(i, j int) bool {
 		return flavours[i].Precision > flavours[j].Precision
 	})
+	r.calibrate(ctx, ts, flavours, sources)
 
 	return flavours, nil
 }
@@ -158,10 +253,81 @@ func (r *TrafficScheduleReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 
 	var existing schedulingv1alpha1.TrafficSchedule
 	if err := r.Get(ctx, req.NamespacedName, &existing); err != nil {
+		if apierrors.IsNotFound(err) && r.Engine != nil {
+			r.Engine.Forget(req.NamespacedName)
+		}
+		if apierrors.IsNotFound(err) && r.Streams != nil {
+			r.Streams.Forget(req.NamespacedName)
+		}
+		if apierrors.IsNotFound(err) && r.Receiver != nil {
+			r.Receiver.Forget(req.NamespacedName)
+		}
+		if apierrors.IsNotFound(err) && r.Events != nil {
+			r.Events.Forget(req.NamespacedName)
+		}
+		if apierrors.IsNotFound(err) {
+			forgetScheduleMetrics(req.NamespacedName)
+			r.DecisionLog.Forget(req.NamespacedName)
+			r.forecasts.forget(req.NamespacedName)
+			r.Kepler.forget(req.NamespacedName)
+		}
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	flavours, err := r.discoverFlavours(ctx, req.Namespace)
+	result, err := r.reconcileSchedule(ctx, req, &existing)
+	if err != nil {
+		result, err = r.scheduleFailed(ctx, &existing, err)
+	}
+	if retry := r.propagate(ctx, &existing); retry > 0 && err == nil && !result.Requeue &&
+		(result.RequeueAfter == 0 || retry < result.RequeueAfter) {
+		result.RequeueAfter = retry
+	}
+	recordScheduleMetrics(&existing)
+	return result, err
+}
+
+// scheduleFailed reports err in the Reconciled condition of the schedule and
+// turns it into a reconcile result retried according to its class.
+func (r *TrafficScheduleReconciler) scheduleFailed(ctx context.Context, existing *schedulingv1alpha1.TrafficSchedule, err error) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx).WithName("[TrafficSchedule]")
+	class := classify(err)
+	// Conflicts are retried on a fresh copy and would only make the condition flicker
+	if class != failureConflict {
+		cond := reconciledCondition(class, err)
+		cond.ObservedGeneration = existing.Generation
+		original := existing.DeepCopy()
+		changed := r.setEngineCondition(existing)
+		fallback := false
+		var engineErr *engineError
+		if class == failureTransient && errors.As(err, &engineErr) {
+			recordEvent(r.Recorder, existing, corev1.EventTypeWarning, eventEngineUnreachable, "Decision engine call failed: %v", err)
+			if r.applyFallback(existing) {
+				log.Info("Decision engine unreachable, falling back", "reason", fallbackReason(existing))
+				changed, fallback = true, true
+			}
+		}
+		if meta.SetStatusCondition(&existing.Status.Conditions, cond) || changed {
+			if patchErr := r.Status().Patch(ctx, existing, client.MergeFrom(original)); patchErr != nil {
+				log.Error(patchErr, "Failed to report reconcile failure")
+			} else if fallback {
+				r.DecisionLog.Record(ctx, existing, decisionSourceFallback, fallbackReason(existing))
+			}
+		}
+	}
+	result, err := failureResult("trafficschedule", class, err)
+	// A fallback schedule is refreshed before it expires rather than on the
+	// backoff, which soon outgrows the poll interval
+	if requeue, ok := fallbackRequeue(existing); ok && class == failureTransient {
+		return ctrl.Result{RequeueAfter: requeue}, nil
+	}
+	return result, err
+}
+
+// reconcileSchedule computes the schedule of existing and publishes it.
+func (r *TrafficScheduleReconciler) reconcileSchedule(ctx context.Context, req ctrl.Request, existing *schedulingv1alpha1.TrafficSchedule) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx).WithName("[TrafficSchedule]")
+
+	flavours, err := r.discoverFlavours(ctx, existing)
 	if err != nil {
 		log.Error(err, "Failed to discover strategy deployments")
 		return ctrl.Result{}, err
@@ -170,6 +336,28 @@ func (r *TrafficScheduleReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		log.Info("No carbon flavours discovered – scheduler will use defaults")
 	}
 
+	if r.Dashboards {
+		if err := r.ensureDashboard(ctx, existing); err != nil {
+			log.Error(err, "Failed to publish Grafana dashboard")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := r.ensureBrokerCluster(ctx, existing); err != nil {
+		log.Error(err, "Failed to provision the RabbitMQ cluster")
+		return ctrl.Result{}, err
+	}
+
+	// The kill-switch takes precedence over the decision engine, which may be the
+	// very component misbehaving during an incident.
+	engaged, err := killSwitchEngaged(ctx, r.Client, r.KillSwitchNamespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if engaged {
+		return r.applyKillSwitch(ctx, existing, flavours)
+	}
+
 	payload := buildSchedulerConfigPayload(existing.Spec, flavours)
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
@@ -177,125 +365,178 @@ func (r *TrafficScheduleReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 		return ctrl.Result{}, err
 	}
 
+	if r.Engine != nil {
+		return r.reconcileEmbedded(ctx, existing, payloadBytes, flavours)
+	}
+	if r.Streams != nil {
+		return r.reconcileStreamed(ctx, existing, payloadBytes, flavours)
+	}
+
 	prevHash := ""
 	if existing.Annotations != nil {
 		prevHash = existing.Annotations[configHashAnnotation]
 	}
 	configHash := fmt.Sprintf("%x", sha256.Sum256(payloadBytes))
 
-	// Check if schedule exists in decision engine
-	checkURL := fmt.Sprintf("%s/schedule/%s/%s", engineBaseURL, req.Namespace, req.Name)
-	checkResp, err := httpClient.Get(checkURL)
-	scheduleExists := err == nil && checkResp.StatusCode == http.StatusOK
-	checkStatusCode := 0
-	if checkResp != nil {
-		checkStatusCode = checkResp.StatusCode
-		checkResp.Body.Close()
+	// A pushed schedule saves the round trip, unless it predates the
+	// configuration about to be pushed
+	if pushed, ok := r.Receiver.take(req.NamespacedName); ok && prevHash == configHash {
+		log.Info("Applying schedule pushed by the decision engine", "validUntil", pushed.ValidUntil)
+		return r.publishSchedule(ctx, existing, pushed, flavours)
 	}
-	log.Info("Schedule existence check", "statusCode", checkStatusCode, "scheduleExists", scheduleExists, "prevHash", prevHash, "configHash", configHash)
+
+	credential, err := r.engineCredentialFor(ctx, existing)
+	if err != nil {
+		log.Error(err, "Failed to read decision engine credentials")
+		return ctrl.Result{}, err
+	}
+	r.Events.watch(req.NamespacedName, credential)
+	if streamed, ok := r.Events.latest(req.NamespacedName); ok && prevHash == configHash {
+		log.V(1).Info("Applying schedule streamed by the decision engine", "validUntil", streamed.ValidUntil)
+		return r.publishSchedule(ctx, existing, streamed, flavours)
+	}
+	statusCode, remote, err := r.fetchSchedule(ctx, credential, req.Namespace, req.Name)
+	if errors.Is(err, errEngineCircuitOpen) {
+		return r.engineDegraded(ctx, existing)
+	}
+	if err != nil {
+		log.Error(err, "Failed to get traffic schedule")
+		return ctrl.Result{}, engineFailure(err)
+	}
+	log.Info("Schedule existence check", "statusCode", statusCode, "prevHash", prevHash, "configHash", configHash)
 
 	// Push config if hash changed OR schedule doesn't exist
-	if prevHash != configHash || !scheduleExists {
-		if !scheduleExists {
-			log.Info("Schedule not found in decision engine, pushing configuration", "checkStatusCode", checkStatusCode)
+	if prevHash != configHash || statusCode == http.StatusNotFound {
+		if statusCode == http.StatusNotFound {
+			log.Info("Schedule not found in decision engine, pushing configuration")
 		}
-		if err := pushSchedulerConfig(req.Namespace, req.Name, payload); err != nil {
+		err := callEngine(ctx, func() error {
+			return r.pushSchedulerConfig(ctx, credential, req.Namespace, req.Name, payloadBytes)
+		})
+		if errors.Is(err, errEngineCircuitOpen) {
+			return r.engineDegraded(ctx, existing)
+		}
+		if err != nil {
 			log.Error(err, "Failed to push scheduler configuration")
-			return ctrl.Result{}, err
+			return ctrl.Result{}, engineFailure(err)
 		}
 
-		original := existing.DeepCopy()
-		updated := existing.DeepCopy()
-		if updated.Annotations == nil {
-			updated.Annotations = map[string]string{}
-		}
-		updated.Annotations[configHashAnnotation] = configHash
-		if err := r.Patch(ctx, updated, client.MergeFrom(original)); err != nil {
+		if err := r.recordConfigHash(ctx, existing, configHash); err != nil {
 			log.Error(err, "Failed to persist scheduler config hash")
 			return ctrl.Result{}, err
 		}
-		if err := r.Get(ctx, req.NamespacedName, &existing); err != nil {
-			return ctrl.Result{}, err
-		}
 
 		// Requeue to give decision engine time to process the configuration
 		// This prevents immediately trying to GET a schedule that was just created
 		log.Info("Configuration pushed successfully, requeueing to allow decision engine processing")
 		return ctrl.Result{RequeueAfter: schedulePendingInterval}, nil
-	} else {
-		log.V(1).Info("Scheduler configuration unchanged; skipping push")
 	}
+	log.V(1).Info("Scheduler configuration unchanged; skipping push")
 
-	// 1) Get schedule from decision engine
-	url := fmt.Sprintf("%s/schedule/%s/%s", engineBaseURL, req.Namespace, req.Name)
-	resp, err := httpClient.Get(url)
-	if err != nil {
+	if statusCode == http.StatusAccepted || statusCode == http.StatusNoContent {
+		log.Info("Decision engine reports schedule pending", "statusCode", statusCode)
+		return ctrl.Result{RequeueAfter: schedulePendingInterval}, nil
+	}
+	if statusCode >= http.StatusBadRequest {
+		err := fmt.Errorf("unexpected status code: %d", statusCode)
 		log.Error(err, "Failed to get traffic schedule")
-		return ctrl.Result{}, err
+		return ctrl.Result{}, engineFailure(err)
 	}
-	defer resp.Body.Close()
+	return r.publishSchedule(ctx, existing, remote, flavours)
+}
 
-	if resp.StatusCode == http.StatusAccepted || resp.StatusCode == http.StatusNoContent {
-		log.Info("Decision engine reports schedule pending", "statusCode", resp.StatusCode)
-		return ctrl.Result{RequeueAfter: schedulePendingInterval}, nil
+// fetchSchedule gets the schedule from the decision engine through the circuit
+// breaker. Server errors are retried; other status codes are returned for the
+// caller to act on, along with the schedule when the engine has one.
+func (r *TrafficScheduleReconciler) fetchSchedule(ctx context.Context, credential engineCredential, namespace, name string) (int, engine.Schedule, error) {
+	var (
+		statusCode int
+		remote     engine.Schedule
+	)
+	url := fmt.Sprintf("%s/schedule/%s/%s", r.engineURL(), namespace, name)
+	err := callEngine(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		credential.apply(req)
+		resp, err := r.engineClient().Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if err := credentialsRejected(resp); err != nil {
+			return err
+		}
+		statusCode = resp.StatusCode
+		if statusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("decision engine returned %s", resp.Status)
+		}
+		if statusCode != http.StatusOK {
+			return nil
+		}
+		remote = engine.Schedule{}
+		return json.NewDecoder(resp.Body).Decode(&remote)
+	})
+	return statusCode, remote, err
+}
+
+// engineDegraded keeps the last published schedule while the decision engine
+// circuit is open, and looks again once a trial call is allowed.
+func (r *TrafficScheduleReconciler) engineDegraded(ctx context.Context, existing *schedulingv1alpha1.TrafficSchedule) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx).WithName("[TrafficSchedule]")
+	retryIn := decisionEngineBreaker.retryIn()
+	log.Info("Decision engine circuit open, keeping the last schedule", "retryIn", retryIn)
+	original := existing.DeepCopy()
+	changed := r.setEngineCondition(existing)
+	if changed {
+		recordEvent(r.Recorder, existing, corev1.EventTypeWarning, eventEngineUnreachable,
+			"Decision engine circuit open, keeping the last schedule; retrying in %s", retryIn.Round(time.Second))
 	}
-	if resp.StatusCode == http.StatusNotFound {
-		// Schedule not found in decision engine - push config and retry
-		log.Info("Schedule not found in decision engine (404), pushing configuration and retrying")
-		if err := pushSchedulerConfig(req.Namespace, req.Name, payload); err != nil {
-			log.Error(err, "Failed to push scheduler configuration after 404")
+	fallback := r.applyFallback(existing)
+	if changed || fallback {
+		if err := r.Status().Patch(ctx, existing, client.MergeFrom(original)); err != nil {
 			return ctrl.Result{}, err
 		}
-		// Clear the config hash annotation to ensure it gets updated on next reconcile
-		if existing.Annotations != nil {
-			delete(existing.Annotations, configHashAnnotation)
-			if err := r.Update(ctx, &existing); err != nil {
-				log.Error(err, "Failed to clear config hash annotation")
-				return ctrl.Result{}, err
-			}
-		}
-		return ctrl.Result{RequeueAfter: schedulePendingInterval}, nil
 	}
-	if resp.StatusCode >= http.StatusBadRequest {
-		err := fmt.Errorf("unexpected status code: %s", resp.Status)
-		log.Error(err, "Failed to get traffic schedule")
-		return ctrl.Result{}, err
+	if fallback {
+		r.DecisionLog.Record(ctx, existing, decisionSourceFallback, fallbackReason(existing))
+	}
+	if requeue, ok := fallbackRequeue(existing); ok {
+		retryIn = min(retryIn, requeue)
 	}
+	return ctrl.Result{RequeueAfter: retryIn}, nil
+}
 
-	// 2) Temp struct to decode the response
-	var remote struct {
-		Flavours []struct {
-			Name            string  `json:"name"`
-			Precision       int     `json:"precision"`
-			Weight          int     `json:"weight"`
-			CarbonIntensity float64 `json:"carbonIntensity"`
-		} `json:"flavours"`
-		Policy struct {
-			Name string `json:"name"`
-		} `json:"policy"`
-		ValidUntilISO string `json:"validUntil"`
-		Credits       struct {
-			Balance   float64 `json:"balance"`
-			Velocity  float64 `json:"velocity"`
-			Target    float64 `json:"target"`
-			Min       float64 `json:"min"`
-			Max       float64 `json:"max"`
-			Allowance float64 `json:"allowance"`
-		} `json:"credits"`
-		Processing struct {
-			Throttle float64          `json:"throttle"`
-			Ceilings map[string]int32 `json:"ceilings"`
-		} `json:"processing"`
-		Diagnostics map[string]float64 `json:"diagnostics"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&remote); err != nil {
-		log.Error(err, "Failed to decode traffic schedule response")
-		return ctrl.Result{}, err
+// setEngineCondition reports the state of the decision engine circuit breaker
+// on schedules served by the external engine over HTTP.
+func (r *TrafficScheduleReconciler) setEngineCondition(ts *schedulingv1alpha1.TrafficSchedule) bool {
+	if r.Engine != nil || r.Streams != nil {
+		return false
 	}
-	if remote.ValidUntilISO == "" || len(remote.Flavours) == 0 {
-		log.Info("Decision engine returned incomplete schedule", "flavours", len(remote.Flavours), "validUntil", remote.ValidUntilISO)
+	cond := decisionEngineBreaker.condition()
+	cond.ObservedGeneration = ts.Generation
+	return meta.SetStatusCondition(&ts.Status.Conditions, cond)
+}
+
+// publishSchedule writes a decision of the decision engine into the status of
+// the schedule and requeues it for when the decision expires.
+func (r *TrafficScheduleReconciler) publishSchedule(ctx context.Context, existing *schedulingv1alpha1.TrafficSchedule, remote engine.Schedule, flavours []schedulerFlavour) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx).WithName("[TrafficSchedule]")
+	if remote.ValidUntil == "" || len(remote.Flavours) == 0 {
+		log.Info("Decision engine returned incomplete schedule", "flavours", len(remote.Flavours), "validUntil", remote.ValidUntil)
 		return ctrl.Result{RequeueAfter: schedulePendingInterval}, nil
 	}
+	// A Deployment removed mid-slot keeps its weight in the engine's schedule
+	// until the new flavours reach it
+	remote = retireRemovedPrecisions(log, remote, flavours)
+	if r.Engine == nil {
+		var err error
+		if remote, err = r.withOperatorForecast(ctx, existing, remote); err != nil {
+			log.Error(err, "Failed to set up the carbon provider")
+			return ctrl.Result{}, err
+		}
+	}
 
 	// 3) Create the status for the TrafficSchedule CR
 	var diagnostics map[string]string
@@ -319,32 +560,66 @@ func (r *TrafficScheduleReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 	if remote.Processing.Throttle > 0 {
 		status.ProcessingThrottle = formatFloat(remote.Processing.Throttle)
 	}
+	if remote.Carbon.Now != nil {
+		status.CarbonForecastNow = formatFloat(*remote.Carbon.Now)
+	}
+	if remote.Carbon.Next != nil {
+		status.CarbonForecastNext = formatFloat(*remote.Carbon.Next)
+	}
+	status.CarbonIndex = remote.Carbon.Index
+	if status.CarbonIndex == "" && len(remote.Carbon.Schedule) > 0 {
+		status.CarbonIndex = remote.Carbon.Schedule[0].Index
+	}
+	if len(remote.Zones) > 0 {
+		status.ZoneForecasts = make(map[string]string, len(remote.Zones))
+		for zone, forecast := range remote.Zones {
+			status.ZoneForecasts[zone] = formatFloat(forecast)
+		}
+	}
+	status.ForecastSchedule = forecastSlots(remote.Carbon.Schedule)
 	if len(remote.Processing.Ceilings) > 0 {
 		status.EffectiveReplicaCeilings = remote.Processing.Ceilings
 	}
 	for _, flavour := range remote.Flavours {
 		status.Flavours = append(status.Flavours, schedulingv1alpha1.FlavourDecision{
-			Precision: flavour.Precision,
-			Weight:    flavour.Weight,
-			Emissions: formatFloat(flavour.CarbonIntensity),
+			Precision:        flavour.Precision,
+			Weight:           flavour.Weight,
+			Emissions:        formatFloat(flavour.CarbonIntensity),
+			JoulesPerRequest: measuredJoules(flavours, flavour.Precision),
 		})
 	}
-	if t, err := time.Parse(time.RFC3339, remote.ValidUntilISO); err == nil {
+	if t, err := time.Parse(time.RFC3339, remote.ValidUntil); err == nil {
 		status.ValidUntil = metav1.NewTime(t)
 	}
 
 	sort.Slice(status.Flavours, func(i, j int) bool {
 		return status.Flavours[i].Precision < status.Flavours[j].Precision
 	})
+	setConcurrencyFactors(&status, existing.Spec.Concurrency)
+	status.LastKnownGood = lastKnownGood(status)
+	savings := r.rollUpSavings(existing, &status)
+	status.Conditions = slices.Clone(existing.Status.Conditions)
+	meta.RemoveStatusCondition(&status.Conditions, conditionScheduleFallback)
+	cond := reconciledCondition("", nil)
+	cond.ObservedGeneration = existing.Generation
+	meta.SetStatusCondition(&status.Conditions, cond)
+	if r.Engine == nil && r.Streams == nil {
+		cond := decisionEngineBreaker.condition()
+		cond.ObservedGeneration = existing.Generation
+		meta.SetStatusCondition(&status.Conditions, cond)
+	}
 
 	// 4) Overwrite old status with the new one
 	statusChanged := !reflect.DeepEqual(existing.Status, status)
 	if statusChanged {
+		recordScheduleChanges(r.Recorder, existing, existing.Status, status)
 		existing.Status = status
-		if err := r.Status().Update(ctx, &existing); err != nil {
+		if err := r.Status().Update(ctx, existing); err != nil {
+			r.Savings.restore(client.ObjectKeyFromObject(existing), savings)
 			log.Error(err, "unable to update TrafficSchedule status")
 			return ctrl.Result{}, err
 		}
+		r.DecisionLog.Record(ctx, existing, decisionSourceEngine, "")
 	}
 	next := pollInterval
 	if !status.ValidUntil.IsZero() {
@@ -356,6 +631,11 @@ func (r *TrafficScheduleReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 			next = until
 		}
 	}
+	// Forecasts fetched by the operator are refreshed in the status as their
+	// cache expires
+	if refresh := carbonRefreshInterval(existing.Spec.Scheduler); refresh > 0 && refresh < next {
+		next = refresh
+	}
 
 	log.Info("TrafficSchedule reconcile complete",
 		"nextReconcileIn", next)
@@ -363,36 +643,259 @@ func (r *TrafficScheduleReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 	return ctrl.Result{RequeueAfter: next}, nil
 }
 
+// recordConfigHash stores the hash of the configuration last pushed to the
+// decision engine on the schedule.
+func (r *TrafficScheduleReconciler) recordConfigHash(ctx context.Context, existing *schedulingv1alpha1.TrafficSchedule, configHash string) error {
+	original := existing.DeepCopy()
+	if existing.Annotations == nil {
+		existing.Annotations = map[string]string{}
+	}
+	existing.Annotations[configHashAnnotation] = configHash
+	if err := r.Patch(ctx, existing, client.MergeFrom(original)); err != nil {
+		return err
+	}
+	recordEvent(r.Recorder, existing, corev1.EventTypeNormal, eventConfigPushed, "Pushed scheduler configuration %.12s to the decision engine", configHash)
+	return nil
+}
+
+// applyFallback applies the last known good schedule to ts, see
+// applyLastKnownGood, and records an Event when the fallback starts or moves
+// on to full precision.
+func (r *TrafficScheduleReconciler) applyFallback(ts *schedulingv1alpha1.TrafficSchedule) bool {
+	prevReason := ""
+	if prev := meta.FindStatusCondition(ts.Status.Conditions, conditionScheduleFallback); prev != nil {
+		prevReason = prev.Reason
+	}
+	if !applyLastKnownGood(ts, time.Now()) {
+		return false
+	}
+	if cond := meta.FindStatusCondition(ts.Status.Conditions, conditionScheduleFallback); cond.Reason != prevReason {
+		recordEvent(r.Recorder, ts, corev1.EventTypeWarning, eventFallbackApplied, "%s", cond.Message)
+	}
+	return true
+}
+
+// reconcileStreamed exchanges the configuration and schedule with the decision
+// engine over gRPC. New decisions arrive through the schedule stream, so the
+// schedule is only requeued as a safety net.
+func (r *TrafficScheduleReconciler) reconcileStreamed(ctx context.Context, existing *schedulingv1alpha1.TrafficSchedule, payload []byte, flavours []schedulerFlavour) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx).WithName("[TrafficSchedule]")
+	key := client.ObjectKeyFromObject(existing)
+	configHash := fmt.Sprintf("%x", sha256.Sum256(payload))
+	credential, err := r.engineCredentialFor(ctx, existing)
+	if err != nil {
+		log.Error(err, "Failed to read decision engine credentials")
+		return ctrl.Result{}, err
+	}
+	if existing.Annotations[configHashAnnotation] != configHash {
+		if err := r.Streams.PutConfig(ctx, key, credential, payload); err != nil {
+			log.Error(err, "Failed to push scheduler configuration")
+			return ctrl.Result{}, engineFailure(err)
+		}
+		if err := r.recordConfigHash(ctx, existing, configHash); err != nil {
+			log.Error(err, "Failed to persist scheduler config hash")
+			return ctrl.Result{}, err
+		}
+	}
+
+	schedule, err := r.Streams.Schedule(ctx, key, credential)
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.NotFound:
+		// The engine lost the session, e.g. after a restart
+		log.Info("Schedule not found in decision engine, pushing configuration")
+		if err := r.Streams.PutConfig(ctx, key, credential, payload); err != nil {
+			log.Error(err, "Failed to push scheduler configuration")
+			return ctrl.Result{}, engineFailure(err)
+		}
+		return ctrl.Result{RequeueAfter: schedulePendingInterval}, nil
+	case codes.Unavailable:
+		// Pending schedules and unreachable engines share the code; an expired
+		// schedule calls for the fallback either way
+		if existing.Status.LastKnownGood != nil && time.Now().After(existing.Status.ValidUntil.Time) {
+			return ctrl.Result{}, engineFailure(err)
+		}
+		log.Info("Decision engine reports schedule pending", "reason", status.Convert(err).Message())
+		return ctrl.Result{RequeueAfter: schedulePendingInterval}, nil
+	default:
+		log.Error(err, "Failed to get traffic schedule")
+		return ctrl.Result{}, engineFailure(err)
+	}
+
+	if _, err := r.publishSchedule(ctx, existing, schedule, flavours); err != nil {
+		return ctrl.Result{}, err
+	}
+	if refresh := carbonRefreshInterval(existing.Spec.Scheduler); refresh > 0 && refresh < streamResyncInterval {
+		return ctrl.Result{RequeueAfter: refresh}, nil
+	}
+	return ctrl.Result{RequeueAfter: streamResyncInterval}, nil
+}
+
+// forecastSlots converts the forecast slots of a schedule for the status.
+func forecastSlots(schedule []engine.ForecastSlot) []schedulingv1alpha1.ForecastSlot {
+	var out []schedulingv1alpha1.ForecastSlot
+	for _, slot := range schedule {
+		forecast := ""
+		if slot.Forecast != nil {
+			forecast = formatFloat(*slot.Forecast)
+		}
+		out = append(out, schedulingv1alpha1.ForecastSlot{
+			From: slot.From, To: slot.To, Forecast: forecast, Index: slot.Index,
+		})
+	}
+	return out
+}
+
+// reconcileEmbedded computes the schedule with the in-process engine, which
+// receives the same configuration payload as the external one.
+func (r *TrafficScheduleReconciler) reconcileEmbedded(ctx context.Context, existing *schedulingv1alpha1.TrafficSchedule, payload []byte, flavours []schedulerFlavour) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx).WithName("[TrafficSchedule]")
+	cfg, err := engine.ParseConfig(payload)
+	if err != nil {
+		log.Error(err, "Failed to decode scheduler payload")
+		return ctrl.Result{}, invalidConfigError(err)
+	}
+	if cfg.Carbon, err = r.carbonProviderFor(ctx, existing); err != nil {
+		log.Error(err, "Failed to set up the carbon provider")
+		return ctrl.Result{}, err
+	}
+	if ref := existing.Spec.Scheduler.CarbonProviderRef; ref != "" {
+		// The status of the CarbonIntensityProvider is read from the cache of
+		// the operator, so there is nothing to cache on top
+		noCache := 0.0
+		cfg.CarbonTarget, cfg.CarbonCacheTTL = ref, &noCache
+	}
+	key := client.ObjectKeyFromObject(existing)
+	r.Engine.Configure(ctx, key, cfg)
+	schedule, err := r.Engine.Schedule(ctx, key)
+	if err != nil {
+		log.Error(err, "Embedded decision engine failed")
+		return ctrl.Result{}, engineFailure(err)
+	}
+	return r.publishSchedule(ctx, existing, schedule, flavours)
+}
+
+// applyKillSwitch replaces the schedule with full precision routing and no
+// ceilings or throttle. Schedules never computed by the engine are built from
+// the discovered flavours.
+func (r *TrafficScheduleReconciler) applyKillSwitch(ctx context.Context, existing *schedulingv1alpha1.TrafficSchedule, flavours []schedulerFlavour) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx).WithName("[TrafficSchedule]")
+	log.Info("Kill-switch engaged, bypassing the decision engine")
+
+	base := existing.Status
+	if len(base.Flavours) == 0 {
+		for _, flavour := range flavours {
+			precision := int(math.Round(flavour.Precision * 100))
+			base.Flavours = append(base.Flavours, schedulingv1alpha1.FlavourDecision{
+				Precision:        precision,
+				Emissions:        formatFloat(flavour.CarbonIntensity),
+				JoulesPerRequest: measuredJoules(flavours, precision),
+			})
+		}
+		sort.Slice(base.Flavours, func(i, j int) bool {
+			return base.Flavours[i].Precision < base.Flavours[j].Precision
+		})
+	}
+	status := killSwitchStatus(base)
+	if time.Until(status.ValidUntil.Time) <= 0 {
+		status.ValidUntil = metav1.NewTime(time.Now().Add(pollInterval).UTC().Truncate(time.Second))
+	}
+	savings := r.rollUpSavings(existing, &status)
+
+	if !reflect.DeepEqual(existing.Status, status) {
+		if existing.Status.ActivePolicy != killSwitchPolicy {
+			recordEvent(r.Recorder, existing, corev1.EventTypeWarning, eventKillSwitchEngaged,
+				"Kill-switch engaged, routing at full precision without throttle or ceilings")
+		}
+		existing.Status = status
+		if err := r.Status().Update(ctx, existing); err != nil {
+			r.Savings.restore(client.ObjectKeyFromObject(existing), savings)
+			log.Error(err, "unable to update TrafficSchedule status")
+			return ctrl.Result{}, err
+		}
+		r.DecisionLog.Record(ctx, existing, decisionSourceKillSwitch, "KillSwitch")
+	}
+	return ctrl.Result{RequeueAfter: pollInterval}, nil
+}
+
+// rollUpSavings carries the carbon savings of existing over to status, and
+// rolls the savings of its Services up once per schedule window, when status
+// starts a new one. It returns the window rolled up, to restore should the
+// status not be stored.
+func (r *TrafficScheduleReconciler) rollUpSavings(existing *schedulingv1alpha1.TrafficSchedule, status *schedulingv1alpha1.TrafficScheduleStatus) *savingsWindow {
+	status.Savings = existing.Status.Savings
+	if status.ValidUntil.Equal(&existing.Status.ValidUntil) {
+		return nil
+	}
+	window := r.Savings.take(client.ObjectKeyFromObject(existing))
+	status.Savings = rollUpSavings(existing.Status.Savings, window, time.Now())
+	return window
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *TrafficScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Flipping the kill-switch re-evaluates every schedule right away
+	mapAll := handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, _ client.Object) []reconcile.Request {
+		var list schedulingv1alpha1.TrafficScheduleList
+		if err := mgr.GetClient().List(ctx, &list); err != nil {
+			return nil
+		}
+		out := make([]reconcile.Request, 0, len(list.Items))
+		for _, ts := range list.Items {
+			out = append(out, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&ts)})
+		}
+		return out
+	})
+
 	// Allow periodic reconciliation by not filtering status updates
 	// This ensures the controller re-reconciles when schedules expire
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&schedulingv1alpha1.TrafficSchedule{}).
-		Complete(r)
-}
-
-func pushSchedulerConfig(namespace, name string, payload map[string]interface{}) error {
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return err
+		Watches(&corev1.ConfigMap{}, mapAll, builder.WithPredicates(killSwitchPredicate(r.KillSwitchNamespace))).
+		// Added and removed flavours reach the engine right away instead of at the next poll
+		Watches(&appsv1.Deployment{}, mapAll, builder.WithPredicates(flavourDeploymentPredicate())).
+		// So does every forecast refreshed by a CarbonIntensityProvider
+		Watches(&schedulingv1alpha1.CarbonIntensityProvider{}, schedulesFollowingProvider(mgr.GetClient()))
+	if r.Streams != nil {
+		// Every decision streamed by the decision engine re-evaluates its schedule
+		b = b.WatchesRawSource(source.Channel(r.Streams.events, &handler.EnqueueRequestForObject{}))
 	}
+	if r.Receiver != nil {
+		// So does every decision pushed to the schedule receiver
+		b = b.WatchesRawSource(source.Channel(r.Receiver.events, &handler.EnqueueRequestForObject{}))
+	}
+	if r.Events != nil {
+		// And every decision received as a schedule event
+		b = b.WatchesRawSource(source.Channel(r.Events.events, &handler.EnqueueRequestForObject{}))
+	}
+	return b.Complete(r)
+}
 
-	url := fmt.Sprintf("%s/config/%s/%s", engineBaseURL, namespace, name)
-	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(body))
+func (r *TrafficScheduleReconciler) pushSchedulerConfig(ctx context.Context, credential engineCredential, namespace, name string, body []byte) error {
+	url := fmt.Sprintf("%s/config/%s/%s", r.engineURL(), namespace, name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	credential.apply(req)
 
-	resp, err := httpClient.Do(req)
+	resp, err := r.engineClient().Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode >= http.StatusBadRequest {
-		return fmt.Errorf("scheduler config rejected: %s", resp.Status)
+	if err := credentialsRejected(resp); err != nil {
+		return err
+	}
+	// Only a payload the engine cannot take stops the retries; rate limits,
+	// lost sessions and conflicts clear up on their own
+	switch {
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnprocessableEntity:
+		return invalidConfigError(fmt.Errorf("scheduler config rejected: %s", resp.Status))
+	case resp.StatusCode >= http.StatusBadRequest:
+		return fmt.Errorf("scheduler config push failed: %s", resp.Status)
 	}
 
 	return nil
@@ -449,9 +952,41 @@ func buildSchedulerConfigPayload(spec schedulingv1alpha1.TrafficScheduleSpec, fl
 		cfg["flavours"] = flavours
 	}
 
+	if spec.Locality.Enabled && len(spec.Locality.Zones) > 0 {
+		zones := make([]map[string]string, 0, len(spec.Locality.Zones))
+		for _, zone := range spec.Locality.Zones {
+			zones = append(zones, map[string]string{"name": zone.Name, "carbonTarget": zone.CarbonTarget})
+		}
+		cfg["zones"] = zones
+	}
+
+	if spec.Chaos.Enabled && len(spec.Chaos.Windows) > 0 {
+		cfg["chaos"] = chaosWindows(spec.Chaos.Windows)
+	}
+
 	return cfg
 }
 
+// chaosWindows encodes the synthetic carbon windows for the decision engine,
+// with the anchor as Unix seconds.
+func chaosWindows(windows []schedulingv1alpha1.ChaosWindow) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(windows))
+	for _, window := range windows {
+		entry := map[string]interface{}{
+			"name":     window.Name,
+			"period":   window.PeriodSeconds,
+			"duration": window.DurationSeconds,
+		}
+		if window.Start != nil {
+			entry["start"] = window.Start.Unix()
+		}
+		assignFloat(entry, "factor", window.Factor)
+		assignFloat(entry, "intensity", window.Intensity)
+		out = append(out, entry)
+	}
+	return out
+}
+
 func formatFloat(value float64) string {
 	return strconv.FormatFloat(value, 'f', -1, 64)
 }
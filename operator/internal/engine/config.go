@@ -0,0 +1,171 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Config is the scheduler configuration of one TrafficSchedule. It is decoded
+// from the same payload the operator sends to PUT /config/<ns>/<name> of the
+// external decision engine; unknown keys are ignored.
+type Config struct {
+	TargetError              *float64                 `json:"targetError,omitempty"`
+	CreditMin                *float64                 `json:"creditMin,omitempty"`
+	CreditMax                *float64                 `json:"creditMax,omitempty"`
+	CreditWindow             *int                     `json:"creditWindow,omitempty"`
+	Policy                   string                   `json:"policy,omitempty"`
+	ValidFor                 *int                     `json:"validFor,omitempty"`
+	CarbonTarget             string                   `json:"carbonTarget,omitempty"`
+	CarbonTimeout            *float64                 `json:"carbonTimeout,omitempty"`
+	CarbonCacheTTL           *float64                 `json:"carbonCacheTTL,omitempty"`
+	ThrottleMin              *float64                 `json:"throttleMin,omitempty"`
+	ThrottleIntensityFloor   *float64                 `json:"throttleIntensityFloor,omitempty"`
+	ThrottleIntensityCeiling *float64                 `json:"throttleIntensityCeiling,omitempty"`
+	Components               map[string]ReplicaBounds `json:"components,omitempty"`
+	Flavours                 []Flavour                `json:"flavours,omitempty"`
+	Zones                    []Zone                   `json:"zones,omitempty"`
+	// Carbon fetches the forecasts in place of the Carbon Intensity API, when
+	// the operator does; it is never part of the payload.
+	Carbon CarbonProvider `json:"-"`
+}
+
+// DefaultProviderCacheTTL is how long the forecasts of a Config.Carbon
+// provider are cached without carbonCacheTTL, as the APIs of commercial
+// providers are rate limited and update their forecasts at most every few
+// minutes.
+const DefaultProviderCacheTTL = 5 * time.Minute
+
+// ReplicaBounds are the autoscaling bounds of a component.
+type ReplicaBounds struct {
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+}
+
+// Flavour is a precision variant of the target service.
+type Flavour struct {
+	Name string `json:"name"`
+	// Precision is the quality relative to the baseline, between 0 and 1.
+	Precision float64 `json:"precision"`
+	// CarbonIntensity is the estimated cost per request in gCO2eq.
+	CarbonIntensity float64 `json:"carbonIntensity"`
+	Enabled         bool    `json:"enabled"`
+	// Resources are the per-pod requests of the flavour, when rightsizing is on.
+	Resources *Resources `json:"resources,omitempty"`
+}
+
+// Resources are the requests of a flavour pod, recommended by a
+// VerticalPodAutoscaler or declared.
+type Resources struct {
+	// CPU is in cores and Memory in bytes.
+	CPU    float64 `json:"cpu"`
+	Memory float64 `json:"memory"`
+	Source string  `json:"source,omitempty"`
+}
+
+// Zone is a locality whose grid intensity is reported with the schedule.
+type Zone struct {
+	Name         string `json:"name"`
+	CarbonTarget string `json:"carbonTarget"`
+}
+
+// ParseConfig decodes a scheduler configuration payload.
+func ParseConfig(payload []byte) (Config, error) {
+	var cfg Config
+	err := json.Unmarshal(payload, &cfg)
+	return cfg, err
+}
+
+// settings are the effective values of a Config, with the defaults of the
+// external decision engine.
+type settings struct {
+	targetError              float64
+	creditMin                float64
+	creditMax                float64
+	creditSensitivity        float64
+	creditWindow             int
+	policy                   string
+	validFor                 time.Duration
+	carbonTarget             string
+	carbonTimeout            time.Duration
+	carbonCacheTTL           time.Duration
+	throttleMin              float64
+	throttleIntensityFloor   float64
+	throttleIntensityCeiling float64
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
+
+func (c Config) settings() settings {
+	s := settings{
+		targetError:              0.15,
+		creditMin:                -1.0,
+		creditMax:                1.0,
+		creditSensitivity:        0.33,
+		creditWindow:             300,
+		policy:                   policyCreditGreedy,
+		validFor:                 60 * time.Second,
+		carbonTarget:             "national",
+		carbonTimeout:            2 * time.Second,
+		carbonCacheTTL:           5 * time.Second,
+		throttleMin:              0.05,
+		throttleIntensityFloor:   150.0,
+		throttleIntensityCeiling: 350.0,
+	}
+	setFloat := func(dst *float64, value *float64) {
+		if value != nil {
+			*dst = *value
+		}
+	}
+	setFloat(&s.targetError, c.TargetError)
+	setFloat(&s.creditMin, c.CreditMin)
+	setFloat(&s.creditMax, c.CreditMax)
+	setFloat(&s.throttleMin, c.ThrottleMin)
+	setFloat(&s.throttleIntensityFloor, c.ThrottleIntensityFloor)
+	setFloat(&s.throttleIntensityCeiling, c.ThrottleIntensityCeiling)
+	if c.CreditWindow != nil && *c.CreditWindow > 0 {
+		s.creditWindow = *c.CreditWindow
+	}
+	if c.Policy != "" {
+		s.policy = c.Policy
+	}
+	if c.ValidFor != nil && *c.ValidFor > 0 {
+		s.validFor = time.Duration(*c.ValidFor) * time.Second
+	}
+	if c.CarbonTarget != "" {
+		s.carbonTarget = c.CarbonTarget
+	}
+	if c.CarbonTimeout != nil && *c.CarbonTimeout > 0 {
+		s.carbonTimeout = seconds(*c.CarbonTimeout)
+	}
+	if c.CarbonCacheTTL != nil && *c.CarbonCacheTTL >= 0 {
+		s.carbonCacheTTL = seconds(*c.CarbonCacheTTL)
+	}
+	return s
+}
+
+// defaultFlavours are used until the operator discovers precision deployments.
+func defaultFlavours() []Flavour {
+	return []Flavour{
+		{Name: "precision-100", Precision: 1.0, CarbonIntensity: 1.0, Enabled: true},
+		{Name: "precision-50", Precision: 0.5, CarbonIntensity: 0.6, Enabled: true},
+		{Name: "precision-30", Precision: 0.3, CarbonIntensity: 0.3, Enabled: true},
+	}
+}
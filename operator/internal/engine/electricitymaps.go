@@ -0,0 +1,144 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultElectricityMapsURL is the Electricity Maps API.
+const DefaultElectricityMapsURL = "https://api.electricitymap.org"
+
+// errForecastUnavailable is returned for the forecasts the plan of a token
+// does not include.
+var errForecastUnavailable = errors.New("forecast not available")
+
+// electricityMaps is the CarbonProvider of the Electricity Maps API. Its slots
+// last an hour.
+type electricityMaps struct {
+	baseURL string
+	token   string
+}
+
+// NewElectricityMaps returns the CarbonProvider of the Electricity Maps API at
+// baseURL authenticated with token, whose targets are zones such as "DE" or
+// "zone:US-CAL-CISO".
+func NewElectricityMaps(baseURL, token string) CarbonProvider {
+	return electricityMaps{baseURL: strings.TrimRight(baseURL, "/"), token: token}
+}
+
+// Forecast returns the latest intensity of the zone as the current slot,
+// followed by the forecast when the plan of the token includes it.
+func (p electricityMaps) Forecast(ctx context.Context, target string) ([]ForecastPoint, error) {
+	zone := strings.TrimSpace(target)
+	if strings.HasPrefix(strings.ToLower(zone), "zone:") {
+		zone = strings.TrimSpace(zone[len("zone:"):])
+	}
+	if zone == "" {
+		return nil, fmt.Errorf("electricity maps needs a zone as carbon target, got %q", target)
+	}
+
+	var latest struct {
+		CarbonIntensity *float64 `json:"carbonIntensity"`
+		Datetime        string   `json:"datetime"`
+	}
+	if err := p.get(ctx, "/v3/carbon-intensity/latest", zone, &latest, false); err != nil {
+		return nil, err
+	}
+	start, err := time.Parse(time.RFC3339, latest.Datetime)
+	if err != nil {
+		return nil, fmt.Errorf("electricity maps latest intensity of %s: invalid datetime %q", zone, latest.Datetime)
+	}
+	start = start.UTC().Truncate(time.Hour)
+	points := []ForecastPoint{{Start: start, End: start.Add(time.Hour), Forecast: latest.CarbonIntensity, Index: intensityIndex(latest.CarbonIntensity)}}
+
+	var forecast struct {
+		Forecast []struct {
+			CarbonIntensity *float64 `json:"carbonIntensity"`
+			Datetime        string   `json:"datetime"`
+		} `json:"forecast"`
+	}
+	err = p.get(ctx, "/v3/carbon-intensity/forecast", zone, &forecast, true)
+	if errors.Is(err, errForecastUnavailable) {
+		return points, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range forecast.Forecast {
+		slotStart, err := time.Parse(time.RFC3339, entry.Datetime)
+		if err != nil || !slotStart.After(start) {
+			continue
+		}
+		slotStart = slotStart.UTC()
+		points = append(points, ForecastPoint{Start: slotStart, End: slotStart.Add(time.Hour), Forecast: entry.CarbonIntensity, Index: intensityIndex(entry.CarbonIntensity)})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Start.Before(points[j].Start) })
+	return points, nil
+}
+
+// get decodes the answer of path for zone into out. With planned, the answers
+// refusing an endpoint outside the plan of the token are errForecastUnavailable.
+func (p electricityMaps) get(ctx context.Context, path, zone string, out interface{}, planned bool) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+path+"?"+url.Values{"zone": {zone}}.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("auth-token", p.token)
+	resp, err := forecastClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch electricity maps %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case planned && (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound):
+		return errForecastUnavailable
+	case resp.StatusCode >= http.StatusBadRequest:
+		return fmt.Errorf("fetch electricity maps %s of %s: %s", path, zone, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode electricity maps %s: %w", path, err)
+	}
+	return nil
+}
+
+// intensityIndex bands an intensity in gCO2/kWh into the index levels of the
+// Carbon Intensity API, for providers reporting none.
+func intensityIndex(value *float64) string {
+	switch {
+	case value == nil:
+		return ""
+	case *value < 40:
+		return "very low"
+	case *value < 120:
+		return "low"
+	case *value < 200:
+		return "moderate"
+	case *value < 290:
+		return "high"
+	default:
+		return "very high"
+	}
+}
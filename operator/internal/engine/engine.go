@@ -0,0 +1,227 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package engine is an in-process decision engine. It ports the credit
+// scheduler, the carbon-aware policies and the scaling directive of the
+// external Python service, so small installs can compute TrafficSchedule
+// decisions inside the operator without an HTTP dependency.
+package engine
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// ErrNotConfigured is returned for schedules never passed to Configure.
+var ErrNotConfigured = errors.New("schedule is not configured")
+
+// Options tune the embedded engine.
+type Options struct {
+	// CarbonAPIURL is the base URL of the carbon intensity API.
+	CarbonAPIURL string
+	// EvaluationInterval is how long a decision is reused before the policy
+	// runs again and the credit ledger advances. Defaults to 15 seconds.
+	EvaluationInterval time.Duration
+}
+
+// Engine keeps one scheduling session per TrafficSchedule.
+type Engine struct {
+	opts     Options
+	mu       sync.Mutex
+	sessions map[types.NamespacedName]*session
+}
+
+// New returns an Engine without sessions.
+func New(opts Options) *Engine {
+	if opts.CarbonAPIURL == "" {
+		opts.CarbonAPIURL = DefaultCarbonAPIURL
+	}
+	if opts.EvaluationInterval <= 0 {
+		opts.EvaluationInterval = 15 * time.Second
+	}
+	return &Engine{opts: opts, sessions: map[types.NamespacedName]*session{}}
+}
+
+// session is the scheduler state of one TrafficSchedule.
+type session struct {
+	mu        sync.Mutex
+	config    Config
+	settings  settings
+	policy    policy
+	flavours  []Flavour
+	ledger    *creditLedger
+	carbon    *ForecastCache
+	zones     map[string]*ForecastCache
+	schedule  *Schedule
+	evaluated time.Time
+}
+
+// Configure applies the configuration of a schedule. A changed configuration
+// starts a new session, resetting the credit ledger like the external engine,
+// except when only the flavours changed, as their measured carbon cost does.
+func (e *Engine) Configure(ctx context.Context, key types.NamespacedName, cfg Config) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if current, ok := e.sessions[key]; ok {
+		if reflect.DeepEqual(current.config, cfg) {
+			return
+		}
+		if current.sameButFlavours(cfg) {
+			flavours := withResourceIntensity(byPrecision(cfg.Flavours))
+			if len(flavours) == 0 {
+				flavours = defaultFlavours()
+			}
+			current.mu.Lock()
+			current.config, current.flavours = cfg, flavours
+			current.mu.Unlock()
+			return
+		}
+	}
+
+	s := cfg.settings()
+	selected, ok := policies[s.policy]
+	if !ok {
+		ctrl.LoggerFrom(ctx).WithName("[Engine]").Info("Unknown policy, falling back to credit-greedy", "schedule", key, "policy", s.policy)
+		s.policy = policyCreditGreedy
+		selected = creditGreedy
+	}
+	flavours := withResourceIntensity(byPrecision(cfg.Flavours))
+	if len(flavours) == 0 {
+		flavours = defaultFlavours()
+	}
+	provider, ttl := cfg.Carbon, s.carbonCacheTTL
+	if provider == nil {
+		provider = NewCarbonIntensityAPI(e.opts.CarbonAPIURL)
+	} else if cfg.CarbonCacheTTL == nil {
+		ttl = DefaultProviderCacheTTL
+	}
+	zones := make(map[string]*ForecastCache, len(cfg.Zones))
+	for _, zone := range cfg.Zones {
+		if zone.Name != "" && zone.CarbonTarget != "" {
+			zones[zone.Name] = NewForecastCache(provider, zone.CarbonTarget, s.carbonTimeout, ttl)
+		}
+	}
+	e.sessions[key] = &session{
+		config:   cfg,
+		settings: s,
+		policy:   selected,
+		flavours: flavours,
+		ledger:   newCreditLedger(s),
+		carbon:   NewForecastCache(provider, s.carbonTarget, s.carbonTimeout, ttl),
+		zones:    zones,
+	}
+}
+
+// sameButFlavours reports whether cfg only changes the flavours of s.
+func (s *session) sameButFlavours(cfg Config) bool {
+	current := s.config
+	current.Flavours = cfg.Flavours
+	return reflect.DeepEqual(current, cfg)
+}
+
+// Forget drops the session of a deleted schedule.
+func (e *Engine) Forget(key types.NamespacedName) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.sessions, key)
+}
+
+// Schedule returns the current decision of a schedule, evaluating the policy
+// again once the previous decision is older than the evaluation interval.
+func (e *Engine) Schedule(ctx context.Context, key types.NamespacedName) (Schedule, error) {
+	e.mu.Lock()
+	sess, ok := e.sessions[key]
+	e.mu.Unlock()
+	if !ok {
+		return Schedule{}, ErrNotConfigured
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	now := time.Now().UTC()
+	if sess.schedule != nil && now.Sub(sess.evaluated) < e.opts.EvaluationInterval {
+		return *sess.schedule, nil
+	}
+	schedule := sess.evaluate(ctx, now)
+	sess.schedule = &schedule
+	sess.evaluated = now
+	return schedule, nil
+}
+
+func (s *session) evaluate(ctx context.Context, now time.Time) Schedule {
+	log := ctrl.LoggerFrom(ctx).WithName("[Engine]")
+	fc, err := s.carbon.fetch(ctx)
+	if err != nil {
+		log.Error(err, "Carbon forecast unavailable, evaluating without it")
+	}
+
+	result := s.policy(s.flavours, s.ledger, fc)
+	balance := s.ledger.update(result.avgPrecision)
+	scaled := percentages(result.weights)
+
+	schedule := Schedule{
+		FlavourWeights: scaled,
+		ValidUntil:     validUntil(now, s.settings.validFor, fc).Format(validUntilLayout),
+		Credits: Credits{
+			Balance:   balance,
+			Velocity:  s.ledger.velocity(),
+			Target:    s.settings.targetError,
+			Min:       s.settings.creditMin,
+			Max:       s.settings.creditMax,
+			Allowance: result.diagnostics["allowance"],
+		},
+		Policy:       PolicyRef{Name: s.settings.policy},
+		Diagnostics:  result.diagnostics,
+		AvgPrecision: result.avgPrecision,
+		Processing:   scalingDirective(balance, s.settings, fc, s.config.Components),
+		Carbon:       Carbon{Now: fc.now, Next: fc.next, Schedule: upcomingSlots(fc.schedule, now)},
+	}
+	if len(fc.schedule) > 0 {
+		schedule.Carbon.Index = fc.schedule[0].Index
+	}
+	for _, flavour := range s.flavours {
+		schedule.Flavours = append(schedule.Flavours, FlavourWeight{
+			Name:            flavour.Name,
+			Precision:       int(math.Round(flavour.Precision * 100)),
+			Weight:          scaled[flavour.Name],
+			CarbonIntensity: flavour.CarbonIntensity,
+			Enabled:         flavour.Enabled,
+		})
+	}
+
+	// Zones without a forecast are left out, so locality routing never uses stale data
+	for name, provider := range s.zones {
+		zone, err := provider.fetch(ctx)
+		if err != nil || zone.now == nil {
+			if err != nil {
+				log.Error(err, "Zone forecast unavailable", "zone", name)
+			}
+			continue
+		}
+		if schedule.Zones == nil {
+			schedule.Zones = map[string]float64{}
+		}
+		schedule.Zones[name] = *zone.now
+	}
+	return schedule
+}
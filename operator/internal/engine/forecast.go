@@ -0,0 +1,215 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCarbonAPIURL is the Carbon Intensity API of the GB grid, also used by
+// the external decision engine.
+const DefaultCarbonAPIURL = "https://api.carbonintensity.org.uk"
+
+// forecastClient fetches the forecasts of the providers, within the timeout
+// of the ForecastCache in the context.
+var forecastClient = &http.Client{Timeout: 30 * time.Second}
+
+// ForecastPoint is the intensity forecast of one grid slot, in gCO2/kWh.
+type ForecastPoint struct {
+	Start    time.Time
+	End      time.Time
+	Forecast *float64
+	// Index is the qualitative intensity band of the slot, such as "low".
+	Index string
+}
+
+// CarbonProvider fetches the intensity forecast of a grid target, such as
+// "region:13" for the Carbon Intensity API or a zone for Electricity Maps.
+type CarbonProvider interface {
+	// Forecast returns the slots of the forecast in start order, from the
+	// current one.
+	Forecast(ctx context.Context, target string) ([]ForecastPoint, error)
+}
+
+// forecast is the carbon signal a policy is evaluated against.
+type forecast struct {
+	now      *float64
+	next     *float64
+	schedule []ForecastPoint
+}
+
+// ForecastCache fetches the forecast of a target from a CarbonProvider,
+// caching it for a TTL.
+type ForecastCache struct {
+	provider CarbonProvider
+	target   string
+	timeout  time.Duration
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	fetched time.Time
+	points  []ForecastPoint
+}
+
+// NewForecastCache returns a cache of the forecast of target, fetched from
+// provider within timeout and kept for ttl.
+func NewForecastCache(provider CarbonProvider, target string, timeout, ttl time.Duration) *ForecastCache {
+	return &ForecastCache{provider: provider, target: target, timeout: timeout, ttl: ttl}
+}
+
+// Carbon returns the current forecast as published in a Schedule. Failures
+// yield an empty forecast.
+func (c *ForecastCache) Carbon(ctx context.Context, now time.Time) (Carbon, error) {
+	fc, err := c.fetch(ctx)
+	carbon := Carbon{Now: fc.now, Next: fc.next, Schedule: upcomingSlots(fc.schedule, now)}
+	if len(fc.schedule) > 0 {
+		carbon.Index = fc.schedule[0].Index
+	}
+	return carbon, err
+}
+
+// fetch returns the current forecast. Failures yield an empty forecast, which
+// policies treat as an unknown signal.
+func (c *ForecastCache) fetch(ctx context.Context) (forecast, error) {
+	points, err := c.load(ctx)
+	if len(points) == 0 {
+		return forecast{}, err
+	}
+	fc := forecast{now: points[0].Forecast, next: points[0].Forecast, schedule: points}
+	if len(points) > 1 {
+		fc.next = points[1].Forecast
+	}
+	return fc, err
+}
+
+func (c *ForecastCache) load(ctx context.Context) ([]ForecastPoint, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.points != nil && time.Since(c.fetched) < c.ttl {
+		return c.points, nil
+	}
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	points, err := c.provider.Forecast(ctx, c.target)
+	if err != nil || len(points) == 0 {
+		return nil, err
+	}
+	c.points = points
+	c.fetched = time.Now()
+	return points, nil
+}
+
+// carbonIntensityAPI is the CarbonProvider of the Carbon Intensity API of the
+// GB grid, the source of the external decision engine.
+type carbonIntensityAPI struct {
+	baseURL string
+}
+
+// NewCarbonIntensityAPI returns the CarbonProvider of the Carbon Intensity API
+// at baseURL, whose targets are "national", "region:<id>" or
+// "postcode:<outcode>".
+func NewCarbonIntensityAPI(baseURL string) CarbonProvider {
+	return carbonIntensityAPI{baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+func (p carbonIntensityAPI) Forecast(ctx context.Context, target string) ([]ForecastPoint, error) {
+	url := p.baseURL + p.schedulePath(target, time.Now().UTC())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := forecastClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch carbon forecast: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("fetch carbon forecast %s: %s", url, resp.Status)
+	}
+
+	var payload struct {
+		Data []struct {
+			From      string `json:"from"`
+			To        string `json:"to"`
+			Intensity struct {
+				Forecast *float64 `json:"forecast"`
+				Actual   *float64 `json:"actual"`
+				Index    string   `json:"index"`
+			} `json:"intensity"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("decode carbon forecast: %w", err)
+	}
+
+	windowStart := time.Now().Add(-30 * time.Minute)
+	points := make([]ForecastPoint, 0, len(payload.Data))
+	for _, entry := range payload.Data {
+		start, errStart := parseSlotTime(entry.From)
+		end, errEnd := parseSlotTime(entry.To)
+		if errStart != nil || errEnd != nil || end.Before(windowStart) {
+			continue
+		}
+		value := entry.Intensity.Forecast
+		if value == nil {
+			value = entry.Intensity.Actual
+		}
+		points = append(points, ForecastPoint{Start: start, End: end, Forecast: value, Index: entry.Intensity.Index})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Start.Before(points[j].Start) })
+	return points, nil
+}
+
+// schedulePath mirrors the paths queried by the external decision engine:
+// "national", "region:<id>" or "postcode:<outcode>" targets over 48 hours.
+// Mock APIs on localhost get second precision for fast test patterns.
+func (p carbonIntensityAPI) schedulePath(target string, start time.Time) string {
+	layout := "2006-01-02T15:04Z"
+	if strings.Contains(p.baseURL, "localhost") || strings.Contains(p.baseURL, "host.docker.internal") {
+		layout = "2006-01-02T15:04:05Z"
+	}
+	from := start.Format(layout)
+	target = strings.TrimSpace(target)
+	lowered := strings.ToLower(target)
+	switch {
+	case strings.HasPrefix(lowered, "region:"):
+		return fmt.Sprintf("/regional/intensity/%s/fw48h/regionid/%s", from, strings.TrimSpace(target[len("region:"):]))
+	case strings.HasPrefix(lowered, "postcode:"):
+		return fmt.Sprintf("/regional/intensity/%s/fw48h/postcode/%s", from, strings.ToUpper(strings.TrimSpace(target[len("postcode:"):])))
+	default:
+		return fmt.Sprintf("/intensity/%s/fw48h", from)
+	}
+}
+
+func parseSlotTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid slot time %q", value)
+}
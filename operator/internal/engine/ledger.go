@@ -0,0 +1,69 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+// creditLedger balances the realised precision error against the target. A
+// positive balance is a quality surplus that may be spent on greener flavours,
+// a negative one a debt that must be repaid with higher precision.
+type creditLedger struct {
+	targetError float64
+	min         float64
+	max         float64
+	sensitivity float64
+	window      int
+	history     []float64
+	balance     float64
+}
+
+func newCreditLedger(s settings) *creditLedger {
+	return &creditLedger{
+		targetError: s.targetError,
+		min:         s.creditMin,
+		max:         s.creditMax,
+		sensitivity: s.creditSensitivity,
+		window:      s.creditWindow,
+	}
+}
+
+// update records the precision served over the last window and returns the
+// new balance, clamped to [min, max].
+func (l *creditLedger) update(precision float64) float64 {
+	realised := max(0, 1-precision)
+	delta := (l.targetError - realised) * l.sensitivity
+	l.history = append(l.history, delta)
+	if len(l.history) > l.window {
+		l.history = l.history[len(l.history)-l.window:]
+	}
+	l.balance = clamp(l.balance+delta, l.min, l.max)
+	return l.balance
+}
+
+// velocity is the average credit delta over the window.
+func (l *creditLedger) velocity() float64 {
+	if len(l.history) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, delta := range l.history {
+		sum += delta
+	}
+	return sum / float64(len(l.history))
+}
+
+func clamp(value, low, high float64) float64 {
+	return max(low, min(value, high))
+}
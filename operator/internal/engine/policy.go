@@ -0,0 +1,235 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	policyCreditGreedy  = "credit-greedy"
+	policyForecastAware = "forecast-aware"
+	policyP100          = "p100"
+)
+
+// policyResult is the flavour distribution chosen by a policy, with weights
+// summing to 1.
+type policyResult struct {
+	weights      map[string]float64
+	avgPrecision float64
+	diagnostics  map[string]float64
+}
+
+type policy func(flavours []Flavour, ledger *creditLedger, fc forecast) policyResult
+
+// policies are the ports of the external engine policies of the same name.
+var policies = map[string]policy{
+	policyCreditGreedy:  creditGreedy,
+	policyForecastAware: forecastAware,
+	policyP100:          p100,
+}
+
+// byPrecision returns the enabled flavours, highest precision first.
+func byPrecision(flavours []Flavour) []Flavour {
+	out := make([]Flavour, 0, len(flavours))
+	for _, flavour := range flavours {
+		if flavour.Enabled {
+			out = append(out, flavour)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Precision > out[j].Precision })
+	return out
+}
+
+// withResourceIntensity estimates the carbon cost of the flavours without one
+// from their CPU, relative to the flavour with the most, so that right-sized
+// requests stand in for the carbonstat.emissions label.
+func withResourceIntensity(flavours []Flavour) []Flavour {
+	maxCPU := 0.0
+	for _, flavour := range flavours {
+		if flavour.Resources != nil {
+			maxCPU = max(maxCPU, flavour.Resources.CPU)
+		}
+	}
+	if maxCPU <= 0 {
+		return flavours
+	}
+	for i, flavour := range flavours {
+		if flavour.CarbonIntensity == 0 && flavour.Resources != nil {
+			flavours[i].CarbonIntensity = flavour.Resources.CPU / maxCPU
+		}
+	}
+	return flavours
+}
+
+func averagePrecision(flavours []Flavour, weights map[string]float64) float64 {
+	avg := 0.0
+	for _, flavour := range flavours {
+		avg += weights[flavour.Name] * flavour.Precision
+	}
+	return avg
+}
+
+func normalise(weights map[string]float64) {
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+	if total == 0 {
+		total = 1
+	}
+	for name := range weights {
+		weights[name] /= total
+	}
+}
+
+// carbonScore favours flavours saving the most carbon per unit of error.
+func carbonScore(baseline, flavour Flavour) float64 {
+	gain := baseline.CarbonIntensity - flavour.CarbonIntensity
+	penalty := max(1e-6, 1-flavour.Precision)
+	score := 1e-6
+	if gain > 0 {
+		score = gain
+	}
+	return max(1e-6, score/penalty)
+}
+
+// creditGreedy spends credit on greener flavours, more eagerly the dirtier the
+// current grid, while keeping the error in check.
+func creditGreedy(flavours []Flavour, ledger *creditLedger, fc forecast) policyResult {
+	sorted := byPrecision(flavours)
+	baseline := sorted[0]
+
+	span := ledger.max - ledger.min
+	if span == 0 {
+		span = 1
+	}
+	normalisedCredit := (ledger.balance - ledger.min) / span
+	baseAllowance := clamp(normalisedCredit, 0, 1)
+	// Already in quality debt: shrink the allowance
+	if ledger.balance < 0 && ledger.min < 0 {
+		debtRatio := min(1, math.Abs(ledger.balance)/math.Abs(ledger.min))
+		baseAllowance *= max(0.2, 1-0.5*debtRatio)
+	}
+
+	diagnostics := map[string]float64{}
+	carbonMultiplier := 1.0
+	if fc.now != nil {
+		const lowCarbon, highCarbon = 80.0, 280.0
+		carbonRatio := clamp((*fc.now-lowCarbon)/(highCarbon-lowCarbon), 0, 1)
+		carbonMultiplier = 0.3 + 1.7*carbonRatio
+		diagnostics["carbon_now"] = *fc.now
+		diagnostics["carbon_ratio"] = carbonRatio
+	}
+	allowance := clamp(baseAllowance*carbonMultiplier, 0, 0.95)
+
+	weights := map[string]float64{baseline.Name: max(0, 1-allowance)}
+	if greener := sorted[1:]; len(greener) > 0 {
+		scores := make([]float64, len(greener))
+		sum := 0.0
+		for i, flavour := range greener {
+			scores[i] = carbonScore(baseline, flavour)
+			sum += scores[i]
+		}
+		if sum == 0 {
+			sum = float64(len(scores))
+		}
+		for i, flavour := range greener {
+			weights[flavour.Name] = allowance * scores[i] / sum
+		}
+	}
+	normalise(weights)
+
+	avg := averagePrecision(sorted, weights)
+	diagnostics["credit_balance"] = ledger.balance
+	diagnostics["base_allowance"] = baseAllowance
+	diagnostics["carbon_multiplier"] = carbonMultiplier
+	diagnostics["allowance"] = allowance
+	diagnostics["avg_precision"] = avg
+	diagnostics["normalised_credit"] = normalisedCredit
+	return policyResult{weights: weights, avgPrecision: avg, diagnostics: diagnostics}
+}
+
+// forecastAware adjusts the credit-greedy split to the intensity trend: it
+// spends quality now when the grid gets dirtier and saves it when it gets
+// greener. Trends under 15 gCO2/kWh are ignored to avoid oscillation.
+func forecastAware(flavours []Flavour, ledger *creditLedger, fc forecast) policyResult {
+	base := creditGreedy(flavours, ledger, fc)
+	if fc.now == nil || fc.next == nil {
+		return base
+	}
+	trend := *fc.next - *fc.now
+	if math.Abs(trend) < 15 {
+		return base
+	}
+	relative := math.Abs(trend) / max(*fc.now, 1e-6) * 0.25
+	adjustment := min(0.15, relative)
+	if trend > 0 {
+		adjustment = -adjustment
+	}
+
+	sorted := byPrecision(flavours)
+	baseline := sorted[0].Name
+	weights := base.weights
+	if len(weights) > 1 {
+		baselineWeight := weights[baseline]
+		nonBaseline := 1 - baselineWeight
+		switch {
+		case adjustment > 0 && nonBaseline > 0:
+			shift := min(adjustment, baselineWeight)
+			baselineWeight = max(0.05, baselineWeight-shift)
+			weights[baseline] = baselineWeight
+			scale := (nonBaseline + shift) / nonBaseline
+			for name := range weights {
+				if name != baseline {
+					weights[name] = min(0.95, weights[name]*scale)
+				}
+			}
+		case adjustment < 0:
+			shift := min(-adjustment, nonBaseline)
+			for name := range weights {
+				if name == baseline {
+					continue
+				}
+				portion := 0.0
+				if nonBaseline > 0 {
+					portion = weights[name] / nonBaseline
+				}
+				weights[name] = max(0.02, weights[name]-shift*portion)
+			}
+			weights[baseline] = min(0.98, baselineWeight+shift)
+		}
+	}
+	normalise(weights)
+
+	base.avgPrecision = averagePrecision(sorted, weights)
+	base.diagnostics["trend"] = trend
+	base.diagnostics["adjustment"] = adjustment
+	base.diagnostics["baseline_weight"] = weights[baseline]
+	return base
+}
+
+// p100 always routes everything to the highest precision.
+func p100(flavours []Flavour, _ *creditLedger, _ forecast) policyResult {
+	best := byPrecision(flavours)[0]
+	return policyResult{
+		weights:      map[string]float64{best.Name: 1},
+		avgPrecision: best.Precision,
+		diagnostics:  map[string]float64{"selected_flavour": best.Precision},
+	}
+}
@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"testing"
+
+	"k8s.io/utils/ptr"
+)
+
+func near(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
+
+func TestCreditLedgerUpdate(t *testing.T) {
+	ledger := newCreditLedger(settings{targetError: 0.1, creditMin: -1, creditMax: 1, creditSensitivity: 1, creditWindow: 2})
+	steps := []struct {
+		name      string
+		precision float64
+		balance   float64
+		velocity  float64
+	}{
+		{name: "full precision is a surplus", precision: 1, balance: 0.1, velocity: 0.1},
+		{name: "error over the target is a debt", precision: 0.5, balance: -0.3, velocity: -0.15},
+		{name: "balance is clamped, velocity only spans the window", precision: 0, balance: -1, velocity: -0.65},
+	}
+	for _, step := range steps {
+		balance := ledger.update(step.precision)
+		if !near(balance, step.balance) || !near(ledger.velocity(), step.velocity) {
+			t.Errorf("%s: got balance %v velocity %v, want %v and %v", step.name, balance, ledger.velocity(), step.balance, step.velocity)
+		}
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	flavours := []Flavour{
+		{Name: "precision-50", Precision: 0.5, CarbonIntensity: 0.5, Enabled: true},
+		{Name: "precision-100", Precision: 1, CarbonIntensity: 1, Enabled: true},
+		{Name: "precision-30", Precision: 0.3, CarbonIntensity: 0.3},
+	}
+	precisions := map[string]float64{"precision-100": 1, "precision-50": 0.5}
+	tests := []struct {
+		name   string
+		policy string
+		fc     forecast
+		want   map[string]float64
+	}{
+		{name: "p100", policy: policyP100,
+			want: map[string]float64{"precision-100": 1}},
+		{name: "credit-greedy spends the credit", policy: policyCreditGreedy,
+			want: map[string]float64{"precision-100": 0.5, "precision-50": 0.5}},
+		{name: "credit-greedy spends more on a dirty grid", policy: policyCreditGreedy, fc: forecast{now: ptr.To(280.0)},
+			want: map[string]float64{"precision-100": 0.05, "precision-50": 0.95}},
+		{name: "credit-greedy saves on a clean grid", policy: policyCreditGreedy, fc: forecast{now: ptr.To(80.0)},
+			want: map[string]float64{"precision-100": 0.85, "precision-50": 0.15}},
+		{name: "forecast-aware ignores a flat trend", policy: policyForecastAware, fc: forecast{now: ptr.To(200.0), next: ptr.To(210.0)},
+			want: map[string]float64{"precision-100": 0.34, "precision-50": 0.66}},
+		{name: "forecast-aware follows a rising trend", policy: policyForecastAware, fc: forecast{now: ptr.To(200.0), next: ptr.To(300.0)},
+			want: map[string]float64{"precision-100": 0.465, "precision-50": 0.535}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newCreditLedger(settings{creditMin: -1, creditMax: 1, creditWindow: 1})
+			got := policies[tt.policy](flavours, ledger, tt.fc)
+			if len(got.weights) != len(tt.want) {
+				t.Fatalf("got weights %v, want %v", got.weights, tt.want)
+			}
+			avg := 0.0
+			for name, weight := range tt.want {
+				if !near(got.weights[name], weight) {
+					t.Errorf("got weights %v, want %v", got.weights, tt.want)
+					break
+				}
+				avg += weight * precisions[name]
+			}
+			if !near(got.avgPrecision, avg) {
+				t.Errorf("got average precision %v, want %v", got.avgPrecision, avg)
+			}
+		})
+	}
+}
+
+func TestWithResourceIntensity(t *testing.T) {
+	flavours := withResourceIntensity([]Flavour{
+		{Name: "precision-100", Resources: &Resources{CPU: 2}},
+		{Name: "precision-50", Resources: &Resources{CPU: 0.5}},
+		{Name: "precision-30", CarbonIntensity: 0.1, Resources: &Resources{CPU: 0.25}},
+		{Name: "precision-10"},
+	})
+	want := []float64{1, 0.25, 0.1, 0}
+	for i, flavour := range flavours {
+		if !near(flavour.CarbonIntensity, want[i]) {
+			t.Errorf("%s: got intensity %v, want %v", flavour.Name, flavour.CarbonIntensity, want[i])
+		}
+	}
+	unsized := []Flavour{{Name: "precision-100", Resources: &Resources{Memory: 1 << 30}}}
+	if got := withResourceIntensity(unsized); got[0].CarbonIntensity != 0 {
+		t.Errorf("got intensity %v without CPU requests, want none", got[0].CarbonIntensity)
+	}
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// greenBlendWeight pulls the throttle towards the intensity ratio when the
+	// grid is greener than the credit balance suggests.
+	greenBlendWeight = 0.6
+	// greenOverrideThreshold lifts every throttle once the grid is this green.
+	greenOverrideThreshold = 0.99
+	validUntilLayout       = "2006-01-02T15:04:05Z"
+)
+
+// Schedule is a scheduling decision, in the JSON format served by GET
+// /schedule/<ns>/<name> of the external decision engine.
+type Schedule struct {
+	FlavourWeights map[string]int     `json:"flavourWeights"`
+	Flavours       []FlavourWeight    `json:"flavours"`
+	ValidUntil     string             `json:"validUntil"`
+	Credits        Credits            `json:"credits"`
+	Policy         PolicyRef          `json:"policy"`
+	Diagnostics    map[string]float64 `json:"diagnostics"`
+	AvgPrecision   float64            `json:"avgPrecision"`
+	Processing     Processing         `json:"processing"`
+	Carbon         Carbon             `json:"carbon"`
+	Zones          map[string]float64 `json:"zones,omitempty"`
+}
+
+// FlavourWeight is the share of traffic assigned to a flavour.
+type FlavourWeight struct {
+	Name string `json:"name"`
+	// Precision is an integer percentage.
+	Precision       int     `json:"precision"`
+	Weight          int     `json:"weight"`
+	CarbonIntensity float64 `json:"carbonIntensity"`
+	Enabled         bool    `json:"enabled"`
+}
+
+// Credits is the state of the credit ledger.
+type Credits struct {
+	Balance   float64 `json:"balance"`
+	Velocity  float64 `json:"velocity"`
+	Target    float64 `json:"target"`
+	Min       float64 `json:"min"`
+	Max       float64 `json:"max"`
+	Allowance float64 `json:"allowance"`
+}
+
+// PolicyRef names the policy that produced a schedule.
+type PolicyRef struct {
+	Name string `json:"name"`
+}
+
+// Processing is the autoscaling directive: a throttle between 0 and 1 and the
+// replica ceilings it yields per component.
+type Processing struct {
+	Throttle       float64          `json:"throttle"`
+	CreditsRatio   float64          `json:"creditsRatio"`
+	IntensityRatio float64          `json:"intensityRatio"`
+	Ceilings       map[string]int32 `json:"ceilings"`
+}
+
+// Carbon is the grid intensity of the current and next slots, in gCO2/kWh.
+type Carbon struct {
+	Now  *float64 `json:"now,omitempty"`
+	Next *float64 `json:"next,omitempty"`
+	// Index is the intensity band of the current slot, when the provider
+	// reports one.
+	Index string `json:"index,omitempty"`
+	// Schedule lists the slots that have not ended yet, up to a day ahead.
+	Schedule []ForecastSlot `json:"schedule,omitempty"`
+}
+
+// ForecastSlot is the forecast of one slot, with RFC 3339 bounds.
+type ForecastSlot struct {
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Forecast *float64 `json:"forecast"`
+	Index    string   `json:"index,omitempty"`
+}
+
+// maxPublishedSlots bounds Carbon.Schedule to a day of half-hour slots.
+const maxPublishedSlots = 48
+
+func upcomingSlots(points []ForecastPoint, now time.Time) []ForecastSlot {
+	var slots []ForecastSlot
+	for _, point := range points {
+		if !point.End.After(now) {
+			continue
+		}
+		if len(slots) == maxPublishedSlots {
+			break
+		}
+		slots = append(slots, ForecastSlot{
+			From:     point.Start.UTC().Format(time.RFC3339),
+			To:       point.End.UTC().Format(time.RFC3339),
+			Forecast: point.Forecast,
+			Index:    point.Index,
+		})
+	}
+	return slots
+}
+
+// scalingDirective throttles processing when credits run low or the grid is
+// dirty, and further when a much greener slot is coming up, so deferrable work
+// shifts into it.
+func scalingDirective(balance float64, s settings, fc forecast, bounds map[string]ReplicaBounds) Processing {
+	creditsRatio := 1.0
+	if span := s.creditMax - s.creditMin; span > 0 {
+		creditsRatio = clamp((balance-s.creditMin)/span, 0, 1)
+	}
+
+	intensityRatio := 1.0
+	if s.throttleIntensityCeiling > s.throttleIntensityFloor && (fc.now != nil || fc.next != nil) {
+		peak := math.Inf(-1)
+		for _, value := range []*float64{fc.now, fc.next} {
+			if value != nil {
+				peak = max(peak, *value)
+			}
+		}
+		intensityRatio = clamp((s.throttleIntensityCeiling-peak)/(s.throttleIntensityCeiling-s.throttleIntensityFloor), 0, 1)
+	}
+
+	throttle := clamp(min(creditsRatio, intensityRatio), s.throttleMin, 1)
+	if intensityRatio >= greenOverrideThreshold {
+		throttle = 1
+	} else if intensityRatio > creditsRatio {
+		blended := creditsRatio + (intensityRatio-creditsRatio)*greenBlendWeight
+		throttle = clamp(max(throttle, blended), s.throttleMin, 1)
+	}
+
+	if fc.now != nil && *fc.now > 0 {
+		lowest := math.Inf(1)
+		for i, point := range fc.schedule {
+			if i == 6 {
+				break
+			}
+			if point.Forecast != nil {
+				lowest = min(lowest, *point.Forecast)
+			}
+		}
+		if lowest > 0 && !math.IsInf(lowest, 1) {
+			if opportunity := *fc.now / lowest; opportunity > 1.2 {
+				throttle = max(s.throttleMin, throttle/opportunity)
+			}
+		}
+	}
+
+	ceilings := map[string]int32{}
+	for component, bound := range bounds {
+		if bound.MaxReplicas == nil {
+			continue
+		}
+		ceiling := int32(math.Round(float64(*bound.MaxReplicas) * throttle))
+		if bound.MinReplicas != nil {
+			ceiling = max(ceiling, *bound.MinReplicas)
+		}
+		ceilings[component] = max(0, min(ceiling, *bound.MaxReplicas))
+	}
+
+	return Processing{
+		Throttle:       throttle,
+		CreditsRatio:   creditsRatio,
+		IntensityRatio: intensityRatio,
+		Ceilings:       ceilings,
+	}
+}
+
+// percentages turns policy weights into integer percentages summing to 100,
+// giving the rounding error to the largest share.
+func percentages(weights map[string]float64) map[string]int {
+	out := make(map[string]int, len(weights))
+	total := 0
+	largest := ""
+	for name, weight := range weights {
+		out[name] = int(math.Round(weight * 100))
+		total += out[name]
+		if largest == "" || out[name] > out[largest] || (out[name] == out[largest] && name < largest) {
+			largest = name
+		}
+	}
+	if largest != "" {
+		out[largest] += 100 - total
+	}
+	return out
+}
+
+// validUntil ends the schedule after validFor, or earlier at the end of the
+// current grid slot.
+func validUntil(now time.Time, validFor time.Duration, fc forecast) time.Time {
+	until := now.Add(validFor)
+	for _, point := range fc.schedule {
+		if point.End.After(now) {
+			if point.End.Before(until) {
+				until = point.End
+			}
+			break
+		}
+	}
+	return until
+}
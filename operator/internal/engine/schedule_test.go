@@ -0,0 +1,35 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/utils/ptr"
+)
+
+func TestUpcomingSlots(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 10, 0, 0, time.UTC)
+	var points []ForecastPoint
+	for i := -2; i < 60; i++ {
+		start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC).Add(time.Duration(i) * 30 * time.Minute)
+		points = append(points, ForecastPoint{Start: start, End: start.Add(30 * time.Minute), Forecast: ptr.To(float64(200 + i)), Index: "moderate"})
+	}
+	slots := upcomingSlots(points, now)
+	if len(slots) != maxPublishedSlots {
+		t.Fatalf("got %d slots, want a day of them", len(slots))
+	}
+	first := slots[0]
+	if first.From != "2025-06-01T12:00:00Z" || first.To != "2025-06-01T12:30:00Z" || *first.Forecast != 200 || first.Index != "moderate" {
+		t.Errorf("got first slot %+v, want the current one", first)
+	}
+
+	// Bounds are published in UTC
+	local := time.FixedZone("CEST", 2*60*60)
+	slots = upcomingSlots([]ForecastPoint{{Start: now.In(local), End: now.Add(time.Hour).In(local)}}, now)
+	if len(slots) != 1 || slots[0].From != "2025-06-01T12:10:00Z" || slots[0].Forecast != nil {
+		t.Errorf("got %+v, want the slot in UTC without a forecast", slots)
+	}
+	if slots := upcomingSlots(points[:2], now); slots != nil {
+		t.Errorf("got %+v, want the past slots dropped", slots)
+	}
+}
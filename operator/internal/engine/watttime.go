@@ -0,0 +1,263 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWattTimeURL is the WattTime API.
+	DefaultWattTimeURL = "https://api.watttime.org"
+	// wattTimeSignal is the marginal operating emissions rate, the emissions
+	// of the power plants answering a change in demand.
+	wattTimeSignal = "co2_moer"
+	// wattTimeTokenTTL renews the login tokens, valid for 30 minutes, ahead
+	// of their expiry.
+	wattTimeTokenTTL = 25 * time.Minute
+	// lbsPerMWhToGramsPerKWh converts the WattTime rates to gCO2/kWh.
+	lbsPerMWhToGramsPerKWh = 0.45359237
+	// wattTimeSlot is the length of the slots the five-minute forecast is
+	// averaged into, as the half-hour slots of the Carbon Intensity API.
+	wattTimeSlot = 30 * time.Minute
+)
+
+// wattTimeTokens caches the login tokens per account, across the providers
+// built on every reconcile.
+var wattTimeTokens = struct {
+	sync.Mutex
+	tokens map[string]wattTimeToken
+}{tokens: map[string]wattTimeToken{}}
+
+type wattTimeToken struct {
+	value   string
+	expires time.Time
+}
+
+// wattTime is the CarbonProvider of the WattTime API, which forecasts the
+// marginal emissions of a grid region.
+type wattTime struct {
+	baseURL  string
+	username string
+	password string
+}
+
+// NewWattTime returns the CarbonProvider of the WattTime API at baseURL for
+// the account of username and password, whose targets are regions such as
+// "CAISO_NORTH" or "region:PJM_DC".
+func NewWattTime(baseURL, username, password string) CarbonProvider {
+	return wattTime{baseURL: strings.TrimRight(baseURL, "/"), username: username, password: password}
+}
+
+// Forecast returns the marginal emissions forecast of the region in
+// half-hour slots. Each slot is indexed by its rank between the cleanest and
+// dirtiest slots of the forecast, except the current one, indexed by the
+// signal index of WattTime, the percentile of its rate over the past month.
+// Accounts without forecasts of the region only get the signal index, with
+// no intensity.
+func (p wattTime) Forecast(ctx context.Context, target string) ([]ForecastPoint, error) {
+	region := strings.TrimSpace(target)
+	if strings.HasPrefix(strings.ToLower(region), "region:") {
+		region = strings.TrimSpace(region[len("region:"):])
+	}
+	if region == "" {
+		return nil, fmt.Errorf("watttime needs a region as carbon target, got %q", target)
+	}
+	query := url.Values{"region": {region}, "signal_type": {wattTimeSignal}}
+
+	var index struct {
+		Data []struct {
+			PointTime string  `json:"point_time"`
+			Value     float64 `json:"value"`
+		} `json:"data"`
+	}
+	if err := p.get(ctx, "/v3/signal-index", query, &index, false); err != nil {
+		return nil, err
+	}
+	current := ""
+	if len(index.Data) > 0 {
+		current = percentileIndex(index.Data[0].Value)
+	}
+
+	forecastQuery := url.Values{"horizon_hours": {"24"}}
+	for key, values := range query {
+		forecastQuery[key] = values
+	}
+	var forecast struct {
+		Data []struct {
+			PointTime string  `json:"point_time"`
+			Value     float64 `json:"value"`
+		} `json:"data"`
+		Meta struct {
+			Units string `json:"units"`
+		} `json:"meta"`
+	}
+	err := p.get(ctx, "/v3/forecast", forecastQuery, &forecast, true)
+	if errors.Is(err, errForecastUnavailable) {
+		start := time.Now().UTC().Truncate(wattTimeSlot)
+		return []ForecastPoint{{Start: start, End: start.Add(wattTimeSlot), Index: current}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if forecast.Meta.Units != "" && forecast.Meta.Units != "lbs_co2_per_mwh" {
+		return nil, fmt.Errorf("watttime forecast of %s in unexpected units %q", region, forecast.Meta.Units)
+	}
+
+	// Average the five-minute points into half-hour slots
+	var points []ForecastPoint
+	var sum float64
+	var count int
+	flush := func() {
+		if count > 0 {
+			value := sum / float64(count) * lbsPerMWhToGramsPerKWh
+			points[len(points)-1].Forecast = &value
+		}
+		sum, count = 0, 0
+	}
+	for _, entry := range forecast.Data {
+		at, err := time.Parse(time.RFC3339, entry.PointTime)
+		if err != nil {
+			continue
+		}
+		start := at.UTC().Truncate(wattTimeSlot)
+		if len(points) == 0 || !points[len(points)-1].Start.Equal(start) {
+			if len(points) > 0 {
+				flush()
+			}
+			points = append(points, ForecastPoint{Start: start, End: start.Add(wattTimeSlot)})
+		}
+		sum += entry.Value
+		count++
+	}
+	flush()
+
+	lowest, highest := math.Inf(1), math.Inf(-1)
+	for _, point := range points {
+		if point.Forecast != nil {
+			lowest, highest = min(lowest, *point.Forecast), max(highest, *point.Forecast)
+		}
+	}
+	for i := range points {
+		if points[i].Forecast != nil && highest > lowest {
+			points[i].Index = percentileIndex(100 * (*points[i].Forecast - lowest) / (highest - lowest))
+		}
+	}
+	if len(points) > 0 && current != "" {
+		points[0].Index = current
+	}
+	return points, nil
+}
+
+// get decodes the answer of path into out, logging in first when the
+// account has no valid token. With planned, the answers refusing an endpoint
+// outside the plan of the account are errForecastUnavailable.
+func (p wattTime) get(ctx context.Context, path string, query url.Values, out interface{}, planned bool) error {
+	token, err := p.token(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := forecastClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch watttime %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		p.forgetToken()
+		return fmt.Errorf("fetch watttime %s: %s", path, resp.Status)
+	case planned && resp.StatusCode == http.StatusForbidden:
+		return errForecastUnavailable
+	case resp.StatusCode >= http.StatusBadRequest:
+		return fmt.Errorf("fetch watttime %s of %s: %s", path, query.Get("region"), resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode watttime %s: %w", path, err)
+	}
+	return nil
+}
+
+func (p wattTime) token(ctx context.Context) (string, error) {
+	key := p.baseURL + "|" + p.username
+	wattTimeTokens.Lock()
+	cached, ok := wattTimeTokens.tokens[key]
+	wattTimeTokens.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.value, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/login", nil)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(p.username, p.password)
+	resp, err := forecastClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("watttime login: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", fmt.Errorf("watttime login as %s: %s", p.username, resp.Status)
+	}
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Token == "" {
+		return "", fmt.Errorf("watttime login as %s: no token in the answer", p.username)
+	}
+	wattTimeTokens.Lock()
+	wattTimeTokens.tokens[key] = wattTimeToken{value: body.Token, expires: time.Now().Add(wattTimeTokenTTL)}
+	wattTimeTokens.Unlock()
+	return body.Token, nil
+}
+
+func (p wattTime) forgetToken() {
+	wattTimeTokens.Lock()
+	defer wattTimeTokens.Unlock()
+	delete(wattTimeTokens.tokens, p.baseURL+"|"+p.username)
+}
+
+// percentileIndex bands a percentile, 0 being the cleanest, into the index
+// levels of the Carbon Intensity API.
+func percentileIndex(percentile float64) string {
+	switch {
+	case percentile < 20:
+		return "very low"
+	case percentile < 40:
+		return "low"
+	case percentile < 60:
+		return "moderate"
+	case percentile < 80:
+		return "high"
+	default:
+		return "very high"
+	}
+}
@@ -0,0 +1,867 @@
+// Decision engine API used by the operator.
+//
+// It mirrors the JSON endpoints of the decision engine (PUT /config and GET
+// /schedule) and adds WatchSchedule, which streams every new decision so the
+// operator does not have to poll. Field names map to the JSON keys of the HTTP
+// API through the proto3 JSON mapping.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v5.28.3
+// source: carbonrouter/decisionengine/v1/decision_engine.proto
+
+package enginepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// ScheduleRef identifies a TrafficSchedule.
+type ScheduleRef struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Namespace     string                 `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ScheduleRef) Reset() {
+	*x = ScheduleRef{}
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ScheduleRef) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScheduleRef) ProtoMessage() {}
+
+func (x *ScheduleRef) ProtoReflect() protoreflect.Message {
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScheduleRef.ProtoReflect.Descriptor instead.
+func (*ScheduleRef) Descriptor() ([]byte, []int) {
+	return file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ScheduleRef) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *ScheduleRef) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type PutConfigRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Schedule *ScheduleRef           `protobuf:"bytes,1,opt,name=schedule,proto3" json:"schedule,omitempty"`
+	// Config is the scheduler configuration, in the format of PUT /config.
+	Config        *structpb.Struct `protobuf:"bytes,2,opt,name=config,proto3" json:"config,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutConfigRequest) Reset() {
+	*x = PutConfigRequest{}
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutConfigRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutConfigRequest) ProtoMessage() {}
+
+func (x *PutConfigRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutConfigRequest.ProtoReflect.Descriptor instead.
+func (*PutConfigRequest) Descriptor() ([]byte, []int) {
+	return file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *PutConfigRequest) GetSchedule() *ScheduleRef {
+	if x != nil {
+		return x.Schedule
+	}
+	return nil
+}
+
+func (x *PutConfigRequest) GetConfig() *structpb.Struct {
+	if x != nil {
+		return x.Config
+	}
+	return nil
+}
+
+type PutConfigResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutConfigResponse) Reset() {
+	*x = PutConfigResponse{}
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutConfigResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutConfigResponse) ProtoMessage() {}
+
+func (x *PutConfigResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutConfigResponse.ProtoReflect.Descriptor instead.
+func (*PutConfigResponse) Descriptor() ([]byte, []int) {
+	return file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDescGZIP(), []int{2}
+}
+
+type GetScheduleRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Schedule      *ScheduleRef           `protobuf:"bytes,1,opt,name=schedule,proto3" json:"schedule,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetScheduleRequest) Reset() {
+	*x = GetScheduleRequest{}
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetScheduleRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetScheduleRequest) ProtoMessage() {}
+
+func (x *GetScheduleRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetScheduleRequest.ProtoReflect.Descriptor instead.
+func (*GetScheduleRequest) Descriptor() ([]byte, []int) {
+	return file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetScheduleRequest) GetSchedule() *ScheduleRef {
+	if x != nil {
+		return x.Schedule
+	}
+	return nil
+}
+
+type WatchScheduleRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Schedule      *ScheduleRef           `protobuf:"bytes,1,opt,name=schedule,proto3" json:"schedule,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchScheduleRequest) Reset() {
+	*x = WatchScheduleRequest{}
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchScheduleRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchScheduleRequest) ProtoMessage() {}
+
+func (x *WatchScheduleRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchScheduleRequest.ProtoReflect.Descriptor instead.
+func (*WatchScheduleRequest) Descriptor() ([]byte, []int) {
+	return file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *WatchScheduleRequest) GetSchedule() *ScheduleRef {
+	if x != nil {
+		return x.Schedule
+	}
+	return nil
+}
+
+// Schedule is a scheduling decision.
+type Schedule struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Integer percentages keyed by flavour name.
+	FlavourWeights map[string]int32 `protobuf:"bytes,1,rep,name=flavour_weights,json=flavourWeights,proto3" json:"flavour_weights,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	Flavours       []*FlavourWeight `protobuf:"bytes,2,rep,name=flavours,proto3" json:"flavours,omitempty"`
+	// RFC 3339 time after which the decision must be refreshed.
+	ValidUntil   string             `protobuf:"bytes,3,opt,name=valid_until,json=validUntil,proto3" json:"valid_until,omitempty"`
+	Credits      *Credits           `protobuf:"bytes,4,opt,name=credits,proto3" json:"credits,omitempty"`
+	Policy       *Policy            `protobuf:"bytes,5,opt,name=policy,proto3" json:"policy,omitempty"`
+	Diagnostics  map[string]float64 `protobuf:"bytes,6,rep,name=diagnostics,proto3" json:"diagnostics,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"fixed64,2,opt,name=value"`
+	AvgPrecision float64            `protobuf:"fixed64,7,opt,name=avg_precision,json=avgPrecision,proto3" json:"avg_precision,omitempty"`
+	Processing   *Processing        `protobuf:"bytes,8,opt,name=processing,proto3" json:"processing,omitempty"`
+	Carbon       *Carbon            `protobuf:"bytes,9,opt,name=carbon,proto3" json:"carbon,omitempty"`
+	// Current forecast in gCO2/kWh per locality zone.
+	Zones         map[string]float64 `protobuf:"bytes,10,rep,name=zones,proto3" json:"zones,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"fixed64,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Schedule) Reset() {
+	*x = Schedule{}
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Schedule) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Schedule) ProtoMessage() {}
+
+func (x *Schedule) ProtoReflect() protoreflect.Message {
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Schedule.ProtoReflect.Descriptor instead.
+func (*Schedule) Descriptor() ([]byte, []int) {
+	return file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Schedule) GetFlavourWeights() map[string]int32 {
+	if x != nil {
+		return x.FlavourWeights
+	}
+	return nil
+}
+
+func (x *Schedule) GetFlavours() []*FlavourWeight {
+	if x != nil {
+		return x.Flavours
+	}
+	return nil
+}
+
+func (x *Schedule) GetValidUntil() string {
+	if x != nil {
+		return x.ValidUntil
+	}
+	return ""
+}
+
+func (x *Schedule) GetCredits() *Credits {
+	if x != nil {
+		return x.Credits
+	}
+	return nil
+}
+
+func (x *Schedule) GetPolicy() *Policy {
+	if x != nil {
+		return x.Policy
+	}
+	return nil
+}
+
+func (x *Schedule) GetDiagnostics() map[string]float64 {
+	if x != nil {
+		return x.Diagnostics
+	}
+	return nil
+}
+
+func (x *Schedule) GetAvgPrecision() float64 {
+	if x != nil {
+		return x.AvgPrecision
+	}
+	return 0
+}
+
+func (x *Schedule) GetProcessing() *Processing {
+	if x != nil {
+		return x.Processing
+	}
+	return nil
+}
+
+func (x *Schedule) GetCarbon() *Carbon {
+	if x != nil {
+		return x.Carbon
+	}
+	return nil
+}
+
+func (x *Schedule) GetZones() map[string]float64 {
+	if x != nil {
+		return x.Zones
+	}
+	return nil
+}
+
+// FlavourWeight is the share of traffic assigned to a flavour.
+type FlavourWeight struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// Integer percentage.
+	Precision       int32   `protobuf:"varint,2,opt,name=precision,proto3" json:"precision,omitempty"`
+	Weight          int32   `protobuf:"varint,3,opt,name=weight,proto3" json:"weight,omitempty"`
+	CarbonIntensity float64 `protobuf:"fixed64,4,opt,name=carbon_intensity,json=carbonIntensity,proto3" json:"carbon_intensity,omitempty"`
+	Enabled         bool    `protobuf:"varint,5,opt,name=enabled,proto3" json:"enabled,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *FlavourWeight) Reset() {
+	*x = FlavourWeight{}
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FlavourWeight) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FlavourWeight) ProtoMessage() {}
+
+func (x *FlavourWeight) ProtoReflect() protoreflect.Message {
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FlavourWeight.ProtoReflect.Descriptor instead.
+func (*FlavourWeight) Descriptor() ([]byte, []int) {
+	return file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *FlavourWeight) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *FlavourWeight) GetPrecision() int32 {
+	if x != nil {
+		return x.Precision
+	}
+	return 0
+}
+
+func (x *FlavourWeight) GetWeight() int32 {
+	if x != nil {
+		return x.Weight
+	}
+	return 0
+}
+
+func (x *FlavourWeight) GetCarbonIntensity() float64 {
+	if x != nil {
+		return x.CarbonIntensity
+	}
+	return 0
+}
+
+func (x *FlavourWeight) GetEnabled() bool {
+	if x != nil {
+		return x.Enabled
+	}
+	return false
+}
+
+// Credits is the state of the credit ledger.
+type Credits struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Balance       float64                `protobuf:"fixed64,1,opt,name=balance,proto3" json:"balance,omitempty"`
+	Velocity      float64                `protobuf:"fixed64,2,opt,name=velocity,proto3" json:"velocity,omitempty"`
+	Target        float64                `protobuf:"fixed64,3,opt,name=target,proto3" json:"target,omitempty"`
+	Min           float64                `protobuf:"fixed64,4,opt,name=min,proto3" json:"min,omitempty"`
+	Max           float64                `protobuf:"fixed64,5,opt,name=max,proto3" json:"max,omitempty"`
+	Allowance     float64                `protobuf:"fixed64,6,opt,name=allowance,proto3" json:"allowance,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Credits) Reset() {
+	*x = Credits{}
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Credits) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Credits) ProtoMessage() {}
+
+func (x *Credits) ProtoReflect() protoreflect.Message {
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Credits.ProtoReflect.Descriptor instead.
+func (*Credits) Descriptor() ([]byte, []int) {
+	return file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Credits) GetBalance() float64 {
+	if x != nil {
+		return x.Balance
+	}
+	return 0
+}
+
+func (x *Credits) GetVelocity() float64 {
+	if x != nil {
+		return x.Velocity
+	}
+	return 0
+}
+
+func (x *Credits) GetTarget() float64 {
+	if x != nil {
+		return x.Target
+	}
+	return 0
+}
+
+func (x *Credits) GetMin() float64 {
+	if x != nil {
+		return x.Min
+	}
+	return 0
+}
+
+func (x *Credits) GetMax() float64 {
+	if x != nil {
+		return x.Max
+	}
+	return 0
+}
+
+func (x *Credits) GetAllowance() float64 {
+	if x != nil {
+		return x.Allowance
+	}
+	return 0
+}
+
+type Policy struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Policy) Reset() {
+	*x = Policy{}
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Policy) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Policy) ProtoMessage() {}
+
+func (x *Policy) ProtoReflect() protoreflect.Message {
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Policy.ProtoReflect.Descriptor instead.
+func (*Policy) Descriptor() ([]byte, []int) {
+	return file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Policy) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+// Processing is the autoscaling directive.
+type Processing struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Throttle       float64                `protobuf:"fixed64,1,opt,name=throttle,proto3" json:"throttle,omitempty"`
+	CreditsRatio   float64                `protobuf:"fixed64,2,opt,name=credits_ratio,json=creditsRatio,proto3" json:"credits_ratio,omitempty"`
+	IntensityRatio float64                `protobuf:"fixed64,3,opt,name=intensity_ratio,json=intensityRatio,proto3" json:"intensity_ratio,omitempty"`
+	Ceilings       map[string]int32       `protobuf:"bytes,4,rep,name=ceilings,proto3" json:"ceilings,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Processing) Reset() {
+	*x = Processing{}
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Processing) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Processing) ProtoMessage() {}
+
+func (x *Processing) ProtoReflect() protoreflect.Message {
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Processing.ProtoReflect.Descriptor instead.
+func (*Processing) Descriptor() ([]byte, []int) {
+	return file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Processing) GetThrottle() float64 {
+	if x != nil {
+		return x.Throttle
+	}
+	return 0
+}
+
+func (x *Processing) GetCreditsRatio() float64 {
+	if x != nil {
+		return x.CreditsRatio
+	}
+	return 0
+}
+
+func (x *Processing) GetIntensityRatio() float64 {
+	if x != nil {
+		return x.IntensityRatio
+	}
+	return 0
+}
+
+func (x *Processing) GetCeilings() map[string]int32 {
+	if x != nil {
+		return x.Ceilings
+	}
+	return nil
+}
+
+// Carbon is the grid intensity of the current and next slots, in gCO2/kWh.
+type Carbon struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Now           *float64               `protobuf:"fixed64,1,opt,name=now,proto3,oneof" json:"now,omitempty"`
+	Next          *float64               `protobuf:"fixed64,2,opt,name=next,proto3,oneof" json:"next,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Carbon) Reset() {
+	*x = Carbon{}
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Carbon) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Carbon) ProtoMessage() {}
+
+func (x *Carbon) ProtoReflect() protoreflect.Message {
+	mi := &file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Carbon.ProtoReflect.Descriptor instead.
+func (*Carbon) Descriptor() ([]byte, []int) {
+	return file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Carbon) GetNow() float64 {
+	if x != nil && x.Now != nil {
+		return *x.Now
+	}
+	return 0
+}
+
+func (x *Carbon) GetNext() float64 {
+	if x != nil && x.Next != nil {
+		return *x.Next
+	}
+	return 0
+}
+
+var File_carbonrouter_decisionengine_v1_decision_engine_proto protoreflect.FileDescriptor
+
+const file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDesc = "" +
+	"\n" +
+	"4carbonrouter/decisionengine/v1/decision_engine.proto\x12\x1ecarbonrouter.decisionengine.v1\x1a\x1cgoogle/protobuf/struct.proto\"?\n" +
+	"\vScheduleRef\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\"\x8c\x01\n" +
+	"\x10PutConfigRequest\x12G\n" +
+	"\bschedule\x18\x01 \x01(\v2+.carbonrouter.decisionengine.v1.ScheduleRefR\bschedule\x12/\n" +
+	"\x06config\x18\x02 \x01(\v2\x17.google.protobuf.StructR\x06config\"\x13\n" +
+	"\x11PutConfigResponse\"]\n" +
+	"\x12GetScheduleRequest\x12G\n" +
+	"\bschedule\x18\x01 \x01(\v2+.carbonrouter.decisionengine.v1.ScheduleRefR\bschedule\"_\n" +
+	"\x14WatchScheduleRequest\x12G\n" +
+	"\bschedule\x18\x01 \x01(\v2+.carbonrouter.decisionengine.v1.ScheduleRefR\bschedule\"\xf6\x06\n" +
+	"\bSchedule\x12e\n" +
+	"\x0fflavour_weights\x18\x01 \x03(\v2<.carbonrouter.decisionengine.v1.Schedule.FlavourWeightsEntryR\x0eflavourWeights\x12I\n" +
+	"\bflavours\x18\x02 \x03(\v2-.carbonrouter.decisionengine.v1.FlavourWeightR\bflavours\x12\x1f\n" +
+	"\vvalid_until\x18\x03 \x01(\tR\n" +
+	"validUntil\x12A\n" +
+	"\acredits\x18\x04 \x01(\v2'.carbonrouter.decisionengine.v1.CreditsR\acredits\x12>\n" +
+	"\x06policy\x18\x05 \x01(\v2&.carbonrouter.decisionengine.v1.PolicyR\x06policy\x12[\n" +
+	"\vdiagnostics\x18\x06 \x03(\v29.carbonrouter.decisionengine.v1.Schedule.DiagnosticsEntryR\vdiagnostics\x12#\n" +
+	"\ravg_precision\x18\a \x01(\x01R\favgPrecision\x12J\n" +
+	"\n" +
+	"processing\x18\b \x01(\v2*.carbonrouter.decisionengine.v1.ProcessingR\n" +
+	"processing\x12>\n" +
+	"\x06carbon\x18\t \x01(\v2&.carbonrouter.decisionengine.v1.CarbonR\x06carbon\x12I\n" +
+	"\x05zones\x18\n" +
+	" \x03(\v23.carbonrouter.decisionengine.v1.Schedule.ZonesEntryR\x05zones\x1aA\n" +
+	"\x13FlavourWeightsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x05R\x05value:\x028\x01\x1a>\n" +
+	"\x10DiagnosticsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x01R\x05value:\x028\x01\x1a8\n" +
+	"\n" +
+	"ZonesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x01R\x05value:\x028\x01\"\x9e\x01\n" +
+	"\rFlavourWeight\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1c\n" +
+	"\tprecision\x18\x02 \x01(\x05R\tprecision\x12\x16\n" +
+	"\x06weight\x18\x03 \x01(\x05R\x06weight\x12)\n" +
+	"\x10carbon_intensity\x18\x04 \x01(\x01R\x0fcarbonIntensity\x12\x18\n" +
+	"\aenabled\x18\x05 \x01(\bR\aenabled\"\x99\x01\n" +
+	"\aCredits\x12\x18\n" +
+	"\abalance\x18\x01 \x01(\x01R\abalance\x12\x1a\n" +
+	"\bvelocity\x18\x02 \x01(\x01R\bvelocity\x12\x16\n" +
+	"\x06target\x18\x03 \x01(\x01R\x06target\x12\x10\n" +
+	"\x03min\x18\x04 \x01(\x01R\x03min\x12\x10\n" +
+	"\x03max\x18\x05 \x01(\x01R\x03max\x12\x1c\n" +
+	"\tallowance\x18\x06 \x01(\x01R\tallowance\"\x1c\n" +
+	"\x06Policy\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\"\x89\x02\n" +
+	"\n" +
+	"Processing\x12\x1a\n" +
+	"\bthrottle\x18\x01 \x01(\x01R\bthrottle\x12#\n" +
+	"\rcredits_ratio\x18\x02 \x01(\x01R\fcreditsRatio\x12'\n" +
+	"\x0fintensity_ratio\x18\x03 \x01(\x01R\x0eintensityRatio\x12T\n" +
+	"\bceilings\x18\x04 \x03(\v28.carbonrouter.decisionengine.v1.Processing.CeilingsEntryR\bceilings\x1a;\n" +
+	"\rCeilingsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x05R\x05value:\x028\x01\"I\n" +
+	"\x06Carbon\x12\x15\n" +
+	"\x03now\x18\x01 \x01(\x01H\x00R\x03now\x88\x01\x01\x12\x17\n" +
+	"\x04next\x18\x02 \x01(\x01H\x01R\x04next\x88\x01\x01B\x06\n" +
+	"\x04_nowB\a\n" +
+	"\x05_next2\xe2\x02\n" +
+	"\x0eDecisionEngine\x12p\n" +
+	"\tPutConfig\x120.carbonrouter.decisionengine.v1.PutConfigRequest\x1a1.carbonrouter.decisionengine.v1.PutConfigResponse\x12k\n" +
+	"\vGetSchedule\x122.carbonrouter.decisionengine.v1.GetScheduleRequest\x1a(.carbonrouter.decisionengine.v1.Schedule\x12q\n" +
+	"\rWatchSchedule\x124.carbonrouter.decisionengine.v1.WatchScheduleRequest\x1a(.carbonrouter.decisionengine.v1.Schedule0\x01BJZHgithub.com/belgio99/k8s-carbonrouter/operator/internal/enginepb;enginepbb\x06proto3"
+
+var (
+	file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDescOnce sync.Once
+	file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDescData []byte
+)
+
+func file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDescGZIP() []byte {
+	file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDescOnce.Do(func() {
+		file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDesc), len(file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDesc)))
+	})
+	return file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDescData
+}
+
+var file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
+var file_carbonrouter_decisionengine_v1_decision_engine_proto_goTypes = []any{
+	(*ScheduleRef)(nil),          // 0: carbonrouter.decisionengine.v1.ScheduleRef
+	(*PutConfigRequest)(nil),     // 1: carbonrouter.decisionengine.v1.PutConfigRequest
+	(*PutConfigResponse)(nil),    // 2: carbonrouter.decisionengine.v1.PutConfigResponse
+	(*GetScheduleRequest)(nil),   // 3: carbonrouter.decisionengine.v1.GetScheduleRequest
+	(*WatchScheduleRequest)(nil), // 4: carbonrouter.decisionengine.v1.WatchScheduleRequest
+	(*Schedule)(nil),             // 5: carbonrouter.decisionengine.v1.Schedule
+	(*FlavourWeight)(nil),        // 6: carbonrouter.decisionengine.v1.FlavourWeight
+	(*Credits)(nil),              // 7: carbonrouter.decisionengine.v1.Credits
+	(*Policy)(nil),               // 8: carbonrouter.decisionengine.v1.Policy
+	(*Processing)(nil),           // 9: carbonrouter.decisionengine.v1.Processing
+	(*Carbon)(nil),               // 10: carbonrouter.decisionengine.v1.Carbon
+	nil,                          // 11: carbonrouter.decisionengine.v1.Schedule.FlavourWeightsEntry
+	nil,                          // 12: carbonrouter.decisionengine.v1.Schedule.DiagnosticsEntry
+	nil,                          // 13: carbonrouter.decisionengine.v1.Schedule.ZonesEntry
+	nil,                          // 14: carbonrouter.decisionengine.v1.Processing.CeilingsEntry
+	(*structpb.Struct)(nil),      // 15: google.protobuf.Struct
+}
+var file_carbonrouter_decisionengine_v1_decision_engine_proto_depIdxs = []int32{
+	0,  // 0: carbonrouter.decisionengine.v1.PutConfigRequest.schedule:type_name -> carbonrouter.decisionengine.v1.ScheduleRef
+	15, // 1: carbonrouter.decisionengine.v1.PutConfigRequest.config:type_name -> google.protobuf.Struct
+	0,  // 2: carbonrouter.decisionengine.v1.GetScheduleRequest.schedule:type_name -> carbonrouter.decisionengine.v1.ScheduleRef
+	0,  // 3: carbonrouter.decisionengine.v1.WatchScheduleRequest.schedule:type_name -> carbonrouter.decisionengine.v1.ScheduleRef
+	11, // 4: carbonrouter.decisionengine.v1.Schedule.flavour_weights:type_name -> carbonrouter.decisionengine.v1.Schedule.FlavourWeightsEntry
+	6,  // 5: carbonrouter.decisionengine.v1.Schedule.flavours:type_name -> carbonrouter.decisionengine.v1.FlavourWeight
+	7,  // 6: carbonrouter.decisionengine.v1.Schedule.credits:type_name -> carbonrouter.decisionengine.v1.Credits
+	8,  // 7: carbonrouter.decisionengine.v1.Schedule.policy:type_name -> carbonrouter.decisionengine.v1.Policy
+	12, // 8: carbonrouter.decisionengine.v1.Schedule.diagnostics:type_name -> carbonrouter.decisionengine.v1.Schedule.DiagnosticsEntry
+	9,  // 9: carbonrouter.decisionengine.v1.Schedule.processing:type_name -> carbonrouter.decisionengine.v1.Processing
+	10, // 10: carbonrouter.decisionengine.v1.Schedule.carbon:type_name -> carbonrouter.decisionengine.v1.Carbon
+	13, // 11: carbonrouter.decisionengine.v1.Schedule.zones:type_name -> carbonrouter.decisionengine.v1.Schedule.ZonesEntry
+	14, // 12: carbonrouter.decisionengine.v1.Processing.ceilings:type_name -> carbonrouter.decisionengine.v1.Processing.CeilingsEntry
+	1,  // 13: carbonrouter.decisionengine.v1.DecisionEngine.PutConfig:input_type -> carbonrouter.decisionengine.v1.PutConfigRequest
+	3,  // 14: carbonrouter.decisionengine.v1.DecisionEngine.GetSchedule:input_type -> carbonrouter.decisionengine.v1.GetScheduleRequest
+	4,  // 15: carbonrouter.decisionengine.v1.DecisionEngine.WatchSchedule:input_type -> carbonrouter.decisionengine.v1.WatchScheduleRequest
+	2,  // 16: carbonrouter.decisionengine.v1.DecisionEngine.PutConfig:output_type -> carbonrouter.decisionengine.v1.PutConfigResponse
+	5,  // 17: carbonrouter.decisionengine.v1.DecisionEngine.GetSchedule:output_type -> carbonrouter.decisionengine.v1.Schedule
+	5,  // 18: carbonrouter.decisionengine.v1.DecisionEngine.WatchSchedule:output_type -> carbonrouter.decisionengine.v1.Schedule
+	16, // [16:19] is the sub-list for method output_type
+	13, // [13:16] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
+}
+
+func init() { file_carbonrouter_decisionengine_v1_decision_engine_proto_init() }
+func file_carbonrouter_decisionengine_v1_decision_engine_proto_init() {
+	if File_carbonrouter_decisionengine_v1_decision_engine_proto != nil {
+		return
+	}
+	file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes[10].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDesc), len(file_carbonrouter_decisionengine_v1_decision_engine_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   15,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_carbonrouter_decisionengine_v1_decision_engine_proto_goTypes,
+		DependencyIndexes: file_carbonrouter_decisionengine_v1_decision_engine_proto_depIdxs,
+		MessageInfos:      file_carbonrouter_decisionengine_v1_decision_engine_proto_msgTypes,
+	}.Build()
+	File_carbonrouter_decisionengine_v1_decision_engine_proto = out.File
+	file_carbonrouter_decisionengine_v1_decision_engine_proto_goTypes = nil
+	file_carbonrouter_decisionengine_v1_decision_engine_proto_depIdxs = nil
+}
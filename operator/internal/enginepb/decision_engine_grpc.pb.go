@@ -0,0 +1,224 @@
+// Decision engine API used by the operator.
+//
+// It mirrors the JSON endpoints of the decision engine (PUT /config and GET
+// /schedule) and adds WatchSchedule, which streams every new decision so the
+// operator does not have to poll. Field names map to the JSON keys of the HTTP
+// API through the proto3 JSON mapping.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.3
+// source: carbonrouter/decisionengine/v1/decision_engine.proto
+
+package enginepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	DecisionEngine_PutConfig_FullMethodName     = "/carbonrouter.decisionengine.v1.DecisionEngine/PutConfig"
+	DecisionEngine_GetSchedule_FullMethodName   = "/carbonrouter.decisionengine.v1.DecisionEngine/GetSchedule"
+	DecisionEngine_WatchSchedule_FullMethodName = "/carbonrouter.decisionengine.v1.DecisionEngine/WatchSchedule"
+)
+
+// DecisionEngineClient is the client API for DecisionEngine service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// DecisionEngine computes the traffic schedules of TrafficSchedule resources.
+type DecisionEngineClient interface {
+	// PutConfig creates or reconfigures the scheduler session of a schedule.
+	PutConfig(ctx context.Context, in *PutConfigRequest, opts ...grpc.CallOption) (*PutConfigResponse, error)
+	// GetSchedule returns the current decision of a schedule. It fails with
+	// NOT_FOUND before the first PutConfig and UNAVAILABLE until the first
+	// decision is computed.
+	GetSchedule(ctx context.Context, in *GetScheduleRequest, opts ...grpc.CallOption) (*Schedule, error)
+	// WatchSchedule sends the current decision of a schedule, then every new
+	// one, until the client cancels the call.
+	WatchSchedule(ctx context.Context, in *WatchScheduleRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Schedule], error)
+}
+
+type decisionEngineClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDecisionEngineClient(cc grpc.ClientConnInterface) DecisionEngineClient {
+	return &decisionEngineClient{cc}
+}
+
+func (c *decisionEngineClient) PutConfig(ctx context.Context, in *PutConfigRequest, opts ...grpc.CallOption) (*PutConfigResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PutConfigResponse)
+	err := c.cc.Invoke(ctx, DecisionEngine_PutConfig_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *decisionEngineClient) GetSchedule(ctx context.Context, in *GetScheduleRequest, opts ...grpc.CallOption) (*Schedule, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Schedule)
+	err := c.cc.Invoke(ctx, DecisionEngine_GetSchedule_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *decisionEngineClient) WatchSchedule(ctx context.Context, in *WatchScheduleRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Schedule], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &DecisionEngine_ServiceDesc.Streams[0], DecisionEngine_WatchSchedule_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchScheduleRequest, Schedule]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DecisionEngine_WatchScheduleClient = grpc.ServerStreamingClient[Schedule]
+
+// DecisionEngineServer is the server API for DecisionEngine service.
+// All implementations must embed UnimplementedDecisionEngineServer
+// for forward compatibility.
+//
+// DecisionEngine computes the traffic schedules of TrafficSchedule resources.
+type DecisionEngineServer interface {
+	// PutConfig creates or reconfigures the scheduler session of a schedule.
+	PutConfig(context.Context, *PutConfigRequest) (*PutConfigResponse, error)
+	// GetSchedule returns the current decision of a schedule. It fails with
+	// NOT_FOUND before the first PutConfig and UNAVAILABLE until the first
+	// decision is computed.
+	GetSchedule(context.Context, *GetScheduleRequest) (*Schedule, error)
+	// WatchSchedule sends the current decision of a schedule, then every new
+	// one, until the client cancels the call.
+	WatchSchedule(*WatchScheduleRequest, grpc.ServerStreamingServer[Schedule]) error
+	mustEmbedUnimplementedDecisionEngineServer()
+}
+
+// UnimplementedDecisionEngineServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedDecisionEngineServer struct{}
+
+func (UnimplementedDecisionEngineServer) PutConfig(context.Context, *PutConfigRequest) (*PutConfigResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PutConfig not implemented")
+}
+func (UnimplementedDecisionEngineServer) GetSchedule(context.Context, *GetScheduleRequest) (*Schedule, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSchedule not implemented")
+}
+func (UnimplementedDecisionEngineServer) WatchSchedule(*WatchScheduleRequest, grpc.ServerStreamingServer[Schedule]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchSchedule not implemented")
+}
+func (UnimplementedDecisionEngineServer) mustEmbedUnimplementedDecisionEngineServer() {}
+func (UnimplementedDecisionEngineServer) testEmbeddedByValue()                        {}
+
+// UnsafeDecisionEngineServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DecisionEngineServer will
+// result in compilation errors.
+type UnsafeDecisionEngineServer interface {
+	mustEmbedUnimplementedDecisionEngineServer()
+}
+
+func RegisterDecisionEngineServer(s grpc.ServiceRegistrar, srv DecisionEngineServer) {
+	// If the following call pancis, it indicates UnimplementedDecisionEngineServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&DecisionEngine_ServiceDesc, srv)
+}
+
+func _DecisionEngine_PutConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PutConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DecisionEngineServer).PutConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DecisionEngine_PutConfig_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DecisionEngineServer).PutConfig(ctx, req.(*PutConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DecisionEngine_GetSchedule_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetScheduleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DecisionEngineServer).GetSchedule(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DecisionEngine_GetSchedule_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DecisionEngineServer).GetSchedule(ctx, req.(*GetScheduleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DecisionEngine_WatchSchedule_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchScheduleRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DecisionEngineServer).WatchSchedule(m, &grpc.GenericServerStream[WatchScheduleRequest, Schedule]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DecisionEngine_WatchScheduleServer = grpc.ServerStreamingServer[Schedule]
+
+// DecisionEngine_ServiceDesc is the grpc.ServiceDesc for DecisionEngine service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var DecisionEngine_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "carbonrouter.decisionengine.v1.DecisionEngine",
+	HandlerType: (*DecisionEngineServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "PutConfig",
+			Handler:    _DecisionEngine_PutConfig_Handler,
+		},
+		{
+			MethodName: "GetSchedule",
+			Handler:    _DecisionEngine_GetSchedule_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchSchedule",
+			Handler:       _DecisionEngine_WatchSchedule_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "carbonrouter/decisionengine/v1/decision_engine.proto",
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package poweragent implements the node agent that applies CPU power caps
+// (RAPL package limits and cpufreq maximum frequency) requested by the operator
+// through a node annotation, and reverts them once the annotation is removed.
+package poweragent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// CapAnnotation is set by the operator on nodes that should be power capped.
+// Its value is the cap as a percentage of the node maximum (10-100).
+const CapAnnotation = "carbonrouter.io/power-cap-percent"
+
+// Capper writes power limits into sysfs and remembers the original values.
+type Capper struct {
+	// Root is the sysfs mount point, normally /sys (or /host/sys in the DaemonSet).
+	Root  string
+	saved map[string]string
+}
+
+// NewCapper returns a Capper operating under root.
+func NewCapper(root string) *Capper {
+	return &Capper{Root: root, saved: map[string]string{}}
+}
+
+func readInt(path string) (int64, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(raw)), 10, 64)
+}
+
+func (c *Capper) write(path string, value int64) error {
+	if _, ok := c.saved[path]; !ok {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		c.saved[path] = strings.TrimSpace(string(raw))
+	}
+	return os.WriteFile(path, []byte(strconv.FormatInt(value, 10)), 0o644)
+}
+
+// Apply caps every RAPL package and every CPU frequency policy to percent of its maximum.
+func (c *Capper) Apply(percent int) error {
+	if percent <= 0 || percent > 100 {
+		return fmt.Errorf("invalid power cap percent %d", percent)
+	}
+	var errs []string
+
+	packages, _ := filepath.Glob(filepath.Join(c.Root, "class/powercap/intel-rapl:[0-9]*"))
+	for _, pkg := range packages {
+		if strings.Count(filepath.Base(pkg), ":") != 1 {
+			continue // sub-zones (core/uncore) follow the package limit
+		}
+		maxPower, err := readInt(filepath.Join(pkg, "constraint_0_max_power_uw"))
+		if err != nil || maxPower <= 0 {
+			continue
+		}
+		if err := c.write(filepath.Join(pkg, "constraint_0_power_limit_uw"), maxPower*int64(percent)/100); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	policies, _ := filepath.Glob(filepath.Join(c.Root, "devices/system/cpu/cpufreq/policy[0-9]*"))
+	for _, policy := range policies {
+		maxFreq, err := readInt(filepath.Join(policy, "cpuinfo_max_freq"))
+		if err != nil || maxFreq <= 0 {
+			continue
+		}
+		target := maxFreq * int64(percent) / 100
+		if minFreq, err := readInt(filepath.Join(policy, "cpuinfo_min_freq")); err == nil && target < minFreq {
+			target = minFreq
+		}
+		if err := c.write(filepath.Join(policy, "scaling_max_freq"), target); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to apply power cap: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Revert restores every value changed by Apply.
+func (c *Capper) Revert() error {
+	var errs []string
+	for path, value := range c.saved {
+		if err := os.WriteFile(path, []byte(value), 0o644); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		delete(c.saved, path)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to revert power cap: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Run polls the node annotation and applies or reverts the cap until ctx is done.
+// The cap is always reverted on exit so a removed DaemonSet never leaves nodes capped.
+func Run(ctx context.Context, clientset kubernetes.Interface, nodeName string, capper *Capper, interval time.Duration) error {
+	log := ctrl.Log.WithName("power-agent").WithValues("node", nodeName)
+	applied := 0
+	defer func() {
+		if applied > 0 {
+			if err := capper.Revert(); err != nil {
+				log.Error(err, "Failed to revert power cap on shutdown")
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			log.Error(err, "Failed to read node")
+		} else {
+			desired := 0
+			if value, ok := node.Annotations[CapAnnotation]; ok {
+				if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 && parsed < 100 {
+					desired = parsed
+				}
+			}
+			switch {
+			case desired == applied:
+			case desired == 0:
+				log.Info("Reverting power cap")
+				if err := capper.Revert(); err != nil {
+					log.Error(err, "Failed to revert power cap")
+				} else {
+					applied = 0
+				}
+			default:
+				log.Info("Applying power cap", "percent", desired)
+				if err := capper.Apply(desired); err != nil {
+					log.Error(err, "Failed to apply power cap")
+				}
+				applied = desired
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
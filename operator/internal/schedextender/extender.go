@@ -0,0 +1,129 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package schedextender implements a kube-scheduler extender that scores
+// nodes by the carbon intensity of their zone, as labelled by the operator, so
+// the pods of the precision Deployments land on the greener nodes first.
+package schedextender
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// IntensityLabel is set by the operator on the nodes of the zones with a
+// forecast. Its value is the current forecast of the zone in gCO2/kWh.
+const IntensityLabel = "carbonrouter.io/carbon-intensity"
+
+const (
+	// precisionLabel marks the pods of the precision Deployments, the only
+	// ones the extender scores.
+	precisionLabel = "carbonstat.precision"
+	// maxPriority is the highest score an extender may give a node.
+	maxPriority = 10
+)
+
+// extenderArgs and hostPriority are the prioritize request and response of
+// the scheduler extender protocol (k8s.io/kube-scheduler/extender/v1).
+type extenderArgs struct {
+	Pod       *corev1.Pod
+	Nodes     *corev1.NodeList
+	NodeNames *[]string
+}
+
+type hostPriority struct {
+	Host  string
+	Score int64
+}
+
+// Handler answers the prioritize calls of the scheduler.
+type Handler struct {
+	reader client.Reader
+}
+
+// NewHandler returns a Handler reading the nodes named by schedulers with
+// nodeCacheCapable set from reader.
+func NewHandler(reader client.Reader) *Handler {
+	return &Handler{reader: reader}
+}
+
+// ServeHTTP scores the candidate nodes of the pod from 0 to 10, the greenest
+// labelled node the highest. Unlabelled nodes score 0, and so does every node
+// for pods other than those of precision Deployments.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var args extenderArgs
+	if err := json.NewDecoder(req.Body).Decode(&args); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var nodes []corev1.Node
+	switch {
+	case args.Nodes != nil:
+		nodes = args.Nodes.Items
+	case args.NodeNames != nil:
+		for _, name := range *args.NodeNames {
+			var node corev1.Node
+			if err := h.reader.Get(req.Context(), client.ObjectKey{Name: name}, &node); err != nil {
+				// Scored as unlabelled
+				ctrl.Log.WithName("schedextender").V(1).Info("Node not found", "node", name, "error", err.Error())
+				node.Name = name
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	scoreIntensity := args.Pod != nil && args.Pod.Labels[precisionLabel] != ""
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(score(nodes, scoreIntensity))
+}
+
+// score ranks nodes linearly between the lowest intensity, scored
+// maxPriority, and the highest, scored 0.
+func score(nodes []corev1.Node, scoreIntensity bool) []hostPriority {
+	intensities := make(map[string]float64, len(nodes))
+	lowest, highest := math.Inf(1), math.Inf(-1)
+	if scoreIntensity {
+		for _, node := range nodes {
+			intensity, err := strconv.ParseFloat(node.Labels[IntensityLabel], 64)
+			if err != nil {
+				continue
+			}
+			intensities[node.Name] = intensity
+			lowest, highest = min(lowest, intensity), max(highest, intensity)
+		}
+	}
+	out := make([]hostPriority, 0, len(nodes))
+	for _, node := range nodes {
+		priority := hostPriority{Host: node.Name}
+		if intensity, ok := intensities[node.Name]; ok {
+			priority.Score = maxPriority
+			if highest > lowest {
+				priority.Score = int64(math.Round(maxPriority * (highest - intensity) / (highest - lowest)))
+			}
+		}
+		out = append(out, priority)
+	}
+	return out
+}
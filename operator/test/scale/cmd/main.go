@@ -0,0 +1,123 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command scale runs the operator scale benchmark and fails when a result
+// exceeds its budget.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	"github.com/belgio99/k8s-carbonrouter/operator/test/scale"
+)
+
+// crdDirs collects repeated --crd-dir flags.
+type crdDirs []string
+
+func (d *crdDirs) String() string     { return strings.Join(*d, ",") }
+func (d *crdDirs) Set(v string) error { *d = append(*d, v); return nil }
+
+func main() {
+	os.Exit(run())
+}
+
+// run returns the exit code, so envtest is stopped on every path.
+func run() int {
+	var sc scale.Config
+	var budget scale.Budget
+	var useEnvtest, verbose bool
+	var maxHeapMiB uint64
+	var output string
+	extraCRDs := crdDirs{}
+	flag.IntVar(&sc.Services, "services", 100, "Number of synthetic routed Services.")
+	flag.IntVar(&sc.Flavours, "flavours", 3, "Precision deployments per Service (1-10).")
+	flag.StringVar(&sc.Namespace, "namespace", "carbonrouter-scale", "Namespace of the synthetic objects, deleted after the run.")
+	flag.DurationVar(&sc.Timeout, "timeout", 10*time.Minute, "Maximum wait for every Service to converge.")
+	flag.BoolVar(&useEnvtest, "envtest", false, "Start an envtest API server instead of using the current kubeconfig.")
+	flag.Var(&extraCRDs, "crd-dir", "Extra CRD directory to install in envtest, e.g. the Istio and KEDA CRDs. Repeatable.")
+	flag.DurationVar(&budget.MaxConvergence, "max-convergence", 0, "Fail if convergence takes longer (0 disables).")
+	flag.Float64Var(&budget.MaxRequestsPerService, "max-requests-per-service", 0, "Fail above this many API requests per Service (0 disables).")
+	flag.Uint64Var(&maxHeapMiB, "max-heap-mib", 0, "Fail above this peak in-use heap in MiB (0 disables).")
+	flag.StringVar(&output, "output", "", "Write the result as JSON to this file.")
+	flag.BoolVar(&verbose, "v", false, "Log the controllers.")
+	flag.Parse()
+	budget.MaxPeakHeapBytes = maxHeapMiB << 20
+
+	if verbose {
+		ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var cfg *rest.Config
+	if useEnvtest {
+		env := &envtest.Environment{
+			CRDDirectoryPaths:     append([]string{filepath.Join("config", "crd", "bases")}, extraCRDs...),
+			ErrorIfCRDPathMissing: true,
+		}
+		var err error
+		if cfg, err = env.Start(); err != nil {
+			fmt.Fprintln(os.Stderr, "starting envtest:", err)
+			return 1
+		}
+		defer func() { _ = env.Stop() }()
+	} else {
+		cfg = ctrl.GetConfigOrDie()
+	}
+
+	result, err := scale.Run(ctx, cfg, sc)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "scale run failed:", err)
+		return 1
+	}
+
+	fmt.Printf("services:              %d x %d flavours\n", result.Services, result.Flavours)
+	fmt.Printf("converged in:          %s\n", result.ConvergedIn.Round(time.Millisecond))
+	fmt.Printf("reconciles:            %v (%.1f/s)\n", result.Reconciles, result.ReconcilesPerSecond)
+	fmt.Printf("API requests:          %d (%.1f QPS, %.1f per service)\n", result.APIRequests, result.APIQPS, result.RequestsPerService())
+	fmt.Printf("peak heap:             %.1f MiB\n", float64(result.PeakHeapBytes)/(1<<20))
+
+	if output != "" {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err == nil {
+			err = os.WriteFile(output, data, 0o644)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "writing result:", err)
+			return 1
+		}
+	}
+	if err := result.Check(budget); err != nil {
+		fmt.Fprintln(os.Stderr, "scale budget exceeded:")
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
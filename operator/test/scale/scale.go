@@ -0,0 +1,432 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package scale runs the operator controllers in-process against a cluster
+// (envtest or kind), creates synthetic routed Services and measures how the
+// operator copes: time to converge, reconcile throughput, API server requests
+// and heap usage.
+package scale
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	goruntime "runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	kedav1alpha1 "github.com/kedacore/keda/v2/apis/keda/v1alpha1"
+	istionet "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	istiosecurity "istio.io/client-go/pkg/apis/security/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/config"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	schedulingv1alpha1 "github.com/belgio99/k8s-carbonrouter/operator/api/v1alpha1"
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/controller"
+	"github.com/belgio99/k8s-carbonrouter/operator/internal/engine"
+)
+
+const (
+	// The labels and condition the operator uses for routed Services.
+	parentServiceLabel  = "carbonrouter/parent-service"
+	precisionLabel      = "carbonstat.precision"
+	ConditionReconciled = "carbonrouter.io/Reconciled"
+
+	// createWorkers bounds the concurrent creations of synthetic objects.
+	createWorkers = 16
+	// pollInterval is how often convergence and heap usage are sampled.
+	pollInterval = 250 * time.Millisecond
+)
+
+// Scheme holds every type the operator reconciles.
+var Scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(Scheme))
+	utilruntime.Must(istionet.AddToScheme(Scheme))
+	utilruntime.Must(istiosecurity.AddToScheme(Scheme))
+	utilruntime.Must(schedulingv1alpha1.AddToScheme(Scheme))
+	utilruntime.Must(kedav1alpha1.AddToScheme(Scheme))
+}
+
+// Config sizes a scale run.
+type Config struct {
+	// Services is the number of synthetic routed Services.
+	Services int
+	// Flavours is the number of precision deployments per Service, at most 10.
+	Flavours int
+	// Namespace receives the synthetic objects. It is created if missing and
+	// deleted at the end of the run.
+	Namespace string
+	// Timeout bounds the wait for every Service to converge.
+	Timeout time.Duration
+}
+
+// Result holds the measurements of a scale run.
+type Result struct {
+	Services int `json:"services"`
+	Flavours int `json:"flavours"`
+	// ConvergedIn is the time from the creation of the first Service until
+	// every Service reports a successful reconcile.
+	ConvergedIn time.Duration `json:"convergedIn"`
+	// Reconciles counts the reconciles run until convergence, by controller.
+	Reconciles map[string]int `json:"reconciles"`
+	// ReconcilesPerSecond is the reconcile throughput of all controllers.
+	ReconcilesPerSecond float64 `json:"reconcilesPerSecond"`
+	// APIRequests counts the requests of the operator to the API server.
+	APIRequests int64 `json:"apiRequests"`
+	// APIQPS is the mean API request rate of the operator.
+	APIQPS float64 `json:"apiQPS"`
+	// PeakHeapBytes is the highest in-use heap of the process, which includes
+	// the cache of the controllers.
+	PeakHeapBytes uint64 `json:"peakHeapBytes"`
+}
+
+// RequestsPerService is the mean number of API requests spent per Service.
+func (r Result) RequestsPerService() float64 {
+	if r.Services == 0 {
+		return 0
+	}
+	return float64(r.APIRequests) / float64(r.Services)
+}
+
+// Budget bounds the results of a run; zero fields are not checked.
+type Budget struct {
+	MaxConvergence        time.Duration `json:"maxConvergence"`
+	MaxRequestsPerService float64       `json:"maxRequestsPerService"`
+	MaxPeakHeapBytes      uint64        `json:"maxPeakHeapBytes"`
+}
+
+// Check returns every budget the result exceeds.
+func (r Result) Check(b Budget) error {
+	var errs []error
+	if b.MaxConvergence > 0 && r.ConvergedIn > b.MaxConvergence {
+		errs = append(errs, fmt.Errorf("converged in %s, budget %s", r.ConvergedIn, b.MaxConvergence))
+	}
+	if b.MaxRequestsPerService > 0 && r.RequestsPerService() > b.MaxRequestsPerService {
+		errs = append(errs, fmt.Errorf("%.1f API requests per service, budget %.1f", r.RequestsPerService(), b.MaxRequestsPerService))
+	}
+	if b.MaxPeakHeapBytes > 0 && r.PeakHeapBytes > b.MaxPeakHeapBytes {
+		errs = append(errs, fmt.Errorf("peak heap %d bytes, budget %d", r.PeakHeapBytes, b.MaxPeakHeapBytes))
+	}
+	return errors.Join(errs...)
+}
+
+// countingTransport counts the requests sent to the API server.
+type countingTransport struct {
+	next  http.RoundTripper
+	count *atomic.Int64
+}
+
+func (t countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.count.Add(1)
+	return t.next.RoundTrip(req)
+}
+
+// Run starts the operator controllers against cfg, creates the synthetic
+// Services of sc and waits for all of them to converge. The controllers use the
+// embedded decision engine fed by a constant carbon forecast, so no decision
+// engine or carbon API is needed. The cluster must serve the Istio and KEDA
+// CRDs besides the operator ones.
+func Run(ctx context.Context, cfg *rest.Config, sc Config) (Result, error) {
+	if sc.Flavours < 1 || sc.Flavours > 10 {
+		return Result{}, fmt.Errorf("flavours must be between 1 and 10, got %d", sc.Flavours)
+	}
+	result := Result{Services: sc.Services, Flavours: sc.Flavours}
+
+	// Objects are created with a separate client, so only the requests of the
+	// operator are counted
+	setup, err := client.New(cfg, client.Options{Scheme: Scheme})
+	if err != nil {
+		return result, err
+	}
+	var requests atomic.Int64
+	operatorCfg := rest.CopyConfig(cfg)
+	operatorCfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return countingTransport{next: rt, count: &requests}
+	})
+
+	carbonAPI := httptest.NewServer(http.HandlerFunc(serveForecast))
+	defer carbonAPI.Close()
+
+	mgr, err := ctrl.NewManager(operatorCfg, ctrl.Options{
+		Scheme:                 Scheme,
+		Metrics:                metricsserver.Options{BindAddress: "0"},
+		HealthProbeBindAddress: "0",
+		// Runs share the controller-runtime registry within a process
+		Controller: config.Controller{SkipNameValidation: ptr.To(true)},
+	})
+	if err != nil {
+		return result, err
+	}
+	if err := (&controller.TrafficScheduleReconciler{
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		Engine:    engine.New(engine.Options{CarbonAPIURL: carbonAPI.URL}),
+		APIReader: mgr.GetAPIReader(),
+	}).SetupWithManager(mgr); err != nil {
+		return result, err
+	}
+	if err := (&controller.FlavourRouterReconciler{
+		Client:        mgr.GetClient(),
+		Scheme:        mgr.GetScheme(),
+		APIReader:     mgr.GetAPIReader(),
+		Inventory:     controller.NewResourceInventory(),
+		RouterSync:    controller.NewRouterSyncTracker(),
+		FlapThreshold: 5,
+		FlapWindow:    10 * time.Minute,
+	}).SetupWithManager(mgr); err != nil {
+		return result, err
+	}
+
+	mgrCtx, stop := context.WithCancel(ctx)
+	mgrDone := make(chan error, 1)
+	go func() { mgrDone <- mgr.Start(mgrCtx) }()
+	defer func() {
+		stop()
+		<-mgrDone
+	}()
+	if !mgr.GetCache().WaitForCacheSync(ctx) {
+		return result, errors.New("operator cache did not sync")
+	}
+
+	if err := createFixtures(ctx, setup, sc); err != nil {
+		return result, err
+	}
+	defer func() {
+		_ = setup.Delete(context.Background(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: sc.Namespace}})
+	}()
+
+	before := reconcileCounts()
+	requests.Store(0)
+	start := time.Now()
+	var peakHeap atomic.Uint64
+	sampleHeap := func() {
+		var stats goruntime.MemStats
+		goruntime.ReadMemStats(&stats)
+		if stats.HeapInuse > peakHeap.Load() {
+			peakHeap.Store(stats.HeapInuse)
+		}
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, sc.Timeout)
+	defer cancel()
+	services, err := createServices(waitCtx, setup, sc)
+	if err != nil {
+		return result, err
+	}
+	converged := 0
+	for converged < services {
+		sampleHeap()
+		if converged, err = countConverged(waitCtx, setup, sc.Namespace); err != nil {
+			return result, err
+		}
+		select {
+		case <-waitCtx.Done():
+			return result, fmt.Errorf("%d of %d services converged: %w", converged, services, waitCtx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
+	sampleHeap()
+
+	result.ConvergedIn = time.Since(start)
+	result.APIRequests = requests.Load()
+	result.APIQPS = float64(result.APIRequests) / result.ConvergedIn.Seconds()
+	result.PeakHeapBytes = peakHeap.Load()
+	result.Reconciles = map[string]int{}
+	total := 0
+	for name, count := range reconcileCounts() {
+		if delta := count - before[name]; delta > 0 {
+			result.Reconciles[name] = delta
+			total += delta
+		}
+	}
+	result.ReconcilesPerSecond = float64(total) / result.ConvergedIn.Seconds()
+	return result, nil
+}
+
+// createFixtures creates the namespace and the TrafficSchedule the synthetic
+// Services bind to.
+func createFixtures(ctx context.Context, c client.Client, sc Config) error {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: sc.Namespace}}
+	if err := c.Create(ctx, ns); client.IgnoreAlreadyExists(err) != nil {
+		return err
+	}
+	ts := &schedulingv1alpha1.TrafficSchedule{ObjectMeta: metav1.ObjectMeta{Name: "scale", Namespace: sc.Namespace}}
+	return client.IgnoreAlreadyExists(c.Create(ctx, ts))
+}
+
+// createServices creates the routed Services with their precision deployments
+// and returns how many were created.
+func createServices(ctx context.Context, c client.Client, sc Config) (int, error) {
+	names := make(chan string)
+	errs := make(chan error, createWorkers)
+	var wg sync.WaitGroup
+	for range createWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				if err := createService(ctx, c, sc, name); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	created := 0
+feed:
+	for i := range sc.Services {
+		select {
+		case names <- fmt.Sprintf("svc-%04d", i):
+			created++
+		case err := <-errs:
+			close(names)
+			wg.Wait()
+			return created, err
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(names)
+	wg.Wait()
+	select {
+	case err := <-errs:
+		return created, err
+	default:
+	}
+	return created, ctx.Err()
+}
+
+func createService(ctx context.Context, c client.Client, sc Config, name string) error {
+	for i := range sc.Flavours {
+		precision := strconv.Itoa(100 - 10*i)
+		labels := map[string]string{"app": name, parentServiceLabel: name, precisionLabel: precision}
+		dep := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name + "-" + precision, Namespace: sc.Namespace, Labels: labels},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: ptr.To[int32](0),
+				Selector: &metav1.LabelSelector{MatchLabels: labels},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: labels},
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{
+						Name:  "app",
+						Image: "registry.k8s.io/pause:3.10",
+					}}},
+				},
+			},
+		}
+		if err := c.Create(ctx, dep); client.IgnoreAlreadyExists(err) != nil {
+			return err
+		}
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: sc.Namespace},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": name},
+			Ports:    []corev1.ServicePort{{Name: "http", Port: 80}},
+		},
+	}
+	if err := c.Create(ctx, svc); client.IgnoreAlreadyExists(err) != nil {
+		return err
+	}
+	routed := &schedulingv1alpha1.CarbonRoutedService{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: sc.Namespace},
+		Spec:       schedulingv1alpha1.CarbonRoutedServiceSpec{ServiceName: name},
+	}
+	return client.IgnoreAlreadyExists(c.Create(ctx, routed))
+}
+
+// countConverged counts the Services of namespace whose last reconcile went
+// through.
+func countConverged(ctx context.Context, c client.Client, namespace string) (int, error) {
+	var list corev1.ServiceList
+	if err := c.List(ctx, &list, client.InNamespace(namespace)); err != nil {
+		return 0, err
+	}
+	converged := 0
+	for i := range list.Items {
+		if meta.IsStatusConditionTrue(list.Items[i].Status.Conditions, ConditionReconciled) {
+			converged++
+		}
+	}
+	return converged, nil
+}
+
+// reconcileCounts reads the reconciles run so far by controller.
+func reconcileCounts() map[string]int {
+	counts := map[string]int{}
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		return counts
+	}
+	for _, family := range families {
+		if family.GetName() != "controller_runtime_reconcile_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "controller" {
+					counts[label.GetValue()] += int(metric.GetCounter().GetValue())
+				}
+			}
+		}
+	}
+	return counts
+}
+
+// serveForecast answers the embedded engine with a flat forecast in the format
+// of the Carbon Intensity API.
+func serveForecast(w http.ResponseWriter, _ *http.Request) {
+	type intensity struct {
+		Forecast float64 `json:"forecast"`
+		Index    string  `json:"index"`
+	}
+	type slot struct {
+		From      string    `json:"from"`
+		To        string    `json:"to"`
+		Intensity intensity `json:"intensity"`
+	}
+	start := time.Now().UTC().Truncate(30 * time.Minute)
+	data := make([]slot, 0, 96)
+	for i := range 96 {
+		from := start.Add(time.Duration(i) * 30 * time.Minute)
+		data = append(data, slot{
+			From:      from.Format(time.RFC3339),
+			To:        from.Add(30 * time.Minute).Format(time.RFC3339),
+			Intensity: intensity{Forecast: 200, Index: "moderate"},
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+}
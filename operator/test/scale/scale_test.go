@@ -0,0 +1,128 @@
+/*
+Copyright 2025 belgio99.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scale
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestResultCheck(t *testing.T) {
+	result := Result{Services: 10, ConvergedIn: 2 * time.Minute, APIRequests: 900, PeakHeapBytes: 300 << 20}
+	if got := result.RequestsPerService(); got != 90 {
+		t.Errorf("got %v requests per service, want 90", got)
+	}
+	if got := (Result{}).RequestsPerService(); got != 0 {
+		t.Errorf("no services: got %v requests per service, want 0", got)
+	}
+
+	if err := result.Check(Budget{}); err != nil {
+		t.Errorf("empty budget: got %v", err)
+	}
+	if err := result.Check(Budget{MaxConvergence: 5 * time.Minute, MaxRequestsPerService: 100, MaxPeakHeapBytes: 512 << 20}); err != nil {
+		t.Errorf("within budget: got %v", err)
+	}
+	err := result.Check(Budget{MaxConvergence: time.Minute, MaxRequestsPerService: 80, MaxPeakHeapBytes: 512 << 20})
+	if err == nil {
+		t.Fatal("exceeded budget accepted")
+	}
+	if msg := err.Error(); !strings.Contains(msg, "converged in 2m0s") || !strings.Contains(msg, "90.0 API requests per service") || strings.Contains(msg, "heap") {
+		t.Errorf("got %q, want the convergence and request budgets only", msg)
+	}
+}
+
+func TestCountingTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+	var count atomic.Int64
+	httpClient := &http.Client{Transport: countingTransport{next: http.DefaultTransport, count: &count}}
+	for range 3 {
+		resp, err := httpClient.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if count.Load() != 3 {
+		t.Errorf("got %d requests, want 3", count.Load())
+	}
+}
+
+func TestCountConverged(t *testing.T) {
+	service := func(namespace, name string, status metav1.ConditionStatus) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Status:     corev1.ServiceStatus{Conditions: []metav1.Condition{{Type: ConditionReconciled, Status: status}}},
+		}
+	}
+	c := fake.NewClientBuilder().WithScheme(Scheme).WithObjects(
+		service("scale", "a", metav1.ConditionTrue),
+		service("scale", "b", metav1.ConditionFalse),
+		service("scale", "c", metav1.ConditionTrue),
+		service("other", "d", metav1.ConditionTrue),
+	).Build()
+	got, err := countConverged(context.Background(), c, "scale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 2 {
+		t.Errorf("got %d converged Services, want 2", got)
+	}
+}
+
+func TestServeForecast(t *testing.T) {
+	rec := httptest.NewRecorder()
+	serveForecast(rec, httptest.NewRequest(http.MethodGet, "/intensity", nil))
+	var body struct {
+		Data []struct {
+			From      string `json:"from"`
+			To        string `json:"to"`
+			Intensity struct {
+				Forecast float64 `json:"forecast"`
+			} `json:"intensity"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Data) != 96 {
+		t.Fatalf("got %d slots, want two days of half hours", len(body.Data))
+	}
+	for i, slot := range body.Data {
+		from, err := time.Parse(time.RFC3339, slot.From)
+		if err != nil {
+			t.Fatal(err)
+		}
+		to, _ := time.Parse(time.RFC3339, slot.To)
+		if to.Sub(from) != 30*time.Minute || slot.Intensity.Forecast != 200 {
+			t.Errorf("slot %d: got %+v, want a flat half hour", i, slot)
+		}
+		if i > 0 && slot.From != body.Data[i-1].To {
+			t.Errorf("slot %d starts at %s, want the end of the previous one", i, slot.From)
+		}
+	}
+}